@@ -3,4 +3,4 @@ sleep 1s
 screen -r play-bin -X kill
 screen -U -A -md -S play-bin
 screen -r play-bin -X stuff "cd $(dirname $0)/\n"
-screen -r play-bin -X stuff "while :; do go run .; done\n"
\ No newline at end of file
+screen -r play-bin -X stuff "while :; do go run ./cmd/playbin; done\n"
\ No newline at end of file
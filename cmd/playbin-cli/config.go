@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/play-bin/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// MARK: newConfigCmd()
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "設定ファイルを扱う",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "サーバーのディスク上の設定ファイルを検証する (エラーがある場合は終了コード 1)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			result, err := c.ValidateConfig(cmd.Context())
+			if err != nil {
+				return err
+			}
+			printIssues(result.Issues)
+			if !result.Valid {
+				return errors.New(result.File + " has validation errors")
+			}
+			fmt.Printf("%s is valid\n", result.File)
+			return nil
+		},
+	})
+	return cmd
+}
+
+// printIssues は設定の検証で見つかった問題を標準エラーへ表示する。
+func printIssues(issues []client.ConfigIssue) {
+	for _, issue := range issues {
+		location := issue.Path
+		if issue.File != "" {
+			location = issue.File + ": " + location
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", issue.Level, location, issue.Message)
+	}
+}
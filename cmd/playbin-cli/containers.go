@@ -0,0 +1,494 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/play-bin/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// MARK: newListCmd()
+func newListCmd() *cobra.Command {
+	var opts client.ListOptions
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "コンテナの一覧を表示する",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			containers, _, err := c.ListContainers(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if opts.Stats {
+				fmt.Fprintln(tw, "NAME\tHOST\tSTATE\tUPTIME\tCPU\tMEMORY")
+			} else {
+				fmt.Fprintln(tw, "NAME\tHOST\tSTATE\tLAST\tACTIONS")
+			}
+			for _, ct := range containers {
+				host := firstNonEmpty(ct.Host, "-")
+				if !opts.Stats {
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", ct.Name(), host, ct.State, lastSummary(ct), strings.Join(ct.Actions, ","))
+					continue
+				}
+				uptime, cpu, mem := "-", "-", "-"
+				if !ct.StartedAt.IsZero() {
+					uptime = time.Since(ct.StartedAt).Truncate(time.Second).String()
+				}
+				if ct.Stats != nil {
+					cpu = fmt.Sprintf("%.1f%%", ct.Stats.CPUPercent)
+					mem = fmt.Sprintf("%s / %s", formatBytes(ct.Stats.MemoryUsage), formatBytes(ct.Stats.MemoryLimit))
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", ct.Name(), host, ct.State, uptime, cpu, mem)
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().StringSliceVar(&opts.States, "state", nil, "状態で絞り込む (例: running,exited)")
+	cmd.Flags().StringVar(&opts.Name, "name", "", "名前の部分一致で絞り込む")
+	cmd.Flags().StringSliceVar(&opts.Tags, "tag", nil, "タグで絞り込む (例: events,survival-*)")
+	cmd.Flags().StringVar(&opts.Sort, "sort", "", "並び順 (name / state / uptime。先頭に - で降順)")
+	cmd.Flags().BoolVar(&opts.Stats, "stats", false, "起動中のコンテナの稼働時間と CPU / メモリ使用量を表示する")
+	return cmd
+}
+
+// lastSummary は停止中であれば停止理由を、それ以外は最後の操作を短く表す。
+func lastSummary(ct client.Container) string {
+	if ct.State != "running" && ct.LastStop != nil {
+		if ct.LastStop.Reason == "requested" {
+			return fmt.Sprintf("%s by %s", ct.LastStop.Action, firstNonEmpty(ct.LastStop.User, ct.LastStop.Via, "-"))
+		}
+		return fmt.Sprintf("%s (exit %d)", ct.LastStop.Reason, ct.LastStop.ExitCode)
+	}
+	if a := ct.LastAction; a != nil {
+		return fmt.Sprintf("%s by %s", a.Action, firstNonEmpty(a.User, a.Via, "-"))
+	}
+	return "-"
+}
+
+// MARK: newActionCmd()
+// 起動・停止等の操作を実行し、完了までジョブの進捗ログを表示する。"tag:<pattern>" を指定した場合はタグが一致する全てのサーバーへ実行する。
+func newActionCmd(action, short string) *cobra.Command {
+	var opts client.ActionOptions
+	cmd := &cobra.Command{
+		Use:   action + " <server|tag:pattern>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tag, ok := strings.CutPrefix(args[0], "tag:"); ok {
+				return runBulkAction(cmd, tag, action, opts)
+			}
+			return runAction(cmd, args[0], action, opts)
+		},
+	}
+	if action == client.ActionStart {
+		cmd.Flags().BoolVar(&opts.WaitReady, "wait-ready", false, "サーバーの準備完了 (ready 設定) まで待つ")
+	}
+	return cmd
+}
+
+// MARK: newRestoreCmd()
+func newRestoreCmd() *cobra.Command {
+	var generation string
+	cmd := &cobra.Command{
+		Use:   "restore <server>",
+		Short: "バックアップから復元する (世代は backups で確認)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAction(cmd, args[0], client.ActionRestore, client.ActionOptions{Generation: generation})
+		},
+	}
+	cmd.Flags().StringVarP(&generation, "generation", "g", "", "復元する世代 (必須)")
+	cmd.MarkFlagRequired("generation")
+	return cmd
+}
+
+// runAction は操作を実行し、ジョブのログを追加された分だけ表示する。
+func runAction(cmd *cobra.Command, server, action string, opts client.ActionOptions) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	printed := 0
+	opts.OnProgress = func(job client.Job) {
+		for _, line := range job.Log[min(printed, len(job.Log)):] {
+			fmt.Printf("  %s\n", line)
+		}
+		printed = len(job.Log)
+	}
+	fmt.Printf("%s %s...\n", action, server)
+	start := time.Now()
+	job, err := c.RunAction(cmd.Context(), server, action, &opts)
+	if err != nil {
+		return err
+	}
+	if job.ID != "" {
+		fmt.Printf("%s %s: %s (job %s, %s)\n", action, server, job.Status, job.ID, time.Since(start).Truncate(time.Millisecond))
+	} else {
+		fmt.Printf("%s %s: done (%s)\n", action, server, time.Since(start).Truncate(time.Millisecond))
+	}
+	return nil
+}
+
+// runBulkAction はタグが一致するサーバーへ操作を実行し、サーバーごとの結果を表示する。失敗したサーバーがあればエラーを返す。
+func runBulkAction(cmd *cobra.Command, tag, action string, opts client.ActionOptions) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s tag:%s...\n", action, tag)
+	start := time.Now()
+	results, err := c.RunBulkAction(cmd.Context(), tag, action, &opts)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, res := range results {
+		if res.Error != "" {
+			failed++
+			fmt.Printf("  %s: failed: %s\n", res.Server, res.Error)
+		} else {
+			fmt.Printf("  %s: done\n", res.Server)
+		}
+	}
+	fmt.Printf("%s tag:%s: %d/%d succeeded (%s)\n", action, tag, len(results)-failed, len(results), time.Since(start).Truncate(time.Millisecond))
+	if failed > 0 {
+		return fmt.Errorf("%s failed on %d server(s)", action, failed)
+	}
+	return nil
+}
+
+// MARK: newBackupsCmd()
+func newBackupsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backups <server>",
+		Short: "バックアップの世代を、実行の経路・ユーザー・所要時間・サイズ・結果と共に新しい順で表示する",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			backups, err := c.ListBackups(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "GENERATION\tSTATUS\tVIA\tUSER\tDURATION\tSIZE\tCHANGED")
+			for _, b := range backups {
+				if b.Status == "" {
+					// カタログの導入前の世代等、記録の無い世代は世代名のみを表示する。
+					fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t-\n", b.Generation)
+					continue
+				}
+				duration := (time.Duration(b.Duration) * time.Millisecond).Round(time.Second)
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", b.Generation, b.Status, firstNonEmpty(b.Via, "-"), firstNonEmpty(b.User, "-"),
+					duration, formatBytes(uint64(max(b.TotalSize, 0))), b.ChangedFiles)
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+// MARK: newLogsCmd()
+func newLogsCmd() *cobra.Command {
+	var tail int
+	var follow, timestamps bool
+	var since, until, level string
+	cmd := &cobra.Command{
+		Use:   "logs <server>",
+		Short: "コンテナのログを表示する",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if follow {
+				// Ctrl+C で中断するまで出力を追従する。
+				return c.FollowLogs(cmd.Context(), args[0], tail, os.Stdout)
+			}
+			if since != "" || until != "" || timestamps || level != "" {
+				// 期間を指定した場合は、tail を省略すると範囲内の全てを出力する。
+				opts := client.LogOptions{Timestamps: timestamps, Level: level}
+				if cmd.Flags().Changed("tail") {
+					opts.Tail = tail
+				}
+				if opts.Since, err = parseLogTime(since); err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+				if opts.Until, err = parseLogTime(until); err != nil {
+					return fmt.Errorf("--until: %w", err)
+				}
+				return c.DownloadLogs(cmd.Context(), args[0], opts, os.Stdout)
+			}
+			logs, err := c.Logs(cmd.Context(), args[0], tail)
+			if err != nil {
+				return err
+			}
+			fmt.Print(logs)
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&tail, "tail", "n", 100, "表示する末尾の行数")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "以降の出力を追従して表示する")
+	cmd.Flags().StringVar(&since, "since", "", "この時刻以降のログのみ (例: 2h で 2 時間前、または RFC 3339 の時刻)")
+	cmd.Flags().StringVar(&until, "until", "", "この時刻以前のログのみ (--since と同じ形式)")
+	cmd.Flags().BoolVarP(&timestamps, "timestamps", "t", false, "各行に時刻を付与する")
+	cmd.Flags().StringVar(&level, "level", "", "指定したレベル (debug / info / warn / error) 以上の行のみ (サーバーの logFormat が必要)")
+	return cmd
+}
+
+// MARK: newGrepCmd()
+func newGrepCmd() *cobra.Command {
+	var regex, all bool
+	var since, until string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "grep <server> <pattern>",
+		Short: "保存済みのログと Docker のログを検索する",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			opts := client.LogSearchOptions{Query: args[1], Limit: limit}
+			if regex {
+				opts.Regex = args[1]
+			}
+			if opts.Since, err = parseLogTime(since); err != nil {
+				return fmt.Errorf("--since: %w", err)
+			}
+			if opts.Until, err = parseLogTime(until); err != nil {
+				return fmt.Errorf("--until: %w", err)
+			}
+			for {
+				result, err := c.SearchLogs(cmd.Context(), args[0], opts)
+				if err != nil {
+					return err
+				}
+				for _, m := range result.Matches {
+					fmt.Printf("%s %s\n", m.Time.Local().Format(time.DateTime), m.Text)
+				}
+				if result.Next == "" {
+					return nil
+				}
+				if !all {
+					fmt.Fprintln(os.Stderr, "(件数の上限に達しました。--all で全ての結果を表示します)")
+					return nil
+				}
+				opts.Cursor = result.Next
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&regex, "regex", "E", false, "pattern を正規表現として扱う")
+	cmd.Flags().BoolVar(&all, "all", false, "上限を超える結果も続けて取得し、全て表示する")
+	cmd.Flags().StringVar(&since, "since", "", "この時刻以降の行のみ (例: 2h で 2 時間前、または RFC 3339 の時刻)")
+	cmd.Flags().StringVar(&until, "until", "", "この時刻以前の行のみ (--since と同じ形式)")
+	cmd.Flags().IntVar(&limit, "limit", 0, "1 回の要求で取得する件数 (省略時はサーバーの既定値)")
+	return cmd
+}
+
+// MARK: newArchiveCmd()
+func newArchiveCmd() *cobra.Command {
+	var file, grep, regex, since, until string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "archive <server>",
+		Short: "ディスクに保存したログを一覧・検索・表示する (logArchive が必要)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if file != "" {
+				return c.DownloadArchive(cmd.Context(), args[0], file, os.Stdout)
+			}
+			if grep != "" || regex != "" {
+				opts := client.LogSearchOptions{Query: grep, Regex: regex, Limit: limit}
+				if opts.Since, err = parseLogTime(since); err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+				if opts.Until, err = parseLogTime(until); err != nil {
+					return fmt.Errorf("--until: %w", err)
+				}
+				result, err := c.SearchArchive(cmd.Context(), args[0], opts)
+				if err != nil {
+					return err
+				}
+				for _, m := range result.Matches {
+					fmt.Printf("%s:%d: %s\n", m.File, m.Line, m.Text)
+				}
+				if result.Truncated {
+					fmt.Fprintln(os.Stderr, "(件数の上限に達しました。--since で範囲を絞り込んでください)")
+				}
+				return nil
+			}
+
+			files, err := c.ArchivedLogs(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tSIZE\tMODIFIED")
+			for _, f := range files {
+				fmt.Fprintf(tw, "%s\t%d\t%s\n", f.Name, f.Size, f.ModTime.Local().Format(time.DateTime))
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&file, "file", "", "表示するファイル (一覧の NAME)")
+	cmd.Flags().StringVar(&grep, "grep", "", "部分一致で検索する文字列")
+	cmd.Flags().StringVar(&regex, "regex", "", "正規表現で検索する")
+	cmd.Flags().StringVar(&since, "since", "", "この時刻以降の行のみ検索する (例: 2h で 2 時間前、または RFC 3339 の時刻)")
+	cmd.Flags().StringVar(&until, "until", "", "この時刻以前の行のみ検索する (--since と同じ形式)")
+	cmd.Flags().IntVar(&limit, "limit", 0, "検索結果の上限 (省略時はサーバーの既定値)")
+	return cmd
+}
+
+// parseLogTime は現在からの相対時間 (例: 30m) または RFC 3339 の時刻を解釈する。空文字はゼロ値とする。
+func parseLogTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// MARK: newCmdCmd()
+func newCmdCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cmd <server> <command...>",
+		Short: "起動中のコンテナの標準入力へコマンドを送信する",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			return c.SendCommand(cmd.Context(), args[0], strings.Join(args[1:], " "))
+		},
+	}
+}
+
+// MARK: newJobsCmd()
+func newJobsCmd() *cobra.Command {
+	var server string
+	var cancel bool
+	cmd := &cobra.Command{
+		Use:   "jobs [job-id]",
+		Short: "直近のジョブを表示する (ID を指定した場合はそのログを表示する)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if cancel {
+				if len(args) != 1 {
+					return fmt.Errorf("--cancel requires a job id")
+				}
+				if err := c.CancelJob(cmd.Context(), args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("%s: cancel requested\n", args[0])
+				return nil
+			}
+			if len(args) == 1 {
+				job, err := c.GetJob(cmd.Context(), args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s %s %s: %s\n", job.ID, job.Action, job.Server, job.Status)
+				if job.Error != "" {
+					fmt.Printf("error: %s\n", job.Error)
+				}
+				for _, line := range job.Log {
+					fmt.Printf("  %s\n", line)
+				}
+				return nil
+			}
+
+			jobs, err := c.ListJobs(cmd.Context(), client.JobFilter{Server: server})
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tSERVER\tACTION\tSTATUS\tSTARTED\tDURATION")
+			for _, job := range jobs {
+				duration := "-"
+				if !job.FinishedAt.IsZero() {
+					duration = job.FinishedAt.Sub(job.StartedAt).Truncate(time.Millisecond).String()
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Server, job.Action, job.Status, job.StartedAt.Local().Format(time.DateTime), duration)
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "", "サーバーで絞り込む")
+	cmd.Flags().BoolVar(&cancel, "cancel", false, "実行中のジョブ (リストア等) を中断する")
+	return cmd
+}
+
+// formatBytes はバイト数を人が読みやすい単位で表す。
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// MARK: newShareCmd()
+func newShareCmd() *cobra.Command {
+	var duration time.Duration
+	var revoke bool
+	cmd := &cobra.Command{
+		Use:   "share <server>",
+		Short: "ログと統計情報を閲覧できる期限付きの共有リンクを発行する",
+		Example: `  playbin-cli share mc --for 2h
+  playbin-cli share mc --revoke`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if revoke {
+				if err := c.RevokeShareLinks(cmd.Context(), args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("All share links for %s revoked\n", args[0])
+				return nil
+			}
+			link, err := c.CreateShareLink(cmd.Context(), args[0], duration)
+			if err != nil {
+				return err
+			}
+			fmt.Println(link.URL)
+			fmt.Fprintf(os.Stderr, "expires at %s\n", link.ExpiresAt.Local().Format(time.DateTime))
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&duration, "for", time.Hour, "リンクの有効期間 (最長 168h)")
+	cmd.Flags().BoolVar(&revoke, "revoke", false, "発行済みのリンクを全て無効にする")
+	return cmd
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/play-bin/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// MARK: newSyncCmd()
+func newSyncCmd() *cobra.Command {
+	var opts client.SyncOptions
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "sync <local-dir> <server>/<mount>/<dir>",
+		Short: "ローカルのディレクトリをサーバーへ同期する (差分のみを送信)",
+		Example: `  playbin-cli sync ./mods mc/data/mods --delete
+  playbin-cli sync ./config mc/data/config --exclude '*.local.json' --dry-run`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			plan, result, err := c.SyncDir(cmd.Context(), args[0], args[1], opts, dryRun)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				for _, p := range plan.Upload {
+					fmt.Println("upload", p)
+				}
+				for _, p := range plan.Delete {
+					fmt.Println("delete", p)
+				}
+				fmt.Fprintf(os.Stderr, "%d to upload, %d to delete, %d unchanged (dry run)\n", len(plan.Upload), len(plan.Delete), plan.Unchanged)
+				return nil
+			}
+			for _, p := range result.Updated {
+				fmt.Println("updated", p)
+			}
+			for _, p := range result.Deleted {
+				fmt.Println("deleted", p)
+			}
+			fmt.Fprintf(os.Stderr, "%d updated, %d deleted, %d unchanged\n", len(result.Updated), len(result.Deleted), result.Unchanged)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&opts.Delete, "delete", false, "ローカルに無いファイルをサーバーから削除する")
+	cmd.Flags().StringSliceVar(&opts.Exclude, "exclude", nil, "比較と削除の対象外とするパターン (例: '*.log',world)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "送信・削除するファイルを表示するのみで、適用しない")
+	return cmd
+}
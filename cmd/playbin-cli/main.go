@@ -0,0 +1,99 @@
+// Command playbin-cli は play-bin の HTTP API を利用する管理用 CLI。
+// Web UI を開けないヘッドレスなサーバーでも、SSH 越しにコンテナの操作・ログの参照・ユーザー管理・設定の検証を行えるようにする。
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/play-bin/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// MARK: globalFlags
+// 全てのサブコマンドで共通の接続先の指定。省略時は環境変数、次に login で保存したセッションを使用する。
+type globalFlags struct {
+	url   string
+	token string
+}
+
+var flags globalFlags
+
+// MARK: main()
+func main() {
+	root := &cobra.Command{
+		Use:           "playbin-cli",
+		Short:         "play-bin の管理用 CLI",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&flags.url, "url", "", "play-bin の URL (環境変数 PLAYBIN_URL。省略時は login で保存した URL)")
+	root.PersistentFlags().StringVar(&flags.token, "token", "", "セッショントークン (環境変数 PLAYBIN_TOKEN。省略時は login で保存したトークン)")
+
+	root.AddCommand(
+		newLoginCmd(),
+		newLogoutCmd(),
+		newWhoamiCmd(),
+		newPasswdCmd(),
+		newListCmd(),
+		newActionCmd(client.ActionStart, "コンテナを起動する"),
+		newActionCmd(client.ActionStop, "コンテナを停止する"),
+		newActionCmd(client.ActionKill, "コンテナを強制停止する"),
+		newActionCmd(client.ActionBackup, "バックアップを作成する"),
+		newRestoreCmd(),
+		newActionCmd(client.ActionRemove, "コンテナを削除する"),
+		newBackupsCmd(),
+		newLogsCmd(),
+		newGrepCmd(),
+		newArchiveCmd(),
+		newCmdCmd(),
+		newJobsCmd(),
+		newShareCmd(),
+		newSyncCmd(),
+		newUserCmd(),
+		newConfigCmd(),
+	)
+
+	// Ctrl+C でログの追従や操作の待機を中断できるよう、シグナルでコンテキストをキャンセルする。
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := root.ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		if client.IsCode(err, "unauthenticated") {
+			fmt.Fprintln(os.Stderr, "hint: run `playbin-cli login` to start a new session")
+		}
+		os.Exit(1)
+	}
+}
+
+// MARK: newClient()
+// フラグ・環境変数・保存済みのセッションの順に接続先を決定し、クライアントを作成する。
+func newClient() (*client.Client, error) {
+	session, err := loadSession()
+	if err != nil {
+		return nil, err
+	}
+	baseURL := firstNonEmpty(flags.url, os.Getenv("PLAYBIN_URL"), session.URL)
+	if baseURL == "" {
+		return nil, errors.New("no server url (use --url, PLAYBIN_URL or `playbin-cli login`)")
+	}
+	token := firstNonEmpty(flags.token, os.Getenv("PLAYBIN_TOKEN"))
+	// 保存済みのトークンは、同じ URL へ接続する場合のみ使用する。
+	if token == "" && baseURL == session.URL {
+		token = session.Token
+	}
+	return client.NewClient(baseURL, client.WithToken(token))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/play-bin/pkg/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// MARK: session
+// login で保存する接続先とトークン。次回以降のコマンドで再利用する。
+type session struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+// sessionPath は保存先のファイル (例: ~/.config/playbin-cli/session.json) を返す。
+func sessionPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "playbin-cli", "session.json"), nil
+}
+
+// loadSession は保存済みのセッションを読み込む。未保存の場合はゼロ値を返す。
+func loadSession() (session, error) {
+	var s session
+	path, err := sessionPath()
+	if err != nil {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// saveSession はトークンを含むため、所有者のみ読み書きできる権限で保存する。
+func saveSession(s session) (string, error) {
+	path, err := sessionPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// MARK: newLoginCmd()
+func newLoginCmd() *cobra.Command {
+	var username string
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "login --url <url> [--user <name>]",
+		Short: "ログインし、接続先とトークンを保存する",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			saved, err := loadSession()
+			if err != nil {
+				return err
+			}
+			baseURL := firstNonEmpty(flags.url, os.Getenv("PLAYBIN_URL"), saved.URL)
+			if baseURL == "" {
+				return errors.New("no server url (use --url or PLAYBIN_URL)")
+			}
+			c, err := client.NewClient(baseURL)
+			if err != nil {
+				return err
+			}
+
+			if username == "" {
+				if username, err = prompt("Username: "); err != nil {
+					return err
+				}
+			}
+			password, err := readPassword("Password: ", passwordStdin)
+			if err != nil {
+				return err
+			}
+			if err := c.Login(cmd.Context(), username, password); err != nil {
+				return err
+			}
+
+			path, err := saveSession(session{URL: baseURL, Username: username, Token: c.Token()})
+			if err != nil {
+				return fmt.Errorf("failed to save session: %w", err)
+			}
+			fmt.Printf("Logged in to %s as %s (session saved to %s)\n", baseURL, username, path)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&username, "user", "u", "", "ユーザー名 (省略時は入力を求める)")
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "パスワードを標準入力から読み込む (スクリプト用)")
+	return cmd
+}
+
+// MARK: newLogoutCmd()
+// サーバーにはログアウトの API が無いため、保存したセッションを削除する。
+func newLogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "保存したセッションを削除する",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := sessionPath()
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			fmt.Println("Session removed")
+			return nil
+		},
+	}
+}
+
+// MARK: newWhoamiCmd()
+func newWhoamiCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "whoami",
+		Short: "ログイン中のユーザーとサーバーごとの権限を表示する",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			me, err := c.Me(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Println(me.Username)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "SERVER\tPERMISSIONS")
+			for _, server := range slices.Sorted(maps.Keys(me.Servers)) {
+				fmt.Fprintf(tw, "%s\t%s\n", server, strings.Join(me.Servers[server], ","))
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+// MARK: newPasswdCmd()
+// 自身のパスワードを変更する。他のユーザーのパスワードは user passwd で変更する。
+func newPasswdCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "passwd",
+		Short: "自身のパスワードを変更する",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			current, err := readPassword("Current password: ", false)
+			if err != nil {
+				return err
+			}
+			password, err := readNewPassword(false)
+			if err != nil {
+				return err
+			}
+			if err := c.ChangePassword(cmd.Context(), current, password); err != nil {
+				return err
+			}
+			fmt.Println("Password changed (other sessions have been signed out)")
+			return nil
+		},
+	}
+}
+
+// stdin は問い合わせとパスワードの読み込みで共有する。個別にバッファすると、パイプで渡された後続の行を読み落とすため。
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt は標準エラーへ問い合わせを表示し、標準入力から 1 行を読み込む。
+func prompt(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPassword はパスワードを読み込む。端末からの入力は画面に表示しない。
+// fromStdin が指定された場合や標準入力が端末でない場合は、標準入力の 1 行目をそのまま使用する。
+func readPassword(label string, fromStdin bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if fromStdin || !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.New("no password on stdin")
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, label)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(b), err
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/play-bin/pkg/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// MARK: newUserCmd()
+// 設定ファイルのユーザー定義を /api/config/users 経由で変更する。config.read / config.write 権限が必要。
+func newUserCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "ユーザーを管理する",
+	}
+	cmd.AddCommand(newUserListCmd(), newUserAddCmd(), newUserPasswdCmd(), newUserGrantCmd(), newUserRevokeCmd(), newUserRemoveCmd(),
+		newUserGrantsCmd(), newUserUngrantCmd())
+	return cmd
+}
+
+func newUserListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "ユーザーと権限の一覧を表示する",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			users, err := c.ListUsers(cmd.Context())
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "USER\tSERVER\tPERMISSIONS")
+			for _, name := range slices.Sorted(maps.Keys(users)) {
+				perms := users[name].Permissions
+				if len(perms) == 0 {
+					fmt.Fprintf(tw, "%s\t-\t-\n", name)
+					continue
+				}
+				for _, server := range slices.Sorted(maps.Keys(perms)) {
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", name, server, strings.Join(perms[server], ","))
+				}
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+func newUserAddCmd() *cobra.Command {
+	var grants []string
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "add <user>",
+		Short: "ユーザーを追加する",
+		Example: `  playbin-cli user add alice --grant mc=container.read,container.execute.start
+  echo "$PW" | playbin-cli user add bot --password-stdin --grant '*=container.read'`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			permissions, err := parseGrants(grants)
+			if err != nil {
+				return err
+			}
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			users, err := c.ListUsers(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if _, ok := users[args[0]]; ok {
+				return fmt.Errorf("user %q already exists", args[0])
+			}
+			password, err := readNewPassword(passwordStdin)
+			if err != nil {
+				return err
+			}
+			hash, err := hashPassword(password)
+			if err != nil {
+				return err
+			}
+			result, err := c.PatchUser(cmd.Context(), args[0], map[string]any{"password": hash, "permissions": permissions})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("User %s added (%s)\n", args[0], result.File)
+			printIssues(result.Issues)
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&grants, "grant", nil, "付与する権限 (<server>=<perm>[,<perm>...]。複数回指定できる)")
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "パスワードを標準入力から読み込む (スクリプト用)")
+	return cmd
+}
+
+func newUserPasswdCmd() *cobra.Command {
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "passwd <user>",
+		Short: "ユーザーのパスワードを変更する",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := requireUser(cmd, c, args[0]); err != nil {
+				return err
+			}
+			password, err := readNewPassword(passwordStdin)
+			if err != nil {
+				return err
+			}
+			hash, err := hashPassword(password)
+			if err != nil {
+				return err
+			}
+			if _, err := c.PatchUser(cmd.Context(), args[0], map[string]any{"password": hash}); err != nil {
+				return err
+			}
+			fmt.Printf("Password of %s changed\n", args[0])
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "パスワードを標準入力から読み込む (スクリプト用)")
+	return cmd
+}
+
+func newUserGrantCmd() *cobra.Command {
+	var duration time.Duration
+	var reason string
+	cmd := &cobra.Command{
+		Use:   "grant <user> <server> <perm...>",
+		Short: "ユーザーに権限を付与する (--for を指定した場合は期限付き)",
+		Example: `  playbin-cli user grant alice mc container.read container.execute.start
+  playbin-cli user grant mod mc container.write --for 3h --reason "event moderation"`,
+		Args: cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration > 0 {
+				// 期限付きの権限は設定ファイルを変更せず、/api/admin/grants で付与する。
+				c, err := newClient()
+				if err != nil {
+					return err
+				}
+				grant, err := c.CreateGrant(cmd.Context(), args[0], args[1], args[2:], duration, reason)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Granted %s on %s to %s until %s (grant %s)\n", strings.Join(grant.Permissions, ","), grant.Server, grant.User, grant.ExpiresAt.Local().Format(time.DateTime), grant.ID)
+				return nil
+			}
+			return updatePermissions(cmd, args[0], args[1], func(perms []string) []string {
+				for _, p := range args[2:] {
+					if !slices.Contains(perms, p) {
+						perms = append(perms, p)
+					}
+				}
+				return perms
+			})
+		},
+	}
+	cmd.Flags().DurationVar(&duration, "for", 0, "期限付きで付与する期間 (例: 2h。最長 720h)。admin.grants 権限が必要")
+	cmd.Flags().StringVar(&reason, "reason", "", "期限付きの付与の理由 (記録用)")
+	return cmd
+}
+
+func newUserGrantsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "grants [user]",
+		Short: "有効な期限付きの権限を表示する",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			user := ""
+			if len(args) == 1 {
+				user = args[0]
+			}
+			grants, err := c.ListGrants(cmd.Context(), user, "")
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tUSER\tSERVER\tPERMISSIONS\tEXPIRES\tBY\tREASON")
+			for _, g := range grants {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", g.ID, g.User, g.Server, strings.Join(g.Permissions, ","),
+					g.ExpiresAt.Local().Format(time.DateTime), firstNonEmpty(g.CreatedBy, "-"), firstNonEmpty(g.Reason, "-"))
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+func newUserUngrantCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ungrant <grant-id>",
+		Short: "期限付きの権限を期限前に取り消す",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := c.RevokeGrant(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Grant %s revoked\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newUserRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <user> <server> [perm...]",
+		Short: "ユーザーの権限を取り消す (権限を省略した場合はサーバーに対する全ての権限)",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updatePermissions(cmd, args[0], args[1], func(perms []string) []string {
+				if len(args) == 2 {
+					return nil
+				}
+				return slices.DeleteFunc(perms, func(p string) bool { return slices.Contains(args[2:], p) })
+			})
+		},
+	}
+}
+
+func newUserRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <user>",
+		Short: "ユーザーを削除する",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := c.DeleteUser(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("User %s removed\n", args[0])
+			return nil
+		},
+	}
+}
+
+// updatePermissions はユーザーのサーバーに対する権限を update の結果で置き換える。
+// Merge Patch では配列がマージされないため、現在の権限を取得して変更した配列全体を送信する。結果が空の場合はサーバーの項目を削除する。
+func updatePermissions(cmd *cobra.Command, username, server string, update func([]string) []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	users, err := c.ListUsers(cmd.Context())
+	if err != nil {
+		return err
+	}
+	user, ok := users[username]
+	if !ok {
+		return fmt.Errorf("user %q not found", username)
+	}
+
+	var value any
+	if perms := update(slices.Clone(user.Permissions[server])); len(perms) > 0 {
+		value = perms
+	}
+	result, err := c.PatchUser(cmd.Context(), username, map[string]any{"permissions": map[string]any{server: value}})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Permissions of %s on %s updated\n", username, server)
+	printIssues(result.Issues)
+	return nil
+}
+
+// requireUser はユーザーが存在することを確認する。PatchUser は存在しないユーザーを作成するため、変更の前に確認する。
+func requireUser(cmd *cobra.Command, c *client.Client, username string) error {
+	users, err := c.ListUsers(cmd.Context())
+	if err != nil {
+		return err
+	}
+	if _, ok := users[username]; !ok {
+		return fmt.Errorf("user %q not found", username)
+	}
+	return nil
+}
+
+// maxPasswordLength は bcrypt でハッシュ化できるパスワードの最大のバイト数。サーバーの制限と同じ。
+const maxPasswordLength = 72
+
+// readNewPassword は新しいパスワードを読み込む。端末から入力する場合は、打ち間違いを防ぐため 2 回入力させる。
+func readNewPassword(fromStdin bool) (string, error) {
+	password, err := readPassword("New password: ", fromStdin)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("password must not be empty")
+	}
+	if len(password) > maxPasswordLength {
+		return "", fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+	}
+	if fromStdin || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return password, nil
+	}
+	confirm, err := readPassword("Retype new password: ", fromStdin)
+	if err != nil {
+		return "", err
+	}
+	if confirm != password {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return password, nil
+}
+
+// hashPassword は設定ファイルに平文のパスワードを残さないよう、送信前に bcrypt でハッシュ化する。
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// parseGrants は "<server>=<perm>[,<perm>...]" 形式の指定をサーバーごとの権限へ変換する。
+func parseGrants(grants []string) (map[string][]string, error) {
+	permissions := make(map[string][]string)
+	for _, g := range grants {
+		server, perms, ok := strings.Cut(g, "=")
+		if !ok || server == "" || perms == "" {
+			return nil, fmt.Errorf("invalid grant %q (expected <server>=<perm>[,<perm>...])", g)
+		}
+		for _, p := range strings.Split(perms, ",") {
+			if p = strings.TrimSpace(p); p != "" && !slices.Contains(permissions[server], p) {
+				permissions[server] = append(permissions[server], p)
+			}
+		}
+	}
+	return permissions, nil
+}
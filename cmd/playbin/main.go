@@ -0,0 +1,292 @@
+// Command playbin は play-bin 本体。設定ファイル (config.json) と状態のファイルは作業ディレクトリから読み書きする。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/play-bin/internal/api"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/discord"
+	"github.com/play-bin/internal/dnsupdate"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/firewall"
+	"github.com/play-bin/internal/forwarder"
+	"github.com/play-bin/internal/incident"
+	"github.com/play-bin/internal/logarchive"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/notify"
+	"github.com/play-bin/internal/process"
+	"github.com/play-bin/internal/proxyreg"
+	"github.com/play-bin/internal/recording"
+	"github.com/play-bin/internal/sftp"
+	"github.com/play-bin/internal/systemd"
+	"github.com/play-bin/internal/wake"
+)
+
+const (
+	// shutdownTimeout は終了時に処理中のリクエストや SFTP の転送の完了を待機する時間。
+	shutdownTimeout = 15 * time.Second
+	// jobDrainTimeout は終了時に実行中のジョブ（バックアップ等）の完了を待機する時間。超過したジョブはキャンセルする。
+	jobDrainTimeout = 60 * time.Second
+	// jobsPath はジョブの履歴を再起動後も参照できるよう保存するファイル。
+	jobsPath = "./jobs.json"
+	// grantsPath は API で付与した期限付きの権限を保存するファイル。
+	grantsPath = "./grants.json"
+	// statesPath はサーバーごとの最後の操作と停止理由を保存するファイル。
+	statesPath = "./server_states.json"
+	// trafficPath はサーバーごとの日ごとの通信量を保存するファイル。
+	trafficPath = "./traffic.json"
+	// backupsPath はバックアップの世代ごとの実行の経路・ユーザー・結果を保存するファイル。
+	backupsPath = "./backups.json"
+	// preferencesPath はユーザーごとの UI と通知の設定を保存するファイル。
+	preferencesPath = "./preferences.json"
+)
+
+// MARK: main()
+// アプリケーションの基盤システム（設定、Docker、各サービス）を初期化し起動する。
+func main() {
+	validateOnly := flag.Bool("validate", false, "設定ファイルを検証して終了する (エラーがある場合は終了コード 1)")
+	migrateOnly := flag.Bool("migrate-config", false, "旧形式の設定ファイルを現在の形式へ変換して終了する")
+	flag.Parse()
+
+	// MARK: > Validate Only
+	// デプロイ前や CI で設定の誤りを検出できるよう、サービスを起動せずに検証結果のみを出力する。
+	if *validateOnly {
+		os.Exit(validateConfig())
+	}
+	// MARK: > Migrate Only
+	// 起動時にも自動で変換するが、内容を事前に確認できるよう変換のみを行う手段を用意する。
+	if *migrateOnly {
+		os.Exit(migrateConfig())
+	}
+
+	// MARK: > Initialize Config
+	// 起動時に最新の設定をメモリに展開し、以降のコンポーネントで参照可能にする。
+	cfg := &config.LoadedConfig{}
+	cfg.Reload()
+	// API で付与された期限付きの権限は設定ファイルとは別に保存しているため、再起動後も引き継ぐ。
+	if err := cfg.LoadGrants(grantsPath); err != nil {
+		logger.Errorf("Internal", "System", "一時的な権限の読み込みに失敗: %v", err)
+	}
+	// 以降の変更はファイル監視と SIGHUP で検知し、設定のスナップショットを差し替える。
+	cfg.Watch()
+
+	// MARK: > Docker Client
+	// Dockerエンジンとの通信が確立できないと全ての操作が不可能になるため、最初期に検証する。
+	logger.Log("Internal", "System", "Dockerクライアントを初期化しています...")
+	// Dockerクライアントの初期化処理を修正
+	if err := docker.Init(cfg); err != nil {
+		// 接続失敗時はエラーをログに出力し、プロセスの起動を続行する。
+		logger.Error("System", err)
+	}
+	logger.Log("Internal", "System", "Dockerクライアントが準備完了しました")
+
+	// MARK: > Docker Events
+	// コンテナの状態変化を各モジュールがポーリングせずに済むよう、イベント購読を一元的に開始する。
+	docker.Events.Start()
+	// 認可チェック等で参照するコンテナ詳細情報のキャッシュを、イベントに応じて破棄する。
+	docker.Inspects.Start()
+	// ホスト上で直接実行するサーバー (process) の起動・終了も、コンテナのイベントとして同じ購読者へ配信する。
+	process.OnEvent = func(name, action string, exitCode int) {
+		ev := docker.ContainerEvent{ID: name, Name: name, Server: name, Action: action, Time: time.Now()}
+		if action == "die" {
+			ev.ExitCode = strconv.Itoa(exitCode)
+		}
+		docker.Events.Publish(ev)
+	}
+
+	// MARK: > Initialize Services
+	// 各サービスが相互に依存する設定やマネージャーを注入し、インスタンスを生成する。
+	cm := container.NewManager(cfg)
+	if err := cm.Jobs.Load(jobsPath); err != nil {
+		logger.Errorf("Internal", "System", "ジョブ履歴の読み込みに失敗: %v", err)
+	}
+	if err := cm.States.Load(statesPath); err != nil {
+		logger.Errorf("Internal", "System", "サーバーの状態の読み込みに失敗: %v", err)
+	}
+	// 停止イベントから終了コードと停止理由 (意図した停止か異常終了か) を記録する。
+	cm.StartStateTracking()
+	if err := cm.Traffic.Load(trafficPath); err != nil {
+		logger.Errorf("Internal", "System", "通信量の記録の読み込みに失敗: %v", err)
+	}
+	if err := cm.Backups.Load(backupsPath); err != nil {
+		logger.Errorf("Internal", "System", "バックアップの記録の読み込みに失敗: %v", err)
+	}
+	// 起動中のコンテナの通信量を定期的に取得し、日ごとに集計する。
+	cm.StartTrafficAccounting()
+	ds := discord.NewBotManager(cfg, cm)
+	as := api.NewServer(cfg, cm)
+	if err := as.Preferences.Load(preferencesPath); err != nil {
+		logger.Errorf("Internal", "System", "ユーザー設定の読み込みに失敗: %v", err)
+	}
+	ss := sftp.NewServer(cfg, cm)
+
+	// MARK: > Start Background Services
+	// 非ブロッキングで動作させる必要のあるサービスを非同期(または専用ループ)で開始する。
+	logger.Log("Internal", "Discord", "Discord連携サービスを開始しています...")
+	ds.Start()
+	// ルールに一致したログの行を、サーバーごとの転送先 (Discord Webhook・HTTP・コンテナへのコマンド・イベント) へ送る。
+	fw := forwarder.NewManager(cfg)
+	fw.Start()
+
+	// 無人状態が続いたサーバーの自動停止と、定時起動の巡回を開始する。
+	cm.StartAutoShutdown()
+	// ready が設定されたサーバーについて、起動後のログ・ポートから準備完了を判定する。
+	cm.StartReadiness()
+
+	// 停止中のサーバーのゲームポートを代理で待ち受け、接続があれば起動する。コンテナ作成直前にポートを明け渡す。
+	wp := wake.NewProxy(cfg, cm)
+	cm.BeforeCreate = wp.Release
+	wp.Start()
+	// 起動・停止したコンテナの公開ポートを、firewall の設定に応じてホストのファイアウォールで開閉する。
+	firewall.NewManager(cfg).Start()
+	// proxy を設定したサーバーを、起動中のみ Velocity / BungeeCord のプロキシへ登録する。
+	proxyreg.NewRegistrar(cfg).Start()
+	// dns を設定したサーバーの起動時に、動作するホストとポートを DNS のレコードへ反映する。
+	dnsupdate.NewUpdater(cfg).Start()
+
+	// 異常終了したコンテナのログとクラッシュレポートを記録し、設定に応じて Discord へ通知する。
+	ir := incident.NewRecorder(cfg)
+	ir.OnIncident = func(inc incident.Incident) {
+		ds.NotifyIncident(inc)
+		notify.Events.Publish(notify.CrashEvent(inc))
+	}
+	ir.Start()
+
+	// クラッシュ・バックアップの失敗・ディスクの逼迫・ログインの拒否を、notify に登録したユーザーへのメールと routes の通知先へ通知する。
+	// 宛先にはユーザー自身が /api/me/preferences で登録したイベントも含める。
+	mailer := notify.NewMailer(cfg)
+	mailer.Preferences = as.Preferences
+	mailer.Start()
+	notify.NewRouter(cfg).Start()
+	notify.WatchJobs(cm.Jobs)
+	notify.WatchDisk(cfg)
+
+	// API から登録された定期コマンド（告知・保存等）の実行を開始する。
+	as.Schedules.Start()
+
+	// logArchive が設定されている場合、コンテナの再作成で失われないようログをディスクへ保存し続ける。
+	logarchive.NewArchiver(cfg).Start()
+
+	// 保持期間を過ぎたコンソール録画を定期的に削除する。
+	recording.StartJanitor(cfg)
+
+	// 設定と実際のコンテナを照合し、存在しないサーバー・作成後に設定が変更されたコンテナを報告する。
+	// 購読者の開始後に行い、autostart のサーバーの起動も通常の起動と同じく通知・記録されるようにする。
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		cm.Reconcile(ctx, true)
+	}()
+
+	logger.Log("Internal", "SFTP", "SFTPサーバーを開始しています...")
+	go ss.Start()
+
+	// MARK: > Start Web Server
+	// 終了シグナルを待機するため、HTTPサーバーもゴルーチンで起動する。
+	logger.Log("Internal", "API", "Webサーバーを開始しています...")
+	go as.Start()
+	// gRPC 管理 API は grpcListen が設定されている場合のみ待機する。
+	go as.StartGRPC()
+
+	// MARK: > Notify systemd
+	// 全ての待機を開始してから起動完了を通知し、After= で順序付けられたユニットが接続可能な状態で起動するようにする。
+	// ウォッチドッグは HTTP の応答を確認できた場合のみ通知し、応答しなくなったインスタンスを systemd に再起動させる。
+	<-ss.Ready()
+	<-as.Ready()
+	systemd.Ready()
+	systemd.Watchdog(as.HealthCheck)
+
+	// MARK: > Graceful Shutdown
+	// SIGINT / SIGTERM を受信したら、接続の受け付けを止めてから処理中の作業を完了・保存して終了する。
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	logger.Log("Internal", "System", "終了シグナルを受信しました。終了処理を開始します（再度受信した場合は即座に終了します）")
+	systemd.Stopping()
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+		<-ch
+		logger.Log("Internal", "System", "終了シグナルを再度受信したため、終了処理を中断します")
+		os.Exit(1)
+	}()
+	shutdown(as, ss, ds, fw, cm)
+	logger.Log("Internal", "System", "終了処理が完了しました")
+}
+
+// MARK: shutdown()
+// 新しい接続の受け付けを停止し、実行中のジョブの完了を待ってから外部との接続を閉じ、状態を保存する。
+func shutdown(as *api.Server, ss *sftp.Server, ds *discord.BotManager, fw *forwarder.Manager, cm *container.Manager) {
+	// HTTP と SFTP は並行して停止し、処理中のリクエストと転送の完了を待つ。
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		ss.Shutdown(ctx)
+		close(done)
+	}()
+	as.Shutdown(ctx)
+	<-done
+
+	// バックアップやリストアの途中で終了するとデータが不完全になるため、完了を待機する。期限を過ぎたジョブはキャンセルする。
+	jobCtx, jobCancel := context.WithTimeout(context.Background(), jobDrainTimeout)
+	defer jobCancel()
+	// 子プロセスとして実行中のサーバーは play-bin と共に終了するため、停止手順 (保存等) を実行してから停止する。
+	cm.StopProcesses(jobCtx)
+	cm.Jobs.Shutdown(jobCtx)
+	if err := cm.Jobs.Save(jobsPath); err != nil {
+		logger.Errorf("Internal", "System", "ジョブ履歴の保存に失敗: %v", err)
+	}
+
+	// ジョブの完了通知を送り終えてから Discord のセッションとログの転送を閉じる。
+	fw.Close()
+	ds.Close()
+}
+
+// MARK: migrateConfig()
+// 旧形式の設定ファイルを現在の形式へ変換し、変換の内容を出力してプロセスの終了コードを返す。
+func migrateConfig() int {
+	cfg := &config.LoadedConfig{Path: config.DetectPath()}
+	changes, backup, err := cfg.MigrateLegacy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if len(changes) == 0 {
+		fmt.Printf("%s: already up to date\n", cfg.Path)
+		return 0
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	fmt.Printf("%s: migrated (original saved to %s)\n", cfg.Path, backup)
+	return 0
+}
+
+// MARK: validateConfig()
+// 設定ファイルと servers.d を検証して問題を出力し、プロセスの終了コードを返す。
+func validateConfig() int {
+	path := config.DetectPath()
+	_, issues, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if config.HasErrors(issues) {
+		return 1
+	}
+	fmt.Printf("%s: OK\n", path)
+	return 0
+}
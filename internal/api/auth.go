@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
 	"github.com/play-bin/internal/docker"
 	"github.com/play-bin/internal/logger"
 )
@@ -21,80 +22,98 @@ func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
 
 	// クライアントから送られた資格情報をパースする。
 	// フォーマット不正は即座にクライアント側の誤り（Client）として却下する。
-	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
-		logger.Logf("Client", "Auth", "ログインリクエストのパース失敗: %v", err)
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &creds); err != nil {
+		logger.For(r.Context()).Warnf("Client", "Auth", "ログインリクエストのパース失敗: %v", err)
 		return
 	}
 
-	cfg := s.Config.Get()
-	user, ok := cfg.Users[creds.Username]
-
 	// 登録済みユーザーか、およびパスワードが一致するかを検証する。
 	// 認証の失敗はセキュリティ監視のため、対象ユーザー名を添えて記録する。
-	if !ok || user.Password != creds.Password {
-		logger.Logf("Client", "Auth", "認証失敗: user=%s", creds.Username)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !s.checkCredentials(creds.Username, creds.Password) {
+		logger.For(r.Context()).Warnf("Client", "Auth", "認証失敗: user=%s", creds.Username)
+		writeError(w, r, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Unauthorized", nil)
 		return
 	}
 
-	// セッション維持のための、十分なエントロピーを持つ推測困難なトークンを生成する。
-	tokenBytes := make([]byte, 16)
-	if _, err := rand.Read(tokenBytes); err != nil {
+	token, err := s.newSession(creds.Username)
+	if err != nil {
 		// 乱数生成の失敗はOSレベルの重大な障害（Internal）として扱う。
-		logger.Logf("Internal", "Auth", "トークン生成用乱数取得失敗: %v", err)
+		logger.For(r.Context()).Errorf("Internal", "Auth", "トークン生成用乱数取得失敗: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	token := hex.EncodeToString(tokenBytes)
 
-	// 生成したトークンをサーバー側のメモリに保持し、以降のリクエストで照合可能にする。
-	s.WebSessionMu.Lock()
-	s.WebSessions[token] = creds.Username
-	s.WebSessionMu.Unlock()
-
-	logger.Logf("Internal", "Auth", "ログイン成功: user=%s", creds.Username)
+	logger.For(r.Context()).Logf("Internal", "Auth", "ログイン成功: user=%s", creds.Username)
 
 	// 成功応答としてトークンをクライアントに返却する。
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"token": token}); err != nil {
-		logger.Logf("Internal", "Auth", "JSONエンコード失敗: %v", err)
+		logger.For(r.Context()).Errorf("Internal", "Auth", "JSONエンコード失敗: %v", err)
 	}
 }
 
+// MARK: checkCredentials()
+// ユーザー名とパスワードが登録済みのユーザーと一致するかを検証する。
+func (s *Server) checkCredentials(username, password string) bool {
+	user, ok := s.Config.Get().Users[username]
+	return ok && user.CheckPassword(password)
+}
+
+// MARK: newSession()
+// セッション維持のための、十分なエントロピーを持つ推測困難なトークンを生成し、ユーザーと関連付けて保持する。
+// HTTP と gRPC のどちらで発行したトークンも、以降の両方のリクエストで照合可能とする。
+func (s *Server) newSession(username string) (string, error) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	s.WebSessionMu.Lock()
+	s.WebSessions[token] = username
+	s.WebSessionMu.Unlock()
+	return token, nil
+}
+
 // MARK: Auth()
 // 認証が必要なエンドポイント用のミドルウェア。
 func (s *Server) Auth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// ヘッダーまたはクエリパラメータから認証トークンを抽出する。
-		// WS接続時などはヘッダーが使えないため、クエリパラメータもサポートしている。
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			token = r.URL.Query().Get("token")
-		}
+	return s.auth(next, false)
+}
 
-		// 有効なセッションが存在するかチェックする。
+// MARK: AuthBulk()
+// id=tag:<pattern> による複数のサーバーへの一括操作を受け付けるエンドポイント用の Auth。
+// タグの指定は複数のサーバーを対象とするため、ここでは判定せず、ハンドラーがサーバーごとに権限を判定する。
+// サーバー名の指定は Auth と同じく判定する。
+func (s *Server) AuthBulk(next http.HandlerFunc) http.HandlerFunc {
+	return s.auth(next, true)
+}
+
+// auth は Auth・AuthBulk の本体。bulk が true の場合、タグの指定 (id=tag:<pattern>) の権限をハンドラーの判定に委ねる。
+func (s *Server) auth(next http.HandlerFunc, bulk bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// ヘッダーの認証トークンに対応する、有効なセッションが存在するかチェックする。
+		// ヘッダーを付与できない WebSocket・SSE は、WSAuth により使い捨てのチケットで認証する。
 		s.WebSessionMu.RLock()
-		username, ok := s.WebSessions[token]
+		username, ok := s.WebSessions[sessionToken(r)]
 		s.WebSessionMu.RUnlock()
 
 		if !ok {
 			// 未認証またはトークン期限切れ（メモリ上の抹消）の場合は401を返す。
-			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthenticated, "Authentication required", nil)
 			return
 		}
 
 		// コンテナ操作のリクエストである場合、ユーザーに対象コンテナの操作権限があるか検証する。
-		if serverName := r.URL.Query().Get("id"); serverName != "" {
+		serverName := r.URL.Query().Get("id")
+		if _, isTag := config.TagSelector(serverName); serverName != "" && !(bulk && isTag) {
 			cfg := s.Config.Get()
 			user := cfg.Users[username]
 
 			// Docker上の実名（コンテナ名）を取得して照合を行う（ID直接指定にも対応）。
-			inspect, err := docker.Client.ContainerInspect(r.Context(), serverName)
-			var realName string
-			if err == nil {
-				realName = inspect.Name[1:]
-			} else {
+			// 全てのリクエストで問い合わせることのないよう、短時間キャッシュされた解決結果を使用する。
+			realName, err := docker.Inspects.Name(r.Context(), serverName)
+			if err != nil {
 				// 未作成コンテナ（missing）の場合は、リクエスト時のIDをサーバー名とみなす。
 				realName = serverName
 			}
@@ -102,13 +121,44 @@ func (s *Server) Auth(next http.HandlerFunc) http.HandlerFunc {
 			// 認可チェック。指定されたコンテナ名が許可リストに含まれているか確認する。
 			if !user.HasPermission(realName, config.PermContainerRead) {
 				// 権限外の操作試行は重要な監視対象（Client）として記録する。
-				logger.Logf("Client", "Auth", "操作拒否: user=%s, target=%s", username, realName)
-				http.Error(w, "Operation not allowed for this container", http.StatusForbidden)
+				logger.For(r.Context()).Warnf("Client", "Auth", "操作拒否: user=%s, target=%s", username, realName)
+				writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Operation not allowed for this container", map[string]string{"permission": config.PermContainerRead, "server": realName})
 				return
 			}
 		}
 
 		// 認証・認可がパスしたため、次のプロセッサに制御を委譲する。
-		next(w, r)
+		// コンテナ操作のジョブと最後の操作の記録に、操作したユーザーを残せるようにする。
+		next(w, r.WithContext(container.WithActor(r.Context(), username, container.ViaHTTP)))
+	}
+}
+
+// MARK: sessionUser()
+// リクエストのトークン（ヘッダー）からログイン中のユーザー名を特定する。
+// Auth ミドルウェア通過後のハンドラーで使用する前提のため、未認証時は空文字を返す。
+func (s *Server) sessionUser(r *http.Request) string {
+	s.WebSessionMu.RLock()
+	defer s.WebSessionMu.RUnlock()
+	return s.WebSessions[sessionToken(r)]
+}
+
+// sessionToken はリクエストのヘッダーからセッショントークンを取り出す。
+// クエリパラメータのトークンは、アクセスログやプロキシのログに残るため受け付けない。
+func sessionToken(r *http.Request) string {
+	return r.Header.Get("Authorization")
+}
+
+// MARK: revokeSessions()
+// ユーザーのセッションのうち、keep 以外を全て無効にする。パスワードの変更時に、他の端末に残ったログインを失効させるために使用する。
+func (s *Server) revokeSessions(username, keep string) int {
+	s.WebSessionMu.Lock()
+	defer s.WebSessionMu.Unlock()
+	n := 0
+	for token, u := range s.WebSessions {
+		if u == username && token != keep {
+			delete(s.WebSessions, token)
+			n++
+		}
 	}
+	return n
 }
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+)
+
+// newTestServer は configJSON の設定を読み込み、token で user としてログインした状態の Server を返す。
+func newTestServer(t *testing.T, configJSON, token, user string) *Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(configJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.LoadedConfig{Path: path}
+	cfg.Reload()
+	if len(cfg.Get().Servers) == 0 {
+		t.Fatal("config was not loaded")
+	}
+	return &Server{Config: cfg, WebSessions: map[string]string{token: user}}
+}
+
+func TestAuthTagSelectorWithPerServerPermissions(t *testing.T) {
+	s := newTestServer(t, `{
+		"servers": {
+			"a": {"tags": ["events"]},
+			"b": {"tags": ["events"]},
+			"c": {"tags": ["events"]}
+		},
+		"users": {
+			"operator": {"password": "", "permissions": {"a": ["container.read"], "b": ["container.read"]}}
+		}
+	}`, "token", "operator")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/container/stop?id=tag:events", nil)
+	req.Header.Set("Authorization", "token")
+	rec := httptest.NewRecorder()
+	s.AuthBulk(s.Action(container.ActionStop))(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var res struct {
+		Results []BulkActionResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	// 閲覧できるサーバーのみが対象となり、操作の権限が無いためいずれも実行されない。
+	if len(res.Results) != 2 || res.Results[0].Server != "a" || res.Results[1].Server != "b" {
+		t.Fatalf("results = %+v, want servers a and b", res.Results)
+	}
+	for _, r := range res.Results {
+		if r.Error != "permission denied: "+container.ActionStop.Permission() {
+			t.Errorf("%s: error = %q", r.Server, r.Error)
+		}
+	}
+}
+
+func TestAuthTagSelectorWithoutMatchingServers(t *testing.T) {
+	s := newTestServer(t, `{
+		"servers": {"a": {"tags": ["events"]}},
+		"users": {
+			"operator": {"password": "", "permissions": {"a": ["container.read"]}}
+		}
+	}`, "token", "operator")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/container/stop?id=tag:lobby", nil)
+	req.Header.Set("Authorization", "token")
+	rec := httptest.NewRecorder()
+	s.AuthBulk(s.Action(container.ActionStop))(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+	}
+}
+
+func TestAuthChecksTagSelectorOutsideBulkActions(t *testing.T) {
+	s := newTestServer(t, `{
+		"servers": {"a": {"tags": ["events"]}},
+		"users": {
+			"operator": {"password": "", "permissions": {"a": ["container.read"]}}
+		}
+	}`, "token", "operator")
+	called := false
+	handler := s.Auth(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	// 一括操作以外のエンドポイントでは、タグの指定もサーバー名と同じく判定する。
+	req := httptest.NewRequest(http.MethodGet, "/api/container/inspect?id=tag:events", nil)
+	req.Header.Set("Authorization", "token")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusForbidden || called {
+		t.Errorf("status = %d, called = %v, want 403", rec.Code, called)
+	}
+}
+
+func TestAuthRejectsTokenInQuery(t *testing.T) {
+	s := newTestServer(t, `{"servers": {"a": {}}, "users": {"operator": {"password": "", "permissions": {"*": ["*"]}}}}`, "token", "operator")
+	called := false
+	handler := s.Auth(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/containers?token=token", nil))
+	if rec.Code != http.StatusUnauthorized || called {
+		t.Errorf("token in query: status = %d, called = %v, want 401", rec.Code, called)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/containers", nil)
+	req.Header.Set("Authorization", "token")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if !called {
+		t.Errorf("token in header: status = %d, want the handler to be called", rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressMinSize はこのサイズ未満の応答を圧縮しない。小さな応答は圧縮による削減よりもヘッダー等の付加の方が大きくなる。
+const compressMinSize = 1024
+
+var (
+	gzipWriters  = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression); return w }}
+	flateWriters = sync.Pool{New: func() any { w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression); return w }}
+)
+
+// MARK: WithCompression()
+// Accept-Encoding に応じて応答を gzip または deflate で圧縮する。
+// WebSocket のアップグレード、既に圧縮された形式 (画像・アーカイブ等)、範囲指定の応答、小さな応答は圧縮しない。
+func (s *Server) WithCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding は Accept-Encoding から使用する圧縮形式を選ぶ。gzip を優先し、q=0 で拒否された形式は使用しない。
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for part := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	for _, enc := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[enc]; ok || (!listed && accepted["*"]) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compressibleType は応答の Content-Type が圧縮の効果を見込める形式かを判定する。
+func compressibleType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		// SSE はイベントごとに即時送出する必要があるため、圧縮のバッファリングを避ける。
+		return mediaType != "text/event-stream"
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"):
+		return false
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "application/x-ndjson", "application/x-asciicast", "application/wasm":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// MARK: compressResponseWriter
+// 応答の先頭を compressMinSize までバッファリングし、ヘッダーとサイズから圧縮するかを決定してから書き込む。
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	zw       io.WriteCloser // 圧縮する場合の書き込み先。圧縮しない場合は nil
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.decided {
+		return
+	}
+	cw.status = code
+	// 本文を持たない応答と情報応答は、バッファリングせずにそのまま送る。
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) >= compressMinSize {
+			if err := cw.decideAndFlushBuffer(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if cw.zw != nil {
+		return cw.zw.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush は SSE 等のストリーミング応答で、バッファ済みのデータを即座に送出する。
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		cw.decideAndFlushBuffer(true)
+	}
+	if f, ok := cw.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack は圧縮の対象外とした WebSocket 以外のアップグレードにも対応できるよう、基盤の接続を返す。
+func (cw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	cw.decided = true
+	return hijacker.Hijack()
+}
+
+// decideAndFlushBuffer は圧縮するかを決定し、バッファ済みの本文を書き込む。sizeOK が false の場合は圧縮しない。
+func (cw *compressResponseWriter) decideAndFlushBuffer(sizeOK bool) error {
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		// 標準の ResponseWriter と同様に本文から推定し、圧縮の判定に使用する。
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	compress := sizeOK &&
+		cw.status != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		compressibleType(h.Get("Content-Type"))
+	cw.decide(compress)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.Write(buf)
+	return err
+}
+
+// decide は圧縮の有無に応じてヘッダーを整え、ステータスコードを送出する。
+func (cw *compressResponseWriter) decide(compress bool) {
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Set("Content-Encoding", cw.encoding)
+		// 圧縮後の長さは事前に分からず、範囲指定は元の本文に対するものとなるため削除する。
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		switch cw.encoding {
+		case "gzip":
+			zw := gzipWriters.Get().(*gzip.Writer)
+			zw.Reset(cw.ResponseWriter)
+			cw.zw = zw
+		case "deflate":
+			zw := flateWriters.Get().(*flate.Writer)
+			zw.Reset(cw.ResponseWriter)
+			cw.zw = zw
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// close は未決定の応答 (compressMinSize 未満) を圧縮せずに送出し、圧縮している場合は末尾を書き込んで書き込み器を再利用に戻す。
+func (cw *compressResponseWriter) close() {
+	if !cw.decided {
+		if len(cw.buf) == 0 && cw.status == http.StatusOK {
+			// ハンドラーが何も書き込まなかった場合は、標準の ResponseWriter と同様に 200 の空応答とする。
+			cw.decide(false)
+			return
+		}
+		cw.decideAndFlushBuffer(false)
+	}
+	if cw.zw == nil {
+		return
+	}
+	cw.zw.Close()
+	switch zw := cw.zw.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(zw)
+	case *flate.Writer:
+		flateWriters.Put(zw)
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/play-bin/internal/logger"
+)
+
+// apiV1Prefix はバージョン付き API の接頭辞。/api/v1/<path> は /api/<path> と同じハンドラーで処理する。
+const apiV1Prefix = "/api/v1/"
+
+// MARK: ErrorCode
+// UI やスクリプトが応答本文の文言に依存せずに分岐できるよう、エラーの種類を表す機械可読なコード。
+type ErrorCode string
+
+const (
+	ErrCodeBadRequest         ErrorCode = "bad_request"
+	ErrCodeUnauthenticated    ErrorCode = "unauthenticated"
+	ErrCodeInvalidCredentials ErrorCode = "invalid_credentials"
+	ErrCodePermissionDenied   ErrorCode = "permission_denied"
+	ErrCodeNotFound           ErrorCode = "not_found"
+	ErrCodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	ErrCodeConflict           ErrorCode = "conflict"
+	ErrCodePayloadTooLarge    ErrorCode = "payload_too_large"
+	ErrCodeInvalidConfig      ErrorCode = "invalid_config"
+	ErrCodeInvalidPatch       ErrorCode = "invalid_patch"
+	ErrCodeUnprocessable      ErrorCode = "unprocessable"
+	ErrCodeRateLimited        ErrorCode = "rate_limited"
+	ErrCodeCooldown           ErrorCode = "cooldown"
+	ErrCodeInternal           ErrorCode = "internal"
+	ErrCodeUpstream           ErrorCode = "upstream_error"
+	ErrCodeUnavailable        ErrorCode = "unavailable"
+	ErrCodeTimeout            ErrorCode = "timeout"
+)
+
+// codeForStatus は個別のコードを指定しなかったエラーに、ステータスコードから既定のコードを割り当てる。
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthenticated
+	case http.StatusForbidden:
+		return ErrCodePermissionDenied
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrCodePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return ErrCodeUnprocessable
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case http.StatusBadGateway:
+		return ErrCodeUpstream
+	case http.StatusServiceUnavailable:
+		return ErrCodeUnavailable
+	case http.StatusGatewayTimeout:
+		return ErrCodeTimeout
+	}
+	if status >= 500 {
+		return ErrCodeInternal
+	}
+	return ErrCodeBadRequest
+}
+
+// MARK: ErrorBody
+// /api/v1 のエラー応答の本文 ({"error": {...}})。
+type ErrorBody struct {
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	Details   any       `json:"details,omitempty"`   // エラーの種類ごとの補足 (不足している権限、設定の検証結果等)
+	RequestID string    `json:"requestId,omitempty"` // ログと突き合わせるためのリクエスト ID (X-Request-ID と同じ値)
+}
+
+type apiVersionKey struct{}
+
+// isV1 はリクエストが /api/v1 経由で受け付けられたかを返す。
+func isV1(r *http.Request) bool {
+	v, _ := r.Context().Value(apiVersionKey{}).(bool)
+	return v
+}
+
+// MARK: writeError()
+// エラーを応答する。/api/v1 では JSON のエラー形式、旧来のパスでは従来どおりの平文で返す。
+func writeError(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, message string, details any) {
+	if !isV1(r) {
+		http.Error(w, message, status)
+		return
+	}
+	writeErrorJSON(w, r, status, code, message, details)
+}
+
+func writeErrorJSON(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, message string, details any) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error ErrorBody `json:"error"`
+	}{ErrorBody{Code: code, Message: message, Details: details, RequestID: logger.RequestID(r.Context())}})
+}
+
+// MARK: WithAPIVersion()
+// /api/v1/ へのリクエストを /api/ のハンドラーへ振り分け、平文のエラー応答を JSON のエラー形式へ変換する。
+// 旧来の /api/ へのリクエストには、移行を促すため Deprecation ヘッダーと後継のパスを示す Link ヘッダーを付与する。
+func (s *Server) WithAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, apiV1Prefix)
+		if !ok {
+			if legacy, ok := strings.CutPrefix(r.URL.Path, "/api/"); ok {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Link", "<"+apiV1Prefix+legacy+">; rel=\"successor-version\"")
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r2 := r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, true))
+		u := *r.URL
+		u.Path, u.RawPath = "/api/"+rest, ""
+		r2.URL = &u
+		vw := &v1ResponseWriter{ResponseWriter: w, r: r2}
+		next.ServeHTTP(vw, r2)
+		vw.finish()
+	})
+}
+
+// MARK: v1ResponseWriter
+// http.Error 等で書き込まれた平文のエラー応答を捕捉し、完了後に JSON のエラー形式で書き直す。
+// ハンドラーが JSON で応答するエラー (writeError 等) と、成功時の応答はそのまま通過させる。
+type v1ResponseWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	status int
+	buf    *bytes.Buffer // 捕捉中の平文のエラー本文。nil の場合は捕捉していない
+}
+
+func (w *v1ResponseWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest && !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.status, w.buf = code, &bytes.Buffer{}
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *v1ResponseWriter) Write(p []byte) (int, error) {
+	if w.buf != nil {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush は SSE 等のストリーミング応答のため、捕捉中でなければ基盤の Flusher へ委譲する。
+func (w *v1ResponseWriter) Flush() {
+	if w.buf != nil {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *v1ResponseWriter) finish() {
+	if w.buf == nil {
+		return
+	}
+	writeErrorJSON(w.ResponseWriter, w.r, w.status, codeForStatus(w.status), strings.TrimSpace(w.buf.String()), nil)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/netutil"
+	"github.com/play-bin/pkg/playbinpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcUserKey は認証済みのユーザー名をコンテキストへ関連付けるためのキー。
+type grpcUserKey struct{}
+
+// grpcUser はインターセプターで認証したユーザー名を返す。
+func grpcUser(ctx context.Context) string {
+	username, _ := ctx.Value(grpcUserKey{}).(string)
+	return username
+}
+
+// MARK: StartGRPC()
+// gRPC 管理 API の待機を開始する。Shutdown が呼ばれるまで戻らない。grpcListen が未設定の場合は何もしない。
+func (s *Server) StartGRPC() {
+	addr := s.Config.Get().GRPCListen
+	if addr == "" {
+		logger.Log("Internal", "API", "gRPCサーバーは無効です（grpcListenが未設定）")
+		return
+	}
+
+	listener, err := netutil.Listen(addr)
+	if err != nil {
+		logger.Errorf("Internal", "API", "gRPCサーバーが予期せず終了しました: %v", err)
+		panic(err)
+	}
+	// リクエストは小さなメッセージのみのため、受信サイズの上限を HTTP の JSON 本文と揃える。
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxJSONBodySize),
+		grpc.ChainUnaryInterceptor(s.grpcUnaryInterceptor),
+		grpc.ChainStreamInterceptor(s.grpcStreamInterceptor),
+	)
+	playbinpb.RegisterPlayBinServer(srv, &grpcService{s: s})
+	s.httpMu.Lock()
+	s.grpcServer = srv
+	s.httpMu.Unlock()
+	logger.Logf("Internal", "API", "gRPCサーバーが開始されました: \"%s\"", addr)
+
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		logger.Errorf("Internal", "API", "gRPCサーバーが予期せず終了しました: %v", err)
+		panic(err)
+	}
+}
+
+// shutdownGRPC は新しい呼び出しの受け付けを停止し、処理中の呼び出しの完了を ctx の期限まで待機する。
+// ストリーミングの呼び出しは baseCtx のキャンセルで終了するため、呼び出し前にキャンセルしておくこと。
+func (s *Server) shutdownGRPC(ctx context.Context) {
+	s.httpMu.Lock()
+	srv := s.grpcServer
+	s.httpMu.Unlock()
+	if srv == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Logf("Internal", "API", "gRPCサーバーの停止を待機できませんでした: %v", ctx.Err())
+		srv.Stop()
+	}
+	logger.Log("Internal", "API", "gRPCサーバーを停止しました")
+}
+
+// MARK: grpcUnaryInterceptor()
+// 単発の呼び出しに、リクエスト ID の割り当て・流量制限・トークンの検証とアクセスログを適用する。
+func (s *Server) grpcUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx, err := s.grpcAuthenticate(ctx, info.FullMethod)
+	var resp any
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	logGRPCAccess(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// MARK: grpcStreamInterceptor()
+// ストリーミングの呼び出しに、単発の呼び出しと同じ前処理を適用する。
+func (s *Server) grpcStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, err := s.grpcAuthenticate(ss.Context(), info.FullMethod)
+	if err == nil {
+		err = handler(srv, &grpcServerStream{ServerStream: ss, ctx: ctx})
+	}
+	logGRPCAccess(ctx, info.FullMethod, start, err)
+	return err
+}
+
+// grpcServerStream は認証済みのユーザーとリクエスト ID を関連付けたコンテキストを、ハンドラーへ渡すためのラッパー。
+type grpcServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *grpcServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+// grpcAuthenticate はリクエスト ID を割り当て、流量制限とトークンの検証を行う。Login はトークンを要求しない。
+// HTTP と同じく、メタデータ x-request-id が妥当な形式であれば引き継ぎ、応答のヘッダーでも返す。
+func (s *Server) grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := firstMetadata(md, "x-request-id")
+	if !requestIDPattern.MatchString(id) {
+		id = logger.NewRequestID()
+	}
+	ctx = logger.WithRequestID(ctx, id)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+
+	ip := grpcPeerIP(ctx)
+	username := ""
+	if method != playbinpb.PlayBin_Login_FullMethodName {
+		token := strings.TrimPrefix(firstMetadata(md, "authorization"), "Bearer ")
+		s.WebSessionMu.RLock()
+		username = s.WebSessions[token]
+		s.WebSessionMu.RUnlock()
+		if username == "" {
+			return ctx, status.Error(codes.Unauthenticated, "authentication required")
+		}
+		ctx = context.WithValue(ctx, grpcUserKey{}, username)
+		ctx = container.WithActor(ctx, username, container.ViaGRPC)
+	}
+	if err := s.grpcRateLimit(ctx, method, username, ip); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// grpcRateLimit は WithRateLimit と同じバケットで呼び出しを制限する。
+// ログインは IP アドレスごとに、操作の実行 (RunAction) は変更を伴う HTTP リクエストと合算して制限する。
+func (s *Server) grpcRateLimit(ctx context.Context, method, username, ip string) error {
+	cfg := s.Config.Get().RateLimit.WithDefaults()
+	if cfg.Disabled {
+		return nil
+	}
+	ip = netutil.ClientKey(ip)
+	subject := "ip:" + ip
+	if username != "" {
+		subject = "user:" + username
+	}
+	checks := []rateCheck{{"requests", "req:" + subject, cfg.RequestsPerMinute, cfg.Burst}}
+	switch method {
+	case playbinpb.PlayBin_Login_FullMethodName:
+		checks = append(checks, rateCheck{"login", "login:" + ip, cfg.LoginPerMinute, cfg.LoginBurst})
+	case playbinpb.PlayBin_RunAction_FullMethodName:
+		checks = append(checks, rateCheck{"actions", "action:" + subject, cfg.ActionsPerMinute, cfg.ActionBurst})
+	}
+	for _, c := range checks {
+		if delay, ok := s.limiter.allow(c.key, c.perMinute, c.burst); !ok {
+			retryAfter := max(1, int(math.Ceil(delay.Seconds())))
+			logger.For(ctx).Warnf("Client", "API", "流量制限により拒否: %s, limit=%s, method=%s", subject, c.kind, method)
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(retryAfter)))
+			return status.Errorf(codes.ResourceExhausted, "too many requests (limit=%s, retry after %ds)", c.kind, retryAfter)
+		}
+	}
+	return nil
+}
+
+// logGRPCAccess は HTTP のアクセスログと同じ形式で、呼び出しの結果を記録する。
+func logGRPCAccess(ctx context.Context, method string, start time.Time, err error) {
+	logger.For(ctx).Logf("Internal", "Access", "GRPC %s %s %s %v",
+		method,
+		grpcPeerIP(ctx),
+		status.Code(err),
+		time.Since(start),
+	)
+}
+
+// grpcPeerIP は接続元の IP アドレスを返す。
+func grpcPeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return netutil.RemoteIP(p.Addr.String())
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/pkg/playbinpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MARK: grpcService
+// proto/playbin/v1/playbin.proto の PlayBin サービスの実装。認証・権限・コンテナ操作は HTTP API と共通の処理を使用する。
+type grpcService struct {
+	playbinpb.UnimplementedPlayBinServer
+	s *Server
+}
+
+// MARK: Login()
+func (g *grpcService) Login(ctx context.Context, req *playbinpb.LoginRequest) (*playbinpb.LoginResponse, error) {
+	if !g.s.checkCredentials(req.GetUsername(), req.GetPassword()) {
+		logger.For(ctx).Warnf("Client", "Auth", "認証失敗: user=%s", req.GetUsername())
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	token, err := g.s.newSession(req.GetUsername())
+	if err != nil {
+		logger.For(ctx).Errorf("Internal", "Auth", "トークン生成用乱数取得失敗: %v", err)
+		return nil, status.Error(codes.Internal, "failed to issue token")
+	}
+	logger.For(ctx).Logf("Internal", "Auth", "ログイン成功: user=%s (gRPC)", req.GetUsername())
+	return &playbinpb.LoginResponse{Token: token}, nil
+}
+
+// MARK: ListContainers()
+func (g *grpcService) ListContainers(ctx context.Context, req *playbinpb.ListContainersRequest) (*playbinpb.ListContainersResponse, error) {
+	lq := containerListQuery{states: req.GetStates(), name: strings.ToLower(req.GetName()), sort: "name", stats: req.GetStats()}
+	items, _, err := g.s.containerList(ctx, grpcUser(ctx), lq)
+	if err != nil {
+		logger.For(ctx).Errorf("Internal", "API", "コンテナリストの取得に失敗: %v", err)
+		return nil, status.Error(codes.Unavailable, "failed to list containers")
+	}
+	resp := &playbinpb.ListContainersResponse{}
+	for _, item := range items {
+		c := &playbinpb.Container{
+			Id:          item.ID,
+			Name:        item.name(),
+			Host:        item.Host,
+			State:       item.State,
+			Actions:     item.Actions,
+			Permissions: item.Permissions,
+		}
+		if !item.StartedAt.IsZero() {
+			c.StartedAt = timestamppb.New(item.StartedAt)
+		}
+		if item.Stats != nil {
+			c.Stats = statsToProto(time.Time{}, *item.Stats)
+		}
+		resp.Containers = append(resp.Containers, c)
+	}
+	return resp, nil
+}
+
+// MARK: RunAction()
+// 操作を開始したリクエスト ID を手掛かりにジョブを特定し、その状態の変化を完了まで配信する。
+func (g *grpcService) RunAction(req *playbinpb.RunActionRequest, stream playbinpb.PlayBin_RunActionServer) error {
+	ctx := stream.Context()
+	username, serverName := grpcUser(ctx), req.GetServer()
+	action := container.Action(req.GetAction())
+
+	perm := action.Permission()
+	switch action {
+	case container.ActionStart, container.ActionStop, container.ActionKill, container.ActionBackup, container.ActionRemove:
+	case container.ActionRestore:
+		if req.GetGeneration() == "" {
+			return status.Error(codes.InvalidArgument, "generation is required for restore")
+		}
+	default:
+		return status.Errorf(codes.InvalidArgument, "unknown action %q", action)
+	}
+	if !g.s.Config.Get().Users[username].HasPermission(serverName, perm) {
+		logger.For(ctx).Warnf("Client", "API", "Action拒否: user=%s, target=%s", username, serverName)
+		return status.Errorf(codes.PermissionDenied, "%s permission required", perm)
+	}
+
+	updates, unsubscribe := g.s.ContainerManager.Jobs.Subscribe()
+	defer unsubscribe()
+
+	// HTTP と同様に、呼び出し元の切断からは切り離して最後まで実行する。
+	done := make(chan error, 1)
+	go func() {
+		actionCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Minute)
+		defer cancel()
+		var err error
+		if action == container.ActionRestore {
+			err = g.s.ContainerManager.Restore(actionCtx, serverName, req.GetGeneration())
+		} else {
+			err = g.s.ContainerManager.ExecuteAction(actionCtx, serverName, action)
+		}
+		done <- err
+	}()
+
+	requestID := logger.RequestID(ctx)
+	var jobID string
+	finished := false // 完了状態のジョブを送信済みか
+	for {
+		select {
+		case job := <-updates:
+			if job.RequestID != requestID || job.Server != serverName {
+				continue
+			}
+			jobID, finished = job.ID, job.Status != container.JobRunning
+			if err := stream.Send(jobToProto(job)); err != nil {
+				return err
+			}
+		case err := <-done:
+			if errors.Is(err, container.ErrCooldown) {
+				// 待機時間内の操作はジョブを開始せずに拒否されるため、送信済みの進捗も無い。
+				return status.Error(codes.ResourceExhausted, err.Error())
+			}
+			if err != nil {
+				logger.For(ctx).Errorf("Internal", "API", "コンテナ %s へのアクション %s 実行失敗: %v", serverName, action, err)
+			} else {
+				logger.For(ctx).Logf("Internal", "API", "アクション実行成功: container=%s, action=%s", serverName, action)
+			}
+			if finished {
+				return nil
+			}
+			// 購読の受信が滞って完了の通知を取りこぼした場合に備え、最終状態を改めて送る。
+			job, ok := g.s.ContainerManager.Jobs.Get(jobID)
+			if !ok {
+				job, ok = g.s.findJobByRequest(requestID, serverName)
+			}
+			if !ok {
+				if err != nil {
+					return status.Error(codes.Internal, err.Error())
+				}
+				return nil
+			}
+			return stream.Send(jobToProto(job))
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-g.s.baseCtx.Done():
+			// 操作自体はジョブとして完了まで実行され、終了処理で待機される。
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+// findJobByRequest は指定したリクエストで開始された、サーバーのジョブを返す。
+func (s *Server) findJobByRequest(requestID, serverName string) (container.Job, bool) {
+	for _, job := range s.ContainerManager.Jobs.List() {
+		if job.RequestID == requestID && job.Server == serverName {
+			return job, true
+		}
+	}
+	return container.Job{}, false
+}
+
+// MARK: ListJobs()
+func (g *grpcService) ListJobs(ctx context.Context, req *playbinpb.ListJobsRequest) (*playbinpb.ListJobsResponse, error) {
+	user := g.s.Config.Get().Users[grpcUser(ctx)]
+	resp := &playbinpb.ListJobsResponse{}
+	for _, job := range g.s.ContainerManager.Jobs.List() {
+		if req.GetServer() != "" && job.Server != req.GetServer() {
+			continue
+		}
+		if user.HasPermission(job.Server, config.PermContainerRead) {
+			resp.Jobs = append(resp.Jobs, jobToProto(job))
+		}
+	}
+	return resp, nil
+}
+
+// MARK: GetJob()
+func (g *grpcService) GetJob(ctx context.Context, req *playbinpb.GetJobRequest) (*playbinpb.Job, error) {
+	job, ok := g.s.ContainerManager.Jobs.Get(req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "job %q not found", req.GetId())
+	}
+	if !g.s.Config.Get().Users[grpcUser(ctx)].HasPermission(job.Server, config.PermContainerRead) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s permission required", config.PermContainerRead)
+	}
+	return jobToProto(job), nil
+}
+
+// MARK: WatchJobs()
+// 閲覧権限のあるサーバーのジョブの変化を、呼び出し元が切断するか play-bin が終了するまで配信する。
+func (g *grpcService) WatchJobs(req *playbinpb.WatchJobsRequest, stream playbinpb.PlayBin_WatchJobsServer) error {
+	ctx := stream.Context()
+	username := grpcUser(ctx)
+	updates, unsubscribe := g.s.ContainerManager.Jobs.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case job, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if req.GetServer() != "" && job.Server != req.GetServer() {
+				continue
+			}
+			// 設定の再読み込みで権限が変更される場合に備え、配信のたびに最新の設定で判定する。
+			if !g.s.Config.Get().Users[username].HasPermission(job.Server, config.PermContainerRead) {
+				continue
+			}
+			if err := stream.Send(jobToProto(job)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		case <-g.s.baseCtx.Done():
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+// MARK: StreamStats()
+// Docker の統計情報のストリームを購読し、算出済みの指標を配信する。
+func (g *grpcService) StreamStats(req *playbinpb.StreamStatsRequest, stream playbinpb.PlayBin_StreamStatsServer) error {
+	ctx := stream.Context()
+	serverName := req.GetServer()
+	if !g.s.Config.Get().Users[grpcUser(ctx)].HasPermission(serverName, config.PermContainerRead) {
+		return status.Errorf(codes.PermissionDenied, "%s permission required", config.PermContainerRead)
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		logger.For(ctx).Errorf("Internal", "API", "Dockerホストの解決に失敗: container=%s, err=%v", serverName, err)
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	// 終了時に配信を打ち切れるよう、baseCtx のキャンセルでも購読を閉じる。
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(g.s.baseCtx, cancel)()
+
+	ref, err := docker.Ref(ctx, serverName)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	stats, err := cli.ContainerStats(ctx, ref, true)
+	if err != nil {
+		logger.For(ctx).Errorf("Internal", "API", "統計情報取得失敗: container=%s, err=%v", serverName, err)
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer stats.Body.Close()
+
+	decoder := json.NewDecoder(stats.Body)
+	calc := &docker.StatsCalculator{}
+	for {
+		var typed ctypes.StatsResponse
+		if err := decoder.Decode(&typed); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			logger.For(ctx).Errorf("Internal", "API", "Docker統計デコード失敗: %v", err)
+			return status.Error(codes.Internal, "failed to decode stats")
+		}
+		if err := stream.Send(statsToProto(typed.Read, calc.Compute(typed))); err != nil {
+			return err
+		}
+	}
+}
+
+// jobToProto はジョブを gRPC のメッセージへ変換する。
+func jobToProto(j container.Job) *playbinpb.Job {
+	pj := &playbinpb.Job{
+		Id:        j.ID,
+		Server:    j.Server,
+		Action:    string(j.Action),
+		Error:     j.Error,
+		StartedAt: timestamppb.New(j.StartedAt),
+		Log:       j.Log,
+		RequestId: j.RequestID,
+	}
+	switch j.Status {
+	case container.JobRunning:
+		pj.Status = playbinpb.JobStatus_JOB_STATUS_RUNNING
+	case container.JobSucceeded:
+		pj.Status = playbinpb.JobStatus_JOB_STATUS_SUCCEEDED
+	case container.JobFailed:
+		pj.Status = playbinpb.JobStatus_JOB_STATUS_FAILED
+	}
+	if !j.FinishedAt.IsZero() {
+		pj.FinishedAt = timestamppb.New(j.FinishedAt)
+	}
+	return pj
+}
+
+// statsToProto は算出済みの統計情報を gRPC のメッセージへ変換する。at がゼロ値の場合は時刻を省略する。
+func statsToProto(at time.Time, c docker.ComputedStats) *playbinpb.ContainerStats {
+	ps := &playbinpb.ContainerStats{
+		CpuPercent:     c.CPUPercent,
+		OnlineCpus:     c.OnlineCPUs,
+		MemoryUsage:    c.MemoryUsage,
+		MemoryLimit:    c.MemoryLimit,
+		MemoryPercent:  c.MemoryPercent,
+		NetworkRx:      c.NetworkRx,
+		NetworkTx:      c.NetworkTx,
+		NetworkRxRate:  c.NetworkRxRate,
+		NetworkTxRate:  c.NetworkTxRate,
+		BlockRead:      c.BlockRead,
+		BlockWrite:     c.BlockWrite,
+		BlockReadRate:  c.BlockReadRate,
+		BlockWriteRate: c.BlockWriteRate,
+	}
+	if !at.IsZero() {
+		ps.Time = timestamppb.New(at)
+	}
+	return ps
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/forwarder"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: requireAdminPermission()
+// play-bin 自体の運用操作は全体に影響するため、サーバー名 "*" に対する権限として判定する。
+func (s *Server) requireAdminPermission(w http.ResponseWriter, r *http.Request, perm string) bool {
+	username := s.sessionUser(r)
+	if !s.Config.Get().Users[username].HasPermission("*", perm) {
+		logger.For(r.Context()).Warnf("Client", "API", "管理操作拒否: user=%s, perm=%s", username, perm)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Admin permission required", map[string]string{"permission": perm})
+		return false
+	}
+	return true
+}
+
+// MARK: LogLevelHandler()
+// GET: 適用中のログの出力形式としきい値を返す。
+// PUT: {"service": "API", "level": "debug"} でしきい値を実行中に変更する。service を省略すると全体、level を空にすると変更を取り消す。
+// DELETE: ?service= で指定したしきい値の変更を取り消し、設定ファイルの値へ戻す。
+// 実行中の変更は再起動まで有効で、設定ファイルの再読み込みでは失われない。
+func (s *Server) LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdminPermission(w, r, config.PermAdminLogLevel) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Service string `json:"service"`
+			Level   string `json:"level"`
+		}
+		if err := decodeJSON(w, r, &req); err != nil {
+			return
+		}
+		if req.Level == "" {
+			logger.ClearOverride(req.Service)
+			logger.For(r.Context()).Logf("Client", "API", "ログレベルの変更を取り消しました: user=%s, service=%s", s.sessionUser(r), req.Service)
+			break
+		}
+		level, err := logger.ParseLevel(req.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.SetOverride(req.Service, level)
+		logger.For(r.Context()).Logf("Client", "API", "ログレベルを変更しました: user=%s, service=%s, level=%s", s.sessionUser(r), req.Service, level)
+	case http.MethodDelete:
+		service := r.URL.Query().Get("service")
+		logger.ClearOverride(service)
+		logger.For(r.Context()).Logf("Client", "API", "ログレベルの変更を取り消しました: user=%s, service=%s", s.sessionUser(r), service)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logger.CurrentStatus())
+}
+
+// defaultAdminLogLines は /api/admin/logs で lines を省略した場合に返す件数。
+const defaultAdminLogLines = 200
+
+// MARK: LogsHandler()
+// メモリ上に保持している play-bin 自身の直近のログを古い順に返す。
+// クエリ: lines (件数、既定 200、0 で全件), level (この重要度以上), service (サービス名), q (メッセージに含む文字列), requestId (リクエスト ID)。
+func (s *Server) LogsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdminPermission(w, r, config.PermAdminLogs) {
+		return
+	}
+
+	q := r.URL.Query()
+	query := logger.Query{Limit: defaultAdminLogLines, Service: q.Get("service"), Contains: q.Get("q"), RequestID: q.Get("requestId")}
+	if v := q.Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid lines", http.StatusBadRequest)
+			return
+		}
+		query.Limit = n
+	}
+	if v := q.Get("level"); v != "" {
+		level, err := logger.ParseLevel(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.Severity = level
+	}
+
+	entries := logger.Recent(query)
+	if entries == nil {
+		entries = []logger.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// MARK: ForwarderHandler()
+// ログの転送先ごとの送信の統計 (未送信・成功・再送・失敗・キューの満杯による破棄の件数と直近のエラー) を返す。
+// 転送先の応答が遅い・失敗し続けることで、転送が欠落していないかの確認に使用する。
+func (s *Server) ForwarderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdminPermission(w, r, config.PermAdminForwarder) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(forwarder.Deliveries.Stats())
+}
+
+// MARK: PruneHandler()
+// Docker ホスト (?host=、省略時は既定のホスト) の未使用の資源を削除し、種類ごとの件数と回収した容量を返す。
+// ?targets=images,containers,networks,buildCache で種類を絞り込める (省略時は全て)。設定に定義されたサーバーのコンテナは停止中でも削除しない。
+// GET または ?dryRun=true では削除せずに、削除の候補と回収できる容量の見込みを返す。
+func (s *Server) PruneHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdminPermission(w, r, config.PermAdminPrune) {
+		return
+	}
+
+	q := r.URL.Query()
+	cli, err := docker.ForHost(q.Get("host"))
+	if err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "Dockerホストの解決に失敗: %v", err)
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+		return
+	}
+	targets := docker.PruneTargets
+	if t := q.Get("targets"); t != "" {
+		targets = strings.Split(t, ",")
+		for _, target := range targets {
+			if !slices.Contains(docker.PruneTargets, target) {
+				writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "unknown prune target: "+target, map[string]any{"targets": docker.PruneTargets})
+				return
+			}
+		}
+	}
+	dryRun := r.Method == http.MethodGet || q.Get("dryRun") == "true"
+
+	servers := s.Config.Get().Servers
+	managed := func(name string) bool {
+		_, ok := servers[name]
+		return ok
+	}
+	report, err := docker.Prune(r.Context(), cli, targets, managed, dryRun)
+	if err != nil {
+		logger.For(r.Context()).Errorf("External", "API", "資源の削除に失敗: host=%s, err=%v", q.Get("host"), err)
+		writeError(w, r, http.StatusBadGateway, ErrCodeUpstream, err.Error(), nil)
+		return
+	}
+	if !dryRun {
+		logger.For(r.Context()).Logf("Client", "API", "未使用の資源を削除しました: user=%s, host=%s, targets=%s, reclaimed=%d bytes",
+			s.sessionUser(r), q.Get("host"), strings.Join(targets, ","), report.Space)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: ReconcileHandler()
+// GET: 最後に行った設定と実際のコンテナの照合結果 (存在しないサーバー・作成後に変更されたイメージとマウント) を返す。未実施の場合は照合する。
+// POST: 改めて照合して結果を返す。?autostart=true では autostart を設定したサーバーのうち、コンテナが存在しないものを起動する。
+func (s *Server) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdminPermission(w, r, config.PermAdminReconcile) {
+		return
+	}
+
+	report := s.ContainerManager.LastReconcile()
+	if r.Method == http.MethodPost || report == nil {
+		autostart := r.Method == http.MethodPost && r.URL.Query().Get("autostart") == "true"
+		if autostart {
+			// サーバーの起動を伴うため、実行したユーザーを記録する。
+			logger.For(r.Context()).Logf("Client", "API", "照合による自動起動を実行します: user=%s", s.sessionUser(r))
+		}
+		result := s.ContainerManager.Reconcile(r.Context(), autostart)
+		report = &result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: GrantsHandler()
+// GET: 有効な期限付きの権限を期限の近い順で返す。?user= / ?server= で絞り込める。
+// POST: {"user", "server", "permissions", "expiresAt" または "duration", "reason"} で期限付きの権限を付与する。duration は "2h" 等の Go の形式。
+// DELETE: ?id= で指定した権限を期限前に取り消す。
+// 設定ファイルを編集せずに、イベントの進行役へ一時的にコンソール操作を許可する等の用途に使用する。
+func (s *Server) GrantsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdminPermission(w, r, config.PermAdminGrants) {
+		return
+	}
+	username := s.sessionUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		grants := []config.Grant{}
+		for _, g := range s.Config.Grants() {
+			if (q.Get("user") == "" || g.User == q.Get("user")) && (q.Get("server") == "" || g.Server == q.Get("server")) {
+				grants = append(grants, g)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grants)
+
+	case http.MethodPost:
+		var req struct {
+			User        string    `json:"user"`
+			Server      string    `json:"server"`
+			Permissions []string  `json:"permissions"`
+			ExpiresAt   time.Time `json:"expiresAt"`
+			Duration    string    `json:"duration"`
+			Reason      string    `json:"reason"`
+		}
+		if err := decodeJSON(w, r, &req); err != nil {
+			return
+		}
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid duration", map[string]string{"duration": req.Duration})
+				return
+			}
+			req.ExpiresAt = time.Now().Add(d)
+		}
+		grant, err := s.Config.AddGrant(config.Grant{
+			User: req.User, Server: req.Server, Permissions: req.Permissions,
+			ExpiresAt: req.ExpiresAt, CreatedBy: username, Reason: req.Reason,
+		})
+		switch {
+		case errors.Is(err, config.ErrInvalidGrant):
+			writeError(w, r, http.StatusUnprocessableEntity, ErrCodeUnprocessable, err.Error(), nil)
+			return
+		case err != nil && grant.ID == "":
+			logger.For(r.Context()).Errorf("Internal", "API", "一時的な権限の付与に失敗: err=%v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		case err != nil:
+			// 付与自体は反映済みのため、保存の失敗は記録のみとする (再起動で失われる)。
+			logger.For(r.Context()).Errorf("Internal", "API", "一時的な権限の保存に失敗: id=%s, err=%v", grant.ID, err)
+		}
+		logger.For(r.Context()).Logf("Client", "API", "一時的な権限を付与しました: user=%s, target=%s, server=%s, perms=%v, expires=%s",
+			username, grant.User, grant.Server, grant.Permissions, grant.ExpiresAt.Format(time.RFC3339))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(grant)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		err := s.Config.RevokeGrant(id)
+		switch {
+		case errors.Is(err, config.ErrGrantNotFound):
+			writeError(w, r, http.StatusNotFound, ErrCodeNotFound, err.Error(), nil)
+			return
+		case err != nil:
+			logger.For(r.Context()).Errorf("Internal", "API", "一時的な権限の保存に失敗: id=%s, err=%v", id, err)
+		}
+		logger.For(r.Context()).Logf("Client", "API", "一時的な権限を取り消しました: user=%s, id=%s", username, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
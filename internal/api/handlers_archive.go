@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/containerd/errdefs"
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logarchive"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// defaultArchiveMatches はアーカイブの検索で返す既定の件数。
+	defaultArchiveMatches = 200
+	// maxArchiveMatches はアーカイブの検索で返す件数の上限。
+	maxArchiveMatches = 5000
+)
+
+// MARK: ArchiveHandler()
+// ディスクに保存したコンテナのログを扱う。
+// ?q= を指定した場合は検索結果を、?file= を指定した場合はファイルの内容を、省略時はファイルの一覧を返す。
+func (s *Server) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	serverName := q.Get("id")
+	cfg := s.Config.Get().LogArchive
+	if cfg == nil || cfg.Directory == "" {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Log archive is not enabled", nil)
+		return
+	}
+
+	switch {
+	case q.Has("q") || q.Has("regex"):
+		s.searchArchive(w, r, serverName)
+		return
+	case q.Get("file") != "":
+		name := q.Get("file")
+		f, err := logarchive.Open(cfg, serverName, name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Archived log not found", map[string]string{"file": name})
+				return
+			}
+			logger.For(r.Context()).Errorf("Internal", "API", "保存済みログのオープンに失敗: container=%s, file=%s, err=%v", serverName, name, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": serverName + "-" + name}))
+		if _, err := io.Copy(w, f); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "保存済みログの送信に失敗: %v", err)
+		}
+		return
+	}
+
+	list, err := logarchive.List(cfg, serverName)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "保存済みログの一覧の取得に失敗: container=%s, err=%v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// searchArchive は保存済みのログのみを検索する。
+func (s *Server) searchArchive(w http.ResponseWriter, r *http.Request, serverName string) {
+	opts, ok := parseSearchOptions(w, r)
+	if !ok {
+		return
+	}
+	matches, truncated, err := logarchive.Search(r.Context(), s.Config.Get().LogArchive, serverName, opts)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		logger.For(r.Context()).Errorf("Internal", "API", "保存済みログの検索に失敗: container=%s, err=%v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	writeSearchResult(w, r, matches, truncated)
+}
+
+// MARK: SearchLogs()
+// 保存済みのログと、まだ保存されていない Docker のログを古い順に検索する。logArchive が無効な場合は Docker のログのみを検索する。
+// 結果が limit 件を超える場合は next を返し、cursor に指定すると続きを取得できる。
+func (s *Server) SearchLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	serverName := r.URL.Query().Get("id")
+	opts, ok := parseSearchOptions(w, r)
+	if !ok {
+		return
+	}
+
+	cfg := s.Config.Get().LogArchive
+	matches, truncated, err := logarchive.Search(r.Context(), cfg, serverName, opts)
+	if err == nil && !truncated {
+		// 保存済みの最後の行より後のみを検索し、保存済みの行との重複を避ける。
+		err = searchDockerLogs(r.Context(), serverName, logarchive.LastTime(cfg, serverName), opts, &matches)
+		truncated = len(matches) >= opts.Limit
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		logger.For(r.Context()).Errorf("Internal", "API", "ログの検索に失敗: container=%s, err=%v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	writeSearchResult(w, r, matches, truncated)
+}
+
+// searchDockerLogs は Docker のログのうち、archived より後の行を検索する。コンテナが存在しない場合は何もしない。
+func searchDockerLogs(ctx context.Context, serverName string, archived time.Time, opts logarchive.SearchOptions, matches *[]logarchive.Match) error {
+	inspect, err := docker.Inspects.Inspect(ctx, serverName)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return err
+	}
+	if archived.After(opts.After) {
+		opts.After = archived
+	}
+	logOptions := ctypes.LogsOptions{ShowStdout: true, ShowStderr: true, Timestamps: true}
+	// Docker の since は指定した時刻の行を含むため、After は SearchStream で除外する。
+	if from := maxTime(opts.Since, opts.After); !from.IsZero() {
+		logOptions.Since = from.Format(time.RFC3339Nano)
+	}
+	if !opts.Until.IsZero() {
+		logOptions.Until = opts.Until.Format(time.RFC3339Nano)
+	}
+	logs, err := cli.ContainerLogs(ctx, inspect.ID, logOptions)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	var reader io.Reader = logs
+	if !inspect.Config.Tty {
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, logs)
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		reader = pr
+	}
+	_, err = logarchive.SearchStream(ctx, reader, logarchive.Match{Source: logarchive.SourceDocker}, opts, matches)
+	return err
+}
+
+// maxTime は a と b のうち遅い方の時刻を返す。
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// parseSearchOptions はクエリから検索条件を読み取る。不正な値の場合はエラーを応答して false を返す。
+// 部分一致 (q) または正規表現 (regex) で検索し、since / until (RFC 3339) で範囲を、limit で件数を、cursor で前回の続きを指定する。
+func parseSearchOptions(w http.ResponseWriter, r *http.Request) (logarchive.SearchOptions, bool) {
+	q := r.URL.Query()
+	opts := logarchive.SearchOptions{Query: q.Get("q"), Limit: defaultArchiveMatches}
+	if pattern := q.Get("regex"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid regex: "+err.Error(), nil)
+			return opts, false
+		}
+		opts.Regex = re
+	}
+	if opts.Query == "" && opts.Regex == nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "q or regex is required", nil)
+		return opts, false
+	}
+	// cursor は前回の応答の next (最後に一致した行の時刻) をそのまま受け取る。
+	for _, v := range []struct {
+		key string
+		dst *time.Time
+	}{{"since", &opts.Since}, {"until", &opts.Until}, {"cursor", &opts.After}} {
+		if raw := q.Get(v.key); raw != "" {
+			t, err := time.Parse(time.RFC3339Nano, raw)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid "+v.key, map[string]string{v.key: raw})
+				return opts, false
+			}
+			*v.dst = t
+		}
+	}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid limit", map[string]string{"limit": raw})
+			return opts, false
+		}
+		opts.Limit = min(n, maxArchiveMatches)
+	}
+	return opts, true
+}
+
+// writeSearchResult は検索結果を返す。上限に達した場合は、続きを取得するためのカーソルを next に含める。
+func writeSearchResult(w http.ResponseWriter, r *http.Request, matches []logarchive.Match, truncated bool) {
+	body := map[string]any{"matches": matches, "truncated": truncated}
+	if truncated && len(matches) > 0 {
+		body["next"] = matches[len(matches)-1].Time.Format(time.RFC3339Nano)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
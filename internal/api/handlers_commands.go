@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+// maxCommandHistory はユーザー・サーバーごとに保持するコマンド履歴の件数。
+const maxCommandHistory = 50
+
+// MARK: CommandHistory
+// ユーザーごと・サーバーごとの最近送信したコマンドを保持し、再起動後も参照できるようファイルへ永続化する。
+type CommandHistory struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]map[string][]string // user -> server -> commands（新しい順）
+}
+
+// MARK: NewCommandHistory()
+// 履歴ファイルが存在すれば読み込み、存在しない場合は空の履歴で開始する。
+func NewCommandHistory(path string) *CommandHistory {
+	h := &CommandHistory{path: path, entries: make(map[string]map[string][]string)}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Internal", "API", "コマンド履歴の読み込みに失敗: %v", err)
+		}
+		return h
+	}
+	if err := json.Unmarshal(b, &h.entries); err != nil {
+		logger.Errorf("Internal", "API", "コマンド履歴のパースに失敗: %v", err)
+		h.entries = make(map[string]map[string][]string)
+	}
+	return h
+}
+
+// Add はコマンドを履歴の先頭に追加する。同じコマンドが既にあれば先頭へ移動する。
+func (h *CommandHistory) Add(user, server, command string) {
+	command = strings.TrimRight(command, "\r\n")
+	if user == "" || strings.TrimSpace(command) == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	servers, ok := h.entries[user]
+	if !ok {
+		servers = make(map[string][]string)
+		h.entries[user] = servers
+	}
+	list := slices.DeleteFunc(servers[server], func(c string) bool { return c == command })
+	list = append([]string{command}, list...)
+	if len(list) > maxCommandHistory {
+		list = list[:maxCommandHistory]
+	}
+	servers[server] = list
+	h.save()
+}
+
+// Get はユーザーの指定サーバーに対するコマンド履歴を新しい順に返す。
+func (h *CommandHistory) Get(user, server string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.entries[user][server])
+}
+
+// save は履歴をファイルへ書き出す。h.mu を保持した状態で呼び出すこと。
+func (h *CommandHistory) save() {
+	if err := fsutil.WriteJSON(h.path, h.entries, 0o600); err != nil {
+		logger.Errorf("Internal", "API", "コマンド履歴の保存に失敗: %v", err)
+	}
+}
+
+// MARK: CommandsHandler()
+// GET: サーバーに設定された定型コマンドと、ユーザーのコマンド履歴を返す（クイックアクションと補完に使用）。
+// POST: WebSocket 経由（Exec / Attach）で送信したコマンドを履歴へ追加する。
+func (s *Server) CommandsHandler(w http.ResponseWriter, r *http.Request) {
+	serverName := r.URL.Query().Get("id")
+	username := s.sessionUser(r)
+	cfg := s.Config.Get()
+
+	switch r.Method {
+	case http.MethodGet:
+		saved := cfg.Servers[serverName].Commands.Saved
+		if saved == nil {
+			saved = []config.SavedCommandConfig{}
+		}
+		history := s.History.Get(username, serverName)
+		if history == nil {
+			history = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"saved":   saved,
+			"history": history,
+		}); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		}
+
+	case http.MethodPost:
+		if !cfg.Users[username].HasPermission(serverName, config.PermContainerWrite) {
+			http.Error(w, "Write permission required", http.StatusForbidden)
+			return
+		}
+		var payload struct {
+			Command string `json:"command"`
+		}
+		if err := decodeJSON(w, r, &payload); err != nil {
+			logger.For(r.Context()).Warnf("Client", "API", "コマンドのデコードに失敗: %v", err)
+			return
+		}
+		s.History.Add(username, serverName, payload.Command)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
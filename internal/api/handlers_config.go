@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+// ConfigValidation は設定ファイルの検証結果を表す。
+type ConfigValidation struct {
+	File   string         `json:"file"`
+	Valid  bool           `json:"valid"` // エラーがなく、再読み込みで適用される
+	Issues []config.Issue `json:"issues"`
+}
+
+// maxConfigPatchSize は設定 (サーバー・ユーザー定義) へのパッチの最大サイズ。
+const maxConfigPatchSize = 1 << 20
+
+// MARK: requireConfigPermission()
+// 設定は play-bin 全体に影響するため、サーバー名 "*" に対する権限として判定する。
+func (s *Server) requireConfigPermission(w http.ResponseWriter, r *http.Request, perm string) bool {
+	username := s.sessionUser(r)
+	if !s.Config.Get().Users[username].HasPermission("*", perm) {
+		logger.For(r.Context()).Warnf("Client", "API", "設定操作拒否: user=%s, perm=%s", username, perm)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Config permission required", map[string]string{"permission": perm})
+		return false
+	}
+	return true
+}
+
+// MARK: GetConfig()
+// 現在適用されている設定（servers.d を統合し、環境変数等を解決した後）を、秘密情報を伏せて返す。
+func (s *Server) GetConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireConfigPermission(w, r, config.PermConfigRead) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Redact(s.Config.Get()))
+}
+
+// MARK: PatchServerConfig()
+// サーバー定義に JSON Merge Patch を適用して設定ファイルへ書き込み、即座に再読み込みする。本文が null の場合はサーバー定義を削除する。
+// 変更後の設定に検証エラーがある場合は書き込まず、422 と検証結果を返す。
+func (s *Server) PatchServerConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireConfigPermission(w, r, config.PermConfigWrite) {
+		return
+	}
+	serverName := r.URL.Query().Get("server")
+	patch, ok := readConfigPatch(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.Config.PatchServer(serverName, patch)
+	if err == nil {
+		logger.For(r.Context()).Logf("Client", "API", "サーバー定義を変更しました: user=%s, server=%s", s.sessionUser(r), serverName)
+	}
+	writePatchResult(w, r, result, err, "server="+serverName)
+}
+
+// MARK: PatchUserConfig()
+// ユーザー定義に JSON Merge Patch を適用して設定ファイルへ書き込み、即座に再読み込みする。本文が null の場合はユーザーを削除する。
+// 応答の形式は PatchServerConfig と同じ。
+func (s *Server) PatchUserConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireConfigPermission(w, r, config.PermConfigWrite) {
+		return
+	}
+	target := r.URL.Query().Get("user")
+	patch, ok := readConfigPatch(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := s.Config.PatchUser(target, patch)
+	if err == nil {
+		logger.For(r.Context()).Logf("Client", "API", "ユーザー定義を変更しました: user=%s, target=%s", s.sessionUser(r), target)
+	}
+	writePatchResult(w, r, result, err, "target="+target)
+}
+
+// readConfigPatch は設定へのパッチの本文を読み込む。上限で切り詰めると不正なパッチとして扱われるため、超過した場合は 413 で拒否する。
+func readConfigPatch(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigPatchSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body too large", map[string]int64{"limit": tooLarge.Limit})
+			return nil, false
+		}
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, false
+	}
+	return patch, true
+}
+
+// writePatchResult は設定の書き込み結果を応答する。検証エラーの場合は 422 と検証結果を返す。target はログに記録する対象の説明。
+func writePatchResult(w http.ResponseWriter, r *http.Request, result config.WriteResult, err error, target string) {
+	status := http.StatusOK
+	switch {
+	case err == nil:
+	case errors.Is(err, config.ErrInvalidConfig) && result.File != "":
+		if isV1(r) {
+			// /api/v1 では検証結果をエラー形式の details として返す。
+			writeError(w, r, http.StatusUnprocessableEntity, ErrCodeInvalidConfig, err.Error(), result)
+			return
+		}
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, config.ErrInvalidConfig), errors.Is(err, config.ErrInvalidName):
+		writeError(w, r, http.StatusUnprocessableEntity, ErrCodeInvalidConfig, err.Error(), nil)
+		return
+	case errors.Is(err, config.ErrInvalidPatch):
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidPatch, err.Error(), nil)
+		return
+	case errors.Is(err, config.ErrNotFound), errors.Is(err, config.ErrUserNotFound):
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, err.Error(), nil)
+		return
+	default:
+		logger.For(r.Context()).Errorf("Internal", "API", "設定の変更に失敗: %s, err=%v", target, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// MARK: ValidateConfig()
+// ディスク上の設定ファイルと servers.d を検証し、問題の一覧を返す。編集後、再読み込みで適用される前に内容を確認するために使用する。
+func (s *Server) ValidateConfig(w http.ResponseWriter, r *http.Request) {
+	if !s.requireConfigPermission(w, r, config.PermConfigRead) {
+		return
+	}
+
+	path := s.Config.Path
+	result := ConfigValidation{File: path, Issues: []config.Issue{}}
+	_, issues, err := config.Load(path)
+	if err != nil {
+		// 読み込み自体の失敗（構文エラー等）も、検証結果の 1 件として返す。
+		result.Issues = append(result.Issues, config.Issue{Level: config.LevelError, Message: err.Error()})
+	} else if issues != nil {
+		result.Issues = issues
+	}
+	result.Valid = !config.HasErrors(result.Issues)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
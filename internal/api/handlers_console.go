@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/logger"
+)
+
+// ConsoleStatus は attach モードのコンソールの利用状況を表す。
+type ConsoleStatus struct {
+	Holder  string    `json:"holder,omitempty"` // 書き込み権を保持しているユーザー（不在時は省略）
+	Since   time.Time `json:"since,omitzero"`   // 書き込み権の取得時刻
+	Viewers int       `json:"viewers"`          // 読み取り専用で接続中のセッション数
+}
+
+// consoleSession は attach モードの 1 接続を識別するための値。
+type consoleSession struct {
+	user string
+}
+
+// consoleState はコンテナ 1 つ分の接続状況を保持する。
+type consoleState struct {
+	holder  *consoleSession
+	since   time.Time
+	viewers map[*consoleSession]struct{}
+}
+
+// MARK: ConsoleLocks
+// コンテナごとの attach コンソールの書き込み権を管理する。
+// 同時に stdin へ書き込めるのは 1 セッションのみとし、他の接続は読み取り専用の閲覧者として扱う。
+type ConsoleLocks struct {
+	mu     sync.Mutex
+	states map[string]*consoleState
+}
+
+// MARK: NewConsoleLocks()
+func NewConsoleLocks() *ConsoleLocks {
+	return &ConsoleLocks{states: make(map[string]*consoleState)}
+}
+
+// Join はセッションを登録する。wantWrite が真で書き込み権が空いていれば取得し、true を返す。
+// 取得できなかった場合は閲覧者として登録され、現在の保持者名を返す。
+func (l *ConsoleLocks) Join(id, user string, wantWrite bool) (session *consoleSession, writable bool, holder string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st, ok := l.states[id]
+	if !ok {
+		st = &consoleState{viewers: make(map[*consoleSession]struct{})}
+		l.states[id] = st
+	}
+
+	session = &consoleSession{user: user}
+	if wantWrite && st.holder == nil {
+		st.holder = session
+		st.since = time.Now()
+		return session, true, user
+	}
+	st.viewers[session] = struct{}{}
+	if st.holder != nil {
+		holder = st.holder.user
+	}
+	return session, false, holder
+}
+
+// Leave はセッションの登録を解除し、書き込み権を保持していた場合は解放する。
+func (l *ConsoleLocks) Leave(id string, session *consoleSession) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st, ok := l.states[id]
+	if !ok {
+		return
+	}
+	if st.holder == session {
+		st.holder = nil
+		st.since = time.Time{}
+	}
+	delete(st.viewers, session)
+	if st.holder == nil && len(st.viewers) == 0 {
+		delete(l.states, id)
+	}
+}
+
+// Status は指定コンテナの現在の利用状況を返す。
+func (l *ConsoleLocks) Status(id string) ConsoleStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st, ok := l.states[id]
+	if !ok {
+		return ConsoleStatus{}
+	}
+	status := ConsoleStatus{Since: st.since, Viewers: len(st.viewers)}
+	if st.holder != nil {
+		status.Holder = st.holder.user
+	}
+	return status
+}
+
+// MARK: ConsoleStatusHandler()
+// attach コンソールの書き込み権を誰が保持しているかと、閲覧者数を返す。
+func (s *Server) ConsoleStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Consoles.Status(id)); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
@@ -1,59 +1,188 @@
 package api
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	ctypes "github.com/docker/docker/api/types/container"
+	timetypes "github.com/docker/docker/api/types/time"
+	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/container"
 	"github.com/play-bin/internal/docker"
 	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+	"github.com/play-bin/internal/query"
+)
+
+const (
+	// defaultExecTimeout は Exec API でタイムアウトが指定されなかった場合の待機時間。
+	defaultExecTimeout = 60 * time.Second
+	// maxExecTimeout は HTTP 接続を長時間占有しないよう、指定可能なタイムアウトの上限。
+	maxExecTimeout = 10 * time.Minute
+	// maxReadyWait は準備状態の問い合わせで、starting を抜けるまで待機する時間の上限。
+	maxReadyWait = 5 * time.Minute
 )
 
 // ContainerListItem はリスト表示用のコンテナ情報を表す。
 type ContainerListItem struct {
 	ID          string   `json:"id"`
 	Names       []string `json:"names"`
-	State       string   `json:"state"`       // running, stopped, missing
-	Actions     []string `json:"actions"`     // Available actions based on permission and config
-	Permissions []string `json:"permissions"` // "read", "write", "execute"
+	Host        string   `json:"host,omitempty"` // dockerHosts 名（既定ホストは省略）
+	Tags        []string `json:"tags,omitempty"` // 設定の tags
+	State       string   `json:"state"`          // running, stopped, missing, unreachable
+	Actions     []string `json:"actions"`        // Available actions based on permission and config
+	Permissions []string `json:"permissions"`    // container.read / container.write と、許可された操作ごとの container.execute.<action>
+
+	Ready      container.ReadyState  `json:"ready,omitempty"`      // ready 設定のあるサーバーの起動中のみ。starting, ready, timeout
+	LastAction *container.LastAction `json:"lastAction,omitempty"` // 最後に実行された操作 (誰が・いつ・どの経路で)
+	LastStop   *container.LastStop   `json:"lastStop,omitempty"`   // 最後の停止の終了コードと理由 (意図した停止か異常終了か)
+	LogLevels  bool                  `json:"logLevels,omitempty"`  // logFormat が定義され、ログをレベルで絞り込める
+	StartedAt  time.Time             `json:"startedAt,omitzero"`   // 起動中のみ。sort=uptime または stats 指定時に付与
+	Stats      *docker.ComputedStats `json:"stats,omitempty"`      // stats 指定時のみ。取得できなかった場合は省略
+}
+
+const (
+	// listStatsConcurrency は一覧の起動時刻・統計情報を取得する際に、Docker へ同時に発行する要求の上限。
+	listStatsConcurrency = 8
+	// listStatsTimeout は一覧の起動時刻・統計情報の取得を待つ時間。超過した項目は値を省略する。
+	listStatsTimeout = 5 * time.Second
+)
+
+// containerListQuery は ListContainers の絞り込み・並び替え・ページングの条件。
+type containerListQuery struct {
+	states []string // 空でない場合はいずれかの状態に一致するもののみ
+	name   string   // 空でない場合は名前にこの文字列を含むもののみ (大文字・小文字は区別しない)
+	tags   []string // 空でない場合はいずれかのパターンに一致するタグを持つもののみ
+	sort   string   // "name" (既定) / "state" / "uptime"
+	desc   bool     // 降順 (sort の先頭に "-")
+	limit  int      // 0 は全件
+	offset int
+	stats  bool // 起動中の項目に CPU / メモリ等の統計情報を付与する
+}
+
+// parseContainerListQuery はクエリ state, name, tag, sort, limit, offset, stats を解釈する。
+func parseContainerListQuery(q url.Values) (containerListQuery, error) {
+	lq := containerListQuery{name: strings.ToLower(q.Get("name")), sort: "name"}
+	if v := q.Get("state"); v != "" {
+		for st := range strings.SplitSeq(v, ",") {
+			if st = strings.TrimSpace(st); st != "" {
+				lq.states = append(lq.states, st)
+			}
+		}
+	}
+	if v := q.Get("tag"); v != "" {
+		for tag := range strings.SplitSeq(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				if _, err := path.Match(tag, ""); err != nil {
+					return lq, fmt.Errorf("invalid tag pattern %q", tag)
+				}
+				lq.tags = append(lq.tags, tag)
+			}
+		}
+	}
+	if v := q.Get("sort"); v != "" {
+		lq.sort, lq.desc = strings.TrimPrefix(v, "-"), strings.HasPrefix(v, "-")
+		if lq.sort != "name" && lq.sort != "state" && lq.sort != "uptime" {
+			return lq, fmt.Errorf("unknown sort key %q (expected name, state or uptime)", lq.sort)
+		}
+	}
+	for key, dst := range map[string]*int{"limit": &lq.limit, "offset": &lq.offset} {
+		if v := q.Get(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return lq, fmt.Errorf("invalid %s %q", key, v)
+			}
+			*dst = n
+		}
+	}
+	if v := q.Get("stats"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return lq, fmt.Errorf("invalid stats %q", v)
+		}
+		lq.stats = b
+	}
+	return lq, nil
 }
 
 // MARK: ListContainers()
 // 管理対象および実在するコンテナのリストを返す。
+// クエリで状態 (state、カンマ区切りで複数可)・名前の部分一致 (name)・タグ (tag、カンマ区切りで複数可。"*" 等のパターンも可) の絞り込み、並び替え (sort=name|state|uptime、"-" で降順)、
+// ページング (limit, offset) と、起動中の項目への統計情報の付与 (stats=true) を指定できる。絞り込み後の総数は X-Total-Count で返す。
 func (s *Server) ListContainers(w http.ResponseWriter, r *http.Request) {
-	// 現在のDocker上の全コンテナと管理対象設定を突き合わせるため、まずDockerから情報を取得する。
-	containers, err := docker.Client.ContainerList(r.Context(), ctypes.ListOptions{All: true})
+	lq, err := parseContainerListQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+		return
+	}
+
+	// ユーザーごとの権限に基づいたフィルタリングを行うため、セッションからユーザー情報を特定する。
+	result, total, err := s.containerList(r.Context(), s.sessionUser(r), lq)
 	if err != nil {
 		// Dockerデーモンとの通信失敗はサーバー内部の問題としてログに記録する。
-		logger.Logf("Internal", "API", "コンテナリストの取得に失敗: %v", err)
+		logger.For(r.Context()).Errorf("Internal", "API", "コンテナリストの取得に失敗: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// 突き合わせの効率化のため、Docker上のコンテナを名前をキーとしたマップに整理する。
-	dockerMap := make(map[string]ctypes.Summary)
-	for _, c := range containers {
-		for _, name := range c.Names {
-			// 先頭の '/' を除去して比較しやすくする。
-			dockerMap[name[1:]] = c
-		}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// JSON変換の失敗はプログラムの不備（Internal）として扱う。
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
 	}
+}
 
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		token = r.URL.Query().Get("token")
+// MARK: containerList()
+// ユーザーが閲覧できるコンテナを、条件に従って絞り込み・並び替え・ページングした上で、絞り込み後の総数と共に返す。
+// HTTP の一覧と gRPC の ListContainers で共通に使用する。
+func (s *Server) containerList(ctx context.Context, username string, lq containerListQuery) ([]ContainerListItem, int, error) {
+	// 現在のDocker上の全コンテナと管理対象設定を突き合わせるため、まず既定ホストから情報を取得する。
+	cli, err := docker.ForHost("")
+	if err != nil {
+		return nil, 0, err
+	}
+	containers, err := cli.ContainerList(ctx, ctypes.ListOptions{All: true})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// ユーザーごとの権限に基づいたフィルタリングを行うため、セッションからユーザー情報を特定する。
-	s.WebSessionMu.RLock()
-	username := s.WebSessions[token]
-	s.WebSessionMu.RUnlock()
+	// 突き合わせの効率化のため、Docker上のコンテナをホスト名・コンテナ名をキーとしたマップに整理する。
+	dockerMaps := map[string]map[string]ctypes.Summary{"": summariesByName(containers)}
+
+	// 名前付きホスト上のコンテナも取得する。到達不能なホストは一覧全体を失敗させず、個別に状態を示す。
+	unreachable := make(map[string]bool)
+	for _, hostName := range docker.HostNames() {
+		if hostName == "" {
+			continue
+		}
+		hostCli, err := docker.ForHost(hostName)
+		if err == nil {
+			var hostContainers []ctypes.Summary
+			if hostContainers, err = hostCli.ContainerList(ctx, ctypes.ListOptions{All: true}); err == nil {
+				dockerMaps[hostName] = summariesByName(hostContainers)
+				continue
+			}
+		}
+		logger.For(ctx).Errorf("External", "API", "ホスト %s のコンテナリスト取得に失敗: %v", hostName, err)
+		unreachable[hostName] = true
+	}
 
 	cfg := s.Config.Get()
 	user := cfg.Users[username]
@@ -71,28 +200,41 @@ func (s *Server) ListContainers(w http.ResponseWriter, r *http.Request) {
 		item := ContainerListItem{
 			ID:    serverName,
 			Names: []string{"/" + serverName},
+			Host:  serverCfg.Host,
+			Tags:  serverCfg.Tags,
 		}
 
-		if c, exists := dockerMap[serverName]; exists {
+		if pc := serverCfg.ProcessSettings(); pc != nil {
+			// ホスト上で直接実行するサーバーは、Docker ではなくプロセスの状態を返す。
+			status, err := process.Inspect(ctx, serverName, *pc)
+			if err != nil {
+				logger.For(ctx).Errorf("External", "API", "プロセスの状態の取得に失敗: server=%s, err=%v", serverName, err)
+				status.State = "unreachable"
+			}
+			item.State = status.State
+		} else if c, exists := dockerMaps[serverCfg.Host][cfg.ContainerName(serverName)]; exists && docker.OwnedBy(c.Labels, cfg.ContainerName(serverName), serverName) {
+			// 同じ名前の管理外のコンテナはサーバーのコンテナとせず、未管理のコンテナとして一覧に含める。
 			item.State = c.State
-			processedDockerNames[serverName] = true
+			if serverCfg.Host == "" {
+				processedDockerNames[cfg.ContainerName(serverName)] = true
+			}
+		} else if unreachable[serverCfg.Host] {
+			item.State = "unreachable"
 		} else {
 			item.State = "missing"
 		}
+		if item.State == "running" {
+			item.Ready = s.ContainerManager.Readiness.Status(serverName).State
+		}
+		item.LogLevels = serverCfg.LogFormat != nil
+		if st := s.ContainerManager.States.Get(serverName); st != nil {
+			item.LastAction, item.LastStop = st.LastAction, st.LastStop
+		}
 
 		// 利用可能なアクションを計算する
 		item.Actions = s.calculateActions(user, serverName, serverCfg)
 		// 権限リストも付与する（フロントエンドでのボタン制御用）
-		// 権限リストの付与
-		if user.HasPermission(serverName, config.PermContainerRead) {
-			item.Permissions = append(item.Permissions, config.PermContainerRead)
-		}
-		if user.HasPermission(serverName, config.PermContainerWrite) {
-			item.Permissions = append(item.Permissions, config.PermContainerWrite)
-		}
-		if user.HasPermission(serverName, config.PermContainerExecute) {
-			item.Permissions = append(item.Permissions, config.PermContainerExecute)
-		}
+		item.Permissions = containerPermissions(user, serverName)
 		result = append(result, item)
 	}
 
@@ -113,86 +255,232 @@ func (s *Server) ListContainers(w http.ResponseWriter, r *http.Request) {
 			State: c.State,
 		}
 		// 権限リストも付与
-		if user.HasPermission(name, config.PermContainerRead) {
-			item.Permissions = append(item.Permissions, config.PermContainerRead)
+		item.Permissions = containerPermissions(user, name)
+		result = append(result, item)
+	}
+
+	// 絞り込み → (起動時刻の取得) → 並び替え → ページング → (統計情報の取得) の順とし、Docker への問い合わせを必要な項目に限定する。
+	result = filterContainerList(result, lq)
+	if lq.sort == "uptime" || lq.stats {
+		s.fillContainerDetails(ctx, result, false)
+	}
+	sortContainerList(result, lq)
+	total := len(result)
+	if lq.offset > 0 {
+		result = result[min(lq.offset, len(result)):]
+	}
+	if lq.limit > 0 && len(result) > lq.limit {
+		result = result[:lq.limit]
+	}
+	if lq.stats {
+		s.fillContainerDetails(ctx, result, true)
+	}
+	return result, total, nil
+}
+
+// filterContainerList は状態・名前・タグの条件に一致する項目のみを返す。タグを指定した場合、設定にないコンテナは含めない。
+func filterContainerList(items []ContainerListItem, lq containerListQuery) []ContainerListItem {
+	return slices.DeleteFunc(items, func(item ContainerListItem) bool {
+		if len(lq.states) > 0 && !slices.Contains(lq.states, item.State) {
+			return true
 		}
-		if user.HasPermission(name, config.PermContainerWrite) {
-			item.Permissions = append(item.Permissions, config.PermContainerWrite)
+		if len(lq.tags) > 0 && !slices.ContainsFunc(lq.tags, func(pattern string) bool { return config.MatchTags(pattern, item.Tags) }) {
+			return true
 		}
-		if user.HasPermission(name, config.PermContainerExecute) {
-			item.Permissions = append(item.Permissions, "execute")
+		return lq.name != "" && !strings.Contains(strings.ToLower(item.name()), lq.name)
+	})
+}
+
+// sortContainerList は指定されたキーで並び替える。キーが等しい項目は名前順とする。
+func sortContainerList(items []ContainerListItem, lq containerListQuery) {
+	now := time.Now()
+	uptime := func(item ContainerListItem) time.Duration {
+		if item.StartedAt.IsZero() {
+			return 0
 		}
-		result = append(result, item)
+		return now.Sub(item.StartedAt)
 	}
+	slices.SortStableFunc(items, func(a, b ContainerListItem) int {
+		c := 0
+		switch lq.sort {
+		case "state":
+			c = strings.Compare(a.State, b.State)
+		case "uptime":
+			c = cmp.Compare(uptime(a), uptime(b))
+		}
+		if c == 0 {
+			c = strings.Compare(strings.ToLower(a.name()), strings.ToLower(b.name()))
+		}
+		if lq.desc {
+			return -c
+		}
+		return c
+	})
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(result); err != nil {
-		// JSON変換の失敗はプログラムの不備（Internal）として扱う。
-		logger.Logf("Internal", "API", "JSONエンコード失敗: %v", err)
+// name は先頭の '/' を除いたコンテナ名を返す。
+func (item ContainerListItem) name() string {
+	if len(item.Names) == 0 {
+		return item.ID
 	}
+	return strings.TrimPrefix(item.Names[0], "/")
 }
 
-func containerToPerm(a container.Action) string {
-	switch a {
-	case container.ActionStart:
-		return config.PermContainerStart
-	case container.ActionStop:
-		return config.PermContainerStop
-	case container.ActionKill:
-		return config.PermContainerKill
-	case container.ActionBackup:
-		return config.PermContainerBackup
-	case container.ActionRemove:
-		return config.PermContainerRemove
-	default:
-		return config.PermContainerExecute
+// fillContainerDetails は起動中の項目に起動時刻 (withStats の場合は統計情報) を並行して付与する。
+// 一覧の応答を遅らせないよう、時間内に取得できなかった項目や取得に失敗した項目は値を省略する。
+func (s *Server) fillContainerDetails(ctx context.Context, items []ContainerListItem, withStats bool) {
+	ctx, cancel := context.WithTimeout(ctx, listStatsTimeout)
+	defer cancel()
+	sem := make(chan struct{}, listStatsConcurrency)
+	var wg sync.WaitGroup
+	for i := range items {
+		item := &items[i]
+		if item.State != "running" {
+			continue
+		}
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if item.StartedAt.IsZero() {
+				if inspect, err := docker.Inspects.InspectOnHost(ctx, item.Host, docker.ContainerName(item.ID)); err == nil && inspect.State != nil {
+					item.StartedAt, _ = time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+				}
+			}
+			if withStats {
+				cli, err := docker.ForHost(item.Host)
+				if err != nil {
+					return
+				}
+				if stats, err := docker.StatsSnapshot(ctx, cli, docker.ContainerName(item.ID)); err == nil {
+					item.Stats = &stats
+				} else {
+					logger.For(ctx).Debugf("External", "API", "統計情報の取得に失敗: container=%s, err=%v", item.name(), err)
+				}
+			}
+		})
 	}
+	wg.Wait()
+}
+
+// summariesByName はコンテナ一覧を、先頭の '/' を除いたコンテナ名をキーとしたマップへ変換する。
+func summariesByName(containers []ctypes.Summary) map[string]ctypes.Summary {
+	m := make(map[string]ctypes.Summary)
+	for _, c := range containers {
+		for _, name := range c.Names {
+			m[name[1:]] = c
+		}
+	}
+	return m
 }
 
 // MARK: calculateActions()
 // ユーザー権限とサーバー設定に基づいて、実行可能なアクションのリストを生成する。
+// 操作ごとの権限を個別に判定し、許可されていない操作はボタンごと表示しないようにする。
 func (s *Server) calculateActions(user config.UserConfig, name string, cfg config.ServerConfig) []string {
-	// execute権限がない場合はアクションなし
-	if !user.HasPermission(name, config.PermContainerExecute) {
-		return []string{}
-	}
-
-	var actions []string
+	var candidates []container.Action
 
 	// 設定ファイルに定義が存在する場合のみ追加
-	if cfg.Compose != nil && cfg.Compose.Image != "" {
-		actions = append(actions, "start")
+	if cfg.Compose.ImageRef(name) != "" || cfg.Process != nil {
+		candidates = append(candidates, container.ActionStart)
 	}
 	if cfg.Commands.Stop != nil { // 停止定義があれば Stop と Kill を許可
-		actions = append(actions, "stop")
-		actions = append(actions, "kill")
+		candidates = append(candidates, container.ActionStop, container.ActionKill)
 	}
 	if len(cfg.Commands.Backup) > 0 {
-		actions = append(actions, "backup")
-		actions = append(actions, "restore")
+		candidates = append(candidates, container.ActionBackup, container.ActionRestore)
 	}
 
 	// 物理的なコンテナが存在する場合のみ、削除(remove)を許可する
-	actions = append(actions, "remove")
+	if cfg.Process == nil {
+		candidates = append(candidates, container.ActionRemove)
+	}
 
+	actions := []string{}
+	for _, a := range candidates {
+		if user.HasPermission(name, a.Permission()) {
+			actions = append(actions, string(a))
+		}
+	}
 	return actions
 }
 
+// containerActions は操作ごとの権限を判定する対象の操作。
+var containerActions = []container.Action{
+	container.ActionStart, container.ActionStop, container.ActionKill,
+	container.ActionBackup, container.ActionRestore, container.ActionRemove, container.ActionSnapshot, container.ActionMigrate,
+}
+
+// containerPermissions はフロントエンドでのボタン制御用に、コンテナに対して保持している権限を列挙する。
+// 操作の権限は、ワイルドカードで付与されていても操作ごとの名前 (container.execute.start 等) で返す。
+func containerPermissions(user config.UserConfig, name string) []string {
+	var perms []string
+	for _, p := range []string{config.PermContainerRead, config.PermContainerWrite, config.PermContainerShare} {
+		if user.HasPermission(name, p) {
+			perms = append(perms, p)
+		}
+	}
+	for _, a := range containerActions {
+		if user.HasPermission(name, a.Permission()) {
+			perms = append(perms, a.Permission())
+		}
+	}
+	return perms
+}
+
 // MARK: InspectContainer()
 // コンテナの詳細情報を取得する。
 func (s *Server) InspectContainer(w http.ResponseWriter, r *http.Request) {
 	serverName := r.URL.Query().Get("id")
+	if pc := s.Config.Get().Servers[serverName].ProcessSettings(); pc != nil {
+		s.inspectProcess(w, r, serverName, *pc)
+		return
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "Dockerホストの解決に失敗: container=%s, err=%v", serverName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	// 詳細情報を取得し、フロントエンドでの詳細表示（スペックやネットワーク設定など）に利用する。
-	inspect, err := docker.Client.ContainerInspect(r.Context(), serverName)
+	// 同じ名前の play-bin の管理外のコンテナは、サーバーのコンテナとして返さない。
+	ref, err := docker.Ref(r.Context(), serverName)
+	var inspect ctypes.InspectResponse
+	if err == nil {
+		inspect, err = cli.ContainerInspect(r.Context(), ref)
+	}
 	if err != nil {
 		// コンテナが見つからない原因はクライアントからの無効な指定（Client）として扱う。
-		logger.Logf("Client", "API", "コンテナ %s の詳細取得失敗: %v", serverName, err)
+		logger.For(r.Context()).Warnf("Client", "API", "コンテナ %s の詳細取得失敗: %v", serverName, err)
 		http.Error(w, "Container Not Found", http.StatusNotFound)
 		return
 	}
+	// Docker の詳細情報に、play-bin が記録した最後の操作と停止理由を playbin として付け加える。
+	resp := struct {
+		ctypes.InspectResponse
+		PlayBin *container.ServerState `json:"playbin,omitempty"`
+	}{inspect, s.ContainerManager.States.Get(serverName)}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// inspectProcess はホスト上で直接実行するサーバーの状態を、Docker の詳細情報の代わりに process として返す。
+func (s *Server) inspectProcess(w http.ResponseWriter, r *http.Request, serverName string, pc config.ProcessConfig) {
+	status, err := process.Inspect(r.Context(), serverName, pc)
+	if err != nil {
+		logger.For(r.Context()).Errorf("External", "API", "プロセスの状態の取得に失敗: server=%s, err=%v", serverName, err)
+		http.Error(w, "Failed to inspect process", http.StatusInternalServerError)
+		return
+	}
+	resp := struct {
+		Name    string                 `json:"Name"`
+		Process process.Status         `json:"process"`
+		PlayBin *container.ServerState `json:"playbin,omitempty"`
+	}{"/" + serverName, status, s.ContainerManager.States.Get(serverName)}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(inspect); err != nil {
-		logger.Logf("Internal", "API", "JSONエンコード失敗: %v", err)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
 	}
 }
 
@@ -202,52 +490,129 @@ func (s *Server) Action(action container.Action) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		serverName := r.URL.Query().Get("id")
 
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			token = r.URL.Query().Get("token")
+		username := s.sessionUser(r)
+
+		// バックアップ・リストア等の長時間処理に対応するため、HTTPリクエストのキャンセルからは切り離し、
+		// リクエスト ID のみを引き継いだ十分なタイムアウトを持つコンテキストを使用する。
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Minute)
+		defer cancel()
+		// start は ?wait=ready の指定で、コンテナの起動ではなくサーバーの準備完了 (ready 設定) を待ってから応答する。
+		if action == container.ActionStart && r.URL.Query().Get("wait") == "ready" {
+			ctx = container.WithWaitReady(ctx)
 		}
-		s.WebSessionMu.RLock()
-		username := s.WebSessions[token]
-		s.WebSessionMu.RUnlock()
 
-		if !s.Config.Get().Users[username].HasPermission(serverName, containerToPerm(action)) {
-			logger.Logf("Client", "API", "Action拒否: user=%s, target=%s", username, serverName)
-			http.Error(w, "Execute permission required", http.StatusForbidden)
+		// id=tag:<pattern> の場合は、タグが一致する全てのサーバーへ同じ操作を実行する。
+		if pattern, ok := config.TagSelector(serverName); ok {
+			s.bulkAction(ctx, w, r, username, pattern, action)
 			return
 		}
 
-		// バックアップ・リストア等の長時間処理に対応するため、HTTPリクエストのコンテキストではなく、
-		// 十分なタイムアウトを持つ背景コンテキストを使用する。
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-		defer cancel()
+		// 操作ごとの権限 (container.execute.start 等) を要求し、例えばバックアップのみを許可された運用者が停止できないようにする。
+		perm := action.Permission()
+		if !s.Config.Get().Users[username].HasPermission(serverName, perm) {
+			logger.For(r.Context()).Warnf("Client", "API", "Action拒否: user=%s, target=%s, action=%s", username, serverName, action)
+			writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Execute permission required", map[string]string{"permission": perm, "server": serverName})
+			return
+		}
 
 		// 共通のマネージャーを介して非同期または連鎖的なアクション（停止前コマンド等）を実行する。
 		if err := s.ContainerManager.ExecuteAction(ctx, serverName, action); err != nil {
+			if writeCooldownError(w, r, err) {
+				return
+			}
 			// アクションの失敗は、コンテナの状態不整合やリソース不足などの内部問題（Internal）として扱う。
-			logger.Logf("Internal", "API", "コンテナ %s へのアクション %s 実行失敗: %v", serverName, action, err)
+			logger.For(r.Context()).Errorf("Internal", "API", "コンテナ %s へのアクション %s 実行失敗: %v", serverName, action, err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		logger.Logf("Internal", "API", "アクション実行成功: container=%s, action=%s", serverName, action)
+		logger.For(r.Context()).Logf("Internal", "API", "アクション実行成功: container=%s, action=%s", serverName, action)
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
+// bulkActionConcurrency は一括操作で同時に実行する操作の上限。
+const bulkActionConcurrency = 4
+
+// BulkActionResult は一括操作のサーバーごとの結果。
+type BulkActionResult struct {
+	Server string `json:"server"`
+	Error  string `json:"error,omitempty"` // 成功した場合は空
+}
+
+// MARK: bulkAction()
+// タグがパターンに一致し、閲覧権限 (container.read) のあるサーバーへ同じ操作を並行して実行し、サーバーごとの結果を返す。
+// 操作の権限がないサーバーや失敗したサーバーは、他のサーバーの操作を妨げないよう結果のエラーとして返す。
+func (s *Server) bulkAction(ctx context.Context, w http.ResponseWriter, r *http.Request, username, pattern string, action container.Action) {
+	cfg := s.Config.Get()
+	user := cfg.Users[username]
+	var targets []string
+	for _, name := range cfg.ServersWithTag(pattern) {
+		if user.HasPermission(name, config.PermContainerRead) {
+			targets = append(targets, name)
+		}
+	}
+	if len(targets) == 0 {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "No server matches the tag", map[string]string{"tag": pattern})
+		return
+	}
+
+	results := make([]BulkActionResult, len(targets))
+	sem := make(chan struct{}, bulkActionConcurrency)
+	var wg sync.WaitGroup
+	for i, name := range targets {
+		results[i].Server = name
+		if !user.HasPermission(name, action.Permission()) {
+			results[i].Error = "permission denied: " + action.Permission()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := s.ContainerManager.ExecuteAction(ctx, name, action); err != nil {
+				logger.For(r.Context()).Errorf("Internal", "API", "コンテナ %s へのアクション %s 実行失敗: %v", name, action, err)
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	logger.For(r.Context()).Logf("Internal", "API", "一括アクションを実行しました: tag=%s, action=%s, servers=%v", pattern, action, targets)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"tag": pattern, "action": action, "results": results}); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: writeCooldownError()
+// 待機時間 (cooldowns) 内の操作の拒否であれば、Retry-After を付けて 429 を返し true を返す。
+func writeCooldownError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var cooldown *container.CooldownError
+	if !errors.As(err, &cooldown) {
+		return false
+	}
+	retryAfter := max(1, int(math.Ceil(cooldown.RetryAfter.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, r, http.StatusTooManyRequests, ErrCodeCooldown, cooldown.Error(), map[string]any{"action": cooldown.Action, "retryAfter": retryAfter})
+	return true
+}
+
 // MARK: ListBackups()
-// 指定コンテナのバックアップ世代一覧を返す。
+// 指定コンテナのバックアップ世代一覧を、実行の経路・ユーザー・所要時間・サイズ・結果と共に新しい順で返す。
 func (s *Server) ListBackups(w http.ResponseWriter, r *http.Request) {
 	serverName := r.URL.Query().Get("id")
 
-	generations, err := s.ContainerManager.ListBackupGenerations(serverName)
+	backups, err := s.ContainerManager.ListBackups(serverName)
 	if err != nil {
-		logger.Logf("Internal", "API", "バックアップ世代一覧取得失敗: container=%s, err=%v", serverName, err)
+		logger.For(r.Context()).Errorf("Internal", "API", "バックアップ世代一覧取得失敗: container=%s, err=%v", serverName, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(generations); err != nil {
-		logger.Logf("Internal", "API", "JSONエンコード失敗: %v", err)
+	if err := json.NewEncoder(w).Encode(backups); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
 	}
 }
 
@@ -257,50 +622,94 @@ func (s *Server) RestoreAction(w http.ResponseWriter, r *http.Request) {
 	serverName := r.URL.Query().Get("id")
 	generation := r.URL.Query().Get("generation")
 
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		token = r.URL.Query().Get("token")
-	}
-	s.WebSessionMu.RLock()
-	username := s.WebSessions[token]
-	s.WebSessionMu.RUnlock()
+	username := s.sessionUser(r)
 
-	if !s.Config.Get().Users[username].HasPermission(serverName, config.PermContainerRestore) {
-		logger.Logf("Client", "API", "Restore拒否: user=%s, target=%s", username, serverName)
-		http.Error(w, "Execute permission required", http.StatusForbidden)
+	perm := container.ActionRestore.Permission()
+	if !s.Config.Get().Users[username].HasPermission(serverName, perm) {
+		logger.For(r.Context()).Warnf("Client", "API", "Restore拒否: user=%s, target=%s", username, serverName)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Execute permission required", map[string]string{"permission": perm, "server": serverName})
 		return
 	}
 
-	// バックアップ・リストア等の長時間処理に対応するため、HTTPリクエストのコンテキストではなく、
-	// 十分なタイムアウトを持つ背景コンテキストを使用する。
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	// バックアップ・リストア等の長時間処理に対応するため、HTTPリクエストのキャンセルからは切り離し、
+	// リクエスト ID のみを引き継いだ十分なタイムアウトを持つコンテキストを使用する。
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Minute)
 	defer cancel()
 
 	// 世代パラメータを受けて直接 Restore を呼び出す。
 	if err := s.ContainerManager.Restore(ctx, serverName, generation); err != nil {
-		logger.Logf("Internal", "API", "コンテナ %s のリストア失敗 (generation=%s): %v", serverName, generation, err)
+		if writeCooldownError(w, r, err) {
+			return
+		}
+		logger.For(r.Context()).Errorf("Internal", "API", "コンテナ %s のリストア失敗 (generation=%s): %v", serverName, generation, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	logger.Logf("Internal", "API", "リストア成功: container=%s, generation=%s", serverName, generation)
+	logger.For(r.Context()).Logf("Internal", "API", "リストア成功: container=%s, generation=%s", serverName, generation)
 	w.WriteHeader(http.StatusOK)
 }
 
+// MARK: MigrateAction()
+// POST: {"target": <dockerHosts 名>, "transfer": "rsync" | "s3", "dryRun": bool} でサーバーを別の Docker ホストへ移行する。
+// 成功時は実行した手順を返す。失敗時はエラーの details に、ロールバックの有無を含む手順を返す。
+func (s *Server) MigrateAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	serverName := r.URL.Query().Get("id")
+	username := s.sessionUser(r)
+
+	perm := container.ActionMigrate.Permission()
+	if !s.Config.Get().Users[username].HasPermission(serverName, perm) {
+		logger.For(r.Context()).Warnf("Client", "API", "Migrate拒否: user=%s, target=%s", username, serverName)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Execute permission required", map[string]string{"permission": perm, "server": serverName})
+		return
+	}
+
+	var payload struct {
+		Target   string `json:"target"`
+		Transfer string `json:"transfer"`
+		DryRun   bool   `json:"dryRun"`
+	}
+	if err := decodeJSON(w, r, &payload); err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "移行のリクエストのデコードに失敗: %v", err)
+		return
+	}
+
+	// データの転送は容量に応じて長時間となるため、リクエストのキャンセルから切り離し、バックアップより長い期限を設ける。
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 6*time.Hour)
+	defer cancel()
+
+	plan, err := s.ContainerManager.Migrate(ctx, serverName, container.MigrateOptions{Target: payload.Target, Transfer: payload.Transfer, DryRun: payload.DryRun})
+	if err != nil {
+		if writeCooldownError(w, r, err) {
+			return
+		}
+		logger.For(r.Context()).Errorf("Internal", "API", "コンテナ %s の移行失敗 (target=%s): %v", serverName, payload.Target, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, container.ErrMigrationUnsupported) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, r, status, codeForStatus(status), err.Error(), plan)
+		return
+	}
+	logger.For(r.Context()).Logf("Internal", "API", "移行成功: container=%s, target=%s, dryRun=%t", serverName, payload.Target, payload.DryRun)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
 // MARK: CmdContainer()
 // コンテナの標準入力(stdin)に対してコマンドを送信する。
 func (s *Server) CmdContainer(w http.ResponseWriter, r *http.Request) {
 	serverName := r.URL.Query().Get("id")
 
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		token = r.URL.Query().Get("token")
-	}
-	s.WebSessionMu.RLock()
-	username := s.WebSessions[token]
-	s.WebSessionMu.RUnlock()
+	username := s.sessionUser(r)
 
 	if !s.Config.Get().Users[username].HasPermission(serverName, config.PermContainerWrite) {
-		logger.Logf("Client", "API", "Cmd拒否: user=%s, target=%s", username, serverName)
+		logger.For(r.Context()).Warnf("Client", "API", "Cmd拒否: user=%s, target=%s", username, serverName)
 		http.Error(w, "Write permission required", http.StatusForbidden)
 		return
 	}
@@ -309,30 +718,209 @@ func (s *Server) CmdContainer(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		Command string `json:"command"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		logger.Logf("Client", "API", "コマンドのデコードに失敗: %v", err)
-		http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &payload); err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "コマンドのデコードに失敗: %v", err)
 		return
 	}
 
 	// 指定されたコンテナに対して生のコマンド文字列を流し込む。
 	if err := docker.SendCommand(serverName, payload.Command); err != nil {
 		// 送信失敗は接続断などの内部的な要因（Internal）として扱う。
-		logger.Logf("Internal", "API", "コンテナ %s へのコマンド送信失敗: %v", serverName, err)
+		logger.For(r.Context()).Errorf("Internal", "API", "コンテナ %s へのコマンド送信失敗: %v", serverName, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	logger.Logf("Internal", "API", "コマンド送信成功: container=%s, cmd_len=%d", serverName, len(payload.Command))
+	logger.For(r.Context()).Logf("Internal", "API", "コマンド送信成功: container=%s, cmd_len=%d", serverName, len(payload.Command))
+	s.History.Add(username, serverName, payload.Command)
 	w.WriteHeader(http.StatusOK)
 }
 
+// MARK: ExecContainer()
+// コンテナ内で任意のコマンドを実行し、標準出力・標準エラー・終了コードを返す。
+// シェルを介さずに引数リストをそのまま実行するため、シェル構文が必要な場合は cmd に sh -c を指定する。
+func (s *Server) ExecContainer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	serverName := r.URL.Query().Get("id")
+	username := s.sessionUser(r)
+
+	// 任意コマンドの実行はコンソール入力よりも強い権限のため、専用の権限で判定する。
+	if !s.Config.Get().Users[username].HasPermission(serverName, config.PermContainerExec) {
+		logger.For(r.Context()).Warnf("Client", "API", "Exec拒否: user=%s, target=%s", username, serverName)
+		http.Error(w, "Exec permission required", http.StatusForbidden)
+		return
+	}
+
+	var payload struct {
+		docker.ExecRequest
+		Command string `json:"command"` // cmd の代わりに 1 つの文字列で指定する。引用符とエスケープをシェルと同様に解釈して引数へ分割する
+		Timeout int    `json:"timeout"` // 秒。省略時は defaultExecTimeout
+	}
+	if err := decodeJSON(w, r, &payload); err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "Execリクエストのデコードに失敗: %v", err)
+		return
+	}
+	if payload.Command != "" {
+		if len(payload.Cmd) > 0 {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "cmd and command cannot be used together", nil)
+			return
+		}
+		argv, err := config.SplitCommandLine(payload.Command)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid command: "+err.Error(), map[string]string{"command": payload.Command})
+			return
+		}
+		payload.Cmd = argv
+	}
+	if len(payload.Cmd) == 0 {
+		http.Error(w, "cmd is required", http.StatusBadRequest)
+		return
+	}
+
+	timeout := defaultExecTimeout
+	if payload.Timeout > 0 {
+		timeout = min(time.Duration(payload.Timeout)*time.Second, maxExecTimeout)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	logger.For(r.Context()).Logf("Client", "API", "Execを実行します: user=%s, container=%s, cmd=%q", username, serverName, payload.Cmd)
+	result, err := docker.Exec(ctx, serverName, payload.ExecRequest)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "コンテナ %s でのExec失敗: %v", serverName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.TimedOut {
+		logger.For(r.Context()).Warnf("Client", "API", "Execがタイムアウトしました: container=%s, timeout=%s", serverName, timeout)
+	} else {
+		logger.For(r.Context()).Logf("Internal", "API", "Exec完了: container=%s, exit=%d", serverName, result.ExitCode)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: GetPlayers()
+// 設定されたプロトコルでゲームサーバーへ問い合わせ、プレイヤー数や MOTD を返す。
+func (s *Server) GetPlayers(w http.ResponseWriter, r *http.Request) {
+	serverName := r.URL.Query().Get("id")
+	queryCfg := s.Config.Get().Servers[serverName].Query
+	if queryCfg == nil {
+		http.Error(w, "Query is not configured for this server", http.StatusNotFound)
+		return
+	}
+
+	result, err := query.Cached(r.Context(), serverName, *queryCfg)
+	if err != nil {
+		logger.For(r.Context()).Warnf("Internal", "API", "サーバー問い合わせの設定が不正です: container=%s, err=%v", serverName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: TrafficHandler()
+// サーバーのネットワークの通信量を、月ごとの合計と ?month= (YYYY-MM。省略時は今月) の日ごとの内訳で返す。
+func (s *Server) TrafficHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	serverName := q.Get("id")
+	if _, ok := s.Config.Get().Servers[serverName]; !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Server not found", map[string]string{"server": serverName})
+		return
+	}
+	month := q.Get("month")
+	if month != "" {
+		if _, err := time.Parse("2006-01", month); err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid month (expected YYYY-MM)", map[string]string{"month": month})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.ContainerManager.Traffic.Summary(serverName, month)); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: ReadyHandler()
+// サーバーの準備状態 (starting, ready, timeout) を返す。ready が未設定、またはコンテナが停止中の場合は state が空となる。
+// wait を指定すると、starting を抜けるまで最大 maxReadyWait 待機してから応答する (ロングポーリング)。
+func (s *Server) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	serverName := r.URL.Query().Get("id")
+	if _, ok := s.Config.Get().Servers[serverName]; !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Server not found", map[string]string{"server": serverName})
+		return
+	}
+
+	status := s.ContainerManager.Readiness.Status(serverName)
+	if v := r.URL.Query().Get("wait"); v != "" {
+		wait, err := time.ParseDuration(v)
+		if err != nil || wait <= 0 {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid wait duration", map[string]string{"wait": v})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), min(wait, maxReadyWait))
+		defer cancel()
+		// 期限切れは starting のまま返し、呼び出し側で再度待機できるようにする。
+		status, _ = s.ContainerManager.Readiness.Wait(ctx, serverName)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
 // MARK: GetContainerLogs()
 // コンテナの過去ログを特定行数取得する。無限スクロール等の用途に使用。
+// since / until で期間を絞り込み、timestamps=true で各行に時刻を付与できる。download=true ではファイルとして全件を返す。
+// format=json でサーバーの logFormat に従って構造化した行を返し、level でレベルによる絞り込みができる。
 func (s *Server) GetContainerLogs(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	serverName := q.Get("id")
+	download := q.Get("download") == "true"
+
+	// 時刻は RFC 3339、UNIX 時間、または現在からの相対時間 (例: 30m) で指定する。Docker API と同じ形式。
+	now := time.Now()
+	for _, key := range []string{"since", "until"} {
+		if v := q.Get(key); v != "" {
+			if _, err := timetypes.GetTimestamp(v, now); err != nil {
+				writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid "+key, map[string]string{key: v})
+				return
+			}
+		}
+	}
+
+	filter, err := parseLogFilter(q, s.Config.Get().Servers[serverName])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+		return
+	}
+
 	tail := q.Get("tail")
-	if tail == "" {
+	switch {
+	case tail != "":
+		if n, err := strconv.Atoi(tail); tail != "all" && (err != nil || n < 0) {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid tail", map[string]string{"tail": tail})
+			return
+		}
+	case download || q.Get("since") != "" || q.Get("until") != "":
+		// 期間の指定やダウンロードでは、指定された範囲を全て返す。
+		tail = "all"
+	default:
 		tail = "100" // デフォルトは直近100行とする
 	}
 
@@ -343,25 +931,107 @@ func (s *Server) GetContainerLogs(w http.ResponseWriter, r *http.Request) {
 		ShowStderr: true,
 		Follow:     false,
 		Tail:       tail,
+		Since:      q.Get("since"),
+		Until:      q.Get("until"),
+		Timestamps: q.Get("timestamps") == "true",
 	}
 
-	logs, err := docker.Client.ContainerLogs(r.Context(), serverName, logOptions)
+	var logs io.ReadCloser
+	isTty := true
+	if pc := s.Config.Get().Servers[serverName].ProcessSettings(); pc != nil {
+		// ホスト上で直接実行するサーバーは journald または logFile から読む。出力は多重化されていないため TTY と同様に扱う。
+		logs, err = process.Logs(r.Context(), serverName, *pc, processLogOptions(logOptions, now))
+	} else {
+		var cli *client.Client
+		if cli, err = docker.ForServer(serverName); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "Dockerホストの解決に失敗: container=%s, err=%v", serverName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var ref string
+		if ref, err = docker.Ref(r.Context(), serverName); err != nil {
+			logger.For(r.Context()).Warnf("Client", "API", "コンテナ %s の詳細取得失敗: %v", serverName, err)
+			http.Error(w, "Container Not Found", http.StatusNotFound)
+			return
+		}
+		if logs, err = cli.ContainerLogs(r.Context(), ref, logOptions); err == nil {
+			// xterm.jsでそのまま扱えるよう、バイナリ（ANSIコード含む）をデマルチプレクスして出力する。
+			// TTYが有効な場合はそのままio.Copy可能だが、ログモードでは通常TTYなしとなるためStdCopyを使用。
+			inspect, ierr := cli.ContainerInspect(r.Context(), ref)
+			isTty = ierr == nil && inspect.Config.Tty
+		}
+	}
 	if err != nil {
-		logger.Logf("Internal", "API", "過去ログの取得に失敗: container=%s, err=%v", serverName, err)
+		logger.For(r.Context()).Errorf("Internal", "API", "過去ログの取得に失敗: container=%s, err=%v", serverName, err)
 		http.Error(w, "Failed to get logs", http.StatusInternalServerError)
 		return
 	}
 	defer logs.Close()
 
 	w.Header().Set("Content-Type", "text/plain")
-	// xterm.jsでそのまま扱えるよう、バイナリ（ANSIコード含む）をデマルチプレクスして出力する。
-	// TTYが有効な場合はそのままio.Copy可能だが、ログモードでは通常TTYなしとなるためStdCopyを使用。
-	inspect, err := docker.Client.ContainerInspect(r.Context(), serverName)
-	if err == nil && inspect.Config.Tty {
-		io.Copy(w, logs)
-	} else {
-		// ヘッダーを除去し、標準出力と標準エラーをマージしてクライアントへ返す。
-		// WriteCloserが必要なため、http.ResponseWriterをラップする。
-		stdcopy.StdCopy(w, w, logs)
+	ext := "log"
+	if filter != nil && filter.json {
+		// 構造化出力は 1 行 1 件の JSON (NDJSON) とする。
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		ext = "ndjson"
+	}
+	if download {
+		filename := fmt.Sprintf("%s-%s.%s", serverName, now.Format("20060102-150405"), ext)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		logger.For(r.Context()).Logf("Internal", "API", "ログをダウンロードします: container=%s, since=%s, until=%s", serverName, logOptions.Since, logOptions.Until)
+	}
+	if filter == nil {
+		if isTty {
+			io.Copy(w, logs)
+		} else {
+			// ヘッダーを除去し、標準出力と標準エラーをマージしてクライアントへ返す。
+			// WriteCloserが必要なため、http.ResponseWriterをラップする。
+			stdcopy.StdCopy(w, w, logs)
+		}
+		return
+	}
+
+	// 構造化・絞り込みは行単位で行うため、多重化を解除した出力を読み出しながら処理する。
+	var src io.Reader = logs
+	if !isTty {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, logs)
+			pw.CloseWithError(err)
+		}()
+		src = pr
+	}
+	filter.copyLines(src, func(line []byte, isJSON bool) error {
+		if isJSON {
+			line = append(line, '\n')
+		}
+		_, err := w.Write(line)
+		return err
+	})
+}
+
+// processLogOptions は Docker の形式のログの取得条件を、ホスト上で直接実行するサーバー向けに変換する。
+// since / until は GetContainerLogs で検証済みのため、ここでは解釈できた値のみを用いる。
+func processLogOptions(opts ctypes.LogsOptions, now time.Time) process.LogOptions {
+	result := process.LogOptions{Tail: -1, Timestamps: opts.Timestamps}
+	if opts.Tail != "all" {
+		result.Tail, _ = strconv.Atoi(opts.Tail)
+	}
+	for _, v := range []struct {
+		raw string
+		dst *time.Time
+	}{{opts.Since, &result.Since}, {opts.Until, &result.Until}} {
+		if v.raw == "" {
+			continue
+		}
+		ts, err := timetypes.GetTimestamp(v.raw, now)
+		if err != nil {
+			continue
+		}
+		if sec, nsec, err := timetypes.ParseTimestamps(ts, 0); err == nil {
+			*v.dst = time.Unix(sec, nsec)
+		}
 	}
+	return result
 }
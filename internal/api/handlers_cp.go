@@ -0,0 +1,183 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: CopyHandler()
+// バインドマウントされていないコンテナ内のファイルを読み書きする (docker cp 相当)。停止中のコンテナでも扱える。
+// GET: ?path= のファイルの内容を返す。ディレクトリ、または ?archive=true の場合は tar として返す。
+// PUT: 本文を ?path= へファイルとして書き込む。?archive=true の場合は本文の tar を ?path= のディレクトリへ展開する。
+// 書き込んだファイルの所有者は root となるため、必要に応じて ?owner=<uid>:<gid> を指定する。
+func (s *Server) CopyHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	serverName := q.Get("id")
+	username := s.sessionUser(r)
+
+	// 読み出しはファイルの閲覧、書き込みはコンテナ内の任意の場所を変更できるため Exec と同じ権限で判定する。
+	perm := config.PermFileRead
+	if r.Method != http.MethodGet {
+		perm = config.PermContainerExec
+	}
+	if !s.Config.Get().Users[username].HasPermission(serverName, perm) {
+		logger.For(r.Context()).Warnf("Client", "API", "コンテナ内ファイル操作拒否: user=%s, target=%s, method=%s", username, serverName, r.Method)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Permission required", map[string]string{"permission": perm, "server": serverName})
+		return
+	}
+	if s.Config.Get().Servers[serverName].ProcessSettings() != nil {
+		http.Error(w, "Copy is not supported for process servers", http.StatusBadRequest)
+		return
+	}
+
+	p := q.Get("path")
+	if !path.IsAbs(p) {
+		http.Error(w, "path must be absolute", http.StatusBadRequest)
+		return
+	}
+	p = path.Clean(p)
+	archive := q.Get("archive") == "true"
+
+	switch r.Method {
+	case http.MethodGet:
+		s.copyFrom(w, r, serverName, p, archive)
+	case http.MethodPut:
+		if p == "/" && !archive {
+			http.Error(w, "path must be a file", http.StatusBadRequest)
+			return
+		}
+		owner, err := parseCopyOwner(q.Get("owner"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if archive {
+			err = docker.CopyArchiveTo(r.Context(), serverName, p, r.Body)
+		} else {
+			err = s.copyFileTo(r, serverName, p, owner)
+		}
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "コンテナ内への書き込み失敗: container=%s, path=%s, err=%v", serverName, p, err)
+			writeCopyError(w, err)
+			return
+		}
+		logger.For(r.Context()).Logf("Client", "API", "コンテナ内へ書き込みました: user=%s, container=%s, path=%s, archive=%t", username, serverName, p, archive)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// copyFrom はコンテナ内のパスを返す。通常のファイル以外 (ディレクトリ・シンボリックリンク等) は tar として返す。
+func (s *Server) copyFrom(w http.ResponseWriter, r *http.Request, serverName, p string, archive bool) {
+	if !archive {
+		rc, hdr, err := docker.CopyFileFrom(r.Context(), serverName, p)
+		switch {
+		case err == nil:
+			defer rc.Close()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Length", strconv.FormatInt(hdr.Size, 10))
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": hdr.Name}))
+			if _, err := io.Copy(w, rc); err != nil {
+				logger.For(r.Context()).Warnf("Internal", "API", "コンテナ内ファイルの送信中断: container=%s, path=%s, err=%v", serverName, p, err)
+			}
+			return
+		case !errors.Is(err, docker.ErrNotRegularFile):
+			logger.For(r.Context()).Errorf("Internal", "API", "コンテナ内ファイルの読み出し失敗: container=%s, path=%s, err=%v", serverName, p, err)
+			writeCopyError(w, err)
+			return
+		}
+	}
+
+	rc, stat, err := docker.CopyArchiveFrom(r.Context(), serverName, p)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "コンテナ内ファイルの読み出し失敗: container=%s, path=%s, err=%v", serverName, p, err)
+		writeCopyError(w, err)
+		return
+	}
+	defer rc.Close()
+	name := stat.Name
+	if name == "" || name == "/" {
+		name = serverName
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".tar"}))
+	if _, err := io.Copy(w, rc); err != nil {
+		logger.For(r.Context()).Warnf("Internal", "API", "コンテナ内アーカイブの送信中断: container=%s, path=%s, err=%v", serverName, p, err)
+	}
+}
+
+// copyFileTo は本文を 1 つのファイルとして書き込む。既存のファイルの権限は保持し、新規の場合は 0644 とする。
+// tar のヘッダーには大きさが必要なため、Content-Length が無い場合は一時ファイルへ受信してから送る。
+func (s *Server) copyFileTo(r *http.Request, serverName, p string, owner *docker.CopyOwner) error {
+	mode := os.FileMode(0o644)
+	if stat, err := docker.StatPath(r.Context(), serverName, p); err == nil {
+		if stat.Mode.IsDir() {
+			return fmt.Errorf("%w: %s is a directory", errInvalidCopy, p)
+		}
+		mode = stat.Mode.Perm()
+	} else if !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	body, size := io.Reader(r.Body), r.ContentLength
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "play-bin-cp-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if size, err = io.Copy(tmp, r.Body); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		body = tmp
+	}
+	return docker.CopyFileTo(r.Context(), serverName, p, body, size, mode, owner)
+}
+
+// errInvalidCopy は書き込み先の指定が不正な場合のエラー。
+var errInvalidCopy = errors.New("invalid copy destination")
+
+// parseCopyOwner は "<uid>:<gid>" 形式の所有者を解釈する。空の場合は nil (root) を返す。
+func parseCopyOwner(s string) (*docker.CopyOwner, error) {
+	if s == "" {
+		return nil, nil
+	}
+	uid, gid, ok := strings.Cut(s, ":")
+	u, err1 := strconv.Atoi(uid)
+	g, err2 := strconv.Atoi(gid)
+	if !ok || err1 != nil || err2 != nil || u < 0 || g < 0 {
+		return nil, fmt.Errorf("owner must be <uid>:<gid>, got %q", s)
+	}
+	return &docker.CopyOwner{UID: u, GID: g}, nil
+}
+
+// writeCopyError は docker cp 相当の操作のエラーを HTTP ステータスへ対応付けて返す。
+func writeCopyError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errdefs.IsNotFound(err):
+		status = http.StatusNotFound
+	case errors.Is(err, errInvalidCopy), errdefs.IsInvalidArgument(err):
+		status = http.StatusBadRequest
+	case errdefs.IsPermissionDenied(err):
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/forwarder"
+	"github.com/play-bin/internal/logger"
+)
+
+// StateEvent は管理対象コンテナの状態遷移を SSE で通知するためのペイロード。
+type StateEvent struct {
+	ID     string    `json:"id"`
+	State  string    `json:"state"`  // running, exited, created, paused, missing
+	Action string    `json:"action"` // 遷移の契機となった Docker イベント
+	Time   time.Time `json:"time"`
+}
+
+// eventToState は Docker のイベントを、コンテナ一覧 API と同じ状態表現に変換する。
+// 状態遷移を伴わないイベント（kill, stop 等の直後には die が続く）は空文字を返す。
+func eventToState(action string) string {
+	switch action {
+	case "create":
+		return "created"
+	case "start", "restart", "unpause":
+		return "running"
+	case "die":
+		return "exited"
+	case "pause":
+		return "paused"
+	case "destroy":
+		return "missing"
+	default:
+		return ""
+	}
+}
+
+// MARK: EventsHandler()
+// Server-Sent Events で、管理対象コンテナの状態遷移と準備状態、ジョブの進行状況、設定の再読み込みの差分と、
+// event の転送先に一致したログの行を配信する。
+// EventSource はヘッダーを付与できないため、認証は WSAuth により使い捨てのチケット (?ticket=) で行う。
+func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	username := wsUser(r)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.For(r.Context()).Log("Internal", "API", "ResponseWriter does not implement http.Flusher")
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	containerEvents, unsubscribeContainers := docker.Events.Subscribe()
+	defer unsubscribeContainers()
+	jobEvents, unsubscribeJobs := s.ContainerManager.Jobs.Subscribe()
+	defer unsubscribeJobs()
+	configDiffs, unsubscribeConfig := s.Config.Subscribe()
+	defer unsubscribeConfig()
+	readyEvents, unsubscribeReady := s.ContainerManager.Readiness.Subscribe()
+	defer unsubscribeReady()
+	matchEvents, unsubscribeMatches := forwarder.Matches.Subscribe()
+	defer unsubscribeMatches()
+
+	// プロキシ等によるアイドル切断を防ぐため、定期的にコメント行を送信する。
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	logger.For(r.Context()).Logf("Internal", "API", "イベントストリームを開始しました: user=%s", username)
+	defer logger.For(r.Context()).Logf("Internal", "API", "イベントストリームが切断されました: user=%s", username)
+
+	// 権限はストリーム接続中にも変更され得るため、イベント毎に最新の設定で判定する。
+	canRead := func(serverName string) bool {
+		cfg := s.Config.Get()
+		if _, managed := cfg.Servers[serverName]; !managed {
+			return false
+		}
+		return cfg.Users[username].HasPermission(serverName, config.PermContainerRead)
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-containerEvents:
+			if !ok {
+				return
+			}
+			// play-bin が作成したコンテナはサーバー名、未管理のコンテナはコンテナ名で通知する。
+			id := cmp.Or(ev.Server, ev.Name)
+			state := eventToState(ev.Action)
+			if state == "" || !ev.Of(id) || !canRead(id) {
+				continue
+			}
+			if err := writeSSE(w, "state", StateEvent{ID: id, State: state, Action: ev.Action, Time: ev.Time}); err != nil {
+				return
+			}
+			flusher.Flush()
+		case job, ok := <-jobEvents:
+			if !ok {
+				return
+			}
+			if !canRead(job.Server) {
+				continue
+			}
+			if err := writeSSE(w, "job", job); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ready, ok := <-readyEvents:
+			if !ok {
+				return
+			}
+			if !canRead(ready.Server) {
+				continue
+			}
+			if err := writeSSE(w, "ready", ready); err != nil {
+				return
+			}
+			flusher.Flush()
+		case match, ok := <-matchEvents:
+			if !ok {
+				return
+			}
+			if !canRead(match.Server) {
+				continue
+			}
+			if err := writeSSE(w, "match", match); err != nil {
+				return
+			}
+			flusher.Flush()
+		case diff, ok := <-configDiffs:
+			if !ok {
+				return
+			}
+			// 差分は全サーバー・全ユーザーの構成を含むため、設定の閲覧権限を持つユーザーにのみ配信する。
+			if !s.Config.Get().Users[username].HasPermission("*", config.PermConfigRead) {
+				continue
+			}
+			if err := writeSSE(w, "config", diff); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE は 1 件のイベントを SSE 形式（event/data 行）で書き出す。
+func writeSSE(w http.ResponseWriter, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		logger.Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// ImageListItem は一覧表示用のイメージ情報を表す。
+type ImageListItem struct {
+	ID         string   `json:"id"`
+	Tags       []string `json:"tags"`
+	Size       int64    `json:"size"`
+	Created    int64    `json:"created"`
+	Containers int64    `json:"containers"` // このイメージを使用しているコンテナ数（不明な場合は -1）
+	Dangling   bool     `json:"dangling"`
+}
+
+// MARK: requireImagePermission()
+// イメージはホスト全体で共有される資源のため、サーバー名 "*" に対する権限として判定する。
+func (s *Server) requireImagePermission(w http.ResponseWriter, r *http.Request, perm string) bool {
+	username := s.sessionUser(r)
+	if !s.Config.Get().Users[username].HasPermission("*", perm) {
+		logger.For(r.Context()).Warnf("Client", "API", "イメージ操作拒否: user=%s, perm=%s", username, perm)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Image permission required", map[string]string{"permission": perm})
+		return false
+	}
+	return true
+}
+
+// MARK: ListImages()
+// 指定ホスト（省略時は既定ホスト）のローカルイメージ一覧をサイズ付きで返す。
+func (s *Server) ListImages(w http.ResponseWriter, r *http.Request) {
+	if !s.requireImagePermission(w, r, config.PermImageRead) {
+		return
+	}
+
+	cli, err := docker.ForHost(r.URL.Query().Get("host"))
+	if err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "Dockerホストの解決に失敗: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	images, err := cli.ImageList(r.Context(), image.ListOptions{SharedSize: true, ContainerCount: true})
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "イメージ一覧の取得に失敗: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]ImageListItem, 0, len(images))
+	for _, img := range images {
+		// タグを持たない（<none>:<none>）イメージは、新しいビルドやプルで置き換えられた不要なイメージとみなす。
+		tags := make([]string, 0, len(img.RepoTags))
+		for _, t := range img.RepoTags {
+			if t != "<none>:<none>" {
+				tags = append(tags, t)
+			}
+		}
+		result = append(result, ImageListItem{
+			ID:         img.ID,
+			Tags:       tags,
+			Size:       img.Size,
+			Created:    img.Created,
+			Containers: img.Containers,
+			Dangling:   len(tags) == 0,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: PullImage()
+// 指定イメージをプルし、Docker から届く進捗メッセージを NDJSON としてそのままストリーミングする。
+func (s *Server) PullImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireImagePermission(w, r, config.PermImageWrite) {
+		return
+	}
+
+	q := r.URL.Query()
+	ref := q.Get("image")
+	if ref == "" {
+		http.Error(w, "image parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := docker.ForHost(q.Get("host"))
+	if err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "Dockerホストの解決に失敗: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// プル中にクライアントが切断した場合は、Docker 側のプルも中断させるためリクエストのコンテキストを使用する。
+	// private レジストリの場合は、設定済みの認証情報が自動的に付与される。
+	progress, err := docker.PullImage(r.Context(), cli, ref)
+	if err != nil {
+		logger.For(r.Context()).Errorf("External", "API", "イメージのプル開始に失敗: image=%s, err=%v", ref, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer progress.Close()
+
+	logger.For(r.Context()).Logf("Client", "API", "イメージのプルを開始しました: user=%s, image=%s", s.sessionUser(r), ref)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	if err := streamJSONMessages(w, flusher, progress); err != nil {
+		logger.For(r.Context()).Errorf("External", "API", "イメージのプルに失敗: image=%s, err=%v", ref, err)
+		return
+	}
+	logger.For(r.Context()).Logf("Internal", "API", "イメージのプルが完了しました: image=%s", ref)
+}
+
+// MARK: TagImage()
+// 既存イメージに新しいタグ（別名）を付与する。
+func (s *Server) TagImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireImagePermission(w, r, config.PermImageWrite) {
+		return
+	}
+
+	q := r.URL.Query()
+	source, target := q.Get("source"), q.Get("target")
+	if source == "" || target == "" {
+		http.Error(w, "source and target parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	cli, err := docker.ForHost(q.Get("host"))
+	if err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "Dockerホストの解決に失敗: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := cli.ImageTag(r.Context(), source, target); err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "イメージのタグ付けに失敗: %s -> %s, err=%v", source, target, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.For(r.Context()).Logf("Client", "API", "イメージにタグを付与しました: user=%s, %s -> %s", s.sessionUser(r), source, target)
+	w.WriteHeader(http.StatusOK)
+}
+
+// MARK: PruneImages()
+// 未使用イメージを削除し、削除件数と回収した容量を返す。
+// 既定ではタグを持たない（dangling）イメージのみを対象とし、all=true でコンテナから参照されない全イメージを対象とする。
+func (s *Server) PruneImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireImagePermission(w, r, config.PermImageWrite) {
+		return
+	}
+
+	q := r.URL.Query()
+	cli, err := docker.ForHost(q.Get("host"))
+	if err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "Dockerホストの解決に失敗: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dangling := "true"
+	if q.Get("all") == "true" {
+		dangling = "false"
+	}
+	report, err := cli.ImagesPrune(r.Context(), filters.NewArgs(filters.Arg("dangling", dangling)))
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "イメージの削除に失敗: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.For(r.Context()).Logf("Client", "API", "未使用イメージを削除しました: user=%s, deleted=%d, reclaimed=%d bytes",
+		s.sessionUser(r), len(report.ImagesDeleted), report.SpaceReclaimed)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"deleted":        len(report.ImagesDeleted),
+		"spaceReclaimed": report.SpaceReclaimed,
+	}); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: streamJSONMessages()
+// Docker のプル・ビルド等が返す JSON メッセージ列を 1 行ずつ転送する。
+// ストリーム中に error フィールドを持つメッセージが現れた場合は、その内容をエラーとして返す。
+func streamJSONMessages(w io.Writer, flusher http.Flusher, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	var streamErr error
+	for {
+		var msg json.RawMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return streamErr
+			}
+			return err
+		}
+
+		var parsed struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(msg, &parsed) == nil && parsed.Error != "" {
+			streamErr = errors.New(strings.TrimSpace(parsed.Error))
+		}
+
+		if _, err := w.Write(append(msg, '\n')); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/play-bin/internal/incident"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: IncidentsHandler()
+// 異常終了の記録を返す。?incident= を指定した場合はログとクラッシュレポートを含む詳細を、省略時は概要の一覧を返す。
+func (s *Server) IncidentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	serverName := q.Get("id")
+
+	var body any
+	var err error
+	if id := q.Get("incident"); id != "" {
+		body, err = incident.Get(serverName, id)
+	} else {
+		body, err = incident.List(serverName)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Incident not found", http.StatusNotFound)
+			return
+		}
+		logger.For(r.Context()).Errorf("Internal", "API", "インシデントの取得に失敗: container=%s, err=%v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: JobsHandler()
+// 閲覧権限のあるサーバーのジョブを新しい順で返す。
+// クエリ id (ジョブ ID)・server (サーバー名)・requestId (操作のリクエスト ID) で絞り込める。
+// 操作の要求に X-Request-ID を付与しておくと、応答を待つ間に requestId で進捗を取得できる。
+// DELETE は id のジョブを中断する (リストア等、中断を許可されたジョブのみ)。
+func (s *Server) JobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		s.cancelJob(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	id, serverName, requestID := q.Get("id"), q.Get("server"), q.Get("requestId")
+	user := s.Config.Get().Users[s.sessionUser(r)]
+
+	jobs := []container.Job{}
+	for _, job := range s.ContainerManager.Jobs.List() {
+		if (id != "" && job.ID != id) || (serverName != "" && job.Server != serverName) || (requestID != "" && job.RequestID != requestID) {
+			continue
+		}
+		if user.HasPermission(job.Server, config.PermContainerRead) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(jobs); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// cancelJob はジョブを中断する。ジョブの操作を実行できるユーザーのみ中断できる。
+// ジョブは中断を受け付けた後、処理を止めた時点で失敗として完了するため、完了は GET で確認する。
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	username := s.sessionUser(r)
+	job, ok := s.ContainerManager.Jobs.Get(id)
+	user := s.Config.Get().Users[username]
+	if !ok || !user.HasPermission(job.Server, config.PermContainerRead) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "job not found", map[string]string{"id": id})
+		return
+	}
+	if perm := job.Action.Permission(); !user.HasPermission(job.Server, perm) {
+		logger.For(r.Context()).Warnf("Client", "API", "ジョブの中断を拒否: user=%s, job=%s", username, id)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Execute permission required", map[string]string{"permission": perm, "server": job.Server})
+		return
+	}
+	if err := s.ContainerManager.Jobs.Cancel(id, username); err != nil {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, err.Error(), map[string]string{"id": id})
+		return
+	}
+	logger.For(r.Context()).Logf("Client", "API", "ジョブを中断しました: user=%s, job=%s, target=%s, action=%s", username, id, job.Server, job.Action)
+	w.WriteHeader(http.StatusAccepted)
+}
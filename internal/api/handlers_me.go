@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/preferences"
+)
+
+// minPasswordLength は自身で設定するパスワードの最小の長さ。
+const minPasswordLength = 8
+
+// Profile はログイン中のユーザー自身の情報。
+type Profile struct {
+	Username    string              `json:"username"`
+	Discord     string              `json:"discord,omitempty"`
+	Permissions map[string][]string `json:"permissions"` // 設定に記述された権限 (ワイルドカードを含む)
+	// Servers はサーバーごとに実際に許可される権限。"*" は全サーバーに対する付与。閲覧権限の無いサーバーは含まない。
+	Servers map[string][]string `json:"servers"`
+	// Grants は有効な期限付きの権限。Servers には反映済み。
+	Grants []config.Grant `json:"grants,omitempty"`
+}
+
+// MARK: MeHandler()
+// ログイン中のユーザーの情報と、サーバーごとの実効的な権限を返す。UI が操作できないボタンを隠すために使用する。
+func (s *Server) MeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := s.Config.Get()
+	username := s.sessionUser(r)
+	user := cfg.Users[username]
+
+	profile := Profile{Username: username, Discord: user.Discord, Permissions: user.Permissions, Servers: map[string][]string{}}
+	if profile.Permissions == nil {
+		profile.Permissions = map[string][]string{}
+	}
+	now := time.Now()
+	for _, g := range user.Grants {
+		if g.Active(now) {
+			profile.Grants = append(profile.Grants, g)
+		}
+	}
+	if perms := user.EffectivePermissions("*"); len(perms) > 0 {
+		profile.Servers["*"] = perms
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		if !user.HasPermission(name, config.PermContainerRead) {
+			continue
+		}
+		profile.Servers[name] = user.EffectivePermissions(name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: ChangePassword()
+// 現在のパスワードを確認した上で、自身のパスワードを変更する。新しいパスワードは bcrypt でハッシュ化して設定ファイルへ書き込む。
+// 変更後は、このリクエストのセッションを除く同じユーザーのセッションを全て無効にする。
+func (s *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		OldPassword string `json:"oldPassword"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		return
+	}
+	username := s.sessionUser(r)
+
+	if !s.checkCredentials(username, req.OldPassword) {
+		// 乗っ取られたセッションからの変更の試行である可能性があるため、ログインの失敗と同様に記録する。
+		logger.For(r.Context()).Warnf("Client", "Auth", "パスワード変更拒否 (現在のパスワードが不一致): user=%s", username)
+		writeError(w, r, http.StatusForbidden, ErrCodeInvalidCredentials, "Current password is incorrect", nil)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "New password is too short", map[string]int{"minLength": minPasswordLength})
+		return
+	}
+	if len(req.NewPassword) > config.MaxPasswordLength {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "New password is too long", map[string]int{"maxLength": config.MaxPasswordLength})
+		return
+	}
+
+	hash, err := config.HashPassword(req.NewPassword)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "Auth", "パスワードのハッシュ化に失敗: user=%s, err=%v", username, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	patch, _ := json.Marshal(map[string]string{"password": hash})
+	result, err := s.Config.PatchUser(username, patch)
+	if err != nil {
+		if errors.Is(err, config.ErrInvalidConfig) {
+			// 既存の設定の問題で書き込めない場合は、管理者が確認できるよう検証結果を返す。
+			writeError(w, r, http.StatusUnprocessableEntity, ErrCodeInvalidConfig, err.Error(), result)
+			return
+		}
+		logger.For(r.Context()).Errorf("Internal", "Auth", "パスワードの保存に失敗: user=%s, err=%v", username, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revoked := s.revokeSessions(username, sessionToken(r))
+	logger.For(r.Context()).Logf("Client", "Auth", "パスワードを変更しました: user=%s, revokedSessions=%d", username, revoked)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MARK: PreferencesHandler()
+// ログイン中のユーザー自身の UI と通知の設定。GET で取得、PUT で置き換え、DELETE で既定に戻す。
+// 未知の項目と不正な値は拒否し、どの項目が不正かを details.issues で返す。
+func (s *Server) PreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	username := s.sessionUser(r)
+	switch r.Method {
+	case http.MethodGet:
+		writePreferences(w, r, s.Preferences.Get(username), nil)
+
+	case http.MethodPut:
+		var raw json.RawMessage
+		if err := decodeJSON(w, r, &raw); err != nil {
+			return
+		}
+		var prefs preferences.Preferences
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&prefs); err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid preferences: "+err.Error(), nil)
+			return
+		}
+		issues := prefs.Validate(s.Config.Get(), username)
+		if slices.ContainsFunc(issues, func(i config.Issue) bool { return i.Level == config.LevelError }) {
+			writeError(w, r, http.StatusUnprocessableEntity, ErrCodeUnprocessable, "Invalid preferences", map[string]any{"issues": issues})
+			return
+		}
+		saved, err := s.Preferences.Set(username, prefs)
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "ユーザー設定の保存に失敗: user=%s, err=%v", username, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		writePreferences(w, r, saved, issues)
+
+	case http.MethodDelete:
+		if err := s.Preferences.Delete(username); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "ユーザー設定の保存に失敗: user=%s, err=%v", username, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writePreferences はユーザー設定を、保存時の警告と共に返す。
+func writePreferences(w http.ResponseWriter, r *http.Request, prefs preferences.Preferences, warnings []config.Issue) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		preferences.Preferences
+		Warnings []config.Issue `json:"warnings,omitempty"`
+	}{prefs, warnings}); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
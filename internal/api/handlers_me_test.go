@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/play-bin/internal/config"
+)
+
+func TestChangePasswordRejectsLongPassword(t *testing.T) {
+	s := newTestServer(t, `{"servers": {"a": {}}, "users": {"operator": {"password": "current-password", "permissions": {}}}}`, "token", "operator")
+	body := `{"oldPassword": "current-password", "newPassword": "` + strings.Repeat("x", config.MaxPasswordLength+1) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/me/password", strings.NewReader(body))
+	req.Header.Set("Authorization", "token")
+	rec := httptest.NewRecorder()
+	s.Auth(s.ChangePassword)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/mods"
+)
+
+// MARK: ModsHandler()
+// GET: Mod ディレクトリ内のファイル一覧を返す。
+// POST: Modrinth / CurseForge から Mod を配置する。{"file": ...} のみ指定した場合は、そのファイルを最新の互換バージョンへ更新する。
+// DELETE: ?file= で指定したファイルを削除する。
+func (s *Server) ModsHandler(w http.ResponseWriter, r *http.Request) {
+	serverName := r.URL.Query().Get("id")
+	cfg := s.Config.Get()
+	user := cfg.Users[s.sessionUser(r)]
+
+	switch r.Method {
+	case http.MethodGet:
+		if !user.HasPermission(serverName, config.PermModRead) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		list, err := mods.List(serverName, cfg.Servers[serverName])
+		if err != nil {
+			writeModsError(w, serverName, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		}
+
+	case http.MethodPost:
+		if !user.HasPermission(serverName, config.PermModWrite) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		var payload struct {
+			Source  string `json:"source"`  // "modrinth", "curseforge"
+			Project string `json:"project"` // プロジェクト ID（Modrinth はスラッグも可）
+			Version string `json:"version"` // 省略時は最新の互換バージョン
+			File    string `json:"file"`    // 更新対象の配置済みファイル名
+		}
+		if err := decodeJSON(w, r, &payload); err != nil {
+			logger.For(r.Context()).Warnf("Client", "API", "Mod リクエストのデコードに失敗: %v", err)
+			return
+		}
+
+		var installed mods.Installed
+		var err error
+		if payload.File != "" && payload.Project == "" {
+			installed, err = mods.Update(r.Context(), cfg, serverName, payload.File)
+		} else {
+			installed, err = mods.Install(r.Context(), cfg, serverName, payload.Source, payload.Project, payload.Version)
+		}
+		if err != nil {
+			writeModsError(w, serverName, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(installed); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		}
+
+	case http.MethodDelete:
+		if !user.HasPermission(serverName, config.PermModWrite) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err := mods.Remove(serverName, cfg.Servers[serverName], r.URL.Query().Get("file")); err != nil {
+			writeModsError(w, serverName, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeModsError は mods パッケージのエラーを HTTP ステータスへ対応付けて返す。
+func writeModsError(w http.ResponseWriter, serverName string, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, mods.ErrNotConfigured), errors.Is(err, mods.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, mods.ErrRemoteHost):
+		status = http.StatusNotImplemented
+	case errors.Is(err, mods.ErrInvalidFile):
+		status = http.StatusBadRequest
+	}
+	logger.Errorf("Internal", "API", "Mod 操作に失敗: container=%s, err=%v", serverName, err)
+	http.Error(w, err.Error(), status)
+}
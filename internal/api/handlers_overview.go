@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+const (
+	// overviewDefaultInterval は ?interval= を省略した場合の配信間隔。
+	overviewDefaultInterval = 2 * time.Second
+	// overviewMinInterval・overviewMaxInterval は ?interval= で指定できる配信間隔の範囲。
+	// 1 回の集計で全コンテナの統計情報を取得するため、短すぎる間隔は受け付けない。
+	overviewMinInterval = 1 * time.Second
+	overviewMaxInterval = 60 * time.Second
+)
+
+// overviewFrame は /ws/overview で配信する、ホストと閲覧できる全サーバーの状態をまとめたフレーム。
+type overviewFrame struct {
+	Type    string           `json:"type"` // 常に "overview"
+	Time    time.Time        `json:"time"`
+	Host    overviewHost     `json:"host"`
+	Servers []overviewServer `json:"servers"`
+}
+
+// overviewHost は play-bin が動作しているホスト全体の使用状況。
+type overviewHost struct {
+	CPUPercent        float64 `json:"cpu_percent"` // 全コア合計を 100% とした使用率
+	MemoryUsed        uint64  `json:"memory_used"` // Total - Available
+	MemoryTotal       uint64  `json:"memory_total"`
+	MemoryUsedPercent float64 `json:"memory_used_percent"`
+	DiskUsed          uint64  `json:"disk_used"` // 作業ディレクトリを含むファイルシステム
+	DiskTotal         uint64  `json:"disk_total"`
+	DiskUsedPercent   float64 `json:"disk_used_percent"`
+}
+
+// overviewServer は管理対象のサーバー 1 件の状態と統計情報。
+type overviewServer struct {
+	Name      string                `json:"name"`
+	Host      string                `json:"host,omitempty"` // dockerHosts 名（既定ホストは省略）
+	State     string                `json:"state"`          // running, exited, missing, unreachable 等 (一覧 API と同じ)
+	StartedAt time.Time             `json:"startedAt,omitzero"`
+	Stats     *docker.ComputedStats `json:"stats,omitempty"` // 起動中のコンテナのみ。取得できなかった場合は省略
+}
+
+// MARK: OverviewHandler()
+// ホストの CPU・メモリ・ディスクと、閲覧権限 (container.read) のある管理対象サーバーの状態・統計情報を
+// 1 つのフレームにまとめて ?interval= 秒 (既定 2 秒) ごとに配信する。?tag= (カンマ区切り) でタグが一致するサーバーに限定できる。
+// ダッシュボードでサーバーごとに /ws/stats を開かずに済むよう、1 本の接続で全体を把握できるようにする。
+func (s *Server) OverviewHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		interval := overviewDefaultInterval
+		if v := r.URL.Query().Get("interval"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid interval", map[string]string{"interval": v})
+				return
+			}
+			interval = min(max(time.Duration(n)*time.Second, overviewMinInterval), overviewMaxInterval)
+		}
+		lq, err := parseContainerListQuery(url.Values{"tag": r.URL.Query()["tag"]})
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error(), nil)
+			return
+		}
+
+		upgraded, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "Overview WebSocketアップグレード失敗: %v", err)
+			return
+		}
+		ws := newWSConn(upgraded)
+		defer ws.Close()
+		defer ws.CloseOnDone(r.Context())()
+
+		// クライアントからの送信は無いが、pong の処理と切断の検知のために読み込みを継続する。
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			defer cancel()
+			defer ws.Close()
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		username := wsUser(r)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var prev *overviewFrame
+		for {
+			frame, err := s.collectOverview(ctx, username, lq.tags, prev)
+			if err != nil {
+				logger.For(ctx).Errorf("Internal", "API", "概要の集計に失敗: user=%s, err=%v", username, err)
+			} else {
+				b, err := json.Marshal(frame)
+				if err != nil {
+					logger.For(ctx).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+					return
+				}
+				// 概要は次の値で置き換わるため、クライアントが追従できない場合は古いフレームを破棄する。
+				if !ws.TrySend(websocket.TextMessage, b) {
+					select {
+					case <-ws.Done():
+						return
+					default:
+					}
+				}
+				prev = frame
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// collectOverview はホストと管理対象サーバーの状態を集計する。状態と統計情報は一覧 API (?stats=true) と同じ方法で取得し、
+// スナップショットでは求まらないネットワーク等のレートは前回のフレーム prev との差分から求める。
+func (s *Server) collectOverview(ctx context.Context, username string, tags []string, prev *overviewFrame) (*overviewFrame, error) {
+	items, _, err := s.containerList(ctx, username, containerListQuery{tags: tags, sort: "name", stats: true})
+	if err != nil {
+		return nil, err
+	}
+	frame := &overviewFrame{Type: "overview", Time: time.Now(), Host: hostOverview(), Servers: []overviewServer{}}
+
+	prevStats := make(map[string]docker.ComputedStats)
+	if prev != nil {
+		for _, sv := range prev.Servers {
+			if sv.Stats != nil {
+				prevStats[sv.Name] = *sv.Stats
+			}
+		}
+	}
+	servers := s.Config.Get().Servers
+	for _, item := range items {
+		// 設定ファイルにないコンテナは一覧 API にのみ含め、概要は管理対象のサーバーに限定する。
+		if _, managed := servers[item.ID]; !managed {
+			continue
+		}
+		sv := overviewServer{Name: item.ID, Host: item.Host, State: item.State, StartedAt: item.StartedAt, Stats: item.Stats}
+		if p, ok := prevStats[sv.Name]; ok && sv.Stats != nil {
+			stats := sv.Stats.WithRates(p, frame.Time.Sub(prev.Time))
+			sv.Stats = &stats
+		}
+		frame.Servers = append(frame.Servers, sv)
+	}
+	return frame, nil
+}
+
+// hostOverview はホスト全体の CPU・メモリ・ディスクの使用状況を返す。取得できなかった項目は 0 とする。
+func hostOverview() overviewHost {
+	var h overviewHost
+	// サンプリング間隔を持たせて安定させる (/ws/stats の os_stats と同じ)
+	if c, err := cpu.Percent(200*time.Millisecond, false); err == nil && len(c) > 0 {
+		h.CPUPercent = c[0]
+	}
+	if v, err := mem.VirtualMemory(); err == nil {
+		h.MemoryTotal, h.MemoryUsed, h.MemoryUsedPercent = v.Total, v.Total-v.Available, v.UsedPercent
+	}
+	// サーバーのデータは作業ディレクトリ配下に置くことが多いため、作業ディレクトリを含むファイルシステムを対象とする。
+	if d, err := disk.Usage("."); err == nil {
+		h.DiskTotal, h.DiskUsed, h.DiskUsedPercent = d.Total, d.Used, d.UsedPercent
+	}
+	return h
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/recording"
+)
+
+// MARK: requireRecordingPermission()
+// 録画には他ユーザーの入力内容も含まれるため、閲覧には専用の権限を要求する。
+func (s *Server) requireRecordingPermission(w http.ResponseWriter, r *http.Request, serverName string) bool {
+	username := s.sessionUser(r)
+	if !s.Config.Get().Users[username].HasPermission(serverName, config.PermRecordingRead) {
+		logger.For(r.Context()).Warnf("Client", "API", "録画の閲覧拒否: user=%s, target=%s", username, serverName)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Recording permission required", map[string]string{"permission": config.PermRecordingRead, "server": serverName})
+		return false
+	}
+	return true
+}
+
+// MARK: ListRecordings()
+// 指定サーバーのコンソールセッションの録画一覧を新しい順に返す。
+func (s *Server) ListRecordings(w http.ResponseWriter, r *http.Request) {
+	serverName := r.URL.Query().Get("id")
+	if !s.requireRecordingPermission(w, r, serverName) {
+		return
+	}
+
+	list, err := recording.List(s.Config.Get().Recording, serverName)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "録画一覧の取得に失敗: container=%s, err=%v", serverName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// MARK: GetRecording()
+// 録画ファイル（asciicast v2）をそのまま返す。asciinema や asciinema-player でそのまま再生できる。
+func (s *Server) GetRecording(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	serverName, name := q.Get("id"), q.Get("name")
+	if !s.requireRecordingPermission(w, r, serverName) {
+		return
+	}
+
+	f, err := recording.Open(s.Config.Get().Recording, serverName, name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+			return
+		}
+		logger.For(r.Context()).Errorf("Internal", "API", "録画ファイルのオープンに失敗: container=%s, name=%s, err=%v", serverName, name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	logger.For(r.Context()).Logf("Client", "API", "録画を再生します: user=%s, container=%s, name=%s", s.sessionUser(r), serverName, name)
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	if _, err := io.Copy(w, f); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "録画ファイルの送信に失敗: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/schedule"
+)
+
+// MARK: SchedulesHandler()
+// GET: サーバーの定期コマンドの一覧を返す。
+// POST: 定期コマンドを追加・更新する（id が空の場合は追加）。?run=<id> を指定した場合は即時に実行する。
+// DELETE: ?schedule=<id> で定期コマンドを削除する。
+func (s *Server) SchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	serverName := q.Get("id")
+	username := s.sessionUser(r)
+
+	// 定期コマンドはコンソールへの入力と同等であるため、変更・実行には書き込み権限を要求する。
+	if r.Method != http.MethodGet && !s.Config.Get().Users[username].HasPermission(serverName, config.PermContainerWrite) {
+		http.Error(w, "Write permission required", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeScheduleJSON(w, s.Schedules.List(serverName))
+
+	case http.MethodPost:
+		if id := q.Get("run"); id != "" {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Minute)
+			defer cancel()
+			if err := s.Schedules.Run(ctx, serverName, id); err != nil {
+				// 送信先（コンテナ / RCON）側の失敗は上流の障害として扱う。
+				writeScheduleError(w, serverName, err, http.StatusBadGateway)
+				return
+			}
+			logger.For(r.Context()).Logf("Client", "API", "定期コマンドを手動実行しました: user=%s, container=%s, id=%s", username, serverName, id)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var sc schedule.Schedule
+		if err := decodeJSON(w, r, &sc); err != nil {
+			logger.For(r.Context()).Warnf("Client", "API", "定期コマンドのデコードに失敗: %v", err)
+			return
+		}
+		sc.Server = serverName
+		saved, err := s.Schedules.Put(sc)
+		if err != nil {
+			writeScheduleError(w, serverName, err, http.StatusBadRequest)
+			return
+		}
+		logger.For(r.Context()).Logf("Client", "API", "定期コマンドを保存しました: user=%s, container=%s, name=%s, cron=%s", username, serverName, saved.Name, saved.Cron)
+		writeScheduleJSON(w, saved)
+
+	case http.MethodDelete:
+		if err := s.Schedules.Delete(serverName, q.Get("schedule")); err != nil {
+			writeScheduleError(w, serverName, err, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeScheduleJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
+
+// writeScheduleError は定期コマンド操作のエラーを HTTP ステータスへ対応付けて返す。該当しないエラーは fallback を使用する。
+func writeScheduleError(w http.ResponseWriter, serverName string, err error, fallback int) {
+	status := fallback
+	switch {
+	case errors.Is(err, schedule.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, schedule.ErrNotRunning):
+		status = http.StatusConflict
+	}
+	logger.Errorf("Internal", "API", "定期コマンドの操作に失敗: container=%s, err=%v", serverName, err)
+	http.Error(w, err.Error(), status)
+}
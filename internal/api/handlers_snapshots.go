@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: SnapshotsHandler()
+// GET: スナップショットの一覧を返す。?download=<tag> を指定した場合はイメージを docker save の形式 (tar) で返す。
+// POST: {"export": true} でコンテナからスナップショットを作成し、必要に応じて tar へ書き出す。{"tag": ...} を指定した場合は作成済みのものを書き出す。
+// DELETE: ?tag=<tag> でスナップショットのイメージと書き出し済みの tar を削除する。
+func (s *Server) SnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	serverName := q.Get("id")
+	username := s.sessionUser(r)
+
+	// 一覧は container.read (Auth で判定済み) で閲覧できる。ダウンロードはファイルシステム全体を含むため、作成と同じ権限を要求する。
+	if r.Method != http.MethodGet || q.Get("download") != "" {
+		if !s.Config.Get().Users[username].HasPermission(serverName, config.PermContainerSnapshot) {
+			logger.For(r.Context()).Warnf("Client", "API", "スナップショット操作拒否: user=%s, target=%s", username, serverName)
+			writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Execute permission required", map[string]string{"permission": config.PermContainerSnapshot, "server": serverName})
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if tag := q.Get("download"); tag != "" {
+			s.downloadSnapshot(w, r, serverName, tag)
+			return
+		}
+		snapshots, err := s.ContainerManager.ListSnapshots(r.Context(), serverName)
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "スナップショット一覧取得失敗: container=%s, err=%v", serverName, err)
+			writeSnapshotError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshots); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		}
+
+	case http.MethodPost:
+		var payload struct {
+			Export bool   `json:"export"` // 作成したスナップショットを tar へ書き出す
+			Tag    string `json:"tag"`    // 指定した場合は作成せず、作成済みのスナップショットを書き出す
+		}
+		if err := decodeJSON(w, r, &payload); err != nil {
+			logger.For(r.Context()).Warnf("Client", "API", "スナップショット操作のデコードに失敗: %v", err)
+			return
+		}
+
+		// イメージの書き出しは長時間となるため、リクエストのキャンセルから切り離して実行する (リクエスト ID は引き継ぐ)。
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Minute)
+		defer cancel()
+
+		var snap container.Snapshot
+		var err error
+		if payload.Tag != "" {
+			snap, err = s.ContainerManager.ExportSnapshot(ctx, serverName, payload.Tag)
+		} else {
+			snap, err = s.ContainerManager.Snapshot(ctx, serverName, payload.Export)
+		}
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "スナップショット操作失敗: container=%s, err=%v", serverName, err)
+			writeSnapshotError(w, r, err)
+			return
+		}
+		logger.For(r.Context()).Logf("Internal", "API", "スナップショット操作成功: container=%s, tag=%s", serverName, snap.Tag)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(snap); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		}
+
+	case http.MethodDelete:
+		if err := s.ContainerManager.DeleteSnapshot(r.Context(), serverName, q.Get("tag")); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "スナップショットの削除失敗: container=%s, err=%v", serverName, err)
+			writeSnapshotError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// downloadSnapshot は書き出し済みの tar があればそれを返し、無ければ Docker から読み出しながら返す。
+func (s *Server) downloadSnapshot(w http.ResponseWriter, r *http.Request, serverName, tag string) {
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+serverName+"-"+tag+`.tar"`)
+	if path, err := s.ContainerManager.SnapshotFile(serverName, tag); err == nil {
+		http.ServeFile(w, r, path)
+		return
+	}
+	if _, err := s.ContainerManager.SaveSnapshot(r.Context(), serverName, tag, w); err != nil {
+		// 書き出し開始前のエラー（存在しない等）のみステータスとして返せる。開始後のエラーはクライアント側で不完全なアーカイブとなる。
+		logger.For(r.Context()).Errorf("Internal", "API", "スナップショットの書き出しに失敗: container=%s, tag=%s, err=%v", serverName, tag, err)
+		w.Header().Del("Content-Disposition")
+		writeSnapshotError(w, r, err)
+	}
+}
+
+// writeSnapshotError はスナップショット操作のエラーを HTTP ステータスへ対応付けて返す。
+func writeSnapshotError(w http.ResponseWriter, r *http.Request, err error) {
+	if writeCooldownError(w, r, err) {
+		return
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, os.ErrNotExist), errdefs.IsNotFound(err):
+		status = http.StatusNotFound
+	case errors.Is(err, container.ErrInvalidSnapshotTag), errors.Is(err, container.ErrSnapshotUnsupported):
+		status = http.StatusBadRequest
+	case errors.Is(err, container.ErrSnapshotExists):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
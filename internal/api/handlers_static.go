@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/play-bin/web"
+)
+
+// MARK: StaticHandler()
+// Web UI を配信する。既定ではバイナリに埋め込んだファイルのみを配信し、作業ディレクトリの内容は公開しない。
+// 設定の staticRoot が指定されている場合は、独自の UI としてそのディレクトリを配信する (再読み込みに追従する)。
+func (s *Server) StaticHandler() http.Handler {
+	embedded := http.FileServerFS(web.Assets)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if root := s.Config.Get().StaticRoot; root != "" {
+			http.FileServer(http.Dir(root)).ServeHTTP(w, r)
+			return
+		}
+		embedded.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: WorldsHandler()
+// GET: ワールドの一覧を返す。?download=<name> を指定した場合はワールドを tar.gz として返す。
+// POST: {"action": "archive" | "switch" | "reset", "world": ..., "saveAs": ...} でワールドを操作する。
+// PUT: ?name=<name> で、本文の zip / tar.gz をワールドとして取り込む。
+// DELETE: ?name=<name> で保管中のワールドを削除する。
+func (s *Server) WorldsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	serverName := q.Get("id")
+	user := s.Config.Get().Users[s.sessionUser(r)]
+
+	perm := config.PermWorldWrite
+	if r.Method == http.MethodGet {
+		perm = config.PermWorldRead
+	}
+	if !user.HasPermission(serverName, perm) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if name := q.Get("download"); name != "" {
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+serverName+"-"+name+`.tar.gz"`)
+			if err := s.ContainerManager.ExportWorld(serverName, name, w); err != nil {
+				// 書き出し開始前のエラー（存在しない等）のみステータスとして返せる。開始後のエラーはクライアント側で不完全なアーカイブとなる。
+				logger.For(r.Context()).Errorf("Internal", "API", "ワールドの書き出しに失敗: container=%s, world=%s, err=%v", serverName, name, err)
+				writeWorldError(w, r, err)
+			}
+			return
+		}
+		worlds, err := s.ContainerManager.ListWorlds(serverName)
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "ワールド一覧取得失敗: container=%s, err=%v", serverName, err)
+			writeWorldError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(worlds); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		}
+
+	case http.MethodPost:
+		var payload struct {
+			Action string `json:"action"`
+			World  string `json:"world"`  // archive: 保管する名前, switch: 切り替え先
+			SaveAs string `json:"saveAs"` // switch / reset: 現在のワールドを保管する名前（省略時は日時から生成）
+		}
+		if err := decodeJSON(w, r, &payload); err != nil {
+			logger.For(r.Context()).Warnf("Client", "API", "ワールド操作のデコードに失敗: %v", err)
+			return
+		}
+
+		// バックアップを伴う長時間処理のため、リクエストのキャンセルから切り離して実行する (リクエスト ID は引き継ぐ)。
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Minute)
+		defer cancel()
+
+		var err error
+		switch payload.Action {
+		case "archive":
+			err = s.ContainerManager.ArchiveWorld(ctx, serverName, payload.World)
+		case "switch":
+			err = s.ContainerManager.SwitchWorld(ctx, serverName, payload.World, payload.SaveAs)
+		case "reset":
+			err = s.ContainerManager.ResetWorld(ctx, serverName, payload.SaveAs)
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "ワールド操作失敗: container=%s, action=%s, err=%v", serverName, payload.Action, err)
+			writeWorldError(w, r, err)
+			return
+		}
+		logger.For(r.Context()).Logf("Internal", "API", "ワールド操作成功: container=%s, action=%s, world=%s", serverName, payload.Action, payload.World)
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPut:
+		name := q.Get("name")
+		if err := s.ContainerManager.ImportWorld(r.Context(), serverName, name, r.Body); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "ワールドの取り込み失敗: container=%s, world=%s, err=%v", serverName, name, err)
+			writeWorldError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodDelete:
+		if err := s.ContainerManager.DeleteWorld(serverName, q.Get("name")); err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "ワールドの削除失敗: container=%s, err=%v", serverName, err)
+			writeWorldError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeWorldError はワールド操作のエラーを HTTP ステータスへ対応付けて返す。
+func writeWorldError(w http.ResponseWriter, r *http.Request, err error) {
+	if writeCooldownError(w, r, err) {
+		return
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, container.ErrWorldsNotConfigured), errors.Is(err, os.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, container.ErrInvalidWorldName):
+		status = http.StatusBadRequest
+	case errors.Is(err, container.ErrWorldExists):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
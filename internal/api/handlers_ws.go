@@ -1,18 +1,30 @@
 package api
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/containerd/errdefs"
 	ctypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/gorilla/websocket"
 	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/docker"
 	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/query"
+	"github.com/play-bin/internal/recording"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
 )
@@ -20,6 +32,20 @@ import (
 var wsUpgrader = websocket.Upgrader{
 	// 開発の簡便性と、Authミドルウェアによる事前のトークン検証を前提として、全てのOriginを許可する。
 	CheckOrigin: func(r *http.Request) bool { return true },
+	// クライアントが対応している場合は permessage-deflate で圧縮し、ログや統計の転送量を削減する。
+	EnableCompression: true,
+}
+
+// terminalControl は /ws/terminal のテキストフレームで送受信される制御メッセージ。
+// 端末への入出力データはバイナリフレームで、制御メッセージは JSON のテキストフレームで区別する。
+type terminalControl struct {
+	Type string `json:"type"` // "resize"（クライアント→サーバー）, "console"（サーバー→クライアント）
+	Cols uint   `json:"cols,omitempty"`
+	Rows uint   `json:"rows,omitempty"`
+
+	// attach モードで、このセッションが stdin へ書き込めるかと、書き込み権の保持者を通知する。
+	Writable bool   `json:"writable,omitempty"`
+	Holder   string `json:"holder,omitempty"`
 }
 
 // MARK: TerminalHandler()
@@ -31,21 +57,39 @@ func (s *Server) TerminalHandler() http.HandlerFunc {
 		ctx := r.Context()
 		var stream io.ReadWriteCloser
 		var isTty bool
+		// resize はクライアントの表示領域の変更を TTY へ反映する。TTY を所有しないモードでは nil のままとする。
+		var resize func(ctypes.ResizeOptions) error
+		// writable は WebSocket からの入力をコンテナへ転送してよいかを示す。attach モードの閲覧者のみ false となる。
+		writable := true
+		var consoleInfo *terminalControl
+		// logLines はログモードで構造化・絞り込みを行う場合の指定。nil の場合は出力をそのまま転送する。
+		var logLines *logFilter
+
+		cli, err := docker.ForServer(id)
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "Dockerホストの解決に失敗: container=%s, err=%v", id, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// 同じ名前の play-bin の管理外のコンテナには接続しない。未作成の場合は従来どおり接続時のエラーとする。
+		ref, err := docker.Ref(ctx, id)
+		if errors.Is(err, docker.ErrNotOwned) {
+			logger.For(r.Context()).Warnf("Client", "API", "管理外のコンテナへの接続を拒否: container=%s, err=%v", id, err)
+			writeError(w, r, http.StatusConflict, ErrCodeConflict, err.Error(), map[string]string{"server": id})
+			return
+		} else if err != nil {
+			ref = docker.ContainerName(id)
+		}
 
 		// コンテナの設定を確認し、TTYが有効かどうかで出力のデマルチプレクス処理を切り替える。
-		inspect, err := docker.Client.ContainerInspect(ctx, id)
+		inspect, err := cli.ContainerInspect(ctx, ref)
 		if err == nil {
 			isTty = inspect.Config.Tty
 		}
 
-		// WebSocketハンドラーはAuthミドルウェアを経由しているが、Usernameは引き継がれないためトークンから再取得する。
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			token = r.URL.Query().Get("token")
-		}
-		s.WebSessionMu.RLock()
-		username := s.WebSessions[token]
-		s.WebSessionMu.RUnlock()
+		// WSAuth がセッショントークンまたはチケットから特定したユーザー。
+		username := wsUser(r)
 		// ユーザーが存在しない場合（Auth通過後にセッション切れ等）はAuth側で弾かれるはずだが念のため
 		if username == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -58,53 +102,116 @@ func (s *Server) TerminalHandler() http.HandlerFunc {
 		switch mode {
 		case "exec":
 			if !user.HasPermission(id, config.PermContainerWrite) {
-				logger.Logf("Client", "API", "WS Exec拒否: user=%s, target=%s", username, id)
+				logger.For(r.Context()).Warnf("Client", "API", "WS Exec拒否: user=%s, target=%s", username, id)
 				http.Error(w, "Write permission required", http.StatusForbidden)
 				return
 			}
+			// シェル・実行ユーザー等はサーバーの既定値 (terminal) をクエリで上書きする。
+			terminal := s.Config.Get().Servers[id].Terminal
+			opts, err := terminalOptions(q, terminal)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// シェル以外のコマンドは許可リストに含まれるもののみ起動できる。任意コマンドの実行権限を持つ場合は制限しない。
+			if q.Has("cmd") && !terminal.AllowsCommand(opts.Cmd) && !user.HasPermission(id, config.PermContainerExec) {
+				logger.For(r.Context()).Warnf("Client", "API", "WS Exec拒否 (許可されていないコマンド): user=%s, target=%s, cmd=%q", username, id, opts.Cmd)
+				writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Command is not allowed by terminal.commands", map[string]string{"permission": config.PermContainerExec, "server": id})
+				return
+			}
+			// root のシェルはコンテナ内の全てを変更できるため、一般ユーザーとしての実行とは別の権限で判定する。
+			imageUser := ""
+			if inspect.Config != nil {
+				imageUser = inspect.Config.User
+			}
+			if isRootUser(cmp.Or(opts.User, imageUser)) && !user.HasPermission(id, config.PermContainerTerminalRoot) {
+				logger.For(r.Context()).Warnf("Client", "API", "WS Exec拒否 (root): user=%s, target=%s", username, id)
+				writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Root terminal permission required; specify a non-root user", map[string]string{"permission": config.PermContainerTerminalRoot, "server": id})
+				return
+			}
 			// インタラクティブなシェル操作を提供するため、TTYを強制しつつ環境変数を最適化する。
 			isTty = true
-			cfg := ctypes.ExecOptions{
-				Tty: true, AttachStdin: true, AttachStdout: true, AttachStderr: true,
-				Env: []string{"TERM=xterm-256color"}, Cmd: []string{"/bin/sh"},
+			cfg := opts
+			cfg.Tty, cfg.AttachStdin, cfg.AttachStdout, cfg.AttachStderr = true, true, true, true
+			cExec, err := cli.ContainerExecCreate(ctx, ref, cfg)
+			if err != nil {
+				logger.For(r.Context()).Errorf("Internal", "API", "Exec作成失敗: container=%s, err=%v", id, err)
+				return
 			}
-			cExec, err := docker.Client.ContainerExecCreate(ctx, id, cfg)
+			resp, err := cli.ContainerExecAttach(ctx, cExec.ID, ctypes.ExecAttachOptions{Tty: true})
 			if err != nil {
-				logger.Logf("Internal", "API", "Exec作成失敗: container=%s, err=%v", id, err)
+				logger.For(r.Context()).Errorf("Internal", "API", "Execアタッチ失敗: container=%s, err=%v", id, err)
 				return
 			}
-			resp, err := docker.Client.ContainerExecAttach(ctx, cExec.ID, ctypes.ExecAttachOptions{Tty: true})
+			stream = resp.Conn
+			resize = func(opts ctypes.ResizeOptions) error {
+				return cli.ContainerExecResize(ctx, cExec.ID, opts)
+			}
+			logger.For(r.Context()).Logf("Internal", "API", "Exec接続を開始しました: container=%s, user=%s, cmd=%q, execUser=%s", id, username, opts.Cmd, cmp.Or(opts.User, imageUser, "(default)"))
+
+		case "attach":
+			if !user.HasPermission(id, config.PermContainerRead) {
+				logger.For(r.Context()).Warnf("Client", "API", "WS Attach拒否: user=%s, target=%s", username, id)
+				http.Error(w, "Read permission required", http.StatusForbidden)
+				return
+			}
+			// 複数人が同時に stdin へ書き込むと入力が混ざるため、書き込み権はコンテナごとに 1 セッションに限定する。
+			// 権限が無い場合や readonly=true が指定された場合、既に保持者がいる場合は閲覧者として接続する。
+			wantWrite := user.HasPermission(id, config.PermContainerWrite) && q.Get("readonly") != "true"
+			session, ok, holder := s.Consoles.Join(id, username, wantWrite)
+			defer s.Consoles.Leave(id, session)
+			writable = ok
+			consoleInfo = &terminalControl{Type: "console", Writable: writable, Holder: holder}
+
+			resp, err := cli.ContainerAttach(ctx, ref, ctypes.AttachOptions{
+				Stream: true, Stdin: writable, Stdout: true, Stderr: true,
+			})
 			if err != nil {
-				logger.Logf("Internal", "API", "Execアタッチ失敗: container=%s, err=%v", id, err)
+				logger.For(r.Context()).Errorf("Internal", "API", "アタッチ失敗: container=%s, err=%v", id, err)
+				http.Error(w, "Failed to attach", http.StatusInternalServerError)
 				return
 			}
 			stream = resp.Conn
-			logger.Logf("Internal", "API", "Exec接続を開始しました: container=%s", id)
+			if writable && isTty {
+				// コンテナ本体の TTY サイズを変更できるのは書き込み権の保持者のみとする。
+				resize = func(opts ctypes.ResizeOptions) error {
+					return cli.ContainerResize(ctx, ref, opts)
+				}
+			}
+			logger.For(r.Context()).Logf("Internal", "API", "アタッチ接続を開始しました: container=%s, user=%s, writable=%t", id, username, writable)
 
 		case "logs":
 			if !user.HasPermission(id, config.PermContainerRead) {
-				logger.Logf("Client", "API", "WS Logs拒否: user=%s, target=%s", username, id)
+				logger.For(r.Context()).Warnf("Client", "API", "WS Logs拒否: user=%s, target=%s", username, id)
 				http.Error(w, "Read permission required", http.StatusForbidden)
 				return
 			}
-			// コンテナの開始時からのログを、指定された行数（tail）分取得してストリームを開始する。
+			// 直近の出力はサーバー側で共有しているバッファから、指定された行数（tail）分を即座に返す。
 			// 初期表示や無限スクロール時の重複読み込みを防ぐためのパラメータ。
 			tail := q.Get("tail")
 			if tail == "" {
 				tail = "all"
 			}
-			logOptions := ctypes.LogsOptions{
-				ShowStdout: true, ShowStderr: true, Follow: true, Tail: tail,
+			tailLines := -1
+			if n, err := strconv.Atoi(tail); err == nil {
+				tailLines = n
 			}
-			logs, err := docker.Client.ContainerLogs(ctx, id, logOptions)
+			sub, err := docker.Console.Subscribe(id, tailLines)
 			if err != nil {
-				logger.Logf("Internal", "API", "ログ取得失敗: container=%s, err=%v", id, err)
+				logger.For(r.Context()).Errorf("Internal", "API", "ログ取得失敗: container=%s, err=%v", id, err)
 				http.Error(w, "Failed to get logs", http.StatusInternalServerError)
 				return
 			}
-			// ログモードでは入力（stdin）を送る必要がないため、書き込みを無視するラッパーを使用する。
-			stream = &docker.ReadNullWriteCloser{R: logs}
-			logger.Logf("Internal", "API", "ログストリーミングを開始しました: container=%s, tail=%s", id, tail)
+			// format=json / level の指定がある場合は、行単位で構造化・絞り込みを行ってから転送する。
+			if logLines, err = parseLogFilter(q, s.Config.Get().Servers[id]); err != nil {
+				sub.Close()
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// 共有バッファの出力は多重化解除済みのため、TTY の有無に関わらずそのまま転送する。
+			stream = sub
+			isTty = true
+			logger.For(r.Context()).Logf("Internal", "API", "ログストリーミングを開始しました: container=%s, tail=%s", id, tail)
 		}
 
 		if stream != nil {
@@ -112,12 +219,30 @@ func (s *Server) TerminalHandler() http.HandlerFunc {
 		}
 
 		// HTTP接続をWebSocketにアップグレードし、双方向通信を確立する。
-		ws, err := wsUpgrader.Upgrade(w, r, nil)
+		upgraded, err := wsUpgrader.Upgrade(w, r, nil)
 		if err != nil {
-			logger.Logf("Internal", "API", "WebSocketアップグレード失敗: %v", err)
+			logger.For(r.Context()).Errorf("Internal", "API", "WebSocketアップグレード失敗: %v", err)
 			return
 		}
+		ws := newWSConn(upgraded)
 		defer ws.Close()
+		defer ws.CloseOnDone(ctx)()
+
+		// 監査・障害調査のため、操作可能なセッション（exec / attach）を録画する。閲覧のみのログ表示は対象外。
+		var rec *recording.Recorder
+		if mode == "exec" || mode == "attach" {
+			rec, err = recording.Start(s.Config.Get().Recording, id, username, mode)
+			if err != nil {
+				logger.For(r.Context()).Errorf("Internal", "API", "録画の開始に失敗: container=%s, err=%v", id, err)
+			}
+			defer rec.Close()
+		}
+
+		if consoleInfo != nil {
+			if b, err := json.Marshal(consoleInfo); err == nil {
+				ws.Send(websocket.TextMessage, b)
+			}
+		}
 
 		var once sync.Once
 		done := make(chan struct{})
@@ -129,7 +254,7 @@ func (s *Server) TerminalHandler() http.HandlerFunc {
 					stream.Close()
 				}
 				ws.Close()
-				logger.Logf("Internal", "API", "WebSocket接続が切断されました: container=%s, mode=%s", id, mode)
+				logger.For(r.Context()).Logf("Internal", "API", "WebSocket接続が切断されました: container=%s, mode=%s", id, mode)
 			})
 		}
 
@@ -137,8 +262,16 @@ func (s *Server) TerminalHandler() http.HandlerFunc {
 		// コンテナからの標準出力を捕捉し、WebSocketクライアントへと転送する。
 		go func() {
 			defer cleanup()
-			wsWriter := &wsBinaryWriter{ws}
-			if isTty {
+			wsWriter := io.MultiWriter(&wsBinaryWriter{ws}, rec)
+			if logLines != nil {
+				// 構造化した行はテキストフレーム、絞り込んだ元の行はバイナリフレームで 1 行ずつ送信する。
+				logLines.copyLines(stream, func(line []byte, isJSON bool) error {
+					if isJSON {
+						return ws.Send(websocket.TextMessage, line)
+					}
+					return ws.Send(websocket.BinaryMessage, line)
+				})
+			} else if isTty {
 				// TTYが有効な場合はそのまま転送可能。
 				io.Copy(wsWriter, stream)
 			} else {
@@ -152,12 +285,39 @@ func (s *Server) TerminalHandler() http.HandlerFunc {
 		go func() {
 			defer cleanup()
 			for {
-				_, msg, err := ws.ReadMessage()
+				msgType, msg, err := ws.ReadMessage()
 				if err != nil {
 					// クライアント側からの切断やエラーを検知して終了する。
 					return
 				}
-				stream.Write(msg)
+				if msgType == websocket.BinaryMessage {
+					// 閲覧者からの入力は破棄する。
+					if writable {
+						rec.Input(msg)
+						stream.Write(msg)
+					}
+					continue
+				}
+
+				// テキストフレームは制御メッセージとして解釈する。
+				var ctrl terminalControl
+				if err := json.Unmarshal(msg, &ctrl); err != nil {
+					logger.For(r.Context()).Warnf("Client", "API", "不正な制御メッセージを受信しました: container=%s, err=%v", id, err)
+					continue
+				}
+				switch ctrl.Type {
+				case "resize":
+					if resize == nil || ctrl.Cols == 0 || ctrl.Rows == 0 {
+						continue
+					}
+					if err := resize(ctypes.ResizeOptions{Width: ctrl.Cols, Height: ctrl.Rows}); err != nil {
+						logger.For(r.Context()).Errorf("Internal", "API", "端末サイズの変更に失敗: container=%s, err=%v", id, err)
+						continue
+					}
+					rec.Resize(ctrl.Cols, ctrl.Rows)
+				default:
+					logger.For(r.Context()).Logf("Client", "API", "未知の制御メッセージを受信しました: container=%s, type=%s", id, ctrl.Type)
+				}
 			}
 		}()
 
@@ -170,14 +330,7 @@ func (s *Server) TerminalHandler() http.HandlerFunc {
 func (s *Server) StatsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.URL.Query().Get("id")
-
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			token = r.URL.Query().Get("token")
-		}
-		s.WebSessionMu.RLock()
-		username := s.WebSessions[token]
-		s.WebSessionMu.RUnlock()
+		username := wsUser(r)
 
 		user := s.Config.Get().Users[username]
 		if !user.HasPermission(id, config.PermContainerRead) {
@@ -185,52 +338,283 @@ func (s *Server) StatsHandler() http.HandlerFunc {
 			http.Error(w, "Read permission required", http.StatusForbidden)
 			return
 		}
+		s.streamStats(w, r, id)
+	}
+}
 
-		ws, err := wsUpgrader.Upgrade(w, r, nil)
-		if err != nil {
-			logger.Logf("Internal", "API", "Stats WebSocketアップグレード失敗: %v", err)
-			return
-		}
+// 統計情報の配信で通知するコンテナの状態。
+const (
+	statsRunning     = "running"     // 統計情報を配信中
+	statsStopped     = "stopped"     // コンテナは存在するが停止中
+	statsMissing     = "missing"     // コンテナが未作成 (または削除済み)
+	statsUnavailable = "unavailable" // Docker に接続できない、または統計情報を取得できないサーバー (process 等)
+)
+
+// statsRecheckInterval はイベントを取りこぼした場合に備え、停止中のコンテナの状態を再確認する間隔。
+const statsRecheckInterval = 30 * time.Second
+
+// statsStateFrame は統計情報の配信で、コンテナの状態が変わった際に送信するフレーム。
+// 統計情報のフレームの type は "stats" となり、クライアントは type で区別する。
+type statsStateFrame struct {
+	Type   string    `json:"type"` // 常に "state"
+	Server string    `json:"server"`
+	State  string    `json:"state"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// MARK: streamStats()
+// コンテナの統計情報を WebSocket へ配信し続ける。呼び出し元で権限を確認済みであること。
+// 共有リンクからの閲覧でも同じ形式で配信するため、StatsHandler から切り出している。
+// 停止中・未作成の場合は状態のフレームを送って接続を維持し、コンテナが起動した時点で統計情報の配信へ切り替える。
+func (s *Server) streamStats(w http.ResponseWriter, r *http.Request, id string) {
+	upgraded, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "Stats WebSocketアップグレード失敗: %v", err)
+		return
+	}
+	ws := newWSConn(upgraded)
+	defer ws.Close()
+	defer ws.CloseOnDone(r.Context())()
+
+	// クライアントからの送信は無いが、pong の処理と切断の検知のために読み込みを継続する。
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
 		defer ws.Close()
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
 
-		// Docker SDKからストリーム形式で統計情報を取得し続け、OS全体の情報を付与してWebSocketへ流し込む。
-		stats, err := docker.Client.ContainerStats(r.Context(), id, true)
-		if err != nil {
-			logger.Logf("Internal", "API", "統計情報取得失敗: container=%s, err=%v", id, err)
+	// 状態の確認より前に購読し、確認から待機までの間の起動を取りこぼさないようにする。
+	events, unsubscribe := docker.Events.Subscribe()
+	defer unsubscribe()
+
+	lastState := ""
+	for ctx.Err() == nil {
+		state, detail := s.statsState(ctx, id)
+		if state != lastState {
+			b, _ := json.Marshal(statsStateFrame{Type: "state", Server: id, State: state, Error: detail, Time: time.Now()})
+			if err := ws.Send(websocket.TextMessage, b); err != nil {
+				return
+			}
+			lastState = state
+		}
+		if state == statsRunning {
+			if err := s.sendStats(ctx, ws, id, events); err != nil {
+				logger.For(r.Context()).Errorf("Internal", "API", "統計情報取得失敗: container=%s, err=%v", id, err)
+				waitContainerEvent(ctx, events, id, 5*time.Second)
+			}
+			continue
+		}
+		waitContainerEvent(ctx, events, id, statsRecheckInterval)
+	}
+}
+
+// statsState はコンテナの状態を、統計情報の配信で通知する状態へ変換する。
+func (s *Server) statsState(ctx context.Context, id string) (string, string) {
+	if s.Config.Get().Servers[id].ProcessSettings() != nil {
+		return statsUnavailable, "stats are not available for process servers"
+	}
+	cli, err := docker.ForServer(id)
+	if err != nil {
+		return statsUnavailable, err.Error()
+	}
+	callCtx, cancel := context.WithTimeout(ctx, docker.CallTimeout)
+	defer cancel()
+	// 同じ名前の管理外のコンテナは ErrNotOwned として、統計情報を配信しない。
+	ref, err := docker.Ref(callCtx, id)
+	var inspect ctypes.InspectResponse
+	if err == nil {
+		inspect, err = cli.ContainerInspect(callCtx, ref)
+	}
+	switch {
+	case errdefs.IsNotFound(err):
+		return statsMissing, ""
+	case err != nil:
+		return statsUnavailable, err.Error()
+	case inspect.State == nil || !inspect.State.Running:
+		return statsStopped, ""
+	}
+	return statsRunning, ""
+}
+
+// waitContainerEvent はコンテナのライフサイクルイベントを受信するか、timeout が経過するまで待機する。
+func waitContainerEvent(ctx context.Context, events <-chan docker.ContainerEvent, id string, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
 			return
+		case ev, ok := <-events:
+			if !ok {
+				// 購読が打ち切られた場合は、再確認の間隔まで待つ。
+				events = nil
+				continue
+			}
+			if ev.Of(id) {
+				return
+			}
 		}
-		defer stats.Body.Close()
+	}
+}
 
-		decoder := json.NewDecoder(stats.Body)
+// sendStats は稼働中のコンテナの統計情報を、停止 (die / destroy) するか接続が切れるまで配信する。
+// Docker の統計情報のストリームは停止後もゼロ値を送り続けるため、停止はイベントで検知して打ち切る。
+func (s *Server) sendStats(ctx context.Context, ws *wsConn, id string, events <-chan docker.ContainerEvent) error {
+	cli, err := docker.ForServer(id)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watcherDone := make(chan struct{})
+	defer func() { <-watcherDone }()
+	go func() {
+		defer close(watcherDone)
 		for {
-			var dockerStats map[string]any
-			if err := decoder.Decode(&dockerStats); err != nil {
-				if err == io.EOF {
-					break
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if ev.Of(id) && (ev.Action == "die" || ev.Action == "destroy") {
+					cancel()
+					return
 				}
-				logger.Logf("Internal", "API", "Docker統計デコード失敗: %v", err)
-				break
 			}
+		}
+	}()
 
-			// OS全体の情報を取得 (サンプリング間隔を持たせて安定させる)
-			v, _ := mem.VirtualMemory()
-			c, _ := cpu.Percent(200*time.Millisecond, false)
+	ref, err := docker.Ref(ctx, id)
+	if err != nil {
+		return err
+	}
+	// Docker SDKからストリーム形式で統計情報を取得し続け、OS全体の情報を付与してWebSocketへ流し込む。
+	stats, err := cli.ContainerStats(ctx, ref, true)
+	if err != nil {
+		return err
+	}
+	defer stats.Body.Close()
 
-			// 情報を付与
-			osStats := map[string]any{
-				"memory_used_percent": v.UsedPercent,
-				"memory_total":        v.Total,
-				"memory_used":         v.Total - v.Available, // htop 等に近い「直感的な」使用量 (Total - Available)
-				"cpu_percent":         0.0,
+	decoder := json.NewDecoder(stats.Body)
+	calc := &docker.StatsCalculator{}
+	for {
+		// 生の統計値はそのまま転送しつつ、正規化した指標を算出するため型付きでも解釈する。
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
 			}
-			if len(c) > 0 {
-				osStats["cpu_percent"] = c[0]
+			return fmt.Errorf("failed to decode stats: %w", err)
+		}
+		var dockerStats map[string]any
+		var typed ctypes.StatsResponse
+		if err := json.Unmarshal(raw, &dockerStats); err != nil {
+			return fmt.Errorf("failed to decode stats: %w", err)
+		}
+		if err := json.Unmarshal(raw, &typed); err != nil {
+			return fmt.Errorf("failed to decode stats: %w", err)
+		}
+		dockerStats["type"] = "stats"
+		// クライアント側で cpu_delta 等の計算を再実装させないよう、算出済みの値を付与する。
+		dockerStats["computed"] = calc.Compute(typed)
+
+		// OS全体の情報を取得 (サンプリング間隔を持たせて安定させる)
+		v, _ := mem.VirtualMemory()
+		c, _ := cpu.Percent(200*time.Millisecond, false)
+
+		// 情報を付与
+		osStats := map[string]any{
+			"memory_used_percent": v.UsedPercent,
+			"memory_total":        v.Total,
+			"memory_used":         v.Total - v.Available, // htop 等に近い「直感的な」使用量 (Total - Available)
+			"cpu_percent":         0.0,
+		}
+		if len(c) > 0 {
+			osStats["cpu_percent"] = c[0]
+		}
+		dockerStats["os_stats"] = osStats
+
+		// プレイヤー数等の問い合わせ結果はキャッシュされるため、フレーム毎に参照してもサーバーへの負荷は増えない。
+		if queryCfg := s.Config.Get().Servers[id].Query; queryCfg != nil {
+			if result, err := query.Cached(ctx, id, *queryCfg); err == nil {
+				dockerStats["query"] = result
 			}
-			dockerStats["os_stats"] = osStats
+		}
 
-			if err := ws.WriteJSON(dockerStats); err != nil {
-				break
+		b, err := json.Marshal(dockerStats)
+		if err != nil {
+			return err
+		}
+		// 統計情報は次の値で置き換わるため、クライアントが追従できない場合は古いフレームを破棄する。
+		if !ws.TrySend(websocket.TextMessage, b) {
+			select {
+			case <-ws.Done():
+				return nil
+			default:
 			}
 		}
 	}
 }
+
+// MARK: terminalOptions()
+// exec モードで起動するシェルの設定を、サーバーの既定値とクエリ (shell, cmd, user, cwd, env) から求める。
+// cmd はシェルの代わりに起動するコマンドラインで、引数はシェルと同様の引用符の規則で分割する。
+// env は KEY=VALUE の形式で複数指定でき、既定値の同名の変数を上書きする。
+func terminalOptions(q url.Values, defaults *config.TerminalConfig) (ctypes.ExecOptions, error) {
+	var base config.TerminalConfig
+	if defaults != nil {
+		base = *defaults
+	}
+	opts := ctypes.ExecOptions{
+		Cmd:        []string{cmp.Or(q.Get("shell"), base.Shell, "/bin/sh")},
+		User:       cmp.Or(q.Get("user"), base.User),
+		WorkingDir: cmp.Or(q.Get("cwd"), base.WorkingDir),
+		Env:        []string{"TERM=xterm-256color"},
+	}
+	if q.Has("cmd") {
+		if q.Has("shell") {
+			return opts, errors.New("shell and cmd cannot be used together")
+		}
+		argv, err := config.SplitCommandLine(q.Get("cmd"))
+		if err != nil {
+			return opts, fmt.Errorf("invalid cmd: %w", err)
+		}
+		if len(argv) == 0 {
+			return opts, errors.New("cmd is empty")
+		}
+		opts.Cmd = argv
+	} else if strings.ContainsAny(opts.Cmd[0], " \t\r\n") {
+		return opts, fmt.Errorf("shell must be a single command without arguments, got %q", opts.Cmd[0])
+	}
+	if opts.WorkingDir != "" && !strings.HasPrefix(opts.WorkingDir, "/") {
+		return opts, fmt.Errorf("cwd must be an absolute path, got %q", opts.WorkingDir)
+	}
+	for _, key := range slices.Sorted(maps.Keys(base.Env)) {
+		opts.Env = append(opts.Env, key+"="+base.Env[key])
+	}
+	for _, kv := range q["env"] {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return opts, fmt.Errorf("env must be KEY=VALUE, got %q", kv)
+		}
+		// Docker は同名の変数のうち後のものを採用するため、クエリの値が既定値を上書きする。
+		opts.Env = append(opts.Env, kv)
+	}
+	return opts, nil
+}
+
+// isRootUser は Exec の実行ユーザー (name / uid / name:group) が root かを返す。空はイメージの既定 (root) を表す。
+func isRootUser(u string) bool {
+	name, _, _ := strings.Cut(u, ":")
+	return name == "" || name == "root" || name == "0"
+}
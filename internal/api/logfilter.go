@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logformat"
+)
+
+// MARK: logFilter
+// ログの構造化出力 (format=json) とレベルでの絞り込み (level=warn 等) の指定。
+type logFilter struct {
+	parser *logformat.Parser
+	level  string // 空の場合は絞り込まない
+	json   bool   // 行ごとに logformat.Entry の JSON を出力する
+}
+
+// parseLogFilter はクエリから絞り込みの指定を読み取る。指定が無い場合は nil を返し、元の出力をそのまま転送させる。
+// レベルでの絞り込みは、サーバーに logFormat が定義されている場合のみ受け付ける。
+func parseLogFilter(q url.Values, serverCfg config.ServerConfig) (*logFilter, error) {
+	format, level := q.Get("format"), q.Get("level")
+	if format != "" && format != "json" && format != "text" {
+		return nil, fmt.Errorf("unknown format %q (expected json or text)", format)
+	}
+	if format != "json" && level == "" {
+		return nil, nil
+	}
+
+	f := &logFilter{json: format == "json"}
+	if level != "" {
+		if serverCfg.LogFormat == nil {
+			return nil, fmt.Errorf("logFormat is not configured for this server")
+		}
+		var err error
+		if f.level, err = logformat.ParseLevel(level); err != nil {
+			return nil, err
+		}
+	}
+	parser, err := logformat.New(serverCfg.LogFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logFormat: %w", err)
+	}
+	f.parser = parser
+	return f, nil
+}
+
+// copyLines は r を行単位で分解・絞り込みし、emit へ渡す。emit には JSON (format=json) または改行付きの元の行を渡す。
+func (f *logFilter) copyLines(r io.Reader, emit func(line []byte, isJSON bool) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := f.parser.Parse(scanner.Text())
+		if f.level != "" && !entry.AtLeast(f.level) {
+			continue
+		}
+		var line []byte
+		if f.json {
+			b, err := json.Marshal(entry)
+			if err != nil {
+				continue
+			}
+			line = b
+		} else {
+			line = []byte(entry.Raw + "\n")
+		}
+		if err := emit(line, f.json); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
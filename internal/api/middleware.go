@@ -5,6 +5,10 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -36,6 +40,33 @@ func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error)
 	return hijacker.Hijack()
 }
 
+// MARK: Flush()
+// SSE 等のストリーミング応答で、バッファ済みのデータを即座にクライアントへ送出できるようにする。
+func (lrw *loggingResponseWriter) Flush() {
+	if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// requestIDPattern はクライアントやリバースプロキシから受け取る X-Request-ID として受け入れる形式。
+// ログの行を壊す文字や過度に長い値は受け入れず、新たに生成する。
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// MARK: WithRequestID()
+// リクエストごとに ID を割り当ててコンテキストへ関連付け、X-Request-ID ヘッダーで応答する。
+// 以降の API・コンテナ操作・Docker 呼び出し・ジョブのログに同じ ID が付与され、失敗した操作を一貫して追跡できる。
+// リバースプロキシ等が X-Request-ID を付与している場合は、その値を引き継ぐ。
+func (s *Server) WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	})
+}
+
 // MARK: WithLogging()
 // すべてのHTTPリクエストに対して、メソッド、パス（クエリ付き）、ステータス、処理時間を記録する共通ミドルウェア。
 func (s *Server) WithLogging(next http.Handler) http.Handler {
@@ -47,9 +78,14 @@ func (s *Server) WithLogging(next http.Handler) http.Handler {
 		// 次のハンドラー（実際のAPI処理）を実行し、一連の処理が完了するのを待機する。
 		next.ServeHTTP(lrw, r)
 
+		// ウォッチドッグ等による定期的な死活監視は、アクセスログを埋めないよう正常応答のみ記録を省く。
+		if r.URL.Path == "/api/health" && lrw.statusCode == http.StatusOK {
+			return
+		}
+
 		// 規約に基づき [timestamp] [level] [service]: message 形式でアクセス情報を出力する。
 		// クエリパラメータ (?id=...) を含めた完全なリクエスト内容を追跡するため RequestURI を使用する。
-		logger.Logf("Internal", "Access", "%s %s %s %d %v",
+		logger.For(r.Context()).Logf("Internal", "Access", "%s %s %s %d %v",
 			r.Method,
 			r.RequestURI,
 			r.RemoteAddr,
@@ -59,18 +95,93 @@ func (s *Server) WithLogging(next http.Handler) http.Handler {
 	})
 }
 
+// CORS の既定値。設定で省略された項目に使用する。
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "X-Request-ID", uploadOffsetHeader}
+	// corsExposedHeaders は別オリジンのフロントエンドからも参照できるようにする応答ヘッダー。
+	corsExposedHeaders = []string{"X-Request-ID", "X-Total-Count", "Deprecation", "Link", "Location", uploadOffsetHeader}
+)
+
+// defaultCORSMaxAge はプリフライトの結果をブラウザがキャッシュする既定の秒数。
+const defaultCORSMaxAge = 600
+
+// MARK: WithCORS()
+// 設定 (cors) で許可されたオリジンからのリクエストに CORS ヘッダーを付与し、プリフライト (OPTIONS) に応答する。
+// 設定は再読み込みに追従するよう、リクエストごとに参照する。未設定または許可されないオリジンの場合はヘッダーを付与しない (同一オリジンのみ)。
+func (s *Server) WithCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		c := s.Config.Get().CORS
+		if origin == "" || c == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		// 許可の判定がオリジンにより異なるため、キャッシュがオリジンごとに区別されるようにする。
+		h.Add("Vary", "Origin")
+		wildcard := slices.Contains(c.AllowedOrigins, "*")
+		if !wildcard && !slices.Contains(c.AllowedOrigins, origin) {
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				logger.For(r.Context()).Warnf("Client", "API", "許可されていないオリジンからのプリフライトを拒否: origin=%s", origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wildcard && !c.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// プリフライトはハンドラーへ渡さず、許可するメソッドとヘッダーを応答する。
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			methods, headers, maxAge := c.AllowedMethods, c.AllowedHeaders, c.MaxAge
+			if len(methods) == 0 {
+				methods = defaultCORSMethods
+			}
+			if len(headers) == 0 {
+				headers = defaultCORSHeaders
+			}
+			if maxAge == 0 {
+				maxAge = defaultCORSMaxAge
+			}
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			h.Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		next.ServeHTTP(w, r)
+	})
+}
+
 // MARK: wsBinaryWriter
 // WebSocket経由でバイナリデータを送信するための、io.Writer互換ラッパー。
 type wsBinaryWriter struct {
-	*websocket.Conn
+	*wsConn
 }
 
 // MARK: Write()
-// バイナリメッセージとして送信を行い、送信失敗時には正規のエラーを返却する。
+// バイナリメッセージとして送信キューへ積み、接続断時には正規のエラーを返却する。
+// 端末出力は欠落させてはならないため、キューが空くまで待機する。
 func (w *wsBinaryWriter) Write(p []byte) (int, error) {
-	if w.Conn == nil {
+	if w.wsConn == nil {
 		return 0, os.ErrInvalid
 	}
-	err := w.WriteMessage(websocket.BinaryMessage, p)
-	return len(p), err
+	// 呼び出し元はバッファを再利用するため、送信前に複製する。
+	if err := w.Send(websocket.BinaryMessage, append([]byte(nil), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
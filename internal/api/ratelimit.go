@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/netutil"
+	"github.com/play-bin/internal/notify"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdleTTL はこの時間使われなかったバケットを破棄する。破棄されたバケットは満杯の状態で再作成されるため、制限は緩まない。
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// MARK: rateLimiter
+// キー (制限の種類 + ユーザー名または IP アドレス) ごとのトークンバケットと、同時に処理中のリクエスト数を保持する。
+type rateLimiter struct {
+	buckets   map[string]*rateBucket
+	inflight  map[string]int
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+type rateBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets:  make(map[string]*rateBucket),
+		inflight: make(map[string]int),
+	}
+}
+
+// allow はキーのバケットからトークンを 1 つ取り出す。不足している場合は取り出さず、次に取り出せるまでの時間を返す。
+// 設定の再読み込みで流量が変更された場合は、既存のバケットにも反映する。
+func (l *rateLimiter) allow(key string, perMinute, burst int) (time.Duration, bool) {
+	now := time.Now()
+	limit := rate.Limit(float64(perMinute) / 60)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &rateBucket{limiter: rate.NewLimiter(limit, burst)}
+		l.buckets[key] = b
+	} else if b.limiter.Limit() != limit || b.limiter.Burst() != burst {
+		b.limiter.SetLimitAt(now, limit)
+		b.limiter.SetBurstAt(now, burst)
+	}
+	b.lastSeen = now
+
+	res := b.limiter.ReserveN(now, 1)
+	if !res.OK() {
+		return time.Minute, false
+	}
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// sweep は一定時間使われていないバケットを破棄し、メモリ使用量を接続元の数に比例させない。呼び出し側で mu を保持していること。
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > rateLimiterIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// acquire は同時に処理中のリクエスト数が上限未満であれば 1 つ加算し、解放する関数を返す。
+func (l *rateLimiter) acquire(key string, max int) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[key] >= max {
+		return nil, false
+	}
+	l.inflight[key]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.inflight[key]--; l.inflight[key] <= 0 {
+			delete(l.inflight, key)
+		}
+	}, true
+}
+
+// rateCheck は 1 リクエストに適用する制限の 1 つ。
+type rateCheck struct {
+	kind      string // 応答と記録に含める制限の種類
+	key       string
+	perMinute int
+	burst     int
+}
+
+// MARK: WithRateLimit()
+// API へのリクエストをトークンバケットで制限し、超過した場合は Retry-After を付けて 429 を返す。
+// 全てのリクエストに加え、ログイン (IP アドレスごと) と変更を伴う操作はより厳しく制限し、ユーザーごとの同時処理数にも上限を設ける。
+func (s *Server) WithRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.Config.Get().RateLimit.WithDefaults()
+		path := r.URL.Path
+		limited := strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/ws/")
+		if cfg.Disabled || !limited || path == "/api/health" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// IPv6 は /64 ごとに数える (netutil.ClientKey)。
+		ip := netutil.ClientKey(clientIP(r))
+		subject := "ip:" + ip
+		if user := s.sessionUser(r); user != "" {
+			subject = "user:" + user
+		}
+
+		checks := []rateCheck{{"requests", "req:" + subject, cfg.RequestsPerMinute, cfg.Burst}}
+		switch {
+		case path == "/api/login", path == "/api/me/password":
+			// パスワードの変更も現在のパスワードの総当たりに使えるため、ログインと同じ枠で制限する。
+			checks = append(checks, rateCheck{"login", "login:" + ip, cfg.LoginPerMinute, cfg.LoginBurst})
+		case r.Method != http.MethodGet && r.Method != http.MethodHead:
+			checks = append(checks, rateCheck{"actions", "action:" + subject, cfg.ActionsPerMinute, cfg.ActionBurst})
+		}
+		for _, c := range checks {
+			if delay, ok := s.limiter.allow(c.key, c.perMinute, c.burst); !ok {
+				s.rejectRateLimited(w, r, c.kind, subject, delay)
+				return
+			}
+		}
+
+		// SSE と WebSocket は接続を維持し続けるため、同時処理数には数えない。
+		if path != "/api/events" && !strings.HasPrefix(path, "/ws/") {
+			release, ok := s.limiter.acquire("inflight:"+subject, cfg.MaxConcurrent)
+			if !ok {
+				s.rejectRateLimited(w, r, "concurrency", subject, time.Second)
+				return
+			}
+			defer release()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectRateLimited は制限の種類と再試行までの秒数を添えて 429 を返す。
+func (s *Server) rejectRateLimited(w http.ResponseWriter, r *http.Request, kind, subject string, delay time.Duration) {
+	retryAfter := max(1, int(math.Ceil(delay.Seconds())))
+	logger.For(r.Context()).Warnf("Client", "API", "流量制限により拒否: %s, limit=%s, path=%s", subject, kind, r.URL.Path)
+	if kind == "login" {
+		// ログインの総当たりの可能性があるため、管理者へ通知する。同じ接続元からの連続した拒否は通知側でまとめる。
+		ip := clientIP(r)
+		notify.Events.Publish(notify.Event{
+			Kind:    config.NotifyLoginLockout,
+			Summary: fmt.Sprintf("Login attempts from %s were rejected by the rate limit", ip),
+			Details: map[string]string{"ip": ip, "path": r.URL.Path},
+			Key:     ip,
+		})
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, r, http.StatusTooManyRequests, ErrCodeRateLimited, "Too many requests", map[string]any{"limit": kind, "retryAfter": retryAfter})
+}
+
+// clientIP は接続元の IP アドレスを返す。X-Forwarded-For は偽装できるため参照しない。
+func clientIP(r *http.Request) string {
+	return netutil.RemoteIP(r.RemoteAddr)
+}
@@ -1,13 +1,24 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"sync"
 
 	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/fsutil"
 	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/netutil"
+	"github.com/play-bin/internal/preferences"
+	"github.com/play-bin/internal/schedule"
 	"github.com/play-bin/internal/webdav"
+	"google.golang.org/grpc"
 )
 
 // Server はAPIサーバーの本体を表す。
@@ -18,17 +29,65 @@ type Server struct {
 	// WebSessions はトークンをキー、ユーザー名を値として管理するスレッドセーフなマップ。
 	WebSessions  map[string]string
 	WebSessionMu sync.RWMutex
+	// sessionsPath は終了時にセッションを保存し、再起動後もログイン状態を維持するためのファイル。
+	sessionsPath string
+
+	// Consoles は attach モードのコンソールの書き込み権を管理する。
+	Consoles *ConsoleLocks
+	// History はユーザーごとのコマンド送信履歴を保持する。
+	History *CommandHistory
+	// Schedules はサーバーへの定期コマンドを保持・実行する。
+	Schedules *schedule.Scheduler
+	// limiter はユーザー・IP アドレスごとの流量と同時処理数を制限する。
+	limiter *rateLimiter
+	// shares はアカウントなしで閲覧できる共有リンクの署名鍵を保持する。
+	shares *shareLinks
+	// uploads は受信中の再開可能なアップロードを保持する。
+	uploads *uploads
+	// syncs はディレクトリの同期の計画を保持する。
+	syncs *syncPlans
+	// wsTickets は WebSocket 接続用の使い捨てのチケットを保持する。
+	wsTickets *wsTickets
+	// Preferences はユーザーごとの UI と通知の設定を保持する。
+	Preferences *preferences.Store
+	// publicStatus は認証不要の公開ステータスの集計結果を短時間保持する。
+	publicStatus publicStatusCache
+
+	httpServer *http.Server
+	grpcServer *grpc.Server
+	httpAddr   string // 実際に待機しているアドレス (ヘルスチェックの接続先)
+	httpMu     sync.Mutex
+	// ready は待機を開始した (または HTTP サーバーが無効である) 時点で閉じられる。
+	ready     chan struct{}
+	readyOnce sync.Once
+	// baseCtx は全リクエストのコンテキストの親。終了時にキャンセルし、SSE や WebSocket 等の長時間の接続を閉じる。
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
 }
 
 // MARK: NewServer()
 // APIサーバーの新しいインスタンスを作成する。
 func NewServer(cfg *config.LoadedConfig, cm *container.Manager) *Server {
 	// 各コンポーネントとの依存関係を明示的に注入し、整合性を保った状態でインスタンスを初期化する。
-	return &Server{
+	s := &Server{
 		Config:           cfg,
 		ContainerManager: cm,
 		WebSessions:      make(map[string]string),
+		sessionsPath:     "./sessions.json",
+		Consoles:         NewConsoleLocks(),
+		History:          NewCommandHistory("./command_history.json"),
+		Schedules:        schedule.NewScheduler(cfg, "./schedules.json"),
+		limiter:          newRateLimiter(),
+		shares:           loadShareLinks("./share_links.json"),
+		uploads:          loadUploads("./uploads.json"),
+		syncs:            newSyncPlans(),
+		wsTickets:        newWSTickets(),
+		Preferences:      preferences.NewStore(),
+		ready:            make(chan struct{}),
 	}
+	s.baseCtx, s.cancelBase = context.WithCancel(context.Background())
+	s.loadSessions()
+	return s
 }
 
 // MARK: Routes()
@@ -37,29 +96,102 @@ func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 
 	// MARK: > Static Files
-	// UIの資産である静的ファイル（HTML, CSS, JS）をルートディレクトリから提供する。
-	mux.Handle("/", http.FileServer(http.Dir("./")))
+	// UIの資産である静的ファイル（HTML, CSS, JS）を、バイナリに埋め込んだもの（または設定の staticRoot）から提供する。
+	mux.Handle("/", s.StaticHandler())
 
 	// MARK: > Container API
 	// ログインやコンテナ一覧、詳細情報取得など、すべての動的APIエンドポイントを定義する。
 	// Authミドルウェアを介することで、未認証ユーザーによる操作を未然に防ぐ。
 	mux.HandleFunc("/api/login", s.Login)
+	mux.HandleFunc("/api/health", s.Health)
+	mux.HandleFunc("/api/me", s.Auth(s.MeHandler))
+	mux.HandleFunc("/api/me/password", s.Auth(s.ChangePassword))
+	mux.HandleFunc("/api/me/preferences", s.Auth(s.PreferencesHandler))
 	mux.HandleFunc("/api/containers", s.Auth(s.ListContainers))
 	mux.HandleFunc("/api/container/inspect", s.Auth(s.InspectContainer))
-	mux.HandleFunc("/api/container/start", s.Auth(s.Action("start")))
-	mux.HandleFunc("/api/container/stop", s.Auth(s.Action("stop")))
-	mux.HandleFunc("/api/container/kill", s.Auth(s.Action("kill")))
-	mux.HandleFunc("/api/container/backup", s.Auth(s.Action("backup")))
+	mux.HandleFunc("/api/container/start", s.AuthBulk(s.Action("start")))
+	mux.HandleFunc("/api/container/stop", s.AuthBulk(s.Action("stop")))
+	mux.HandleFunc("/api/container/kill", s.AuthBulk(s.Action("kill")))
+	mux.HandleFunc("/api/container/backup", s.AuthBulk(s.Action("backup")))
 	mux.HandleFunc("/api/container/backups", s.Auth(s.ListBackups))
 	mux.HandleFunc("/api/container/restore", s.Auth(s.RestoreAction))
-	mux.HandleFunc("/api/container/remove", s.Auth(s.Action("remove")))
+	mux.HandleFunc("/api/container/migrate", s.Auth(s.MigrateAction))
+	mux.HandleFunc("/api/container/remove", s.AuthBulk(s.Action("remove")))
 	mux.HandleFunc("/api/container/cmd", s.Auth(s.CmdContainer))
+	mux.HandleFunc("/api/container/exec", s.Auth(s.ExecContainer))
+	mux.HandleFunc("/api/container/cp", s.Auth(s.CopyHandler))
+	mux.HandleFunc("/api/container/console", s.Auth(s.ConsoleStatusHandler))
+	mux.HandleFunc("/api/container/commands", s.Auth(s.CommandsHandler))
+	mux.HandleFunc("/api/container/recordings", s.Auth(s.ListRecordings))
+	mux.HandleFunc("/api/container/recording", s.Auth(s.GetRecording))
 	mux.HandleFunc("/api/container/logs", s.Auth(s.GetContainerLogs))
+	mux.HandleFunc("/api/container/logs/search", s.Auth(s.SearchLogs))
+	mux.HandleFunc("/api/container/archive", s.Auth(s.ArchiveHandler))
+	mux.HandleFunc("/api/container/players", s.Auth(s.GetPlayers))
+	mux.HandleFunc("/api/container/ready", s.Auth(s.ReadyHandler))
+	mux.HandleFunc("/api/container/traffic", s.Auth(s.TrafficHandler))
+	mux.HandleFunc("/api/container/mods", s.Auth(s.ModsHandler))
+	mux.HandleFunc("/api/container/worlds", s.Auth(s.WorldsHandler))
+	mux.HandleFunc("/api/container/snapshots", s.Auth(s.SnapshotsHandler))
+	mux.HandleFunc("/api/container/incidents", s.Auth(s.IncidentsHandler))
+	mux.HandleFunc("/api/container/schedules", s.Auth(s.SchedulesHandler))
+	mux.HandleFunc("/api/container/share", s.Auth(s.ShareHandler))
+	// 操作の応答を待つ間の進捗の取得や、SSE を扱えないクライアントからの参照のためにジョブの一覧を提供する。
+	mux.HandleFunc("/api/jobs", s.Auth(s.JobsHandler))
+	// 回線が不安定でも大きなファイル (ワールド等) を送れるよう、断片に分けて再開できるアップロードを提供する。
+	mux.HandleFunc("/api/files/upload", s.Auth(s.UploadHandler))
+	// CI から Modpack 等を配置できるよう、マニフェストとの差分のみを受信してまとめて適用する同期を提供する。
+	mux.HandleFunc("/api/files/sync", s.Auth(s.SyncHandler))
+
+	// MARK: > Image API
+	// ゲームサーバー用イメージの肥大化を防ぐため、一覧・プル・タグ付け・削除を提供する。
+	mux.HandleFunc("/api/images", s.Auth(s.ListImages))
+	mux.HandleFunc("/api/images/pull", s.Auth(s.PullImage))
+	mux.HandleFunc("/api/images/tag", s.Auth(s.TagImage))
+	mux.HandleFunc("/api/images/prune", s.Auth(s.PruneImages))
+
+	// MARK: > Config API
+	// 設定の閲覧・サーバー定義の変更と、設定ファイルの編集ミスを再読み込みで拒否される前に確認する検証を提供する。
+	mux.HandleFunc("/api/config", s.Auth(s.GetConfig))
+	mux.HandleFunc("/api/config/servers", s.Auth(s.PatchServerConfig))
+	mux.HandleFunc("/api/config/users", s.Auth(s.PatchUserConfig))
+	mux.HandleFunc("/api/config/validate", s.Auth(s.ValidateConfig))
+
+	// MARK: > Admin API
+	// 障害調査のため、再起動や設定ファイルの編集なしにログの詳細度の変更と直近のログの参照をできるようにする。
+	mux.HandleFunc("/api/admin/loglevel", s.Auth(s.LogLevelHandler))
+	mux.HandleFunc("/api/admin/logs", s.Auth(s.LogsHandler))
+	// ログの転送先への送信が滞っていないかを確認できるようにする。
+	mux.HandleFunc("/api/admin/forwarder", s.Auth(s.ForwarderHandler))
+	mux.HandleFunc("/api/admin/prune", s.Auth(s.PruneHandler))
+	// 設定と実際のコンテナの差異 (存在しないサーバー・再作成が必要なコンテナ) を確認できるようにする。
+	mux.HandleFunc("/api/reconcile", s.Auth(s.ReconcileHandler))
+	// 設定ファイルを編集せずに、期限付きで権限を付与・取り消しできるようにする。
+	mux.HandleFunc("/api/admin/grants", s.Auth(s.GrantsHandler))
+
+	// MARK: > Server-Sent Events
+	// コンテナの状態遷移やジョブの進行状況を、ポーリングなしで UI へ即時反映させるために配信する。
+	mux.HandleFunc("/api/events", s.WSAuth("/api/events", s.EventsHandler))
 
 	// MARK: > WebSocket API
 	// ターミナルの入力同期やリソース使用率のリアルタイム配信のためにWebSocketを利用する。
-	mux.HandleFunc("/ws/terminal", s.Auth(s.TerminalHandler()))
-	mux.HandleFunc("/ws/stats", s.Auth(s.StatsHandler()))
+	// セッショントークンをクエリへ載せずに済むよう、端点とコンテナに限定した使い捨てのチケットで接続できる。
+	mux.HandleFunc("/api/ws-ticket", s.Auth(s.WSTicketHandler))
+	mux.HandleFunc("/ws/terminal", s.WSAuth("/ws/terminal", s.TerminalHandler()))
+	mux.HandleFunc("/ws/stats", s.WSAuth("/ws/stats", s.StatsHandler()))
+	mux.HandleFunc("/ws/overview", s.WSAuth("/ws/overview", s.OverviewHandler()))
+
+	// MARK: > Share links
+	// アカウントを持たない閲覧者へ、署名付きの期限付きリンクでログと統計情報のみを読み取り専用で公開する。
+	// Auth ミドルウェアは経由せず、各ハンドラーがリンクのトークン (?t=) を検証する。
+	mux.HandleFunc("/api/share", s.SharedInfo)
+	mux.HandleFunc("/ws/share/logs", s.SharedLogsHandler)
+	mux.HandleFunc("/ws/share/stats", s.SharedStatsHandler)
+
+	// MARK: > Public status
+	// public を設定したサーバーの状態を、コミュニティのウェブサイト等へ向けて認証なしで公開する。
+	mux.HandleFunc("/api/status", s.PublicStatus)
+	mux.HandleFunc("/status", s.StatusPage)
 
 	// MARK: > WebDAV integration
 	// /dav/ 配下へのアクセスを WebDAV ハンドラーへ委譲する。
@@ -67,24 +199,149 @@ func (s *Server) Routes() http.Handler {
 	mux.Handle("/dav/", ws.Handler())
 
 	// 全てのリクエストに対してアクセスログを出力する共通ラッパーを適用する。
-	return s.WithLogging(mux)
+	// エンドポイントごとの期限を設定し、低速な回線からの管理に備えて応答を圧縮し、別オリジンのフロントエンドからの利用に備えて CORS を処理する。
+	// /api/v1/ は同じハンドラーへ振り分けてエラーを JSON 形式で返し、ハンドラーの手前で流量を制限する。
+	return s.WithRequestID(s.WithTimeouts(s.WithLogging(s.WithCompression(s.WithCORS(s.WithAPIVersion(s.WithRateLimit(mux)))))))
 }
 
 // MARK: Start()
-// HTTPサーバーを起動し、リクエストの待機を開始する。
+// HTTPサーバーを起動し、リクエストの待機を開始する。Shutdown が呼ばれるまで戻らない。
 func (s *Server) Start() {
+	defer s.markReady()
 	addr := s.Config.Get().HTTPListen
 	if addr == "" {
 		// 待機アドレスが未設定の場合は、APIサービスを提供しない意図と判断し起動をスキップする。
 		logger.Log("Internal", "API", "HTTPサーバーは無効です（httpListenが未設定）")
 		return
 	}
-	logger.Logf("Internal", "API", "HTTPサーバーが開始されました: \"%s\"", addr)
 
 	// 指定されたアドレスでリスニングを開始。
 	// エラーが発生した場合は致命的なシステム障害（ポート競合等）と見なし、プロセスを停止させる。
-	if err := http.ListenAndServe(addr, s.Routes()); err != nil {
-		logger.Logf("Internal", "API", "HTTPサーバーが予期せず終了しました: %v", err)
+	listener, err := netutil.Listen(addr)
+	if err != nil {
+		logger.Errorf("Internal", "API", "HTTPサーバーが予期せず終了しました: %v", err)
+		panic(err)
+	}
+	// 本文の受信と応答の送信の期限はエンドポイントごとに WithTimeouts で設定するため、ここではヘッダーの受信と待機中の接続の期限のみを設ける。
+	srv := &http.Server{
+		Handler:           s.Routes(),
+		BaseContext:       func(net.Listener) context.Context { return s.baseCtx },
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+	// Shutdown は待機中の接続のみを閉じるため、長時間の接続（SSE・WebSocket）にはコンテキストのキャンセルで終了を伝える。
+	srv.RegisterOnShutdown(s.cancelBase)
+	s.httpMu.Lock()
+	s.httpServer = srv
+	s.httpAddr = listener.Addr().String()
+	s.httpMu.Unlock()
+	logger.Logf("Internal", "API", "HTTPサーバーが開始されました: \"%s\"", addr)
+	go s.uploads.cleanupLoop(s.baseCtx)
+	s.markReady()
+
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("Internal", "API", "HTTPサーバーが予期せず終了しました: %v", err)
 		panic(err)
 	}
 }
+
+// MARK: Ready()
+// HTTPサーバーが接続の受け付けを開始した (または無効である) 時点で閉じられるチャネルを返す。
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *Server) markReady() {
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
+// MARK: Shutdown()
+// 新しい接続の受け付けを停止し、処理中のリクエストの完了を ctx の期限まで待機する。終了後にセッションを保存する。
+func (s *Server) Shutdown(ctx context.Context) {
+	s.httpMu.Lock()
+	srv := s.httpServer
+	s.httpMu.Unlock()
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Logf("Internal", "API", "HTTPサーバーの停止を待機できませんでした: %v", err)
+			srv.Close()
+		}
+		logger.Log("Internal", "API", "HTTPサーバーを停止しました")
+	}
+	s.cancelBase()
+	s.shutdownGRPC(ctx)
+	s.saveSessions()
+}
+
+// MARK: HealthCheck()
+// 自身の待機アドレスへ /api/health を要求し、接続の受け付けからハンドラーの実行までが応答するかを確認する。
+// HTTPサーバーが無効な場合は設定を参照できることのみを確認する。
+func (s *Server) HealthCheck(ctx context.Context) error {
+	s.httpMu.Lock()
+	addr := s.httpAddr
+	s.httpMu.Unlock()
+	if addr == "" {
+		s.Config.Get()
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/api/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// MARK: Health()
+// 死活監視用の認証不要の端点。設定とジョブの状態を参照できる (ロックが解放されている) ことを確認して 200 を返す。
+func (s *Server) Health(w http.ResponseWriter, r *http.Request) {
+	s.Config.Get()
+	s.ContainerManager.Jobs.List()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// saveSessions はログイン中のセッションをファイルへ書き出す。
+func (s *Server) saveSessions() {
+	s.WebSessionMu.RLock()
+	b, err := json.MarshalIndent(s.WebSessions, "", "  ")
+	s.WebSessionMu.RUnlock()
+	if err != nil {
+		logger.Errorf("Internal", "API", "セッションのエンコードに失敗: %v", err)
+		return
+	}
+	// トークンはそれだけで認証に使えるため、所有者のみ読み取れる権限で保存する。
+	if err := fsutil.WriteFile(s.sessionsPath, b, 0o600); err != nil {
+		logger.Errorf("Internal", "API", "セッションの保存に失敗: %v", err)
+	}
+}
+
+// loadSessions は前回の終了時に保存したセッションを読み込む。設定から削除されたユーザーのセッションは破棄する。
+func (s *Server) loadSessions() {
+	b, err := os.ReadFile(s.sessionsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Internal", "API", "セッションの読み込みに失敗: %v", err)
+		}
+		return
+	}
+	var sessions map[string]string
+	if err := json.Unmarshal(b, &sessions); err != nil {
+		logger.Errorf("Internal", "API", "セッションのパースに失敗: %v", err)
+		return
+	}
+	users := s.Config.Get().Users
+	for token, username := range sessions {
+		if _, ok := users[username]; ok {
+			s.WebSessions[token] = username
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// defaultShareDuration は期間を指定せずに発行した共有リンクの有効期間。
+	defaultShareDuration = time.Hour
+	// maxShareDuration は共有リンクの最長の有効期間。アカウントなしで閲覧できるため、障害対応の間に限る想定とする。
+	maxShareDuration = 7 * 24 * time.Hour
+	// shareTailLines は共有リンクのログ表示で最初に送信する直近の行数。
+	shareTailLines = 500
+)
+
+var errInvalidShareToken = errors.New("invalid or expired share link")
+
+// MARK: shareClaims
+// 共有リンクのトークンに署名付きで埋め込む内容。サーバー側に一覧を持たず、署名と期限のみで検証する。
+type shareClaims struct {
+	Server    string `json:"s"`
+	User      string `json:"u"` // 発行したユーザー。権限を失った場合はリンクも無効とする
+	IssuedAt  int64  `json:"i"`
+	ExpiresAt int64  `json:"e"`
+	Nonce     string `json:"n"`
+}
+
+// MARK: shareLinks
+// 共有リンクの署名鍵と、サーバーごとの取り消し時刻を保持する。再起動後も発行済みのリンクを使えるよう、ファイルへ保存する。
+type shareLinks struct {
+	path string
+	mu   sync.RWMutex
+	// Key は HMAC-SHA256 の署名鍵 (16 進数)。
+	Key string `json:"key"`
+	// RevokedBefore はサーバーごとに、この時刻以前に発行したリンクを無効とする。
+	RevokedBefore map[string]time.Time `json:"revokedBefore,omitempty"`
+}
+
+// loadShareLinks は保存済みの署名鍵を読み込む。存在しない場合は新しい鍵を生成して保存する。
+func loadShareLinks(path string) *shareLinks {
+	l := &shareLinks{path: path, RevokedBefore: make(map[string]time.Time)}
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, l); err != nil {
+			logger.Errorf("Internal", "API", "共有リンクの鍵のパースに失敗 (新しい鍵を生成します): %v", err)
+			l.Key = ""
+		}
+	case !os.IsNotExist(err):
+		logger.Errorf("Internal", "API", "共有リンクの鍵の読み込みに失敗 (新しい鍵を生成します): %v", err)
+	}
+	if l.RevokedBefore == nil {
+		l.RevokedBefore = make(map[string]time.Time)
+	}
+	if _, err := hex.DecodeString(l.Key); err != nil || l.Key == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		l.Key = hex.EncodeToString(key)
+		l.save()
+	}
+	return l
+}
+
+// save は署名鍵と取り消し時刻をファイルへ書き出す。呼び出し側で mu を保持していること (読み込み時を除く)。
+func (l *shareLinks) save() {
+	// 鍵があればリンクを偽造できるため、所有者のみ読み取れる権限で保存する。
+	if err := fsutil.WriteJSON(l.path, l, 0o600); err != nil {
+		logger.Errorf("Internal", "API", "共有リンクの鍵の保存に失敗: %v", err)
+	}
+}
+
+func (l *shareLinks) sign(payload string) string {
+	key, _ := hex.DecodeString(l.Key)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue は server の出力を閲覧できるトークンを発行する。
+func (l *shareLinks) issue(server, user string, expiresAt time.Time) (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(shareClaims{
+		Server: server, User: user,
+		IssuedAt: time.Now().UnixMilli(), ExpiresAt: expiresAt.Unix(),
+		Nonce: hex.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return payload + "." + l.sign(payload), nil
+}
+
+// verify はトークンの署名・期限・取り消しを検証し、埋め込まれた内容を返す。
+func (l *shareLinks) verify(token string) (shareClaims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return shareClaims{}, errInvalidShareToken
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if !hmac.Equal([]byte(sig), []byte(l.sign(payload))) {
+		return shareClaims{}, errInvalidShareToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return shareClaims{}, errInvalidShareToken
+	}
+	var claims shareClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return shareClaims{}, errInvalidShareToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return shareClaims{}, errInvalidShareToken
+	}
+	if revoked, ok := l.RevokedBefore[claims.Server]; ok && claims.IssuedAt <= revoked.UnixMilli() {
+		return shareClaims{}, errInvalidShareToken
+	}
+	return claims, nil
+}
+
+// revoke は server に対して発行済みの共有リンクを全て無効にする。
+func (l *shareLinks) revoke(server string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.RevokedBefore[server] = now
+	// 最長の有効期間を過ぎた取り消しは判定に影響しないため、ファイルが肥大化しないよう削除する。
+	for name, t := range l.RevokedBefore {
+		if now.Sub(t) > maxShareDuration {
+			delete(l.RevokedBefore, name)
+		}
+	}
+	l.save()
+}
+
+// MARK: ShareLink
+// 発行した共有リンクの応答。
+type ShareLink struct {
+	Server    string    `json:"server"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"` // 閲覧用のページ (/share.html) への相対 URL
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// MARK: ShareHandler()
+// POST: {"duration"} で、アカウントなしでログと統計情報を閲覧できる期限付きのリンクを発行する。duration は "2h" 等の Go の形式 (既定 1 時間、最長 7 日)。
+// DELETE: 指定サーバーに対して発行済みのリンクを全て無効にする。
+// 障害対応の間、サーバーの管理者がプレイヤーへコンソールの様子を共有する等の用途に使用する。
+func (s *Server) ShareHandler(w http.ResponseWriter, r *http.Request) {
+	serverName := r.URL.Query().Get("id")
+	username := s.sessionUser(r)
+	if !s.Config.Get().Users[username].HasPermission(serverName, config.PermContainerShare) {
+		logger.For(r.Context()).Warnf("Client", "API", "共有リンクの操作拒否: user=%s, target=%s", username, serverName)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Share permission required", map[string]string{"permission": config.PermContainerShare, "server": serverName})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Duration string `json:"duration"`
+		}
+		// 本文を省略した場合は既定の期間で発行する。
+		if r.ContentLength != 0 {
+			if err := decodeJSON(w, r, &req); err != nil {
+				return
+			}
+		}
+		duration := defaultShareDuration
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 || d > maxShareDuration {
+				writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid duration", map[string]string{"duration": req.Duration, "max": maxShareDuration.String()})
+				return
+			}
+			duration = d
+		}
+		// 秒未満は切り捨てて埋め込むため、応答の期限も揃える。
+		expiresAt := time.Now().Add(duration).Truncate(time.Second)
+		token, err := s.shares.issue(serverName, username, expiresAt)
+		if err != nil {
+			logger.For(r.Context()).Errorf("Internal", "API", "共有リンクの発行に失敗: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		logger.For(r.Context()).Logf("Client", "API", "共有リンクを発行しました: user=%s, target=%s, expires=%s", username, serverName, expiresAt.Format(time.RFC3339))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ShareLink{
+			Server: serverName, Token: token, URL: "/share.html?t=" + token, ExpiresAt: expiresAt,
+		})
+
+	case http.MethodDelete:
+		s.shares.revoke(serverName)
+		logger.For(r.Context()).Logf("Client", "API", "共有リンクを全て無効にしました: user=%s, target=%s", username, serverName)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// MARK: shareTarget()
+// 共有リンクのトークン (?t=) を検証し、閲覧を許可するサーバー名を返す。
+// 発行したユーザーが削除された場合や権限を失った場合、サーバーが設定から削除された場合もリンクは無効とする。
+func (s *Server) shareTarget(w http.ResponseWriter, r *http.Request) (shareClaims, bool) {
+	claims, err := s.shares.verify(r.URL.Query().Get("t"))
+	if err == nil {
+		cfg := s.Config.Get()
+		user, ok := cfg.Users[claims.User]
+		if _, defined := cfg.Servers[claims.Server]; !ok || !defined ||
+			!user.HasPermission(claims.Server, config.PermContainerShare) {
+			err = errInvalidShareToken
+		}
+	}
+	if err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "無効な共有リンクによるアクセス: ip=%s, path=%s", clientIP(r), r.URL.Path)
+		writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthenticated, err.Error(), nil)
+		return shareClaims{}, false
+	}
+	return claims, true
+}
+
+// MARK: SharedInfo()
+// 共有リンクの対象サーバー名・期限と、コンテナの現在の状態を返す。認証は不要で、トークンのみで閲覧できる。
+func (s *Server) SharedInfo(w http.ResponseWriter, r *http.Request) {
+	claims, ok := s.shareTarget(w, r)
+	if !ok {
+		return
+	}
+	info := map[string]any{
+		"server":    claims.Server,
+		"expiresAt": time.Unix(claims.ExpiresAt, 0),
+		"status":    "missing",
+	}
+	if inspect, err := docker.Inspects.Inspect(r.Context(), claims.Server); err == nil && inspect.State != nil {
+		info["status"] = inspect.State.Status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// MARK: SharedLogsHandler()
+// 共有リンクから、コンテナの出力を読み取り専用で WebSocket へ配信する。入力は受け付けず、リンクの期限を迎えた時点で切断する。
+func (s *Server) SharedLogsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := s.shareTarget(w, r)
+	if !ok {
+		return
+	}
+	sub, err := docker.Console.Subscribe(claims.Server, shareTailLines)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "ログ取得失敗: container=%s, err=%v", claims.Server, err)
+		http.Error(w, "Failed to get logs", http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	upgraded, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "WebSocketアップグレード失敗: %v", err)
+		return
+	}
+	ctx, cancel := context.WithDeadline(r.Context(), time.Unix(claims.ExpiresAt, 0))
+	defer cancel()
+	ws := newWSConn(upgraded)
+	defer ws.Close()
+	defer ws.CloseOnDone(ctx)()
+	logger.For(r.Context()).Logf("Internal", "API", "共有リンクによるログの閲覧を開始しました: container=%s, by=%s, ip=%s", claims.Server, claims.User, clientIP(r))
+
+	// クライアントからの入力は破棄し、pong の処理と切断の検知のためにのみ読み込む。
+	go func() {
+		defer sub.Close()
+		defer ws.Close()
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	io.Copy(&wsBinaryWriter{ws}, sub)
+}
+
+// MARK: SharedStatsHandler()
+// 共有リンクから、コンテナの統計情報を /ws/stats と同じ形式で配信する。リンクの期限を迎えた時点で切断する。
+func (s *Server) SharedStatsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := s.shareTarget(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithDeadline(r.Context(), time.Unix(claims.ExpiresAt, 0))
+	defer cancel()
+	s.streamStats(w, r.WithContext(ctx), claims.Server)
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+	"github.com/play-bin/internal/query"
+	"github.com/play-bin/web"
+)
+
+// publicStatusTTL は公開ステータスの集計結果を再利用する期間。認証不要の端点のため、要求の度に Docker やゲームサーバーへ問い合わせない。
+// ブラウザや CDN にも同じ期間のキャッシュを許可する。
+const publicStatusTTL = 15 * time.Second
+
+// 公開ステータスで示すサーバーの状態。停止・未作成・到達不能等の内部の事情は区別せず offline とする。
+const (
+	publicOnline   = "online"
+	publicStarting = "starting" // 起動したが ready の判定条件をまだ満たしていない
+	publicOffline  = "offline"
+)
+
+// publicStatus は /api/status の応答。
+type publicStatus struct {
+	Servers   []publicServerStatus `json:"servers"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// publicServerStatus は公開するサーバー 1 件の状態。サーバー名・ホスト・アドレス等の内部の情報は含めない。
+type publicServerStatus struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	State       string    `json:"state"`
+	Players     *int      `json:"players,omitempty"` // query でプレイヤー数を取得できる場合のみ
+	MaxPlayers  *int      `json:"maxPlayers,omitempty"`
+	StartedAt   time.Time `json:"startedAt,omitzero"`
+	Uptime      int64     `json:"uptime,omitempty"` // 秒
+}
+
+// publicStatusCache は集計済みの公開ステータス。
+type publicStatusCache struct {
+	mu   sync.Mutex
+	at   time.Time
+	body []byte
+}
+
+// MARK: PublicStatus()
+// 認証不要の公開ステータス。public を設定したサーバーの状態・プレイヤー数・稼働時間を JSON で返す。
+// コミュニティのウェブサイトから読み込めるよう、資格情報を伴わない別オリジンからの参照を許可する。
+func (s *Server) PublicStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !publicStatusEnabled(s.Config.Get().Servers) {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := s.publicStatusBody(r.Context())
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(publicStatusTTL/time.Second)))
+	if h.Get("Access-Control-Allow-Origin") == "" {
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
+	w.Write(body)
+}
+
+// MARK: StatusPage()
+// 公開ステータスを表示するページ (/status)。iframe でウェブサイトへ埋め込めるよう、独立した 1 枚のページとする。
+// staticRoot を設定している場合も、埋め込みのページを配信する。
+func (s *Server) StatusPage(w http.ResponseWriter, r *http.Request) {
+	if !publicStatusEnabled(s.Config.Get().Servers) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(publicStatusTTL/time.Second)))
+	http.ServeFileFS(w, r, web.Assets, "status.html")
+}
+
+// publicStatusEnabled は public を設定したサーバーが 1 つ以上あるかを返す。無い場合はステータスページ自体を公開しない。
+func publicStatusEnabled(servers map[string]config.ServerConfig) bool {
+	for _, server := range servers {
+		if server.Public != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// publicStatusBody は集計済みの公開ステータスを返す。publicStatusTTL を過ぎている場合は集計し直す。
+// 集計中の要求は同じ結果を待つため、同時に多数の要求を受けても問い合わせは 1 回となる。
+func (s *Server) publicStatusBody(ctx context.Context) ([]byte, error) {
+	c := &s.publicStatus
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.body != nil && time.Since(c.at) < publicStatusTTL {
+		return c.body, nil
+	}
+	// 要求の切断で集計を打ち切らず、待っている他の要求にも結果を返す。
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), docker.CallTimeout)
+	defer cancel()
+	body, err := json.Marshal(s.collectPublicStatus(ctx))
+	if err != nil {
+		return nil, err
+	}
+	c.body, c.at = body, time.Now()
+	return body, nil
+}
+
+// collectPublicStatus は public を設定したサーバーの状態を表示名の順で集計する。
+func (s *Server) collectPublicStatus(ctx context.Context) publicStatus {
+	now := time.Now()
+	status := publicStatus{Servers: []publicServerStatus{}, UpdatedAt: now}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for serverName, serverCfg := range s.Config.Get().Servers {
+		if serverCfg.Public == nil {
+			continue
+		}
+		wg.Go(func() {
+			item := s.publicServerStatus(ctx, serverName, serverCfg, now)
+			mu.Lock()
+			status.Servers = append(status.Servers, item)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	slices.SortFunc(status.Servers, func(a, b publicServerStatus) int { return cmp.Compare(a.Name, b.Name) })
+	return status
+}
+
+// publicServerStatus はサーバー 1 件の公開する状態を求める。
+func (s *Server) publicServerStatus(ctx context.Context, serverName string, serverCfg config.ServerConfig, now time.Time) publicServerStatus {
+	item := publicServerStatus{
+		Name:        cmp.Or(serverCfg.Public.Name, serverName),
+		Description: serverCfg.Public.Description,
+		State:       publicOffline,
+	}
+	if pc := serverCfg.ProcessSettings(); pc != nil {
+		if st, err := process.Inspect(ctx, serverName, *pc); err == nil && st.Running() {
+			item.State, item.StartedAt = publicOnline, st.StartedAt
+		}
+	} else if inspect, err := docker.Inspects.Inspect(ctx, serverName); err == nil && inspect.State != nil && inspect.State.Running {
+		item.State = publicOnline
+		item.StartedAt, _ = time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	}
+	if item.State != publicOnline {
+		return item
+	}
+	if !item.StartedAt.IsZero() {
+		item.Uptime = int64(now.Sub(item.StartedAt).Seconds())
+	}
+	if s.ContainerManager.Readiness.Status(serverName).State == container.ReadyStarting {
+		item.State = publicStarting
+	}
+	if serverCfg.Query != nil {
+		if result, err := query.Cached(ctx, serverName, *serverCfg.Query); err == nil && result.Online && result.Supported {
+			item.Players, item.MaxPlayers = &result.Players, &result.MaxPlayers
+		}
+	}
+	return item
+}
@@ -0,0 +1,549 @@
+package api
+
+import (
+	"archive/tar"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/vfs"
+)
+
+const (
+	// syncPlanExpiry は同期の計画を作成してから、差分の送信を受け付ける期間。
+	syncPlanExpiry = time.Hour
+	// syncStagingPrefix は差分の受信と置き換え前のファイルの退避に使う一時ディレクトリの名前の接頭辞。
+	// 同じファイルシステム上で rename できるよう、同期先のディレクトリの直下に作成する。
+	syncStagingPrefix = ".playbin-sync-"
+)
+
+// MARK: syncEntry
+// マニフェストの 1 ファイル分。Path は同期先のディレクトリからの相対パス ("/" 区切り)。
+type syncEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// fileState は計画の作成時のファイルの状態。差分の適用までに変更されていないことの確認に使う。
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// MARK: syncPlan
+// 同期の計画。送信を求めるファイルと削除するファイルを保持し、差分の tar を受信した時点でまとめて適用する。
+type syncPlan struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`      // 同期先のディレクトリの仮想パス ("<サーバー名>/<マウント先>/...")
+	Upload    []string  `json:"upload"`    // 送信が必要なファイル (追加・変更)
+	Delete    []string  `json:"delete"`    // 削除するファイル (delete を指定した場合のみ)
+	Unchanged int       `json:"unchanged"` // 内容が一致したファイルの数
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	user    string
+	server  string
+	root    string               // 同期先のディレクトリのホスト上のパス
+	entries map[string]syncEntry // 送信が必要なファイルのマニフェスト
+	states  map[string]fileState // 計画の作成時の対象のファイルの状態
+	busy    bool                 // 差分の適用中
+}
+
+// MARK: syncPlans
+// 作成済みの同期の計画。計画は短時間で使い切るため、保存はせずメモリ上にのみ保持する。
+type syncPlans struct {
+	mu    sync.Mutex
+	items map[string]*syncPlan
+}
+
+func newSyncPlans() *syncPlans {
+	return &syncPlans{items: make(map[string]*syncPlan)}
+}
+
+// add は計画を追加し、期限を過ぎた計画を破棄する。同じディレクトリへの適用中の計画がある場合は追加しない。
+func (p *syncPlans) add(plan *syncPlan) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for id, item := range p.items {
+		if item.busy && item.root == plan.root {
+			return false
+		}
+		if !item.busy && now.After(item.ExpiresAt) {
+			delete(p.items, id)
+		}
+	}
+	p.items[plan.ID] = plan
+	return true
+}
+
+// acquire はユーザーが作成した期限内の計画を適用中とし、返す。
+func (p *syncPlans) acquire(id, user string) (*syncPlan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan, ok := p.items[id]
+	if !ok || plan.user != user || time.Now().After(plan.ExpiresAt) {
+		return nil, os.ErrNotExist
+	}
+	for _, item := range p.items {
+		if item.busy && item.root == plan.root {
+			return nil, errSyncBusy
+		}
+	}
+	plan.busy = true
+	return plan, nil
+}
+
+// errSyncBusy は同じディレクトリへの差分の適用が進行中であることを表す。
+var errSyncBusy = errors.New("sync in progress")
+
+// errSyncChanged は計画の作成後に対象のファイルが変更されたことを表す。
+var errSyncChanged = errors.New("files changed since the plan")
+
+// MARK: SyncHandler()
+// CI 等から Modpack 等のディレクトリを配置するための、rsync のような差分の同期。
+// POST: {"path", "files": [{"path", "sha256", "size"}], "delete", "exclude"} のマニフェストと同期先の内容を比較し、送信が必要なファイルと削除するファイルを返す。
+// PUT ?sync=: 送信が必要なファイルを tar で受信し、全てを検証してから追加・変更・削除をまとめて適用する。途中で失敗した場合は元に戻す。
+// DELETE ?sync=: 計画を破棄する。
+func (s *Server) SyncHandler(w http.ResponseWriter, r *http.Request) {
+	username := s.sessionUser(r)
+	switch r.Method {
+	case http.MethodPost:
+		s.planSync(w, r, username)
+	case http.MethodPut:
+		s.applySync(w, r, username)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("sync")
+		s.syncs.mu.Lock()
+		plan, ok := s.syncs.items[id]
+		if ok && plan.user == username && !plan.busy {
+			delete(s.syncs.items, id)
+		}
+		s.syncs.mu.Unlock()
+		if !ok || plan.user != username {
+			writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Sync plan not found", map[string]string{"sync": id})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method Not Allowed", nil)
+	}
+}
+
+// planSync はマニフェストと同期先のディレクトリの内容を SHA-256 で比較し、計画を作成する。
+func (s *Server) planSync(w http.ResponseWriter, r *http.Request, username string) {
+	var req struct {
+		Path    string      `json:"path"`
+		Files   []syncEntry `json:"files"`
+		Delete  bool        `json:"delete"`
+		Exclude []string    `json:"exclude"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		return
+	}
+	req.Path = strings.Trim(path.Clean("/"+req.Path), "/")
+	for _, pattern := range req.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid exclude pattern", map[string]string{"exclude": pattern})
+			return
+		}
+	}
+	entries := make(map[string]syncEntry, len(req.Files))
+	for _, f := range req.Files {
+		rel, ok := cleanSyncPath(f.Path)
+		b, err := hex.DecodeString(f.SHA256)
+		if !ok || err != nil || len(b) != sha256.Size || f.Size < 0 {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid manifest entry", map[string]string{"path": f.Path})
+			return
+		}
+		if syncExcluded(req.Exclude, rel) {
+			continue
+		}
+		f.Path, f.SHA256 = rel, strings.ToLower(f.SHA256)
+		entries[rel] = f
+	}
+
+	serverName, _, _ := strings.Cut(req.Path, "/")
+	h := &vfs.Handler{Username: username, Config: s.Config}
+	if !h.CanWrite(req.Path) {
+		logger.For(r.Context()).Warnf("Client", "API", "同期拒否: user=%s, path=%s", username, req.Path)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Permission required", map[string]string{"permission": config.PermFileWrite, "server": serverName, "path": req.Path})
+		return
+	}
+	root, err := h.MapPath("/" + req.Path)
+	switch {
+	case errors.Is(err, vfs.ErrVfsRoot), errors.Is(err, vfs.ErrVfsContainerRoot):
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "path must be a directory under a mount", nil)
+		return
+	case errors.Is(err, os.ErrPermission):
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Permission denied", map[string]string{"path": req.Path})
+		return
+	case err != nil:
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Path not found", map[string]string{"path": req.Path})
+		return
+	}
+	if root, err = filepath.EvalSymlinks(root); err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(root); err == nil && !info.IsDir() {
+			err = os.ErrInvalid
+		}
+	}
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Directory not found", map[string]string{"path": req.Path})
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", nil)
+		return
+	}
+	plan := &syncPlan{
+		ID: hex.EncodeToString(b), Path: req.Path, Upload: []string{}, Delete: []string{}, ExpiresAt: time.Now().Add(syncPlanExpiry),
+		user: username, server: serverName, root: root,
+		entries: make(map[string]syncEntry), states: make(map[string]fileState),
+	}
+	local, err := scanSyncDir(root, req.Exclude)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "同期先の走査に失敗: path=%s, err=%v", req.Path, err)
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to scan the directory", nil)
+		return
+	}
+	for rel, entry := range entries {
+		state, exists := local[rel]
+		plan.states[rel] = state
+		if exists && state.size == entry.Size {
+			if sum, err := fileSHA256(filepath.Join(root, filepath.FromSlash(rel))); err == nil && sum == entry.SHA256 {
+				plan.Unchanged++
+				continue
+			}
+		}
+		if _, err := syncTarget(root, rel); err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Manifest path conflicts with the directory", map[string]string{"path": rel})
+			return
+		}
+		plan.Upload = append(plan.Upload, rel)
+		plan.entries[rel] = entry
+	}
+	if req.Delete {
+		for rel, state := range local {
+			if _, ok := entries[rel]; !ok {
+				plan.Delete = append(plan.Delete, rel)
+				plan.states[rel] = state
+			}
+		}
+	}
+	slices.Sort(plan.Upload)
+	slices.Sort(plan.Delete)
+
+	if !s.syncs.add(plan) {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "Another sync to the directory is in progress", map[string]string{"path": req.Path})
+		return
+	}
+	logger.For(r.Context()).Logf("Client", "API", "同期を計画しました: user=%s, path=%s, upload=%d, delete=%d, unchanged=%d", username, req.Path, len(plan.Upload), len(plan.Delete), plan.Unchanged)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// applySync は差分の tar を受信して検証し、追加・変更・削除をまとめて適用する。
+func (s *Server) applySync(w http.ResponseWriter, r *http.Request, username string) {
+	id := r.URL.Query().Get("sync")
+	plan, err := s.syncs.acquire(id, username)
+	if errors.Is(err, errSyncBusy) {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "Another sync to the directory is in progress", map[string]string{"sync": id})
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Sync plan not found", map[string]string{"sync": id})
+		return
+	}
+	// 計画は成否に関わらず使い切る。失敗した場合は改めて計画を作成させる。
+	defer func() {
+		s.syncs.mu.Lock()
+		delete(s.syncs.items, id)
+		s.syncs.mu.Unlock()
+	}()
+
+	// 作成後に権限を失ったユーザーからの適用は拒否する。
+	h := &vfs.Handler{Username: username, Config: s.Config}
+	if !h.CanWrite(plan.Path) {
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Permission required", map[string]string{"permission": config.PermFileWrite, "server": plan.server, "path": plan.Path})
+		return
+	}
+	if changed := plan.changedFiles(); len(changed) > 0 {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, errSyncChanged.Error(), map[string][]string{"files": changed})
+		return
+	}
+
+	staging, err := os.MkdirTemp(plan.root, syncStagingPrefix)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "同期の一時ディレクトリの作成に失敗: path=%s, err=%v", plan.Path, err)
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", nil)
+		return
+	}
+	defer os.RemoveAll(staging)
+
+	received, err := receiveSyncFiles(r.Body, plan, staging)
+	if err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "同期の差分を受理できません: user=%s, path=%s, err=%v", username, plan.Path, err)
+		writeError(w, r, http.StatusUnprocessableEntity, ErrCodeUnprocessable, "Sync rejected: "+err.Error(), map[string]string{"path": plan.Path})
+		return
+	}
+	for _, rel := range plan.Upload {
+		if err := h.ValidateUpload("/"+path.Join(plan.Path, rel), received[rel]); err != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, ErrCodeUnprocessable, "Sync rejected: "+err.Error(), map[string]string{"path": rel})
+			return
+		}
+	}
+
+	if err := plan.apply(h, staging, received); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "同期の適用に失敗したため元に戻しました: user=%s, path=%s, err=%v", username, plan.Path, err)
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to apply the sync: "+err.Error(), map[string]string{"path": plan.Path})
+		return
+	}
+	logger.For(r.Context()).Logf("Client", "API", "同期を適用しました: user=%s, path=%s, updated=%d, deleted=%d", username, plan.Path, len(plan.Upload), len(plan.Delete))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id": plan.ID, "path": plan.Path, "updated": plan.Upload, "deleted": plan.Delete, "unchanged": plan.Unchanged,
+	})
+}
+
+// changedFiles は計画の作成後に大きさ・更新時刻・有無が変わったファイルを返す。
+func (p *syncPlan) changedFiles() []string {
+	var changed []string
+	for rel, before := range p.states {
+		var now fileState
+		if info, err := os.Lstat(filepath.Join(p.root, filepath.FromSlash(rel))); err == nil {
+			now = fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+		}
+		if now.exists != before.exists || now.size != before.size || !now.modTime.Equal(before.modTime) {
+			changed = append(changed, rel)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// receiveSyncFiles は tar から計画で送信を求めたファイルのみを一時ディレクトリへ受信し、SHA-256 を照合する。
+// 過不足がある場合や計画に無いファイルを含む場合は拒否する。戻り値は相対パスから受信したファイルのパスへの対応。
+func receiveSyncFiles(body io.Reader, plan *syncPlan, staging string) (map[string]string, error) {
+	received := make(map[string]string, len(plan.Upload))
+	tr := tar.NewReader(body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		rel, _ := cleanSyncPath(hdr.Name)
+		entry, ok := plan.entries[rel]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+		if _, dup := received[rel]; dup {
+			return nil, fmt.Errorf("duplicate entry %s", rel)
+		}
+		tmp := filepath.Join(staging, fmt.Sprintf("new-%d", len(received)))
+		f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(io.MultiWriter(f, hash), tr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != entry.SHA256 || hdr.Size != entry.Size {
+			return nil, fmt.Errorf("checksum mismatch for %s", rel)
+		}
+		received[rel] = tmp
+	}
+	for _, rel := range plan.Upload {
+		if _, ok := received[rel]; !ok {
+			return nil, fmt.Errorf("missing file %s", rel)
+		}
+	}
+	return received, nil
+}
+
+// apply は削除と置き換えを行う。置き換え前・削除するファイルは一時ディレクトリへ退避し、途中で失敗した場合は退避したファイルを戻す。
+func (p *syncPlan) apply(h *vfs.Handler, staging string, received map[string]string) error {
+	type change struct {
+		target string
+		backup string // 退避した元のファイル (新規作成の場合は空)
+		added  bool   // target に受信したファイルを置いたか
+	}
+	var changes []change
+	rollback := func() {
+		for _, c := range slices.Backward(changes) {
+			if c.added {
+				os.Remove(c.target)
+			}
+			if c.backup != "" {
+				os.Rename(c.backup, c.target)
+			}
+		}
+	}
+	backupPath := func() string { return filepath.Join(staging, fmt.Sprintf("old-%d", len(changes))) }
+
+	for _, rel := range p.Delete {
+		target, err := syncTarget(p.root, rel)
+		if err != nil {
+			rollback()
+			return err
+		}
+		backup := backupPath()
+		if err := os.Rename(target, backup); err != nil {
+			rollback()
+			return err
+		}
+		changes = append(changes, change{target: target, backup: backup})
+	}
+	for _, rel := range p.Upload {
+		target, err := syncTarget(p.root, rel)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(target), 0o755)
+		}
+		if err == nil {
+			_, err = h.PrepareReplace("/"+path.Join(p.Path, rel), received[rel], target)
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+		c := change{target: target}
+		if _, err := os.Lstat(target); err == nil {
+			c.backup = backupPath()
+			if err := os.Rename(target, c.backup); err != nil {
+				rollback()
+				return err
+			}
+		}
+		if err := os.Rename(received[rel], target); err != nil {
+			changes = append(changes, c)
+			rollback()
+			return err
+		}
+		c.added = true
+		changes = append(changes, c)
+	}
+
+	// 削除によって空になったディレクトリを、同期先のディレクトリの直下まで遡って削除する。
+	for _, rel := range p.Delete {
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if os.Remove(filepath.Join(p.root, filepath.FromSlash(dir))) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// scanSyncDir は同期先のディレクトリの通常のファイルの状態を相対パスで返す。
+// 除外したパス・シンボリックリンク・play-bin の一時ファイルは比較と削除の対象にしない。
+func scanSyncDir(root string, exclude []string) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		name := d.Name()
+		if syncExcluded(exclude, rel) || strings.HasPrefix(name, syncStagingPrefix) || strings.HasPrefix(name, vfs.StagingPrefix) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// syncTarget は相対パスをホスト上のパスへ変換する。途中の階層がシンボリックリンクやファイルの場合は、同期先の外へ書き込まないよう拒否する。
+func syncTarget(root, rel string) (string, error) {
+	parts := strings.Split(rel, "/")
+	dir := root
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("%s is not a directory", rel)
+		}
+	}
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", rel)
+	}
+	return target, nil
+}
+
+// cleanSyncPath はマニフェストと tar の相対パスを正規化する。同期先の外を指すパスと play-bin の一時ファイルの名前は受け付けない。
+func cleanSyncPath(p string) (string, bool) {
+	rel := path.Clean(strings.TrimPrefix(p, "./"))
+	if rel == "." || rel == ".." || path.IsAbs(rel) || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, syncStagingPrefix) || strings.HasPrefix(part, vfs.StagingPrefix) {
+			return "", false
+		}
+	}
+	return rel, true
+}
+
+// syncExcluded は相対パスが exclude のいずれかに一致するかを返す。"/" を含まないパターンはファイル名 (ディレクトリ名) と照合する。
+func syncExcluded(exclude []string, rel string) bool {
+	for _, pattern := range exclude {
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// serverReadHeaderTimeout はリクエストヘッダーの受信を待つ時間。ヘッダーを送り切らない接続がゴルーチンを占有し続けないようにする。
+	serverReadHeaderTimeout = 10 * time.Second
+	// serverIdleTimeout は keep-alive の接続で次のリクエストを待つ時間。
+	serverIdleTimeout = 2 * time.Minute
+
+	// maxJSONBodySize は JSON の本文として受け付ける上限。
+	maxJSONBodySize = 1 << 20
+	// longOperationTimeout はバックアップ・リストア等、ハンドラー自身が期限を管理する長時間の操作に許容する応答までの時間。
+	longOperationTimeout = 31 * time.Minute
+)
+
+// MARK: endpointLimits
+// エンドポイントごとの期限。0 は期限なしを表す。
+type endpointLimits struct {
+	handler time.Duration // ハンドラーのコンテキストの期限。Docker デーモンが応答しない場合に呼び出しを打ち切る
+	read    time.Duration // 本文の受信期限
+	write   time.Duration // 応答の送信期限 (処理時間を含む)
+}
+
+// defaultEndpointLimits は endpointLimitTable に無いエンドポイントの期限。
+var defaultEndpointLimits = endpointLimits{handler: 30 * time.Second, read: 30 * time.Second, write: time.Minute}
+
+// longOperationLimits は長時間の操作の期限。処理自体の期限はハンドラーがリクエストから切り離したコンテキストで設定する。
+var longOperationLimits = endpointLimits{read: 30 * time.Second, write: longOperationTimeout}
+
+// endpointLimitTable は既定と異なる期限を持つエンドポイント。パスは /api/v1/ を /api/ に読み替えて照合する。
+var endpointLimitTable = map[string]endpointLimits{
+	"/api/container/start":   longOperationLimits,
+	"/api/container/stop":    longOperationLimits,
+	"/api/container/kill":    longOperationLimits,
+	"/api/container/backup":  longOperationLimits,
+	"/api/container/restore": longOperationLimits,
+	"/api/container/remove":  longOperationLimits,
+	// 移行はデータの転送を含むため、応答まで長時間を要する。
+	"/api/container/migrate": {read: 30 * time.Second, write: 6*time.Hour + time.Minute},
+	// ワールドのインポートは大きなアーカイブを受信するため、本文の受信にも長い期限を設ける。
+	"/api/container/worlds": {read: longOperationTimeout, write: longOperationTimeout},
+	// 再開可能なアップロードは大きな断片を受信し、完了時にファイル全体のチェックサムを計算するため、受信・送信ともに長い期限を設ける。
+	"/api/files/upload": {read: longOperationTimeout, write: longOperationTimeout},
+	// 同期は計画の作成時に同期先の全てのファイルのハッシュを計算し、適用時に差分の tar を受信する。
+	"/api/files/sync": {read: longOperationTimeout, write: longOperationTimeout},
+	// スナップショットのダウンロードはイメージ全体を送信するため、送信にも長い期限を設ける。
+	"/api/container/snapshots": longOperationLimits,
+	"/api/container/mods":      {handler: 10 * time.Minute, read: 30 * time.Second, write: 11 * time.Minute},
+	// Exec はリクエストで指定されたタイムアウト (最大 maxExecTimeout) をハンドラーが適用する。
+	"/api/container/exec": {read: 30 * time.Second, write: maxExecTimeout + time.Minute},
+	// コンテナ内のディレクトリは大きなアーカイブとなる場合があり、受信・送信ともに長い期限を設ける。
+	"/api/container/cp": {read: longOperationTimeout, write: longOperationTimeout},
+	// 準備状態の問い合わせは wait (最大 maxReadyWait) の間、応答を保留する。
+	"/api/container/ready": {read: 30 * time.Second, write: maxReadyWait + time.Minute},
+	// 録画は大きなファイルとなる場合があり、低速な回線でも送信し切れるようにする。
+	"/api/container/recording": {handler: 30 * time.Second, read: 30 * time.Second, write: 30 * time.Minute},
+	// ログのダウンロードは Docker から読み出しながら送信するため、ハンドラーにも同じ期限を設ける。
+	"/api/container/logs": {handler: 30 * time.Minute, read: 30 * time.Second, write: 30 * time.Minute},
+	// 保存済みのログは複数のファイルを検索・送信するため、録画と同様に長い期限を設ける。
+	"/api/container/archive": {handler: 30 * time.Minute, read: 30 * time.Second, write: 30 * time.Minute},
+	// 全文検索は保存済みの全てのファイルと Docker のログを走査する。
+	"/api/container/logs/search": {handler: 10 * time.Minute, read: 30 * time.Second, write: 11 * time.Minute},
+	"/api/images/pull":           {handler: 30 * time.Minute, read: 30 * time.Second, write: longOperationTimeout},
+	"/api/admin/prune":           {handler: 10 * time.Minute, read: 30 * time.Second, write: 11 * time.Minute},
+	"/api/images/prune":          {handler: 10 * time.Minute, read: 30 * time.Second, write: 11 * time.Minute},
+	// 照合は全ての Docker ホストへ問い合わせる。
+	"/api/reconcile": {handler: 2 * time.Minute, read: 30 * time.Second, write: 3 * time.Minute},
+	// SSE は接続を維持し続けるため、期限を設けない。
+	"/api/events": {},
+}
+
+// limitsFor はパスに適用する期限を返す。WebSocket は接続を引き継ぎ、WebDAV は大きなファイルを転送するため期限を設けない。
+func limitsFor(path string) endpointLimits {
+	if strings.HasPrefix(path, "/ws/") || strings.HasPrefix(path, "/dav/") {
+		return endpointLimits{}
+	}
+	if rest, ok := strings.CutPrefix(path, apiV1Prefix); ok {
+		path = "/api/" + rest
+	}
+	if l, ok := endpointLimitTable[path]; ok {
+		return l
+	}
+	return defaultEndpointLimits
+}
+
+// MARK: WithTimeouts()
+// エンドポイントごとに本文の受信・応答の送信の期限と、ハンドラーのコンテキストの期限を設定する。
+// 応答しない Docker デーモンや送受信の滞った接続によって、ゴルーチンが際限なく積み上がらないようにする。
+func (s *Server) WithTimeouts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := limitsFor(r.URL.Path)
+		rc := http.NewResponseController(w)
+		now := time.Now()
+		if limits.read > 0 {
+			rc.SetReadDeadline(now.Add(limits.read))
+		}
+		if limits.write > 0 {
+			rc.SetWriteDeadline(now.Add(limits.write))
+			// keep-alive で同じ接続を使う次のリクエストに期限を持ち越さないよう、完了後に解除する。
+			defer rc.SetWriteDeadline(time.Time{})
+		}
+		if limits.handler > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), limits.handler)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MARK: decodeJSON()
+// 本文を maxJSONBodySize までに制限して JSON として読み込む。失敗した場合はエラーを応答した上で、そのエラーを返す。
+// 上限を超えた場合は 413、形式が不正な場合は 400 とする。
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if err == nil {
+		return nil
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body too large", map[string]int64{"limit": tooLarge.Limit})
+	} else {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Invalid request format", nil)
+	}
+	return err
+}
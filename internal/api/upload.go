@@ -0,0 +1,427 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/vfs"
+)
+
+const (
+	// uploadExpiry は再開可能なアップロードを、最後にデータを受信してから破棄するまでの期間。
+	uploadExpiry = 24 * time.Hour
+	// uploadCleanupInterval は放棄されたアップロードを破棄する間隔。
+	uploadCleanupInterval = time.Hour
+	// uploadOffsetHeader は受信済みのバイト数を示すヘッダー (tus と同じ名前)。PATCH では送信する断片の開始位置を示す。
+	uploadOffsetHeader = "Upload-Offset"
+)
+
+// MARK: resumableUpload
+// 再開可能なアップロード 1 件。受信中のデータは置き換え先と同じディレクトリの一時ファイル (vfs.PartPath) に追記する。
+type resumableUpload struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Server    string    `json:"server"`
+	Path      string    `json:"path"`             // 置き換え先の仮想パス ("<サーバー名>/<マウント先>/...")
+	Size      int64     `json:"size"`             // ファイル全体のバイト数
+	Offset    int64     `json:"offset"`           // 受信済みのバイト数
+	SHA256    string    `json:"sha256,omitempty"` // 完了時に照合するファイル全体の SHA-256 (16 進数)
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"` // 最後にデータを受信した時刻
+
+	target string // 置き換え先のホスト上のパス
+	part   string // 受信中のデータのホスト上のパス
+	busy   bool   // 断片の受信中。同じアップロードへの並行した書き込みを拒否する
+}
+
+// uploadRecord は再起動後も再開できるよう保存する内容。ホスト上のパスを含むため、API の応答とは分ける。
+type uploadRecord struct {
+	resumableUpload
+	Target string `json:"target"`
+	Part   string `json:"part"`
+}
+
+// uploadStatus は API の応答。
+type uploadStatus struct {
+	resumableUpload
+	Complete  bool      `json:"complete"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+func (u *resumableUpload) status() uploadStatus {
+	st := uploadStatus{resumableUpload: *u, Complete: u.Offset >= u.Size}
+	if !st.Complete {
+		st.ExpiresAt = u.UpdatedAt.Add(uploadExpiry)
+	}
+	return st
+}
+
+// MARK: uploads
+// 受信中の再開可能なアップロードを保持し、変更の都度ファイルへ書き出す。
+type uploads struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]*resumableUpload
+}
+
+// loadUploads は前回までの受信中のアップロードを読み込む。受信中のファイルが失われたものは破棄し、受信済みのバイト数はファイルの大きさに合わせる。
+func loadUploads(path string) *uploads {
+	u := &uploads{path: path, items: make(map[string]*resumableUpload)}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Internal", "API", "アップロードの状態の読み込みに失敗: %v", err)
+		}
+		return u
+	}
+	var records []uploadRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		logger.Errorf("Internal", "API", "アップロードの状態のパースに失敗: %v", err)
+		return u
+	}
+	for _, rec := range records {
+		info, err := os.Stat(rec.Part)
+		if err != nil {
+			continue
+		}
+		item := rec.resumableUpload
+		item.target, item.part = rec.Target, rec.Part
+		item.Offset = min(info.Size(), item.Size)
+		u.items[item.ID] = &item
+	}
+	return u
+}
+
+// save は受信中のアップロードをファイルへ書き出す。呼び出し側で mu を保持していること。
+func (u *uploads) save() {
+	records := make([]uploadRecord, 0, len(u.items))
+	for _, item := range u.items {
+		records = append(records, uploadRecord{resumableUpload: *item, Target: item.target, Part: item.part})
+	}
+	if err := fsutil.WriteJSON(u.path, records, 0o600); err != nil {
+		logger.Errorf("Internal", "API", "アップロードの状態の保存に失敗: %v", err)
+	}
+}
+
+// get はユーザーが作成したアップロードを返す。他のユーザーのアップロードは存在しないものとして扱う。
+func (u *uploads) get(id, user string) (uploadStatus, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	item, ok := u.items[id]
+	if !ok || item.User != user {
+		return uploadStatus{}, false
+	}
+	return item.status(), true
+}
+
+// remove はアップロードを破棄し、受信中のファイルを削除する。
+func (u *uploads) remove(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if item, ok := u.items[id]; ok {
+		os.Remove(item.part)
+		delete(u.items, id)
+		u.save()
+	}
+}
+
+// MARK: cleanupLoop()
+// 最後の受信から uploadExpiry を過ぎたアップロードを uploadCleanupInterval ごとに破棄する。ctx のキャンセルで終了する。
+func (u *uploads) cleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(uploadCleanupInterval)
+	defer ticker.Stop()
+	for {
+		u.cleanup(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (u *uploads) cleanup(now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	changed := false
+	for id, item := range u.items {
+		if item.busy || now.Sub(item.UpdatedAt) < uploadExpiry {
+			continue
+		}
+		os.Remove(item.part)
+		delete(u.items, id)
+		changed = true
+		logger.Logf("Internal", "API", "放棄されたアップロードを破棄しました: id=%s, user=%s, path=%s, received=%d/%d", id, item.User, item.Path, item.Offset, item.Size)
+	}
+	if changed {
+		u.save()
+	}
+}
+
+// MARK: UploadHandler()
+// 大きなファイルを断片に分けて送信し、回線が切れても続きから再開できるアップロード。置き換え先は WebDAV と同じ仮想パスで指定する。
+// POST: {"path", "size", "sha256"} でアップロードを作成する。GET / HEAD ?upload=: 受信済みのバイト数を返す。
+// PATCH ?upload=: Upload-Offset ヘッダーの位置からの断片を本文で受信する。全体を受信した時点で照合・検証してから置き換える。
+// DELETE ?upload=: アップロードを中止する。
+func (s *Server) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	username := s.sessionUser(r)
+	id := r.URL.Query().Get("upload")
+	if r.Method == http.MethodPost {
+		s.createUpload(w, r, username)
+		return
+	}
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "upload is required", nil)
+		return
+	}
+	st, ok := s.uploads.get(id, username)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Upload not found", map[string]string{"upload": id})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeUploadStatus(w, http.StatusOK, st)
+	case http.MethodPatch:
+		s.receiveChunk(w, r, username, id)
+	case http.MethodDelete:
+		s.uploads.remove(id)
+		logger.For(r.Context()).Logf("Client", "API", "アップロードを中止しました: user=%s, path=%s, received=%d/%d", username, st.Path, st.Offset, st.Size)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method Not Allowed", nil)
+	}
+}
+
+// createUpload は置き換え先を解決し、空の受信中のファイルを作成する。
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request, username string) {
+	var req struct {
+		Path   string `json:"path"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		return
+	}
+	req.Path = strings.Trim(path.Clean("/"+req.Path), "/")
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if req.Size < 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "size must not be negative", nil)
+		return
+	}
+	if b, err := hex.DecodeString(req.SHA256); req.SHA256 != "" && (err != nil || len(b) != sha256.Size) {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "sha256 must be a hex-encoded SHA-256 digest", nil)
+		return
+	}
+
+	serverName, _, _ := strings.Cut(req.Path, "/")
+	h := &vfs.Handler{Username: username, Config: s.Config}
+	if !h.CanWrite(req.Path) {
+		logger.For(r.Context()).Warnf("Client", "API", "アップロード拒否: user=%s, path=%s", username, req.Path)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Permission required", map[string]string{"permission": config.PermFileWrite, "server": serverName, "path": req.Path})
+		return
+	}
+	target, err := h.MapPath("/" + req.Path)
+	switch {
+	case errors.Is(err, vfs.ErrVfsRoot), errors.Is(err, vfs.ErrVfsContainerRoot):
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "path must be a file under a mount", nil)
+		return
+	case errors.Is(err, os.ErrPermission):
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Permission denied", map[string]string{"path": req.Path})
+		return
+	case err != nil:
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Path not found", map[string]string{"path": req.Path})
+		return
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "path is a directory", map[string]string{"path": req.Path})
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", nil)
+		return
+	}
+	now := time.Now()
+	item := &resumableUpload{
+		ID: hex.EncodeToString(b), User: username, Server: serverName, Path: req.Path,
+		Size: req.Size, SHA256: req.SHA256, CreatedAt: now, UpdatedAt: now,
+		target: target,
+	}
+	item.part = vfs.PartPath(target, item.ID)
+	f, err := os.OpenFile(item.part, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		// 親ディレクトリが存在しない場合等。
+		logger.For(r.Context()).Errorf("Internal", "API", "アップロードの一時ファイルの作成に失敗: path=%s, err=%v", req.Path, err)
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Parent directory not found", map[string]string{"path": req.Path})
+		return
+	}
+	f.Close()
+
+	s.uploads.mu.Lock()
+	s.uploads.items[item.ID] = item
+	s.uploads.save()
+	s.uploads.mu.Unlock()
+	logger.For(r.Context()).Logf("Client", "API", "アップロードを開始しました: user=%s, path=%s, size=%d", username, req.Path, req.Size)
+
+	if item.Size == 0 {
+		// 受信するデータが無いため、その場で照合・置き換えを行う。
+		s.completeUpload(w, r, item.ID)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/files/upload?upload="+item.ID)
+	writeUploadStatus(w, http.StatusCreated, item.status())
+}
+
+// receiveChunk は Upload-Offset の位置からの断片を受信中のファイルへ書き込む。
+// 受信の途中で切断された場合も、書き込めた分は受信済みとし、続きは GET で得た位置から再送させる。
+func (s *Server) receiveChunk(w http.ResponseWriter, r *http.Request, username, id string) {
+	offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, uploadOffsetHeader+" header is required", nil)
+		return
+	}
+
+	s.uploads.mu.Lock()
+	item, ok := s.uploads.items[id]
+	if !ok {
+		s.uploads.mu.Unlock()
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Upload not found", map[string]string{"upload": id})
+		return
+	}
+	if item.busy || offset != item.Offset {
+		current := item.Offset
+		s.uploads.mu.Unlock()
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(current, 10))
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "Offset does not match the received size", map[string]int64{"offset": current})
+		return
+	}
+	item.busy = true
+	size, part, serverName, virtual := item.Size, item.part, item.Server, item.Path
+	s.uploads.mu.Unlock()
+	done := func(n int64) {
+		s.uploads.mu.Lock()
+		item.busy = false
+		if n > 0 {
+			item.Offset += n
+			item.UpdatedAt = time.Now()
+			s.uploads.save()
+		}
+		s.uploads.mu.Unlock()
+	}
+
+	// 作成後に権限を失ったユーザーからの受信は拒否する。
+	if !(&vfs.Handler{Username: username, Config: s.Config}).CanWrite(virtual) {
+		done(0)
+		writeError(w, r, http.StatusForbidden, ErrCodePermissionDenied, "Permission required", map[string]string{"permission": config.PermFileWrite, "server": serverName, "path": virtual})
+		return
+	}
+
+	f, err := os.OpenFile(part, os.O_WRONLY, 0)
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		done(0)
+		logger.For(r.Context()).Errorf("Internal", "API", "アップロードの一時ファイルを開けません: id=%s, err=%v", id, err)
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", nil)
+		return
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(r.Body, size-offset))
+	closeErr := f.Close()
+	if copyErr == nil && closeErr == nil {
+		// 宣言した大きさを超える断片は、書き込んだ分も取り消して受信済みの位置を元に戻す。
+		if extra, _ := r.Body.Read(make([]byte, 1)); extra > 0 {
+			os.Truncate(part, offset)
+			done(0)
+			writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Chunk exceeds the declared size", map[string]int64{"size": size})
+			return
+		}
+	}
+	done(n)
+	if copyErr != nil || closeErr != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "アップロードの断片の受信が中断されました: id=%s, received=%d, err=%v", id, n, errors.Join(copyErr, closeErr))
+		return
+	}
+
+	if offset+n < size {
+		st, _ := s.uploads.get(id, username)
+		writeUploadStatus(w, http.StatusOK, st)
+		return
+	}
+	s.completeUpload(w, r, id)
+}
+
+// completeUpload は全体を受信したファイルを SHA-256 で照合し、upload.validate の検証を経て置き換える。
+// 照合・検証に失敗した場合は受信したデータを破棄する。
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, id string) {
+	s.uploads.mu.Lock()
+	item, ok := s.uploads.items[id]
+	if !ok {
+		s.uploads.mu.Unlock()
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Upload not found", map[string]string{"upload": id})
+		return
+	}
+	delete(s.uploads.items, id)
+	s.uploads.save()
+	st := item.status()
+	s.uploads.mu.Unlock()
+
+	if st.SHA256 != "" {
+		actual, err := fileSHA256(item.part)
+		if err != nil || actual != st.SHA256 {
+			os.Remove(item.part)
+			logger.For(r.Context()).Warnf("Client", "API", "アップロードのチェックサムが一致しません: user=%s, path=%s, expected=%s, actual=%s, err=%v", st.User, st.Path, st.SHA256, actual, err)
+			writeError(w, r, http.StatusUnprocessableEntity, ErrCodeUnprocessable, "Checksum mismatch", map[string]string{"expected": st.SHA256, "actual": actual})
+			return
+		}
+	}
+	h := &vfs.Handler{Username: st.User, Config: s.Config}
+	if err := h.CommitUpload("/"+st.Path, item.part, item.target); err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, ErrCodeUnprocessable, "Upload rejected: "+err.Error(), map[string]string{"path": st.Path})
+		return
+	}
+	logger.For(r.Context()).Logf("Client", "API", "アップロードが完了しました: user=%s, path=%s, size=%d", st.User, st.Path, st.Size)
+	writeUploadStatus(w, http.StatusOK, st)
+}
+
+// fileSHA256 はファイル全体の SHA-256 を 16 進数で返す。
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeUploadStatus(w http.ResponseWriter, status int, st uploadStatus) {
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(st.Offset, 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(st)
+}
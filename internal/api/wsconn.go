@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsPongWait はクライアントからの応答（pong または任意のメッセージ）が途絶えたとみなすまでの時間。
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod は ping の送信間隔。NAT やプロキシのアイドル切断を防ぎつつ、wsPongWait 内に応答を得られる間隔とする。
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsWriteWait は 1 フレームの書き込みに許容する時間。これを超えるクライアントは切断する。
+	wsWriteWait = 10 * time.Second
+	// wsSendQueue はクライアントごとの送信待ちフレーム数の上限。
+	wsSendQueue = 64
+)
+
+var errWSClosed = errors.New("websocket connection closed")
+
+type wsMessage struct {
+	typ  int
+	data []byte
+}
+
+// MARK: wsConn
+// 書き込みを単一のゴルーチンへ集約し、送信キュー・keepalive（ping/pong）・書き込みタイムアウトを提供する WebSocket 接続。
+// gorilla/websocket は並行書き込みを許容しないため、全ての送信はこの型を経由させる。
+type wsConn struct {
+	*websocket.Conn
+	send      chan wsMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// MARK: newWSConn()
+// 接続をラップし、送信ループを開始する。読み込み側は呼び出し元で ReadMessage を継続的に呼ぶ必要がある（pong の処理のため）。
+func newWSConn(ws *websocket.Conn) *wsConn {
+	c := &wsConn{
+		Conn: ws,
+		send: make(chan wsMessage, wsSendQueue),
+		done: make(chan struct{}),
+	}
+	ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go c.writeLoop()
+	return c
+}
+
+func (c *wsConn) writeLoop() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer c.Close()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.WriteMessage(msg.typ, msg.data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Send はフレームを送信キューへ積む。キューが空くまで待機するため、欠落させてはならないデータ（端末出力）に使用する。
+func (c *wsConn) Send(typ int, data []byte) error {
+	select {
+	case c.send <- wsMessage{typ: typ, data: data}:
+		return nil
+	case <-c.done:
+		return errWSClosed
+	}
+}
+
+// TrySend はキューに空きがある場合のみフレームを積み、溢れている場合は破棄して false を返す。
+// 最新値で置き換わるデータ（統計情報）に使用し、遅いクライアントが送信側を詰まらせないようにする。
+func (c *wsConn) TrySend(typ int, data []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- wsMessage{typ: typ, data: data}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done は接続が閉じられた際にクローズされるチャネルを返す。
+func (c *wsConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close は送信ループを停止し、下位の接続を閉じる。複数回呼び出しても安全。
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+	return nil
+}
+
+// CloseOnDone は ctx がキャンセルされた時点（play-bin の終了時）で、クライアントへ終了理由 (1001 Going Away) を通知して接続を閉じる。
+// 返す関数で監視を解除する。ハイジャックされた接続は http.Server.Shutdown の対象外のため、WebSocket のハンドラーで使用する。
+func (c *wsConn) CloseOnDone(ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, func() {
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		c.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+		c.Close()
+	})
+}
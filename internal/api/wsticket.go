@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/logger"
+)
+
+// wsTicketTTL は WebSocket・SSE 接続用チケットの有効期間。発行直後に接続する用途のため短くする。
+const wsTicketTTL = 30 * time.Second
+
+// wsTicketEndpoints はチケットで接続できる WebSocket・SSE の端点。
+var wsTicketEndpoints = []string{"/ws/terminal", "/ws/stats", "/ws/overview", "/api/events"}
+
+// wsTicketGlobalEndpoints は特定のコンテナを対象としない (?id= を取らない) 端点。
+var wsTicketGlobalEndpoints = []string{"/ws/overview", "/api/events"}
+
+// MARK: wsTickets
+// WebSocket・SSE (EventSource) 接続用の使い捨てのチケットを保持する。いずれもブラウザからヘッダーを付与できない。
+// セッショントークンをクエリへ載せるとアクセスログやプロキシに残るため、端点とコンテナに限定した短命のチケットで代替する。
+type wsTickets struct {
+	mu      sync.Mutex
+	tickets map[string]wsTicket
+}
+
+// wsTicket はチケットの発行者と、使用できる端点・コンテナ。
+type wsTicket struct {
+	user      string
+	endpoint  string
+	server    string
+	expiresAt time.Time
+}
+
+func newWSTickets() *wsTickets {
+	return &wsTickets{tickets: make(map[string]wsTicket)}
+}
+
+// issue はチケットを発行する。発行の度に期限切れのチケットを破棄し、使われなかったチケットが溜まり続けないようにする。
+func (t *wsTickets) issue(user, endpoint, server string) (string, time.Time, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := hex.EncodeToString(b)
+	now := time.Now()
+	expiresAt := now.Add(wsTicketTTL)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, v := range t.tickets {
+		if now.After(v.expiresAt) {
+			delete(t.tickets, k)
+		}
+	}
+	t.tickets[ticket] = wsTicket{user: user, endpoint: endpoint, server: server, expiresAt: expiresAt}
+	return ticket, expiresAt, nil
+}
+
+// redeem はチケットを消費し、発行したユーザーを返す。端点・コンテナが発行時と異なる場合や期限切れの場合は失敗する。
+// 不一致の場合もチケットは破棄し、同じチケットでの再試行を許さない。
+func (t *wsTickets) redeem(ticket, endpoint, server string) (string, bool) {
+	t.mu.Lock()
+	v, ok := t.tickets[ticket]
+	delete(t.tickets, ticket)
+	t.mu.Unlock()
+	if !ok || time.Now().After(v.expiresAt) || v.endpoint != endpoint || v.server != server {
+		return "", false
+	}
+	return v.user, true
+}
+
+// wsUserKey は WebSocket の接続を認証したユーザー名をコンテキストに格納するためのキー。
+type wsUserKey struct{}
+
+// MARK: WSAuth()
+// WebSocket・SSE の端点用の認証ミドルウェア。?ticket= で使い捨てのチケットを、無い場合は Auth と同じく Authorization ヘッダーのセッショントークンを受け付ける。
+// 認証したユーザーは wsUser で取得する。
+func (s *Server) WSAuth(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	withSession := s.Auth(func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), wsUserKey{}, s.sessionUser(r))))
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if !q.Has("ticket") {
+			withSession(w, r)
+			return
+		}
+		username, ok := s.wsTickets.redeem(q.Get("ticket"), endpoint, q.Get("id"))
+		if !ok || username == "" {
+			logger.For(r.Context()).Warnf("Client", "Auth", "WebSocketチケットの検証失敗: endpoint=%s, target=%s, addr=%s", endpoint, q.Get("id"), r.RemoteAddr)
+			writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthenticated, "Invalid or expired ticket", nil)
+			return
+		}
+		ctx := context.WithValue(r.Context(), wsUserKey{}, username)
+		next(w, r.WithContext(container.WithActor(ctx, username, container.ViaHTTP)))
+	}
+}
+
+// wsUser は WSAuth が認証したユーザー名を返す。
+func wsUser(r *http.Request) string {
+	username, _ := r.Context().Value(wsUserKey{}).(string)
+	return username
+}
+
+// MARK: WSTicketHandler()
+// POST: {"endpoint": "/ws/terminal"} で、?id= のコンテナへ接続するための使い捨てのチケットを発行する。
+// /ws/overview・/api/events のようにコンテナを対象としない端点では ?id= を省略する。
+// 接続時の権限 (exec / attach 等) は端点側で改めて判定するため、ここでは Auth による container.read の確認のみを行う。
+func (s *Server) WSTicketHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := decodeJSON(w, r, &payload); err != nil {
+		logger.For(r.Context()).Warnf("Client", "API", "WebSocketチケット発行リクエストのデコードに失敗: %v", err)
+		return
+	}
+	if !slices.Contains(wsTicketEndpoints, payload.Endpoint) {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Unknown endpoint", map[string]any{"endpoint": payload.Endpoint, "allowed": wsTicketEndpoints})
+		return
+	}
+	serverName := r.URL.Query().Get("id")
+	if slices.Contains(wsTicketGlobalEndpoints, payload.Endpoint) {
+		serverName = ""
+	} else if serverName == "" {
+		writeError(w, r, http.StatusBadRequest, ErrCodeBadRequest, "id is required", nil)
+		return
+	}
+
+	ticket, expiresAt, err := s.wsTickets.issue(s.sessionUser(r), payload.Endpoint, serverName)
+	if err != nil {
+		logger.For(r.Context()).Errorf("Internal", "Auth", "チケット生成用乱数取得失敗: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{"ticket": ticket, "expiresAt": expiresAt}); err != nil {
+		logger.For(r.Context()).Errorf("Internal", "API", "JSONエンコード失敗: %v", err)
+	}
+}
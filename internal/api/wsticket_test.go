@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWSAuthEventsTicket(t *testing.T) {
+	s := &Server{WebSessions: map[string]string{}, wsTickets: newWSTickets()}
+	var got string
+	handler := s.WSAuth("/api/events", func(w http.ResponseWriter, r *http.Request) { got = wsUser(r) })
+	connect := func(ticket string) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/events?ticket="+ticket, nil))
+		return rec.Code
+	}
+
+	ticket, _, err := s.wsTickets.issue("alice", "/api/events", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := connect(ticket); code != http.StatusOK || got != "alice" {
+		t.Fatalf("status = %d, user = %q, want 200 and alice", code, got)
+	}
+	// チケットは 1 回の接続にのみ使用できる。
+	if code := connect(ticket); code != http.StatusUnauthorized {
+		t.Errorf("reused ticket: status = %d, want 401", code)
+	}
+	// 他の端点のために発行したチケットでは接続できない。
+	other, _, _ := s.wsTickets.issue("alice", "/ws/overview", "")
+	if code := connect(other); code != http.StatusUnauthorized {
+		t.Errorf("ticket for another endpoint: status = %d, want 401", code)
+	}
+}
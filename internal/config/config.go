@@ -1,10 +1,13 @@
 package config
 
 import (
-	"encoding/json"
-	"os"
+	"net"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/play-bin/internal/logger"
@@ -12,25 +15,501 @@ import (
 
 // MARK: LoadedConfig
 // プログラム実行中に動的に変更可能な設定情報を管理するスレッドセーフなコンテナ。
+// 読み込み済みの設定はスナップショットとして不変に保持し、再読み込み時にポインタごと差し替える。
 type LoadedConfig struct {
-	Config
-	LastLoaded time.Time
-	mu         sync.RWMutex
+	Path string // 読み込み元の設定ファイル。空の場合は初回の Reload で自動検出する
+
+	current     atomic.Pointer[snapshot]
+	mu          sync.Mutex // Reload の多重実行を防ぐ
+	writeMu     sync.Mutex // API による設定ファイルへの書き込みの多重実行を防ぐ
+	diffs       diffHub    // 再読み込みの差分の購読者
+	lastChecked time.Time  // 最後に読み込みを試みたときの更新時刻（失敗した場合も含む）。ファイル監視が使えない場合の巡回で使用する
+	grantsMu    sync.Mutex // 一時的な権限の変更の多重実行を防ぐ。取得する場合は mu より先に取得する
+	grants      grantStore
+}
+
+// snapshot は適用済みの設定と、その適用時刻の組。
+type snapshot struct {
+	config   Config
+	loadedAt time.Time
 }
 
 // MARK: Config
 // config.json の構造を反映したデータモデル。
 type Config struct {
-	HTTPListen string                  `json:"httpListen,omitempty"`
-	SFTPListen string                  `json:"sftpListen,omitempty"`
-	Users      map[string]UserConfig   `json:"users"`
-	Servers    map[string]ServerConfig `json:"servers"`
+	HTTPListen  string                       `json:"httpListen,omitempty"`
+	GRPCListen  string                       `json:"grpcListen,omitempty"` // gRPC 管理 API の待機アドレス。省略時は提供しない
+	StaticRoot  string                       `json:"staticRoot,omitempty"` // 埋め込みの Web UI の代わりに配信するディレクトリ
+	CORS        *CORSConfig                  `json:"cors,omitempty"`
+	RateLimit   *RateLimitConfig             `json:"rateLimit,omitempty"`
+	SFTPListen  string                       `json:"sftpListen,omitempty"`
+	ContainerFS bool                         `json:"containerFS,omitempty"` // SFTP / WebDAV の /<server>/_container でコンテナ内を読み取り専用で公開する
+	DockerHosts map[string]DockerHostConfig  `json:"dockerHosts,omitempty"`
+	Registries  map[string]RegistryConfig    `json:"registries,omitempty"`
+	Recording   *RecordingConfig             `json:"recording,omitempty"`
+	LogArchive  *LogArchiveConfig            `json:"logArchive,omitempty"`
+	CurseForge  *CurseForgeConfig            `json:"curseforge,omitempty"`
+	SnapshotDir string                       `json:"snapshotDir,omitempty"` // スナップショットの docker save の書き出し先。省略時は ./snapshots
+	Migration   *MigrationConfig             `json:"migration,omitempty"`   // ホスト間の移行でのデータの転送の設定
+	Firewall    *FirewallConfig              `json:"firewall,omitempty"`    // 公開するポートのホストのファイアウォールでの開閉。省略時は操作しない
+	Proxies     map[string]ProxyConfig       `json:"proxies,omitempty"`     // サーバーを起動・停止に合わせて登録・削除する Velocity / BungeeCord のプロキシ
+	DNS         map[string]DNSProviderConfig `json:"dns,omitempty"`         // サーバーの起動時に A / AAAA / SRV レコードを更新する DNS の提供元
+	Log         *LogConfig                   `json:"log,omitempty"`
+	// ContainerPrefix はコンテナ名の接頭辞。Docker 上のコンテナ名は接頭辞とサーバー名を連結したものとなる。省略時はサーバー名のまま。
+	ContainerPrefix string `json:"containerPrefix,omitempty"`
+	// StrictOwnership は所有ラベルの無いコンテナを、名前がサーバー名と一致してもサーバーのコンテナとして扱わない。
+	// 省略時は、以前のバージョンで作成したラベルの無いコンテナも、接頭辞無しで名前が一致すれば引き続き操作できる。
+	StrictOwnership bool `json:"strictOwnership,omitempty"`
+	// Notifications はクラッシュ・バックアップの失敗等をメール・Discord 等で通知する設定。省略時は通知しない。
+	Notifications *NotificationsConfig    `json:"notifications,omitempty"`
+	Users         map[string]UserConfig   `json:"users"`
+	Servers       map[string]ServerConfig `json:"servers"`
+}
+
+// MARK: ContainerName()
+// サーバーのコンテナの Docker 上の名前 (containerPrefix とサーバー名の連結) を返す。
+func (c Config) ContainerName(serverName string) string {
+	return c.ContainerPrefix + serverName
+}
+
+// MARK: NotificationsConfig
+// イベントの通知の設定。メールの宛先と受け取るイベントはユーザーごとに email と notify で指定する。
+// ユーザーに依らない通知先 (Discord, Webhook, Telegram 等) へは routes に一致したイベントを送信する。
+type NotificationsConfig struct {
+	// SMTP はメールの送信に使用する SMTP サーバー。ユーザーの notify と email の通知先を使用しない場合は省略できる
+	SMTP SMTPConfig `json:"smtp,omitzero"`
+	// DiskThreshold は作業ディレクトリを含むファイルシステムの使用率 (%)。超えた時点で disk を通知する。0 は監視しない
+	DiskThreshold float64 `json:"diskThreshold,omitempty"`
+	// Templates はイベントの種類ごとの件名・本文 (text/template)。省略した種類は既定の文面とする
+	Templates map[string]EmailTemplate `json:"templates,omitempty"`
+	// Channels は名前付きの通知先。routes から名前で参照する
+	Channels map[string]NotifyChannelConfig `json:"channels,omitempty"`
+	// Routes はイベントの種類・重要度ごとの通知先。一致した全てのルートの通知先へ送信する (同じ通知先へは 1 回)
+	Routes []NotifyRouteConfig `json:"routes,omitempty"`
+}
+
+// MARK: NotifyChannelConfig
+// 通知先 1 件。type により使用する項目が異なる。
+type NotifyChannelConfig struct {
+	Type    string            `json:"type"`              // discord / email / webhook / telegram
+	URL     string            `json:"url,omitempty"`     // discord の Webhook の URL、webhook の送信先
+	Headers map[string]string `json:"headers,omitempty"` // webhook で付与するヘッダー (例: Authorization)
+	To      []string          `json:"to,omitempty"`      // email の宛先
+	Token   string            `json:"token,omitempty"`   // telegram のボットのトークン
+	ChatID  string            `json:"chatId,omitempty"`  // telegram の送信先のチャット
+}
+
+// 通知先の種類。
+const (
+	ChannelDiscord  = "discord"
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+	ChannelTelegram = "telegram"
+)
+
+// MARK: NotifyRouteConfig
+// イベントを通知先へ振り分けるルール。条件を省略した項目は全てに一致する。
+type NotifyRouteConfig struct {
+	Events   []string `json:"events,omitempty"`   // イベントの種類 (NotifyEvents)
+	Severity string   `json:"severity,omitempty"` // 通知する最低の重要度 (info / warning / critical)
+	Servers  []string `json:"servers,omitempty"`  // 対象のサーバー。ホスト全体のイベントは "" で指定する
+	Channels []string `json:"channels"`           // 送信先の channels の名前
+	// QuietHours は重要度の低いイベントを通知しない時間帯。省略時は常に通知する
+	QuietHours *QuietHoursConfig `json:"quietHours,omitempty"`
+	// Dedup は同じ種類・サーバーのイベントを再び通知するまでの間隔。省略時は 10m、"0s" は抑制しない
+	Dedup string `json:"dedup,omitempty"`
+}
+
+// defaultNotifyDedup は routes の dedup を省略した場合の通知の抑制の間隔。
+const defaultNotifyDedup = 10 * time.Minute
+
+// MARK: DedupDuration()
+// 同じイベントを再び通知するまでの間隔を返す。未設定または不正な値の場合は既定値とする。
+func (r NotifyRouteConfig) DedupDuration() time.Duration {
+	if r.Dedup == "" {
+		return defaultNotifyDedup
+	}
+	d, err := time.ParseDuration(r.Dedup)
+	if err != nil || d < 0 {
+		return defaultNotifyDedup
+	}
+	return d
+}
+
+// QuietHoursConfig は通知を控える時間帯 (ホストのローカル時刻)。start が end より後の場合は日付を跨ぐ (例: 23:00 から 07:00)。
+type QuietHoursConfig struct {
+	Start string `json:"start"` // HH:MM
+	End   string `json:"end"`   // HH:MM
+	// Severity は時間帯の中でも通知する最低の重要度。省略時は critical
+	Severity string `json:"severity,omitempty"`
+}
+
+// MARK: Contains()
+// t が時間帯に含まれるかを返す。start と end の書式が不正な場合は含まれないものとする。
+func (q QuietHoursConfig) Contains(t time.Time) bool {
+	start, err1 := time.Parse("15:04", q.Start)
+	end, err2 := time.Parse("15:04", q.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	minute := func(h, m int) int { return h*60 + m }
+	now, from, to := minute(t.Hour(), t.Minute()), minute(start.Hour(), start.Minute()), minute(end.Hour(), end.Minute())
+	if from <= to {
+		return from <= now && now < to
+	}
+	return now >= from || now < to
+}
+
+// SMTPConfig はメールの送信に使用する SMTP サーバー。
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"` // 省略時は tls の場合 465、それ以外は 587
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+	TLS      string `json:"tls,omitempty"` // starttls (既定) / tls (接続時から TLS) / none (平文。localhost の中継用)
+}
+
+// MARK: Addr()
+// 接続先の host:port を返す。
+func (c SMTPConfig) Addr() string {
+	port := c.Port
+	if port == 0 {
+		port = 587
+		if c.TLS == SMTPTLS {
+			port = 465
+		}
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// SMTP の接続の暗号化の方式。
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// EmailTemplate は通知メールの件名と本文のテンプレート。
+type EmailTemplate struct {
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+// 通知するイベントの種類。ユーザーの notify に指定する。
+const (
+	NotifyCrash           = "crash"            // サーバーの異常終了 (インシデントの記録)
+	NotifyBackupCompleted = "backup_completed" // バックアップの完了
+	NotifyBackupFailed    = "backup_failed"    // バックアップの失敗
+	NotifyDisk            = "disk"             // ディスクの使用率が diskThreshold を超えた
+	NotifyLoginLockout    = "login_lockout"    // ログインの試行が流量制限を超え、拒否された
+)
+
+// NotifyEvents は notify に指定できるイベントの種類。
+var NotifyEvents = []string{NotifyCrash, NotifyBackupCompleted, NotifyBackupFailed, NotifyDisk, NotifyLoginLockout}
+
+// 通知するイベントの重要度。
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Severities は重要度の低い順の一覧。
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// MARK: EventSeverity()
+// イベントの種類の重要度を返す。サーバーの異常終了のみ即時の対応を要する critical とする。
+func EventSeverity(kind string) string {
+	switch kind {
+	case NotifyCrash:
+		return SeverityCritical
+	case NotifyBackupFailed, NotifyDisk, NotifyLoginLockout:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// MARK: SeverityAtLeast()
+// severity が min 以上の重要度であるかを返す。min が空の場合は全ての重要度を含む。
+func SeverityAtLeast(severity, min string) bool {
+	return slices.Index(Severities, severity) >= slices.Index(Severities, min)
+}
+
+// DockerHostConfig は名前付きの Docker エンドポイント（ローカル/リモートデーモン）への接続設定。
+type DockerHostConfig struct {
+	Host string           `json:"host"` // unix:///var/run/docker.sock, tcp://host:2376, ssh://user@host
+	TLS  *DockerTLSConfig `json:"tls,omitempty"`
+	// SSH はホスト間の移行でデータを転送する際の ssh の接続先 (user@host または ssh://user@host:port)。
+	// host が ssh:// の場合は省略でき、同じ接続先を使用する。
+	SSH string `json:"ssh,omitempty"`
+	// PublicAddress はこのホストで起動したサーバーへ接続するための IP アドレス。サーバーの dns で A / AAAA レコードに使用する。
+	PublicAddress string `json:"publicAddress,omitempty"`
+}
+
+// DockerTLSConfig は tcp 接続時に使用するクライアント証明書のパス。
+type DockerTLSConfig struct {
+	CA   string `json:"ca,omitempty"`
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// MigrationConfig はサーバーを別の Docker ホストへ移行する際の、データの転送の設定。
+type MigrationConfig struct {
+	StagingDir string `json:"stagingDir,omitempty"` // 移行元・移行先が共にリモートの場合に中継するディレクトリ (省略時 ./migrations)
+	S3         string `json:"s3,omitempty"`         // transfer に s3 を指定した場合の転送先 (例: s3://bucket/play-bin)。各ホストの aws CLI で転送する
+}
+
+// FirewallConfig はサーバーの起動・停止に合わせて、network.mapping で公開するポートをホストのファイアウォールで開閉する設定。
+// play-bin と同じマシンのデーモンで動作するサーバーのみを対象とする。
+type FirewallConfig struct {
+	Backend string `json:"backend"`          // "nftables", "iptables" (IPv6 は ip6tables), "ufw"
+	DryRun  bool   `json:"dryRun,omitempty"` // 実行するコマンドをログへ出力するのみで、ファイアウォールを変更しない
+	Table   string `json:"table,omitempty"`  // nftables のテーブル (省略時 "inet filter")
+	Chain   string `json:"chain,omitempty"`  // nftables / iptables のチェイン (省略時 "input" / "INPUT")
+}
+
+// ServerFirewallConfig はサーバーごとのファイアウォールの設定。
+type ServerFirewallConfig struct {
+	Disabled bool `json:"disabled,omitempty"` // このサーバーのポートは開閉しない (リバースプロキシ経由でのみ公開する場合等)
+}
+
+// ProxyConfig は Minecraft のプロキシ (Velocity / BungeeCord) への、バックエンドのサーバーの登録の設定。
+// api を指定した場合は HTTP で登録・削除を要求し、それ以外はプロキシの設定ファイルを書き換えて再読み込みのコマンドを送る。
+type ProxyConfig struct {
+	Type          string `json:"type"`                    // "velocity" または "bungeecord"
+	Server        string `json:"server,omitempty"`        // プロキシを実行する play-bin のサーバー。configFile の相対パスの基準と reloadCommand の送信先
+	ConfigFile    string `json:"configFile,omitempty"`    // velocity.toml / config.yml のパス
+	ReloadCommand string `json:"reloadCommand,omitempty"` // 設定ファイルの変更後にプロキシのコンソールへ送るコマンド (省略時 velocity: "velocity reload", bungeecord: "greload")
+	API           string `json:"api,omitempty"`           // 登録・削除を受け付けるプラグインの HTTP API の URL
+	APIToken      string `json:"apiToken,omitempty"`      // api へ Authorization: Bearer で送るトークン
+	APITokenFile  string `json:"apiTokenFile,omitempty"`
+}
+
+// DNSProviderConfig はレコードを更新する DNS の提供元。
+type DNSProviderConfig struct {
+	Type string `json:"type"`          // "cloudflare" または "rfc2136"
+	TTL  int    `json:"ttl,omitempty"` // 秒。省略時は 60 (cloudflare の 1 は自動)
+
+	// cloudflare
+	ZoneID       string `json:"zoneId,omitempty"`
+	APIToken     string `json:"apiToken,omitempty"` // DNS の編集権限を持つ API トークン
+	APITokenFile string `json:"apiTokenFile,omitempty"`
+
+	// rfc2136 (nsupdate で動的更新を送信する)
+	Server         string `json:"server,omitempty"`        // プライマリサーバー (host:port)
+	Zone           string `json:"zone,omitempty"`          // 更新するゾーン (例: "example.com")
+	TSIGName       string `json:"tsigName,omitempty"`      // TSIG の鍵の名前
+	TSIGAlgorithm  string `json:"tsigAlgorithm,omitempty"` // 省略時は "hmac-sha256"
+	TSIGSecret     string `json:"tsigSecret,omitempty"`    // base64 の鍵
+	TSIGSecretFile string `json:"tsigSecretFile,omitempty"`
+}
+
+// ServerDNSConfig はサーバーの起動時に更新するレコード。停止時は removeOnStop の場合のみ削除する。
+type ServerDNSConfig struct {
+	Provider     string `json:"provider"`               // dns のキー
+	Name         string `json:"name"`                   // A / AAAA レコードの名前 (例: "survival.mc.example.com")
+	Address      string `json:"address,omitempty"`      // レコードの IP アドレス。省略時は dockerHosts の publicAddress
+	SRV          string `json:"srv,omitempty"`          // SRV レコードのサービスとプロトコル (例: "_minecraft._tcp")。<srv>.<name> に作成する
+	Port         int    `json:"port,omitempty"`         // SRV レコードのポート。省略時は network.mapping のホスト側の最初の TCP ポート
+	RemoveOnStop bool   `json:"removeOnStop,omitempty"` // 停止時にレコードを削除する
+}
+
+// ServerProxyConfig はサーバーをプロキシへ登録する際の設定。
+type ServerProxyConfig struct {
+	Network string `json:"network"`        // proxies のキー
+	Name    string `json:"name,omitempty"` // プロキシ上のサーバー名。省略時は play-bin のサーバー名
+	Address string `json:"address"`        // プロキシから接続するアドレス (host:port)
+	MOTD    string `json:"motd,omitempty"` // bungeecord の motd。省略時は name
+}
+
+// RegistryConfig はプライベートレジストリからのイメージ取得に使用する認証情報。
+// キーはレジストリのホスト名（Docker Hub は "docker.io"）。秘密情報はファイルからの読み込みにも対応する。
+type RegistryConfig struct {
+	Username          string `json:"username,omitempty"`
+	Password          string `json:"password,omitempty"`
+	PasswordFile      string `json:"passwordFile,omitempty"`
+	IdentityToken     string `json:"identityToken,omitempty"`
+	IdentityTokenFile string `json:"identityTokenFile,omitempty"`
+}
+
+// RecordingConfig はコンソールセッション（exec / attach）の録画設定。省略時は録画しない。
+type RecordingConfig struct {
+	Directory     string         `json:"directory"`               // 録画ファイル (asciicast v2) の保存先
+	RetentionDays int            `json:"retentionDays,omitempty"` // 保持日数。0 は無期限
+	Users         map[string]int `json:"users,omitempty"`         // ユーザーごとの保持日数（retentionDays を上書き）
+}
+
+// LogArchiveConfig はコンテナのログをディスクへ保存し続けるアーカイブの設定。省略時は保存しない。
+// Docker のログはコンテナの再作成で失われるため、サーバーごとのファイルへ書き出して履歴を残す。
+type LogArchiveConfig struct {
+	Directory  string   `json:"directory"`            // 保存先。<directory>/<server>/ にサーバーごとのファイルを作成する
+	MaxSizeMB  int      `json:"maxSizeMB,omitempty"`  // このサイズを超えたらローテーションする (省略時 10)
+	MaxAgeDays int      `json:"maxAgeDays,omitempty"` // ローテーション済みのファイルの保持日数。0 は無期限
+	MaxFiles   int      `json:"maxFiles,omitempty"`   // サーバーごとのローテーション済みのファイルの保持数。0 は無制限
+	Servers    []string `json:"servers,omitempty"`    // 保存するサーバー。省略時は全てのサーバー
+}
+
+// MARK: Enabled()
+// 指定サーバーのログを保存するかを返す。
+func (c *LogArchiveConfig) Enabled(server string) bool {
+	if c == nil || c.Directory == "" {
+		return false
+	}
+	return len(c.Servers) == 0 || slices.Contains(c.Servers, server)
+}
+
+// MARK: MaxSize()
+// ローテーションするサイズをバイト単位で返す。
+func (c *LogArchiveConfig) MaxSize() int64 {
+	if c.MaxSizeMB <= 0 {
+		return defaultLogMaxSizeMB << 20
+	}
+	return int64(c.MaxSizeMB) << 20
+}
+
+// CurseForgeConfig は CurseForge API の認証情報。省略時は CurseForge からのダウンロードを無効にする。
+type CurseForgeConfig struct {
+	APIKey     string `json:"apiKey,omitempty"`
+	APIKeyFile string `json:"apiKeyFile,omitempty"`
+}
+
+// CORSConfig は別のオリジンで配信されるフロントエンドから API を利用するための CORS の設定。省略時は同一オリジンからのみ利用できる。
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`             // 例: "https://panel.example.com"。"*" は全てのオリジン
+	AllowedMethods   []string `json:"allowedMethods,omitempty"`   // 省略時 GET, POST, PUT, PATCH, DELETE
+	AllowedHeaders   []string `json:"allowedHeaders,omitempty"`   // 省略時 Authorization, Content-Type, X-Request-ID
+	AllowCredentials bool     `json:"allowCredentials,omitempty"` // Cookie 等の資格情報を伴うリクエストを許可する ("*" とは併用不可)
+	MaxAge           int      `json:"maxAge,omitempty"`           // プリフライトの結果をキャッシュする秒数 (省略時 600)
+}
+
+// RateLimitConfig は API へのリクエストの流量制限。Docker デーモンを過剰な要求から保護するため、省略時も既定値で制限する。
+// 流量は認証済みの場合はユーザーごと、未認証の場合は IP アドレスごとに数える。
+type RateLimitConfig struct {
+	Disabled          bool `json:"disabled,omitempty"`
+	RequestsPerMinute int  `json:"requestsPerMinute,omitempty"` // 全てのリクエスト (省略時 300)
+	Burst             int  `json:"burst,omitempty"`             // 一時的に超過を許容する件数 (省略時 60)
+	LoginPerMinute    int  `json:"loginPerMinute,omitempty"`    // IP アドレスごとのログインの試行 (省略時 10)
+	LoginBurst        int  `json:"loginBurst,omitempty"`        // 省略時 5
+	ActionsPerMinute  int  `json:"actionsPerMinute,omitempty"`  // 変更を伴う操作 (POST / PUT / PATCH / DELETE。省略時 30)
+	ActionBurst       int  `json:"actionBurst,omitempty"`       // 省略時 10
+	MaxConcurrent     int  `json:"maxConcurrent,omitempty"`     // 同時に処理するリクエストの上限 (SSE・WebSocket を除く。省略時 8)
+}
+
+// MARK: WithDefaults()
+// 省略された項目に既定値を補った設定を返す。rateLimit 自体が省略されている場合 (nil) も既定値で制限する。
+func (c *RateLimitConfig) WithDefaults() RateLimitConfig {
+	var out RateLimitConfig
+	if c != nil {
+		out = *c
+	}
+	for _, v := range []struct {
+		dst *int
+		def int
+	}{
+		{&out.RequestsPerMinute, 300}, {&out.Burst, 60},
+		{&out.LoginPerMinute, 10}, {&out.LoginBurst, 5},
+		{&out.ActionsPerMinute, 30}, {&out.ActionBurst, 10},
+		{&out.MaxConcurrent, 8},
+	} {
+		if *v.dst == 0 {
+			*v.dst = v.def
+		}
+	}
+	return out
+}
+
+// LogConfig は play-bin 自身のログの出力設定。省略時はテキスト形式で info 以上を出力する。
+type LogConfig struct {
+	Level    string            `json:"level,omitempty"`    // debug / info / warn / error
+	Format   string            `json:"format,omitempty"`   // text / json
+	Services map[string]string `json:"services,omitempty"` // サービス名 (例: "API", "Discord") ごとのしきい値
+
+	File        *LogFileConfig   `json:"file,omitempty"`        // 標準出力に加えて、ローテーションするファイルへ出力する
+	Syslog      *LogSyslogConfig `json:"syslog,omitempty"`      // 標準出力に加えて、syslog へ出力する
+	BufferLines int              `json:"bufferLines,omitempty"` // /api/admin/logs で参照できる直近のログの件数 (省略時 1000)
+}
+
+// LogFileConfig はログファイルの出力先とローテーションの設定。
+type LogFileConfig struct {
+	Path        string `json:"path"`
+	MaxSizeMB   int    `json:"maxSizeMB,omitempty"`   // このサイズを超えたらローテーションする (省略時 10)
+	RotateEvery string `json:"rotateEvery,omitempty"` // この時間が経過したらローテーションする (例: "24h")
+	MaxAgeDays  int    `json:"maxAgeDays,omitempty"`  // ローテーション済みのファイルの保持日数。0 は無期限
+	MaxBackups  int    `json:"maxBackups,omitempty"`  // ローテーション済みのファイルの保持数。0 は無制限
+}
+
+// LogSyslogConfig は syslog の出力先。network を省略するとローカルの syslog デーモンへ出力する。
+type LogSyslogConfig struct {
+	Network string `json:"network,omitempty"` // udp / tcp / unix
+	Address string `json:"address,omitempty"` // 例: "logs.example.com:514"
+	Tag     string `json:"tag,omitempty"`     // 省略時 "play-bin"
+}
+
+// defaultLogMaxSizeMB はログファイルのローテーションの既定のサイズ。
+const defaultLogMaxSizeMB = 10
+
+// MARK: Options()
+// 出力設定を logger の形式へ変換する。解釈できない値は既定値 (info / text) とする。
+func (c *LogConfig) Options() logger.Options {
+	opts := logger.Options{Format: logger.FormatText, Level: logger.LevelInfo}
+	if c == nil {
+		return opts
+	}
+	if c.Format != "" {
+		opts.Format = c.Format
+	}
+	if l, err := logger.ParseLevel(c.Level); err == nil {
+		opts.Level = l
+	}
+	opts.Services = make(map[string]logger.Level)
+	for service, level := range c.Services {
+		if l, err := logger.ParseLevel(level); err == nil {
+			opts.Services[service] = l
+		}
+	}
+	if f := c.File; f != nil && f.Path != "" {
+		size := f.MaxSizeMB
+		if size == 0 {
+			size = defaultLogMaxSizeMB
+		}
+		every, _ := time.ParseDuration(f.RotateEvery)
+		opts.File = &logger.FileOptions{
+			Path:        f.Path,
+			MaxSize:     int64(size) << 20,
+			RotateEvery: every,
+			MaxAge:      time.Duration(f.MaxAgeDays) * 24 * time.Hour,
+			MaxBackups:  f.MaxBackups,
+		}
+	}
+	if c.Syslog != nil {
+		opts.Syslog = &logger.SyslogOptions{Network: c.Syslog.Network, Address: c.Syslog.Address, Tag: c.Syslog.Tag}
+	}
+	opts.BufferLines = c.BufferLines
+	return opts
+}
+
+// MARK: RetentionFor()
+// 指定ユーザーの録画の保持日数を返す。0 は無期限。
+func (c *RecordingConfig) RetentionFor(username string) int {
+	if days, ok := c.Users[username]; ok {
+		return days
+	}
+	return c.RetentionDays
 }
 
 type UserConfig struct {
 	Discord     string              `json:"discord,omitempty"`
 	Password    string              `json:"password"`
 	Permissions map[string][]string `json:"permissions"`
+	Email       string              `json:"email,omitempty"`  // 通知の宛先
+	Notify      []string            `json:"notify,omitempty"` // メールで受け取るイベントの種類 (NotifyEvents)
+
+	// Grants は API で付与された期限付きの権限。設定ファイルには含まれず、LoadedConfig が関連付ける。
+	Grants []Grant `json:"-"`
+	// ServerTags はサーバーごとのタグ。"tag:<pattern>" の権限の判定に使用する。設定ファイルには含まれず、Load が関連付ける。
+	ServerTags map[string][]string `json:"-"`
 }
 
 const (
@@ -42,32 +521,145 @@ const (
 	PermContainerRead    = "container.read"
 	PermContainerWrite   = "container.write"
 	PermContainerExecute = "container.execute.*"
+	PermContainerExec    = "container.exec"  // コンテナ内での任意コマンド実行
+	PermContainerShare   = "container.share" // アカウントなしで閲覧できる共有リンクの発行・無効化
 
-	PermContainerStart   = "container.execute.start"
-	PermContainerStop    = "container.execute.stop"
-	PermContainerKill    = "container.execute.kill"
-	PermContainerBackup  = "container.execute.backup"
-	PermContainerRestore = "container.execute.restore"
-	PermContainerRemove  = "container.execute.remove"
+	PermContainerTerminalRoot = "container.terminal.root" // Web ターミナルの exec モードで root としてシェルを起動する
+
+	PermContainerStart    = "container.execute.start"
+	PermContainerStop     = "container.execute.stop"
+	PermContainerKill     = "container.execute.kill"
+	PermContainerBackup   = "container.execute.backup"
+	PermContainerRestore  = "container.execute.restore"
+	PermContainerRemove   = "container.execute.remove"
+	PermContainerSnapshot = "container.execute.snapshot" // スナップショットの作成・書き出し・ダウンロード・削除
+	PermContainerMigrate  = "container.execute.migrate"  // 別の Docker ホストへの移行 (設定の host も書き換える)
+
+	// Mod permissions
+	PermModRead  = "mod.read"
+	PermModWrite = "mod.write"
+
+	// World permissions
+	PermWorldRead  = "world.read"
+	PermWorldWrite = "world.write"
+
+	// Recording permissions
+	PermRecordingRead = "recording.read"
+
+	// Image permissions (ホスト全体の資源のため、サーバー名 "*" に対して付与する)
+	PermImageRead  = "image.read"
+	PermImageWrite = "image.write"
+
+	// Config permissions (play-bin 全体の設定のため、サーバー名 "*" に対して付与する)
+	PermConfigRead  = "config.read"
+	PermConfigWrite = "config.write"
+
+	// Admin permissions (play-bin 自体の運用操作のため、サーバー名 "*" に対して付与する)
+	PermAdminLogLevel  = "admin.loglevel"
+	PermAdminLogs      = "admin.logs"
+	PermAdminGrants    = "admin.grants"    // 期限付きの権限の付与・取り消し
+	PermAdminForwarder = "admin.forwarder" // ログの転送先への送信の統計の閲覧
+	PermAdminPrune     = "admin.prune"     // Docker の未使用の資源 (イメージ・コンテナ・ネットワーク・ビルドキャッシュ) の削除
+	PermAdminReconcile = "admin.reconcile" // 設定と実際のコンテナの差異の確認
 )
 
+// Permissions は個別に判定される権限の一覧。ワイルドカードを含む付与から、実際に許可される権限を列挙するために使用する。
+var Permissions = []string{
+	PermFileRead, PermFileWrite,
+	PermContainerRead, PermContainerWrite, PermContainerExec, PermContainerShare, PermContainerTerminalRoot,
+	PermContainerStart, PermContainerStop, PermContainerKill, PermContainerBackup, PermContainerRestore, PermContainerRemove, PermContainerSnapshot, PermContainerMigrate,
+	PermModRead, PermModWrite,
+	PermWorldRead, PermWorldWrite,
+	PermRecordingRead,
+	PermImageRead, PermImageWrite,
+	PermConfigRead, PermConfigWrite,
+	PermAdminLogLevel, PermAdminLogs, PermAdminGrants, PermAdminForwarder, PermAdminPrune, PermAdminReconcile,
+}
+
+// MARK: EffectivePermissions()
+// サーバーに対して実際に許可される権限を Permissions の順で返す。"*" を指定した場合は全サーバーに対する付与のみを評価する。
+func (u UserConfig) EffectivePermissions(serverName string) []string {
+	var perms []string
+	for _, p := range Permissions {
+		if u.HasPermission(serverName, p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
 // HasPermission checks if the user has the specified permission for the given server.
 // It supports hierarchical permissions with wildcards (e.g., "container.*" matches "container.read").
 func (u UserConfig) HasPermission(serverName, requiredPerm string) bool {
-	if u.Permissions == nil {
+	return u.hasPermissionWith(serverName, func(perms []string) bool {
+		return checkPermission(perms, requiredPerm)
+	})
+}
+
+// PermissionScopeSep は file.write の付与を、サーバー内の一部のパスに限定する区切り (例: "file.write:/data/plugins")。
+const PermissionScopeSep = ":"
+
+// MARK: HasPathPermission()
+// サーバー内の仮想パス p ("/<マウント先>/...") に対する権限を判定する。範囲を限定しない付与 (HasPermission) に加え、
+// "file.write:/data/plugins" のように範囲を限定した付与は、そのパスと配下のみを許可する。
+func (u UserConfig) HasPathPermission(serverName, requiredPerm, p string) bool {
+	if u.HasPermission(serverName, requiredPerm) {
+		return true
+	}
+	p = path.Clean("/" + p)
+	return u.hasPermissionWith(serverName, func(perms []string) bool {
+		for _, perm := range perms {
+			perm, scope, ok := strings.Cut(perm, PermissionScopeSep)
+			if ok && matchRecursive(perm, requiredPerm) && pathWithin(p, scope) {
+				return true
+			}
+		}
 		return false
+	})
+}
+
+// pathWithin は仮想パス p が scope と同じか、その配下にあるかを返す。
+func pathWithin(p, scope string) bool {
+	scope = path.Clean("/" + scope)
+	return scope == "/" || p == scope || strings.HasPrefix(p, scope+"/")
+}
+
+// ValidPermissionScope は権限の付与の範囲の指定を検証する。範囲を限定できるのは file.write のみ。
+func ValidPermissionScope(perm string) bool {
+	perm, scope, ok := strings.Cut(perm, PermissionScopeSep)
+	if !ok {
+		return true
 	}
+	return perm == PermFileWrite && strings.HasPrefix(scope, "/") && path.Clean(scope) == scope
+}
 
+// hasPermissionWith はサーバーに適用される付与 (サーバー・全サーバー・タグ・期限付きの権限) のいずれかが check を満たすかを返す。
+func (u UserConfig) hasPermissionWith(serverName string, check func(perms []string) bool) bool {
 	// 1. Check specific server permissions
-	if checkPermission(u.Permissions[serverName], requiredPerm) {
+	if check(u.Permissions[serverName]) {
 		return true
 	}
 
 	// 2. Check wildcard server permissions
-	if checkPermission(u.Permissions["*"], requiredPerm) {
+	if check(u.Permissions["*"]) {
 		return true
 	}
 
+	// 3. Check permissions granted by server tags (e.g., "tag:events")
+	for key, perms := range u.Permissions {
+		if strings.HasPrefix(key, TagPrefix) && u.appliesTo(key, serverName) && check(perms) {
+			return true
+		}
+	}
+
+	// 4. Check temporary grants that have not expired yet
+	now := time.Now()
+	for _, g := range u.Grants {
+		if g.Active(now) && u.appliesTo(g.Server, serverName) && check(g.Permissions) {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -109,18 +701,350 @@ func matchRecursive(userPerm, required string) bool {
 }
 
 type ServerConfig struct {
-	WorkingDir string         `json:"workingDir,omitempty"`
-	Compose    *ComposeConfig `json:"compose,omitempty"`
-	Commands   CommandsConfig `json:"commands"`
-	Discord    *DiscordConfig `json:"discord,omitempty"`
+	Host         string                `json:"host,omitempty"` // dockerHosts のキー。省略時は環境変数由来の既定デーモン
+	Tags         []string              `json:"tags,omitempty"` // 一覧の絞り込み・一括操作・権限の付与 ("tag:<name>") に使用する分類
+	WorkingDir   string                `json:"workingDir,omitempty"`
+	Compose      *ComposeConfig        `json:"compose,omitempty"`
+	Process      *ProcessConfig        `json:"process,omitempty"` // Docker を使わずにホスト上で直接実行する場合の設定 (compose と排他)
+	Commands     CommandsConfig        `json:"commands"`
+	Discord      *DiscordConfig        `json:"discord,omitempty"`
+	Query        *QueryConfig          `json:"query,omitempty"`
+	AutoShutdown *AutoShutdownConfig   `json:"autoShutdown,omitempty"` // query のプレイヤー数を用いた無人時の自動停止
+	Wake         *WakeConfig           `json:"wake,omitempty"`         // 停止中のサーバーへの接続を契機とした自動起動
+	Autostart    bool                  `json:"autostart,omitempty"`    // play-bin の起動時に、コンテナが存在しなければ起動する
+	ConfigFiles  []ConfigFileConfig    `json:"configFiles,omitempty"`  // 起動前に生成する設定ファイル（テンプレート）
+	Vars         map[string]string     `json:"vars,omitempty"`         // テンプレートから ${vars.<key>} で参照する任意の値
+	Mods         *ModsConfig           `json:"mods,omitempty"`         // Mod / プラグインの管理
+	Worlds       *WorldsConfig         `json:"worlds,omitempty"`       // ワールドの一覧・切り替え・リセット
+	Crash        *CrashConfig          `json:"crash,omitempty"`        // 異常終了時のログ・クラッシュレポートの収集
+	RCON         *RCONConfig           `json:"rcon,omitempty"`         // 定期コマンド等で使用する RCON の接続先
+	Cooldowns    map[string]string     `json:"cooldowns,omitempty"`    // 操作ごとの再実行までの待機時間 (例: {"restore": "10m"})
+	Hooks        map[string]HookConfig `json:"hooks,omitempty"`        // 操作ごとの前後にホスト上で実行するコマンド (例: {"stop": {"post": "..."}})
+	Ready        *ReadyConfig          `json:"ready,omitempty"`        // 起動後にゲームサーバーが利用可能になったことの判定条件
+	LogFormat    *LogFormatConfig      `json:"logFormat,omitempty"`    // ログの行の形式。構造化出力とレベルでの絞り込みに使用する
+	Forward      *ForwardConfig        `json:"forward,omitempty"`      // ログのルールに一致した行の転送先
+	Terminal     *TerminalConfig       `json:"terminal,omitempty"`     // Web ターミナルの exec モードで起動するシェルの既定値
+	Public       *PublicConfig         `json:"public,omitempty"`       // 認証不要のステータスページ (/status) へ掲載する場合の設定
+	Firewall     *ServerFirewallConfig `json:"firewall,omitempty"`     // firewall でのポートの開閉の設定
+	Proxy        *ServerProxyConfig    `json:"proxy,omitempty"`        // 起動中のみプロキシ (proxies) へ登録する場合の設定
+	DNS          *ServerDNSConfig      `json:"dns,omitempty"`          // 起動時に更新する DNS のレコード
+	Upload       *UploadConfig         `json:"upload,omitempty"`       // SFTP / WebDAV によるアップロードのステージングと検証
+}
+
+// UploadConfig は SFTP / WebDAV によるファイルの書き込みの設定。
+// ステージングでは書き込みを一時ファイルへ行い、完了後に検証してからアトミックに置き換えるため、稼働中のサーバーが書き込み途中のファイルを読むことがない。
+type UploadConfig struct {
+	Staging  bool                   `json:"staging,omitempty"`  // 全てのファイルをステージングする。省略時は validate に一致するファイルのみ
+	Validate []UploadValidateConfig `json:"validate,omitempty"` // パスごとの置き換え前の検証
+}
+
+// UploadValidateConfig はパスに一致するファイルの置き換え前の検証。format と command の両方を指定した場合は両方を行う。
+type UploadValidateConfig struct {
+	// Path はサーバー内の仮想パス (例: "data/config/*.yml") のパターン (path.Match)。"/" を含まない場合はファイル名と照合する。
+	Path    string `json:"path"`
+	Format  string `json:"format,omitempty"`  // 構文の検証 (UploadFormats)
+	Command string `json:"command,omitempty"` // ホスト上で実行する検証コマンド。末尾に一時ファイルのパスを加えて実行し、終了コードが 0 以外の場合は拒否する
+}
+
+// 構文を検証できるファイルの形式。
+const (
+	UploadFormatJSON = "json"
+	UploadFormatYAML = "yaml"
+	UploadFormatTOML = "toml"
+)
+
+// UploadFormats は upload.validate の format に指定できる値。
+var UploadFormats = []string{UploadFormatJSON, UploadFormatYAML, UploadFormatTOML}
+
+// MARK: Match()
+// サーバー内の仮想パス (先頭の "/" を除く) が検証の対象であるかを返す。
+func (v UploadValidateConfig) Match(p string) bool {
+	if !strings.Contains(v.Path, "/") {
+		p = path.Base(p)
+	}
+	ok, _ := path.Match(strings.Trim(v.Path, "/"), p)
+	return ok
+}
+
+// PublicConfig は認証不要のステータスページへの掲載の設定。設定したサーバーのみが、状態・プレイヤー数・稼働時間を公開する。
+type PublicConfig struct {
+	Name        string `json:"name,omitempty"`        // 表示名。省略時はサーバー名
+	Description string `json:"description,omitempty"` // 表示名に添える説明 (接続先のアドレス等)
+}
+
+// TerminalConfig は Web ターミナルの exec モードで起動するシェルの既定値。接続時のクエリで個別に上書きできる。
+type TerminalConfig struct {
+	Shell      string            `json:"shell,omitempty"`      // 起動するシェル (例: /bin/bash, ash)。省略時は /bin/sh
+	User       string            `json:"user,omitempty"`       // 実行ユーザー (name / uid / uid:gid)。省略時はコンテナの既定ユーザー
+	WorkingDir string            `json:"workingDir,omitempty"` // 作業ディレクトリ。省略時はイメージの既定値
+	Env        map[string]string `json:"env,omitempty"`        // 追加する環境変数
+	// Commands はシェルの代わりに cmd で起動できる対話的なコマンドの許可リスト (例: "rcon-cli", "mc-admin *")。
+	// 末尾の引数が "*" の場合は、それより前が一致すれば任意の引数を追加できる。
+	Commands []string `json:"commands,omitempty"`
+}
+
+// MARK: AllowsCommand()
+// 引数へ分割したコマンドが許可リストのいずれかに一致するかを返す。
+func (t *TerminalConfig) AllowsCommand(argv []string) bool {
+	if t == nil || len(argv) == 0 {
+		return false
+	}
+	for _, entry := range t.Commands {
+		allowed, err := SplitCommandLine(entry)
+		if err != nil || len(allowed) == 0 {
+			continue
+		}
+		if n := len(allowed) - 1; allowed[n] == "*" {
+			if len(argv) >= n && slices.Equal(argv[:n], allowed[:n]) {
+				return true
+			}
+		} else if slices.Equal(argv, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForwardConfig はログの転送の設定。ルールに一致した行を、全ての転送先へ送る。
+type ForwardConfig struct {
+	Rules       string              `json:"rules"` // ルールの定義ファイル (例: logs.json)
+	Sinks       []ForwardSinkConfig `json:"sinks"`
+	MaxLineSize int                 `json:"maxLineSize,omitempty"` // 1 行として扱う最大のバイト数。超える行は分割して評価する (省略時 64 KiB)
+}
+
+// defaultForwardMaxLineSize は forward.maxLineSize を省略した場合の 1 行の最大のバイト数。
+const defaultForwardMaxLineSize = 64 << 10
+
+// MARK: LineSize()
+// 1 行として扱う最大のバイト数を返す。
+func (c *ForwardConfig) LineSize() int {
+	if c.MaxLineSize <= 0 {
+		return defaultForwardMaxLineSize
+	}
+	return c.MaxLineSize
+}
+
+// 転送先の種類。
+const (
+	SinkDiscord = "discord" // ルールの webhook を Discord Webhook へ送信する
+	SinkHTTP    = "http"    // 一致した行とキャプチャを JSON で POST する
+	SinkCommand = "command" // ルールの commands をコンテナの標準入力へ送信する
+	SinkEvent   = "event"   // /api/events の match イベントとして配信する
+)
+
+// ForwardSinkConfig は転送先 1 件の設定。
+type ForwardSinkConfig struct {
+	Type    string            `json:"type"`              // discord / http / command / event
+	URL     string            `json:"url,omitempty"`     // discord / http の送信先
+	Headers map[string]string `json:"headers,omitempty"` // http で付与するヘッダー (例: Authorization)
+}
+
+// MARK: ForwardSettings()
+// ログの転送の設定を返す。forward が未定義の場合は、discord の webhook と logSetting を Discord への転送とみなす。
+// 転送しない場合は nil を返す。
+func (s ServerConfig) ForwardSettings() *ForwardConfig {
+	if s.Forward != nil {
+		return s.Forward
+	}
+	if s.Discord == nil || s.Discord.LogSetting == "" || s.Discord.Webhook == "" {
+		return nil
+	}
+	return &ForwardConfig{
+		Rules: s.Discord.LogSetting,
+		Sinks: []ForwardSinkConfig{{Type: SinkDiscord, URL: s.Discord.Webhook}},
+	}
+}
+
+// MARK: ProcessSettings()
+// ホスト上で直接実行するサーバーの設定を返す。directory を省略した場合は workingDir で実行する。
+// Docker のコンテナとして実行するサーバーでは nil を返す。
+func (s ServerConfig) ProcessSettings() *ProcessConfig {
+	if s.Process == nil {
+		return nil
+	}
+	pc := *s.Process
+	if pc.Directory == "" {
+		pc.Directory = s.WorkingDir
+	}
+	return &pc
+}
+
+// LogFormatConfig はゲームサーバーのログの 1 行を、時刻・レベル・本文に分解するための定義。
+type LogFormatConfig struct {
+	// Pattern は名前付きグループ time, level, message を持つ正規表現 (例: `^\[(?P<time>[\d:]+)\] \[[^/]+/(?P<level>\w+)\]: (?P<message>.*)$`)。
+	Pattern string `json:"pattern"`
+	// Levels はログ中のレベル表記を debug / info / warn / error へ対応付ける (例: {"SEVERE": "error"})。
+	// 指定の無い表記は一般的な名称 (WARNING, FATAL 等) から判定する。
+	Levels map[string]string `json:"levels,omitempty"`
+}
+
+// ReadyConfig はコンテナの起動後、ゲームサーバーの読み込みが完了して利用可能になったことを判定する条件。
+// 両方を指定した場合は、両方を満たした時点で準備完了とする。
+type ReadyConfig struct {
+	Log     string `json:"log,omitempty"`     // 準備完了を示すログの正規表現 (例: "Done \\(.*\\)! For help")
+	Port    string `json:"port,omitempty"`    // 接続を受け付けるようになれば準備完了とする TCP の接続先 (host:port)
+	Timeout string `json:"timeout,omitempty"` // 準備完了を待つ時間。省略時は 10m
+}
+
+// defaultReadyTimeout は ready.timeout を省略した場合に準備完了を待つ時間。
+const defaultReadyTimeout = 10 * time.Minute
+
+// MARK: TimeoutDuration()
+// 準備完了を待つ時間を返す。未設定または不正な値の場合は既定値とする。
+func (r ReadyConfig) TimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(r.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultReadyTimeout
+}
+
+// MARK: Cooldown()
+// 操作 (start, stop, restore 等) の再実行までの待機時間を返す。未設定または不正な値の場合は 0 (制限なし)。
+func (s ServerConfig) Cooldown(action string) time.Duration {
+	d, err := time.ParseDuration(s.Cooldowns[action])
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// defaultHookTimeout は hooks の timeout を省略した場合の実行時間の上限。
+const defaultHookTimeout = 30 * time.Second
+
+// HookConfig は操作の前後にホスト上のシェル (/bin/sh -c) で実行するコマンド。
+// 環境変数 PLAYBIN_SERVER / PLAYBIN_ACTION / PLAYBIN_USER / PLAYBIN_VIA / PLAYBIN_JOB と、post では PLAYBIN_RESULT / PLAYBIN_ERROR を渡す。
+type HookConfig struct {
+	Pre     string `json:"pre,omitempty"`     // 操作の前に実行する。失敗した場合は操作を中止する
+	Post    string `json:"post,omitempty"`    // 操作の完了後に、成否にかかわらず実行する。操作の結果には影響しない
+	Timeout string `json:"timeout,omitempty"` // 1 コマンドの実行時間の上限 (初期値: 30s)
+}
+
+// MARK: TimeoutDuration()
+// コマンドの実行時間の上限を返す。未設定または不正な値の場合は 30 秒。
+func (h HookConfig) TimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultHookTimeout
+}
+
+// RCONConfig は Source RCON プロトコル（Minecraft 等）での接続設定。
+type RCONConfig struct {
+	Address      string `json:"address"` // host:port
+	Password     string `json:"password,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+}
+
+// CrashConfig はコンテナが異常終了した際に、インシデントとして収集する情報の設定。
+type CrashConfig struct {
+	LogLines int      `json:"logLines,omitempty"` // 収集するログの末尾行数。省略時は 200
+	Reports  []string `json:"reports,omitempty"`  // クラッシュレポートのパターン (例: "data/crash-reports/*.txt"。相対パスは workingDir 基準)
+	Discord  bool     `json:"discord,omitempty"`  // Discord チャンネルへログを添付して通知する
+}
+
+// WorldsConfig はワールドデータの配置。active のディレクトリをゲームサーバーが使用し、それ以外のワールドは storage に保管する。
+type WorldsConfig struct {
+	Directory string `json:"directory"`         // アクティブなワールドを含むディレクトリ（相対パスは workingDir 基準）
+	Active    string `json:"active,omitempty"`  // アクティブなワールドのディレクトリ名。省略時は "world"
+	Storage   string `json:"storage,omitempty"` // 保管中のワールドの格納先。省略時は <directory>/.worlds
+}
+
+// ModsConfig は Mod / プラグインを配置するディレクトリと、ダウンロード時の互換性の条件。
+type ModsConfig struct {
+	Directory   string `json:"directory"`             // Mod の配置先（相対パスは workingDir 基準）
+	Loader      string `json:"loader,omitempty"`      // "fabric", "forge", "neoforge", "quilt", "paper" 等
+	GameVersion string `json:"gameVersion,omitempty"` // 対象の Minecraft バージョン (例: "1.20.1")
+}
+
+// ConfigFileConfig はコンテナ作成前にテンプレートから生成する設定ファイル（server.properties 等）。
+// テンプレート内の ${name} 形式の変数をサーバー設定の値で置換し、ポートや RCON パスワード等を play-bin の設定と一致させる。
+type ConfigFileConfig struct {
+	Template string `json:"template"` // テンプレートのパス（相対パスは workingDir 基準）
+	Target   string `json:"target"`   // 出力先のパス（相対パスは workingDir 基準）
+}
+
+// WakeConfig は停止中のサーバーのゲームポートで接続を待ち受け、接続があればサーバーを起動するための設定。
+type WakeConfig struct {
+	Listen   string `json:"listen"`             // 待ち受けるアドレス (例: ":25565")。コンテナが公開するポートと同じにする
+	Protocol string `json:"protocol,omitempty"` // "minecraft" または "tcp"（既定）
+	Message  string `json:"message,omitempty"`  // 起動中であることをプレイヤーへ伝えるメッセージ（minecraft のみ）
+}
+
+// AutoShutdownConfig はプレイヤー不在が続いたサーバーを停止し、ホストの資源を節約するための設定。
+type AutoShutdownConfig struct {
+	IdleMinutes    int      `json:"idleMinutes"`              // プレイヤー数 0 がこの分数続いたら停止する
+	Warnings       []int    `json:"warnings,omitempty"`       // 停止の何分前に警告するか (例: [5, 1])
+	WarningCommand string   `json:"warningCommand,omitempty"` // 警告としてコンソールへ送るコマンド。${minutes} は残り分数に置換
+	StartAt        []string `json:"startAt,omitempty"`        // 停止中のサーバーを起動する時刻 ("HH:MM", ローカル時刻)
+}
+
+// QueryConfig はゲームサーバーのプロトコルに応じた状態問い合わせ（プレイヤー数・MOTD 等）の設定。
+type QueryConfig struct {
+	Type    string `json:"type"`              // "minecraft", "a2s", "tcp"
+	Address string `json:"address"`           // 問い合わせ先 (host:port)
+	Timeout int    `json:"timeout,omitempty"` // 秒。省略時は 3 秒
 }
 
 type ComposeConfig struct {
 	Image   string            `json:"image"`
+	Build   *BuildConfig      `json:"build,omitempty"`
 	Restart string            `json:"restart,omitempty"`
 	Command *StartConfig      `json:"command,omitempty"`
 	Network NetworkConfig     `json:"network,omitempty"`
 	Mount   map[string]string `json:"mount,omitempty"`
+	// Resources はメモリ・CPU の上限。起動コマンドの ${MEMORY_MB} 等の算出にも使用する
+	Resources *ResourcesConfig `json:"resources,omitempty"`
+}
+
+// ResourcesConfig はコンテナのメモリ・CPU の上限。
+type ResourcesConfig struct {
+	Memory      string  `json:"memory,omitempty"`      // メモリの上限 (例: "4g", "4096m")
+	CPUs        float64 `json:"cpus,omitempty"`        // CPU の上限 (例: 2, 1.5)
+	HeapPercent int     `json:"heapPercent,omitempty"` // ${HEAP_MB} としてヒープに充てるメモリの割合 (省略時 75)
+}
+
+// ProcessConfig はコンテナを使わずに、play-bin と同じホスト上で直接実行するサーバーの設定。
+// unit を指定した場合は systemd のユニットとして systemctl で操作し、ログは journald から読む。
+// command を指定した場合は play-bin の子プロセスとして実行し、出力を logFile へ追記する。
+type ProcessConfig struct {
+	Unit        string            `json:"unit,omitempty"`        // systemd のユニット名 (例: minecraft.service)
+	Stdin       string            `json:"stdin,omitempty"`       // unit の標準入力の FIFO (StandardInput=file:<path>)。コマンドの送信に使用する
+	Command     []string          `json:"command,omitempty"`     // 実行するコマンドと引数
+	Directory   string            `json:"directory,omitempty"`   // command の作業ディレクトリ (省略時は workingDir)
+	Env         map[string]string `json:"env,omitempty"`         // command に追加する環境変数
+	LogFile     string            `json:"logFile,omitempty"`     // command の出力の保存先 (省略時 ./process_logs/<server>.log)
+	StopTimeout string            `json:"stopTimeout,omitempty"` // command の停止で SIGTERM から SIGKILL までの待機時間 (省略時 10s)
+}
+
+// defaultProcessStopTimeout は process.stopTimeout を省略した場合の、SIGTERM から SIGKILL までの待機時間。
+const defaultProcessStopTimeout = 10 * time.Second
+
+// MARK: StopTimeoutDuration()
+// command の停止で SIGTERM を送ってから SIGKILL を送るまでの待機時間を返す。
+func (c *ProcessConfig) StopTimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(c.StopTimeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultProcessStopTimeout
+}
+
+// BuildConfig は起動前に Dockerfile からイメージをビルドするための設定。
+type BuildConfig struct {
+	Context    string            `json:"context"`              // ビルドコンテキスト（相対パスは workingDir 基準）
+	Dockerfile string            `json:"dockerfile,omitempty"` // コンテキスト内の Dockerfile パス（既定: Dockerfile）
+	Args       map[string]string `json:"args,omitempty"`       // --build-arg に相当
+}
+
+// MARK: ImageRef()
+// 起動に使用するイメージ名を返す。ビルド設定があり image が未指定の場合は、サーバー名から既定のタグを生成する。
+func (c *ComposeConfig) ImageRef(serverName string) string {
+	if c == nil {
+		return ""
+	}
+	if c.Image == "" && c.Build != nil {
+		return "play-bin/" + strings.ToLower(serverName) + ":latest"
+	}
+	return c.Image
 }
 
 type NetworkConfig struct {
@@ -129,9 +1053,29 @@ type NetworkConfig struct {
 }
 
 type CommandsConfig struct {
-	Stop    []CmdConfig `json:"stop,omitempty"`
-	Backup  []CmdConfig `json:"backup,omitempty"`
-	Message *string     `json:"message,omitempty"`
+	Stop   []CmdConfig `json:"stop,omitempty"`
+	Backup []CmdConfig `json:"backup,omitempty"`
+	// BackupEngine は backup の世代を作成する方式 (BackupEngines)。省略時は auto
+	BackupEngine string               `json:"backupEngine,omitempty"`
+	Message      *string              `json:"message,omitempty"`
+	Saved        []SavedCommandConfig `json:"saved,omitempty"` // Web UI のクイックアクションとして表示する定型コマンド
+}
+
+// バックアップの世代を作成する方式。
+const (
+	BackupEngineAuto  = "auto"  // 復元元が btrfs のサブボリュームまたは ZFS のデータセットであればスナップショット、それ以外は rsync
+	BackupEngineRsync = "rsync" // rsync の --link-dest による差分のコピー
+	BackupEngineBtrfs = "btrfs" // btrfs の読み取り専用スナップショット
+	BackupEngineZFS   = "zfs"   // ZFS のスナップショット
+)
+
+// BackupEngines は commands.backupEngine に指定できる方式。
+var BackupEngines = []string{BackupEngineAuto, BackupEngineRsync, BackupEngineBtrfs, BackupEngineZFS}
+
+// SavedCommandConfig はコンソールへワンクリックで送信できる定型コマンド。
+type SavedCommandConfig struct {
+	Label   string `json:"label"`
+	Command string `json:"command"`
 }
 
 type StartConfig struct {
@@ -145,57 +1089,109 @@ type CmdConfig struct {
 }
 
 type DiscordConfig struct {
-	Token      string `json:"token,omitempty"`
-	Channel    string `json:"channel,omitempty"`
-	Webhook    string `json:"webhook,omitempty"`
-	LogSetting string `json:"logSetting,omitempty"`
+	Token         string `json:"token,omitempty"`
+	Channel       string `json:"channel,omitempty"`
+	Webhook       string `json:"webhook,omitempty"`
+	LogSetting    string `json:"logSetting,omitempty"`
+	ConfigChanges bool   `json:"configChanges,omitempty"` // 設定の再読み込みでこのサーバーの定義が変更された際に通知する
+	// Backups を指定した場合、バックアップの完了・失敗を結果 (世代・所要時間・変更されたファイル数・サイズの増減) と共に通知する。
+	Backups *DiscordBackupConfig `json:"backups,omitempty"`
+}
+
+// MARK: DiscordBackupConfig
+// バックアップの通知先。省略した項目は discord の channel / webhook を使用する。
+type DiscordBackupConfig struct {
+	Channel      string `json:"channel,omitempty"`      // 通知するチャンネル (token の Bot で送信する)
+	Webhook      string `json:"webhook,omitempty"`      // Bot を利用できない場合の通知先
+	FailuresOnly bool   `json:"failuresOnly,omitempty"` // 失敗のみを通知する
 }
 
 // MARK: Get()
-// 現在の設定情報を取得する。
-// アクセス毎にファイルの最終更新時刻を検証し、変更があれば透過的にリロードを行う。
+// 現在の設定情報を取得する。ファイルの変更は Watch によって検知・適用されるため、ここではスナップショットを読むだけで I/O を行わない。
 func (c *LoadedConfig) Get() Config {
-	c.mu.RLock()
-	info, err := os.Stat("./config.json")
-
-	if err == nil && info.ModTime().After(c.LastLoaded) {
-		// 設定変更を検知したため、共有ロックを解除して書き込みロック（リロード）へ昇格する。
-		c.mu.RUnlock()
-		c.Reload()
-		c.mu.RLock()
+	if snap := c.current.Load(); snap != nil {
+		return snap.config
 	}
-	defer c.mu.RUnlock()
+	return Config{}
+}
 
-	return c.Config
+// MARK: LastLoaded()
+// 現在の設定を適用した時刻を返す。設定に依存するキャッシュ等の更新要否の判定に使用する。
+func (c *LoadedConfig) LastLoaded() time.Time {
+	if snap := c.current.Load(); snap != nil {
+		return snap.loadedAt
+	}
+	return time.Time{}
 }
 
 // MARK: Reload()
-// ディスク上の config.json を読み込み、メモリ上のキャッシュをアトミックに更新する。
+// ディスク上の設定ファイル (JSON / YAML / TOML) と servers.d のサーバー定義を読み込み、メモリ上のキャッシュをアトミックに更新する。
+// 初回は存在する設定ファイルを自動検出し、以降は同じファイルを使用する。検証でエラーが見つかった場合は現在の設定を維持する。
 func (c *LoadedConfig) Reload() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	f, err := os.Open("./config.json")
+	if c.Path == "" {
+		c.Path = DetectPath()
+		logger.Logf("Internal", "Config", "設定ファイルを使用します: %s", c.Path)
+	}
+
+	// 旧形式 (listen / controllable) の設定は、読み込む前に現在の形式へ書き換える。
+	if changes, backup, err := c.MigrateLegacy(); err != nil {
+		logger.Errorf("Internal", "Config", "旧形式の設定の変換に失敗しました: %v", err)
+	} else if len(changes) > 0 {
+		logger.Warnf("Internal", "Config", "旧形式の設定を変換しました (元の内容: %s): %s", backup, strings.Join(changes, "; "))
+	}
+
+	// 失敗した場合に同じ内容で読み込みを繰り返さないよう、読み込みを試みた時点の更新時刻を記録する。
+	modTime, err := latestModTime(c.Path)
 	if err != nil {
 		// ファイル消失やパーミッション不足などの内部的な不整合（Internal）として扱う。
-		logger.Logf("Internal", "Config", "設定ファイルのオープンに失敗しました: %v", err)
+		logger.Errorf("Internal", "Config", "設定ファイルのオープンに失敗しました: %v", err)
+		return
+	}
+	c.lastChecked = modTime
+
+	newCfg, issues, err := Load(c.Path)
+	if err != nil {
+		// 不正な形式は、管理者による編集ミスの可能性があるが、システム内処理としてInternalで記録する。
+		logger.Errorf("Internal", "Config", "設定のパースに失敗しました: %v", err)
 		return
 	}
-	defer f.Close()
+	for _, issue := range issues {
+		if issue.Level == LevelError {
+			logger.Errorf("Internal", "Config", "設定の検証: %s", issue)
+		} else {
+			logger.Warnf("Internal", "Config", "設定の検証: %s", issue)
+		}
+	}
+	if HasErrors(issues) {
+		if c.current.Load() != nil {
+			logger.Errorf("Internal", "Config", "設定に誤りがあるため、再読み込みを中止して現在の設定を維持します")
+			return
+		}
+		// 起動時は維持すべき設定が存在しないため、問題を記録した上で適用する。
+		logger.Warnf("Internal", "Config", "設定に誤りがありますが、起動時のため適用します。--validate で内容を確認してください")
+	}
 
-	var newCfg Config
-	if err := json.NewDecoder(f).Decode(&newCfg); err != nil {
-		// 不正なJSON形式は、管理者による編集ミスの可能性があるが、システム内処理としてInternalで記録する。
-		logger.Logf("Internal", "Config", "設定のパース（JSON）に失敗しました: %v", err)
+	// 設定ファイルに含まれない一時的な権限を、新しい設定へ引き継ぐ。
+	newCfg = withGrants(newCfg, c.appliedGrants())
+	prev := c.current.Load()
+	c.current.Store(&snapshot{config: newCfg, loadedAt: time.Now()})
+	if err := logger.Configure(newCfg.Log.Options()); err != nil {
+		logger.Errorf("Internal", "Config", "ログの出力先を開けません: %v", err)
+	}
+	if prev == nil {
+		logger.Log("Internal", "Config", "設定ファイルが再読み込みされました")
 		return
 	}
 
-	c.Config = newCfg
-	info, err := f.Stat()
-	if err != nil {
-		logger.Logf("Internal", "Config", "ファイル情報の取得に失敗しました: %v", err)
+	// 何が反映されたかを運用者が確認できるよう、差分を記録して購読者（SSE・Discord 等）へ通知する。
+	diff := Compare(prev.config, newCfg)
+	if diff.Empty() {
+		logger.Log("Internal", "Config", "設定ファイルが再読み込みされました（変更なし）")
 		return
 	}
-	c.LastLoaded = info.ModTime()
-	logger.Log("Internal", "Config", "設定ファイルが再読み込みされました")
+	logger.Logf("Internal", "Config", "設定ファイルが再読み込みされました: %s", diff)
+	c.diffs.Publish(diff)
 }
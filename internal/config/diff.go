@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/play-bin/internal/pubsub"
+)
+
+// MARK: Diff
+// 再読み込みによって適用された設定の差分。値そのものは秘密情報を含み得るため、変更されたキーのパスのみを保持する。
+type Diff struct {
+	Time    time.Time `json:"time"`
+	Servers Changes   `json:"servers"`
+	Users   Changes   `json:"users"`
+	Global  []string  `json:"global,omitempty"` // servers / users 以外で変更されたキー (例: httpListen, dockerHosts.remote.host)
+}
+
+// Changes は名前付きの定義（サーバー・ユーザー）ごとの追加・削除・変更。
+type Changes struct {
+	Added   []string            `json:"added,omitempty"`
+	Removed []string            `json:"removed,omitempty"`
+	Changed map[string][]string `json:"changed,omitempty"` // 名前 → 変更されたキー (例: compose.network.mapping.25565)
+}
+
+// Empty は差分が無いかを返す。
+func (d Diff) Empty() bool {
+	return d.Servers.empty() && d.Users.empty() && len(d.Global) == 0
+}
+
+func (c Changes) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// String はログ出力用に差分を 1 行で要約する (例: "servers: +lobby -old ~mc(compose.restart); users: ~alice(password)")。
+func (d Diff) String() string {
+	var parts []string
+	if s := d.Servers.String(); s != "" {
+		parts = append(parts, "servers: "+s)
+	}
+	if s := d.Users.String(); s != "" {
+		parts = append(parts, "users: "+s)
+	}
+	if len(d.Global) > 0 {
+		parts = append(parts, "global: "+strings.Join(d.Global, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (c Changes) String() string {
+	var parts []string
+	for _, name := range c.Added {
+		parts = append(parts, "+"+name)
+	}
+	for _, name := range c.Removed {
+		parts = append(parts, "-"+name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Changed)) {
+		parts = append(parts, fmt.Sprintf("~%s(%s)", name, strings.Join(c.Changed[name], ", ")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// MARK: Compare()
+// 2 つの設定の差分を求める。
+func Compare(before, after Config) Diff {
+	d := Diff{
+		Time:    time.Now(),
+		Servers: compareNamed(before.Servers, after.Servers),
+		Users:   compareNamed(before.Users, after.Users),
+	}
+	// servers / users を除いた残りを比較する。
+	before.Servers, after.Servers, before.Users, after.Users = nil, nil, nil, nil
+	d.Global = changedPaths(toGeneric(before), toGeneric(after), "")
+	return d
+}
+
+func compareNamed[T any](before, after map[string]T) Changes {
+	var c Changes
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		prev, ok := before[name]
+		if !ok {
+			c.Added = append(c.Added, name)
+			continue
+		}
+		if paths := changedPaths(toGeneric(prev), toGeneric(after[name]), ""); len(paths) > 0 {
+			if c.Changed == nil {
+				c.Changed = make(map[string][]string)
+			}
+			c.Changed[name] = paths
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(before)) {
+		if _, ok := after[name]; !ok {
+			c.Removed = append(c.Removed, name)
+		}
+	}
+	return c
+}
+
+// toGeneric は JSON の表現（キーは json タグ）で比較するため、値を汎用の値へ変換する。
+func toGeneric(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var g any
+	_ = json.Unmarshal(b, &g)
+	return g
+}
+
+// changedPaths はオブジェクトを辿り、値が異なるキーのパスを返す。配列は要素単位ではなく配列全体を 1 つの値として扱う。
+func changedPaths(before, after any, path string) []string {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	bm, beforeIsMap := before.(map[string]any)
+	am, afterIsMap := after.(map[string]any)
+	if !beforeIsMap || !afterIsMap {
+		if reflect.DeepEqual(before, after) {
+			return nil
+		}
+		return []string{path}
+	}
+
+	keys := make(map[string]bool)
+	for k := range bm {
+		keys[k] = true
+	}
+	for k := range am {
+		keys[k] = true
+	}
+	var paths []string
+	for _, k := range slices.Sorted(maps.Keys(keys)) {
+		paths = append(paths, changedPaths(bm[k], am[k], join(k))...)
+	}
+	return paths
+}
+
+// diffHub は再読み込みの差分を購読者へ配信する。
+type diffHub = pubsub.Hub[Diff]
+
+// MARK: Subscribe()
+// 再読み込みで設定が変更されるたびに差分を受信するチャネルと、購読を解除する関数を返す。
+func (c *LoadedConfig) Subscribe() (<-chan Diff, func()) {
+	return c.diffs.Subscribe()
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// candidatePaths は設定ファイルの探索順。既存の config.json を優先し、存在しない場合に YAML / TOML を使用する。
+var candidatePaths = []string{"./config.json", "./config.yaml", "./config.yml", "./config.toml"}
+
+// MARK: DetectPath()
+// カレントディレクトリに存在する設定ファイルのパスを返す。いずれも存在しない場合は config.json を返す。
+func DetectPath() string {
+	for _, p := range candidatePaths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return candidatePaths[0]
+}
+
+// MARK: Decode()
+// 拡張子に応じて設定ファイルの内容を解釈する。
+// YAML / TOML は一度汎用の値へ読み込んでから JSON を経由して Config へ変換し、構造体のタグ（json）を唯一の定義として保つ。
+func Decode(path string, data []byte) (Config, error) {
+	var cfg Config
+	err := decodeInto(path, data, &cfg)
+	return cfg, err
+}
+
+// decodeInto は拡張子に応じて data を解釈し、v へ格納する。
+func decodeInto(path string, data []byte, v any) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var g any
+		if err := yaml.Unmarshal(data, &g); err != nil {
+			return fmt.Errorf("yaml: %w", err)
+		}
+		return fromGeneric(g, v)
+	case ".toml":
+		var g map[string]any
+		if err := toml.Unmarshal(data, &g); err != nil {
+			return fmt.Errorf("toml: %w", err)
+		}
+		return fromGeneric(g, v)
+	default:
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+			return fmt.Errorf("json: %w", withPosition(data, err))
+		}
+		return nil
+	}
+}
+
+// decodeGeneric は拡張子に応じて data を汎用の値（map[string]any 等）として読み込む。未知のキーの検出に使用する。
+func decodeGeneric(path string, data []byte) (any, error) {
+	var g any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &g); err != nil {
+			return nil, err
+		}
+		return normalizeKeys(g), nil
+	case ".toml":
+		var m map[string]any
+		if err := toml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		if err := json.Unmarshal(data, &g); err != nil {
+			return nil, err
+		}
+		return integerize(g), nil
+	}
+}
+
+// withPosition は JSON のエラーに含まれるバイト位置を行・列に変換し、編集箇所を特定しやすくする。
+func withPosition(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+	offset = min(offset, int64(len(data)))
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	col := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Errorf("line %d, column %d: %w", line, col, err)
+}
+
+// isConfigFile は設定ファイルとして解釈できる拡張子であるかを返す。
+func isConfigFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	}
+	return false
+}
+
+// fromGeneric は YAML / TOML から読み込んだ汎用の値を、JSON を経由して構造体へ変換する。
+func fromGeneric(g any, v any) error {
+	b, err := json.Marshal(normalizeKeys(g))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// normalizeKeys は YAML で数値等をキーにしたマップ (例: network.mapping の 25565: "25565") を、文字列キーのマップへ変換する。
+func normalizeKeys(v any) any {
+	switch t := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalizeKeys(val)
+		}
+		return m
+	case map[string]any:
+		for k, val := range t {
+			t[k] = normalizeKeys(val)
+		}
+		return t
+	case []any:
+		for i, val := range t {
+			t[i] = normalizeKeys(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+var (
+	ErrGrantNotFound = errors.New("grant not found")
+	ErrInvalidGrant  = errors.New("invalid grant")
+)
+
+// maxGrantDuration は一時的な権限の最長の有効期間。付与したまま忘れられた権限が実質的に恒久化することを防ぐ。
+const maxGrantDuration = 30 * 24 * time.Hour
+
+// MARK: Grant
+// 期限付きで付与された権限。設定ファイルを編集せずに、イベントの進行役へ一時的にコンソール操作を許可する等の用途に使用する。
+// 期限を過ぎると判定の対象外となり、その後の掃除で一覧からも削除される。
+type Grant struct {
+	ID          string    `json:"id"`
+	User        string    `json:"user"`
+	Server      string    `json:"server"` // "*" は全サーバー、"tag:<pattern>" はタグが一致するサーバー
+	Permissions []string  `json:"permissions"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// Active は now の時点で権限が有効かを判定する。
+func (g Grant) Active(now time.Time) bool {
+	return now.Before(g.ExpiresAt)
+}
+
+// grantStore は一時的な権限の一覧と、その保存先。LoadedConfig の grantsMu で保護する。
+type grantStore struct {
+	path  string
+	list  []Grant
+	timer *time.Timer // 次に期限を迎える権限の掃除
+	// applied は Reload が grantsMu を取得せずに参照できるよう、反映済みの一覧を保持する。
+	applied atomic.Pointer[[]Grant]
+}
+
+// MARK: LoadGrants()
+// 前回までに付与した一時的な権限をファイルから読み込み、設定へ反映する。ファイルが存在しない場合は空の一覧から始める。
+// 以降の付与・取り消しは同じファイルへ保存する。
+func (c *LoadedConfig) LoadGrants(path string) error {
+	c.grantsMu.Lock()
+	defer c.grantsMu.Unlock()
+	c.grants.path = path
+
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &c.grants.list); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	c.pruneGrantsLocked()
+	c.applyGrantsLocked()
+	return nil
+}
+
+// MARK: Grants()
+// 有効な一時的な権限を、期限の近い順で返す。
+func (c *LoadedConfig) Grants() []Grant {
+	c.grantsMu.Lock()
+	defer c.grantsMu.Unlock()
+	now := time.Now()
+	var list []Grant
+	for _, g := range c.grants.list {
+		if g.Active(now) {
+			list = append(list, g)
+		}
+	}
+	slices.SortFunc(list, func(a, b Grant) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	return list
+}
+
+// MARK: AddGrant()
+// 一時的な権限を付与し、即座に判定へ反映する。ID と作成時刻は自動で設定する。
+// ユーザーとサーバー ("*" を除く) は設定に定義されている必要があり、期限は未来かつ 30 日以内とする。
+func (c *LoadedConfig) AddGrant(g Grant) (Grant, error) {
+	now := time.Now()
+	cfg := c.Get()
+	switch {
+	case g.User == "":
+		return Grant{}, fmt.Errorf("%w: user is required", ErrInvalidGrant)
+	case g.Server == "":
+		return Grant{}, fmt.Errorf("%w: server is required", ErrInvalidGrant)
+	case len(g.Permissions) == 0:
+		return Grant{}, fmt.Errorf("%w: permissions are required", ErrInvalidGrant)
+	case !g.Active(now):
+		return Grant{}, fmt.Errorf("%w: expiresAt must be in the future", ErrInvalidGrant)
+	case g.ExpiresAt.Sub(now) > maxGrantDuration:
+		return Grant{}, fmt.Errorf("%w: expiresAt must be within %s", ErrInvalidGrant, maxGrantDuration)
+	}
+	if _, ok := cfg.Users[g.User]; !ok {
+		return Grant{}, fmt.Errorf("%w: user %q is not defined", ErrInvalidGrant, g.User)
+	}
+	for _, perm := range g.Permissions {
+		if !ValidPermissionScope(perm) {
+			return Grant{}, fmt.Errorf("%w: invalid scoped permission %q", ErrInvalidGrant, perm)
+		}
+	}
+	if pattern, ok := TagSelector(g.Server); ok {
+		if !validTagPattern(pattern) || len(cfg.ServersWithTag(pattern)) == 0 {
+			return Grant{}, fmt.Errorf("%w: no server has a tag matching %q", ErrInvalidGrant, pattern)
+		}
+	} else if _, ok := cfg.Servers[g.Server]; !ok && g.Server != "*" {
+		return Grant{}, fmt.Errorf("%w: server %q is not defined", ErrInvalidGrant, g.Server)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Grant{}, err
+	}
+	g.ID = hex.EncodeToString(id)
+	g.CreatedAt = now
+
+	c.grantsMu.Lock()
+	defer c.grantsMu.Unlock()
+	c.grants.list = append(c.grants.list, g)
+	c.applyGrantsLocked()
+	logger.Logf("Internal", "Config", "一時的な権限を付与しました: id=%s, user=%s, server=%s, perms=%v, expires=%s, by=%s",
+		g.ID, g.User, g.Server, g.Permissions, g.ExpiresAt.Format(time.RFC3339), g.CreatedBy)
+	return g, c.saveGrantsLocked()
+}
+
+// MARK: RevokeGrant()
+// 一時的な権限を期限前に取り消す。
+func (c *LoadedConfig) RevokeGrant(id string) error {
+	c.grantsMu.Lock()
+	defer c.grantsMu.Unlock()
+	i := slices.IndexFunc(c.grants.list, func(g Grant) bool { return g.ID == id })
+	if i < 0 {
+		return ErrGrantNotFound
+	}
+	g := c.grants.list[i]
+	c.grants.list = slices.Delete(c.grants.list, i, i+1)
+	c.applyGrantsLocked()
+	logger.Logf("Internal", "Config", "一時的な権限を取り消しました: id=%s, user=%s, server=%s", g.ID, g.User, g.Server)
+	return c.saveGrantsLocked()
+}
+
+// appliedGrants は Reload で新しい設定へ引き継ぐ、反映済みの一時的な権限を返す。
+func (c *LoadedConfig) appliedGrants() []Grant {
+	if p := c.grants.applied.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// withGrants は設定のユーザーへ一時的な権限を関連付けた設定を返す。スナップショットのマップを共有しないよう、Users は複製する。
+func withGrants(cfg Config, grants []Grant) Config {
+	users := make(map[string]UserConfig, len(cfg.Users))
+	for name, u := range cfg.Users {
+		u.Grants = nil
+		for _, g := range grants {
+			if g.User == name {
+				u.Grants = append(u.Grants, g)
+			}
+		}
+		users[name] = u
+	}
+	cfg.Users = users
+	return cfg
+}
+
+// applyGrantsLocked は現在の設定へ一時的な権限を反映し、次に期限を迎える権限の掃除を予約する。
+func (c *LoadedConfig) applyGrantsLocked() {
+	applied := slices.Clone(c.grants.list)
+	c.grants.applied.Store(&applied)
+	c.mu.Lock()
+	if snap := c.current.Load(); snap != nil {
+		// 権限の判定に依存するキャッシュが更新されるよう、適用時刻も更新する。
+		c.current.Store(&snapshot{config: withGrants(snap.config, c.grants.list), loadedAt: time.Now()})
+	}
+	c.mu.Unlock()
+
+	if c.grants.timer != nil {
+		c.grants.timer.Stop()
+		c.grants.timer = nil
+	}
+	if len(c.grants.list) == 0 {
+		return
+	}
+	next := slices.MinFunc(c.grants.list, func(a, b Grant) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	c.grants.timer = time.AfterFunc(time.Until(next.ExpiresAt), func() {
+		c.grantsMu.Lock()
+		defer c.grantsMu.Unlock()
+		pruned := c.pruneGrantsLocked()
+		// 削除の有無に関わらず、次に期限を迎える権限の掃除を予約し直す。
+		c.applyGrantsLocked()
+		if pruned {
+			if err := c.saveGrantsLocked(); err != nil {
+				logger.Errorf("Internal", "Config", "一時的な権限の保存に失敗: %v", err)
+			}
+		}
+	})
+}
+
+// pruneGrantsLocked は期限を過ぎた権限を一覧から削除する。削除した場合は true を返す。
+func (c *LoadedConfig) pruneGrantsLocked() bool {
+	now := time.Now()
+	before := len(c.grants.list)
+	c.grants.list = slices.DeleteFunc(c.grants.list, func(g Grant) bool {
+		if g.Active(now) {
+			return false
+		}
+		logger.Logf("Internal", "Config", "一時的な権限が期限切れとなりました: id=%s, user=%s, server=%s", g.ID, g.User, g.Server)
+		return true
+	})
+	return len(c.grants.list) != before
+}
+
+// saveGrantsLocked は一時的な権限の一覧をファイルへ保存する。LoadGrants を呼び出していない場合は保存しない。
+func (c *LoadedConfig) saveGrantsLocked() error {
+	if c.grants.path == "" {
+		return nil
+	}
+	list := c.grants.list
+	if list == nil {
+		list = []Grant{}
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(c.grants.path, append(b, '\n'), 0o600)
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/play-bin/internal/fsutil"
+)
+
+// legacyControlPermissions は旧形式の controllable に一致したサーバーへ付与する権限。
+// 旧形式ではサーバーの操作 (起動・停止・バックアップ等)・コンソール・ファイルを区別しなかったため、その範囲に相当する権限とする。
+// コンテナ内での任意コマンドの実行・root でのターミナル・共有リンク・ホスト間の移行は含めない。
+var legacyControlPermissions = []string{PermContainerRead, PermContainerWrite, PermContainerExecute, PermFileRead, PermFileWrite}
+
+// MARK: MigrateLegacy()
+// 旧形式の設定 (トップレベルの listen と、ユーザーの controllable) を現在の形式 (httpListen と permissions) へ変換する。
+// 変換した場合は元の内容を config-backups へ保存してから書き換え、変換の内容とバックアップのパスを返す。旧形式の項目が無い場合とファイルが存在しない場合は何もしない。
+// controllable のパターン ("*" やワイルドカードを含むサーバー名) は、servers.d を含む現在のサーバー定義と照合して展開する。
+func (c *LoadedConfig) MigrateLegacy() (changes []string, backup string, err error) {
+	data, err := os.ReadFile(c.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	g, err := decodeGeneric(c.Path, data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", c.Path, err)
+	}
+	root, ok := g.(map[string]any)
+	if !ok {
+		return nil, "", fmt.Errorf("%s: top level must be an object", c.Path)
+	}
+	if !isLegacy(root) {
+		return nil, "", nil
+	}
+	// サーバー名の一覧のみを使用するため、旧形式の項目による検証の問題は無視する。
+	cfg, _, err := Load(c.Path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if key, ok := findKey(root, "listen"); ok {
+		if _, exists := findKey(root, "httpListen"); exists {
+			changes = append(changes, fmt.Sprintf("removed %s (httpListen is already set)", key))
+		} else {
+			root["httpListen"] = root[key]
+			changes = append(changes, fmt.Sprintf("%s -> httpListen", key))
+		}
+		delete(root, key)
+	}
+
+	usersKey, _ := findKey(root, "users")
+	users, _ := root[usersKey].(map[string]any)
+	for _, name := range slices.Sorted(maps.Keys(users)) {
+		user, ok := users[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		key, ok := findKey(user, "controllable")
+		if !ok {
+			continue
+		}
+		permsKey, ok := findKey(user, "permissions")
+		if !ok {
+			permsKey = "permissions"
+		}
+		perms, _ := user[permsKey].(map[string]any)
+		if perms == nil {
+			perms = make(map[string]any)
+		}
+		for _, pattern := range legacyPatterns(user[key]) {
+			targets := expandLegacyPattern(cfg, pattern)
+			if len(targets) == 0 {
+				changes = append(changes, fmt.Sprintf("users.%s.%s: %q matches no server and was dropped", name, key, pattern))
+				continue
+			}
+			for _, target := range targets {
+				perms[target] = mergePermissions(perms[target], legacyControlPermissions)
+			}
+			changes = append(changes, fmt.Sprintf("users.%s.%s: %q -> permissions for %s", name, key, pattern, strings.Join(targets, ", ")))
+		}
+		user[permsKey] = perms
+		delete(user, key)
+	}
+
+	content, err := encodeGeneric(c.Path, root)
+	if err != nil {
+		return nil, "", err
+	}
+	if backup, err = c.backupFile(c.Path); err != nil {
+		return nil, "", fmt.Errorf("failed to back up %s: %w", c.Path, err)
+	}
+	if err := fsutil.WriteFile(c.Path, content, 0o600); err != nil {
+		return nil, backup, err
+	}
+	return changes, backup, nil
+}
+
+// isLegacy は設定に旧形式の項目が含まれるかを返す。
+func isLegacy(root map[string]any) bool {
+	if _, ok := findKey(root, "listen"); ok {
+		return true
+	}
+	usersKey, _ := findKey(root, "users")
+	users, _ := root[usersKey].(map[string]any)
+	for _, u := range users {
+		if user, ok := u.(map[string]any); ok {
+			if _, ok := findKey(user, "controllable"); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findKey は encoding/json と同じく大文字・小文字を区別せずにキーを探し、実際のキーを返す。
+func findKey(m map[string]any, name string) (string, bool) {
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// legacyPatterns は controllable の値 (文字列の配列、または単一の文字列) をパターンの一覧として返す。
+func legacyPatterns(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var patterns []string
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "" {
+				patterns = append(patterns, s)
+			}
+		}
+		return patterns
+	}
+	return nil
+}
+
+// expandLegacyPattern はパターンを permissions のキーへ変換する。"*" は全サーバー、ワイルドカードを含む場合は一致する全てのサーバー。
+func expandLegacyPattern(cfg Config, pattern string) []string {
+	if pattern == "*" {
+		return []string{"*"}
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}
+	}
+	var targets []string
+	for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		if ok, _ := path.Match(pattern, name); ok {
+			targets = append(targets, name)
+		}
+	}
+	return targets
+}
+
+// mergePermissions は既存の権限の一覧に、含まれていない権限を追加する。
+func mergePermissions(current any, add []string) []any {
+	list, _ := current.([]any)
+	for _, p := range add {
+		if !slices.Contains(list, any(p)) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxPasswordLength は bcrypt でハッシュ化できるパスワードの最大のバイト数。これを超えるパスワードは設定できない。
+const MaxPasswordLength = 72
+
+// ErrPasswordTooLong はパスワードが MaxPasswordLength バイトを超えていることを示す。
+var ErrPasswordTooLong = errors.New("password must be at most 72 bytes")
+
+// maxVerifiedPasswords は verifiedPasswords に保持する件数の上限。
+const maxVerifiedPasswords = 256
+
+// verifiedPasswords は照合に成功したパスワードの SHA-256 を、bcrypt のハッシュごとに 1 件記憶する。照合に失敗した入力は記憶しない。
+// パスワードが変更されるとハッシュが変わるため古い項目は使われず、上限を超えた時点で破棄される。
+var verifiedPasswords = struct {
+	mu      sync.Mutex
+	entries map[string][sha256.Size]byte
+}{entries: make(map[string][sha256.Size]byte)}
+
+// MARK: HashPassword()
+// パスワードを bcrypt でハッシュ化する。結果はユーザー定義の password にそのまま設定できる。
+// MaxPasswordLength バイトを超える場合は ErrPasswordTooLong を返す。
+func HashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// IsPasswordHash は password の値が bcrypt のハッシュ ($2a$ / $2b$ / $2y$) であるかを判定する。
+func IsPasswordHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// MARK: CheckPassword()
+// 入力されたパスワードがユーザーのパスワードと一致するかを判定する。
+// 設定値が bcrypt のハッシュであれば照合し、それ以外は従来の平文として比較する。空のパスワードは常に不一致とする。
+func (u UserConfig) CheckPassword(password string) bool {
+	if u.Password == "" {
+		return false
+	}
+	if IsPasswordHash(u.Password) {
+		// WebDAV はリクエストごとに Basic 認証を行うため、一致した組み合わせを記憶して bcrypt の計算を繰り返さない。
+		digest := sha256.Sum256([]byte(password))
+		verifiedPasswords.mu.Lock()
+		known, ok := verifiedPasswords.entries[u.Password]
+		verifiedPasswords.mu.Unlock()
+		if ok && subtle.ConstantTimeCompare(known[:], digest[:]) == 1 {
+			return true
+		}
+		if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
+			return false
+		}
+		rememberPassword(u.Password, digest)
+		return true
+	}
+	// 応答時間からパスワードを推測されないよう、一定時間で比較する。
+	return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+}
+
+// rememberPassword は照合に成功したパスワードを記憶する。上限に達している場合は任意の 1 件を破棄する。
+func rememberPassword(hash string, digest [sha256.Size]byte) {
+	verifiedPasswords.mu.Lock()
+	defer verifiedPasswords.mu.Unlock()
+	if _, ok := verifiedPasswords.entries[hash]; !ok && len(verifiedPasswords.entries) >= maxVerifiedPasswords {
+		for k := range verifiedPasswords.entries {
+			delete(verifiedPasswords.entries, k)
+			break
+		}
+	}
+	verifiedPasswords.entries[hash] = digest
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxPortRange は 1 つのマッピングで公開できるポートの数の上限。Docker はポートごとに待ち受けを作成するため、誤記による大量の公開を防ぐ。
+const maxPortRange = 1000
+
+// MARK: PortMapping
+// network.mapping の 1 項目を解釈したもの。キーは "[hostIP:]hostPort[-end][/proto]"、値は "containerPort[-end][/proto]" の形式とする。
+// 例: "25565": "25565", "19132/udp": "19132", "127.0.0.1:25575": "25575", "27015-27020/udp": "27015-27020"
+type PortMapping struct {
+	HostIP        string // 空の場合は IPv4 と IPv6 の全てのアドレス
+	HostPort      int
+	ContainerPort int
+	Count         int    // 範囲で指定した場合のポートの数 (単一のポートは 1)
+	Protocol      string // "tcp" (既定) または "udp"
+}
+
+// MARK: ParsePortMapping()
+// network.mapping のキーと値を解釈する。プロトコルはキーと値のどちらに記述してもよいが、両方に記述する場合は一致させる。
+func ParsePortMapping(host, container string) (PortMapping, error) {
+	var m PortMapping
+	hostPorts, hostProto, _ := strings.Cut(host, "/")
+	containerPorts, containerProto, _ := strings.Cut(container, "/")
+	if hostProto != "" && containerProto != "" && hostProto != containerProto {
+		return m, fmt.Errorf("protocol mismatch between %q and %q", host, container)
+	}
+	m.Protocol = cmp.Or(hostProto, containerProto, "tcp")
+	if m.Protocol != "tcp" && m.Protocol != "udp" {
+		return m, fmt.Errorf("unknown protocol %q (expected tcp or udp)", m.Protocol)
+	}
+
+	// "[::1]:25565" や "127.0.0.1:25565" のように、最後の ':' より前をアドレスとする。
+	// IPv6 のアドレスはポートと区別できるよう角括弧で囲む ("[::]:25565" で IPv6 のみ、アドレスの省略で IPv4 と IPv6 の両方)。
+	if i := strings.LastIndexByte(hostPorts, ':'); i >= 0 {
+		ip := hostPorts[:i]
+		hostPorts = hostPorts[i+1:]
+		bracketed := strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]")
+		if bracketed {
+			ip = ip[1 : len(ip)-1]
+		}
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || addr.Zone() != "" {
+			return m, fmt.Errorf("invalid host ip %q", ip)
+		}
+		if addr.Is6() != bracketed {
+			return m, fmt.Errorf("host ip %q must be enclosed in brackets only if it is an IPv6 address", ip)
+		}
+		m.HostIP = addr.String()
+	}
+
+	var hostCount, containerCount int
+	var err error
+	if m.HostPort, hostCount, err = parsePortRange(hostPorts); err != nil {
+		return m, fmt.Errorf("invalid host port %q: %w", hostPorts, err)
+	}
+	if m.ContainerPort, containerCount, err = parsePortRange(containerPorts); err != nil {
+		return m, fmt.Errorf("invalid container port %q: %w", containerPorts, err)
+	}
+	if hostCount != containerCount {
+		return m, fmt.Errorf("port ranges %q and %q have different lengths", hostPorts, containerPorts)
+	}
+	m.Count = hostCount
+	return m, nil
+}
+
+// parsePortRange は "25565" または "27015-27020" を解釈し、先頭のポートと数を返す。
+func parsePortRange(s string) (port, count int, err error) {
+	first, last, isRange := strings.Cut(s, "-")
+	if port, err = parsePortNumber(first); err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return port, 1, nil
+	}
+	end, err := parsePortNumber(last)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < port {
+		return 0, 0, fmt.Errorf("range end %d is lower than start %d", end, port)
+	}
+	if end-port+1 > maxPortRange {
+		return 0, 0, fmt.Errorf("range exceeds %d ports", maxPortRange)
+	}
+	return port, end - port + 1, nil
+}
+
+// parsePortNumber は 1〜65535 のポート番号を解釈する。
+func parsePortNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 || n > 65535 {
+		return 0, fmt.Errorf("expected a number between 1 and 65535")
+	}
+	return n, nil
+}
+
+// MARK: PortMappings()
+// network.mapping を解釈し、ホスト側のポートの順で返す。解釈できない項目は含めない (設定の検証で報告する)。
+func (n NetworkConfig) PortMappings() []PortMapping {
+	var out []PortMapping
+	for _, host := range slices.Sorted(maps.Keys(n.Mapping)) {
+		if m, err := ParsePortMapping(host, n.Mapping[host]); err == nil {
+			out = append(out, m)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b PortMapping) int {
+		return cmp.Or(cmp.Compare(a.HostPort, b.HostPort), strings.Compare(a.Protocol, b.Protocol))
+	})
+	return out
+}
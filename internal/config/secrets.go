@@ -0,0 +1,178 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// envVarPattern は設定値内の環境変数参照 (${NAME}) に一致する。"$${NAME}" は置換せず "${NAME}" として扱う。
+// ${user} や ${vars.x} 等、各機能が独自に置換する小文字の変数と区別するため、大文字・数字・アンダースコアの名前のみを対象とする。
+var envVarPattern = regexp.MustCompile(`\$?\$\{([A-Z_][A-Z0-9_]*)\}`)
+
+// secretFilePrefix で始まる値は、ファイルの内容（末尾の改行を除く）に置き換える。
+const secretFilePrefix = "file://"
+
+// MARK: resolveSecrets()
+// 設定内の全ての文字列値について、環境変数の参照を展開し、"file://" で始まる値をファイルの内容に置き換える。
+// 秘密情報を設定ファイルに平文で記述せず、環境変数やマウントされたシークレットファイルから渡せるようにする。
+// 相対パスのファイルは設定ファイルのディレクトリを基準とする。未定義の環境変数や読み込めないファイルはエラーとして報告する。
+func resolveSecrets(cfg *Config, baseDir string) []Issue {
+	var issues []Issue
+	resolveValue(reflect.ValueOf(cfg).Elem(), "", func(path, s string) string {
+		// 起動コマンドの ${MEMORY_MB} 等は、コンテナの作成時に設定から算出した値で置換する。
+		var keep []string
+		if isStartCommandPath(path) {
+			keep = StartPlaceholders
+		}
+		out, err := resolveString(s, baseDir, keep)
+		if err != nil {
+			issues = append(issues, Issue{Level: LevelError, Path: path, Message: err.Error()})
+			return s
+		}
+		return out
+	})
+	return issues
+}
+
+// resolveString は 1 つの文字列値を解決する。keep に含まれる名前の参照は、後から置換するためそのまま残す。
+func resolveString(s, baseDir string, keep []string) (string, error) {
+	var missing string
+	s = envVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := match[strings.Index(match, "{")+1 : len(match)-1]
+		if slices.Contains(keep, name) {
+			return match
+		}
+		if match[1] == '$' {
+			return match[1:]
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+
+	if path, ok := strings.CutPrefix(s, secretFilePrefix); ok {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		s = strings.TrimRight(string(b), "\r\n")
+	}
+	return s, nil
+}
+
+// resolveValue は構造体・ポインタ・スライス・マップを辿り、文字列値を fn の結果で置き換える。マップのキーは変更しない。
+func resolveValue(v reflect.Value, path string, fn func(path, s string) string) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			resolveValue(v.Elem(), path, fn)
+		}
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(fn(path, v.String()))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				name = f.Name
+			}
+			resolveValue(v.Field(i), join(name), fn)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case reflect.Map:
+		// マップの要素はアドレスを取れないため、コピーを解決してから書き戻す。
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			resolveValue(elem, join(fmt.Sprint(iter.Key().Interface())), fn)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+}
+
+// redactedValue は秘密情報を伏せた値。
+const redactedValue = "********"
+
+// MARK: Redact()
+// API で設定を返す際に、パスワードやトークン等の秘密情報を伏せた複製を返す。元の設定（共有のスナップショット）は変更しない。
+func Redact(cfg Config) Config {
+	// マップを共有しないよう、JSON を経由して複製する。
+	var out Config
+	if b, err := json.Marshal(cfg); err == nil {
+		_ = json.Unmarshal(b, &out)
+	}
+	mask := func(s *string) {
+		if *s != "" {
+			*s = redactedValue
+		}
+	}
+
+	for name, r := range out.Registries {
+		mask(&r.Password)
+		mask(&r.IdentityToken)
+		out.Registries[name] = r
+	}
+	if out.CurseForge != nil {
+		mask(&out.CurseForge.APIKey)
+	}
+	if out.Notifications != nil {
+		mask(&out.Notifications.SMTP.Password)
+		for name, ch := range out.Notifications.Channels {
+			mask(&ch.Token)
+			if ch.Type == ChannelDiscord {
+				mask(&ch.URL) // URL にトークンを含む
+			}
+			for k, v := range ch.Headers {
+				mask(&v)
+				ch.Headers[k] = v
+			}
+			out.Notifications.Channels[name] = ch
+		}
+	}
+	for name, u := range out.Users {
+		mask(&u.Password)
+		out.Users[name] = u
+	}
+	for name, s := range out.Servers {
+		if s.Discord != nil {
+			mask(&s.Discord.Token)
+			mask(&s.Discord.Webhook) // URL にトークンを含む
+		}
+		if s.RCON != nil {
+			mask(&s.RCON.Password)
+		}
+		out.Servers[name] = s
+	}
+	return out
+}
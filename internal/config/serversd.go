@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/play-bin/internal/logger"
+)
+
+// serversDirName は 1 サーバー 1 ファイルで定義を配置するディレクトリ名。メインの設定ファイルと同じ階層に置く。
+const serversDirName = "servers.d"
+
+// serversDir はメインの設定ファイルに対応する servers.d のパスを返す。
+func serversDir(mainPath string) string {
+	return filepath.Join(filepath.Dir(mainPath), serversDirName)
+}
+
+// MARK: loadServerFiles()
+// servers.d 内の各ファイル（<サーバー名>.json / .yaml / .yml / .toml）を ServerConfig として読み込み、cfg.Servers へ統合する。
+// メインの設定ファイルと同名のサーバーがある場合は、servers.d のファイルを優先する。各ファイルの未知のキーを issues として返す。
+// overrides に含まれるファイルは、ディスク上の内容の代わりに指定された内容を使用する（nil は削除）。
+func loadServerFiles(dir string, cfg *Config, overrides map[string][]byte) ([]Issue, error) {
+	files, err := serverFiles(dir, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	loadedFrom := make(map[string]string)
+	for _, file := range files {
+		name := strings.TrimSuffix(file, filepath.Ext(file))
+		if prev, ok := loadedFrom[name]; ok {
+			return nil, fmt.Errorf("server %s is defined in both %s and %s", name, prev, file)
+		}
+
+		path := filepath.Join(dir, file)
+		data, err := readFile(path, overrides)
+		if err != nil {
+			return nil, err
+		}
+		var serverCfg ServerConfig
+		if err := decodeInto(path, data, &serverCfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		issues = append(issues, unknownKeys(path, data, reflect.TypeFor[ServerConfig](), "servers."+name)...)
+
+		if cfg.Servers == nil {
+			cfg.Servers = make(map[string]ServerConfig)
+		}
+		if _, ok := cfg.Servers[name]; ok {
+			logger.Logf("Internal", "Config", "サーバー %s はメインの設定と %s の両方に定義されています。%s を使用します", name, file, file)
+		}
+		cfg.Servers[name] = serverCfg
+		loadedFrom[name] = file
+	}
+	return issues, nil
+}
+
+// serverFiles は servers.d 内のサーバー定義ファイル名を名前順に返す。overrides で追加・削除されるファイルも反映する。
+func serverFiles(dir string, overrides map[string][]byte) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, e := range entries {
+		// エディタの一時ファイル等を誤って読み込まないよう、隠しファイルは除外する。
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !isConfigFile(e.Name()) {
+			continue
+		}
+		names[e.Name()] = true
+	}
+	for path, data := range overrides {
+		if filepath.Dir(path) == filepath.Clean(dir) {
+			names[filepath.Base(path)] = data != nil
+		}
+	}
+
+	var files []string
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		if names[name] {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// latestModTime はメインの設定ファイルと servers.d（ディレクトリ自体と各ファイル）の最終更新時刻のうち最も新しいものを返す。
+// ディレクトリの更新時刻はファイルの追加・削除で変化するため、削除の検知にも使用できる。
+func latestModTime(mainPath string) (time.Time, error) {
+	info, err := os.Stat(mainPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	latest := info.ModTime()
+
+	dir := serversDir(mainPath)
+	if dirInfo, err := os.Stat(dir); err == nil {
+		if dirInfo.ModTime().After(latest) {
+			latest = dirInfo.ModTime()
+		}
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if e.IsDir() || !isConfigFile(e.Name()) {
+				continue
+			}
+			if fi, err := e.Info(); err == nil && fi.ModTime().After(latest) {
+				latest = fi.ModTime()
+			}
+		}
+	}
+	return latest, nil
+}
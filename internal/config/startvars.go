@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+// 起動コマンド (compose.command) で参照できる、コンテナの設定から算出する値。
+// メモリの上限を変更した際に、-Xmx 等の起動オプションを書き換え忘れないよう、コンテナの作成時に置換する。
+const (
+	PlaceholderMemoryMB   = "MEMORY_MB"   // compose.resources.memory (MiB)
+	PlaceholderHeapMB     = "HEAP_MB"     // MEMORY_MB のうち heapPercent の割合 (MiB)
+	PlaceholderJVMMemory  = "JVM_MEMORY"  // "-Xms<HEAP_MB>M -Xmx<HEAP_MB>M"
+	PlaceholderCPUs       = "CPUS"        // compose.resources.cpus
+	PlaceholderServerPort = "SERVER_PORT" // 公開するポートのうち、ホスト側の番号が最も小さいもののコンテナ側の番号
+)
+
+// StartPlaceholders は起動コマンドで参照できる値の名前。
+var StartPlaceholders = []string{PlaceholderMemoryMB, PlaceholderHeapMB, PlaceholderJVMMemory, PlaceholderCPUs, PlaceholderServerPort}
+
+// defaultHeapPercent は resources.heapPercent を省略した場合の、ヒープに充てるメモリの割合。
+// メタスペースやスレッドスタック等のヒープ外の使用量で、コンテナの上限を超えないよう余裕を残す。
+const defaultHeapPercent = 75
+
+// startPlaceholderPattern は起動コマンド内の ${MEMORY_MB} 等に一致する。"$${NAME}" は置換せず "${NAME}" として出力する。
+var startPlaceholderPattern = regexp.MustCompile(`\$?\$\{(` + strings.Join(StartPlaceholders, "|") + `)\}`)
+
+// MARK: MemoryBytes()
+// メモリの上限をバイト数で返す。未指定の場合は 0 を返す。
+func (r *ResourcesConfig) MemoryBytes() (int64, error) {
+	if r == nil || r.Memory == "" {
+		return 0, nil
+	}
+	return units.RAMInBytes(r.Memory)
+}
+
+// MARK: StartVars()
+// 起動コマンドの置換に使用する値を返す。算出できない値 (メモリの上限が無い場合の MEMORY_MB 等) は含めない。
+func (c *ComposeConfig) StartVars() map[string]string {
+	vars := make(map[string]string)
+	if c == nil {
+		return vars
+	}
+	if r := c.Resources; r != nil {
+		if mem, err := r.MemoryBytes(); err == nil && mem > 0 {
+			memoryMB := mem / units.MiB
+			percent := r.HeapPercent
+			if percent <= 0 {
+				percent = defaultHeapPercent
+			}
+			heapMB := memoryMB * int64(percent) / 100
+			vars[PlaceholderMemoryMB] = strconv.FormatInt(memoryMB, 10)
+			vars[PlaceholderHeapMB] = strconv.FormatInt(heapMB, 10)
+			vars[PlaceholderJVMMemory] = fmt.Sprintf("-Xms%dM -Xmx%dM", heapMB, heapMB)
+		}
+		if r.CPUs > 0 {
+			vars[PlaceholderCPUs] = strconv.FormatFloat(r.CPUs, 'f', -1, 64)
+		}
+	}
+	if c.Network.Mode == "" || c.Network.Mode == "bridge" {
+		if mappings := c.Network.PortMappings(); len(mappings) > 0 {
+			vars[PlaceholderServerPort] = strconv.Itoa(mappings[0].ContainerPort)
+		}
+	}
+	return vars
+}
+
+// MARK: ExpandStartCommand()
+// 起動コマンドの ${MEMORY_MB} 等を vars の値で置換する。それ以外の ${...} は変更しない。
+// 参照した値を算出できない場合は、必要な設定と共にエラーを返す。
+func ExpandStartCommand(s string, vars map[string]string) (string, error) {
+	var missing string
+	out := startPlaceholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match[1] == '$' {
+			return match[1:]
+		}
+		name := match[2 : len(match)-1]
+		v, ok := vars[name]
+		if !ok && missing == "" {
+			missing = name
+		}
+		return v
+	})
+	switch missing {
+	case "":
+		return out, nil
+	case PlaceholderCPUs:
+		return "", fmt.Errorf("${%s} requires compose.resources.cpus", missing)
+	case PlaceholderServerPort:
+		return "", fmt.Errorf("${%s} requires compose.network.mapping in bridge mode", missing)
+	default:
+		return "", fmt.Errorf("${%s} requires compose.resources.memory", missing)
+	}
+}
+
+// MARK: ParseStartCommand()
+// 起動コマンドの値を置換した上で、引数へ分割する。"-Dname=My Server" 等の空白を含む引数を指定できるよう、
+// 引用符とエスケープをシェルと同様に解釈する (SplitCommandLine)。
+func ParseStartCommand(s string, vars map[string]string) ([]string, error) {
+	expanded, err := ExpandStartCommand(s, vars)
+	if err != nil {
+		return nil, err
+	}
+	return SplitCommandLine(expanded)
+}
+
+// isStartCommandPath は設定のパスが起動コマンドの値であるかを返す。環境変数の展開で ${MEMORY_MB} 等を残すために使用する。
+func isStartCommandPath(path string) bool {
+	return strings.HasSuffix(path, ".compose.command.entrypoint") || strings.HasSuffix(path, ".compose.command.arguments")
+}
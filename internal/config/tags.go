@@ -0,0 +1,74 @@
+package config
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TagPrefix はサーバー名の代わりにタグでサーバーを指定する際の接頭辞 (例: "tag:events", "tag:survival-*")。
+// 権限の付与・一時的な権限・一括操作の対象に使用できる。
+const TagPrefix = "tag:"
+
+// tagPattern はタグに使用できる文字。権限のキーやクエリにそのまま記述できるよう、記号は限定する。
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// MARK: TagSelector()
+// "tag:<pattern>" 形式の指定からパターンを取り出す。タグの指定でない場合は ok に false を返す。
+func TagSelector(target string) (pattern string, ok bool) {
+	return strings.CutPrefix(target, TagPrefix)
+}
+
+// MARK: MatchTags()
+// タグのいずれかがパターン (path.Match の形式。例: "event-*") に一致するかを返す。
+func MatchTags(pattern string, tags []string) bool {
+	for _, tag := range tags {
+		if ok, _ := path.Match(pattern, tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validTagPattern はタグのパターンとして解釈できるかを返す。
+func validTagPattern(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return pattern != "" && err == nil
+}
+
+// MARK: ServersWithTag()
+// タグがパターンに一致するサーバーの名前を、名前の順で返す。
+func (c Config) ServersWithTag(pattern string) []string {
+	var names []string
+	for name, s := range c.Servers {
+		if MatchTags(pattern, s.Tags) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// appliesTo は権限のキー (サーバー名・"*"・"tag:<pattern>") が serverName のサーバーを対象とするかを返す。
+func (u UserConfig) appliesTo(key, serverName string) bool {
+	if key == serverName || key == "*" {
+		return true
+	}
+	pattern, ok := TagSelector(key)
+	return ok && MatchTags(pattern, u.ServerTags[serverName])
+}
+
+// withServerTags は権限の判定でタグを参照できるよう、各ユーザーへサーバーのタグを関連付ける。
+func withServerTags(cfg *Config) {
+	tags := make(map[string][]string)
+	for name, s := range cfg.Servers {
+		if len(s.Tags) > 0 {
+			tags[name] = s.Tags
+		}
+	}
+	for name, u := range cfg.Users {
+		u.ServerTags = tags
+		cfg.Users[name] = u
+	}
+}
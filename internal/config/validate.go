@@ -0,0 +1,1035 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/netutil"
+)
+
+const (
+	LevelError   = "error"   // 設定として適用すると誤動作するため、再読み込みを拒否する
+	LevelWarning = "warning" // 適用はするが、意図と異なる可能性がある
+)
+
+// MARK: Issue
+// 設定の検証で見つかった問題 1 件。path は問題のあるキーをドット区切りで示す (例: servers.mc.compose.restart)。
+type Issue struct {
+	Level   string `json:"level"`
+	File    string `json:"file,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	var b strings.Builder
+	b.WriteString(i.Level)
+	if i.File != "" {
+		b.WriteString(": " + i.File)
+	}
+	if i.Path != "" {
+		b.WriteString(": " + i.Path)
+	}
+	b.WriteString(": " + i.Message)
+	return b.String()
+}
+
+// MARK: HasErrors()
+// 再読み込みを拒否すべき問題（error）が含まれているかを返す。
+func HasErrors(issues []Issue) bool {
+	return slices.ContainsFunc(issues, func(i Issue) bool { return i.Level == LevelError })
+}
+
+// MARK: Load()
+// 設定ファイルと servers.d を読み込み、統合した設定と検証結果を返す。
+// ファイルの読み込みやパースに失敗した場合は、設定として使用できないため err を返す。
+func Load(path string) (Config, []Issue, error) {
+	return load(path, nil)
+}
+
+// load は Load の本体。overrides はファイルのパスをキーとして、ディスク上の内容の代わりに使用する内容を指定する（nil はファイルの削除として扱う）。
+// API からの変更を、ファイルへ書き込む前に検証するために使用する。
+func load(path string, overrides map[string][]byte) (Config, []Issue, error) {
+	data, err := readFile(path, overrides)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	cfg, err := Decode(path, data)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	issues := unknownKeys(path, data, reflect.TypeFor[Config](), "")
+
+	serverIssues, err := loadServerFiles(serversDir(path), &cfg, overrides)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("%s: %w", serversDirName, err)
+	}
+	issues = append(issues, serverIssues...)
+	issues = append(issues, resolveSecrets(&cfg, filepath.Dir(path))...)
+	issues = append(issues, Validate(cfg)...)
+	withServerTags(&cfg)
+	return cfg, issues, nil
+}
+
+// readFile は overrides に指定があればその内容を、なければディスク上の内容を返す。
+func readFile(path string, overrides map[string][]byte) ([]byte, error) {
+	if data, ok := overrides[path]; ok {
+		if data == nil {
+			return nil, os.ErrNotExist
+		}
+		return data, nil
+	}
+	return os.ReadFile(path)
+}
+
+// MARK: Validate()
+// 読み込んだ設定の値を検証する。型として正しくても実行時に無視・失敗する値（不正な再起動ポリシーや待機時間、存在しないマウント元、重複したポート等）を検出する。
+func Validate(cfg Config) []Issue {
+	var issues []Issue
+	add := func(level, path, format string, args ...any) {
+		issues = append(issues, Issue{Level: level, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, key := range []struct{ path, addr string }{{"httpListen", cfg.HTTPListen}, {"grpcListen", cfg.GRPCListen}, {"sftpListen", cfg.SFTPListen}} {
+		if key.addr != "" && !netutil.ValidListen(key.addr) {
+			add(LevelError, key.path, "invalid listen address %q (expected host:port, e.g. \":8080\" or \"0.0.0.0:8080,[::1]:8080\")", key.addr)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.DockerHosts)) {
+		host := cfg.DockerHosts[name].Host
+		if host != "" && !strings.Contains(host, "://") {
+			add(LevelError, "dockerHosts."+name+".host", "invalid docker host %q (expected unix://, tcp:// or ssh://)", host)
+		}
+		if ssh := cfg.DockerHosts[name].SSH; strings.Contains(ssh, "://") && !strings.HasPrefix(ssh, "ssh://") {
+			add(LevelError, "dockerHosts."+name+".ssh", "invalid ssh destination %q (expected user@host or ssh://user@host:port)", ssh)
+		}
+	}
+	if p := cfg.ContainerPrefix; p != "" && !containerNamePattern.MatchString(p) {
+		add(LevelError, "containerPrefix", "invalid container name prefix %q (expected letters, digits, '_', '.' or '-', starting with a letter or digit)", p)
+	}
+	if root := cfg.StaticRoot; root != "" {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			add(LevelError, "staticRoot", "directory %q does not exist", root)
+		} else {
+			// ディレクトリ内の全てのファイルが認証なしで公開されるため、秘密情報を含むファイルがあれば警告する。
+			secrets := []string{"sftp_host_key", "sessions.json"}
+			for _, p := range candidatePaths {
+				secrets = append(secrets, filepath.Base(p))
+			}
+			for _, name := range secrets {
+				if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+					add(LevelWarning, "staticRoot", "directory %q contains %s, which will be served without authentication", root, name)
+				}
+			}
+		}
+	}
+	if c := cfg.CORS; c != nil {
+		if len(c.AllowedOrigins) == 0 {
+			add(LevelWarning, "cors.allowedOrigins", "no origins are allowed; cross-origin requests will be rejected")
+		}
+		for i, origin := range c.AllowedOrigins {
+			path := fmt.Sprintf("cors.allowedOrigins[%d]", i)
+			switch {
+			case origin == "*":
+				if c.AllowCredentials {
+					add(LevelError, path, "\"*\" cannot be combined with allowCredentials (browsers reject it)")
+				}
+			case !validOrigin(origin):
+				add(LevelError, path, "invalid origin %q (expected scheme://host[:port] without a path, e.g. \"https://panel.example.com\")", origin)
+			}
+		}
+		if c.MaxAge < 0 {
+			add(LevelError, "cors.maxAge", "must not be negative")
+		}
+	}
+	if rl := cfg.RateLimit; rl != nil {
+		for _, v := range []struct {
+			key string
+			n   int
+		}{
+			{"requestsPerMinute", rl.RequestsPerMinute}, {"burst", rl.Burst},
+			{"loginPerMinute", rl.LoginPerMinute}, {"loginBurst", rl.LoginBurst},
+			{"actionsPerMinute", rl.ActionsPerMinute}, {"actionBurst", rl.ActionBurst},
+			{"maxConcurrent", rl.MaxConcurrent},
+		} {
+			if v.n < 0 {
+				add(LevelError, "rateLimit."+v.key, "must not be negative")
+			}
+		}
+	}
+	if m := cfg.Migration; m != nil && m.S3 != "" && !strings.HasPrefix(m.S3, "s3://") {
+		add(LevelError, "migration.s3", "invalid s3 url %q (expected s3://bucket/prefix)", m.S3)
+	}
+	if fw := cfg.Firewall; fw != nil {
+		if !slices.Contains([]string{"nftables", "iptables", "ufw"}, fw.Backend) {
+			add(LevelError, "firewall.backend", "unknown backend %q (expected nftables, iptables or ufw)", fw.Backend)
+		}
+		if fw.Table != "" && (fw.Backend != "nftables" || len(strings.Fields(fw.Table)) != 2) {
+			add(LevelError, "firewall.table", "table is only valid for nftables and must be \"<family> <name>\" (e.g. \"inet filter\")")
+		}
+		if fw.Chain != "" && (fw.Backend == "ufw" || strings.ContainsAny(fw.Chain, " \t")) {
+			add(LevelError, "firewall.chain", "chain is only valid for nftables or iptables and must not contain spaces")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Proxies)) {
+		px, p := cfg.Proxies[name], "proxies."+name
+		if px.Type != "velocity" && px.Type != "bungeecord" {
+			add(LevelError, p+".type", "unknown type %q (expected velocity or bungeecord)", px.Type)
+		}
+		if px.Server != "" {
+			if _, ok := cfg.Servers[px.Server]; !ok {
+				add(LevelError, p+".server", "server %q is not defined", px.Server)
+			}
+		}
+		switch {
+		case px.API != "":
+			if u, err := url.Parse(px.API); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add(LevelError, p+".api", "invalid url %q", px.API)
+			}
+		case px.ConfigFile == "":
+			add(LevelError, p, "configFile or api is required")
+		case px.Server == "" && !filepath.IsAbs(px.ConfigFile):
+			add(LevelError, p+".configFile", "configFile must be an absolute path when server is omitted")
+		case px.Server == "" && px.ReloadCommand != "":
+			add(LevelWarning, p+".reloadCommand", "reloadCommand is not sent because server is omitted")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.DNS)) {
+		d, p := cfg.DNS[name], "dns."+name
+		if d.TTL < 0 {
+			add(LevelError, p+".ttl", "must not be negative")
+		}
+		switch d.Type {
+		case "cloudflare":
+			if d.ZoneID == "" {
+				add(LevelError, p+".zoneId", "zoneId is required")
+			}
+			if d.APIToken == "" && d.APITokenFile == "" {
+				add(LevelError, p+".apiToken", "apiToken or apiTokenFile is required")
+			}
+		case "rfc2136":
+			if !validAddress(d.Server) {
+				add(LevelError, p+".server", "invalid server %q (expected host:port)", d.Server)
+			}
+			if d.Zone == "" {
+				add(LevelError, p+".zone", "zone is required")
+			}
+			if d.TSIGName != "" && d.TSIGSecret == "" && d.TSIGSecretFile == "" {
+				add(LevelError, p+".tsigSecret", "tsigSecret or tsigSecretFile is required with tsigName")
+			}
+		default:
+			add(LevelError, p+".type", "unknown type %q (expected cloudflare or rfc2136)", d.Type)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.DockerHosts)) {
+		if a := cfg.DockerHosts[name].PublicAddress; a != "" && net.ParseIP(a) == nil {
+			add(LevelError, "dockerHosts."+name+".publicAddress", "invalid ip address %q", a)
+		}
+	}
+	if cfg.Recording != nil && cfg.Recording.Directory == "" {
+		add(LevelError, "recording.directory", "directory is required")
+	}
+	if a := cfg.LogArchive; a != nil {
+		if a.Directory == "" {
+			add(LevelError, "logArchive.directory", "directory is required")
+		}
+		for _, v := range []struct {
+			key string
+			n   int
+		}{
+			{"maxSizeMB", a.MaxSizeMB}, {"maxAgeDays", a.MaxAgeDays}, {"maxFiles", a.MaxFiles},
+		} {
+			if v.n < 0 {
+				add(LevelError, "logArchive."+v.key, "must not be negative")
+			}
+		}
+		for i, server := range a.Servers {
+			if _, ok := cfg.Servers[server]; !ok {
+				add(LevelWarning, fmt.Sprintf("logArchive.servers[%d]", i), "server %q is not defined", server)
+			}
+		}
+	}
+
+	if cfg.Log != nil {
+		if cfg.Log.Level != "" {
+			if _, err := logger.ParseLevel(cfg.Log.Level); err != nil {
+				add(LevelError, "log.level", "%v", err)
+			}
+		}
+		if f := cfg.Log.Format; f != "" && f != logger.FormatText && f != logger.FormatJSON {
+			add(LevelError, "log.format", "unknown format %q (expected text or json)", f)
+		}
+		for _, service := range slices.Sorted(maps.Keys(cfg.Log.Services)) {
+			if _, err := logger.ParseLevel(cfg.Log.Services[service]); err != nil {
+				add(LevelError, "log.services."+service, "%v", err)
+			}
+		}
+		if f := cfg.Log.File; f != nil {
+			if f.Path == "" {
+				add(LevelError, "log.file.path", "path is required")
+			}
+			if f.RotateEvery != "" {
+				if d, err := time.ParseDuration(f.RotateEvery); err != nil || d <= 0 {
+					add(LevelError, "log.file.rotateEvery", "invalid duration %q", f.RotateEvery)
+				}
+			}
+			for _, v := range []struct {
+				key string
+				n   int
+			}{{"maxSizeMB", f.MaxSizeMB}, {"maxAgeDays", f.MaxAgeDays}, {"maxBackups", f.MaxBackups}} {
+				if v.n < 0 {
+					add(LevelError, "log.file."+v.key, "must not be negative")
+				}
+			}
+		}
+		if sl := cfg.Log.Syslog; sl != nil {
+			switch sl.Network {
+			case "":
+				if sl.Address != "" {
+					add(LevelError, "log.syslog.network", "network is required when address is set")
+				}
+			case "udp", "tcp", "unix", "unixgram":
+				if sl.Address == "" {
+					add(LevelError, "log.syslog.address", "address is required")
+				}
+			default:
+				add(LevelError, "log.syslog.network", "unknown network %q (expected udp, tcp or unix)", sl.Network)
+			}
+		}
+		if cfg.Log.BufferLines < 0 {
+			add(LevelError, "log.bufferLines", "must not be negative")
+		}
+	}
+
+	if n := cfg.Notifications; n != nil {
+		// ユーザーの notify と email の通知先のいずれも無い場合は、メールを送信しないため SMTP を省略できる。
+		usesMail := n.SMTP != (SMTPConfig{})
+		for _, user := range cfg.Users {
+			usesMail = usesMail || len(user.Notify) > 0
+		}
+		for _, ch := range n.Channels {
+			usesMail = usesMail || ch.Type == ChannelEmail
+		}
+		if usesMail {
+			if n.SMTP.Host == "" {
+				add(LevelError, "notifications.smtp.host", "host is required")
+			}
+			if _, err := mail.ParseAddress(n.SMTP.From); err != nil {
+				add(LevelError, "notifications.smtp.from", "invalid address %q: %v", n.SMTP.From, err)
+			}
+		}
+		if n.SMTP.Port < 0 || n.SMTP.Port > 65535 {
+			add(LevelError, "notifications.smtp.port", "invalid port %d", n.SMTP.Port)
+		}
+		switch n.SMTP.TLS {
+		case "", SMTPStartTLS, SMTPTLS, SMTPNone:
+		default:
+			add(LevelError, "notifications.smtp.tls", "unknown mode %q (expected starttls, tls or none)", n.SMTP.TLS)
+		}
+		if n.DiskThreshold < 0 || n.DiskThreshold >= 100 {
+			add(LevelError, "notifications.diskThreshold", "must be between 0 and 100")
+		}
+		for _, kind := range slices.Sorted(maps.Keys(n.Templates)) {
+			if !slices.Contains(NotifyEvents, kind) {
+				add(LevelError, "notifications.templates."+kind, "unknown event %q (expected one of %s)", kind, strings.Join(NotifyEvents, ", "))
+				continue
+			}
+			t := n.Templates[kind]
+			for _, v := range []struct{ key, text string }{{"subject", t.Subject}, {"body", t.Body}} {
+				if _, err := template.New(kind).Parse(v.text); err != nil {
+					add(LevelError, "notifications.templates."+kind+"."+v.key, "%v", err)
+				}
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(n.Channels)) {
+			ch, path := n.Channels[name], "notifications.channels."+name
+			switch ch.Type {
+			case ChannelDiscord, ChannelWebhook:
+				if u, err := url.Parse(ch.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					add(LevelError, path+".url", "invalid URL %q", ch.URL)
+				}
+			case ChannelEmail:
+				if len(ch.To) == 0 {
+					add(LevelError, path+".to", "at least one address is required")
+				}
+				for i, to := range ch.To {
+					if _, err := mail.ParseAddress(to); err != nil {
+						add(LevelError, fmt.Sprintf("%s.to[%d]", path, i), "invalid address %q: %v", to, err)
+					}
+				}
+			case ChannelTelegram:
+				if ch.Token == "" {
+					add(LevelError, path+".token", "token is required")
+				}
+				if ch.ChatID == "" {
+					add(LevelError, path+".chatId", "chatId is required")
+				}
+			default:
+				add(LevelError, path+".type", "unknown type %q (expected discord, email, webhook or telegram)", ch.Type)
+			}
+		}
+		for i, route := range n.Routes {
+			path := fmt.Sprintf("notifications.routes[%d]", i)
+			for j, kind := range route.Events {
+				if !slices.Contains(NotifyEvents, kind) {
+					add(LevelError, fmt.Sprintf("%s.events[%d]", path, j), "unknown event %q (expected one of %s)", kind, strings.Join(NotifyEvents, ", "))
+				}
+			}
+			if route.Severity != "" && !slices.Contains(Severities, route.Severity) {
+				add(LevelError, path+".severity", "unknown severity %q (expected one of %s)", route.Severity, strings.Join(Severities, ", "))
+			}
+			for j, server := range route.Servers {
+				if _, ok := cfg.Servers[server]; !ok && server != "" {
+					add(LevelWarning, fmt.Sprintf("%s.servers[%d]", path, j), "server %q is not defined", server)
+				}
+			}
+			if len(route.Channels) == 0 {
+				add(LevelError, path+".channels", "at least one channel is required")
+			}
+			for j, name := range route.Channels {
+				if _, ok := n.Channels[name]; !ok {
+					add(LevelError, fmt.Sprintf("%s.channels[%d]", path, j), "channel %q is not defined", name)
+				}
+			}
+			if q := route.QuietHours; q != nil {
+				for _, v := range []struct{ key, value string }{{"start", q.Start}, {"end", q.End}} {
+					if _, err := time.Parse("15:04", v.value); err != nil {
+						add(LevelError, path+".quietHours."+v.key, "invalid time %q (expected HH:MM)", v.value)
+					}
+				}
+				if q.Severity != "" && !slices.Contains(Severities, q.Severity) {
+					add(LevelError, path+".quietHours.severity", "unknown severity %q (expected one of %s)", q.Severity, strings.Join(Severities, ", "))
+				}
+			}
+			if d, err := time.ParseDuration(route.Dedup); route.Dedup != "" && (err != nil || d < 0) {
+				add(LevelError, path+".dedup", "invalid duration %q", route.Dedup)
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Users)) {
+		user := cfg.Users[name]
+		if user.Password == "" {
+			add(LevelWarning, "users."+name+".password", "password is empty; this user cannot log in")
+		}
+		if user.Email != "" {
+			if _, err := mail.ParseAddress(user.Email); err != nil {
+				add(LevelError, "users."+name+".email", "invalid address %q: %v", user.Email, err)
+			}
+		}
+		for i, kind := range user.Notify {
+			if !slices.Contains(NotifyEvents, kind) {
+				add(LevelError, fmt.Sprintf("users.%s.notify[%d]", name, i), "unknown event %q (expected one of %s)", kind, strings.Join(NotifyEvents, ", "))
+			}
+		}
+		if len(user.Notify) > 0 && (user.Email == "" || cfg.Notifications == nil) {
+			add(LevelWarning, "users."+name+".notify", "notifications are not sent without email and notifications.smtp")
+		}
+		for _, server := range slices.Sorted(maps.Keys(user.Permissions)) {
+			for i, perm := range user.Permissions[server] {
+				if !ValidPermissionScope(perm) {
+					add(LevelError, fmt.Sprintf("users.%s.permissions.%s[%d]", name, server, i), "invalid scoped permission %q (only file.write can be limited to an absolute path like \"file.write:/data/plugins\")", perm)
+				}
+			}
+			if pattern, ok := TagSelector(server); ok {
+				if !validTagPattern(pattern) {
+					add(LevelError, "users."+name+".permissions."+server, "invalid tag pattern %q", pattern)
+				} else if len(cfg.ServersWithTag(pattern)) == 0 {
+					add(LevelWarning, "users."+name+".permissions."+server, "no server has a tag matching %q", pattern)
+				}
+				continue
+			}
+			if _, ok := cfg.Servers[server]; !ok && server != "*" {
+				add(LevelWarning, "users."+name+".permissions."+server, "server %q is not defined", server)
+			}
+		}
+	}
+
+	// ホストポートの重複は、同じ Docker ホスト上の同じプロトコルのサーバー間でのみ衝突する。
+	// 待ち受けるアドレスを指定した場合は、異なるアドレス同士であれば衝突しない。
+	type portKey struct{ host, port, proto string }
+	type portOwner struct{ server, ip string }
+	portOwners := make(map[portKey][]portOwner)
+	claim := func(host, ip, port, proto, server string) {
+		k, o := portKey{host, port, proto}, portOwner{server, ip}
+		if !slices.Contains(portOwners[k], o) {
+			portOwners[k] = append(portOwners[k], o)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		s := cfg.Servers[name]
+		p := "servers." + name
+
+		// ":" は "tag:<pattern>" 等の複数のサーバーの指定と区別できなくなるため、サーバー名には使用できない。
+		if strings.Contains(name, ":") {
+			add(LevelError, p, "invalid server name %q (':' is not allowed)", name)
+		}
+		if s.Host != "" {
+			if _, ok := cfg.DockerHosts[s.Host]; !ok {
+				add(LevelError, p+".host", "docker host %q is not defined in dockerHosts", s.Host)
+			}
+		}
+		for i, tag := range s.Tags {
+			if !tagPattern.MatchString(tag) {
+				add(LevelError, fmt.Sprintf("%s.tags[%d]", p, i), "invalid tag %q (letters, digits, '.', '_' and '-' only)", tag)
+			}
+		}
+
+		if pc := s.Process; pc != nil {
+			if s.Compose != nil {
+				add(LevelError, p+".process", "process and compose cannot be used together")
+			}
+			if s.Host != "" {
+				add(LevelError, p+".host", "process servers run on the play-bin host; host must be empty")
+			}
+			switch {
+			case pc.Unit == "" && len(pc.Command) == 0:
+				add(LevelError, p+".process", "unit or command is required")
+			case pc.Unit != "" && len(pc.Command) > 0:
+				add(LevelError, p+".process", "unit and command cannot be used together")
+			}
+			if pc.Unit == "" && pc.Stdin != "" {
+				add(LevelWarning, p+".process.stdin", "stdin is only used with unit")
+			}
+			if pc.Unit != "" && (pc.Directory != "" || len(pc.Env) > 0 || pc.LogFile != "" || pc.StopTimeout != "") {
+				add(LevelWarning, p+".process", "directory, env, logFile and stopTimeout are ignored with unit; configure them in the unit file")
+			}
+			if pc.StopTimeout != "" {
+				if d, err := time.ParseDuration(pc.StopTimeout); err != nil || d <= 0 {
+					add(LevelError, p+".process.stopTimeout", "invalid duration %q", pc.StopTimeout)
+				}
+			}
+		}
+
+		if s.Firewall != nil && cfg.Firewall == nil {
+			add(LevelWarning, p+".firewall", "firewall is not configured; this setting has no effect")
+		} else if cfg.Firewall != nil && s.Firewall == nil && !isLocalHost(cfg, s.Host) {
+			add(LevelWarning, p+".host", "ports of servers on remote docker hosts are not managed by firewall")
+		}
+
+		if d := s.DNS; d != nil {
+			if provider, ok := cfg.DNS[d.Provider]; !ok {
+				add(LevelError, p+".dns.provider", "dns provider %q is not defined", d.Provider)
+			} else if provider.Type == "rfc2136" && d.Name != "" && !inZone(d.Name, provider.Zone) {
+				add(LevelError, p+".dns.name", "name %q is not in zone %q", d.Name, provider.Zone)
+			}
+			if d.Name == "" {
+				add(LevelError, p+".dns.name", "name is required")
+			}
+			if d.Address != "" && net.ParseIP(d.Address) == nil {
+				add(LevelError, p+".dns.address", "invalid ip address %q", d.Address)
+			} else if d.Address == "" && cfg.DockerHosts[s.Host].PublicAddress == "" && d.SRV == "" {
+				add(LevelError, p+".dns.address", "address is required unless dockerHosts.<host>.publicAddress is set")
+			}
+			if d.SRV != "" && !srvLabelPattern.MatchString(d.SRV) {
+				add(LevelError, p+".dns.srv", "invalid srv %q (e.g. \"_minecraft._tcp\")", d.SRV)
+			}
+			if d.Port < 0 || d.Port > 65535 {
+				add(LevelError, p+".dns.port", "invalid port %d", d.Port)
+			} else if d.SRV != "" && d.Port == 0 && (s.Compose == nil || len(s.Compose.Network.PortMappings()) == 0) {
+				add(LevelError, p+".dns.port", "port is required without compose.network.mapping")
+			}
+		}
+
+		if px := s.Proxy; px != nil {
+			if _, ok := cfg.Proxies[px.Network]; !ok {
+				add(LevelError, p+".proxy.network", "proxy %q is not defined in proxies", px.Network)
+			} else if cfg.Proxies[px.Network].Server == name {
+				add(LevelError, p+".proxy.network", "a proxy cannot register itself")
+			}
+			if !validAddress(px.Address) {
+				add(LevelError, p+".proxy.address", "invalid address %q (expected host:port)", px.Address)
+			}
+		}
+
+		if u := s.Upload; u != nil {
+			for i, v := range u.Validate {
+				vp := fmt.Sprintf("%s.upload.validate[%d]", p, i)
+				if v.Path == "" {
+					add(LevelError, vp+".path", "path is required")
+				} else if _, err := path.Match(v.Path, ""); err != nil {
+					add(LevelError, vp+".path", "invalid pattern %q: %v", v.Path, err)
+				}
+				if v.Format == "" && v.Command == "" {
+					add(LevelError, vp, "format or command is required")
+				}
+				if v.Format != "" && !slices.Contains(UploadFormats, v.Format) {
+					add(LevelError, vp+".format", "unknown format %q (expected %s)", v.Format, strings.Join(UploadFormats, ", "))
+				}
+				if v.Command != "" {
+					if args, err := SplitCommandLine(v.Command); err != nil {
+						add(LevelError, vp+".command", "invalid command line %q: %v", v.Command, err)
+					} else if len(args) == 0 {
+						add(LevelError, vp+".command", "command is empty")
+					}
+				}
+			}
+		}
+
+		if t := s.Terminal; t != nil {
+			if s.Process != nil {
+				add(LevelWarning, p+".terminal", "terminal is ignored for process servers")
+			}
+			if t.Shell != "" && strings.ContainsAny(t.Shell, " \t\r\n") {
+				add(LevelError, p+".terminal.shell", "shell must be a single command without arguments, got %q", t.Shell)
+			}
+			if t.WorkingDir != "" && !strings.HasPrefix(t.WorkingDir, "/") {
+				add(LevelError, p+".terminal.workingDir", "workingDir must be an absolute path in the container, got %q", t.WorkingDir)
+			}
+			for _, key := range slices.Sorted(maps.Keys(t.Env)) {
+				if key == "" || strings.Contains(key, "=") {
+					add(LevelError, p+".terminal.env", "invalid environment variable name %q", key)
+				}
+			}
+			for i, entry := range t.Commands {
+				if args, err := SplitCommandLine(entry); err != nil {
+					add(LevelError, fmt.Sprintf("%s.terminal.commands[%d]", p, i), "invalid command line %q: %v", entry, err)
+				} else if len(args) == 0 {
+					add(LevelError, fmt.Sprintf("%s.terminal.commands[%d]", p, i), "command is empty")
+				}
+			}
+		}
+
+		if c := s.Compose; c != nil {
+			if c.Image == "" && c.Build == nil {
+				add(LevelError, p+".compose.image", "image or build is required")
+			}
+			switch c.Restart {
+			case "", "no", "always", "on-failure", "unless-stopped":
+			default:
+				add(LevelError, p+".compose.restart", "invalid restart policy %q (expected no, always, on-failure or unless-stopped)", c.Restart)
+			}
+
+			mode := c.Network.Mode
+			if mode == "" {
+				mode = "bridge"
+			}
+			if mode != "bridge" && len(c.Network.Mapping) > 0 {
+				add(LevelWarning, p+".compose.network.mapping", "mapping is ignored when network mode is %q", mode)
+			}
+			for _, hostPort := range slices.Sorted(maps.Keys(c.Network.Mapping)) {
+				m, err := ParsePortMapping(hostPort, c.Network.Mapping[hostPort])
+				if err != nil {
+					add(LevelError, p+".compose.network.mapping."+hostPort, "%v", err)
+					continue
+				}
+				if mode == "bridge" {
+					for i := range m.Count {
+						claim(s.Host, m.HostIP, strconv.Itoa(m.HostPort+i), m.Protocol, name)
+					}
+				}
+			}
+
+			if r := c.Resources; r != nil {
+				if _, err := r.MemoryBytes(); err != nil {
+					add(LevelError, p+".compose.resources.memory", "invalid memory %q (expected e.g. \"4g\" or \"4096m\")", r.Memory)
+				}
+				if r.CPUs < 0 {
+					add(LevelError, p+".compose.resources.cpus", "must not be negative")
+				}
+				if r.HeapPercent < 0 || r.HeapPercent > 100 {
+					add(LevelError, p+".compose.resources.heapPercent", "must be between 1 and 100")
+				}
+			}
+			if cmd := c.Command; cmd != nil {
+				vars := c.StartVars()
+				for _, field := range []struct{ key, value string }{{"entrypoint", cmd.Entrypoint}, {"arguments", cmd.Arguments}} {
+					if _, err := ParseStartCommand(field.value, vars); err != nil {
+						add(LevelError, p+".compose.command."+field.key, "%v", err)
+					}
+				}
+			}
+
+			// マウント元の存在は、play-bin と同じマシンのデーモンを使用するサーバーでのみ確認できる。
+			if isLocalHost(cfg, s.Host) {
+				for _, src := range slices.Sorted(maps.Keys(c.Mount)) {
+					if !filepath.IsAbs(src) {
+						continue // 名前付きボリューム
+					}
+					if _, err := os.Stat(src); err != nil {
+						add(LevelError, p+".compose.mount", "mount source %s does not exist", src)
+					}
+				}
+			}
+		}
+
+		for i, cmd := range s.Commands.Stop {
+			checkCommand(add, fmt.Sprintf("%s.commands.stop[%d]", p, i), cmd, "attach", "exec", "log", "sleep")
+		}
+		for i, cmd := range s.Commands.Backup {
+			checkCommand(add, fmt.Sprintf("%s.commands.backup[%d]", p, i), cmd, "attach", "sleep", "backup")
+		}
+		if e := s.Commands.BackupEngine; e != "" && !slices.Contains(BackupEngines, e) {
+			add(LevelError, p+".commands.backupEngine", "unknown engine %q (expected one of %s)", e, strings.Join(BackupEngines, ", "))
+		}
+
+		if q := s.Query; q != nil {
+			switch q.Type {
+			case "minecraft", "a2s", "tcp":
+			default:
+				add(LevelError, p+".query.type", "invalid query type %q (expected minecraft, a2s or tcp)", q.Type)
+			}
+			if !validAddress(q.Address) {
+				add(LevelError, p+".query.address", "invalid address %q (expected host:port)", q.Address)
+			}
+			if q.Timeout < 0 {
+				add(LevelError, p+".query.timeout", "timeout must not be negative")
+			}
+		}
+
+		if a := s.AutoShutdown; a != nil {
+			if a.IdleMinutes <= 0 && len(a.StartAt) == 0 {
+				add(LevelWarning, p+".autoShutdown.idleMinutes", "idleMinutes is not positive; the server is never stopped")
+			}
+			if a.IdleMinutes > 0 && s.Query == nil {
+				add(LevelWarning, p+".autoShutdown", "query is required to count players; the server is never stopped")
+			}
+			for i, at := range a.StartAt {
+				if _, err := time.Parse("15:04", at); err != nil || len(at) != 5 {
+					add(LevelError, fmt.Sprintf("%s.autoShutdown.startAt[%d]", p, i), "invalid time %q (expected HH:MM)", at)
+				}
+			}
+		}
+
+		if wk := s.Wake; wk != nil {
+			switch wk.Protocol {
+			case "", "tcp", "minecraft":
+			default:
+				add(LevelError, p+".wake.protocol", "invalid protocol %q (expected tcp or minecraft)", wk.Protocol)
+			}
+			if ip, port, err := net.SplitHostPort(wk.Listen); err != nil || !validPort(port) {
+				add(LevelError, p+".wake.listen", "invalid listen address %q (expected host:port)", wk.Listen)
+			} else {
+				claim(s.Host, ip, port, "tcp", name)
+			}
+		}
+
+		if r := s.RCON; r != nil && !validAddress(r.Address) {
+			add(LevelError, p+".rcon.address", "invalid address %q (expected host:port)", r.Address)
+		}
+		for i, f := range s.ConfigFiles {
+			if f.Template == "" || f.Target == "" {
+				add(LevelError, fmt.Sprintf("%s.configFiles[%d]", p, i), "template and target are required")
+			}
+		}
+		if s.Mods != nil && s.Mods.Directory == "" {
+			add(LevelError, p+".mods.directory", "directory is required")
+		}
+		if s.Worlds != nil && s.Worlds.Directory == "" {
+			add(LevelError, p+".worlds.directory", "directory is required")
+		}
+		if s.Crash != nil && s.Crash.LogLines < 0 {
+			add(LevelError, p+".crash.logLines", "logLines must not be negative")
+		}
+		if rd := s.Ready; rd != nil {
+			if rd.Log == "" && rd.Port == "" {
+				add(LevelWarning, p+".ready", "neither log nor port is set; readiness is not detected")
+			}
+			if _, err := regexp.Compile(rd.Log); err != nil {
+				add(LevelError, p+".ready.log", "invalid regular expression: %v", err)
+			}
+			if rd.Port != "" && !validAddress(rd.Port) {
+				add(LevelError, p+".ready.port", "invalid address %q (expected host:port)", rd.Port)
+			}
+			if d, err := time.ParseDuration(rd.Timeout); rd.Timeout != "" && (err != nil || d <= 0) {
+				add(LevelError, p+".ready.timeout", "invalid duration %q (expected e.g. 5m)", rd.Timeout)
+			}
+		}
+		if lf := s.LogFormat; lf != nil {
+			if re, err := regexp.Compile(lf.Pattern); err != nil {
+				add(LevelError, p+".logFormat.pattern", "invalid regular expression: %v", err)
+			} else if !slices.Contains(re.SubexpNames(), "level") && !slices.Contains(re.SubexpNames(), "message") {
+				add(LevelWarning, p+".logFormat.pattern", "pattern has neither (?P<level>...) nor (?P<message>...) group")
+			}
+			for _, raw := range slices.Sorted(maps.Keys(lf.Levels)) {
+				if !slices.Contains(logLevels, lf.Levels[raw]) {
+					add(LevelError, p+".logFormat.levels."+raw, "unknown level %q (expected one of %s)", lf.Levels[raw], strings.Join(logLevels, ", "))
+				}
+			}
+		}
+		if fw := s.Forward; fw != nil {
+			if fw.Rules == "" {
+				add(LevelError, p+".forward.rules", "rules is required")
+			} else if _, err := os.Stat(fw.Rules); err != nil {
+				add(LevelWarning, p+".forward.rules", "rules file is not readable: %v", err)
+			}
+			if fw.MaxLineSize < 0 {
+				add(LevelError, p+".forward.maxLineSize", "must not be negative")
+			}
+			if len(fw.Sinks) == 0 {
+				add(LevelWarning, p+".forward.sinks", "no sinks are configured; matched lines are discarded")
+			}
+			for i, sink := range fw.Sinks {
+				sp := fmt.Sprintf("%s.forward.sinks[%d]", p, i)
+				switch sink.Type {
+				case SinkDiscord, SinkHTTP:
+					if u, err := url.Parse(sink.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+						add(LevelError, sp+".url", "invalid url %q (expected http(s)://...)", sink.URL)
+					}
+				case SinkCommand, SinkEvent:
+				default:
+					add(LevelError, sp+".type", "unknown type %q (expected discord, http, command or event)", sink.Type)
+				}
+			}
+			if s.Discord != nil && s.Discord.LogSetting != "" {
+				add(LevelWarning, p+".discord.logSetting", "ignored because forward is set; add a discord sink to forward.sinks instead")
+			}
+		}
+		if s.Discord != nil && s.Discord.Backups != nil {
+			b := s.Discord.Backups
+			if b.Channel != "" && s.Discord.Token == "" {
+				add(LevelError, p+".discord.backups.channel", "requires discord.token")
+			}
+			if b.Webhook != "" {
+				if u, err := url.Parse(b.Webhook); err != nil || u.Scheme != "https" || u.Host == "" {
+					add(LevelError, p+".discord.backups.webhook", "invalid url %q (expected https://...)", b.Webhook)
+				}
+			}
+			if cmp.Or(b.Channel, s.Discord.Channel) == "" && cmp.Or(b.Webhook, s.Discord.Webhook) == "" {
+				add(LevelWarning, p+".discord.backups", "no channel or webhook is configured; backups are not notified")
+			}
+		}
+		for _, action := range slices.Sorted(maps.Keys(s.Cooldowns)) {
+			if !slices.Contains(actionNames, action) {
+				add(LevelError, p+".cooldowns."+action, "unknown action %q (expected one of %s)", action, strings.Join(actionNames, ", "))
+			}
+			if d, err := time.ParseDuration(s.Cooldowns[action]); err != nil || d < 0 {
+				add(LevelError, p+".cooldowns."+action, "invalid duration %q (expected e.g. 30s or 10m)", s.Cooldowns[action])
+			}
+		}
+		for _, action := range slices.Sorted(maps.Keys(s.Hooks)) {
+			h := s.Hooks[action]
+			if !slices.Contains(actionNames, action) {
+				add(LevelError, p+".hooks."+action, "unknown action %q (expected one of %s)", action, strings.Join(actionNames, ", "))
+			}
+			if h.Pre == "" && h.Post == "" {
+				add(LevelWarning, p+".hooks."+action, "neither pre nor post is set; the hook does nothing")
+			}
+			if h.Timeout != "" {
+				if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+					add(LevelError, p+".hooks."+action+".timeout", "invalid duration %q (expected e.g. 30s or 2m)", h.Timeout)
+				}
+			}
+		}
+	}
+
+	for _, k := range slices.SortedFunc(maps.Keys(portOwners), func(a, b portKey) int {
+		return strings.Compare(a.host+"/"+a.port+"/"+a.proto, b.host+"/"+b.port+"/"+b.proto)
+	}) {
+		var servers []string
+		owners := portOwners[k]
+		for i, a := range owners {
+			for _, b := range owners[i+1:] {
+				if a.server != b.server && addressesOverlap(a.ip, b.ip) {
+					servers = append(servers, a.server, b.server)
+				}
+			}
+		}
+		if servers = slices.Compact(slices.Sorted(slices.Values(servers))); len(servers) > 1 {
+			add(LevelError, "servers", "host port %s/%s is used by multiple servers: %s", k.port, k.proto, strings.Join(servers, ", "))
+		}
+	}
+	return issues
+}
+
+// actionNames は cooldowns・hooks に指定できる操作。container.Action の値と一致させる。
+var actionNames = []string{"start", "stop", "kill", "backup", "restore", "remove", "world", "snapshot", "migrate"}
+
+// logLevels は logFormat.levels の対応先として指定できるレベル。
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// checkCommand は停止・バックアップ手順の 1 コマンドを検証する。未知の種別は実行時に黙って無視されるため、エラーとして扱う。
+func checkCommand(add func(level, path, format string, args ...any), path string, cmd CmdConfig, types ...string) {
+	if !slices.Contains(types, cmd.Type) {
+		add(LevelError, path+".type", "invalid command type %q (expected %s)", cmd.Type, strings.Join(types, ", "))
+		return
+	}
+	switch cmd.Type {
+	case "sleep":
+		if _, err := time.ParseDuration(cmd.Arg); err != nil {
+			add(LevelError, path+".arg", "invalid duration %q (e.g. \"10s\", \"1m30s\")", cmd.Arg)
+		}
+	case "backup":
+		if src, dest, ok := strings.Cut(cmd.Arg, ":"); !ok || src == "" || dest == "" {
+			add(LevelError, path+".arg", "invalid backup argument %q (expected src:destBase)", cmd.Arg)
+		}
+	}
+}
+
+// isLocalHost は dockerHosts のキーが play-bin と同じマシンのデーモンを指すかを返す。
+func isLocalHost(cfg Config, hostName string) bool {
+	if hostName == "" {
+		return true
+	}
+	h, ok := cfg.DockerHosts[hostName]
+	return ok && (h.Host == "" || strings.HasPrefix(h.Host, "unix://") || strings.HasPrefix(h.Host, "npipe://"))
+}
+
+func validAddress(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && validPort(port)
+}
+
+// validOrigin はブラウザが送信する Origin ヘッダーの形式 (scheme://host[:port]) であるかを判定する。
+func validOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// containerNamePattern は Docker のコンテナ名として使用できる文字列。
+var containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// srvLabelPattern は SRV レコードのサービスとプロトコルのラベル ("_minecraft._tcp" 等)。
+var srvLabelPattern = regexp.MustCompile(`^_[A-Za-z0-9-]+\._(tcp|udp)$`)
+
+// inZone はレコードの名前がゾーンに含まれるかを返す。
+func inZone(name, zone string) bool {
+	name, zone = strings.TrimSuffix(strings.ToLower(name), "."), strings.TrimSuffix(strings.ToLower(zone), ".")
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// addressesOverlap は 2 つの待ち受けアドレスが同じポートで衝突するかを返す。
+// 空 (IPv4 と IPv6 の両方) は全てのアドレスと、0.0.0.0 と :: はそれぞれ同じアドレスファミリーのアドレスと衝突する。
+func addressesOverlap(a, b string) bool {
+	if a == "" || b == "" {
+		return true
+	}
+	ipA, errA := netip.ParseAddr(a)
+	ipB, errB := netip.ParseAddr(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	ipA, ipB = ipA.Unmap(), ipB.Unmap()
+	if ipA.Is4() != ipB.Is4() {
+		return false
+	}
+	return ipA.IsUnspecified() || ipB.IsUnspecified() || ipA == ipB
+}
+
+// MARK: unknownKeys()
+// 設定ファイル内の、構造体に対応しないキーを検出する。キーの誤記は JSON のデコードでは黙って無視されるため、近い候補を添えて報告する。
+func unknownKeys(file string, data []byte, t reflect.Type, prefix string) []Issue {
+	g, err := decodeGeneric(file, data)
+	if err != nil {
+		return nil
+	}
+	var issues []Issue
+	walkKeys(g, t, prefix, func(path, key string, candidates []string) {
+		msg := fmt.Sprintf("unknown key %q", key)
+		if s := suggestKey(key, candidates); s != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", s)
+		}
+		issues = append(issues, Issue{Level: LevelError, File: file, Path: path, Message: msg})
+	})
+	return issues
+}
+
+// walkKeys は汎用の値を構造体の型に沿って辿り、未知のキーごとに report を呼び出す。
+func walkKeys(g any, t reflect.Type, path string, report func(path, key string, candidates []string)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := g.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" || !f.IsExported() {
+				continue
+			}
+			fields[name] = f.Type
+		}
+		names := slices.Sorted(maps.Keys(fields))
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			// encoding/json はキーの大文字・小文字を区別せずに対応付けるため、同様に扱う。
+			i := slices.IndexFunc(names, func(n string) bool { return strings.EqualFold(n, key) })
+			if i < 0 {
+				report(path, key, names)
+				continue
+			}
+			walkKeys(m[key], fields[names[i]], join(key), report)
+		}
+	case reflect.Map:
+		m, ok := g.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			walkKeys(m[key], t.Elem(), join(key), report)
+		}
+	case reflect.Slice:
+		list, ok := g.([]any)
+		if !ok {
+			return
+		}
+		for i, v := range list {
+			walkKeys(v, t.Elem(), fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	}
+}
+
+// suggestKey は誤記とみなせるほど近い（編集距離が 2 以下の）候補を返す。
+func suggestKey(key string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
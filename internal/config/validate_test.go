@@ -0,0 +1,13 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateRejectsColonInServerName(t *testing.T) {
+	issues := Validate(Config{Servers: map[string]ServerConfig{"tag:x": {}}})
+	if !slices.ContainsFunc(issues, func(i Issue) bool { return i.Level == LevelError && i.Path == "servers.tag:x" }) {
+		t.Errorf("issues = %v, want an error for servers.tag:x", issues)
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// reloadDebounce は最後の変更から再読み込みまでの待機時間。エディタの保存や servers.d の一括更新で発生する連続したイベントを 1 回の再読み込みにまとめる。
+	reloadDebounce = 500 * time.Millisecond
+	// pollInterval はファイル監視が使用できない環境で、更新時刻を確認する間隔。
+	pollInterval = 5 * time.Second
+)
+
+// MARK: Watch()
+// 設定ファイルと servers.d の変更を監視し、変更が落ち着いた時点で再読み込みする。SIGHUP を受信した場合は即座に再読み込みする。
+// ファイル監視を開始できない場合は、更新時刻の定期確認に切り替える。
+func (c *LoadedConfig) Watch() {
+	go c.watchSignal()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Logf("Internal", "Config", "ファイル監視を開始できません。定期確認に切り替えます: %v", err)
+		go c.poll()
+		return
+	}
+	// エディタは一時ファイルへの書き込みと置き換えで保存することが多く、ファイル自体を監視すると置き換え後に追跡できなくなるため、ディレクトリを監視する。
+	mainDir := filepath.Dir(c.Path)
+	if err := watcher.Add(mainDir); err != nil {
+		logger.Logf("Internal", "Config", "ファイル監視を開始できません。定期確認に切り替えます: %v", err)
+		watcher.Close()
+		go c.poll()
+		return
+	}
+	sdDir := serversDir(c.Path)
+	_ = watcher.Add(sdDir) // 存在しない場合は、作成を検知した時点で追加する
+
+	go func() {
+		defer watcher.Close()
+		var timer *time.Timer
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !c.isWatchedFile(ev.Name) {
+					continue
+				}
+				if filepath.Clean(ev.Name) == filepath.Clean(sdDir) && ev.Has(fsnotify.Create) {
+					_ = watcher.Add(sdDir)
+				}
+				if timer == nil {
+					timer = time.AfterFunc(reloadDebounce, c.reloadIfChanged)
+				} else {
+					timer.Reset(reloadDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Errorf("Internal", "Config", "ファイル監視でエラーが発生しました: %v", err)
+			}
+		}
+	}()
+	logger.Logf("Internal", "Config", "設定ファイルの監視を開始しました: %s", c.Path)
+}
+
+// isWatchedFile は変更イベントが再読み込みの対象（設定ファイル本体、servers.d ディレクトリ、servers.d 内の設定ファイル）であるかを返す。
+func (c *LoadedConfig) isWatchedFile(name string) bool {
+	name = filepath.Clean(name)
+	sdDir := filepath.Clean(serversDir(c.Path))
+	switch {
+	case name == filepath.Clean(c.Path), name == sdDir:
+		return true
+	case filepath.Dir(name) == sdDir:
+		base := filepath.Base(name)
+		return base[0] != '.' && isConfigFile(base)
+	}
+	return false
+}
+
+// watchSignal は SIGHUP を受信するたびに設定を再読み込みする。
+func (c *LoadedConfig) watchSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		logger.Log("Internal", "Config", "SIGHUP を受信しました。設定を再読み込みします")
+		c.Reload()
+	}
+}
+
+// poll はファイル監視の代替として、定期的に更新の有無を確認する。
+func (c *LoadedConfig) poll() {
+	for range time.Tick(pollInterval) {
+		c.reloadIfChanged()
+	}
+}
+
+// reloadIfChanged は前回の読み込み以降にファイルが更新されている場合のみ再読み込みする。
+// API による書き込み直後の Reload と、その書き込みを検知した監視による再読み込みが重複しないようにする。
+func (c *LoadedConfig) reloadIfChanged() {
+	c.mu.Lock()
+	checked := c.lastChecked
+	c.mu.Unlock()
+	if modTime, err := latestModTime(c.Path); err == nil && !modTime.After(checked) {
+		return
+	}
+	c.Reload()
+}
@@ -0,0 +1,548 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidConfig = errors.New("config has validation errors")
+	ErrNotFound      = errors.New("server not found")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidName   = errors.New("invalid server name")
+	ErrInvalidPatch  = errors.New("invalid patch")
+)
+
+const (
+	// backupDirName は API による変更前の設定ファイルを保存するディレクトリ名。メインの設定ファイルと同じ階層に置く。
+	backupDirName = "config-backups"
+	// backupKeep はファイルごとに保持するバックアップの世代数。
+	backupKeep = 20
+)
+
+// WriteResult は API による設定変更の結果。
+type WriteResult struct {
+	File   string  `json:"file"`             // 書き込んだ（または削除した）ファイル
+	Backup string  `json:"backup,omitempty"` // 変更前の内容のバックアップ
+	Issues []Issue `json:"issues"`           // 検証で見つかった問題（警告を含む）
+}
+
+// MARK: PatchServer()
+// サーバー定義に JSON Merge Patch (RFC 7396) を適用し、定義元のファイル（servers.d またはメインの設定ファイル）へ書き込む。
+// patch が null の場合はサーバー定義を削除する。変更後の設定全体を検証し、エラーがある場合は書き込まずに ErrInvalidConfig を返す。
+// 書き込みは一時ファイルと置き換えで行い、変更前の内容は config-backups に保存する。環境変数やファイルの参照は解決せずにそのまま保つ。
+func (c *LoadedConfig) PatchServer(name string, patch []byte) (WriteResult, error) {
+	if name == "" || strings.ContainsAny(name, `/\:`) || strings.HasPrefix(name, ".") {
+		return WriteResult{}, ErrInvalidName
+	}
+	var p any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return WriteResult{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	p = integerize(p)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	file, content, err := c.patchedFile(name, p)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	result, err := c.commit(file, content)
+	if err != nil {
+		return result, err
+	}
+	logger.Logf("Internal", "Config", "API によりサーバー定義を更新しました: %s (%s)", name, file)
+
+	// ファイル監視による検知を待たずに適用し、呼び出し元へ反映済みの状態を返す。
+	c.Reload()
+	return result, nil
+}
+
+// MARK: PatchUser()
+// ユーザー定義に JSON Merge Patch (RFC 7396) を適用し、メインの設定ファイルへ書き込む。patch が null の場合はユーザーを削除する。
+// 検証・バックアップ・書き込みの扱いは PatchServer と同じ。permissions 等の配列は、マージではなく置き換えとなる。
+func (c *LoadedConfig) PatchUser(name string, patch []byte) (WriteResult, error) {
+	if name == "" || strings.TrimSpace(name) != name {
+		return WriteResult{}, ErrInvalidName
+	}
+	var p any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return WriteResult{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	p = integerize(p)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	g, err := decodeGeneric(c.Path, data)
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("%s: %w", c.Path, err)
+	}
+	root, ok := g.(map[string]any)
+	if !ok {
+		return WriteResult{}, fmt.Errorf("%s: top level must be an object", c.Path)
+	}
+	users, _ := root["users"].(map[string]any)
+	if _, exists := users[name]; !exists && p == nil {
+		return WriteResult{}, ErrUserNotFound
+	}
+	content, err := patchDocument(c.Path, data, p, "users", name)
+	if err != nil {
+		return WriteResult{}, err
+	}
+
+	result, err := c.commit(c.Path, content)
+	if err != nil {
+		return result, err
+	}
+	logger.Logf("Internal", "Config", "API によりユーザー定義を更新しました: %s", name)
+	c.Reload()
+	return result, nil
+}
+
+// commit は変更後の内容で設定全体を検証し、問題がなければ変更前の内容をバックアップしてから書き込む。content が nil の場合はファイルを削除する。
+func (c *LoadedConfig) commit(file string, content []byte) (WriteResult, error) {
+	// 書き込む前に、変更後の内容で設定全体を読み込み・検証する。
+	_, issues, err := load(c.Path, map[string][]byte{file: content})
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	result := WriteResult{File: file, Issues: issues}
+	if result.Issues == nil {
+		result.Issues = []Issue{}
+	}
+	if HasErrors(issues) {
+		return result, ErrInvalidConfig
+	}
+
+	if result.Backup, err = c.backupFile(file); err != nil {
+		return result, fmt.Errorf("failed to back up %s: %w", file, err)
+	}
+	// TOML はファイル全体を再出力するため、記述されていたコメントは失われる。黙って消さないよう、警告として返す。
+	if content != nil && strings.EqualFold(filepath.Ext(file), ".toml") && result.Backup != "" {
+		if old, err := os.ReadFile(result.Backup); err == nil && hasTOMLComment(old) {
+			result.Issues = append(result.Issues, Issue{Level: LevelWarning, File: file, Message: "comments are not preserved when writing TOML files; the previous content is kept in " + result.Backup})
+		}
+	}
+	if content == nil {
+		err = os.Remove(file)
+	} else {
+		err = fsutil.WriteFile(file, content, 0o600)
+	}
+	return result, err
+}
+
+// patchedFile はパッチ適用後のサーバー定義を含むファイルのパスと内容を返す。内容が nil の場合はファイルを削除する。
+// servers.d に定義されたサーバーはそのファイルを、それ以外はメインの設定ファイルを更新する。
+// 新規のサーバーは、servers.d ディレクトリが存在すればそこへ、なければメインの設定ファイルへ追加する。
+func (c *LoadedConfig) patchedFile(name string, patch any) (string, []byte, error) {
+	dir := serversDir(c.Path)
+	files, err := serverFiles(dir, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if i := slices.IndexFunc(files, func(f string) bool { return strings.TrimSuffix(f, filepath.Ext(f)) == name }); i >= 0 {
+		file := filepath.Join(dir, files[i])
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", nil, err
+		}
+		current, err := decodeGeneric(file, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if mergePatch(current, patch) == nil {
+			return file, nil, nil
+		}
+		content, err := patchDocument(file, data, patch)
+		return file, content, err
+	}
+
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	g, err := decodeGeneric(c.Path, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", c.Path, err)
+	}
+	root, ok := g.(map[string]any)
+	if !ok {
+		return "", nil, fmt.Errorf("%s: top level must be an object", c.Path)
+	}
+	servers, _ := root["servers"].(map[string]any)
+	current, exists := servers[name]
+	merged := mergePatch(current, patch)
+
+	switch {
+	case !exists && merged == nil:
+		return "", nil, ErrNotFound
+	case !exists:
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			file := filepath.Join(dir, name+filepath.Ext(c.Path))
+			content, err := encodeGeneric(file, merged)
+			return file, content, err
+		}
+	}
+
+	content, err := patchDocument(c.Path, data, patch, "servers", name)
+	return c.Path, content, err
+}
+
+// backupFile は変更前のファイルを config-backups へ複製し、古い世代を削除する。ファイルが存在しない（新規作成）場合は何もしない。
+func (c *LoadedConfig) backupFile(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	base := filepath.Dir(c.Path)
+	rel, err := filepath.Rel(base, file)
+	if err != nil {
+		rel = filepath.Base(file)
+	}
+	prefix := strings.ReplaceAll(filepath.ToSlash(rel), "/", "_") + "."
+	dir := filepath.Join(base, backupDirName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	// 秘密情報を含む可能性があるため、所有者のみ読み取れる権限で保存する。
+	dest := filepath.Join(dir, prefix+time.Now().Format("20060102-150405.000"))
+	if err := os.WriteFile(dest, data, 0o600); err != nil {
+		return "", err
+	}
+
+	entries, _ := os.ReadDir(dir)
+	var generations []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), prefix) {
+			generations = append(generations, e.Name())
+		}
+	}
+	// タイムスタンプ順に並ぶため、先頭から古い世代を削除する。
+	for len(generations) > backupKeep {
+		os.Remove(filepath.Join(dir, generations[0]))
+		generations = generations[1:]
+	}
+	return dest, nil
+}
+
+// encodeGeneric は汎用の値を、拡張子に応じた形式で出力する。
+func encodeGeneric(path string, v any) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		err := enc.Close()
+		return buf.Bytes(), err
+	case ".toml":
+		var buf bytes.Buffer
+		err := toml.NewEncoder(&buf).Encode(v)
+		return buf.Bytes(), err
+	default:
+		b, err := json.MarshalIndent(v, "", "  ")
+		return append(b, '\n'), err
+	}
+}
+
+// patchDocument は設定ファイルの内容 data のうち、keys で辿った位置の値に patch を適用した内容を返す。
+// YAML と JSON は変更した値以外のキーの順序を保ち、YAML はコメントも保つ。TOML は汎用の値を経由して再出力する。
+func patchDocument(path string, data []byte, patch any, keys ...string) ([]byte, error) {
+	// keys の位置への適用は、その位置まで入れ子にしたパッチを文書全体へ適用することと等しい。
+	for i := len(keys) - 1; i >= 0; i-- {
+		patch = map[string]any{keys[i]: patch}
+	}
+
+	var root *yaml.Node
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		g, err := decodeGeneric(path, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return encodeGeneric(path, mergePatch(g, patch))
+	case ".yaml", ".yml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(doc.Content) > 0 {
+			root = doc.Content[0]
+		}
+		merged, err := mergePatchNode(root, patch)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Kind != yaml.DocumentNode {
+			doc = yaml.Node{Kind: yaml.DocumentNode}
+		}
+		doc.Content = []*yaml.Node{merged}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+		err = enc.Close()
+		return buf.Bytes(), err
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		root, err := jsonNode(dec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		merged, err := mergePatchNode(root, patch)
+		if err != nil {
+			return nil, err
+		}
+		var compact, out bytes.Buffer
+		if err := writeJSONNode(&compact, merged); err != nil {
+			return nil, err
+		}
+		if err := json.Indent(&out, compact.Bytes(), "", jsonIndent(data)); err != nil {
+			return nil, err
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	}
+}
+
+// mergePatchNode は mergePatch と同じ規則で、ノード n に patch を適用した結果を返す。
+// 既存のキーは元の位置とコメントを保ち、追加したキーは末尾に名前順で置く。
+func mergePatchNode(n *yaml.Node, patch any) (*yaml.Node, error) {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return valueNode(patch)
+	}
+	if n != nil && n.Kind == yaml.AliasNode {
+		// アンカーの参照先は他の箇所と共有しているため変更せず、この位置に値として展開する。
+		var g any
+		if err := n.Decode(&g); err != nil {
+			return nil, err
+		}
+		return valueNode(mergePatch(normalizeKeys(g), patch))
+	}
+	if n == nil || n.Kind != yaml.MappingNode {
+		n = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	for _, k := range slices.Sorted(maps.Keys(p)) {
+		// Content にはキーと値が交互に並ぶ。
+		i := -1
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if n.Content[j].Value == k {
+				i = j
+				break
+			}
+		}
+		if p[k] == nil {
+			if i >= 0 {
+				n.Content = slices.Delete(n.Content, i, i+2)
+			}
+			continue
+		}
+		var current *yaml.Node
+		if i >= 0 {
+			current = n.Content[i+1]
+		}
+		merged, err := mergePatchNode(current, p[k])
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, merged)
+			continue
+		}
+		if merged != current {
+			// 値を置き換えた場合も、その値に付いていたコメントは引き継ぐ。
+			merged.HeadComment, merged.LineComment, merged.FootComment = current.HeadComment, current.LineComment, current.FootComment
+		}
+		n.Content[i+1] = merged
+	}
+	return n, nil
+}
+
+// valueNode は汎用の値をノードへ変換する。
+func valueNode(v any) (*yaml.Node, error) {
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// jsonNode は JSON の値を 1 つ読み込み、キーの順序を保ったノードとして返す。
+// YAML のパーサーはタブによるインデントを受け付けないため、JSON は json.Decoder で読み込む。
+func jsonNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if t == '{' {
+			n = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		for dec.More() {
+			if n.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			v, err := jsonNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, v)
+		}
+		// 閉じ括弧を読み飛ばす。
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	case json.Number:
+		if _, err := t.Int64(); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: t.String()}, nil
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: t.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// writeJSONNode はノードを、マッピングのキーの順序を保ったまま (インデントなしの) JSON として出力する。
+func writeJSONNode(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		start, end, step := byte('['), byte(']'), 1
+		if n.Kind == yaml.MappingNode {
+			start, end, step = '{', '}', 2
+		}
+		buf.WriteByte(start)
+		for i := 0; i+step <= len(n.Content); i += step {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if step == 2 {
+				key, _ := json.Marshal(n.Content[i].Value)
+				buf.Write(key)
+				buf.WriteByte(':')
+			}
+			if err := writeJSONNode(buf, n.Content[i+step-1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(end)
+		return nil
+	}
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return err
+	}
+	b, err := json.Marshal(integerize(v))
+	buf.Write(b)
+	return err
+}
+
+// jsonIndent は既存の JSON のインデント (最初にインデントされた行の先頭の空白) を返す。見つからない場合は 2 つの空白とする。
+func jsonIndent(data []byte) string {
+	for line := range bytes.Lines(data) {
+		if indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]; len(indent) > 0 && len(bytes.TrimSpace(line)) > 0 {
+			return string(indent)
+		}
+	}
+	return "  "
+}
+
+// hasTOMLComment は TOML の内容に、文字列の外の "#" (コメント) が含まれるかを返す。
+func hasTOMLComment(data []byte) bool {
+	var quote byte
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case quote == 0 && c == '#':
+			return true
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return false
+}
+
+// mergePatch は RFC 7396 に従い、target に patch を適用した結果を返す。null の値はキーの削除を意味する。
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// integerize は JSON の数値 (float64) のうち整数であるものを int64 へ変換する。
+// YAML / TOML へ出力した際に 1e+06 のような指数表記となり、整数のフィールドとして読み込めなくなることを防ぐ。
+func integerize(v any) any {
+	switch t := v.(type) {
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1<<53 {
+			return int64(t)
+		}
+	case map[string]any:
+		for k, val := range t {
+			t[k] = integerize(val)
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = integerize(val)
+		}
+	}
+	return v
+}
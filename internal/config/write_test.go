@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatchDocumentYAMLKeepsComments(t *testing.T) {
+	data := []byte(`# play-bin
+users:
+  # 管理者
+  admin:
+    password: old # bcrypt
+    permissions:
+      "*": ["*"]
+  guest:
+    password: guest
+servers:
+  mc:
+    workingDir: /srv/mc
+`)
+	got, err := patchDocument("config.yaml", data, map[string]any{"password": "new", "email": "a@example.com"}, "users", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(got)
+	for _, want := range []string{"# play-bin", "# 管理者", "password: new # bcrypt", "email: a@example.com"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	// 変更していないキーは元の順序のまま残る。
+	if strings.Index(out, "users:") > strings.Index(out, "servers:") || strings.Index(out, "admin:") > strings.Index(out, "guest:") {
+		t.Errorf("key order changed:\n%s", out)
+	}
+
+	got, err = patchDocument("config.yaml", data, nil, "users", "guest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "guest") {
+		t.Errorf("user was not removed:\n%s", got)
+	}
+}
+
+func TestPatchDocumentJSONKeepsOrder(t *testing.T) {
+	data := []byte("{\n\t\"users\": {\n\t\t\"b\": {\"password\": \"x\"},\n\t\t\"a\": {\"password\": \"y\"}\n\t},\n\t\"httpListen\": \":8080\"\n}\n")
+	got, err := patchDocument("config.json", data, map[string]any{"password": "z", "notify": []any{"backup"}}, "users", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n\t\"users\": {\n\t\t\"b\": {\n\t\t\t\"password\": \"x\"\n\t\t},\n\t\t\"a\": {\n\t\t\t\"password\": \"z\",\n\t\t\t\"notify\": [\n\t\t\t\t\"backup\"\n\t\t\t]\n\t\t}\n\t},\n\t\"httpListen\": \":8080\"\n}\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPatchUserTOMLWarnsAboutComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := "# play-bin\n[users.admin]\npassword = \"old\"\n\n[servers.mc]\nworkingDir = \"/srv/#mc\"\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := &LoadedConfig{Path: path}
+	result, err := c.PatchUser("admin", []byte(`{"password": "new"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(must(os.ReadFile(path))), `password = "new"`) {
+		t.Errorf("password was not written")
+	}
+	if !hasWarning(result.Issues, "comments are not preserved") {
+		t.Errorf("issues = %v, want a warning about comments", result.Issues)
+	}
+}
+
+func TestHasTOMLComment(t *testing.T) {
+	for data, want := range map[string]bool{
+		"a = \"#fff\"\n":        false,
+		"a = '#fff'\n":          false,
+		"a = \"\\\"#\"\n":       false,
+		"a = 1 # note\n":        true,
+		"# note\na = 1\n":       true,
+		"a = \"\"\"\n#\n\"\"\"": false,
+	} {
+		if got := hasTOMLComment([]byte(data)); got != want {
+			t.Errorf("hasTOMLComment(%q) = %v, want %v", data, got, want)
+		}
+	}
+}
+
+func hasWarning(issues []Issue, substr string) bool {
+	for _, i := range issues {
+		if i.Level == LevelWarning && strings.Contains(i.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
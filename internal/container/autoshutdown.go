@@ -0,0 +1,149 @@
+package container
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/errdefs"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/query"
+)
+
+// idleState はサーバーごとの無人状態の追跡情報。
+type idleState struct {
+	since  time.Time    // プレイヤー数が 0 になった時刻
+	warned map[int]bool // 送信済みの警告（残り分数）
+}
+
+// MARK: StartAutoShutdown()
+// autoShutdown が設定されたサーバーを 1 分毎に巡回し、無人状態が続いたサーバーの停止と定時起動を行う。
+func (m *Manager) StartAutoShutdown() {
+	go func() {
+		idle := make(map[string]*idleState)
+		lastStarted := make(map[string]string) // サーバー名 -> 起動済みの "日付 HH:MM"（同一分内の重複起動防止）
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			for serverName, serverCfg := range m.Config.Get().Servers {
+				policy := serverCfg.AutoShutdown
+				if policy == nil {
+					delete(idle, serverName)
+					continue
+				}
+				m.checkScheduledStart(serverName, policy, now, lastStarted)
+				if serverCfg.Query == nil || policy.IdleMinutes <= 0 {
+					continue
+				}
+				m.checkIdle(serverName, serverCfg, idle, now)
+			}
+		}
+	}()
+}
+
+// checkIdle は現在のプレイヤー数から無人時間を更新し、警告の送信や停止を行う。
+func (m *Manager) checkIdle(serverName string, serverCfg config.ServerConfig, idle map[string]*idleState, now time.Time) {
+	policy := serverCfg.AutoShutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if !m.isRunning(ctx, serverName) {
+		delete(idle, serverName)
+		return
+	}
+	result, err := query.Cached(ctx, serverName, *serverCfg.Query)
+	// 起動直後等で応答が無い場合や、プレイヤー数が取得できない方式の場合は無人とみなさない。
+	if err != nil || !result.Online || !result.Supported || result.Players > 0 {
+		delete(idle, serverName)
+		return
+	}
+
+	st, ok := idle[serverName]
+	if !ok {
+		st = &idleState{since: now, warned: make(map[int]bool)}
+		idle[serverName] = st
+		logger.Logf("Internal", "Container", "プレイヤー不在を検知しました。%d 分後に停止します: %s", policy.IdleMinutes, serverName)
+	}
+
+	remaining := policy.IdleMinutes - int(now.Sub(st.since).Minutes())
+	if remaining > 0 {
+		// 複数の警告時刻を同時に過ぎた場合（監視開始が遅れた場合等）も、警告は 1 回にまとめる。
+		warn := false
+		for _, w := range policy.Warnings {
+			if w >= remaining && !st.warned[w] {
+				st.warned[w] = true
+				warn = true
+			}
+		}
+		if warn && policy.WarningCommand != "" {
+			text := strings.ReplaceAll(policy.WarningCommand, "${minutes}", strconv.Itoa(remaining))
+			if err := docker.SendCommand(serverName, text+"\n"); err != nil {
+				logger.Errorf("Internal", "Container", "%s: 自動停止の警告送信失敗: %v", serverName, err)
+			}
+		}
+		return
+	}
+
+	delete(idle, serverName)
+	logger.Logf("Internal", "Container", "プレイヤー不在が %d 分続いたため停止します: %s", policy.IdleMinutes, serverName)
+	// 停止シーケンスは時間を要するため、他サーバーの巡回を妨げないよう非同期で実行する。
+	// 自動停止はユーザーの操作ではないため、待機時間の判定から除外する。
+	go func() {
+		ctx := WithActor(WithoutCooldown(context.Background()), "", ViaAutoShutdown)
+		if err := m.ExecuteAction(ctx, serverName, ActionStop); err != nil {
+			logger.Errorf("Internal", "Container", "自動停止に失敗(%s): %v", serverName, err)
+			return
+		}
+		// Start は既存コンテナがあると起動できないため、定時起動や手動起動に備えてコンテナを削除しておく。
+		// データはバインドマウント先に残るため、削除による損失は無い。
+		if err := m.ExecuteAction(ctx, serverName, ActionRemove); err != nil {
+			logger.Errorf("Internal", "Container", "自動停止後のコンテナ削除に失敗(%s): %v", serverName, err)
+		}
+	}()
+}
+
+// checkScheduledStart は startAt に一致する時刻であれば、停止中のサーバーを起動する。
+func (m *Manager) checkScheduledStart(serverName string, policy *config.AutoShutdownConfig, now time.Time, lastStarted map[string]string) {
+	hhmm := now.Format("15:04")
+	if !slices.Contains(policy.StartAt, hhmm) {
+		return
+	}
+	key := now.Format("2006-01-02 ") + hhmm
+	if lastStarted[serverName] == key {
+		return
+	}
+	lastStarted[serverName] = key
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if m.Config.Get().Servers[serverName].Process != nil {
+		// プロセスには残存するコンテナが無いため、停止中であれば起動する。
+		if running, err := m.running(ctx, serverName); err != nil || running {
+			return
+		}
+	} else if cli, err := docker.ForServer(serverName); err != nil {
+		return
+	} else if _, err := cli.ContainerInspect(ctx, docker.ContainerName(serverName)); !errdefs.IsNotFound(err) {
+		// 既に稼働中、または停止状態のコンテナ (同名の管理外のコンテナを含む) が残っている場合は手動操作に委ねる。
+		return
+	}
+
+	logger.Logf("Internal", "Container", "定時起動を実行します: %s (%s)", serverName, hhmm)
+	go func() {
+		if err := m.ExecuteAction(WithActor(WithoutCooldown(context.Background()), "", ViaSchedule), serverName, ActionStart); err != nil {
+			logger.Errorf("Internal", "Container", "定時起動に失敗(%s): %v", serverName, err)
+		}
+	}()
+}
+
+// isRunning はコンテナ (process のサーバーではプロセス) が稼働中かを返す。
+func (m *Manager) isRunning(ctx context.Context, serverName string) bool {
+	running, _ := m.running(ctx, serverName)
+	return running
+}
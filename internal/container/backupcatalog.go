@@ -0,0 +1,138 @@
+package container
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+// maxBackupRecords はサーバーごとに保持するバックアップの記録の上限件数。
+const maxBackupRecords = 500
+
+// MARK: BackupRecord
+// バックアップの世代ごとの記録。世代のディレクトリ名だけでは分からない、実行の経路・ユーザー・結果を保持する。
+type BackupRecord struct {
+	BackupStats
+	Status    JobStatus `json:"status,omitempty"` // succeeded / failed。カタログの導入前の世代は空
+	Error     string    `json:"error,omitempty"`
+	User      string    `json:"user,omitempty"`   // 操作したユーザー
+	Via       string    `json:"via,omitempty"`    // 操作の経路 (ViaHTTP 等)。play-bin 自身の操作は空
+	Job       string    `json:"job,omitempty"`    // バックアップを行ったジョブの ID
+	Action    Action    `json:"action,omitempty"` // ジョブの操作。backup 以外はワールドの切り替え・移行等に伴う事前のバックアップ
+	StartedAt time.Time `json:"startedAt,omitzero"`
+}
+
+// MARK: BackupCatalog
+// バックアップの世代ごとの記録を保持し、変更の都度ファイルへ書き出す。
+type BackupCatalog struct {
+	mu      sync.RWMutex
+	path    string
+	servers map[string][]BackupRecord // 古い順
+	// saveMu は保存を直列化する。書き出す内容の取得から置き換えまでを保持し、古い内容が新しい内容を上書きしないようにする。
+	saveMu sync.Mutex
+}
+
+// MARK: NewBackupCatalog()
+func NewBackupCatalog() *BackupCatalog {
+	return &BackupCatalog{servers: make(map[string][]BackupRecord)}
+}
+
+// record は 1 回のバックアップの結果を記録する。err が nil 以外の場合は失敗として記録する。
+func (c *BackupCatalog) record(ctx context.Context, serverName string, started time.Time, stats BackupStats, err error) {
+	rec := BackupRecord{BackupStats: stats, Status: JobSucceeded, StartedAt: started}
+	if err != nil {
+		rec.Status, rec.Error = JobFailed, err.Error()
+	}
+	rec.User, rec.Via = actorFrom(ctx)
+	if job := JobFromContext(ctx); job != nil {
+		rec.Job, rec.Action = job.ID, job.Action
+	}
+
+	c.mu.Lock()
+	records := append(c.servers[serverName], rec)
+	if len(records) > maxBackupRecords {
+		records = records[len(records)-maxBackupRecords:]
+	}
+	c.servers[serverName] = records
+	c.mu.Unlock()
+	c.save()
+}
+
+// MARK: List()
+// 存在する世代と失敗したバックアップの記録を新しい順で返す。
+// 記録の無い世代 (カタログの導入前や手動で作成した世代) は世代名のみを返し、削除された成功の世代は除く。
+func (c *BackupCatalog) List(serverName string, generations []string) []BackupRecord {
+	c.mu.RLock()
+	byGeneration := make(map[string]BackupRecord)
+	var failed []BackupRecord
+	for _, rec := range c.servers[serverName] {
+		if rec.Status == JobFailed {
+			failed = append(failed, rec)
+			continue
+		}
+		byGeneration[rec.Generation] = rec
+	}
+	c.mu.RUnlock()
+
+	result := make([]BackupRecord, 0, len(generations)+len(failed))
+	for _, g := range generations {
+		rec, ok := byGeneration[g]
+		if !ok {
+			rec = BackupRecord{BackupStats: BackupStats{Generation: g}}
+		}
+		result = append(result, rec)
+	}
+	for _, rec := range failed {
+		// 失敗した rsync が途中まで作成した世代は、存在する世代としての行を失敗の記録で置き換える。
+		if i := slices.IndexFunc(result, func(r BackupRecord) bool { return r.Generation == rec.Generation }); i >= 0 {
+			result[i] = rec
+			continue
+		}
+		result = append(result, rec)
+	}
+	slices.SortStableFunc(result, func(a, b BackupRecord) int { return cmp.Compare(b.Generation, a.Generation) })
+	return result
+}
+
+// save は Load で指定されたファイルへ記録を書き出す。
+// 並行して完了したバックアップの記録を失わないよう、saveMu で直列化する。
+func (c *BackupCatalog) save() {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.mu.RLock()
+	path := c.path
+	b, err := json.MarshalIndent(c.servers, "", "  ")
+	c.mu.RUnlock()
+	if path == "" {
+		return
+	}
+	if err == nil {
+		err = fsutil.WriteFile(path, b, 0o600)
+	}
+	if err != nil {
+		logger.Errorf("Internal", "Container", "バックアップの記録の保存に失敗: %v", err)
+	}
+}
+
+// MARK: Load()
+// 前回までの記録を読み込み、以降の変更の保存先とする。ファイルが存在しない場合は空の状態から始める。
+func (c *BackupCatalog) Load(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &c.servers)
+}
@@ -0,0 +1,169 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+// zfsSnapshotPrefix は play-bin が作成する ZFS のスナップショット名の接頭辞。
+const zfsSnapshotPrefix = "playbin-"
+
+// MARK: backupEngine
+// backup 定義 1 件分 (src:destBase) の世代を作成する方式。
+// 世代は destBase/<世代名> のディレクトリ (または指す先がディレクトリのシンボリックリンク) とし、復元はいずれの方式でも rsync で書き戻す。
+type backupEngine interface {
+	name() string
+	// create は src の現在の内容を destBase/generation として保存する。
+	// 変更されたファイル数とサイズを計測できない方式は nil を返す。
+	create(ctx context.Context, src, destBase, generation string) (*rsyncStats, error)
+}
+
+// MARK: selectBackupEngine()
+// commands.backupEngine に応じて方式を選ぶ。auto (省略時) は src が btrfs のサブボリュームまたは ZFS のデータセットの
+// マウントポイントであればスナップショットを、それ以外は rsync を使用する。
+func selectBackupEngine(ctx context.Context, engine, src string) (backupEngine, error) {
+	switch engine {
+	case config.BackupEngineRsync:
+		return rsyncEngine{}, nil
+	case config.BackupEngineBtrfs:
+		return btrfsEngine{}, nil
+	case config.BackupEngineZFS:
+		dataset, ok := zfsDataset(src)
+		if !ok {
+			return nil, fmt.Errorf("%s is not the mountpoint of a zfs dataset", src)
+		}
+		return zfsEngine{dataset: dataset}, nil
+	}
+
+	fstype, _, _ := mountOf(src)
+	switch fstype {
+	case "btrfs":
+		// サブボリュームのルート以外のディレクトリはスナップショットを作成できない。
+		if exec.CommandContext(ctx, "btrfs", "subvolume", "show", src).Run() == nil {
+			return btrfsEngine{}, nil
+		}
+	case "zfs":
+		if dataset, ok := zfsDataset(src); ok {
+			return zfsEngine{dataset: dataset}, nil
+		}
+	}
+	return rsyncEngine{}, nil
+}
+
+// mountOf は path を含むファイルシステムの種類・デバイス (ZFS ではデータセット名)・マウントポイントを返す。
+func mountOf(path string) (fstype, device, mountpoint string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", ""
+	}
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return "", "", ""
+	}
+	for _, p := range partitions {
+		mp := p.Mountpoint
+		if (abs == mp || strings.HasPrefix(abs, strings.TrimSuffix(mp, "/")+"/")) && len(mp) > len(mountpoint) {
+			fstype, device, mountpoint = p.Fstype, p.Device, mp
+		}
+	}
+	return fstype, device, mountpoint
+}
+
+// zfsDataset は src が ZFS のデータセットのマウントポイントである場合に、データセット名を返す。
+func zfsDataset(src string) (string, bool) {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return "", false
+	}
+	fstype, device, mountpoint := mountOf(abs)
+	return device, fstype == "zfs" && mountpoint == filepath.Clean(abs)
+}
+
+// MARK: rsyncEngine
+// rsync の --link-dest で、前回の世代から変更の無いファイルをハードリンクにして世代を作成する。
+type rsyncEngine struct{}
+
+func (rsyncEngine) name() string { return config.BackupEngineRsync }
+
+func (rsyncEngine) create(ctx context.Context, src, destBase, generation string) (*rsyncStats, error) {
+	latest := filepath.Join(destBase, "latest")
+	// --stats の数値を読み取れるよう、サイズの表記は単位や桁区切りの無い数値にする。
+	args := []string{"-avh", "--delete", "--stats", "--no-human-readable"}
+	if _, err := os.Stat(latest); err == nil {
+		// 前回バックアップをベースに、差分のみを物理コピーすることで効率化する。
+		args = append(args, "--link-dest", latest)
+	}
+	args = append(args, src+"/", filepath.Join(destBase, generation))
+
+	out, err := exec.CommandContext(ctx, "rsync", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("rsync: %w, output: %s", err, string(out))
+	}
+	rs := parseRsyncStats(string(out))
+	return &rs, nil
+}
+
+// MARK: btrfsEngine
+// src のサブボリュームの読み取り専用スナップショットを destBase/<世代名> に作成する。
+// コピーを伴わず瞬時に完了し、作成の時点で一貫した世代となる。destBase は同じ btrfs のファイルシステム上にあること。
+type btrfsEngine struct{}
+
+func (btrfsEngine) name() string { return config.BackupEngineBtrfs }
+
+func (btrfsEngine) create(ctx context.Context, src, destBase, generation string) (*rsyncStats, error) {
+	out, err := exec.CommandContext(ctx, "btrfs", "subvolume", "snapshot", "-r", src, filepath.Join(destBase, generation)).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("btrfs subvolume snapshot: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil, nil
+}
+
+// MARK: zfsEngine
+// src をマウントポイントとするデータセットのスナップショット (<dataset>@playbin-<世代名>) を作成し、
+// destBase/<世代名> からスナップショットの内容 (<src>/.zfs/snapshot/...) へシンボリックリンクを張る。
+type zfsEngine struct {
+	dataset string
+}
+
+func (zfsEngine) name() string { return config.BackupEngineZFS }
+
+func (z zfsEngine) create(ctx context.Context, src, destBase, generation string) (*rsyncStats, error) {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := zfsSnapshotPrefix + generation
+	if out, err := exec.CommandContext(ctx, "zfs", "snapshot", z.dataset+"@"+snapshot).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("zfs snapshot: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Symlink(filepath.Join(abs, ".zfs", "snapshot", snapshot), filepath.Join(destBase, generation)); err != nil {
+		return nil, fmt.Errorf("failed to link snapshot: %w", err)
+	}
+	return nil, nil
+}
+
+// MARK: createGeneration()
+// 方式を選んで世代を作成する。auto でスナップショットの作成に失敗した場合は、rsync で作成し直す。
+func createGeneration(ctx context.Context, engineName, src, destBase, generation string) (backupEngine, *rsyncStats, error) {
+	engine, err := selectBackupEngine(ctx, engineName, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, err := engine.create(ctx, src, destBase, generation)
+	auto := engineName == "" || engineName == config.BackupEngineAuto
+	if err != nil && auto && engine.name() != config.BackupEngineRsync && ctx.Err() == nil {
+		logger.For(ctx).Warnf("Internal", "Container", "%s のスナップショットを作成できないため rsync でバックアップします(%s): %v", engine.name(), src, err)
+		engine = rsyncEngine{}
+		rs, err = engine.create(ctx, src, destBase, generation)
+	}
+	return engine, rs, err
+}
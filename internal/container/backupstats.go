@@ -0,0 +1,62 @@
+package container
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MARK: BackupStats
+// 1 回のバックアップの結果。backup に複数の定義がある場合は全ての定義の合計とする。
+type BackupStats struct {
+	Generation   string `json:"generation"`   // 作成した世代 (20060102_150405)
+	Duration     int64  `json:"duration"`     // 所要時間 (ミリ秒)
+	ChangedFiles int64  `json:"changedFiles"` // 前回の世代から追加・変更されたファイルの数
+	TotalSize    int64  `json:"totalSize"`    // 世代に含まれるファイルの合計サイズ (バイト)
+	SizeDelta    int64  `json:"sizeDelta"`    // 前回の世代からの合計サイズの増減 (バイト)
+	// Engine は世代を作成した方式 (rsync / btrfs / zfs)。スナップショットでは変更されたファイル数とサイズは 0 となる。
+	Engine string `json:"engine,omitempty"`
+}
+
+// MARK: RestoreStats
+// 1 回のリストアの結果。backup に複数の定義がある場合は全ての定義の合計とする。
+type RestoreStats struct {
+	Generation string `json:"generation"`         // 復元した世代
+	Snapshot   string `json:"snapshot,omitempty"` // 復元の前に現在のデータを保存した世代。中断・失敗した場合はこの世代から戻せる
+	Files      int64  `json:"files"`              // 復元 (追加・変更) したファイルの数
+	Bytes      int64  `json:"bytes"`              // 復元したファイルの合計サイズ (バイト)
+}
+
+// rsyncStats は rsync --stats の出力から読み取った値。
+type rsyncStats struct {
+	files            int64 // 転送したファイルの数
+	totalSize        int64 // 転送元のファイルの合計サイズ
+	transferredBytes int64 // 転送したファイルの合計サイズ
+}
+
+var (
+	// rsyncTransferredPattern は --stats の転送したファイル数の行。rsync 3.1 未満では "regular " が付かない。
+	rsyncTransferredPattern = regexp.MustCompile(`(?m)^Number of (?:regular )?files transferred: ([\d,.]+)`)
+	// rsyncTotalSizePattern は --stats の転送元のファイルの合計サイズの行。
+	rsyncTotalSizePattern = regexp.MustCompile(`(?m)^Total file size: ([\d,.]+) bytes`)
+	// rsyncTransferredSizePattern は --stats の転送したファイルの合計サイズの行。
+	rsyncTransferredSizePattern = regexp.MustCompile(`(?m)^Total transferred file size: ([\d,.]+) bytes`)
+)
+
+// parseRsyncStats は rsync --stats の出力から、転送したファイル数と合計サイズを読み取る。
+// 桁区切りを含まないよう --no-human-readable を指定して実行するが、念のため区切り文字を除去する。
+func parseRsyncStats(out string) rsyncStats {
+	number := func(pattern *regexp.Regexp) int64 {
+		m := pattern.FindStringSubmatch(out)
+		if m == nil {
+			return 0
+		}
+		n, _ := strconv.ParseInt(strings.NewReplacer(",", "", ".", "").Replace(m[1]), 10, 64)
+		return n
+	}
+	return rsyncStats{
+		files:            number(rsyncTransferredPattern),
+		totalSize:        number(rsyncTotalSizePattern),
+		transferredBytes: number(rsyncTransferredSizePattern),
+	}
+}
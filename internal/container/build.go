@@ -0,0 +1,181 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/client"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: buildImage()
+// compose.build の設定に従い、データディレクトリ内の Dockerfile からイメージをビルドする。
+// Docker のレイヤーキャッシュが効くため、変更が無い場合のビルドは短時間で完了する。
+func (m *Manager) buildImage(ctx context.Context, cli *client.Client, serverName string, serverCfg config.ServerConfig) error {
+	buildCfg := serverCfg.Compose.Build
+	tag := serverCfg.Compose.ImageRef(serverName)
+
+	contextDir := buildCfg.Context
+	if contextDir == "" {
+		contextDir = "."
+	}
+	if !filepath.IsAbs(contextDir) && serverCfg.WorkingDir != "" {
+		contextDir = filepath.Join(serverCfg.WorkingDir, contextDir)
+	}
+	if info, err := os.Stat(contextDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("build context %s is not a directory", contextDir)
+	}
+
+	dockerfile := buildCfg.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+
+	args := make(map[string]*string, len(buildCfg.Args))
+	for k, v := range buildCfg.Args {
+		args[k] = &v
+	}
+
+	job := JobFromContext(ctx)
+	logger.For(ctx).Logf("Internal", "Container", "イメージをビルドしています(%s): context=%s, tag=%s", serverName, contextDir, tag)
+	job.Logf("building image %s from %s", tag, contextDir)
+
+	// ビルドコンテキストは tar としてストリーミング送信し、ディレクトリ全体をメモリに載せないようにする。
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeBuildContext(pw, contextDir))
+	}()
+	defer pr.Close()
+
+	resp, err := cli.ImageBuild(ctx, pr, build.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  dockerfile,
+		BuildArgs:   args,
+		Remove:      true,
+		AuthConfigs: docker.RegistryAuthConfigs(),
+	})
+	if err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "イメージのビルド開始に失敗(%s): %v", serverName, err)
+		return fmt.Errorf("failed to build image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := logJSONMessages(job, resp.Body); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "イメージのビルドに失敗(%s): %v", serverName, err)
+		return fmt.Errorf("failed to build image: %w", err)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "イメージのビルドが完了しました(%s): %s", serverName, tag)
+	return nil
+}
+
+// MARK: writeBuildContext()
+// ディレクトリを tar 形式で書き出す。.dockerignore に記載されたパターンに一致するファイルは除外する。
+func writeBuildContext(w io.Writer, dir string) error {
+	ignore := readDockerignore(dir)
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isIgnored(ignore, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// readDockerignore はコンテキスト直下の .dockerignore から除外パターンを読み込む。
+func readDockerignore(dir string) []string {
+	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.Trim(filepath.ToSlash(line), "/"))
+	}
+	return patterns
+}
+
+// isIgnored はパスまたはその親ディレクトリが除外パターンに一致するかを判定する。
+// 否定パターン（!）は後に記述されたものが優先される。
+func isIgnored(patterns []string, rel string) bool {
+	ignored := false
+	for _, p := range patterns {
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if matchPathOrParent(p, rel) {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
+
+func matchPathOrParent(pattern, rel string) bool {
+	for path := rel; path != "." && path != ""; path = filepath.ToSlash(filepath.Dir(path)) {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
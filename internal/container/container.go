@@ -5,20 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/containerd/errdefs"
 	ctypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 
 	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/docker"
 	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
 )
 
 type Action string
@@ -32,14 +34,89 @@ const (
 	ActionRemove  Action = "remove"
 )
 
+// MARK: Permission()
+// 操作の実行に必要な権限を返す。HTTP API・gRPC・Discord で同じ対応を用い、操作ごとに権限を付与できるようにする。
+// 個別の権限が定義されていない操作は、全ての操作を許可する container.execute.* を要求する。
+func (a Action) Permission() string {
+	switch a {
+	case ActionStart:
+		return config.PermContainerStart
+	case ActionStop:
+		return config.PermContainerStop
+	case ActionKill:
+		return config.PermContainerKill
+	case ActionBackup:
+		return config.PermContainerBackup
+	case ActionRestore:
+		return config.PermContainerRestore
+	case ActionRemove:
+		return config.PermContainerRemove
+	case ActionSnapshot:
+		return config.PermContainerSnapshot
+	case ActionMigrate:
+		return config.PermContainerMigrate
+	default:
+		return config.PermContainerExecute
+	}
+}
+
 // Manager handles high-level container operations
 type Manager struct {
 	Config *config.LoadedConfig
+	Jobs   *JobTracker
+
+	// Readiness は起動したサーバーが接続を受け付けられる状態になったかの判定結果。
+	Readiness *ReadinessTracker
+	// States はサーバーごとの最後の操作と停止理由の記録。
+	States *StateStore
+	// Traffic はサーバーごとのネットワークの通信量の日ごとの集計。
+	Traffic *TrafficStore
+	// Backups はバックアップの世代ごとの実行の経路・ユーザー・結果の記録。
+	Backups *BackupCatalog
+
+	// cooldowns はサーバー・操作ごとの最後の受付時刻。連打による負荷や誤操作を防ぐ。
+	cooldowns cooldownTracker
+	// reconciled は設定と実際のコンテナの最後の照合結果。
+	reconciled reconcileState
+
+	// BeforeCreate はコンテナの作成直前に呼び出される。
+	// 停止中にゲームポートを代理で待ち受けている場合に、Docker がポートを確保できるよう解放するために使用する。
+	BeforeCreate func(serverName string)
+}
+
+// MARK: NewManager()
+// コンテナ操作マネージャーを、ジョブ追跡機構と共に初期化する。ジョブの開始・完了は最後の操作として States へ記録し、完了時にはサーバーの post フックを実行する。
+func NewManager(cfg *config.LoadedConfig) *Manager {
+	m := &Manager{
+		Config:    cfg,
+		Jobs:      NewJobTracker(),
+		Readiness: NewReadinessTracker(),
+		States:    NewStateStore(),
+		Traffic:   NewTrafficStore(),
+		Backups:   NewBackupCatalog(),
+	}
+	m.Jobs.observe = func(j Job) {
+		m.States.recordJob(j)
+		m.runPostHook(j)
+	}
+	return m
 }
 
 // MARK: ExecuteAction()
 // 指定されたアクション（起動、停止など）をコンテナに対して実行する。
-func (m *Manager) ExecuteAction(ctx context.Context, serverName string, action Action) error {
+// 実行はジョブとして記録され、進行状況は Jobs の購読者へ通知される。
+// サーバーの cooldowns で待機時間が設定されている場合、待機時間内の再実行は *CooldownError で拒否する。
+func (m *Manager) ExecuteAction(ctx context.Context, serverName string, action Action) (err error) {
+	if err := m.checkCooldown(ctx, serverName, action); err != nil {
+		return err
+	}
+	job := m.Jobs.Begin(ctx, serverName, action)
+	defer func() { job.Finish(err) }()
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return err
+	}
+
 	// アクションの種類に応じて、低レベルな個別メソッドに処理を委譲する。
 	switch action {
 	case ActionStart:
@@ -55,6 +132,12 @@ func (m *Manager) ExecuteAction(ctx context.Context, serverName string, action A
 		return fmt.Errorf("restore requires a generation parameter. use dedicated restore handler")
 	case ActionRemove:
 		return m.Remove(ctx, serverName)
+	case ActionWorld:
+		// ワールド操作は対象のワールド名等のパラメータを要するため、専用のメソッドから実行する。
+		return fmt.Errorf("world operations require parameters. use dedicated world handler")
+	case ActionMigrate:
+		// 移行は移行先のホストを要するため、専用のメソッドから実行する。
+		return fmt.Errorf("migration requires a target host. use dedicated migrate handler")
 	default:
 		return fmt.Errorf("unknown action: %w", errors.New(string(action)))
 	}
@@ -62,47 +145,100 @@ func (m *Manager) ExecuteAction(ctx context.Context, serverName string, action A
 
 // MARK: Start()
 // コンフィグ情報を元にコンテナを起動する。
-// 既に同名のコンテナが存在する場合は、手動での削除を促しエラーを返す。
+// 既に同名のコンテナが存在する場合は、手動での削除を促しエラーを返す。play-bin が作成したものではない場合は操作しない。
 func (m *Manager) Start(ctx context.Context, serverName string) error {
 	cfg := m.Config.Get()
 	serverCfg, ok := cfg.Servers[serverName]
-	if !ok || serverCfg.Compose == nil || serverCfg.Compose.Image == "" {
-		// 設定が存在しない、またはイメージが未定義の場合は、起動対象外として何もしない。
+	if pc := serverCfg.ProcessSettings(); ok && pc != nil {
+		return m.startProcess(ctx, serverName, serverCfg, *pc)
+	}
+	if !ok || serverCfg.Compose.ImageRef(serverName) == "" {
+		// 設定が存在しない、またはイメージ（ビルド設定）が未定義の場合は、起動対象外として何もしない。
 		return nil
 	}
+	imageRef := serverCfg.Compose.ImageRef(serverName)
+
+	// サーバーの host 指定に応じて、操作対象の Docker デーモンを選択する。
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return err
+	}
 
 	// 既にコンテナが存在するか確認する。
 	// 安全のため、ユーザーが明示的に /remove を実行するまで、自動での破壊（再作成）は行わない。
-	if inspect, err := docker.Client.ContainerInspect(ctx, serverName); err == nil {
+	containerName := docker.ContainerName(serverName)
+	if inspect, err := docker.InspectOwned(ctx, cli, serverName); err == nil {
 		if inspect.State.Running {
-			return fmt.Errorf("container %s is already running. please stop and remove it first", serverName)
+			return fmt.Errorf("container %s is already running. please stop and remove it first", containerName)
 		}
-		return fmt.Errorf("container %s already exists. please remove it manually to apply new config", serverName)
+		return fmt.Errorf("container %s already exists. please remove it manually to apply new config", containerName)
+	} else if errors.Is(err, docker.ErrNotOwned) {
+		// 同名の管理外のコンテナは削除・再作成の対象とせず、名前の変更か containerPrefix の設定を促す。
+		logger.For(ctx).Warnf("Client", "Container", "同名の管理外のコンテナが存在するため起動を中止しました(%s): %v", serverName, err)
+		return fmt.Errorf("%w. rename or remove it, or set containerPrefix", err)
 	} else if !errdefs.IsNotFound(err) {
 		// 存在しない(missing)場合のエラー以外は、クリティカルな問題として扱う。
-		logger.Logf("Internal", "Container", "コンテナ状態確認失敗(%s): %v", serverName, err)
+		logger.For(ctx).Errorf("Internal", "Container", "コンテナ状態確認失敗(%s): %v", serverName, err)
 		return fmt.Errorf("failed to inspect container: %w", err)
 	}
 
+	if serverCfg.Compose.Build != nil {
+		// ビルド設定がある場合は、データディレクトリ内の Dockerfile から最新のイメージを生成する。
+		if err := m.buildImage(ctx, cli, serverName, serverCfg); err != nil {
+			return err
+		}
+	} else if err := m.ensureImage(ctx, cli, serverName, imageRef); err != nil {
+		// イメージがローカルに存在しない場合は、レジストリ認証情報を用いて事前にプルする。
+		return err
+	}
+
+	// server.properties 等の設定ファイルをテンプレートから生成し、ポートやパスワードを設定と一致させる。
+	if err := m.renderConfigFiles(serverName, serverCfg); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "設定ファイル生成失敗(%s): %v", serverName, err)
+		return err
+	}
+
 	// コンテナのランタイム設定。TTYを有効にすることで、Web経由のターミナル操作を可能にする。
+	// 所有ラベルにより、以降の操作で同名の管理外のコンテナと区別する。
 	containerConfig := &ctypes.Config{
-		Image:     serverCfg.Compose.Image,
+		Image:     imageRef,
 		Tty:       true,
 		OpenStdin: true,
+		Labels:    map[string]string{docker.OwnerLabel: serverName},
 	}
 
 	// カスタムの起動コマンドが指定されている場合のみ、エントリポイントや引数を上書きする。
+	// ${MEMORY_MB} 等は、メモリの上限やポートの設定と一致するよう、作成の直前に算出した値で置換する。
 	if serverCfg.Compose.Command != nil {
+		vars := serverCfg.Compose.StartVars()
 		if e := serverCfg.Compose.Command.Entrypoint; e != "" {
-			containerConfig.Entrypoint = strings.Fields(e)
+			argv, err := config.ParseStartCommand(e, vars)
+			if err != nil {
+				return fmt.Errorf("compose.command.entrypoint: %w", err)
+			}
+			containerConfig.Entrypoint = argv
 		}
 		if a := serverCfg.Compose.Command.Arguments; a != "" {
-			containerConfig.Cmd = strings.Fields(a)
+			argv, err := config.ParseStartCommand(a, vars)
+			if err != nil {
+				return fmt.Errorf("compose.command.arguments: %w", err)
+			}
+			containerConfig.Cmd = argv
 		}
 	}
 
 	hostConfig := &ctypes.HostConfig{}
 
+	// メモリ・CPU の上限を設定する。
+	if r := serverCfg.Compose.Resources; r != nil {
+		memory, err := r.MemoryBytes()
+		if err != nil {
+			return fmt.Errorf("compose.resources.memory: %w", err)
+		}
+		hostConfig.Memory = memory
+		hostConfig.NanoCPUs = int64(r.CPUs * 1e9)
+	}
+
 	// 設定された全ディレクトリをホストからコンテナのボリュームとしてマッピングする。
 	for hostPath, containerPath := range serverCfg.Compose.Mount {
 		hostConfig.Binds = append(hostConfig.Binds, hostPath+":"+containerPath)
@@ -128,27 +264,42 @@ func (m *Manager) Start(ctx context.Context, serverName string) error {
 	if hostConfig.NetworkMode == "bridge" && len(serverCfg.Compose.Network.Mapping) > 0 {
 		portBindings := nat.PortMap{}
 		exposedPorts := nat.PortSet{}
-		for hostPort, containerPort := range serverCfg.Compose.Network.Mapping {
-			port := nat.Port(containerPort + "/tcp")
-			exposedPorts[port] = struct{}{}
-			portBindings[port] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: hostPort}}
+		// 範囲の指定はポートごとに展開し、同じコンテナ側のポートを複数のアドレス・ポートで公開する場合はバインドを追加する。
+		// アドレスを省略した場合は HostIP を空にし、Docker に IPv4 と IPv6 の両方で公開させる。
+		for _, mapping := range serverCfg.Compose.Network.PortMappings() {
+			for i := range mapping.Count {
+				port := nat.Port(fmt.Sprintf("%d/%s", mapping.ContainerPort+i, mapping.Protocol))
+				exposedPorts[port] = struct{}{}
+				portBindings[port] = append(portBindings[port], nat.PortBinding{HostIP: mapping.HostIP, HostPort: strconv.Itoa(mapping.HostPort + i)})
+			}
 		}
 		containerConfig.ExposedPorts = exposedPorts
 		hostConfig.PortBindings = portBindings
 	}
 
+	if m.BeforeCreate != nil {
+		m.BeforeCreate(serverName)
+	}
+
 	// コンテナの実体を Docker エンジン上に生成する。
-	if _, err := docker.Client.ContainerCreate(ctx, containerConfig, hostConfig, &network.NetworkingConfig{}, nil, serverName); err != nil {
-		logger.Logf("Internal", "Container", "コンテナ作成失敗(%s): %v", serverName, err)
+	if _, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, &network.NetworkingConfig{}, nil, containerName); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "コンテナ作成失敗(%s): %v", serverName, err)
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
 	// 生成したコンテナプロセスの実行を開始する。
-	if err := docker.Client.ContainerStart(ctx, serverName, ctypes.StartOptions{}); err != nil {
-		logger.Logf("Internal", "Container", "コンテナ起動失敗(%s): %v", serverName, err)
+	startedAt := time.Now()
+	if err := cli.ContainerStart(ctx, containerName, ctypes.StartOptions{}); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "コンテナ起動失敗(%s): %v", serverName, err)
 		return fmt.Errorf("failed to start container: %w", err)
 	}
-	logger.Logf("Internal", "Container", "コンテナの起動に成功しました: %s", serverName)
+	logger.For(ctx).Logf("Internal", "Container", "コンテナの起動に成功しました: %s", serverName)
+
+	// 起動イベントの受信を待たずに判定を開始し、直後の問い合わせでも starting を返せるようにする。
+	if serverCfg.Ready != nil {
+		m.Readiness.begin(serverName, startedAt, *serverCfg.Ready, nil)
+		return m.waitReady(ctx, serverName)
+	}
 	return nil
 }
 
@@ -157,9 +308,21 @@ func (m *Manager) Start(ctx context.Context, serverName string) error {
 func (m *Manager) Stop(ctx context.Context, serverName string) error {
 	cfg := m.Config.Get()
 	serverCfg, ok := cfg.Servers[serverName]
+	pc := serverCfg.ProcessSettings()
 	if !ok {
-		// 管理対象外のコンテナは、標準的な停止命令（SIGTERM 等）のみを発行する。
-		return docker.Client.ContainerStop(ctx, serverName, ctypes.StopOptions{})
+		// play-bin が作成していないコンテナは操作しない。
+		return fmt.Errorf("%w: %s is not a configured server", docker.ErrNotOwned, serverName)
+	}
+	var cli *client.Client
+	var containerName string
+	if pc == nil {
+		var err error
+		if cli, err = docker.ForServer(serverName); err != nil {
+			return err
+		}
+		if containerName, err = ownedContainer(ctx, cli, serverName); err != nil {
+			return err
+		}
 	}
 
 	// データを安全に保存して終了させるため、Docker 停止前に定義済みのクリーンアップ手順を実行する。
@@ -168,16 +331,20 @@ func (m *Manager) Stop(ctx context.Context, serverName string) error {
 		case "attach":
 			// コンテナの stdin に直接コマンドを流し込み、アプリケーションレベルの終了処理を促す。
 			if err := docker.SendCommand(serverName, cmd.Arg); err != nil {
-				logger.Logf("Internal", "Container", "%s: attachコマンド送信失敗: %v", serverName, err)
+				logger.For(ctx).Errorf("Internal", "Container", "%s: attachコマンド送信失敗: %v", serverName, err)
 			}
 		case "exec":
-			// 外部から補助プロセスを実行してクリーンアップを行う。
-			if err := docker.SendExec(serverName, []string{"/bin/sh", "-c", cmd.Arg}); err != nil {
-				logger.Logf("Internal", "Container", "%s: exec実行失敗: %v", serverName, err)
+			// 外部から補助プロセスを実行してクリーンアップを行う。process のサーバーでは、ホスト上で作業ディレクトリから実行する。
+			if pc != nil {
+				if err := hostExec(ctx, pc.Directory, cmd.Arg); err != nil {
+					logger.For(ctx).Errorf("Internal", "Container", "%s: exec実行失敗: %v", serverName, err)
+				}
+			} else if err := docker.SendExec(serverName, []string{"/bin/sh", "-c", cmd.Arg}); err != nil {
+				logger.For(ctx).Errorf("Internal", "Container", "%s: exec実行失敗: %v", serverName, err)
 			}
 		case "log":
 			// 運用の透明性を確保するため、重要なフェーズをシステムログに刻む。
-			logger.Log("Internal", "Container", fmt.Sprintf("[%s] %s", serverName, cmd.Arg))
+			logger.For(ctx).Log("Internal", "Container", fmt.Sprintf("[%s] %s", serverName, cmd.Arg))
 		case "sleep":
 			// アプリケーションが完全にシャットダウンするまでの猶予期間を確保する。
 			if dur, err := time.ParseDuration(cmd.Arg); err == nil {
@@ -186,28 +353,53 @@ func (m *Manager) Stop(ctx context.Context, serverName string) error {
 		}
 	}
 
+	if pc != nil {
+		if err := process.Stop(ctx, serverName, *pc); err != nil {
+			logger.For(ctx).Errorf("Internal", "Container", "プロセス停止失敗(%s): %v", serverName, err)
+			return fmt.Errorf("failed to stop process: %w", err)
+		}
+		logger.For(ctx).Logf("Internal", "Container", "プロセスの停止に成功しました: %s", serverName)
+		return nil
+	}
+
 	// 全ての手順が完了、またはタイムアウト後に、Docker レベルでコンテナを最終停止させる。
-	if err := docker.Client.ContainerStop(ctx, serverName, ctypes.StopOptions{}); err != nil {
-		logger.Logf("Internal", "Container", "コンテナ停止失敗(%s): %v", serverName, err)
+	if err := cli.ContainerStop(ctx, containerName, ctypes.StopOptions{}); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "コンテナ停止失敗(%s): %v", serverName, err)
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
-	logger.Logf("Internal", "Container", "コンテナの停止に成功しました: %s", serverName)
+	logger.For(ctx).Logf("Internal", "Container", "コンテナの停止に成功しました: %s", serverName)
 	return nil
 }
 
 // MARK: Kill()
 // 応答不能になったコンテナを、SIGKILL 等を用いて強制的に停止する。
 func (m *Manager) Kill(ctx context.Context, serverName string) error {
+	if pc := m.Config.Get().Servers[serverName].ProcessSettings(); pc != nil {
+		if err := process.Kill(ctx, serverName, *pc); err != nil {
+			return fmt.Errorf("failed to kill process: %w", err)
+		}
+		logger.For(ctx).Logf("Internal", "Container", "プロセスを強制終了しました: %s", serverName)
+		return nil
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return err
+	}
+	containerName, err := ownedContainer(ctx, cli, serverName)
+	if err != nil {
+		return err
+	}
+
 	timeout := 30
 	// 可能な限りリソースを壊さないよう、まずは短いタイムアウト付きで標準的な停止を試みる。
-	if err := docker.Client.ContainerStop(ctx, serverName, ctypes.StopOptions{Timeout: &timeout}); err == nil {
-		logger.Logf("Internal", "Container", "コンテナが正常に停止しました(Kill経由): %s", serverName)
+	if err := cli.ContainerStop(ctx, containerName, ctypes.StopOptions{Timeout: &timeout}); err == nil {
+		logger.For(ctx).Logf("Internal", "Container", "コンテナが正常に停止しました(Kill経由): %s", serverName)
 		return nil
 	}
 	// 標準停止が失敗した場合、OS レベルでプロセスを強制終了させる。
-	err := docker.Client.ContainerKill(ctx, serverName, "SIGKILL")
+	err = cli.ContainerKill(ctx, containerName, "SIGKILL")
 	if err == nil {
-		logger.Logf("Internal", "Container", "コンテナを強制終了しました: %s", serverName)
+		logger.For(ctx).Logf("Internal", "Container", "コンテナを強制終了しました: %s", serverName)
 	} else {
 		err = fmt.Errorf("failed to kill container: %w", err)
 	}
@@ -215,22 +407,38 @@ func (m *Manager) Kill(ctx context.Context, serverName string) error {
 }
 
 // MARK: Backup()
-// 指定されたパスのデータを、rsync を用いてインクリメンタルにバックアップする。
+// 指定されたパスのデータを、rsync を用いてインクリメンタルにバックアップする。結果はジョブと Backups へ記録する。
 func (m *Manager) Backup(ctx context.Context, serverName string) error {
+	_, err := m.backup(ctx, serverName)
+	return err
+}
+
+// backup は Backup の本体で、作成した世代と結果を返す。
+func (m *Manager) backup(ctx context.Context, serverName string) (stats BackupStats, err error) {
 	cfg := m.Config.Get()
 	serverCfg, ok := cfg.Servers[serverName]
 	if !ok {
-		return fmt.Errorf("server %s not found in config or not managed by docker", serverName)
+		return stats, fmt.Errorf("server %s not found in config or not managed by docker", serverName)
 	}
 
 	// マシンのタイムゾーンに合わせた世代名を生成する。
-	timestamp := time.Now().Local().Format("20060102_150405")
-	var hasError bool
+	started := time.Now()
+	timestamp := started.Local().Format("20060102_150405")
+	var hasError, attempted bool
+	stats.Generation = timestamp
+	// 失敗した場合も途中までの結果を通知できるよう、終了時に必ずジョブへ記録する。
+	defer func() {
+		stats.Duration = time.Since(started).Milliseconds()
+		JobFromContext(ctx).SetBackup(stats)
+		if attempted {
+			m.Backups.record(ctx, serverName, started, stats, err)
+		}
+	}()
 
 	// 整合性のあるバックアップを取得するため、事前に「保存」コマンド等を送信する必要があるかを確認する。
-	isRunning := false
-	if inspect, err := docker.Client.ContainerInspect(ctx, serverName); err == nil && inspect.State.Running {
-		isRunning = true
+	isRunning, err := m.running(ctx, serverName)
+	if err != nil {
+		return stats, err
 	}
 
 	for _, cmd := range serverCfg.Commands.Backup {
@@ -238,12 +446,12 @@ func (m *Manager) Backup(ctx context.Context, serverName string) error {
 		case "attach":
 			// コンテナが起動していない場合は、stdinへのコマンド送信は失敗するためスキップする。
 			if !isRunning {
-				logger.Logf("Internal", "Container", "%s: コンテナ停止中のためバックアップ準備コマンド(attach)をスキップします", serverName)
+				logger.For(ctx).Logf("Internal", "Container", "%s: コンテナ停止中のためバックアップ準備コマンド(attach)をスキップします", serverName)
 				continue
 			}
 			// ゲームサーバー等の「save-all」コマンドを想定し、ディスクへの同期を促す。
 			if err := docker.SendCommand(serverName, cmd.Arg+"\n"); err != nil {
-				logger.Logf("Internal", "Container", "%s: バックアップ準備コマンド送信失敗: %v", serverName, err)
+				logger.For(ctx).Errorf("Internal", "Container", "%s: バックアップ準備コマンド送信失敗: %v", serverName, err)
 			}
 		case "sleep":
 			// コンテナが停止中の場合は待機も不要なためスキップする（時短）。
@@ -255,29 +463,35 @@ func (m *Manager) Backup(ctx context.Context, serverName string) error {
 				time.Sleep(dur)
 			}
 		case "backup":
-			// 実データのコピー。rsync の --link-dest を使用し、変更がないファイルはハードリンクにする。
+			// 実データの保存。方式 (rsync / btrfs / ZFS) は commands.backupEngine と保存元のファイルシステムから選ぶ。
 			parts := strings.SplitN(cmd.Arg, ":", 2)
 			if len(parts) != 2 {
 				continue
 			}
 			src, destBase := parts[0], parts[1]
-			current := fmt.Sprintf("%s/%s", destBase, timestamp)
-			latest := fmt.Sprintf("%s/latest", destBase)
+			attempted = true
+			latest := filepath.Join(destBase, "latest")
+			previous, _ := filepath.EvalSymlinks(latest)
 
 			_ = os.MkdirAll(destBase, 0755)
 
-			args := []string{"-avh", "--delete"}
-			if _, err := os.Stat(latest); err == nil {
-				// 前回バックアップをベースに、差分のみを物理コピーすることで効率化する。
-				args = append(args, "--link-dest", latest)
-			}
-			args = append(args, src+"/", current)
-
-			if out, err := exec.CommandContext(ctx, "rsync", args...).CombinedOutput(); err != nil {
-				logger.Logf("Internal", "Container", "%s: rsync失敗: %v, output: %s", serverName, err, string(out))
+			engine, rs, err := createGeneration(ctx, serverCfg.Commands.BackupEngine, src, destBase, timestamp)
+			if err != nil {
+				logger.For(ctx).Errorf("Internal", "Container", "%s: バックアップ失敗: %v", serverName, err)
 				hasError = true
 				continue
 			}
+			stats.Engine = engine.name()
+			// スナップショットは差分を計測できないため、rsync で作成した場合のみ変更されたファイル数とサイズを集計する。
+			if rs != nil {
+				var prevSize int64
+				if previous != "" {
+					prevSize, _ = dirUsage(previous)
+				}
+				stats.ChangedFiles += rs.files
+				stats.TotalSize += rs.totalSize
+				stats.SizeDelta += rs.totalSize - prevSize
+			}
 
 			// バックアップ完了後、最新版へのシンボリックリンクを貼り替え、管理を容易にする。
 			_ = os.Remove(latest)
@@ -286,10 +500,10 @@ func (m *Manager) Backup(ctx context.Context, serverName string) error {
 	}
 
 	if hasError {
-		return fmt.Errorf("backup failed partially: %w", errors.New("one or more backup steps failed"))
+		return stats, fmt.Errorf("backup failed partially: %w", errors.New("one or more backup steps failed"))
 	}
-	logger.Logf("Internal", "Container", "バックアップが完了しました: %s", serverName)
-	return nil
+	logger.For(ctx).Logf("Internal", "Container", "バックアップが完了しました: %s", serverName)
+	return stats, nil
 }
 
 // MARK: ListBackupGenerations()
@@ -328,7 +542,10 @@ func (m *Manager) ListBackupGenerations(serverName string) ([]string, error) {
 				continue
 			}
 			if !entry.IsDir() {
-				continue
+				// ZFS の世代はスナップショットの内容へのシンボリックリンクのため、指す先がディレクトリであれば含める。
+				if info, err := os.Stat(filepath.Join(destBase, entry.Name())); err != nil || !info.IsDir() {
+					continue
+				}
 			}
 			if !seen[entry.Name()] {
 				seen[entry.Name()] = true
@@ -342,13 +559,34 @@ func (m *Manager) ListBackupGenerations(serverName string) ([]string, error) {
 	return generations, nil
 }
 
+// MARK: ListBackups()
+// バックアップの世代を、カタログに記録した実行の経路・ユーザー・所要時間・サイズ・結果と共に新しい順で返す。
+func (m *Manager) ListBackups(serverName string) ([]BackupRecord, error) {
+	generations, err := m.ListBackupGenerations(serverName)
+	if err != nil {
+		return nil, err
+	}
+	return m.Backups.List(serverName, generations), nil
+}
+
 // MARK: Restore()
 // 指定された世代のバックアップからデータをロールバックする。
 // generation は必須であり、空文字の場合はエラーを返す。
-func (m *Manager) Restore(ctx context.Context, serverName string, generation string) error {
+func (m *Manager) Restore(ctx context.Context, serverName string, generation string) (err error) {
 	if generation == "" {
 		return fmt.Errorf("generation is required for restore")
 	}
+	if err := m.checkCooldown(ctx, serverName, ActionRestore); err != nil {
+		return err
+	}
+
+	job := m.Jobs.Begin(ctx, serverName, ActionRestore)
+	defer func() { job.Finish(err) }()
+	job.Logf("generation: %s", generation)
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return err
+	}
 
 	cfg := m.Config.Get()
 	serverCfg, ok := cfg.Servers[serverName]
@@ -358,16 +596,16 @@ func (m *Manager) Restore(ctx context.Context, serverName string, generation str
 
 	// 復旧作業中のデータ競合を防ぐため、一旦コンテナを確実に停止させる必要がある。
 	// 起動中のコンテナに対するRestoreは危険なため、エラーとして拒否する。
-	if inspect, err := docker.Client.ContainerInspect(ctx, serverName); err == nil && inspect.State.Running {
+	if running, err := m.running(ctx, serverName); err != nil {
+		return err
+	} else if running {
 		return fmt.Errorf("container is running. please stop it before restore")
 	}
 
-	var hasError bool
-	for _, cmd := range serverCfg.Commands.Backup {
-		if cmd.Type != "backup" {
-			continue
-		}
-
+	// 復元元と復元先の組。latest は事前のスナップショットで置き換わるため、先に指している世代を解決しておく。
+	type restoreTarget struct{ from, to string }
+	var targets []restoreTarget
+	for _, cmd := range backupTargets(serverCfg) {
 		parts := strings.SplitN(cmd.Arg, ":", 2)
 		if len(parts) != 2 {
 			continue
@@ -376,51 +614,106 @@ func (m *Manager) Restore(ctx context.Context, serverName string, generation str
 
 		// 必須パラメータとして受け取った世代名のディレクトリから復元する。
 		restoreSrc := filepath.Join(destBase, generation)
-
+		if resolved, err := filepath.EvalSymlinks(restoreSrc); err == nil {
+			restoreSrc = resolved
+		}
 		if _, err := os.Stat(restoreSrc); err != nil {
 			// 復元元が存在しない場合は、警告を出しつつ次の項目へ。
-			logger.Logf("Internal", "Container", "%s: 復元対象のバックアップが見つかりません: %s", serverName, restoreSrc)
+			logger.For(ctx).Logf("Internal", "Container", "%s: 復元対象のバックアップが見つかりません: %s", serverName, restoreSrc)
 			continue
 		}
+		targets = append(targets, restoreTarget{from: restoreSrc, to: src})
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// 大きなワールドの復元は時間がかかるため、中断できるようにする。
+	// 復元の前に現在のデータをスナップショット (通常の世代) として保存し、中断・失敗した場合もその世代から戻せるようにする。
+	job.AllowCancel()
+	job.Logf("taking pre-restore snapshot")
+	snapshot, err := m.backup(ctx, serverName)
+	if err != nil {
+		return fmt.Errorf("pre-restore snapshot failed: %w", err)
+	}
+	job.Logf("pre-restore snapshot: %s", snapshot.Generation)
 
+	stats := RestoreStats{Generation: generation, Snapshot: snapshot.Generation}
+	defer func() { job.SetRestore(stats) }()
+	var hasError bool
+	for _, t := range targets {
+		job.Logf("restoring %s", t.to)
 		// バックアップ時点の状態に完全に一致させるため、rsync の --delete オプション付きで復元する。
-		if out, err := exec.CommandContext(ctx, "rsync", "-avh", "--delete", restoreSrc+"/", src).CombinedOutput(); err != nil {
-			logger.Logf("Internal", "Container", "%s: 復元失敗: %v, output: %s", serverName, err, string(out))
+		out, err := runRsync(ctx, "-a", "--delete", "--stats", "--no-human-readable", "--info=progress2", "--no-inc-recursive", t.from+"/", t.to)
+		if ctx.Err() != nil {
+			// 中断したデータは途中まで書き換わっているため、スナップショットの世代を案内する。
+			logger.For(ctx).Logf("Internal", "Container", "%s: 復元を中断しました。事前のスナップショット %s から戻せます", serverName, snapshot.Generation)
+			return fmt.Errorf("restore canceled; data may be partially restored, restore generation %s to roll back: %w", snapshot.Generation, ctx.Err())
+		}
+		if err != nil {
+			logger.For(ctx).Errorf("Internal", "Container", "%s: 復元失敗: %v, output: %s", serverName, err, out)
 			hasError = true
+			continue
 		}
+		rs := parseRsyncStats(out)
+		stats.Files += rs.files
+		stats.Bytes += rs.transferredBytes
 	}
 
 	if hasError {
-		return fmt.Errorf("restore failed partially")
+		return fmt.Errorf("restore failed partially; restore generation %s to roll back", snapshot.Generation)
 	}
 
-	logger.Logf("Internal", "Container", "世代 %s からの復元が完了しました: %s", generation, serverName)
+	job.Logf("restored %d files (%d bytes)", stats.Files, stats.Bytes)
+	logger.For(ctx).Logf("Internal", "Container", "世代 %s からの復元が完了しました: %s", generation, serverName)
 	return nil
 }
 
 // MARK: Remove()
 // 停止状態のコンテナを、Docker エンジンから物理的に削除する。
 func (m *Manager) Remove(ctx context.Context, serverName string) error {
-	// 誤って稼働中のサービスを破壊しないよう、事前に実行状態を厳密にチェックする。
-	if inspect, err := docker.Client.ContainerInspect(ctx, serverName); err == nil {
+	if m.Config.Get().Servers[serverName].Process != nil {
+		// ホスト上で直接実行するサーバーには、削除するコンテナが存在しない。
+		return nil
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return err
+	}
+
+	// 誤って稼働中のサービスや管理外のコンテナを破壊しないよう、事前に実行状態と所有者を厳密にチェックする。
+	if inspect, err := docker.InspectOwned(ctx, cli, serverName); err == nil {
 		if inspect.State.Running {
 			// 稼働中の場合は削除を拒否し、ユーザーに停止を促す。
 			return fmt.Errorf("container is running. please stop/kill it before remove")
 		}
+	} else if errors.Is(err, docker.ErrNotOwned) {
+		logger.For(ctx).Warnf("Client", "Container", "管理外のコンテナのため削除を中止しました(%s): %v", serverName, err)
+		return err
 	} else if errdefs.IsNotFound(err) {
 		// 既に存在しない場合は、目的が達成されているため成功として扱う。
 		return nil
 	} else {
-		logger.Logf("Internal", "Container", "コンテナ状態確認失敗(%s): %v", serverName, err)
+		logger.For(ctx).Errorf("Internal", "Container", "コンテナ状態確認失敗(%s): %v", serverName, err)
 		return fmt.Errorf("failed to check container state: %w", err)
 	}
 
 	// Docker SDK を呼び出し、コンテナを破棄する。
-	if err := docker.Client.ContainerRemove(ctx, serverName, ctypes.RemoveOptions{}); err != nil {
-		logger.Logf("Internal", "Container", "コンテナ削除失敗(%s): %v", serverName, err)
+	if err := cli.ContainerRemove(ctx, docker.ContainerName(serverName), ctypes.RemoveOptions{}); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "コンテナ削除失敗(%s): %v", serverName, err)
 		return fmt.Errorf("failed to remove container: %w", err)
 	}
 
-	logger.Logf("Internal", "Container", "コンテナを削除しました: %s", serverName)
+	logger.For(ctx).Logf("Internal", "Container", "コンテナを削除しました: %s", serverName)
 	return nil
 }
+
+// ownedContainer はサーバーのコンテナの Docker 上の名前を返す。同名の管理外のコンテナの場合は ErrNotOwned を返し、呼び出し元は操作を中止する。
+// 存在しない場合は名前をそのまま返し、Docker の呼び出しのエラーに委ねる。
+func ownedContainer(ctx context.Context, cli *client.Client, serverName string) (string, error) {
+	if _, err := docker.InspectOwned(ctx, cli, serverName); errors.Is(err, docker.ErrNotOwned) {
+		logger.For(ctx).Warnf("Client", "Container", "管理外のコンテナのため操作を中止しました(%s): %v", serverName, err)
+		return "", err
+	}
+	return docker.ContainerName(serverName), nil
+}
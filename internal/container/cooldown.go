@@ -0,0 +1,73 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/logger"
+)
+
+// ErrCooldown は操作が待機時間 (cooldowns) 内に再度要求されたことを表す。詳細は *CooldownError で取得できる。
+var ErrCooldown = errors.New("action is on cooldown")
+
+// MARK: CooldownError
+// 待機時間内の操作の拒否。HTTP API は 429 と Retry-After、gRPC は ResourceExhausted、Discord はメッセージで再試行までの時間を伝える。
+type CooldownError struct {
+	Server     string
+	Action     Action
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%s on %s is on cooldown. retry after %s", e.Action, e.Server, e.RetryAfter.Round(time.Second))
+}
+
+func (e *CooldownError) Is(target error) bool {
+	return target == ErrCooldown
+}
+
+// cooldownTracker はサーバーと操作の組ごとに、最後に操作を受け付けた時刻を保持する。
+type cooldownTracker struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+type noCooldownKey struct{}
+
+// MARK: WithoutCooldown()
+// 自動停止や予約起動等、play-bin 自身が開始する操作を待機時間の判定・記録から除外する。
+func WithoutCooldown(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCooldownKey{}, true)
+}
+
+// MARK: checkCooldown()
+// サーバーの cooldowns に従い、前回の受付から待機時間が経過しているかを判定する。経過していれば現在時刻を記録して受け付ける。
+// 失敗した操作も受付として数え、失敗を繰り返す操作の連打も抑止する。
+func (m *Manager) checkCooldown(ctx context.Context, serverName string, action Action) error {
+	if ctx.Value(noCooldownKey{}) != nil {
+		return nil
+	}
+	wait := m.Config.Get().Servers[serverName].Cooldown(string(action))
+	if wait <= 0 {
+		return nil
+	}
+
+	m.cooldowns.mu.Lock()
+	defer m.cooldowns.mu.Unlock()
+	if m.cooldowns.last == nil {
+		m.cooldowns.last = make(map[string]time.Time)
+	}
+	key := serverName + "/" + string(action)
+	now := time.Now()
+	if last, ok := m.cooldowns.last[key]; ok {
+		if remaining := wait - now.Sub(last); remaining > 0 {
+			logger.For(ctx).Warnf("Client", "Container", "待機時間内の操作を拒否しました: container=%s, action=%s, retryAfter=%s", serverName, action, remaining.Round(time.Second))
+			return &CooldownError{Server: serverName, Action: action, RetryAfter: remaining}
+		}
+	}
+	m.cooldowns.last[key] = now
+	return nil
+}
@@ -0,0 +1,111 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// maxHookOutput はエラーとして返すコマンドの出力の上限 (末尾のバイト数)。
+const maxHookOutput = 1024
+
+// hookWaitDelay はタイムアウトでシェルを終了させた後、出力の読み取りの完了を待つ時間。
+const hookWaitDelay = 2 * time.Second
+
+// MARK: runPreHook()
+// サーバーの hooks に操作の pre が設定されていれば、ジョブの開始直後に実行する。
+// 失敗 (終了コード 0 以外・タイムアウト) した場合はエラーを返し、呼び出し元は操作を中止する。
+func (m *Manager) runPreHook(ctx context.Context, job *Job) error {
+	serverCfg := m.Config.Get().Servers[job.Server]
+	hook, ok := serverCfg.Hooks[string(job.Action)]
+	if !ok || hook.Pre == "" {
+		return nil
+	}
+	job.Logf("pre フックを実行しています")
+	// ジョブは実行中に他のゴルーチンから更新されるため、フックへ渡す項目のみを複製する。
+	j := Job{ID: job.ID, Server: job.Server, Action: job.Action, Status: JobRunning, User: job.User, Via: job.Via}
+	if err := runHook(ctx, serverCfg, hook, hook.Pre, j); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "pre フックが失敗したため操作を中止しました(%s, %s): %v", job.Server, job.Action, err)
+		// 操作を実行していないため、完了時の post フックを実行しない。
+		job.tracker.mu.Lock()
+		job.aborted = true
+		job.tracker.mu.Unlock()
+		return fmt.Errorf("pre hook failed: %w", err)
+	}
+	return nil
+}
+
+// runPostHook はジョブの完了時に、サーバーの hooks に操作の post が設定されていれば実行する。
+// 操作の結果の通知を遅らせないよう非同期に実行し、失敗はログへの記録のみとする。
+// pre フックの失敗により操作を中止した場合は、後処理の対象となる操作が無いため実行しない。
+func (m *Manager) runPostHook(j Job) {
+	if j.Status == JobRunning || j.aborted {
+		return
+	}
+	serverCfg := m.Config.Get().Servers[j.Server]
+	hook, ok := serverCfg.Hooks[string(j.Action)]
+	if !ok || hook.Post == "" {
+		return
+	}
+	go func() {
+		ctx := logger.WithRequestID(context.Background(), j.RequestID)
+		if err := runHook(ctx, serverCfg, hook, hook.Post, j); err != nil {
+			logger.For(ctx).Errorf("Internal", "Container", "post フックが失敗しました(%s, %s): %v", j.Server, j.Action, err)
+		}
+	}()
+}
+
+// runHook はコマンドをホスト上のシェルで実行する。ローカルホストのサーバーでは workingDir を作業ディレクトリとする。
+// 環境変数には play-bin の環境に加えて、サーバー名・操作・操作者と、完了したジョブの場合は結果を渡す。
+func runHook(ctx context.Context, serverCfg config.ServerConfig, hook config.HookConfig, command string, j Job) error {
+	ctx, cancel := context.WithTimeout(ctx, hook.TimeoutDuration())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	if docker.IsLocal(j.Server) {
+		cmd.Dir = serverCfg.WorkingDir
+	}
+	cmd.Env = append(os.Environ(),
+		"PLAYBIN_SERVER="+j.Server,
+		"PLAYBIN_ACTION="+string(j.Action),
+		"PLAYBIN_USER="+j.User,
+		"PLAYBIN_VIA="+j.Via,
+		"PLAYBIN_JOB="+j.ID,
+	)
+	if j.Status != JobRunning {
+		cmd.Env = append(cmd.Env, "PLAYBIN_RESULT="+string(j.Status), "PLAYBIN_ERROR="+j.Error)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// タイムアウト時はシェルから起動された子プロセスもまとめて終了させ、出力を保持し続けるプロセスを待ち続けないようにする。
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = hookWaitDelay
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", hook.TimeoutDuration())
+	}
+	if err != nil {
+		output := out.Bytes()
+		if len(output) > maxHookOutput {
+			output = output[len(output)-maxHookOutput:]
+		}
+		if s := strings.TrimSpace(string(output)); s != "" {
+			return fmt.Errorf("%w: %s", err, s)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/client"
+
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: ensureImage()
+// コンテナ作成前にイメージの存在を確認し、未取得であればプルする。進捗はジョブログへ記録する。
+func (m *Manager) ensureImage(ctx context.Context, cli *client.Client, serverName, ref string) error {
+	if _, err := cli.ImageInspect(ctx, ref); err == nil {
+		return nil
+	} else if !errdefs.IsNotFound(err) {
+		logger.For(ctx).Errorf("Internal", "Container", "イメージ状態確認失敗(%s): %v", serverName, err)
+		return fmt.Errorf("failed to inspect image: %w", err)
+	}
+
+	job := JobFromContext(ctx)
+	logger.For(ctx).Logf("Internal", "Container", "イメージが存在しないためプルします(%s): %s", serverName, ref)
+	job.Logf("pulling image %s", ref)
+
+	progress, err := docker.PullImage(ctx, cli, ref)
+	if err != nil {
+		logger.For(ctx).Errorf("External", "Container", "イメージのプル失敗(%s): %v", serverName, err)
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	defer progress.Close()
+
+	if err := logJSONMessages(job, progress); err != nil {
+		logger.For(ctx).Errorf("External", "Container", "イメージのプル失敗(%s): %v", serverName, err)
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "イメージのプルが完了しました(%s): %s", serverName, ref)
+	return nil
+}
+
+// MARK: logJSONMessages()
+// Docker のプル・ビルドが返す JSON メッセージ列を読み切り、人が読める行のみをジョブログへ転記する。
+// 進捗バーの更新（progress 付きメッセージ）は行数が膨大になるため記録しない。
+func logJSONMessages(job *Job, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var msg struct {
+			ID       string `json:"id"`
+			Status   string `json:"status"`
+			Progress string `json:"progress"`
+			Stream   string `json:"stream"`
+			Error    string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case msg.Error != "":
+			job.Logf("error: %s", msg.Error)
+			return fmt.Errorf("%s", msg.Error)
+		case msg.Stream != "":
+			job.Logf("%s", strings.TrimRight(msg.Stream, "\r\n"))
+		case msg.Status != "" && msg.Progress == "":
+			if msg.ID != "" {
+				job.Logf("%s: %s", msg.ID, msg.Status)
+			} else {
+				job.Logf("%s", msg.Status)
+			}
+		}
+	}
+}
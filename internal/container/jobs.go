@@ -0,0 +1,433 @@
+package container
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/pubsub"
+)
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// maxJobHistory は完了済みジョブをメモリ上に保持する上限件数。
+const maxJobHistory = 100
+
+// maxJobLogLines は 1 ジョブあたりに保持する進捗ログの上限行数。
+const maxJobLogLines = 500
+
+// jobCancelGrace は終了時にキャンセルしたジョブが後始末を終えるまで待機する時間。
+const jobCancelGrace = 10 * time.Second
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobNotCancelable = errors.New("job is not running or cannot be canceled")
+)
+
+// MARK: Job
+// コンテナに対する 1 回の操作（起動、停止、バックアップ等）の進行状況を表す。
+type Job struct {
+	ID         string    `json:"id"`
+	Server     string    `json:"server"`
+	Action     Action    `json:"action"`
+	Status     JobStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	Log        []string  `json:"log,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"` // ジョブを開始した操作のリクエスト ID (ログとの突き合わせ用)
+	User       string    `json:"user,omitempty"`      // 操作したユーザー (WithActor で指定)
+	Via        string    `json:"via,omitempty"`       // 操作の経路 (ViaHTTP 等)
+	// Backup はバックアップのジョブの結果 (世代・所要時間・変更されたファイル数・サイズ)。
+	Backup *BackupStats `json:"backup,omitempty"`
+	// Restore はリストアのジョブの結果 (事前のスナップショット・復元したファイル数・バイト数)。
+	Restore *RestoreStats `json:"restore,omitempty"`
+	// Cancelable は実行中のジョブを JobTracker.Cancel で中断できることを表す。
+	Cancelable bool `json:"cancelable,omitempty"`
+
+	tracker *JobTracker
+	release func()             // WithJob で関連付けたコンテキストの解放
+	cancel  context.CancelFunc // WithJob で関連付けたコンテキストのキャンセル
+	aborted bool               // pre フックの失敗により、操作を実行せずに中止した
+}
+
+// MARK: JobTracker
+// 実行中および直近のジョブを保持し、状態の変化を購読者へ通知する。
+type JobTracker struct {
+	jobs  map[string]*Job
+	order []string
+	mu    sync.RWMutex
+	// updates はジョブ状態の変化の購読者への配信。受信が滞った購読者への通知は破棄される。
+	updates pubsub.Hub[Job]
+
+	// observe はジョブの開始・完了時に呼び出される。購読と異なり取りこぼしが無い。
+	observe func(Job)
+	// onFinish は OnFinish で登録された、ジョブの完了時に呼び出される関数。
+	onFinish []func(Job)
+
+	// ctx は play-bin の終了時に、実行中のジョブをキャンセルするために使用する。
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// MARK: NewJobTracker()
+func NewJobTracker() *JobTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobTracker{
+		jobs:   make(map[string]*Job),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// MARK: Begin()
+// 新しいジョブを実行中状態で登録し、購読者へ通知する。ctx にリクエスト ID があればジョブへ引き継ぐ。
+func (t *JobTracker) Begin(ctx context.Context, serverName string, action Action) *Job {
+	if t == nil {
+		return nil
+	}
+	idBytes := make([]byte, 8)
+	_, _ = rand.Read(idBytes)
+	user, via := actorFrom(ctx)
+
+	job := &Job{
+		ID:        hex.EncodeToString(idBytes),
+		Server:    serverName,
+		Action:    action,
+		Status:    JobRunning,
+		StartedAt: time.Now(),
+		RequestID: logger.RequestID(ctx),
+		User:      user,
+		Via:       via,
+		tracker:   t,
+	}
+
+	t.mu.Lock()
+	t.jobs[job.ID] = job
+	t.order = append(t.order, job.ID)
+	// 古い完了済みジョブから順に破棄し、メモリ使用量を一定に保つ。
+	for len(t.order) > maxJobHistory {
+		oldest := t.jobs[t.order[0]]
+		if oldest != nil && oldest.Status == JobRunning {
+			break
+		}
+		delete(t.jobs, t.order[0])
+		t.order = t.order[1:]
+	}
+	snapshot := job.snapshot()
+	t.mu.Unlock()
+
+	if t.observe != nil {
+		t.observe(snapshot)
+	}
+	t.updates.Publish(snapshot)
+	job.log().Debugf("Internal", "Job", "ジョブを開始しました: id=%s server=%s action=%s", job.ID, serverName, action)
+	return job
+}
+
+// log はジョブを開始したリクエストの ID を付与するロガーを返す。
+func (j *Job) log() logger.Scoped {
+	return logger.For(logger.WithRequestID(context.Background(), j.RequestID))
+}
+
+// MARK: Logf()
+// ジョブの進捗ログに 1 行追記し、購読者へ通知する。
+func (j *Job) Logf(format string, v ...any) {
+	if j == nil {
+		return
+	}
+	line := fmt.Sprintf(format, v...)
+	// 進捗はジョブの履歴に加えて debug レベルのログにも出力し、リクエスト ID から一連の処理を追跡できるようにする。
+	j.log().Debugf("Internal", "Job", "[%s] %s", j.ID, line)
+	t := j.tracker
+	t.mu.Lock()
+	j.Log = append(j.Log, line)
+	if len(j.Log) > maxJobLogLines {
+		j.Log = j.Log[len(j.Log)-maxJobLogLines:]
+	}
+	snapshot := j.snapshot()
+	t.mu.Unlock()
+
+	t.updates.Publish(snapshot)
+}
+
+// MARK: SetBackup()
+// バックアップの結果をジョブに記録する。Finish より前に呼び出し、完了の通知に含める。
+func (j *Job) SetBackup(stats BackupStats) {
+	if j == nil {
+		return
+	}
+	t := j.tracker
+	t.mu.Lock()
+	j.Backup = &stats
+	t.mu.Unlock()
+}
+
+// MARK: SetRestore()
+// リストアの結果をジョブに記録する。Finish より前に呼び出し、完了の通知に含める。
+func (j *Job) SetRestore(stats RestoreStats) {
+	if j == nil {
+		return
+	}
+	t := j.tracker
+	t.mu.Lock()
+	j.Restore = &stats
+	t.mu.Unlock()
+}
+
+// MARK: AllowCancel()
+// WithJob で関連付けたジョブを、JobTracker.Cancel で中断できるようにする。
+// 中断はコンテキストのキャンセルとして伝わるため、途中で止めても整合性を保てる処理でのみ呼び出すこと。
+func (j *Job) AllowCancel() {
+	if j == nil || j.cancel == nil {
+		return
+	}
+	t := j.tracker
+	t.mu.Lock()
+	j.Cancelable = true
+	snapshot := j.snapshot()
+	t.mu.Unlock()
+
+	t.updates.Publish(snapshot)
+}
+
+// MARK: Cancel()
+// 中断を許可された実行中のジョブのコンテキストをキャンセルする。ジョブは処理を中断した時点で失敗として完了する。
+func (t *JobTracker) Cancel(id, user string) error {
+	t.mu.Lock()
+	j, ok := t.jobs[id]
+	if !ok {
+		t.mu.Unlock()
+		return ErrJobNotFound
+	}
+	if j.Status != JobRunning || !j.Cancelable {
+		t.mu.Unlock()
+		return ErrJobNotCancelable
+	}
+	cancel := j.cancel
+	t.mu.Unlock()
+
+	j.Logf("cancel requested by %s", user)
+	cancel()
+	return nil
+}
+
+// MARK: Finish()
+// ジョブを完了状態に遷移させる。err が nil 以外の場合は失敗として記録する。
+func (j *Job) Finish(err error) {
+	if j == nil {
+		return
+	}
+	if j.release != nil {
+		j.release()
+	}
+	t := j.tracker
+	t.mu.Lock()
+	j.FinishedAt = time.Now()
+	j.Cancelable = false
+	if err != nil {
+		j.Status = JobFailed
+		j.Error = err.Error()
+	} else {
+		j.Status = JobSucceeded
+	}
+	snapshot := j.snapshot()
+	onFinish := t.onFinish
+	t.mu.Unlock()
+
+	if err != nil {
+		j.log().Errorf("Internal", "Job", "ジョブが失敗しました: id=%s server=%s action=%s: %v", j.ID, j.Server, j.Action, err)
+	} else {
+		j.log().Debugf("Internal", "Job", "ジョブが完了しました: id=%s server=%s action=%s", j.ID, j.Server, j.Action)
+	}
+	if t.observe != nil {
+		t.observe(snapshot)
+	}
+	for _, fn := range onFinish {
+		fn(snapshot)
+	}
+	t.updates.Publish(snapshot)
+}
+
+// MARK: OnFinish()
+// ジョブの完了時に呼び出される関数を登録する。Subscribe と異なり、受信が滞っても取りこぼさない。
+// fn は完了を通知する処理と同期的に呼び出されるため、時間のかかる処理は行わないこと。
+func (t *JobTracker) OnFinish(fn func(Job)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onFinish = append(t.onFinish, fn)
+}
+
+// snapshot は購読者へ渡すためのジョブの複製を生成する。呼び出し側でロックを保持していること。
+func (j *Job) snapshot() Job {
+	c := *j
+	c.Log = append([]string(nil), j.Log...)
+	c.tracker = nil
+	c.release = nil
+	c.cancel = nil
+	return c
+}
+
+// MARK: Get()
+// 指定 ID のジョブの複製を返す。
+func (t *JobTracker) Get(id string) (Job, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	j, ok := t.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.snapshot(), true
+}
+
+// MARK: List()
+// 保持している全ジョブを新しい順で返す。
+func (t *JobTracker) List() []Job {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	result := make([]Job, 0, len(t.order))
+	for i := len(t.order) - 1; i >= 0; i-- {
+		if j, ok := t.jobs[t.order[i]]; ok {
+			result = append(result, j.snapshot())
+		}
+	}
+	return result
+}
+
+// MARK: Subscribe()
+// ジョブ状態の変化を受信するチャネルと、購読を解除する関数を返す。
+func (t *JobTracker) Subscribe() (<-chan Job, func()) {
+	return t.updates.Subscribe()
+}
+
+type jobContextKey struct{}
+
+// MARK: WithJob()
+// 下位の処理から進捗ログを書き込めるよう、実行中のジョブをコンテキストへ関連付ける。
+// 返すコンテキストは play-bin の終了処理で待機の期限を過ぎた場合にキャンセルされ、ジョブの完了 (Finish) で解放される。
+func WithJob(ctx context.Context, job *Job) context.Context {
+	if job != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		stop := context.AfterFunc(job.tracker.ctx, cancel)
+		job.cancel = cancel
+		job.release = func() {
+			stop()
+			cancel()
+		}
+	}
+	return context.WithValue(ctx, jobContextKey{}, job)
+}
+
+// MARK: JobFromContext()
+// コンテキストに関連付けられたジョブを取り出す。存在しない場合は nil を返す（nil の Job への操作は無視される）。
+func JobFromContext(ctx context.Context) *Job {
+	job, _ := ctx.Value(jobContextKey{}).(*Job)
+	return job
+}
+
+// MARK: Shutdown()
+// 実行中のジョブの完了を ctx の期限まで待機する。期限を過ぎた場合は残りのジョブをキャンセルし、後始末の完了を一定時間待つ。
+func (t *JobTracker) Shutdown(ctx context.Context) {
+	if n := t.running(); n > 0 {
+		logger.For(ctx).Logf("Internal", "Container", "実行中のジョブの完了を待機しています: %d 件", n)
+	}
+	if t.waitIdle(ctx) {
+		return
+	}
+
+	logger.For(ctx).Logf("Internal", "Container", "待機時間を過ぎたため、実行中のジョブをキャンセルします: %d 件", t.running())
+	t.cancel()
+	graceCtx, cancel := context.WithTimeout(context.Background(), jobCancelGrace)
+	defer cancel()
+	if !t.waitIdle(graceCtx) {
+		logger.For(ctx).Logf("Internal", "Container", "キャンセル後も終了しないジョブがあります: %d 件", t.running())
+	}
+}
+
+// waitIdle は実行中のジョブが無くなるまで待機し、ctx の期限までに無くなった場合は true を返す。
+func (t *JobTracker) waitIdle(ctx context.Context) bool {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for t.running() > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+func (t *JobTracker) running() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	n := 0
+	for _, j := range t.jobs {
+		if j.Status == JobRunning {
+			n++
+		}
+	}
+	return n
+}
+
+// MARK: Save()
+// ジョブの履歴をファイルへ書き出す。終了時点で実行中のジョブは、中断されたものとして記録する。
+func (t *JobTracker) Save(path string) error {
+	t.mu.RLock()
+	list := make([]Job, 0, len(t.order))
+	for _, id := range t.order {
+		if j, ok := t.jobs[id]; ok {
+			c := j.snapshot()
+			if c.Status == JobRunning {
+				c.Status, c.Error, c.FinishedAt = JobFailed, "interrupted by shutdown", time.Now()
+			}
+			list = append(list, c)
+		}
+	}
+	t.mu.RUnlock()
+
+	return fsutil.WriteJSON(path, list, 0o600)
+}
+
+// MARK: Load()
+// 前回の終了時に保存したジョブの履歴を読み込む。ファイルが存在しない場合は何もしない。
+func (t *JobTracker) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var list []Job
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, j := range list {
+		if _, ok := t.jobs[j.ID]; ok || j.Status == JobRunning {
+			continue
+		}
+		j.tracker = t
+		t.jobs[j.ID] = &j
+		t.order = append(t.order, j.ID)
+	}
+	return nil
+}
@@ -0,0 +1,462 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// ActionMigrate はサーバーを別の Docker ホストへ移行するジョブ種別。
+const ActionMigrate Action = "migrate"
+
+// 移行でのデータの転送方式。
+const (
+	TransferRsync = "rsync" // rsync (リモートのホストへは ssh 経由) で直接転送する
+	TransferS3    = "s3"    // 移行元から migration.s3 へアップロードし、移行先でダウンロードする
+)
+
+// defaultStagingDir は migration.stagingDir を省略した場合の中継先。
+const defaultStagingDir = "./migrations"
+
+var ErrMigrationUnsupported = errors.New("migration is not supported for this server")
+
+// MARK: MigrateOptions
+// 移行の条件。
+type MigrateOptions struct {
+	Target   string // 移行先の dockerHosts 名。空文字は既定のホスト
+	Transfer string // TransferRsync (省略時) または TransferS3
+	DryRun   bool   // 事前確認と手順の記録のみを行い、停止・転送・設定の変更はしない
+}
+
+// MARK: MigrationPlan
+// 移行の手順と、その結果。
+type MigrationPlan struct {
+	Server     string          `json:"server"`
+	From       string          `json:"from"` // 移行元の dockerHosts 名 (空文字は既定のホスト)
+	To         string          `json:"to"`
+	Transfer   string          `json:"transfer"`
+	DryRun     bool            `json:"dryRun"`
+	Running    bool            `json:"running"` // 移行前に稼働中だったか。稼働中の場合は移行先で起動する
+	Backup     bool            `json:"backup"`  // 停止後に最終バックアップを取得するか (commands.backup の定義がある場合)
+	Paths      []MigrationPath `json:"paths"`
+	Skipped    []string        `json:"skipped,omitempty"`    // 転送できないマウント (名前付きボリューム等)
+	Steps      []string        `json:"steps"`                // 実行した (dryRun では実行する) 手順
+	RolledBack bool            `json:"rolledBack,omitempty"` // 失敗により移行元へ戻したか
+}
+
+// MigrationPath は転送するデータのディレクトリ。移行先でも同じパスへ配置する。
+type MigrationPath struct {
+	Path string `json:"path"`
+}
+
+// MARK: Migrate()
+// サーバーを別の Docker ホストへ移行する。移行元で停止し、最終バックアップの取得・データの転送の後、
+// 設定の host を書き換えて移行先で作成・起動する (移行前に停止中だった場合は起動しない)。
+// 転送以降の手順が失敗した場合は設定を戻し、移行先のコンテナを削除して移行元で再び起動する。移行元のデータは削除しない。
+func (m *Manager) Migrate(ctx context.Context, serverName string, opts MigrateOptions) (plan MigrationPlan, err error) {
+	if err := m.checkCooldown(ctx, serverName, ActionMigrate); err != nil {
+		return MigrationPlan{}, err
+	}
+	job := m.Jobs.Begin(ctx, serverName, ActionMigrate)
+	defer func() { job.Finish(err) }()
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return MigrationPlan{}, err
+	}
+
+	plan, src, dst, err := m.planMigration(ctx, serverName, opts)
+	if err != nil {
+		return plan, err
+	}
+	prefix := ""
+	if plan.DryRun {
+		prefix = "[dry-run] "
+	}
+	step := func(format string, args ...any) {
+		s := fmt.Sprintf(format, args...)
+		plan.Steps = append(plan.Steps, s)
+		job.Logf("%s%s", prefix, s)
+	}
+
+	if plan.DryRun {
+		for _, v := range plan.Skipped {
+			step("cannot transfer volume %s (migration will be refused)", v)
+		}
+		if plan.Running {
+			step("stop %s on %s", serverName, hostLabel(plan.From))
+		}
+		if plan.Backup {
+			step("take final backup")
+		}
+		for _, p := range plan.Paths {
+			step("transfer %s via %s", p.Path, plan.Transfer)
+		}
+		step("set servers.%s.host to %q", serverName, plan.To)
+		if plan.Running {
+			step("start %s on %s", serverName, hostLabel(plan.To))
+		}
+		step("remove container on %s", hostLabel(plan.From))
+		return plan, nil
+	}
+
+	// 名前付きボリュームのデータは移行先へ届かないため、データを失わないよう移行を拒否する。
+	if len(plan.Skipped) > 0 {
+		return plan, fmt.Errorf("%w: named volumes cannot be transferred: %s", ErrMigrationUnsupported, strings.Join(plan.Skipped, ", "))
+	}
+	logger.For(ctx).Logf("Internal", "Container", "移行を開始します(%s): %s -> %s", serverName, hostLabel(plan.From), hostLabel(plan.To))
+	hostChanged := false
+	// rollback は移行先のコンテナを削除して設定を戻し、移行前に稼働中だった場合は移行元のコンテナを再び起動する。
+	rollback := func(cause error) error {
+		job.Logf("rollback: %v", cause)
+		logger.For(ctx).Errorf("Internal", "Container", "移行に失敗したため移行元へ戻します(%s): %v", serverName, cause)
+		var errs []error
+		if hostChanged {
+			if cli, err := docker.ForHost(plan.To); err == nil {
+				if err := removeOwned(ctx, cli, serverName, true); err != nil {
+					errs = append(errs, fmt.Errorf("remove container on %s: %w", hostLabel(plan.To), err))
+				}
+			}
+			if err := m.setHost(serverName, plan.From); err != nil {
+				errs = append(errs, fmt.Errorf("restore host binding: %w", err))
+			}
+		}
+		if plan.Running {
+			if cli, err := docker.ForHost(plan.From); err != nil {
+				errs = append(errs, err)
+			} else if err := cli.ContainerStart(ctx, docker.ContainerName(serverName), ctypes.StartOptions{}); err != nil {
+				errs = append(errs, fmt.Errorf("restart on %s: %w", hostLabel(plan.From), err))
+			}
+		}
+		plan.RolledBack = len(errs) == 0
+		if !plan.RolledBack {
+			logger.For(ctx).Errorf("Internal", "Container", "移行のロールバックに失敗しました(%s): %v", serverName, errors.Join(errs...))
+			return fmt.Errorf("migration failed: %w (rollback failed: %v)", cause, errors.Join(errs...))
+		}
+		return fmt.Errorf("migration failed and was rolled back: %w", cause)
+	}
+
+	if plan.Running {
+		step("stop %s on %s", serverName, hostLabel(plan.From))
+		if err := m.Stop(ctx, serverName); err != nil {
+			return plan, fmt.Errorf("failed to stop server: %w", err)
+		}
+	}
+	if plan.Backup {
+		step("take final backup")
+		if err := m.Backup(ctx, serverName); err != nil {
+			return plan, rollback(err)
+		}
+	}
+	for i, p := range plan.Paths {
+		step("transfer %s via %s", p.Path, plan.Transfer)
+		if err := m.transfer(ctx, serverName, i, p.Path, src, dst, plan.Transfer); err != nil {
+			return plan, rollback(err)
+		}
+	}
+
+	step("set servers.%s.host to %q", serverName, plan.To)
+	if err := m.setHost(serverName, plan.To); err != nil {
+		return plan, rollback(err)
+	}
+	hostChanged = true
+
+	if plan.Running {
+		step("start %s on %s", serverName, hostLabel(plan.To))
+		if err := m.Start(ctx, serverName); err != nil {
+			return plan, rollback(err)
+		}
+	}
+
+	// 移行元のコンテナは、ロールバックできなくなる最後に削除する。データは手動で確認・削除できるよう残す。
+	step("remove container on %s", hostLabel(plan.From))
+	if cli, err := docker.ForHost(plan.From); err != nil {
+		logger.For(ctx).Warnf("Internal", "Container", "移行元のコンテナを削除できませんでした(%s): %v", serverName, err)
+	} else if err := removeOwned(ctx, cli, serverName, false); err != nil {
+		logger.For(ctx).Warnf("Internal", "Container", "移行元のコンテナを削除できませんでした(%s): %v", serverName, err)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "移行が完了しました(%s): %s -> %s", serverName, hostLabel(plan.From), hostLabel(plan.To))
+	return plan, nil
+}
+
+// planMigration は移行の条件を検証し、転送するデータと移行元・移行先のファイルの操作先を決定する。
+// 停止等の操作の前に、両方のホストへの接続と転送に使うコマンドの有無を確認する。
+func (m *Manager) planMigration(ctx context.Context, serverName string, opts MigrateOptions) (MigrationPlan, fileHost, fileHost, error) {
+	cfg := m.Config.Get()
+	serverCfg, ok := cfg.Servers[serverName]
+	plan := MigrationPlan{Server: serverName, From: serverCfg.Host, To: opts.Target, Transfer: opts.Transfer, DryRun: opts.DryRun, Paths: []MigrationPath{}, Steps: []string{}}
+	if plan.Transfer == "" {
+		plan.Transfer = TransferRsync
+	}
+	switch {
+	case !ok:
+		return plan, fileHost{}, fileHost{}, fmt.Errorf("server %s not found in config", serverName)
+	case serverCfg.Compose == nil || serverCfg.Process != nil:
+		return plan, fileHost{}, fileHost{}, fmt.Errorf("%w: only docker servers can be migrated", ErrMigrationUnsupported)
+	case plan.To == plan.From:
+		return plan, fileHost{}, fileHost{}, fmt.Errorf("%w: server is already on %s", ErrMigrationUnsupported, hostLabel(plan.To))
+	case plan.Transfer != TransferRsync && plan.Transfer != TransferS3:
+		return plan, fileHost{}, fileHost{}, fmt.Errorf("%w: unknown transfer %q", ErrMigrationUnsupported, plan.Transfer)
+	case plan.Transfer == TransferS3 && (cfg.Migration == nil || cfg.Migration.S3 == ""):
+		return plan, fileHost{}, fileHost{}, fmt.Errorf("%w: migration.s3 is not configured", ErrMigrationUnsupported)
+	}
+
+	src, err := resolveFileHost(cfg, plan.From)
+	if err != nil {
+		return plan, fileHost{}, fileHost{}, err
+	}
+	dst, err := resolveFileHost(cfg, plan.To)
+	if err != nil {
+		return plan, fileHost{}, fileHost{}, err
+	}
+
+	// 移行先のデーモンへ接続でき、同名のコンテナが無いことを確認する。
+	dstCli, err := docker.ForHost(plan.To)
+	if err != nil {
+		return plan, src, dst, err
+	}
+	if _, err := dstCli.Ping(ctx); err != nil {
+		return plan, src, dst, fmt.Errorf("docker host %s is not reachable: %w", hostLabel(plan.To), err)
+	}
+	if _, err := dstCli.ContainerInspect(ctx, docker.ContainerName(serverName)); err == nil {
+		return plan, src, dst, fmt.Errorf("container %s already exists on %s", docker.ContainerName(serverName), hostLabel(plan.To))
+	} else if !errdefs.IsNotFound(err) {
+		return plan, src, dst, err
+	}
+	if plan.Running, err = m.running(ctx, serverName); err != nil {
+		return plan, src, dst, err
+	}
+
+	for _, hostPath := range slices.Sorted(maps.Keys(serverCfg.Compose.Mount)) {
+		// 名前付きボリュームはデーモンが管理する領域のため、ファイルとして転送できない。
+		if !filepath.IsAbs(hostPath) {
+			plan.Skipped = append(plan.Skipped, hostPath)
+			JobFromContext(ctx).Logf("skip volume %s (not a bind mount)", hostPath)
+			continue
+		}
+		plan.Paths = append(plan.Paths, MigrationPath{Path: hostPath})
+	}
+	for _, cmd := range serverCfg.Commands.Backup {
+		if cmd.Type == "backup" {
+			plan.Backup = true
+		}
+	}
+
+	tool := "rsync"
+	if plan.Transfer == TransferS3 {
+		tool = "aws"
+	}
+	for _, h := range []fileHost{src, dst} {
+		if out, err := h.command(ctx, tool, "--version").CombinedOutput(); err != nil {
+			return plan, src, dst, fmt.Errorf("%s is not available on %s: %w: %s", tool, h, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return plan, src, dst, nil
+}
+
+// transfer は 1 つのディレクトリを移行元から移行先へ、削除を含めて同期する。
+func (m *Manager) transfer(ctx context.Context, serverName string, index int, path string, src, dst fileHost, method string) error {
+	if method == TransferS3 {
+		remote := strings.TrimSuffix(m.Config.Get().Migration.S3, "/") + "/" + serverName + "/" + strconv.Itoa(index)
+		if err := runLogged(ctx, src.command(ctx, "aws", "s3", "sync", "--delete", path, remote)); err != nil {
+			return fmt.Errorf("upload %s: %w", path, err)
+		}
+		if err := runLogged(ctx, dst.command(ctx, "mkdir", "-p", path)); err != nil {
+			return err
+		}
+		if err := runLogged(ctx, dst.command(ctx, "aws", "s3", "sync", "--delete", remote, path)); err != nil {
+			return fmt.Errorf("download %s: %w", path, err)
+		}
+		return nil
+	}
+
+	if src.local() && dst.local() {
+		// 同じマシン上のデーモン間の移行では、パスが同じためデータの移動は不要。
+		return nil
+	}
+	if err := runLogged(ctx, dst.command(ctx, "mkdir", "-p", path)); err != nil {
+		return err
+	}
+	if !src.local() && !dst.local() {
+		// rsync はリモート間の直接の転送に対応しないため、play-bin のホストを経由する。
+		staging := defaultStagingDir
+		if mc := m.Config.Get().Migration; mc != nil && mc.StagingDir != "" {
+			staging = mc.StagingDir
+		}
+		staging = filepath.Join(staging, serverName, strconv.Itoa(index))
+		if err := os.MkdirAll(staging, 0o755); err != nil {
+			return err
+		}
+		defer os.RemoveAll(staging)
+		if err := rsync(ctx, src, path, fileHost{}, staging); err != nil {
+			return err
+		}
+		return rsync(ctx, fileHost{}, staging, dst, path)
+	}
+	return rsync(ctx, src, path, dst, path)
+}
+
+// rsync は from のディレクトリの内容を to へ同期する。リモート側は ssh 経由で転送する (どちらか一方のみ)。
+func rsync(ctx context.Context, fromHost fileHost, from string, toHost fileHost, to string) error {
+	args := []string{"-aH", "--delete", "--numeric-ids"}
+	if remote := remoteOf(fromHost, toHost); !remote.local() {
+		args = append(args, "-e", strings.Join(remote.sshArgs(), " "))
+	}
+	args = append(args, fromHost.path(from)+"/", toHost.path(to)+"/")
+	return runLogged(ctx, exec.CommandContext(ctx, "rsync", args...))
+}
+
+// remoteOf は 2 つのうちリモートの方を返す。両方ともローカルの場合はローカルを返す。
+func remoteOf(a, b fileHost) fileHost {
+	if !a.local() {
+		return a
+	}
+	return b
+}
+
+// runLogged はコマンドを実行し、出力をジョブログへ転記する。
+func runLogged(ctx context.Context, cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	job := JobFromContext(ctx)
+	for line := range strings.Lines(string(out)) {
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			job.Logf("%s", line)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(cmd.Path), err)
+	}
+	return nil
+}
+
+// setHost はサーバー定義の host を書き換える。既定のホストへ戻す場合はキーを削除する。
+func (m *Manager) setHost(serverName, host string) error {
+	var value any
+	if host != "" {
+		value = host
+	}
+	patch, err := json.Marshal(map[string]any{"host": value})
+	if err != nil {
+		return err
+	}
+	_, err = m.Config.PatchServer(serverName, patch)
+	return err
+}
+
+// removeOwned は cli のホスト上のサーバーのコンテナを削除する。存在しない場合は何もせず、play-bin が作成したものではない場合は削除しない。
+func removeOwned(ctx context.Context, cli *client.Client, serverName string, force bool) error {
+	if _, err := docker.InspectOwned(ctx, cli, serverName); errdefs.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := cli.ContainerRemove(ctx, docker.ContainerName(serverName), ctypes.RemoveOptions{Force: force}); err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// hostLabel はログ用のホスト名を返す。
+func hostLabel(host string) string {
+	if host == "" {
+		return "default host"
+	}
+	return host
+}
+
+// MARK: fileHost
+// 移行でファイルを操作するホスト。ssh が空の場合は play-bin と同じマシンを表す。
+type fileHost struct {
+	ssh  string // user@host
+	port string
+}
+
+func (h fileHost) local() bool { return h.ssh == "" }
+
+func (h fileHost) String() string {
+	if h.local() {
+		return "local"
+	}
+	return h.ssh
+}
+
+// path は rsync に渡すパスを返す。
+func (h fileHost) path(p string) string {
+	if h.local() {
+		return p
+	}
+	return h.ssh + ":" + p
+}
+
+// sshArgs はこのホストへ接続する ssh のコマンドラインを返す。パスワードの入力を待たないよう BatchMode とする。
+func (h fileHost) sshArgs() []string {
+	args := []string{"ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=30"}
+	if h.port != "" {
+		args = append(args, "-p", h.port)
+	}
+	return args
+}
+
+// command はホスト上でコマンドを実行する。リモートの場合は ssh 経由で、引数をシェル向けに引用して渡す。
+func (h fileHost) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if h.local() {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	quoted := make([]string, 0, len(args)+1)
+	for _, a := range append([]string{name}, args...) {
+		quoted = append(quoted, "'"+strings.ReplaceAll(a, "'", `'\''`)+"'")
+	}
+	sshArgs := h.sshArgs()
+	return exec.CommandContext(ctx, sshArgs[0], append(sshArgs[1:], "--", h.ssh, strings.Join(quoted, " "))...)
+}
+
+// resolveFileHost は dockerHosts の設定から、そのホストのファイルを操作する方法を決定する。
+// ssh を指定した場合はそれを、host が ssh:// の場合は同じ接続先を、ローカルのソケットの場合は play-bin のマシンを用いる。
+func resolveFileHost(cfg config.Config, hostName string) (fileHost, error) {
+	if hostName == "" {
+		return fileHost{}, nil
+	}
+	h, ok := cfg.DockerHosts[hostName]
+	if !ok {
+		return fileHost{}, fmt.Errorf("docker host %q is not configured", hostName)
+	}
+	dest := h.SSH
+	if dest == "" {
+		switch {
+		case strings.HasPrefix(h.Host, "ssh://"):
+			dest = h.Host
+		case h.Host == "" || strings.HasPrefix(h.Host, "unix://") || strings.HasPrefix(h.Host, "npipe://"):
+			return fileHost{}, nil
+		default:
+			return fileHost{}, fmt.Errorf("%w: dockerHosts.%s.ssh is required to transfer files", ErrMigrationUnsupported, hostName)
+		}
+	}
+	if !strings.HasPrefix(dest, "ssh://") {
+		return fileHost{ssh: dest}, nil
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return fileHost{}, err
+	}
+	fh := fileHost{ssh: u.Hostname(), port: u.Port()}
+	if u.User != nil {
+		fh.ssh = u.User.Username() + "@" + fh.ssh
+	}
+	return fh, nil
+}
@@ -0,0 +1,81 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+)
+
+// MARK: startProcess()
+// ホスト上で直接実行するサーバーを起動する。設定ファイルの生成・ポートの解放・準備完了の判定はコンテナと同様に行う。
+func (m *Manager) startProcess(ctx context.Context, serverName string, serverCfg config.ServerConfig, pc config.ProcessConfig) error {
+	if err := m.renderConfigFiles(serverName, serverCfg); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "設定ファイル生成失敗(%s): %v", serverName, err)
+		return err
+	}
+	if m.BeforeCreate != nil {
+		m.BeforeCreate(serverName)
+	}
+
+	startedAt := time.Now()
+	if err := process.Start(ctx, serverName, pc); err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "プロセス起動失敗(%s): %v", serverName, err)
+		return err
+	}
+	logger.For(ctx).Logf("Internal", "Container", "プロセスの起動に成功しました: %s", serverName)
+
+	if serverCfg.Ready != nil {
+		m.Readiness.begin(serverName, startedAt, *serverCfg.Ready, &pc)
+		return m.waitReady(ctx, serverName)
+	}
+	return nil
+}
+
+// running はサーバーが稼働中かを返す。コンテナが存在しない場合は停止中とする。
+func (m *Manager) running(ctx context.Context, serverName string) (bool, error) {
+	if pc := m.Config.Get().Servers[serverName].ProcessSettings(); pc != nil {
+		status, err := process.Inspect(ctx, serverName, *pc)
+		return status.Running(), err
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return false, err
+	}
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	return err == nil && inspect.State.Running, nil
+}
+
+// hostExec は process のサーバーの停止手順の exec を、ホスト上のシェルで実行する。
+func hostExec(ctx context.Context, dir, command string) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
+
+// MARK: StopProcesses()
+// play-bin の子プロセスとして実行中のサーバー (process.command) を、停止手順に従って並行して停止する。
+// 子プロセスは play-bin の終了と共に失われるため、終了時にゲームのデータを保存してから停止させる。
+func (m *Manager) StopProcesses(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, name := range process.Running() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := WithActor(WithoutCooldown(ctx), "", ViaShutdown)
+			if err := m.ExecuteAction(ctx, name, ActionStop); err != nil {
+				logger.Errorf("Internal", "Container", "終了時のプロセスの停止に失敗(%s): %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
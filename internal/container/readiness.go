@@ -0,0 +1,374 @@
+package container
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+	"github.com/play-bin/internal/pubsub"
+)
+
+// ReadyState はコンテナ内のゲームサーバーの準備状態。
+type ReadyState string
+
+const (
+	ReadyNone     ReadyState = ""         // 判定条件 (ready) が未設定、またはコンテナが停止中
+	ReadyStarting ReadyState = "starting" // コンテナは起動したが、判定条件をまだ満たしていない
+	ReadyReady    ReadyState = "ready"    // 判定条件を満たし、接続を受け付けられる
+	ReadyTimeout  ReadyState = "timeout"  // ready.timeout 以内に判定条件を満たさなかった
+)
+
+// readyPortInterval はポートへの接続確認の間隔。
+const readyPortInterval = 2 * time.Second
+
+// MARK: ReadyStatus
+// サーバーの準備状態と、その状態になった時刻。
+type ReadyStatus struct {
+	Server string     `json:"server"`
+	State  ReadyState `json:"state"`
+	Since  time.Time  `json:"since,omitzero"`
+}
+
+// readyEntry は判定中・判定済みのサーバーごとの状態。
+type readyEntry struct {
+	status ReadyStatus
+	cancel context.CancelFunc
+	done   chan struct{} // starting を抜けた時点 (判定の完了・破棄) で閉じる
+}
+
+// MARK: ReadinessTracker
+// 起動したコンテナのログ・ポートを監視し、サーバーごとの準備状態を保持・配信する。
+type ReadinessTracker struct {
+	mu        sync.RWMutex
+	entries   map[string]*readyEntry
+	updates   pubsub.Hub[ReadyStatus] // 準備状態の変化の購読者への配信
+	startOnce sync.Once
+}
+
+// MARK: NewReadinessTracker()
+func NewReadinessTracker() *ReadinessTracker {
+	return &ReadinessTracker{entries: make(map[string]*readyEntry)}
+}
+
+// MARK: Status()
+// サーバーの現在の準備状態を返す。判定していないサーバーは ReadyNone となる。
+func (t *ReadinessTracker) Status(serverName string) ReadyStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if e, ok := t.entries[serverName]; ok {
+		return e.status
+	}
+	return ReadyStatus{Server: serverName}
+}
+
+// MARK: Wait()
+// サーバーが starting を抜けるまで待機し、その時点の状態を返す。
+// 判定中でなければ即座に現在の状態を返す。ctx の期限を過ぎた場合は、その時点の状態と ctx のエラーを返す。
+func (t *ReadinessTracker) Wait(ctx context.Context, serverName string) (ReadyStatus, error) {
+	t.mu.RLock()
+	e, ok := t.entries[serverName]
+	t.mu.RUnlock()
+	if !ok {
+		return ReadyStatus{Server: serverName}, nil
+	}
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return t.Status(serverName), ctx.Err()
+	}
+	return t.Status(serverName), nil
+}
+
+// MARK: Subscribe()
+// 準備状態の変化を受信するチャネルと、購読を解除する関数を返す。
+func (t *ReadinessTracker) Subscribe() (<-chan ReadyStatus, func()) {
+	return t.updates.Subscribe()
+}
+
+// begin はサーバーを starting とし、判定を開始する。判定中のものがあれば打ち切って置き換える。
+// pc はホスト上で直接実行するサーバーの場合に指定し、ログをコンテナではなくプロセスから読む。
+func (t *ReadinessTracker) begin(serverName string, since time.Time, cfg config.ReadyConfig, pc *config.ProcessConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.TimeoutDuration())
+	e := &readyEntry{
+		status: ReadyStatus{Server: serverName, State: ReadyStarting, Since: time.Now()},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	t.mu.Lock()
+	if old, ok := t.entries[serverName]; ok {
+		old.cancel()
+	}
+	t.entries[serverName] = e
+	t.updates.Publish(e.status)
+	t.mu.Unlock()
+
+	go t.probe(ctx, e, since, cfg, pc)
+}
+
+// starting はサーバーが判定中かを返す。
+func (t *ReadinessTracker) starting(serverName string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	e, ok := t.entries[serverName]
+	return ok && e.status.State == ReadyStarting
+}
+
+// clear はコンテナの停止に伴い、判定を打ち切って状態を破棄する。
+func (t *ReadinessTracker) clear(serverName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[serverName]
+	if !ok {
+		return
+	}
+	e.cancel()
+	if e.status.State == ReadyStarting {
+		close(e.done)
+	}
+	delete(t.entries, serverName)
+	t.updates.Publish(ReadyStatus{Server: serverName, State: ReadyNone, Since: time.Now()})
+}
+
+// finish は判定の結果を記録する。既に置き換え・破棄された判定の結果は無視する。
+func (t *ReadinessTracker) finish(e *readyEntry, state ReadyState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries[e.status.Server] != e {
+		return
+	}
+	e.status.State = state
+	e.status.Since = time.Now()
+	close(e.done)
+	t.updates.Publish(e.status)
+}
+
+// probe は設定された全ての判定条件を満たすまで待機する。
+func (t *ReadinessTracker) probe(ctx context.Context, e *readyEntry, since time.Time, cfg config.ReadyConfig, pc *config.ProcessConfig) {
+	defer e.cancel()
+	serverName := e.status.Server
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	passed := 0
+	check := func(fn func(context.Context, string) bool) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if fn(ctx, serverName) {
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}
+		}()
+	}
+	required := 0
+	if cfg.Log != "" {
+		re, err := regexp.Compile(cfg.Log)
+		if err != nil {
+			logger.Errorf("Internal", "Container", "%s: ready.log の正規表現が不正です: %v", serverName, err)
+			return
+		}
+		required++
+		check(func(ctx context.Context, name string) bool { return waitLogMatch(ctx, name, since, re, pc) })
+	}
+	if cfg.Port != "" {
+		required++
+		check(func(ctx context.Context, _ string) bool { return waitPortOpen(ctx, cfg.Port) })
+	}
+	wg.Wait()
+
+	switch {
+	case passed == required:
+		logger.Logf("Internal", "Container", "サーバーの準備が完了しました: %s", serverName)
+		t.finish(e, ReadyReady)
+	case ctx.Err() == context.DeadlineExceeded:
+		logger.Warnf("Internal", "Container", "%s 以内に準備完了を検知できませんでした: %s", cfg.TimeoutDuration(), serverName)
+		t.finish(e, ReadyTimeout)
+	}
+	// それ以外は clear または begin による打ち切りのため、状態は呼び出し側が更新済み。
+}
+
+// waitLogMatch は since 以降のコンテナ出力を追跡し、正規表現に一致する行が現れるまで待機する。
+func waitLogMatch(ctx context.Context, serverName string, since time.Time, re *regexp.Regexp, pc *config.ProcessConfig) bool {
+	if pc != nil {
+		logs, err := process.Logs(ctx, serverName, *pc, process.LogOptions{Follow: true, Tail: -1, Since: since})
+		if err != nil {
+			logger.Errorf("Internal", "Container", "%s: 準備完了判定のログ取得失敗: %v", serverName, err)
+			return false
+		}
+		defer logs.Close()
+		return scanMatch(logs, re)
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return false
+	}
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	if err != nil {
+		return false
+	}
+	logs, err := cli.ContainerLogs(ctx, inspect.ID, ctypes.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Since:      strconv.FormatInt(since.Unix(), 10),
+	})
+	if err != nil {
+		logger.Errorf("Internal", "Container", "%s: 準備完了判定のログ取得失敗: %v", serverName, err)
+		return false
+	}
+	defer logs.Close()
+
+	var reader io.Reader = logs
+	if !inspect.Config.Tty {
+		// TTY 無しのコンテナは stdout/stderr が多重化されているため、分離してから行単位で読む。
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, logs)
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		reader = pr
+	}
+	return scanMatch(reader, re)
+}
+
+// scanMatch は正規表現に一致する行が現れた場合に true を、一致しないままストリームが終了した場合に false を返す。
+func scanMatch(reader io.Reader, re *regexp.Regexp) bool {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if re.MatchString(strings.TrimRight(scanner.Text(), "\r")) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitPortOpen は TCP 接続を受け付けるようになるまで、一定間隔で接続を試みる。
+func waitPortOpen(ctx context.Context, addr string) bool {
+	var dialer net.Dialer
+	for {
+		dialCtx, cancel := context.WithTimeout(ctx, readyPortInterval)
+		conn, err := dialer.DialContext(dialCtx, "tcp", addr)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(readyPortInterval):
+		}
+	}
+}
+
+// MARK: StartReadiness()
+// コンテナイベントを購読し、ready が設定されたサーバーの起動時に準備完了の判定を開始する。
+// play-bin の起動時点で稼働中のコンテナは、コンテナの起動時刻以降のログから判定する。
+func (m *Manager) StartReadiness() {
+	m.Readiness.startOnce.Do(func() {
+		events, _ := docker.Events.Subscribe()
+		go func() {
+			for ev := range events {
+				m.handleReadyEvent(ev)
+			}
+		}()
+		go m.resumeReadiness()
+	})
+}
+
+// handleReadyEvent はコンテナの起動・停止イベントに応じて判定を開始・破棄する。
+func (m *Manager) handleReadyEvent(ev docker.ContainerEvent) {
+	if ev.Host != docker.HostOf(ev.Server) {
+		return
+	}
+	switch ev.Action {
+	case "start", "restart":
+		serverCfg, ok := m.Config.Get().Servers[ev.Server]
+		if !ok || serverCfg.Ready == nil {
+			return
+		}
+		// Start() で判定を開始済みの場合は、その判定を継続する。
+		if m.Readiness.starting(ev.Server) {
+			return
+		}
+		m.Readiness.begin(ev.Server, ev.Time, *serverCfg.Ready, serverCfg.ProcessSettings())
+	case "die", "destroy":
+		m.Readiness.clear(ev.Server)
+	}
+}
+
+// resumeReadiness は稼働中のコンテナについて、起動時刻以降のログから判定をやり直す。
+func (m *Manager) resumeReadiness() {
+	for serverName, serverCfg := range m.Config.Get().Servers {
+		if serverCfg.Ready == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if pc := serverCfg.ProcessSettings(); pc != nil {
+			status, err := process.Inspect(ctx, serverName, *pc)
+			cancel()
+			if err == nil && status.Running() {
+				m.Readiness.begin(serverName, status.StartedAt, *serverCfg.Ready, pc)
+			}
+			continue
+		}
+		inspect, err := docker.Inspects.Inspect(ctx, serverName)
+		cancel()
+		if err != nil || !inspect.State.Running {
+			continue
+		}
+		startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+		if err != nil {
+			startedAt = time.Now()
+		}
+		m.Readiness.begin(serverName, startedAt, *serverCfg.Ready, nil)
+	}
+}
+
+type waitReadyKey struct{}
+
+// MARK: WithWaitReady()
+// 起動操作の完了を、コンテナの起動ではなくサーバーの準備完了まで遅らせる。
+func WithWaitReady(ctx context.Context) context.Context {
+	return context.WithValue(ctx, waitReadyKey{}, true)
+}
+
+// waitReady は WithWaitReady が指定されていれば、起動したサーバーの準備完了を待機する。
+func (m *Manager) waitReady(ctx context.Context, serverName string) error {
+	if ctx.Value(waitReadyKey{}) == nil {
+		return nil
+	}
+	if job := JobFromContext(ctx); job != nil {
+		job.Logf("waiting for %s to become ready", serverName)
+	}
+	status, err := m.Readiness.Wait(ctx, serverName)
+	if err != nil {
+		return err
+	}
+	switch status.State {
+	case ReadyReady:
+		return nil
+	case ReadyTimeout:
+		return fmt.Errorf("%s did not become ready in time", serverName)
+	default:
+		return fmt.Errorf("%s stopped before becoming ready", serverName)
+	}
+}
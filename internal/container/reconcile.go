@@ -0,0 +1,173 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/containerd/errdefs"
+
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+)
+
+// 照合したサーバーの状態。
+const (
+	ReconcileRunning     = "running"     // コンテナ (プロセス) が稼働中
+	ReconcileStopped     = "stopped"     // 停止中のコンテナが存在する
+	ReconcileMissing     = "missing"     // 設定に存在するが、コンテナが存在しない (プロセスの場合は停止中)
+	ReconcileForeign     = "foreign"     // 同名の play-bin の管理外のコンテナが存在する
+	ReconcileUnreachable = "unreachable" // Docker ホストへ問い合わせできなかった
+)
+
+// MARK: ReconcileItem
+// 1 サーバーの設定と実際のコンテナの照合結果。
+type ReconcileItem struct {
+	Server      string   `json:"server"`
+	Host        string   `json:"host,omitempty"`
+	State       string   `json:"state"`
+	Drift       []string `json:"drift,omitempty"`       // コンテナの作成後に変更された設定 (イメージ・マウント)。再作成するまで反映されない
+	Autostart   bool     `json:"autostart,omitempty"`   // 設定の autostart
+	Autostarted bool     `json:"autostarted,omitempty"` // この照合で起動を開始した
+	Error       string   `json:"error,omitempty"`
+}
+
+// MARK: ReconcileReport
+// 全サーバーの照合結果。サーバー名の順に並べる。
+type ReconcileReport struct {
+	Time    time.Time       `json:"time"`
+	Servers []ReconcileItem `json:"servers"`
+}
+
+// reconcileState は最後の照合結果。
+type reconcileState struct {
+	mu   sync.Mutex
+	last *ReconcileReport
+}
+
+// MARK: LastReconcile()
+// 最後の照合結果を返す。まだ照合していない場合は nil を返す。
+func (m *Manager) LastReconcile() *ReconcileReport {
+	m.reconciled.mu.Lock()
+	defer m.reconciled.mu.Unlock()
+	return m.reconciled.last
+}
+
+// MARK: Reconcile()
+// 設定の全サーバーについて、実際のコンテナ (プロセス) の有無・状態と、作成後に変更された設定を照合する。
+// autostart が true の場合、autostart を設定したサーバーのうちコンテナが存在しないもの (プロセスの場合は停止中のもの) を起動する。
+// 停止中のコンテナが残っている場合は、定時起動と同じく手動の操作に委ねる。起動は完了を待たずに結果を返す。
+func (m *Manager) Reconcile(ctx context.Context, autostart bool) ReconcileReport {
+	cfg := m.Config.Get()
+	report := ReconcileReport{Time: time.Now(), Servers: []ReconcileItem{}}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		item := m.reconcileServer(ctx, name)
+		if autostart && item.Autostart && item.State == ReconcileMissing {
+			item.Autostarted = true
+			go func() {
+				if err := m.ExecuteAction(WithActor(WithoutCooldown(context.Background()), "", ViaReconcile), name, ActionStart); err != nil {
+					logger.Errorf("Internal", "Container", "自動起動に失敗(%s): %v", name, err)
+				}
+			}()
+		}
+		report.Servers = append(report.Servers, item)
+	}
+
+	m.reconciled.mu.Lock()
+	m.reconciled.last = &report
+	m.reconciled.mu.Unlock()
+
+	for _, item := range report.Servers {
+		switch {
+		case item.Autostarted:
+			logger.Logf("Internal", "Container", "自動起動を実行します: %s", item.Server)
+		case item.State == ReconcileForeign || item.State == ReconcileUnreachable:
+			logger.Warnf("Internal", "Container", "サーバーの状態を確認できません(%s): %s: %s", item.Server, item.State, item.Error)
+		case len(item.Drift) > 0:
+			logger.Warnf("Internal", "Container", "コンテナが作成時の設定のままです(%s): %v", item.Server, item.Drift)
+		}
+	}
+	return report
+}
+
+// reconcileServer は 1 サーバーを照合する。
+func (m *Manager) reconcileServer(ctx context.Context, serverName string) ReconcileItem {
+	serverCfg := m.Config.Get().Servers[serverName]
+	item := ReconcileItem{Server: serverName, Host: serverCfg.Host, Autostart: serverCfg.Autostart}
+
+	if pc := serverCfg.ProcessSettings(); pc != nil {
+		status, err := process.Inspect(ctx, serverName, *pc)
+		switch {
+		case err != nil:
+			item.State, item.Error = ReconcileUnreachable, err.Error()
+		case status.Running():
+			item.State = ReconcileRunning
+		default:
+			item.State = ReconcileMissing
+		}
+		return item
+	}
+
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		item.State, item.Error = ReconcileUnreachable, err.Error()
+		return item
+	}
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	switch {
+	case errors.Is(err, docker.ErrNotOwned):
+		item.State, item.Error = ReconcileForeign, err.Error()
+		return item
+	case errdefs.IsNotFound(err):
+		item.State = ReconcileMissing
+		return item
+	case err != nil:
+		item.State, item.Error = ReconcileUnreachable, err.Error()
+		return item
+	}
+	if inspect.Config != nil && inspect.Config.Labels[docker.OwnerLabel] == "" {
+		item.Drift = append(item.Drift, "label: "+docker.OwnerLabel+" is missing (created by an older version; recreate to add it)")
+	}
+	item.State = ReconcileStopped
+	if inspect.State != nil && inspect.State.Running {
+		item.State = ReconcileRunning
+	}
+
+	// イメージの参照の変更と、同じ参照のままビルド・プルにより更新されたイメージを区別する。
+	if imageRef := serverCfg.Compose.ImageRef(serverName); imageRef != "" && inspect.Config != nil {
+		if inspect.Config.Image != imageRef {
+			item.Drift = append(item.Drift, fmt.Sprintf("image: %s -> %s", inspect.Config.Image, imageRef))
+		} else if image, err := cli.ImageInspect(ctx, imageRef); err == nil && image.ID != inspect.Image {
+			item.Drift = append(item.Drift, "image: "+imageRef+" has been updated")
+		}
+	}
+
+	// マウントは Start と同じ "ホスト側:コンテナ側" の形式で比較する。
+	var expected []string
+	if serverCfg.Compose != nil {
+		for hostPath, containerPath := range serverCfg.Compose.Mount {
+			expected = append(expected, hostPath+":"+containerPath)
+		}
+	}
+	var actual []string
+	if inspect.HostConfig != nil {
+		actual = inspect.HostConfig.Binds
+	}
+	for _, bind := range expected {
+		if !slices.Contains(actual, bind) {
+			item.Drift = append(item.Drift, "mount added: "+bind)
+		}
+	}
+	for _, bind := range actual {
+		if !slices.Contains(expected, bind) {
+			item.Drift = append(item.Drift, "mount removed: "+bind)
+		}
+	}
+	slices.Sort(item.Drift)
+	return item
+}
@@ -0,0 +1,68 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// rsyncProgressInterval は rsync の進捗をジョブの進捗ログへ書き込む間隔。ログの行数の上限を使い切らないよう間引く。
+const rsyncProgressInterval = 5 * time.Second
+
+// rsyncProgressPattern は --info=progress2 の進捗行 (転送したバイト数・割合・速度・残り時間)。
+var rsyncProgressPattern = regexp.MustCompile(`^\s*([\d,]+)\s+(\d+)%\s+(\S+)\s+(\d+:\d{2}:\d{2})`)
+
+// MARK: runRsync()
+// rsync を実行し、--info=progress2 の進捗を rsyncProgressInterval ごとにコンテキストのジョブの進捗ログへ書き込む。
+// 進捗行を除いた標準出力と標準エラー出力を返す。コンテキストのキャンセルで rsync を停止する。
+func runRsync(ctx context.Context, args ...string) (string, error) {
+	job := JobFromContext(ctx)
+	cmd := exec.CommandContext(ctx, "rsync", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	var lastLogged time.Time
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanLinesOrCR)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := rsyncProgressPattern.FindStringSubmatch(line); m != nil {
+			if time.Since(lastLogged) >= rsyncProgressInterval {
+				lastLogged = time.Now()
+				job.Logf("progress: %s%% (%s bytes, %s, eta %s)", m[2], strings.ReplaceAll(m[1], ",", ""), m[3], m[4])
+			}
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			out.WriteString(line + "\n")
+		}
+	}
+	// 読み込みを中断した場合も rsync が書き込みで停止しないよう、残りの出力を読み捨てる。
+	_, _ = io.Copy(io.Discard, stdout)
+	err = cmd.Wait()
+	return out.String() + stderr.String(), err
+}
+
+// scanLinesOrCR は改行に加えて、進捗の表示の書き換えに使われる "\r" でも区切る bufio.SplitFunc。
+func scanLinesOrCR(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,318 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/errdefs"
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// ActionSnapshot はコンテナのファイルシステムをイメージとして保存するジョブ種別。
+const ActionSnapshot Action = "snapshot"
+
+const (
+	// snapshotRepository はスナップショットのイメージのリポジトリ名の接頭辞。<snapshotRepository>/<サーバー名>:<タグ> とする。
+	snapshotRepository = "play-bin-snapshot"
+	// snapshotLabel はスナップショットのイメージに付けるラベル。値は元のサーバー名で、一覧の絞り込みに使用する。
+	snapshotLabel = "play-bin.snapshot"
+	// snapshotTagFormat はスナップショットのタグ (作成日時) の形式。
+	snapshotTagFormat = "20060102-150405"
+	// defaultSnapshotDir は snapshotDir を省略した場合の、docker save の書き出し先。
+	defaultSnapshotDir = "./snapshots"
+)
+
+var (
+	ErrSnapshotUnsupported = errors.New("snapshot is not supported for process servers")
+	ErrInvalidSnapshotTag  = errors.New("invalid snapshot tag")
+	ErrSnapshotExists      = errors.New("snapshot already exists")
+)
+
+// snapshotTagPattern は作成日時から生成したタグに一致する。API から渡されたタグをパスやイメージ名に使う前に検証する。
+var snapshotTagPattern = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}$`)
+
+// invalidRepositoryChars はイメージのリポジトリ名に使用できない文字。
+var invalidRepositoryChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// Snapshot はスナップショット 1 件の情報を表す。
+type Snapshot struct {
+	Tag        string    `json:"tag"`
+	Image      string    `json:"image"` // docker load 後に image へ指定できる参照
+	ID         string    `json:"id"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	Export     string    `json:"export,omitempty"`     // docker save で書き出した tar のパス
+	ExportSize int64     `json:"exportSize,omitempty"` // 書き出した tar のサイズ
+}
+
+// snapshotImage はサーバーのスナップショットのイメージの参照を返す。
+// サーバー名はリポジトリ名に使えない文字を含み得るため、小文字化した上で置き換える。
+func snapshotImage(serverName, tag string) string {
+	name := strings.Trim(invalidRepositoryChars.ReplaceAllString(strings.ToLower(serverName), "-"), "-._")
+	if name == "" {
+		name = "server"
+	}
+	return snapshotRepository + "/" + name + ":" + tag
+}
+
+// snapshotDir はサーバーのスナップショットの書き出し先のディレクトリを返す。
+func (m *Manager) snapshotDir(serverName string) string {
+	dir := m.Config.Get().SnapshotDir
+	if dir == "" {
+		dir = defaultSnapshotDir
+	}
+	return filepath.Join(dir, serverName)
+}
+
+// snapshotExport は docker save の書き出し先を返す。
+func (m *Manager) snapshotExport(serverName, tag string) string {
+	return filepath.Join(m.snapshotDir(serverName), tag+".tar")
+}
+
+// MARK: Snapshot()
+// コンテナの現在のファイルシステムを、作成日時をタグとしたイメージとして保存する (docker commit)。
+// export を指定した場合は、別のホストへの移行のためにイメージを tar へ書き出す (docker save)。
+// 稼働中のコンテナは保存の間だけ一時停止されるため、整合性のため事前に保存コマンドを送ることを推奨する。
+func (m *Manager) Snapshot(ctx context.Context, serverName string, export bool) (snap Snapshot, err error) {
+	if m.Config.Get().Servers[serverName].ProcessSettings() != nil {
+		return Snapshot{}, ErrSnapshotUnsupported
+	}
+	if err := m.checkCooldown(ctx, serverName, ActionSnapshot); err != nil {
+		return Snapshot{}, err
+	}
+	job := m.Jobs.Begin(ctx, serverName, ActionSnapshot)
+	defer func() { job.Finish(err) }()
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return Snapshot{}, err
+	}
+
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	tag := time.Now().Format(snapshotTagFormat)
+	ref := snapshotImage(serverName, tag)
+	if _, err := cli.ImageInspect(ctx, ref); err == nil {
+		return Snapshot{}, ErrSnapshotExists
+	}
+
+	job.Logf("commit container as %s", ref)
+	containerName, err := ownedContainer(ctx, cli, serverName)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	resp, err := cli.ContainerCommit(ctx, containerName, ctypes.CommitOptions{
+		Reference: ref,
+		Comment:   "play-bin snapshot of " + serverName,
+		Changes:   []string{fmt.Sprintf("LABEL %s=%q", snapshotLabel, serverName)},
+		Pause:     true,
+	})
+	if err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "スナップショットの作成に失敗(%s): %v", serverName, err)
+		return Snapshot{}, fmt.Errorf("failed to commit container: %w", err)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "スナップショットを作成しました(%s): %s", serverName, ref)
+
+	snap = Snapshot{Tag: tag, Image: ref, ID: resp.ID, Created: time.Now()}
+	if inspect, err := cli.ImageInspect(ctx, ref); err == nil {
+		snap.Size = inspect.Size
+	}
+	if export {
+		path, size, err := m.exportSnapshot(ctx, serverName, tag)
+		if err != nil {
+			return snap, err
+		}
+		snap.Export, snap.ExportSize = path, size
+	}
+	return snap, nil
+}
+
+// MARK: ExportSnapshot()
+// 作成済みのスナップショットを tar へ書き出す。書き出し済みの場合は上書きする。
+func (m *Manager) ExportSnapshot(ctx context.Context, serverName, tag string) (snap Snapshot, err error) {
+	if !snapshotTagPattern.MatchString(tag) {
+		return Snapshot{}, ErrInvalidSnapshotTag
+	}
+	job := m.Jobs.Begin(ctx, serverName, ActionSnapshot)
+	defer func() { job.Finish(err) }()
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return Snapshot{}, err
+	}
+
+	path, size, err := m.exportSnapshot(ctx, serverName, tag)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Tag: tag, Image: snapshotImage(serverName, tag), Export: path, ExportSize: size}, nil
+}
+
+// exportSnapshot は docker save の出力を一時ファイルへ書き込み、完了後に書き出し先へ移動する。
+// 書き出し途中のファイルが移行に使われないよう、失敗した場合は一時ファイルを削除する。
+func (m *Manager) exportSnapshot(ctx context.Context, serverName, tag string) (string, int64, error) {
+	ref := snapshotImage(serverName, tag)
+	path := m.snapshotExport(serverName, tag)
+	JobFromContext(ctx).Logf("save %s to %s", ref, path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+tag+"-*.tar")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := m.SaveSnapshot(ctx, serverName, tag, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		logger.For(ctx).Errorf("Internal", "Container", "スナップショットの書き出しに失敗(%s): %v", serverName, err)
+		return "", 0, fmt.Errorf("failed to save image: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	logger.For(ctx).Logf("Internal", "Container", "スナップショットを書き出しました(%s): %s", serverName, path)
+	return path, size, nil
+}
+
+// MARK: SaveSnapshot()
+// スナップショットのイメージを docker save の形式 (tar) で w へ書き込み、書き込んだバイト数を返す。
+func (m *Manager) SaveSnapshot(ctx context.Context, serverName, tag string, w io.Writer) (int64, error) {
+	if !snapshotTagPattern.MatchString(tag) {
+		return 0, ErrInvalidSnapshotTag
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return 0, err
+	}
+	ref := snapshotImage(serverName, tag)
+	if _, err := cli.ImageInspect(ctx, ref); errdefs.IsNotFound(err) {
+		return 0, fmt.Errorf("snapshot %s: %w", tag, os.ErrNotExist)
+	} else if err != nil {
+		return 0, err
+	}
+	r, err := cli.ImageSave(ctx, []string{ref})
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.Copy(w, r)
+}
+
+// MARK: SnapshotFile()
+// 書き出し済みのスナップショットの tar のパスを返す。書き出していない場合は os.ErrNotExist を返す。
+func (m *Manager) SnapshotFile(serverName, tag string) (string, error) {
+	if !snapshotTagPattern.MatchString(tag) {
+		return "", ErrInvalidSnapshotTag
+	}
+	path := m.snapshotExport(serverName, tag)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// MARK: ListSnapshots()
+// サーバーのスナップショットを、書き出し済みの tar の有無と共に新しい順で返す。
+// イメージを削除した後も書き出し済みの tar は移行に使えるため、tar のみが残るものも含める。
+func (m *Manager) ListSnapshots(ctx context.Context, serverName string) ([]Snapshot, error) {
+	if m.Config.Get().Servers[serverName].ProcessSettings() != nil {
+		return nil, ErrSnapshotUnsupported
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return nil, err
+	}
+	images, err := cli.ImageList(ctx, image.ListOptions{Filters: filters.NewArgs(filters.Arg("label", snapshotLabel+"="+serverName))})
+	if err != nil {
+		return nil, err
+	}
+
+	byTag := make(map[string]*Snapshot)
+	prefix := snapshotImage(serverName, "")
+	for _, img := range images {
+		for _, ref := range img.RepoTags {
+			tag, ok := strings.CutPrefix(ref, prefix)
+			if !ok || !snapshotTagPattern.MatchString(tag) {
+				continue
+			}
+			byTag[tag] = &Snapshot{Tag: tag, Image: ref, ID: img.ID, Size: img.Size, Created: time.Unix(img.Created, 0)}
+		}
+	}
+
+	entries, err := os.ReadDir(m.snapshotDir(serverName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		tag, ok := strings.CutSuffix(e.Name(), ".tar")
+		if !ok || !snapshotTagPattern.MatchString(tag) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snap, ok := byTag[tag]
+		if !ok {
+			snap = &Snapshot{Tag: tag, Image: snapshotImage(serverName, tag), Created: info.ModTime()}
+			byTag[tag] = snap
+		}
+		snap.Export, snap.ExportSize = m.snapshotExport(serverName, tag), info.Size()
+	}
+
+	snapshots := make([]Snapshot, 0, len(byTag))
+	for _, snap := range byTag {
+		snapshots = append(snapshots, *snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Tag > snapshots[j].Tag })
+	return snapshots, nil
+}
+
+// MARK: DeleteSnapshot()
+// スナップショットのイメージと、書き出し済みの tar を削除する。どちらも存在しない場合は os.ErrNotExist を返す。
+func (m *Manager) DeleteSnapshot(ctx context.Context, serverName, tag string) error {
+	if !snapshotTagPattern.MatchString(tag) {
+		return ErrInvalidSnapshotTag
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	ref := snapshotImage(serverName, tag)
+	if _, err := cli.ImageRemove(ctx, ref, image.RemoveOptions{PruneChildren: true}); err == nil {
+		found = true
+	} else if !errdefs.IsNotFound(err) {
+		logger.For(ctx).Errorf("Internal", "Container", "スナップショットの削除に失敗(%s): %v", serverName, err)
+		return fmt.Errorf("failed to remove image: %w", err)
+	}
+	if err := os.Remove(m.snapshotExport(serverName, tag)); err == nil {
+		found = true
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("snapshot %s: %w", tag, os.ErrNotExist)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "スナップショットを削除しました(%s): %s", serverName, tag)
+	return nil
+}
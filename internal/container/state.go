@@ -0,0 +1,254 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+// 操作の実行経路。LastAction.Via と Job.Via に記録する。
+const (
+	ViaHTTP         = "http"         // Web UI・HTTP API (CLI を含む)
+	ViaGRPC         = "grpc"         // gRPC 管理 API
+	ViaDiscord      = "discord"      // Discord の /action
+	ViaSchedule     = "schedule"     // autoShutdown.startAt による定時起動
+	ViaAutoShutdown = "autoshutdown" // プレイヤー不在による自動停止
+	ViaWake         = "wake"         // 停止中のゲームポートへの接続による起動
+	ViaShutdown     = "shutdown"     // play-bin の終了に伴う、子プロセスとして実行中のサーバーの停止
+	ViaReconcile    = "reconcile"    // play-bin の起動時の照合による、autostart のサーバーの起動
+)
+
+// StopReason はコンテナが停止した理由。
+type StopReason string
+
+const (
+	StopRequested StopReason = "requested" // play-bin の操作 (stop, kill 等) による停止
+	StopExited    StopReason = "exited"    // 操作によらず、終了コード 0 で終了した (ゲーム内の /stop 等)
+	StopCrashed   StopReason = "crashed"   // 操作によらず、終了コード 0 以外で終了した
+	StopOOM       StopReason = "oom"       // メモリ不足により強制終了された
+)
+
+// stopActions はコンテナの停止を伴う操作。
+var stopActions = []Action{ActionStop, ActionKill, ActionRemove, ActionRestore, ActionMigrate}
+
+// requestedStopGrace は停止操作の完了後、停止イベントを操作によるものとみなす猶予。
+// Docker のイベントは操作の応答より遅れて届く場合がある。
+const requestedStopGrace = 30 * time.Second
+
+// MARK: LastAction
+// サーバーに対して最後に実行された操作。
+type LastAction struct {
+	Action     Action    `json:"action"`
+	User       string    `json:"user,omitempty"` // 操作したユーザー (自動停止等の play-bin 自身の操作は空)
+	Via        string    `json:"via,omitempty"`  // http, grpc, discord, schedule, autoshutdown, wake, reconcile
+	Status     JobStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+// MARK: LastStop
+// コンテナが最後に停止した際の終了コードと理由。
+type LastStop struct {
+	Time     time.Time  `json:"time"`
+	ExitCode int        `json:"exitCode"`
+	Reason   StopReason `json:"reason"`
+	Action   Action     `json:"action,omitempty"` // reason が requested の場合、停止させた操作
+	User     string     `json:"user,omitempty"`
+	Via      string     `json:"via,omitempty"`
+}
+
+// MARK: ServerState
+// サーバーごとに永続化する、最後の操作と停止の記録。
+type ServerState struct {
+	LastAction *LastAction `json:"lastAction,omitempty"`
+	LastStop   *LastStop   `json:"lastStop,omitempty"`
+}
+
+// MARK: StateStore
+// サーバーごとの最後の操作と停止理由を保持し、変更の都度ファイルへ書き出す。
+// 意図した停止か異常終了かを、play-bin の再起動後も判別できるようにする。
+type StateStore struct {
+	mu        sync.RWMutex
+	path      string
+	states    map[string]*ServerState
+	oom       map[string]bool // OOM イベントを受信し、停止イベントを待っているサーバー
+	startOnce sync.Once
+	// saveMu は保存を直列化する。書き出す内容の取得から置き換えまでを保持し、古い内容が新しい内容を上書きしないようにする。
+	saveMu sync.Mutex
+}
+
+// MARK: NewStateStore()
+func NewStateStore() *StateStore {
+	return &StateStore{
+		states: make(map[string]*ServerState),
+		oom:    make(map[string]bool),
+	}
+}
+
+type actorKey struct{}
+
+// actor は操作を要求したユーザーと経路。
+type actor struct {
+	user string
+	via  string
+}
+
+// MARK: WithActor()
+// 操作を要求したユーザーと経路 (ViaHTTP 等) をコンテキストへ関連付け、ジョブと最後の操作の記録に残す。
+func WithActor(ctx context.Context, user, via string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{user: user, via: via})
+}
+
+// actorFrom はコンテキストに関連付けられたユーザーと経路を返す。
+func actorFrom(ctx context.Context) (user, via string) {
+	a, _ := ctx.Value(actorKey{}).(actor)
+	return a.user, a.via
+}
+
+// MARK: Get()
+// サーバーの記録の複製を返す。記録が無い場合は nil を返す。
+func (s *StateStore) Get(serverName string) *ServerState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.states[serverName]
+	if !ok {
+		return nil
+	}
+	c := ServerState{}
+	if st.LastAction != nil {
+		a := *st.LastAction
+		c.LastAction = &a
+	}
+	if st.LastStop != nil {
+		l := *st.LastStop
+		c.LastStop = &l
+	}
+	return &c
+}
+
+// recordJob はジョブの開始・完了を最後の操作として記録する。
+func (s *StateStore) recordJob(j Job) {
+	s.mu.Lock()
+	st := s.entry(j.Server)
+	st.LastAction = &LastAction{
+		Action:     j.Action,
+		User:       j.User,
+		Via:        j.Via,
+		Status:     j.Status,
+		Error:      j.Error,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+	}
+	s.mu.Unlock()
+	s.save()
+}
+
+// recordEvent はコンテナの停止イベントから、終了コードと停止理由を記録する。
+func (s *StateStore) recordEvent(ev docker.ContainerEvent) {
+	switch ev.Action {
+	case "oom":
+		s.mu.Lock()
+		s.oom[ev.Server] = true
+		s.mu.Unlock()
+		return
+	case "die":
+	default:
+		return
+	}
+
+	exitCode, _ := strconv.Atoi(ev.ExitCode)
+	stop := &LastStop{Time: ev.Time, ExitCode: exitCode}
+
+	s.mu.Lock()
+	st := s.entry(ev.Server)
+	oom := s.oom[ev.Server]
+	delete(s.oom, ev.Server)
+	switch last := st.LastAction; {
+	case oom:
+		stop.Reason = StopOOM
+	case last != nil && slices.Contains(stopActions, last.Action) && !last.StartedAt.After(ev.Time) &&
+		(last.FinishedAt.IsZero() || ev.Time.Sub(last.FinishedAt) < requestedStopGrace):
+		stop.Reason = StopRequested
+		stop.Action, stop.User, stop.Via = last.Action, last.User, last.Via
+	case exitCode == 0:
+		stop.Reason = StopExited
+	default:
+		stop.Reason = StopCrashed
+	}
+	st.LastStop = stop
+	s.mu.Unlock()
+
+	logger.Debugf("Internal", "Container", "コンテナの停止を記録しました: %s (exitCode=%d, reason=%s)", ev.Server, exitCode, stop.Reason)
+	s.save()
+}
+
+// entry はサーバーの記録を返す。無ければ作成する。呼び出し側で mu を保持すること。
+func (s *StateStore) entry(serverName string) *ServerState {
+	st, ok := s.states[serverName]
+	if !ok {
+		st = &ServerState{}
+		s.states[serverName] = st
+	}
+	return st
+}
+
+// save は Load で指定されたファイルへ記録を書き出す。
+// ジョブの完了とコンテナイベントから並行して呼び出されるため、saveMu で直列化する。
+func (s *StateStore) save() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.RLock()
+	path := s.path
+	b, err := json.MarshalIndent(s.states, "", "  ")
+	s.mu.RUnlock()
+	if path == "" {
+		return
+	}
+	if err == nil {
+		err = fsutil.WriteFile(path, b, 0o600)
+	}
+	if err != nil {
+		logger.Errorf("Internal", "Container", "サーバーの状態の保存に失敗: %v", err)
+	}
+}
+
+// MARK: Load()
+// 前回までの記録を読み込み、以降の変更の保存先とする。ファイルが存在しない場合は空の状態から始める。
+func (s *StateStore) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &s.states)
+}
+
+// MARK: StartStateTracking()
+// コンテナイベントを購読し、管理対象のサーバーの停止を記録する。
+func (m *Manager) StartStateTracking() {
+	m.States.startOnce.Do(func() {
+		events, _ := docker.Events.Subscribe()
+		go func() {
+			for ev := range events {
+				if _, ok := m.Config.Get().Servers[ev.Server]; !ok || ev.Host != docker.HostOf(ev.Server) {
+					continue
+				}
+				m.States.recordEvent(ev)
+			}
+		}()
+	})
+}
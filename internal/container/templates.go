@@ -0,0 +1,116 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+// templateVarPattern はテンプレート内の変数参照 (${name}) に一致する。"$${name}" は置換せず "${name}" として出力する。
+var templateVarPattern = regexp.MustCompile(`\$?\$\{([A-Za-z0-9_.\-]+)\}`)
+
+// MARK: renderConfigFiles()
+// configFiles に定義されたテンプレートを描画し、コンテナ作成前に出力先へ書き出す。
+// 内容に変更が無い場合は書き込まず、ゲームサーバー側の更新時刻を不必要に変えないようにする。
+func (m *Manager) renderConfigFiles(serverName string, serverCfg config.ServerConfig) error {
+	if len(serverCfg.ConfigFiles) == 0 {
+		return nil
+	}
+	// 出力先はバインドマウント元であり、リモートホストのファイルシステムには書き込めない。
+	if !docker.IsLocal(serverName) {
+		return fmt.Errorf("configFiles is not supported for servers on remote docker hosts")
+	}
+
+	vars := templateVars(serverName, serverCfg)
+	for _, file := range serverCfg.ConfigFiles {
+		templatePath := resolvePath(serverCfg.WorkingDir, file.Template)
+		targetPath := resolvePath(serverCfg.WorkingDir, file.Target)
+
+		src, err := os.ReadFile(templatePath)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", templatePath, err)
+		}
+		rendered, err := renderTemplate(src, vars)
+		if err != nil {
+			return fmt.Errorf("failed to render template %s: %w", templatePath, err)
+		}
+
+		if current, err := os.ReadFile(targetPath); err == nil && bytes.Equal(current, rendered) {
+			continue
+		}
+		if err := fsutil.WriteFile(targetPath, rendered, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", targetPath, err)
+		}
+		logger.Logf("Internal", "Container", "設定ファイルを生成しました(%s): %s", serverName, targetPath)
+	}
+	return nil
+}
+
+// templateVars はテンプレートから参照できる変数の一覧を構築する。
+func templateVars(serverName string, serverCfg config.ServerConfig) map[string]string {
+	vars := map[string]string{
+		"name":  serverName,
+		"image": serverCfg.Compose.ImageRef(serverName),
+	}
+	// ${port.<コンテナ側ポート>} で公開側のポート番号を参照できるようにする。プロトコルを区別する場合は ${port.<ポート>.udp} とする。
+	// TCP と UDP で同じポートを公開している場合、${port.<ポート>} は TCP の値とする。
+	for _, mapping := range serverCfg.Compose.Network.PortMappings() {
+		for i := range mapping.Count {
+			containerPort, hostPort := strconv.Itoa(mapping.ContainerPort+i), strconv.Itoa(mapping.HostPort+i)
+			vars["port."+containerPort+"."+mapping.Protocol] = hostPort
+			if _, ok := vars["port."+containerPort]; !ok || mapping.Protocol == "tcp" {
+				vars["port."+containerPort] = hostPort
+			}
+		}
+	}
+	if q := serverCfg.Query; q != nil {
+		vars["query.address"] = q.Address
+		if _, port, err := net.SplitHostPort(q.Address); err == nil {
+			vars["query.port"] = port
+		}
+	}
+	for k, v := range serverCfg.Vars {
+		vars["vars."+k] = v
+	}
+	return vars
+}
+
+// renderTemplate は ${name} 形式の変数を置換する。未定義の変数は設定の誤りとしてエラーにする。
+func renderTemplate(src []byte, vars map[string]string) ([]byte, error) {
+	var missing string
+	out := templateVarPattern.ReplaceAllFunc(src, func(match []byte) []byte {
+		if match[1] == '$' {
+			return match[1:]
+		}
+		name := string(match[2 : len(match)-1])
+		v, ok := vars[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return match
+		}
+		return []byte(v)
+	})
+	if missing != "" {
+		return nil, fmt.Errorf("undefined variable: ${%s}", missing)
+	}
+	return out, nil
+}
+
+// resolvePath は相対パスを workingDir 基準で解決する。
+func resolvePath(workingDir, path string) string {
+	if !filepath.IsAbs(path) && workingDir != "" {
+		return filepath.Join(workingDir, path)
+	}
+	return path
+}
@@ -0,0 +1,282 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// trafficInterval は起動中のコンテナの通信量を取得する間隔。停止の直前の通信量は最大でこの間隔分が計上されない。
+	trafficInterval = time.Minute
+	// trafficRetentionDays は日ごとの通信量を保持する日数。月ごとの集計で前年の同月と比較できるよう 1 年強とする。
+	trafficRetentionDays = 400
+	// trafficDateLayout は日ごとの集計のキーの書式 (ローカル時刻)。
+	trafficDateLayout = "2006-01-02"
+)
+
+// MARK: TrafficBytes
+// 受信 (RX) と送信 (TX) のバイト数。
+type TrafficBytes struct {
+	RX uint64 `json:"rx"`
+	TX uint64 `json:"tx"`
+}
+
+// add は b に other を加算する。
+func (b *TrafficBytes) add(other TrafficBytes) {
+	b.RX += other.RX
+	b.TX += other.TX
+}
+
+// MARK: TrafficInterval
+// 1 回の取得間隔の通信量。
+type TrafficInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	TrafficBytes
+}
+
+// trafficCounter は最後に取得したコンテナの累計カウンタ。コンテナの起動時刻が変わるとカウンタは 0 から数え直される。
+type trafficCounter struct {
+	StartedAt time.Time `json:"startedAt"`
+	Time      time.Time `json:"time"`
+	TrafficBytes
+}
+
+// serverTraffic はサーバーごとに永続化する通信量の記録。
+type serverTraffic struct {
+	Total   TrafficBytes             `json:"total"` // 記録を開始してからの合計
+	Days    map[string]*TrafficBytes `json:"days"`  // 日付 (YYYY-MM-DD) ごとの合計
+	Counter *trafficCounter          `json:"counter,omitempty"`
+	Last    *TrafficInterval         `json:"last,omitempty"`
+}
+
+// MARK: TrafficStore
+// 管理対象のコンテナのネットワークの通信量を、統計情報の累計カウンタの差分から日ごとに集計してファイルへ保存する。
+// 転送量に上限のあるホストで、サーバーごとの消費量を把握できるようにする。
+type TrafficStore struct {
+	mu        sync.RWMutex
+	path      string
+	servers   map[string]*serverTraffic
+	startOnce sync.Once
+	// saveMu は保存を直列化する。書き出す内容の取得から置き換えまでを保持し、古い内容が新しい内容を上書きしないようにする。
+	saveMu sync.Mutex
+}
+
+// MARK: NewTrafficStore()
+func NewTrafficStore() *TrafficStore {
+	return &TrafficStore{servers: make(map[string]*serverTraffic)}
+}
+
+// MARK: Load()
+// 前回までの記録を読み込み、以降の変更の保存先とする。ファイルが存在しない場合は空の状態から始める。
+func (t *TrafficStore) Load(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &t.servers)
+}
+
+// record はコンテナの累計カウンタを取り込み、前回の取得からの差分を日ごとの集計へ加算する。
+// 起動時刻が前回と異なる場合は再起動によりカウンタが 0 から数え直されたため、現在値をそのまま差分とする。
+// play-bin の再起動を挟んでも、同じコンテナの起動中であれば保存したカウンタとの差分のみを加算する。
+func (t *TrafficStore) record(serverName string, startedAt, now time.Time, cur TrafficBytes) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.servers[serverName]
+	if !ok {
+		st = &serverTraffic{Days: make(map[string]*TrafficBytes)}
+		t.servers[serverName] = st
+	}
+	if st.Days == nil {
+		st.Days = make(map[string]*TrafficBytes)
+	}
+
+	delta, start := cur, startedAt
+	if c := st.Counter; c != nil && c.StartedAt.Equal(startedAt) {
+		delta, start = TrafficBytes{}, c.Time
+		if cur.RX >= c.RX {
+			delta.RX = cur.RX - c.RX
+		}
+		if cur.TX >= c.TX {
+			delta.TX = cur.TX - c.TX
+		}
+	}
+	st.Counter = &trafficCounter{StartedAt: startedAt, Time: now, TrafficBytes: cur}
+	st.Last = &TrafficInterval{Start: start, End: now, TrafficBytes: delta}
+	st.Total.add(delta)
+
+	date := now.Format(trafficDateLayout)
+	day, ok := st.Days[date]
+	if !ok {
+		day = &TrafficBytes{}
+		st.Days[date] = day
+	}
+	day.add(delta)
+
+	cutoff := now.AddDate(0, 0, -trafficRetentionDays).Format(trafficDateLayout)
+	maps.DeleteFunc(st.Days, func(d string, _ *TrafficBytes) bool { return d < cutoff })
+}
+
+// save は Load で指定されたファイルへ記録を書き出す。
+// 並行して呼び出された場合でも古い内容で上書きしないよう、saveMu で直列化する。
+func (t *TrafficStore) save() {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+	t.mu.RLock()
+	path := t.path
+	b, err := json.MarshalIndent(t.servers, "", "  ")
+	t.mu.RUnlock()
+	if path == "" {
+		return
+	}
+	if err == nil {
+		err = fsutil.WriteFile(path, b, 0o600)
+	}
+	if err != nil {
+		logger.Errorf("Internal", "Container", "通信量の記録の保存に失敗: %v", err)
+	}
+}
+
+// MARK: TrafficSummary
+// サーバーの通信量の集計。
+type TrafficSummary struct {
+	Server string           `json:"server"`
+	Total  TrafficBytes     `json:"total"`          // 記録を開始してからの合計
+	Last   *TrafficInterval `json:"last,omitempty"` // 最後の取得間隔の通信量
+	// Current は起動中 (最後に取得した時点) のコンテナの、起動してからの累計。
+	Current *TrafficInterval `json:"current,omitempty"`
+	Months  []TrafficMonth   `json:"months"` // 記録のある月ごとの合計 (新しい順)
+	Month   string           `json:"month"`  // Days の対象の月 (YYYY-MM)
+	Days    []TrafficDay     `json:"days"`   // Month の日ごとの合計 (古い順)
+}
+
+// TrafficMonth は月ごとの通信量の合計。
+type TrafficMonth struct {
+	Month string `json:"month"` // YYYY-MM
+	Days  int    `json:"days"`  // 記録のある日数
+	TrafficBytes
+}
+
+// TrafficDay は日ごとの通信量の合計。
+type TrafficDay struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	TrafficBytes
+}
+
+// MARK: Summary()
+// サーバーの通信量を月ごとに集計し、month (YYYY-MM。空の場合は今月) の日ごとの内訳と共に返す。
+func (t *TrafficStore) Summary(serverName, month string) TrafficSummary {
+	if month == "" {
+		month = time.Now().Format("2006-01")
+	}
+	sum := TrafficSummary{Server: serverName, Month: month, Months: []TrafficMonth{}, Days: []TrafficDay{}}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	st, ok := t.servers[serverName]
+	if !ok {
+		return sum
+	}
+	sum.Total = st.Total
+	if st.Last != nil {
+		last := *st.Last
+		sum.Last = &last
+	}
+	if c := st.Counter; c != nil {
+		sum.Current = &TrafficInterval{Start: c.StartedAt, End: c.Time, TrafficBytes: c.TrafficBytes}
+	}
+
+	months := make(map[string]*TrafficMonth)
+	for _, date := range slices.Sorted(maps.Keys(st.Days)) {
+		b := *st.Days[date]
+		m, ok := months[date[:7]]
+		if !ok {
+			m = &TrafficMonth{Month: date[:7]}
+			months[date[:7]] = m
+		}
+		m.Days++
+		m.add(b)
+		if strings.HasPrefix(date, month+"-") {
+			sum.Days = append(sum.Days, TrafficDay{Date: date, TrafficBytes: b})
+		}
+	}
+	for _, key := range slices.Backward(slices.Sorted(maps.Keys(months))) {
+		sum.Months = append(sum.Months, *months[key])
+	}
+	return sum
+}
+
+// MARK: StartTrafficAccounting()
+// 起動中の管理対象のコンテナの通信量を trafficInterval ごとに取得し、日ごとの集計へ加算する。
+// process のサーバーは統計情報を取得できないため対象外とする。
+func (m *Manager) StartTrafficAccounting() {
+	m.Traffic.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(trafficInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				m.sampleTraffic()
+			}
+		}()
+	})
+}
+
+// sampleTraffic は全ての管理対象のコンテナの通信量を 1 回取得して記録する。
+func (m *Manager) sampleTraffic() {
+	recorded := false
+	for serverName, serverCfg := range m.Config.Get().Servers {
+		if serverCfg.ProcessSettings() != nil {
+			continue
+		}
+		startedAt, cur, ok := containerTraffic(serverName)
+		if !ok {
+			continue
+		}
+		m.Traffic.record(serverName, startedAt, time.Now(), cur)
+		recorded = true
+	}
+	if recorded {
+		m.Traffic.save()
+	}
+}
+
+// containerTraffic は起動中のコンテナの起動時刻と、全インターフェースの累計の送受信量を返す。停止中や取得できない場合は ok に false を返す。
+func containerTraffic(serverName string) (startedAt time.Time, cur TrafficBytes, ok bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), docker.CallTimeout)
+	defer cancel()
+	inspect, err := docker.Inspects.Inspect(ctx, serverName)
+	if err != nil || inspect.State == nil || !inspect.State.Running {
+		return time.Time{}, TrafficBytes{}, false
+	}
+	startedAt, err = time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	if err != nil {
+		return time.Time{}, TrafficBytes{}, false
+	}
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return time.Time{}, TrafficBytes{}, false
+	}
+	stats, err := docker.StatsSnapshot(ctx, cli, inspect.ID)
+	if err != nil {
+		logger.Debugf("External", "Container", "通信量の取得に失敗: container=%s, err=%v", serverName, err)
+		return time.Time{}, TrafficBytes{}, false
+	}
+	return startedAt, TrafficBytes{RX: stats.NetworkRx, TX: stats.NetworkTx}, true
+}
@@ -0,0 +1,544 @@
+package container
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// ActionWorld はワールド操作（保管・切り替え・リセット・取り込み）のジョブ種別。
+const ActionWorld Action = "world"
+
+var (
+	ErrWorldsNotConfigured = errors.New("worlds is not configured for this server")
+	ErrInvalidWorldName    = errors.New("invalid world name")
+	ErrWorldExists         = errors.New("world already exists")
+)
+
+// World はワールド 1 件の情報を表す。
+type World struct {
+	Name    string    `json:"name"`
+	Active  bool      `json:"active"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// worldPaths は設定から解決したワールドの配置先。
+type worldPaths struct {
+	active  string // アクティブなワールドのディレクトリ
+	storage string // 保管中のワールドの格納先
+	name    string // アクティブなワールドのディレクトリ名
+}
+
+// MARK: ListWorlds()
+// アクティブなワールドと保管中のワールドを、ディスク使用量と共に返す。
+func (m *Manager) ListWorlds(serverName string) ([]World, error) {
+	paths, err := m.worldPaths(serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	worlds := []World{}
+	if info, err := os.Stat(paths.active); err == nil && info.IsDir() {
+		size, modTime := dirUsage(paths.active)
+		worlds = append(worlds, World{Name: paths.name, Active: true, Size: size, ModTime: modTime})
+	}
+
+	entries, err := os.ReadDir(paths.storage)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stored := []World{}
+	for _, e := range entries {
+		if !e.IsDir() || !validWorldName(e.Name()) {
+			continue
+		}
+		size, modTime := dirUsage(filepath.Join(paths.storage, e.Name()))
+		stored = append(stored, World{Name: e.Name(), Size: size, ModTime: modTime})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Name < stored[j].Name })
+	return append(worlds, stored...), nil
+}
+
+// MARK: ArchiveWorld()
+// アクティブなワールドの複製を、指定した名前で保管する。稼働中でも実行できるが、整合性のため事前に保存コマンドを送ることを推奨する。
+func (m *Manager) ArchiveWorld(ctx context.Context, serverName, name string) (err error) {
+	if err := m.checkCooldown(ctx, serverName, ActionWorld); err != nil {
+		return err
+	}
+	job := m.Jobs.Begin(ctx, serverName, ActionWorld)
+	defer func() { job.Finish(err) }()
+	job.Logf("archive active world as %s", name)
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return err
+	}
+
+	paths, err := m.worldPaths(serverName)
+	if err != nil {
+		return err
+	}
+	if !validWorldName(name) {
+		return ErrInvalidWorldName
+	}
+	dest := filepath.Join(paths.storage, name)
+	if _, err := os.Stat(dest); err == nil {
+		return ErrWorldExists
+	}
+	if _, err := os.Stat(paths.active); err != nil {
+		return fmt.Errorf("active world not found: %w", err)
+	}
+	if err := os.MkdirAll(paths.storage, 0o755); err != nil {
+		return err
+	}
+
+	if out, err := exec.CommandContext(ctx, "rsync", "-a", paths.active+"/", dest).CombinedOutput(); err != nil {
+		os.RemoveAll(dest)
+		logger.For(ctx).Errorf("Internal", "Container", "%s: ワールドの保管に失敗: %v, output: %s", serverName, err, string(out))
+		return fmt.Errorf("failed to archive world: %w", err)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "ワールドを保管しました(%s): %s", serverName, name)
+	return nil
+}
+
+// MARK: SwitchWorld()
+// 保管中のワールドをアクティブにする。現在のアクティブなワールドは saveAs の名前で保管する（空の場合は日時から生成）。
+// 切り替え前にバックアップを取得し、誤操作時に復元できるようにする。
+func (m *Manager) SwitchWorld(ctx context.Context, serverName, name, saveAs string) (err error) {
+	if err := m.checkCooldown(ctx, serverName, ActionWorld); err != nil {
+		return err
+	}
+	job := m.Jobs.Begin(ctx, serverName, ActionWorld)
+	defer func() { job.Finish(err) }()
+	job.Logf("switch active world to %s", name)
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return err
+	}
+
+	paths, err := m.prepareWorldChange(ctx, serverName)
+	if err != nil {
+		return err
+	}
+	if !validWorldName(name) {
+		return ErrInvalidWorldName
+	}
+	src := filepath.Join(paths.storage, name)
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return fmt.Errorf("world %s not found", name)
+	}
+
+	if err := m.stashActiveWorld(paths, saveAs); err != nil {
+		return err
+	}
+	if err := os.Rename(src, paths.active); err != nil {
+		return fmt.Errorf("failed to activate world: %w", err)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "アクティブなワールドを切り替えました(%s): %s", serverName, name)
+	return nil
+}
+
+// MARK: ResetWorld()
+// アクティブなワールドを退避し、次回起動時にゲームサーバーが新しいワールドを生成するようにする。
+// 退避したワールドは保管領域に残るため、不要であれば DeleteWorld で削除する。
+func (m *Manager) ResetWorld(ctx context.Context, serverName, saveAs string) (err error) {
+	if err := m.checkCooldown(ctx, serverName, ActionWorld); err != nil {
+		return err
+	}
+	job := m.Jobs.Begin(ctx, serverName, ActionWorld)
+	defer func() { job.Finish(err) }()
+	job.Logf("reset active world")
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return err
+	}
+
+	paths, err := m.prepareWorldChange(ctx, serverName)
+	if err != nil {
+		return err
+	}
+	if err := m.stashActiveWorld(paths, saveAs); err != nil {
+		return err
+	}
+	logger.For(ctx).Logf("Internal", "Container", "アクティブなワールドをリセットしました(%s)", serverName)
+	return nil
+}
+
+// MARK: DeleteWorld()
+// 保管中のワールドを削除する。アクティブなワールドは削除できない（ResetWorld を使用する）。
+func (m *Manager) DeleteWorld(serverName, name string) error {
+	paths, err := m.worldPaths(serverName)
+	if err != nil {
+		return err
+	}
+	if !validWorldName(name) {
+		return ErrInvalidWorldName
+	}
+	target := filepath.Join(paths.storage, name)
+	if _, err := os.Stat(target); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	logger.Logf("Internal", "Container", "保管中のワールドを削除しました(%s): %s", serverName, name)
+	return nil
+}
+
+// MARK: ImportWorld()
+// zip または tar.gz 形式のアーカイブを展開し、指定した名前のワールドとして保管する。
+// アーカイブの全体が単一のディレクトリに含まれている場合は、そのディレクトリをワールドの最上位とみなす。
+func (m *Manager) ImportWorld(ctx context.Context, serverName, name string, r io.Reader) (err error) {
+	if err := m.checkCooldown(ctx, serverName, ActionWorld); err != nil {
+		return err
+	}
+	job := m.Jobs.Begin(ctx, serverName, ActionWorld)
+	defer func() { job.Finish(err) }()
+	job.Logf("import world as %s", name)
+	ctx = WithJob(ctx, job)
+	if err := m.runPreHook(ctx, job); err != nil {
+		return err
+	}
+
+	paths, err := m.worldPaths(serverName)
+	if err != nil {
+		return err
+	}
+	if !validWorldName(name) {
+		return ErrInvalidWorldName
+	}
+	dest := filepath.Join(paths.storage, name)
+	if _, err := os.Stat(dest); err == nil {
+		return ErrWorldExists
+	}
+	if err := os.MkdirAll(paths.storage, 0o755); err != nil {
+		return err
+	}
+
+	// 展開途中の状態が一覧に現れないよう、隠しディレクトリへ展開してから名前を付ける。
+	tmp, err := os.MkdirTemp(paths.storage, ".import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		err = extractZip(ctx, br, tmp)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		err = extractTarGz(ctx, br, tmp)
+	default:
+		err = errors.New("unsupported archive format (zip or tar.gz is required)")
+	}
+	if err != nil {
+		return err
+	}
+
+	root := tmp
+	if entries, err := os.ReadDir(tmp); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		root = filepath.Join(tmp, entries[0].Name())
+	}
+	if err := os.Rename(root, dest); err != nil {
+		return fmt.Errorf("failed to store imported world: %w", err)
+	}
+	logger.For(ctx).Logf("Internal", "Container", "ワールドを取り込みました(%s): %s", serverName, name)
+	return nil
+}
+
+// MARK: ExportWorld()
+// ワールドを tar.gz 形式で書き出す。アーカイブ内のパスはワールド名のディレクトリを最上位とする。
+func (m *Manager) ExportWorld(serverName, name string, w io.Writer) error {
+	paths, err := m.worldPaths(serverName)
+	if err != nil {
+		return err
+	}
+	if !validWorldName(name) {
+		return ErrInvalidWorldName
+	}
+	dir := filepath.Join(paths.storage, name)
+	if name == paths.name {
+		dir = paths.active
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return ErrInvalidWorldName
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// シンボリックリンク等はワールド外を指す可能性があるため含めない。
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(name, rel))
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// worldPaths は設定からワールドの配置先を解決する。
+func (m *Manager) worldPaths(serverName string) (worldPaths, error) {
+	serverCfg, ok := m.Config.Get().Servers[serverName]
+	if !ok || serverCfg.Worlds == nil || serverCfg.Worlds.Directory == "" {
+		return worldPaths{}, ErrWorldsNotConfigured
+	}
+	// ワールドはバインドマウント元に存在するため、リモートホスト上のサーバーは操作できない。
+	if !docker.IsLocal(serverName) {
+		return worldPaths{}, fmt.Errorf("worlds is not supported for servers on remote docker hosts")
+	}
+	cfg := serverCfg.Worlds
+	dir := resolvePath(serverCfg.WorkingDir, cfg.Directory)
+	name := cfg.Active
+	if name == "" {
+		name = "world"
+	}
+	storage := filepath.Join(dir, ".worlds")
+	if cfg.Storage != "" {
+		storage = resolvePath(serverCfg.WorkingDir, cfg.Storage)
+	}
+	return worldPaths{active: filepath.Join(dir, name), storage: storage, name: name}, nil
+}
+
+// prepareWorldChange はアクティブなワールドを変更する前提条件（停止済み）を確認し、安全のためバックアップを取得する。
+func (m *Manager) prepareWorldChange(ctx context.Context, serverName string) (worldPaths, error) {
+	paths, err := m.worldPaths(serverName)
+	if err != nil {
+		return worldPaths{}, err
+	}
+	// 稼働中のゲームサーバーはワールドを開いているため、入れ替えるとデータが破損する。
+	if m.isRunning(ctx, serverName) {
+		return worldPaths{}, fmt.Errorf("container is running. please stop it before changing the world")
+	}
+	if len(backupTargets(m.Config.Get().Servers[serverName])) > 0 {
+		JobFromContext(ctx).Logf("taking safety backup")
+		if err := m.Backup(ctx, serverName); err != nil {
+			return worldPaths{}, fmt.Errorf("safety backup failed: %w", err)
+		}
+	}
+	return paths, nil
+}
+
+// stashActiveWorld はアクティブなワールドを保管領域へ移動する。アクティブなワールドが存在しない場合は何もしない。
+func (m *Manager) stashActiveWorld(paths worldPaths, saveAs string) error {
+	if _, err := os.Stat(paths.active); os.IsNotExist(err) {
+		return nil
+	}
+	if saveAs == "" {
+		saveAs = paths.name + "-" + time.Now().Local().Format("20060102_150405")
+	}
+	if !validWorldName(saveAs) {
+		return ErrInvalidWorldName
+	}
+	dest := filepath.Join(paths.storage, saveAs)
+	if _, err := os.Stat(dest); err == nil {
+		return ErrWorldExists
+	}
+	if err := os.MkdirAll(paths.storage, 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(paths.active, dest); err != nil {
+		return fmt.Errorf("failed to stash active world: %w", err)
+	}
+	return nil
+}
+
+// backupTargets は commands.backup のうち、実データをコピーする backup 種別の定義を返す。
+func backupTargets(serverCfg config.ServerConfig) []config.CmdConfig {
+	var targets []config.CmdConfig
+	for _, cmd := range serverCfg.Commands.Backup {
+		if cmd.Type == "backup" {
+			targets = append(targets, cmd)
+		}
+	}
+	return targets
+}
+
+// validWorldName はワールド名がディレクトリ名として安全であるかを検証する。
+func validWorldName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `\/:`)
+}
+
+// dirUsage はディレクトリ配下のファイルサイズの合計と、最終更新時刻を返す。
+func dirUsage(dir string) (int64, time.Time) {
+	var size int64
+	var modTime time.Time
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			if !d.IsDir() {
+				size += info.Size()
+			}
+			if info.ModTime().After(modTime) {
+				modTime = info.ModTime()
+			}
+		}
+		return nil
+	})
+	return size, modTime
+}
+
+// safeJoin はアーカイブ内のパスを展開先に結合する。展開先の外を指すパス（Zip Slip）は拒否する。
+func safeJoin(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if target != dest && !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+	return target, nil
+}
+
+// extractZip は zip アーカイブを展開する。zip は中央ディレクトリの参照にランダムアクセスが必要なため、一時ファイルへ保存してから展開する。
+func extractZip(ctx context.Context, r io.Reader, dest string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		target, err := safeJoin(dest, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeExtracted(target, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTarGz は tar.gz アーカイブを展開する。通常のファイルとディレクトリのみを展開し、リンク等は無視する。
+func extractTarGz(ctx context.Context, r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := safeJoin(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeExtracted(target, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeExtracted(target string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
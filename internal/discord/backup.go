@@ -0,0 +1,114 @@
+package discord
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/notify"
+)
+
+// MARK: runBackupNotifier()
+// 通知のイベントを受け取り、discord.backups を設定したサーバーのバックアップの完了・失敗を通知する。
+func (m *BotManager) runBackupNotifier() {
+	queue := notify.Events.Queue("discord-backups")
+	for {
+		ev := queue.Next()
+		if ev.Kind != config.NotifyBackupCompleted && ev.Kind != config.NotifyBackupFailed {
+			continue
+		}
+		m.notifyBackup(ev)
+	}
+}
+
+// notifyBackup は 1 回のバックアップの結果を通知する。Bot が利用できる場合は backups.channel (省略時は channel) へ、それ以外は Webhook へ送る。
+func (m *BotManager) notifyBackup(ev notify.Event) {
+	d := m.Config.Get().Servers[ev.Server].Discord
+	if d == nil || d.Backups == nil {
+		return
+	}
+	failed := ev.Kind == config.NotifyBackupFailed
+	if d.Backups.FailuresOnly && !failed {
+		return
+	}
+	embed := backupEmbed(ev, failed)
+
+	if token, channel := d.Token, cmp.Or(d.Backups.Channel, d.Channel); token != "" && channel != "" {
+		m.mu.RLock()
+		session := m.Sessions[token]
+		m.mu.RUnlock()
+		if session != nil {
+			if _, err := session.ChannelMessageSendEmbed(channel, embed); err != nil {
+				logger.Errorf("External", "Discord", "バックアップの通知に失敗(%s): %v", ev.Server, err)
+			}
+			return
+		}
+	}
+	if webhook := cmp.Or(d.Backups.Webhook, d.Webhook); webhook != "" {
+		m.executeWebhook(webhook, map[string]any{"embeds": []*discordgo.MessageEmbed{embed}})
+	}
+}
+
+// backupEmbed は世代・所要時間・変更されたファイル数・サイズの増減を表示するリッチメッセージを生成する。
+func backupEmbed(ev notify.Event, failed bool) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Color:     colorSuccess,
+		Title:     fmt.Sprintf("バックアップ完了: %s", ev.Server),
+		Timestamp: ev.Time.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if failed {
+		embed.Color = colorError
+		embed.Title = fmt.Sprintf("バックアップ失敗: %s", ev.Server)
+		embed.Description = "```\n" + ev.Details["error"] + "\n```"
+	}
+
+	field := func(name, value string) {
+		if value != "" {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: name, Value: value, Inline: true})
+		}
+	}
+	number := func(key string) (int64, bool) {
+		n, err := strconv.ParseInt(ev.Details[key], 10, 64)
+		return n, err == nil
+	}
+	field("世代", ev.Details["generation"])
+	field("方式", ev.Details["engine"])
+	if ms, ok := number("duration"); ok {
+		field("所要時間", (time.Duration(ms) * time.Millisecond).Round(time.Second).String())
+	}
+	if n, ok := number("changedFiles"); ok {
+		field("変更されたファイル", fmt.Sprintf("%d 件", n))
+	}
+	if n, ok := number("totalSize"); ok {
+		field("サイズ", formatBytes(n))
+	}
+	if n, ok := number("sizeDelta"); ok {
+		sign := "+"
+		if n < 0 {
+			sign, n = "-", -n
+		}
+		field("増減", sign+formatBytes(n))
+	}
+	if user := cmp.Or(ev.Details["user"], ev.Details["via"]); user != "" {
+		field("実行", user)
+	}
+	return embed
+}
+
+// formatBytes はバイト数を人が読みやすい単位で表す。
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
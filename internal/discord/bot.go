@@ -2,14 +2,18 @@ package discord
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/container"
 	"github.com/play-bin/internal/docker"
 	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+	"github.com/play-bin/internal/query"
 )
 
 const (
@@ -22,11 +26,16 @@ const (
 // MARK: SyncBots()
 // 設定ファイルの内容に合わせて、Discord Botセッションの追加や削除を同期する。
 func (m *BotManager) SyncBots() {
+	select {
+	case <-m.done:
+		return
+	default:
+	}
 	cfg := m.Config.Get()
 
 	m.mu.RLock()
 	// 設定ファイルが最後に読み込まれた時刻をチェックし、Bot構成の更新が必要か判断する。
-	needsUpdate := m.ChannelUpdatedAt.Before(m.Config.LastLoaded)
+	needsUpdate := m.ChannelUpdatedAt.Before(m.Config.LastLoaded())
 	m.mu.RUnlock()
 
 	if !needsUpdate {
@@ -34,7 +43,7 @@ func (m *BotManager) SyncBots() {
 	}
 
 	m.mu.Lock()
-	m.ChannelUpdatedAt = m.Config.LastLoaded
+	m.ChannelUpdatedAt = m.Config.LastLoaded()
 	m.mu.Unlock()
 
 	newChannelToServer := make(map[string]string)
@@ -74,7 +83,7 @@ func (m *BotManager) SyncBots() {
 		if shouldStart {
 			dg, err := discordgo.New("Bot " + token)
 			if err != nil {
-				logger.Logf("External", "Discord", "セッション作成失敗: %v", err)
+				logger.Errorf("External", "Discord", "セッション作成失敗: %v", err)
 				continue
 			}
 
@@ -82,7 +91,7 @@ func (m *BotManager) SyncBots() {
 			dg.AddHandler(m.onMessageCreate)
 
 			if err := dg.Open(); err != nil {
-				logger.Logf("External", "Discord", "接続オープン失敗 (token終端: ...%s): %v", token[len(token)-4:], err)
+				logger.Errorf("External", "Discord", "接続オープン失敗 (token終端: ...%s): %v", token[len(token)-4:], err)
 				m.mu.Lock()
 				m.Sessions[token] = nil // リトライ対象として nil をセット
 				m.mu.Unlock()
@@ -146,6 +155,10 @@ func (m *BotManager) registerCommands(dg *discordgo.Session) {
 			Name:        "backups",
 			Description: "バックアップ世代の一覧を表示します",
 		},
+		{
+			Name:        "status",
+			Description: "サーバーの稼働状態とプレイヤー数を表示します",
+		},
 		{
 			Name:        "cmd",
 			Description: "サーバーコンソールにコマンドを送信します",
@@ -163,7 +176,7 @@ func (m *BotManager) registerCommands(dg *discordgo.Session) {
 	for _, cmd := range commands {
 		_, err := dg.ApplicationCommandCreate(dg.State.User.ID, "", cmd)
 		if err != nil {
-			logger.Logf("External", "Discord", "コマンド登録失敗 (%s, session=%s): %v", cmd.Name, dg.State.User.ID, err)
+			logger.Errorf("External", "Discord", "コマンド登録失敗 (%s, session=%s): %v", cmd.Name, dg.State.User.ID, err)
 		}
 	}
 }
@@ -193,8 +206,8 @@ func (m *BotManager) onInteractionCreate(dg *discordgo.Session, i *discordgo.Int
 	switch i.ApplicationCommandData().Name {
 	case "action":
 		act := i.ApplicationCommandData().Options[0].StringValue()
-		requiredPerm = containerToPerm(container.Action(act))
-	case "backups":
+		requiredPerm = container.Action(act).Permission()
+	case "backups", "status":
 		requiredPerm = config.PermContainerRead
 	case "cmd":
 		requiredPerm = config.PermContainerWrite
@@ -204,8 +217,10 @@ func (m *BotManager) onInteractionCreate(dg *discordgo.Session, i *discordgo.Int
 
 	// ユーザー情報と権限リストを照合し、権限のない操作をブロックする。
 	allowed := false
-	for _, user := range cfg.Users {
+	username := ""
+	for name, user := range cfg.Users {
 		if user.Discord == userID {
+			username = name
 			if user.HasPermission(serverName, requiredPerm) {
 				allowed = true
 			}
@@ -215,7 +230,7 @@ func (m *BotManager) onInteractionCreate(dg *discordgo.Session, i *discordgo.Int
 
 	if !allowed {
 		// 権限のない操作試行は、クライアント起因の不正アクセス（Client）として記録する。
-		logger.Logf("Client", "Discord", "不正アクセス試行: user=%s, target=%s, perm=%s", userID, serverName, requiredPerm)
+		logger.Warnf("Client", "Discord", "不正アクセス試行: user=%s, target=%s, perm=%s", userID, serverName, requiredPerm)
 		dg.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
@@ -231,14 +246,17 @@ func (m *BotManager) onInteractionCreate(dg *discordgo.Session, i *discordgo.Int
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 	})
 	if err != nil {
-		logger.Logf("External", "Discord", "インタラクション応答失敗: %v", err)
+		logger.Errorf("External", "Discord", "インタラクション応答失敗: %v", err)
 		return
 	}
 
 	switch i.ApplicationCommandData().Name {
 	case "action":
 		act := i.ApplicationCommandData().Options[0].StringValue()
-		logger.Logf("Client", "Discord", "アクション実行: user=%s, action=%s, target=%s", userID, act, serverName)
+		// インタラクションの ID をリクエスト ID とし、コンテナ操作やジョブのログと突き合わせられるようにする。
+		ctx := logger.WithRequestID(context.Background(), i.ID)
+		ctx = container.WithActor(ctx, username, container.ViaDiscord)
+		logger.For(ctx).Logf("Client", "Discord", "アクション実行: user=%s, action=%s, target=%s", userID, act, serverName)
 
 		var actionErr error
 		if act == "restore" {
@@ -254,17 +272,28 @@ func (m *BotManager) onInteractionCreate(dg *discordgo.Session, i *discordgo.Int
 				})
 				return
 			}
-			actionErr = m.ContainerManager.Restore(context.Background(), serverName, generation)
+			actionErr = m.ContainerManager.Restore(ctx, serverName, generation)
 		} else {
-			actionErr = m.ContainerManager.ExecuteAction(context.Background(), serverName, container.Action(act))
+			actionErr = m.ContainerManager.ExecuteAction(ctx, serverName, container.Action(act))
 		}
 
+		var cooldown *container.CooldownError
+		if errors.As(actionErr, &cooldown) {
+			actionErr = fmt.Errorf("連続した実行を防ぐため、あと %s 待ってから実行してください", cooldown.RetryAfter.Round(time.Second))
+		}
 		if actionErr != nil {
 			dg.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 				Embeds: &[]*discordgo.MessageEmbed{m.interactionErrorEmbed(act, actionErr)},
 			})
 			return
 		}
+		if act == string(container.ActionStart) && cfg.Servers[serverName].Ready != nil {
+			dg.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+				Embeds: &[]*discordgo.MessageEmbed{m.interactionSuccessEmbed(act, "コンテナを起動しました。サーバーの準備完了を待っています")},
+			})
+			go m.notifyReady(dg, i.Interaction, serverName)
+			return
+		}
 		dg.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
 			Embeds: &[]*discordgo.MessageEmbed{m.interactionSuccessEmbed(act, "実行が完了しました")},
 		})
@@ -299,6 +328,10 @@ func (m *BotManager) onInteractionCreate(dg *discordgo.Session, i *discordgo.Int
 				Description: listText.String(),
 			}},
 		})
+	case "status":
+		dg.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Embeds: &[]*discordgo.MessageEmbed{m.statusEmbed(serverName, cfg.Servers[serverName])},
+		})
 	case "cmd":
 		text := i.ApplicationCommandData().Options[0].StringValue()
 		logger.Logf("Client", "Discord", "コマンド送信: user=%s, target=%s, text=%s", userID, serverName, text)
@@ -346,6 +379,98 @@ func (m *BotManager) onMessageCreate(dg *discordgo.Session, msg *discordgo.Messa
 	docker.SendCommand(serverName, text+"\n")
 }
 
+// MARK: statusEmbed()
+// コンテナの状態と、問い合わせが設定されていればプレイヤー数・MOTD をまとめたリッチメッセージを生成する。
+func (m *BotManager) statusEmbed(serverName string, serverCfg config.ServerConfig) *discordgo.MessageEmbed {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	state := "missing"
+	if pc := serverCfg.ProcessSettings(); pc != nil {
+		if status, err := process.Inspect(ctx, serverName, *pc); err != nil {
+			state = "unreachable"
+		} else {
+			state = status.State
+		}
+	} else if cli, err := docker.ForServer(serverName); err != nil {
+		state = "unreachable"
+	} else if inspect, err := docker.InspectOwned(ctx, cli, serverName); err == nil {
+		state = inspect.State.Status
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Color: colorInfo,
+		Title: fmt.Sprintf("ステータス: %s", serverName),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "コンテナ", Value: state, Inline: true},
+		},
+	}
+	if state != "running" {
+		embed.Color = colorWarn
+	} else if serverCfg.Ready != nil {
+		ready := "判定なし"
+		switch m.ContainerManager.Readiness.Status(serverName).State {
+		case container.ReadyStarting:
+			ready = "起動中"
+			embed.Color = colorWarn
+		case container.ReadyReady:
+			ready = "準備完了"
+		case container.ReadyTimeout:
+			ready = "準備完了を検知できず"
+			embed.Color = colorWarn
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "準備状態", Value: ready, Inline: true})
+	}
+	if serverCfg.Query == nil {
+		return embed
+	}
+
+	result, err := query.Cached(ctx, serverName, *serverCfg.Query)
+	switch {
+	case err != nil:
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "サーバー", Value: err.Error(), Inline: true})
+	case !result.Online:
+		embed.Color = colorWarn
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "サーバー", Value: "応答なし", Inline: true})
+	default:
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "サーバー", Value: fmt.Sprintf("オンライン (%dms)", result.Latency), Inline: true})
+		if result.Supported {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "プレイヤー", Value: fmt.Sprintf("%d / %d", result.Players, result.MaxPlayers), Inline: true})
+		}
+		if result.Version != "" {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "バージョン", Value: result.Version, Inline: true})
+		}
+		if result.MOTD != "" {
+			embed.Description = result.MOTD
+		}
+	}
+	return embed
+}
+
+// MARK: notifyReady()
+// 起動したサーバーの準備完了を待ち、起動操作への応答を結果で更新する。
+// インタラクションの応答は 15 分で編集できなくなるため、それまでに判定が終わらない場合は更新しない。
+func (m *BotManager) notifyReady(dg *discordgo.Session, interaction *discordgo.Interaction, serverName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 14*time.Minute)
+	defer cancel()
+	status, err := m.ContainerManager.Readiness.Wait(ctx, serverName)
+	if err != nil {
+		return
+	}
+
+	embed := m.interactionSuccessEmbed(string(container.ActionStart), "サーバーの準備が完了しました")
+	switch status.State {
+	case container.ReadyReady:
+	case container.ReadyTimeout:
+		embed = m.interactionErrorEmbed(string(container.ActionStart), fmt.Errorf("コンテナは起動していますが、準備完了を検知できませんでした"))
+	default:
+		embed = m.interactionErrorEmbed(string(container.ActionStart), fmt.Errorf("準備完了の前にコンテナが停止しました"))
+	}
+	dg.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{embed},
+	})
+}
+
 // MARK: interactionErrorEmbed()
 // ユーザーへのエラー通知用リッチメッセージを生成する。
 func (m *BotManager) interactionErrorEmbed(act string, err error) *discordgo.MessageEmbed {
@@ -365,20 +490,3 @@ func (m *BotManager) interactionSuccessEmbed(act string, desc string) *discordgo
 		Description: desc,
 	}
 }
-
-func containerToPerm(a container.Action) string {
-	switch a {
-	case container.ActionStart:
-		return config.PermContainerStart
-	case container.ActionStop:
-		return config.PermContainerStop
-	case container.ActionKill:
-		return config.PermContainerKill
-	case container.ActionBackup:
-		return config.PermContainerBackup
-	case container.ActionRemove:
-		return config.PermContainerRemove
-	default:
-		return config.PermContainerExecute
-	}
-}
@@ -0,0 +1,62 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: runConfigNotifier()
+// 設定の再読み込みで変更されたサーバーについて、configChanges を有効にしたサーバーの Discord チャンネルへ変更内容を通知する。
+func (m *BotManager) runConfigNotifier() {
+	diffs, _ := m.Config.Subscribe()
+	for diff := range diffs {
+		for _, name := range diff.Servers.Added {
+			m.notifyConfigChange(name, "サーバー定義が追加されました", nil, diff.Time)
+		}
+		for name, paths := range diff.Servers.Changed {
+			m.notifyConfigChange(name, "サーバー設定が変更されました", paths, diff.Time)
+		}
+	}
+}
+
+// notifyConfigChange は 1 サーバー分の変更を通知する。Bot が利用できる場合はチャンネルへ、それ以外は Webhook へ送る。
+func (m *BotManager) notifyConfigChange(serverName, title string, paths []string, at time.Time) {
+	serverCfg := m.Config.Get().Servers[serverName]
+	if serverCfg.Discord == nil || !serverCfg.Discord.ConfigChanges {
+		return
+	}
+	logger.Logf("Internal", "Discord", "設定変更を通知します: %s", serverName)
+
+	embed := &discordgo.MessageEmbed{
+		Color:     colorInfo,
+		Title:     fmt.Sprintf("%s: %s", title, serverName),
+		Timestamp: at.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if len(paths) > 0 {
+		text := strings.Join(paths, "\n")
+		// 埋め込みの説明文は 4096 文字が上限のため、超える場合は末尾を省略する。
+		if r := []rune(text); len(r) > 4000 {
+			text = string(r[:4000]) + "\n…"
+		}
+		embed.Description = "```\n" + text + "\n```"
+	}
+
+	if token, channel := serverCfg.Discord.Token, serverCfg.Discord.Channel; token != "" && channel != "" {
+		m.mu.RLock()
+		session := m.Sessions[token]
+		m.mu.RUnlock()
+		if session != nil {
+			if _, err := session.ChannelMessageSendEmbed(channel, embed); err != nil {
+				logger.Errorf("External", "Discord", "設定変更の通知に失敗(%s): %v", serverName, err)
+			}
+			return
+		}
+	}
+	if webhook := serverCfg.Discord.Webhook; webhook != "" {
+		m.executeWebhook(webhook, map[string]any{"embeds": []*discordgo.MessageEmbed{embed}})
+	}
+}
@@ -0,0 +1,81 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/play-bin/internal/incident"
+	"github.com/play-bin/internal/logger"
+)
+
+// maxEmbedLogLines は通知の本文に表示するログの末尾行数。全文は添付ファイルで送る。
+const maxEmbedLogLines = 15
+
+// MARK: NotifyIncident()
+// 異常終了の記録をサーバーの Discord チャンネルへ通知する。
+// Bot が利用できる場合はログとクラッシュレポートをファイルとして添付し、Webhook のみの場合は概要のみを送る。
+func (m *BotManager) NotifyIncident(inc incident.Incident) {
+	serverCfg := m.Config.Get().Servers[inc.Server]
+	if serverCfg.Crash == nil || !serverCfg.Crash.Discord || serverCfg.Discord == nil {
+		return
+	}
+	embed := incidentEmbed(inc)
+
+	if token, channel := serverCfg.Discord.Token, serverCfg.Discord.Channel; token != "" && channel != "" {
+		m.mu.RLock()
+		session := m.Sessions[token]
+		m.mu.RUnlock()
+		if session != nil {
+			_, err := session.ChannelMessageSendComplex(channel, &discordgo.MessageSend{
+				Embeds: []*discordgo.MessageEmbed{embed},
+				Files: []*discordgo.File{{
+					Name:        fmt.Sprintf("%s-%s.log", inc.Server, inc.ID),
+					ContentType: "text/plain",
+					Reader:      strings.NewReader(inc.Text()),
+				}},
+			})
+			if err != nil {
+				logger.Errorf("External", "Discord", "異常終了の通知に失敗(%s): %v", inc.Server, err)
+			}
+			return
+		}
+	}
+
+	if webhook := serverCfg.Discord.Webhook; webhook != "" {
+		m.executeWebhook(webhook, map[string]any{"embeds": []*discordgo.MessageEmbed{embed}})
+	}
+}
+
+// incidentEmbed は異常終了の概要とログの末尾を表示するリッチメッセージを生成する。
+func incidentEmbed(inc incident.Incident) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Color:     colorError,
+		Title:     fmt.Sprintf("異常終了: %s", inc.Server),
+		Timestamp: inc.Time.Format("2006-01-02T15:04:05Z07:00"),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "終了コード", Value: fmt.Sprint(inc.ExitCode), Inline: true},
+			{Name: "インシデント", Value: inc.ID, Inline: true},
+		},
+	}
+	if inc.OOMKilled {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "原因", Value: "メモリ不足 (OOM)", Inline: true})
+	}
+	if len(inc.Reports) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "クラッシュレポート", Value: fmt.Sprintf("%d 件", len(inc.Reports)), Inline: true})
+	}
+
+	logs := inc.Logs
+	if len(logs) > maxEmbedLogLines {
+		logs = logs[len(logs)-maxEmbedLogLines:]
+	}
+	text := strings.Join(logs, "\n")
+	// 埋め込みの説明文は 4096 文字が上限のため、コードブロックの記号分を差し引いて末尾を残す。
+	if r := []rune(text); len(r) > 4000 {
+		text = string(r[len(r)-4000:])
+	}
+	if text != "" {
+		embed.Description = "```\n" + strings.ReplaceAll(text, "```", "'''") + "\n```"
+	}
+	return embed
+}
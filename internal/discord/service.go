@@ -7,9 +7,10 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/logger"
 )
 
-// BotManager はすべての Discord 連携（Bot操作およびログ転送）のライフサイクルを統合管理する。
+// BotManager はすべての Discord Bot 連携のライフサイクルを統合管理する。ログの転送は internal/forwarder が担う。
 type BotManager struct {
 	Config           *config.LoadedConfig
 	ContainerManager *container.Manager
@@ -20,9 +21,9 @@ type BotManager struct {
 	ChannelUpdatedAt time.Time
 	mu               sync.RWMutex
 
-	// ログ転送管理：各コンテナのログ監視プロセスを制御するための情報を保持。
-	ActiveForwarders map[string]*forwarderState
-	ForwarderMu      sync.RWMutex
+	// done は Close で閉じられ、同期ループを停止して Bot が再開されないようにする。
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // MARK: NewBotManager()
@@ -33,15 +34,16 @@ func NewBotManager(cfg *config.LoadedConfig, cm *container.Manager) *BotManager
 		ContainerManager: cm,
 		Sessions:         make(map[string]*discordgo.Session),
 		ChannelToServer:  make(map[string]string),
-		ActiveForwarders: make(map[string]*forwarderState),
+		done:             make(chan struct{}),
 	}
 }
 
 // MARK: Start()
-// Bot の同期とログ転送管理のバックグラウンドタスクをそれぞれ独立したゴルーチンで起動する。
+// Bot の同期と、設定の変更・バックアップの結果の通知のバックグラウンドタスクをそれぞれ独立したゴルーチンで起動する。
 func (m *BotManager) Start() {
 	go m.runBotManager()
-	go m.runLogForwarderManager()
+	go m.runConfigNotifier()
+	go m.runBackupNotifier()
 }
 
 // MARK: runBotManager()
@@ -52,19 +54,32 @@ func (m *BotManager) runBotManager() {
 
 	// 起動時に即座に同期を実行
 	m.SyncBots()
-	for range ticker.C {
-		m.SyncBots()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.SyncBots()
+		}
 	}
 }
 
-// MARK: runLogForwarderManager()
-// コンテナログ転送（Webhook）の有効・無効を、設定変更に合わせてリアルタイムに同期させるループ。
-func (m *BotManager) runLogForwarderManager() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// MARK: Close()
+// play-bin の終了時に、全ての Bot セッションを閉じる。Discord 側にはゲートウェイの切断が正常に通知される。
+func (m *BotManager) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
 
-	m.SyncLogForwarders()
-	for range ticker.C {
-		m.SyncLogForwarders()
-	}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for token, session := range m.Sessions {
+			if session != nil {
+				if err := session.Close(); err != nil {
+					logger.Errorf("External", "Discord", "セッションの切断に失敗 (token終端: ...%s): %v", token[len(token)-4:], err)
+				}
+			}
+			delete(m.Sessions, token)
+		}
+		logger.Log("Internal", "Discord", "Discord連携サービスを停止しました")
+	})
 }
@@ -0,0 +1,30 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/play-bin/internal/logger"
+)
+
+// executeWebhook は Bot を持たないサーバーへの通知 (インシデント・設定の変更) を Webhook で送信する。
+func (m *BotManager) executeWebhook(webhook string, body any) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		logger.Errorf("Internal", "Discord", "Webhook JSON変換失敗: %v", err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewBuffer(b))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// 非同期で送るか、タイムアウトを設定したクライアントを推奨
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
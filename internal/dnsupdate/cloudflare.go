@@ -0,0 +1,130 @@
+package dnsupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// cloudflareAPI は Cloudflare API v4 の基底 URL。
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// MARK: cloudflare
+// Cloudflare API でゾーンのレコードを作成・更新・削除する。
+type cloudflare struct {
+	zoneID string
+	token  string
+}
+
+// cloudflareRecord は Cloudflare API のレコードの表現。
+type cloudflareRecord struct {
+	ID      string         `json:"id,omitempty"`
+	Type    string         `json:"type"`
+	Name    string         `json:"name"`
+	Content string         `json:"content,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+	TTL     int            `json:"ttl,omitempty"`
+	Proxied bool           `json:"proxied"`
+}
+
+// cloudflareResponse は Cloudflare API の応答の共通部分。
+type cloudflareResponse struct {
+	Success bool                       `json:"success"`
+	Errors  []struct{ Message string } `json:"errors"`
+	Result  json.RawMessage            `json:"result"`
+}
+
+func (c *cloudflare) upsert(ctx context.Context, records []Record) error {
+	var errs []error
+	for _, r := range records {
+		existing, err := c.find(ctx, r)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		body := cloudflareRecord{Type: r.Type, Name: r.Name, TTL: r.TTL}
+		if r.Type == "SRV" {
+			body.Data = map[string]any{"priority": 0, "weight": 5, "port": r.Port, "target": r.Target}
+		} else {
+			body.Content = r.Value
+		}
+		// 最初のレコードを更新し、重複したレコードは削除して 1 件にする。
+		if len(existing) == 0 {
+			errs = append(errs, c.do(ctx, http.MethodPost, "/dns_records", body, nil))
+			continue
+		}
+		errs = append(errs, c.do(ctx, http.MethodPut, "/dns_records/"+existing[0].ID, body, nil))
+		for _, e := range existing[1:] {
+			errs = append(errs, c.do(ctx, http.MethodDelete, "/dns_records/"+e.ID, nil, nil))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *cloudflare) remove(ctx context.Context, records []Record) error {
+	var errs []error
+	for _, r := range records {
+		existing, err := c.find(ctx, r)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, e := range existing {
+			errs = append(errs, c.do(ctx, http.MethodDelete, "/dns_records/"+e.ID, nil, nil))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// find は同じ名前・種類のレコードを返す。
+func (c *cloudflare) find(ctx context.Context, r Record) ([]cloudflareRecord, error) {
+	var found []cloudflareRecord
+	q := url.Values{"type": {r.Type}, "name": {r.Name}}
+	err := c.do(ctx, http.MethodGet, "/dns_records?"+q.Encode(), nil, &found)
+	return found, err
+}
+
+// do は API を呼び出し、result を out へ読み込む。
+func (c *cloudflare) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudflareAPI+"/zones/"+url.PathEscape(c.zoneID)+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res cloudflareResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res); err != nil {
+		return fmt.Errorf("cloudflare: %s: %w", resp.Status, err)
+	}
+	if !res.Success {
+		msgs := make([]string, len(res.Errors))
+		for i, e := range res.Errors {
+			msgs[i] = e.Message
+		}
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(res.Result, out)
+	}
+	return nil
+}
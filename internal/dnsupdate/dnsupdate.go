@@ -0,0 +1,219 @@
+package dnsupdate
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// defaultTTL は ttl を省略した場合のレコードの TTL。サーバーの移動を早く反映できるよう短くする。
+	defaultTTL = 60
+	// updateTimeout は 1 回の更新 (全てのレコード) の期限。
+	updateTimeout = 30 * time.Second
+)
+
+// MARK: Record
+// 更新するレコード。A / AAAA は Value に IP アドレスを、SRV は Port と Target を持つ。
+type Record struct {
+	Type   string // "A", "AAAA", "SRV"
+	Name   string // 末尾の "." を含まない完全な名前
+	Value  string
+	Port   int
+	Target string
+	TTL    int
+}
+
+// content は比較とログのための、レコードの値の表現を返す。
+func (r Record) content() string {
+	if r.Type == "SRV" {
+		return fmt.Sprintf("0 5 %d %s", r.Port, r.Target)
+	}
+	return r.Value
+}
+
+// provider は DNS の提供元ごとのレコードの更新。
+type provider interface {
+	// upsert は同じ名前・種類のレコードを records の値に置き換える。
+	upsert(ctx context.Context, records []Record) error
+	remove(ctx context.Context, records []Record) error
+}
+
+// newProvider は設定に応じた provider を返す。
+func newProvider(cfg config.DNSProviderConfig) (provider, error) {
+	switch cfg.Type {
+	case "cloudflare":
+		token, err := readSecret(cfg.APIToken, cfg.APITokenFile, "apiTokenFile")
+		if err != nil {
+			return nil, err
+		}
+		return &cloudflare{zoneID: cfg.ZoneID, token: token}, nil
+	case "rfc2136":
+		secret, err := readSecret(cfg.TSIGSecret, cfg.TSIGSecretFile, "tsigSecretFile")
+		if err != nil {
+			return nil, err
+		}
+		return &rfc2136{cfg: cfg, secret: secret}, nil
+	default:
+		return nil, fmt.Errorf("unknown dns provider type %q", cfg.Type)
+	}
+}
+
+// readSecret はファイルが指定されていればその内容を、そうでなければ値を返す。
+func readSecret(value, file, key string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// MARK: Updater
+// サーバーの起動イベントを購読し、サーバーが動作するホストとポートを DNS のレコードへ反映する。
+// ホスト間の移行等でサーバーの配置が変わっても、利用者は同じ名前で接続できる。
+type Updater struct {
+	Config *config.LoadedConfig
+
+	mu sync.Mutex
+}
+
+// MARK: NewUpdater()
+func NewUpdater(cfg *config.LoadedConfig) *Updater {
+	return &Updater{Config: cfg}
+}
+
+// MARK: Start()
+// イベントの購読と、稼働中のサーバーのレコードの更新を開始する。
+func (u *Updater) Start() {
+	events, _ := docker.Events.Subscribe()
+	go func() {
+		for ev := range events {
+			if (ev.Action != "start" && ev.Action != "die") || ev.Host != docker.HostOf(ev.Server) {
+				continue
+			}
+			d := u.Config.Get().Servers[ev.Server].DNS
+			if d == nil || (ev.Action == "die" && !d.RemoveOnStop) {
+				continue
+			}
+			go u.Update(ev.Server, ev.Action == "start")
+		}
+	}()
+	go u.resume()
+}
+
+// resume は play-bin の停止中に起動したサーバーのレコードを更新する。
+func (u *Updater) resume() {
+	cfg := u.Config.Get()
+	for _, serverName := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		if cfg.Servers[serverName].DNS == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		inspect, err := docker.Inspects.Inspect(ctx, serverName)
+		cancel()
+		if err == nil && inspect.State != nil && inspect.State.Running {
+			u.Update(serverName, true)
+		}
+	}
+}
+
+// MARK: Update()
+// サーバーのレコードを作成・更新 (running が true) または削除する。
+func (u *Updater) Update(serverName string, running bool) {
+	cfg := u.Config.Get()
+	d := cfg.Servers[serverName].DNS
+	if d == nil {
+		return
+	}
+	p, err := newProvider(cfg.DNS[d.Provider])
+	if err != nil {
+		logger.Errorf("Internal", "DNS", "DNS の提供元 %s を利用できません(%s): %v", d.Provider, serverName, err)
+		return
+	}
+	records, err := Records(cfg, serverName)
+	if err != nil {
+		logger.Errorf("Internal", "DNS", "レコードを決定できません(%s): %v", serverName, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if running {
+		err = p.upsert(ctx, records)
+	} else {
+		err = p.remove(ctx, records)
+	}
+	if err != nil {
+		logger.Errorf("External", "DNS", "レコードの更新に失敗(%s): %v", serverName, err)
+		return
+	}
+	for _, r := range records {
+		if running {
+			logger.Logf("Internal", "DNS", "レコードを更新しました(%s): %s %s %s", serverName, r.Name, r.Type, r.content())
+		} else {
+			logger.Logf("Internal", "DNS", "レコードを削除しました(%s): %s %s", serverName, r.Name, r.Type)
+		}
+	}
+}
+
+// MARK: Records()
+// サーバーの dns の設定と、所属する Docker ホストの publicAddress から更新するレコードを求める。
+func Records(cfg config.Config, serverName string) ([]Record, error) {
+	serverCfg := cfg.Servers[serverName]
+	d := serverCfg.DNS
+	if d == nil {
+		return nil, nil
+	}
+	ttl := cmp.Or(cfg.DNS[d.Provider].TTL, defaultTTL)
+	name := strings.TrimSuffix(d.Name, ".")
+
+	var records []Record
+	if address := cmp.Or(d.Address, cfg.DockerHosts[serverCfg.Host].PublicAddress); address != "" {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip address %q", address)
+		}
+		typ := "AAAA"
+		if ip.To4() != nil {
+			typ = "A"
+		}
+		records = append(records, Record{Type: typ, Name: name, Value: ip.String(), TTL: ttl})
+	}
+	if d.SRV != "" {
+		port := d.Port
+		if port == 0 && serverCfg.Compose != nil {
+			port = firstTCPPort(serverCfg.Compose.Network.PortMappings())
+		}
+		if port == 0 {
+			return nil, fmt.Errorf("port is required for the srv record")
+		}
+		records = append(records, Record{Type: "SRV", Name: d.SRV + "." + name, Port: port, Target: name, TTL: ttl})
+	}
+	return records, nil
+}
+
+// firstTCPPort は公開する TCP のホスト側のポートのうち、最も小さい番号を返す。
+func firstTCPPort(mappings []config.PortMapping) int {
+	for _, m := range mappings {
+		if m.Protocol == "tcp" {
+			return m.HostPort
+		}
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package dnsupdate
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/play-bin/internal/config"
+)
+
+// MARK: rfc2136
+// RFC 2136 の動的更新を nsupdate で送信する。TSIG の鍵を指定した場合は署名する。
+type rfc2136 struct {
+	cfg    config.DNSProviderConfig
+	secret string
+}
+
+func (r *rfc2136) upsert(ctx context.Context, records []Record) error {
+	var b strings.Builder
+	for _, rec := range records {
+		fmt.Fprintf(&b, "update delete %s. %s\n", rec.Name, rec.Type)
+		fmt.Fprintf(&b, "update add %s. %d %s %s\n", rec.Name, rec.TTL, rec.Type, fqdnContent(rec))
+	}
+	return r.send(ctx, b.String())
+}
+
+func (r *rfc2136) remove(ctx context.Context, records []Record) error {
+	var b strings.Builder
+	for _, rec := range records {
+		fmt.Fprintf(&b, "update delete %s. %s\n", rec.Name, rec.Type)
+	}
+	return r.send(ctx, b.String())
+}
+
+// fqdnContent は nsupdate へ渡すレコードの値を返す。SRV の target は完全な名前として末尾に "." を付ける。
+func fqdnContent(rec Record) string {
+	if rec.Type == "SRV" {
+		return fmt.Sprintf("0 5 %d %s.", rec.Port, rec.Target)
+	}
+	return rec.Value
+}
+
+// send は更新を 1 つのトランザクションとして nsupdate の標準入力へ渡す。
+// 鍵はコマンドライン引数に含めると他のユーザーから参照できるため、key 文で標準入力から渡す。
+func (r *rfc2136) send(ctx context.Context, updates string) error {
+	host, port, err := net.SplitHostPort(r.cfg.Server)
+	if err != nil {
+		return err
+	}
+	var script strings.Builder
+	fmt.Fprintf(&script, "server %s %s\n", host, port)
+	fmt.Fprintf(&script, "zone %s.\n", strings.TrimSuffix(r.cfg.Zone, "."))
+	if r.cfg.TSIGName != "" {
+		fmt.Fprintf(&script, "key %s:%s %s\n", cmp.Or(r.cfg.TSIGAlgorithm, "hmac-sha256"), r.cfg.TSIGName, r.secret)
+	}
+	script.WriteString(updates)
+	script.WriteString("send\n")
+
+	cmd := exec.CommandContext(ctx, "nsupdate")
+	cmd.Stdin = strings.NewReader(script.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nsupdate: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
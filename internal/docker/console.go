@@ -0,0 +1,218 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// consoleBufferLines はコンテナごとに保持する直近の出力行数。
+	consoleBufferLines = 1000
+	// consoleSubscriberQueue は購読者ごとの未送信チャンクの上限。超過した購読者は切断する。
+	// ストリーム開始直後は直近 consoleBufferLines 行が一度に届くため、それを上回る値とする。
+	consoleSubscriberQueue = 2 * consoleBufferLines
+)
+
+// consoleBuffer は 1 コンテナ分のログストリームと、直近の出力を保持するリングバッファ。
+type consoleBuffer struct {
+	lines   [][]byte // 改行までを含む完結した行（古い順）
+	partial []byte   // 改行が届いていない末尾の行（プロンプト等）
+	subs    map[chan []byte]struct{}
+	cancel  context.CancelFunc
+}
+
+// MARK: ConsoleHub
+// コンテナごとに単一の Docker ログストリームを維持し、全ての閲覧者へ同じ出力を配信する。
+// 接続時には保持済みの直近出力を即座に返すため、閲覧者ごとに Docker へ再取得する必要が無く、取りこぼしも起きない。
+type ConsoleHub struct {
+	mu      sync.Mutex
+	buffers map[string]*consoleBuffer
+}
+
+// Console はアプリケーション全体で共有するコンソール出力のハブ。
+var Console = &ConsoleHub{buffers: make(map[string]*consoleBuffer)}
+
+// MARK: Subscribe()
+// 指定コンテナの出力を購読する。戻り値の Reader は、保持済みの直近 tail 行（負数は全て）に続けて新しい出力を返し、
+// コンテナの停止等でストリームが終了すると io.EOF を返す。TTY の有無に関わらず出力は多重化解除済み。
+func (h *ConsoleHub) Subscribe(id string, tail int) (io.ReadWriteCloser, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buf, ok := h.buffers[id]
+	if !ok {
+		var err error
+		if buf, err = h.start(id); err != nil {
+			return nil, err
+		}
+	}
+
+	// 購読者の登録とスナップショットの取得を同じロック内で行い、その間の出力の欠落や重複を防ぐ。
+	lines := buf.lines
+	if tail >= 0 && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+	snapshot := bytes.Join(lines, nil)
+	snapshot = append(snapshot, buf.partial...)
+
+	ch := make(chan []byte, consoleSubscriberQueue)
+	buf.subs[ch] = struct{}{}
+	return &consoleSubscription{hub: h, id: id, buf: buf, ch: ch, pending: snapshot}, nil
+}
+
+// start は Docker のログストリームを開始する。h.mu を保持した状態で呼び出すこと。
+func (h *ConsoleHub) start(id string) (*consoleBuffer, error) {
+	cli, err := ForServer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ref, err := Ref(ctx, id)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	isTty := false
+	if inspect, err := cli.ContainerInspect(ctx, ref); err == nil {
+		isTty = inspect.Config.Tty
+	}
+	logs, err := cli.ContainerLogs(ctx, ref, container.LogsOptions{
+		ShowStdout: true, ShowStderr: true, Follow: true, Tail: strconv.Itoa(consoleBufferLines),
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	buf := &consoleBuffer{subs: make(map[chan []byte]struct{}), cancel: cancel}
+	h.buffers[id] = buf
+	logger.Logf("Internal", "Docker", "コンソール出力の共有ストリームを開始しました: container=%s", id)
+
+	go func() {
+		defer logs.Close()
+		w := &consoleWriter{hub: h, buf: buf}
+		if isTty {
+			io.Copy(w, logs)
+		} else {
+			stdcopy.StdCopy(w, w, logs)
+		}
+		h.stop(id, buf)
+	}()
+	return buf, nil
+}
+
+// stop はストリームを終了し、全ての購読者へ終了を通知する。
+func (h *ConsoleHub) stop(id string, buf *consoleBuffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopLocked(id, buf)
+}
+
+// stopLocked は h.mu を保持した状態で stop と同じ処理を行う。
+func (h *ConsoleHub) stopLocked(id string, buf *consoleBuffer) {
+	buf.cancel()
+	for ch := range buf.subs {
+		close(ch)
+		delete(buf.subs, ch)
+	}
+	// 既に新しいストリームへ置き換わっている場合は削除しない。
+	if h.buffers[id] == buf {
+		delete(h.buffers, id)
+		logger.Logf("Internal", "Docker", "コンソール出力の共有ストリームを終了しました: container=%s", id)
+	}
+}
+
+// unsubscribe は購読を解除し、購読者が居なくなった場合は Docker のストリームを停止する。
+func (h *ConsoleHub) unsubscribe(id string, buf *consoleBuffer, ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, subscribed := buf.subs[ch]; subscribed {
+		delete(buf.subs, ch)
+		close(ch)
+	}
+	// 既に終了したストリームの場合は h.buffers から外れているため、停止処理は不要。
+	if len(buf.subs) == 0 && h.buffers[id] == buf {
+		h.stopLocked(id, buf)
+	}
+}
+
+// consoleWriter は Docker からの出力をリングバッファへ蓄積し、購読者へ配信する。
+type consoleWriter struct {
+	hub *ConsoleHub
+	buf *consoleBuffer
+}
+
+func (w *consoleWriter) Write(p []byte) (int, error) {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+
+	buf := w.buf
+	data := append(buf.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		buf.lines = append(buf.lines, append([]byte(nil), data[:i+1]...))
+		data = data[i+1:]
+	}
+	buf.partial = append([]byte(nil), data...)
+	if over := len(buf.lines) - consoleBufferLines; over > 0 {
+		buf.lines = append([][]byte(nil), buf.lines[over:]...)
+	}
+
+	chunk := append([]byte(nil), p...)
+	for ch := range buf.subs {
+		select {
+		case ch <- chunk:
+		default:
+			// 送信待ちが溢れた購読者は出力の欠落を避けるため切断し、再接続（スナップショットの再取得）を促す。
+			close(ch)
+			delete(buf.subs, ch)
+			logger.Log("Internal", "Docker", "コンソール出力の購読者が追従できないため切断しました")
+		}
+	}
+	return len(p), nil
+}
+
+// consoleSubscription は購読したコンソール出力を io.ReadWriteCloser として読み出すためのアダプター。
+// 書き込みは閲覧専用のため破棄する。
+type consoleSubscription struct {
+	hub       *ConsoleHub
+	id        string
+	buf       *consoleBuffer
+	ch        chan []byte
+	pending   []byte
+	closeOnce sync.Once
+}
+
+func (s *consoleSubscription) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		chunk, ok := <-s.ch
+		if !ok {
+			return 0, io.EOF
+		}
+		s.pending = chunk
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *consoleSubscription) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (s *consoleSubscription) Close() error {
+	s.closeOnce.Do(func() { s.hub.unsubscribe(s.id, s.buf, s.ch) })
+	return nil
+}
@@ -0,0 +1,134 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ErrNotRegularFile は単一のファイルとして取り出せないパス (ディレクトリ・シンボリックリンク等) を指定した場合のエラー。
+var ErrNotRegularFile = errors.New("not a regular file")
+
+// MARK: CopyOwner
+// コンテナへ書き込むファイルの所有者。nil の場合は root とする (docker cp と同じ)。
+type CopyOwner struct {
+	UID int
+	GID int
+}
+
+// MARK: StatPath()
+// コンテナ内のパスの情報を返す。停止中のコンテナでも取得できる。
+func StatPath(ctx context.Context, id, p string) (container.PathStat, error) {
+	cli, err := ForServer(id)
+	if err != nil {
+		return container.PathStat{}, err
+	}
+	ref, err := Ref(ctx, id)
+	if err != nil {
+		return container.PathStat{}, err
+	}
+	return cli.ContainerStatPath(ctx, ref, p)
+}
+
+// MARK: CopyArchiveFrom()
+// コンテナ内のパス (ファイルまたはディレクトリ) を tar として読み出す。tar 内のパスは指定したパスの最後の要素を最上位とする。
+func CopyArchiveFrom(ctx context.Context, id, p string) (io.ReadCloser, container.PathStat, error) {
+	cli, err := ForServer(id)
+	if err != nil {
+		return nil, container.PathStat{}, err
+	}
+	ref, err := Ref(ctx, id)
+	if err != nil {
+		return nil, container.PathStat{}, err
+	}
+	return cli.CopyFromContainer(ctx, ref, p)
+}
+
+// MARK: CopyFileFrom()
+// コンテナ内の通常のファイルの内容を読み出す。ディレクトリ等の場合は ErrNotRegularFile を返す。
+func CopyFileFrom(ctx context.Context, id, p string) (io.ReadCloser, *tar.Header, error) {
+	rc, _, err := CopyArchiveFrom(ctx, id, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	if err != nil {
+		rc.Close()
+		return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		rc.Close()
+		return nil, nil, ErrNotRegularFile
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{tr, rc}, hdr, nil
+}
+
+// MARK: CopyArchiveTo()
+// tar をコンテナ内のディレクトリへ展開する。ディレクトリは存在している必要がある。
+func CopyArchiveTo(ctx context.Context, id, dir string, archive io.Reader) error {
+	cli, err := ForServer(id)
+	if err != nil {
+		return err
+	}
+	ref, err := Ref(ctx, id)
+	if err != nil {
+		return err
+	}
+	return cli.CopyToContainer(ctx, ref, dir, archive, container.CopyToContainerOptions{})
+}
+
+// MARK: CopyFileTo()
+// r の内容 (size バイト) を、コンテナ内の p へファイルとして書き込む。既存のファイルは置き換える。
+// Docker API は tar のみを受け付けるため、1 ファイルの tar に包んで送る。
+func CopyFileTo(ctx context.Context, id, p string, r io.Reader, size int64, mode os.FileMode, owner *CopyOwner) error {
+	cli, err := ForServer(id)
+	if err != nil {
+		return err
+	}
+	ref, err := Ref(ctx, id)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Base(p),
+		Size:     size,
+		Mode:     int64(mode.Perm()),
+		ModTime:  time.Now(),
+	}
+	if owner != nil {
+		hdr.Uid, hdr.Gid = owner.UID, owner.GID
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(hdr)
+		if err == nil {
+			// 申告より短い本文は tar が壊れるため、エラーとして中断する。
+			var n int64
+			n, err = io.Copy(tw, io.LimitReader(r, size))
+			if err == nil && n < size {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	err = cli.CopyToContainer(ctx, ref, path.Dir(p), pr, container.CopyToContainerOptions{CopyUIDGID: owner != nil})
+	pr.CloseWithError(err)
+	return err
+}
@@ -2,13 +2,14 @@ package docker
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"io"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
 )
 
 var (
@@ -16,26 +17,47 @@ var (
 	Client *client.Client
 )
 
+// CallTimeout は期限を持たない呼び出し元 (SFTP・WebDAV のファイル操作等) が Docker API を呼び出す際の期限。
+// デーモンが応答しなくなった場合に、呼び出し元のゴルーチンが積み上がらないようにする。
+const CallTimeout = 10 * time.Second
+
 // MARK: Init()
 // OS 環境変数等を読み込み、Docker デーモンとの通信に必要なクライアントを初期化する。
-func Init() error {
+// 名前付きホスト（dockerHosts）のクライアントは、初回利用時に設定から遅延生成される。
+func Init(cfg *config.LoadedConfig) error {
+	loadedConfig = cfg
+
 	var err error
 	// API バージョンのネゴシエーションを有効にし、ホスト側の Docker 環境に自動で適応させる。
 	Client, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		// 初期化失敗は主に Docker デーモン未起動などの外部要因（External）として記録する。
-		logger.Logf("External", "Docker", "クライアント初期化失敗: %v", err)
+		logger.Errorf("External", "Docker", "クライアント初期化失敗: %v", err)
 	}
 	return err
 }
 
 // MARK: SendCommand()
 // 実行中のコンテナの標準入力 (stdin) へ、文字列（コマンド）を直接流し込む。
+// ホスト上で直接実行するサーバー (process) の場合は、そのプロセスの標準入力へ書き込む。
 func SendCommand(id, command string) error {
+	if loadedConfig != nil {
+		if pc := loadedConfig.Get().Servers[id].ProcessSettings(); pc != nil {
+			return process.SendCommand(id, *pc, command)
+		}
+	}
 	ctx := context.Background()
+	cli, err := ForServer(id)
+	if err != nil {
+		return err
+	}
+	ref, err := Ref(ctx, id)
+	if err != nil {
+		return err
+	}
 
 	// ストリーム接続（Attach）を確立する。TTY 有効なコンテナへのコマンド送信に利用。
-	resp, err := Client.ContainerAttach(ctx, id, container.AttachOptions{
+	resp, err := cli.ContainerAttach(ctx, ref, container.AttachOptions{
 		Stream: true,
 		Stdin:  true,
 	})
@@ -51,39 +73,15 @@ func SendCommand(id, command string) error {
 
 // MARK: SendExec()
 // コンテナ内に一時的な別プロセスを生成（Exec）し、指定された引数リストでコマンドを同期実行する。
+// 非ゼロ終了時は、原因を追えるよう標準エラーの末尾をエラーに含める。
 func SendExec(id string, cmd []string) error {
-	ctx := context.Background()
-	// コマンドの実行環境（出力のキャプチャ等）を定義する。
-	execConfig := container.ExecOptions{
-		Cmd:          cmd,
-		AttachStdout: true,
-		AttachStderr: true,
-	}
-	// Docker エンジンに対して、コマンド実行ジョブの作成を依頼する。
-	resp, err := Client.ContainerExecCreate(ctx, id, execConfig)
+	result, err := Exec(context.Background(), id, ExecRequest{Cmd: cmd})
 	if err != nil {
 		return err
 	}
-
-	// 作成したジョブに対してアタッチし、実際の実行を開始させる。
-	attach, err := Client.ContainerExecAttach(ctx, resp.ID, container.ExecAttachOptions{})
-	if err != nil {
-		return err
-	}
-	defer attach.Close()
-
-	// 同期実行を維持するため、プロセスが終了して出力ストリームが閉じるまで、出力を読み飛ばして待機する。
-	io.Copy(io.Discard, attach.Reader)
-
-	// プロセスの正常終了（終了コード 0）を担保するため、実行後の状態を詳細に検証する。
-	inspect, err := Client.ContainerExecInspect(ctx, resp.ID)
-	if err != nil {
-		return err
+	if result.ExitCode != 0 {
+		return exitError(result)
 	}
-	if inspect.ExitCode != 0 {
-		return fmt.Errorf("command exited with code %d: %w", inspect.ExitCode, errors.New("non-zero exit code"))
-	}
-
 	return nil
 }
 
@@ -0,0 +1,223 @@
+package docker
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/pubsub"
+)
+
+// MARK: ContainerEvent
+// Docker Events API から受信したコンテナのライフサイクルイベントを、購読者向けに簡略化した表現。
+type ContainerEvent struct {
+	Host       string            `json:"host,omitempty"` // イベント発生元の dockerHosts 名（既定ホストは空文字）
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Server     string            `json:"server,omitempty"` // play-bin が作成したコンテナの場合のサーバー名 (所有ラベルの値)
+	Action     string            `json:"action"`           // create, start, stop, die, destroy 等
+	ExitCode   string            `json:"exitCode,omitempty"`
+	Time       time.Time         `json:"time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// lifecycleActions は購読者へ配信するライフサイクル系アクションの一覧。
+// exec_create 等の高頻度かつ状態遷移を伴わないイベントは配信対象外とする。
+var lifecycleActions = map[events.Action]bool{
+	events.ActionCreate:  true,
+	events.ActionStart:   true,
+	events.ActionRestart: true,
+	events.ActionStop:    true,
+	events.ActionKill:    true,
+	events.ActionDie:     true,
+	events.ActionOOM:     true,
+	events.ActionDestroy: true,
+	events.ActionPause:   true,
+	events.ActionUnPause: true,
+	events.ActionRename:  true,
+}
+
+// MARK: EventHub
+// Docker Events API への購読を 1 本に集約し、受信したイベントを複数の購読者へファンアウトする。
+// 購読 (Subscribe) と配信 (Publish) は pubsub.Hub による。
+type EventHub struct {
+	pubsub.Hub[ContainerEvent]
+	startOnce sync.Once
+}
+
+var (
+	// Events はプロセス全体で共有されるコンテナイベントの配信ハブ。
+	Events = &EventHub{}
+)
+
+// MARK: Start()
+// Docker Events API の監視ループをバックグラウンドで開始する。複数回呼び出しても起動は一度のみ。
+func (h *EventHub) Start() {
+	h.startOnce.Do(func() {
+		go h.run()
+	})
+}
+
+// MARK: run()
+// 設定済みの各ホストに対して監視ゴルーチンを 1 本ずつ割り当てる。
+// 設定の再読み込みで追加されたホストも拾えるよう、定期的にホスト一覧を確認する。
+func (h *EventHub) run() {
+	var watching sync.Map
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		for _, hostName := range HostNames() {
+			if _, loaded := watching.LoadOrStore(hostName, true); loaded {
+				continue
+			}
+			go func(hostName string) {
+				defer watching.Delete(hostName)
+				h.watchHost(hostName)
+			}(hostName)
+		}
+		<-ticker.C
+	}
+}
+
+// MARK: watchHost()
+// デーモンの再起動や接続断に備え、ストリームが途切れた場合は待機を挟んで再購読を繰り返す。
+// ホストが設定から削除された場合は監視を終了する。
+func (h *EventHub) watchHost(hostName string) {
+	backoff := time.Second
+	for {
+		cli, err := ForHost(hostName)
+		if err != nil {
+			if hostName != "" && !hostConfigured(hostName) {
+				logger.Logf("Internal", "Docker", "ホスト %s が設定から削除されたため、イベント購読を終了します", hostName)
+				return
+			}
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		started := time.Now()
+		err = h.watch(context.Background(), hostName, cli)
+		logger.Warnf("External", "Docker", "イベントストリームが切断されました。再接続します (host=%s): %v", hostName, err)
+
+		// 長時間正常に購読できていた場合は待機時間をリセットし、連続失敗時のみ指数的に延ばす。
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// MARK: watch()
+// 1 本のイベントストリームを購読し、コンテナのライフサイクルイベントを配信する。
+func (h *EventHub) watch(ctx context.Context, hostName string, cli *client.Client) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	msgs, errs := cli.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("type", string(events.ContainerEventType))),
+	})
+	logger.Logf("Internal", "Docker", "イベントストリームの購読を開始しました (host=%s)", hostName)
+
+	for {
+		select {
+		case msg := <-msgs:
+			action := msg.Action
+			// health_status: healthy のようにアクション名へ詳細が付与されるものは接頭辞で判定する。
+			if i := strings.Index(string(action), ":"); i >= 0 {
+				action = events.Action(string(action)[:i])
+			}
+			if !lifecycleActions[action] && action != events.ActionHealthStatus {
+				continue
+			}
+
+			ev := ContainerEvent{
+				Host:       hostName,
+				ID:         msg.Actor.ID,
+				Name:       msg.Actor.Attributes["name"],
+				Server:     msg.Actor.Attributes[OwnerLabel],
+				Action:     string(msg.Action),
+				ExitCode:   msg.Actor.Attributes["exitCode"],
+				Time:       time.Unix(0, msg.TimeNano),
+				Attributes: msg.Actor.Attributes,
+			}
+			// 所有ラベルの無い以前のバージョンのコンテナは、名前からサーバーを特定する。
+			if ev.Server == "" && HostOf(ev.Name) == hostName && LegacyOwned(ev.Name, ev.Name) {
+				ev.Server = ev.Name
+			}
+			h.Publish(ev)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// MARK: Of()
+// イベントがサーバー名 (または未管理コンテナの名前) id のコンテナのものかを返す。
+// 設定のサーバーは、同じ名前の管理外のコンテナと区別するため play-bin が作成したコンテナのイベントのみを対象とする。
+func (ev ContainerEvent) Of(id string) bool {
+	if ev.Host != HostOf(id) {
+		return false
+	}
+	if managed(id) {
+		return ev.Server == id
+	}
+	return ev.Name == id
+}
+
+// hostConfigured は名前付きホストが現在の設定に存在するかを返す。
+func hostConfigured(hostName string) bool {
+	if loadedConfig == nil {
+		return false
+	}
+	_, ok := loadedConfig.Get().DockerHosts[hostName]
+	return ok
+}
+
+// MARK: WaitFor()
+// 指定サーバーのコンテナで指定アクションのいずれかが発生するまで待機する。
+// イベントの取りこぼしに備え、timeout 経過時は false を返して呼び出し元に状態の再確認を促す。
+// 状態を確認してから待機する場合は、確認の前に WatchFor で購読を開始すること。
+func WaitFor(ctx context.Context, serverName string, timeout time.Duration, actions ...string) bool {
+	wait, stop := WatchFor(serverName, actions...)
+	defer stop()
+	return wait(ctx, timeout)
+}
+
+// MARK: WatchFor()
+// 指定サーバーのコンテナの指定アクションの購読を開始し、発生まで待機する関数と購読を解除する関数を返す。
+// コンテナの状態を確認する前に呼び出すことで、確認から待機の開始までの間に発生したイベントを取りこぼさない。
+// wait の戻り値は WaitFor と同じ。stop は待機しなかった場合も含め、必ず呼び出すこと。
+func WatchFor(serverName string, actions ...string) (wait func(ctx context.Context, timeout time.Duration) bool, stop func()) {
+	ch, unsubscribe := Events.Subscribe()
+	wait = func(ctx context.Context, timeout time.Duration) bool {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-timer.C:
+				return false
+			case ev, ok := <-ch:
+				if !ok {
+					return false
+				}
+				if ev.Of(serverName) && slices.Contains(actions, ev.Action) {
+					return true
+				}
+			}
+		}
+	}
+	return wait, unsubscribe
+}
@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchForReceivesEventBeforeWait(t *testing.T) {
+	wait, stop := WatchFor("mc", "start", "restart")
+	defer stop()
+
+	// 状態の確認から待機の開始までの間に起動した場合も、待機はすぐに終わる。
+	Events.Publish(ContainerEvent{Name: "other", Action: "start"})
+	Events.Publish(ContainerEvent{Name: "mc", Action: "die"})
+	Events.Publish(ContainerEvent{Name: "mc", Action: "start"})
+
+	start := time.Now()
+	if !wait(context.Background(), 5*time.Second) {
+		t.Fatal("wait returned false, want the start event published before waiting")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait took %s", elapsed)
+	}
+}
+
+func TestWatchForTimeout(t *testing.T) {
+	wait, stop := WatchFor("mc", "start")
+	defer stop()
+	Events.Publish(ContainerEvent{Name: "mc", Action: "die"})
+	if wait(context.Background(), 20*time.Millisecond) {
+		t.Error("wait returned true without a matching event")
+	}
+}
@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// maxExecOutput は標準出力・標準エラーそれぞれについて保持する最大バイト数。
+// 大量出力のコマンドでメモリを圧迫しないよう、超過分は破棄して Truncated を立てる。
+const maxExecOutput = 1 << 20
+
+// ExecRequest はコンテナ内で実行するコマンドとその実行環境を表す。
+type ExecRequest struct {
+	Cmd        []string `json:"cmd"`
+	Env        []string `json:"env,omitempty"`        // "KEY=VALUE" 形式
+	WorkingDir string   `json:"workingDir,omitempty"` // 省略時はイメージの既定値
+	User       string   `json:"user,omitempty"`       // 省略時はコンテナの既定ユーザー
+}
+
+// ExecResult はコマンドの実行結果を表す。
+type ExecResult struct {
+	ExitCode  int    `json:"exitCode"` // タイムアウト等で終了コードが得られなかった場合は -1
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"`
+	TimedOut  bool   `json:"timedOut,omitempty"`
+}
+
+// MARK: Exec()
+// コンテナ内に一時的なプロセスを生成し、終了まで待機して出力と終了コードを返す。
+// ctx がキャンセルされた場合は出力の待機を打ち切り、それまでに得られた出力を TimedOut 付きで返す。
+// なお Docker API には Exec プロセスを停止する手段が無いため、プロセス自体はコンテナ内で継続し得る。
+func Exec(ctx context.Context, id string, req ExecRequest) (ExecResult, error) {
+	result := ExecResult{ExitCode: -1}
+	if len(req.Cmd) == 0 {
+		return result, errors.New("command is empty")
+	}
+
+	cli, err := ForServer(id)
+	if err != nil {
+		return result, err
+	}
+	ref, err := Ref(ctx, id)
+	if err != nil {
+		return result, err
+	}
+
+	// 標準出力と標準エラーを区別して取得するため、TTY は割り当てない。
+	resp, err := cli.ContainerExecCreate(ctx, ref, container.ExecOptions{
+		Cmd:          req.Cmd,
+		Env:          req.Env,
+		WorkingDir:   req.WorkingDir,
+		User:         req.User,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	attach, err := cli.ContainerExecAttach(ctx, resp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return result, err
+	}
+	defer attach.Close()
+
+	stdout := &limitedBuffer{limit: maxExecOutput}
+	stderr := &limitedBuffer{limit: maxExecOutput}
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, attach.Reader)
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// 接続を閉じて読み出し中のゴルーチンを解放する。
+		attach.Close()
+		<-done
+		result.TimedOut = true
+	}
+
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+	if result.TimedOut {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, resp.ID)
+	if err != nil {
+		return result, err
+	}
+	result.ExitCode = inspect.ExitCode
+	return result, nil
+}
+
+// limitedBuffer は上限を超えた書き込みを黙って破棄するバッファ。
+// 書き込みエラーを返すと StdCopy が中断されてしまうため、常に成功として扱う。
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string { return b.buf.String() }
+
+// exitError は非ゼロ終了時に、原因調査のため標準エラーの末尾を含めたエラーを生成する。
+func exitError(result ExecResult) error {
+	msg := result.Stderr
+	if len(msg) > 512 {
+		msg = msg[len(msg)-512:]
+	}
+	if msg == "" {
+		return fmt.Errorf("command exited with code %d", result.ExitCode)
+	}
+	return fmt.Errorf("command exited with code %d: %s", result.ExitCode, strings.TrimSpace(msg))
+}
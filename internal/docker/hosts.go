@@ -0,0 +1,222 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+// hostClient は名前付きホスト向けに生成済みのクライアントと、その生成元の設定を保持する。
+type hostClient struct {
+	cfg    config.DockerHostConfig
+	client *client.Client
+}
+
+var (
+	// loadedConfig はサーバー名からホストを解決するために参照する設定。Init 時に注入される。
+	loadedConfig *config.LoadedConfig
+
+	hostClients   = make(map[string]*hostClient)
+	hostClientsMu sync.Mutex
+)
+
+// MARK: ForServer()
+// サーバー設定の host 指定に従い、そのサーバーを管理する Docker デーモンのクライアントを返す。
+// 設定に存在しないサーバー（未管理コンテナ）は既定のクライアントで扱う。
+func ForServer(serverName string) (*client.Client, error) {
+	if loadedConfig == nil {
+		return defaultClient()
+	}
+	serverCfg, ok := loadedConfig.Get().Servers[serverName]
+	if !ok {
+		return defaultClient()
+	}
+	return ForHost(serverCfg.Host)
+}
+
+// MARK: ForHost()
+// 名前付きホストのクライアントを返す。空文字は既定のクライアントを意味する。
+// 設定が変更された場合は、古いクライアントを破棄して再生成する。
+func ForHost(hostName string) (*client.Client, error) {
+	if hostName == "" {
+		return defaultClient()
+	}
+	if loadedConfig == nil {
+		return nil, fmt.Errorf("docker host %q is not configured", hostName)
+	}
+	hostCfg, ok := loadedConfig.Get().DockerHosts[hostName]
+	if !ok {
+		return nil, fmt.Errorf("docker host %q is not configured", hostName)
+	}
+
+	hostClientsMu.Lock()
+	defer hostClientsMu.Unlock()
+
+	if hc, ok := hostClients[hostName]; ok {
+		if sameHostConfig(hc.cfg, hostCfg) {
+			return hc.client, nil
+		}
+		// 接続先が変更されたため、古い接続を閉じて作り直す。
+		hc.client.Close()
+		delete(hostClients, hostName)
+		logger.Warnf("Internal", "Docker", "ホスト設定の変更を検知しました。再接続します: %s", hostName)
+	}
+
+	cli, err := newHostClient(hostCfg)
+	if err != nil {
+		logger.Errorf("Internal", "Docker", "ホスト %s のクライアント初期化失敗: %v", hostName, err)
+		return nil, fmt.Errorf("failed to initialize docker host %q: %w", hostName, err)
+	}
+	hostClients[hostName] = &hostClient{cfg: hostCfg, client: cli}
+	logger.Logf("Internal", "Docker", "ホスト %s のクライアントを初期化しました: %s", hostName, hostCfg.Host)
+	return cli, nil
+}
+
+// MARK: HostOf()
+// サーバーが所属する dockerHosts 名を返す。既定ホストおよび未管理コンテナは空文字。
+func HostOf(serverName string) string {
+	if loadedConfig == nil {
+		return ""
+	}
+	return loadedConfig.Get().Servers[serverName].Host
+}
+
+// MARK: HostNames()
+// 既定のホスト（空文字）を含む、設定済みの全ホスト名を返す。
+func HostNames() []string {
+	names := []string{""}
+	if loadedConfig == nil {
+		return names
+	}
+	for name := range loadedConfig.Get().DockerHosts {
+		names = append(names, name)
+	}
+	return names
+}
+
+// MARK: IsLocal()
+// サーバーのコンテナがこのマシン上のデーモンで動作しているかを判定する。
+// バインドマウントのパスはデーモン側のファイルシステムを指すため、ファイル操作やバックアップの可否判断に使用する。
+func IsLocal(serverName string) bool {
+	if loadedConfig == nil {
+		return true
+	}
+	cfg := loadedConfig.Get()
+	hostName := cfg.Servers[serverName].Host
+	if hostName == "" {
+		return true
+	}
+	hostCfg, ok := cfg.DockerHosts[hostName]
+	return ok && (hostCfg.Host == "" || strings.HasPrefix(hostCfg.Host, "unix://") || strings.HasPrefix(hostCfg.Host, "npipe://"))
+}
+
+func defaultClient() (*client.Client, error) {
+	if Client == nil {
+		return nil, fmt.Errorf("docker client is not initialized")
+	}
+	return Client, nil
+}
+
+func sameHostConfig(a, b config.DockerHostConfig) bool {
+	if a.Host != b.Host || (a.TLS == nil) != (b.TLS == nil) {
+		return false
+	}
+	return a.TLS == nil || *a.TLS == *b.TLS
+}
+
+// MARK: newHostClient()
+// 接続先 URL のスキームに応じて、unix ソケット / TCP(+TLS) / SSH 経由のクライアントを生成する。
+func newHostClient(cfg config.DockerHostConfig) (*client.Client, error) {
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+
+	u, err := url.Parse(cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "ssh":
+		// SSH 接続はリモート側の `docker system dial-stdio` を介して API を中継する（docker CLI と同じ方式）。
+		// HTTP のホスト名はダミーで、実際の通信は全てダイアラーが確立した SSH セッションを通る。
+		target := u.Host
+		if u.User != nil {
+			target = u.User.String() + "@" + u.Host
+		}
+		opts = append(opts,
+			client.WithHost("http://docker.example.com"),
+			client.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialSSH(ctx, target)
+			}),
+		)
+	default:
+		opts = append(opts, client.WithHost(cfg.Host))
+		if cfg.TLS != nil {
+			opts = append(opts, client.WithTLSClientConfig(cfg.TLS.CA, cfg.TLS.Cert, cfg.TLS.Key))
+		}
+	}
+
+	return client.NewClientWithOpts(opts...)
+}
+
+// MARK: dialSSH()
+// ssh コマンドを子プロセスとして起動し、その標準入出力を net.Conn として扱えるようにする。
+// 認証はホストの ssh 設定（鍵、~/.ssh/config）に委ねる。
+func dialSSH(ctx context.Context, target string) (net.Conn, error) {
+	cmd := exec.Command("ssh", "-T", "-o", "ConnectTimeout=30", "--", target, "docker", "system", "dial-stdio")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, target: target}, nil
+}
+
+// MARK: commandConn
+// 子プロセスの標準入出力を net.Conn として振る舞わせるためのアダプター。
+type commandConn struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	target    string
+	closeOnce sync.Once
+}
+
+func (c *commandConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *commandConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.cmd.Wait()
+	})
+	return nil
+}
+func (c *commandConn) LocalAddr() net.Addr                { return dummyAddr("local") }
+func (c *commandConn) RemoteAddr() net.Addr               { return dummyAddr(c.target) }
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dummyAddr string
+
+func (a dummyAddr) Network() string { return "ssh" }
+func (a dummyAddr) String() string  { return string(a) }
@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	// inspectCacheTTL は取得した詳細情報を再利用する期間。
+	// 状態の変化は Docker イベントで即座に破棄するため、これはイベントを取りこぼした場合の上限となる。
+	inspectCacheTTL = 5 * time.Second
+	// inspectNotFoundTTL は存在しないコンテナの結果を再利用する期間。作成は create イベントでも破棄される。
+	inspectNotFoundTTL = 2 * time.Second
+)
+
+// inspectEntry はキャッシュされた 1 件の詳細情報、または存在しなかったという結果。
+type inspectEntry struct {
+	host     string
+	id       string // コンテナ ID。存在しなかった結果の場合は空文字
+	inspect  container.InspectResponse
+	err      error
+	expireAt time.Time
+}
+
+// MARK: InspectCache
+// 名前または ID からコンテナの詳細情報 (ContainerInspect) への解決結果を短時間保持する。
+// 認可チェックやファイルアクセスのたびにデーモンへ問い合わせることによる遅延と負荷を抑える。
+type InspectCache struct {
+	entries   map[string]*inspectEntry // キーは "ホスト名\x00名前または ID"
+	gen       uint64                   // イベントによる破棄のたびに加算する。問い合わせ中に破棄された結果を保存しないために使用する
+	lastSweep time.Time
+	mu        sync.Mutex
+	startOnce sync.Once
+}
+
+var (
+	// Inspects はプロセス全体で共有されるコンテナ詳細情報のキャッシュ。
+	Inspects = &InspectCache{entries: make(map[string]*inspectEntry)}
+)
+
+func inspectKey(host, ref string) string {
+	return host + "\x00" + ref
+}
+
+// MARK: Start()
+// Docker イベントを購読し、状態が変化したコンテナのキャッシュを破棄するループをバックグラウンドで開始する。
+// 複数回呼び出しても起動は一度のみ。
+func (c *InspectCache) Start() {
+	c.startOnce.Do(func() {
+		events, _ := Events.Subscribe()
+		go func() {
+			for ev := range events {
+				c.invalidate(ev)
+			}
+		}()
+	})
+}
+
+// MARK: Inspect()
+// サーバー名 (またはコンテナ ID) のコンテナの詳細情報を返す。有効期間内の結果があればデーモンへ問い合わせない。
+// 設定のサーバーの場合、同じ名前のコンテナが play-bin の作成したものでなければ ErrNotOwned を返す。
+// 返される値は他の呼び出し元と共有されるため、変更しないこと。
+func (c *InspectCache) Inspect(ctx context.Context, serverName string) (container.InspectResponse, error) {
+	inspect, err := c.InspectOnHost(ctx, HostOf(serverName), ContainerName(serverName))
+	if err == nil && managed(serverName) {
+		if err := checkOwned(inspect, serverName); err != nil {
+			return container.InspectResponse{}, err
+		}
+	}
+	return inspect, err
+}
+
+// MARK: InspectOnHost()
+// 指定した dockerHosts 上のコンテナの詳細情報を返す。コンテナ一覧の項目のように、所属ホストが既知の場合に使用する。
+func (c *InspectCache) InspectOnHost(ctx context.Context, host, ref string) (container.InspectResponse, error) {
+	key := inspectKey(host, ref)
+	now := time.Now()
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expireAt) {
+		c.mu.Unlock()
+		return e.inspect, e.err
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	cli, err := ForHost(host)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	inspect, err := cli.ContainerInspect(ctx, ref)
+	switch {
+	case err == nil:
+		c.store(key, gen, &inspectEntry{host: host, id: inspect.ID, inspect: inspect, expireAt: now.Add(inspectCacheTTL)})
+	case errdefs.IsNotFound(err):
+		c.store(key, gen, &inspectEntry{host: host, err: err, expireAt: now.Add(inspectNotFoundTTL)})
+	}
+	// 接続エラー等の一時的な失敗は保持せず、次の呼び出しで再度問い合わせる。
+	return inspect, err
+}
+
+// MARK: Name()
+// サーバー名 (またはコンテナ ID) から、権限の判定に使用する名前を解決する。
+// play-bin が作成したコンテナはサーバー名 (所有ラベルの値)、それ以外は先頭の '/' を除いた Docker 上のコンテナ名を返す。
+func (c *InspectCache) Name(ctx context.Context, serverName string) (string, error) {
+	inspect, err := c.Inspect(ctx, serverName)
+	if err != nil {
+		return "", err
+	}
+	if inspect.Config != nil && inspect.Config.Labels[OwnerLabel] != "" {
+		return inspect.Config.Labels[OwnerLabel], nil
+	}
+	return inspect.Name[1:], nil
+}
+
+// store は結果を保存し、期限切れの項目を一定間隔で破棄してメモリ使用量を抑える。
+// 問い合わせ中にイベントで破棄が行われた場合は、変化前の状態である可能性があるため保存しない。
+func (c *InspectCache) store(key string, gen uint64, e *inspectEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	c.entries[key] = e
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+	for k, e := range c.entries {
+		if now.After(e.expireAt) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// invalidate はイベントが発生したコンテナに関する項目を破棄する。
+// 名前での参照と ID での参照の双方を対象とし、rename の場合は変更前の名前も対象とする。
+func (c *InspectCache) invalidate(ev ContainerEvent) {
+	refs := []string{ev.ID, ev.Name}
+	if oldName, ok := ev.Attributes["oldName"]; ok {
+		// oldName は先頭に '/' を含む。
+		refs = append(refs, oldName, oldName[min(1, len(oldName)):])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, ref := range refs {
+		if ref != "" {
+			delete(c.entries, inspectKey(ev.Host, ref))
+		}
+	}
+	for k, e := range c.entries {
+		if e.host == ev.Host && e.id != "" && e.id == ev.ID {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// OwnerLabel は play-bin が作成したコンテナに付けるラベル。値はサーバー名。
+// 同じ名前の play-bin の管理外のコンテナを、起動・停止・削除等の操作の対象としないために使用する。
+const OwnerLabel = "play-bin.server"
+
+// ErrNotOwned は同じ名前のコンテナが存在するが、play-bin が作成したものではないことを示す。
+var ErrNotOwned = errors.New("container was not created by play-bin")
+
+// MARK: ContainerName()
+// サーバーのコンテナの Docker 上の名前を返す。設定の containerPrefix をサーバー名の前に付ける。
+// ForServer と同じく、設定に存在しないサーバー (未管理コンテナの名前または ID) はそのまま返す。
+func ContainerName(serverName string) string {
+	if !managed(serverName) {
+		return serverName
+	}
+	return loadedConfig.Get().ContainerName(serverName)
+}
+
+// managed はサーバー名が設定に存在するかを返す。
+func managed(serverName string) bool {
+	if loadedConfig == nil {
+		return false
+	}
+	_, ok := loadedConfig.Get().Servers[serverName]
+	return ok
+}
+
+// MARK: Ref()
+// サーバー名 (またはコンテナ ID) を Docker API に渡す参照へ変換する。
+// 設定のサーバーの場合は play-bin が作成したコンテナであることを確認し、そのコンテナ ID を返す。
+func Ref(ctx context.Context, id string) (string, error) {
+	if !managed(id) {
+		return id, nil
+	}
+	inspect, err := Inspects.Inspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return inspect.ID, nil
+}
+
+// MARK: Owned()
+// コンテナがサーバーのコンテナとして play-bin が作成したもの (所有ラベルの値がサーバー名と一致する) かを返す。
+// 所有ラベルの導入前に作成したコンテナは、LegacyOwned の条件を満たせばサーバーのコンテナとして扱う。
+func Owned(inspect container.InspectResponse, serverName string) bool {
+	var labels map[string]string
+	if inspect.Config != nil {
+		labels = inspect.Config.Labels
+	}
+	return OwnedBy(labels, strings.TrimPrefix(inspect.Name, "/"), serverName)
+}
+
+// MARK: OwnedBy()
+// ラベルと Docker 上の名前から、コンテナがサーバーのコンテナであるかを返す。コンテナ一覧の項目の判定に使用する。
+func OwnedBy(labels map[string]string, containerName, serverName string) bool {
+	if owner, ok := labels[OwnerLabel]; ok {
+		return owner == serverName
+	}
+	return LegacyOwned(containerName, serverName)
+}
+
+// MARK: LegacyOwned()
+// 所有ラベルの無いコンテナを、以前のバージョンで作成したサーバーのコンテナとして扱うかを返す。
+// strictOwnership が無効で、containerPrefix を使用せず、名前がサーバー名と完全に一致する場合に限る。
+func LegacyOwned(containerName, serverName string) bool {
+	if loadedConfig == nil || containerName != serverName {
+		return false
+	}
+	cfg := loadedConfig.Get()
+	if _, ok := cfg.Servers[serverName]; !ok {
+		return false
+	}
+	return !cfg.StrictOwnership && cfg.ContainerPrefix == ""
+}
+
+// MARK: InspectOwned()
+// サーバーのコンテナの詳細情報を返す。存在しない場合は Docker の NotFound のエラー、
+// play-bin が作成したものではない場合は ErrNotOwned を返し、呼び出し元はそのコンテナを操作しない。
+func InspectOwned(ctx context.Context, cli *client.Client, serverName string) (container.InspectResponse, error) {
+	name := ContainerName(serverName)
+	inspect, err := cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return inspect, err
+	}
+	return inspect, checkOwned(inspect, serverName)
+}
+
+// checkOwned は play-bin が作成したコンテナではない場合に ErrNotOwned を返す。
+func checkOwned(inspect container.InspectResponse, serverName string) error {
+	if Owned(inspect, serverName) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s (missing label %s=%s)", ErrNotOwned, ContainerName(serverName), OwnerLabel, serverName)
+}
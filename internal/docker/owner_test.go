@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/play-bin/internal/config"
+)
+
+// useConfig は configJSON の設定をパッケージの設定として使用する。
+func useConfig(t *testing.T, configJSON string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(configJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.LoadedConfig{Path: path}
+	cfg.Reload()
+	prev := loadedConfig
+	loadedConfig = cfg
+	t.Cleanup(func() { loadedConfig = prev })
+}
+
+func inspectOf(name string, labels map[string]string) container.InspectResponse {
+	inspect := container.InspectResponse{Config: &container.Config{Labels: labels}}
+	inspect.ContainerJSONBase = &container.ContainerJSONBase{Name: "/" + name}
+	return inspect
+}
+
+func TestOwned(t *testing.T) {
+	useConfig(t, `{"servers": {"mc": {}}, "users": {}}`)
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"mc", map[string]string{OwnerLabel: "mc"}, true},
+		{"mc", map[string]string{OwnerLabel: "other"}, false},
+		// 所有ラベルの導入前に作成したコンテナは、名前が一致すれば引き続き操作できる。
+		{"mc", nil, true},
+		{"mc-old", nil, false},
+	}
+	for _, tt := range tests {
+		if got := Owned(inspectOf(tt.name, tt.labels), "mc"); got != tt.want {
+			t.Errorf("Owned(%s, %v) = %v, want %v", tt.name, tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestOwnedStrict(t *testing.T) {
+	useConfig(t, `{"strictOwnership": true, "servers": {"mc": {}}, "users": {}}`)
+	if Owned(inspectOf("mc", nil), "mc") {
+		t.Error("unlabeled container is owned with strictOwnership")
+	}
+	if !Owned(inspectOf("mc", map[string]string{OwnerLabel: "mc"}), "mc") {
+		t.Error("labeled container is not owned with strictOwnership")
+	}
+}
+
+func TestOwnedWithPrefix(t *testing.T) {
+	useConfig(t, `{"containerPrefix": "playbin-", "servers": {"mc": {}}, "users": {}}`)
+	// 接頭辞を使用する場合、接頭辞の無い同名のコンテナは以前のバージョンのものとは限らない。
+	if Owned(inspectOf("mc", nil), "mc") || Owned(inspectOf("playbin-mc", nil), "mc") {
+		t.Error("unlabeled container is owned with containerPrefix")
+	}
+}
@@ -0,0 +1,218 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// 削除の対象となる資源の種類。
+const (
+	PruneImages     = "images"     // タグを持たない (dangling) イメージ
+	PruneContainers = "containers" // 停止中の、play-bin が管理していないコンテナ
+	PruneNetworks   = "networks"   // コンテナから使用されていないネットワーク
+	PruneBuildCache = "buildCache" // 使用されていないビルドキャッシュ
+)
+
+// PruneTargets は指定できる全ての種類。
+var PruneTargets = []string{PruneImages, PruneContainers, PruneNetworks, PruneBuildCache}
+
+// builtinNetworks は Docker が作成し、削除できないネットワーク。
+var builtinNetworks = []string{"bridge", "host", "none"}
+
+// MARK: PruneItems
+// 種類ごとの削除 (dryRun では削除候補) の結果。
+type PruneItems struct {
+	Count int      `json:"count"`
+	Space uint64   `json:"space"` // 回収した (dryRun では回収できる見込みの) 容量 (bytes)
+	Items []string `json:"items"` // 削除したイメージ ID・コンテナ名・ネットワーク名等
+}
+
+// MARK: PruneReport
+// 資源の削除の結果。
+type PruneReport struct {
+	DryRun  bool                  `json:"dryRun"`
+	Targets map[string]PruneItems `json:"targets"`
+	Space   uint64                `json:"space"`            // 全種類の合計
+	Errors  []string              `json:"errors,omitempty"` // 削除できなかったもの (使用中になった等)
+}
+
+// MARK: Prune()
+// 指定した種類の未使用の資源を削除する。managed に一致する名前のコンテナと play-bin が作成したコンテナ (所有ラベル付き) は、停止中でも削除しない。
+// dryRun では削除せずに、削除の候補と回収できる容量の見込みを返す。
+func Prune(ctx context.Context, cli *client.Client, targets []string, managed func(name string) bool, dryRun bool) (PruneReport, error) {
+	report := PruneReport{DryRun: dryRun, Targets: make(map[string]PruneItems)}
+	for _, t := range targets {
+		var items PruneItems
+		var err error
+		switch t {
+		case PruneImages:
+			items, err = pruneImages(ctx, cli, dryRun)
+		case PruneContainers:
+			items, err = pruneContainers(ctx, cli, managed, dryRun, &report)
+		case PruneNetworks:
+			items, err = pruneNetworks(ctx, cli, dryRun)
+		case PruneBuildCache:
+			items, err = pruneBuildCache(ctx, cli, dryRun)
+		default:
+			return report, fmt.Errorf("unknown prune target %q (expected one of %s)", t, strings.Join(PruneTargets, ", "))
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", t, err)
+		}
+		if items.Items == nil {
+			items.Items = []string{}
+		}
+		report.Targets[t] = items
+		report.Space += items.Space
+	}
+	return report, nil
+}
+
+// pruneImages はタグを持たないイメージを削除する。見込みの容量は、他のイメージと共有する層も含むため実際より大きくなる場合がある。
+func pruneImages(ctx context.Context, cli *client.Client, dryRun bool) (PruneItems, error) {
+	dangling := filters.NewArgs(filters.Arg("dangling", "true"))
+	if !dryRun {
+		r, err := cli.ImagesPrune(ctx, dangling)
+		if err != nil {
+			return PruneItems{}, err
+		}
+		items := PruneItems{Space: r.SpaceReclaimed}
+		for _, d := range r.ImagesDeleted {
+			if d.Deleted != "" {
+				items.Items = append(items.Items, d.Deleted)
+			}
+		}
+		items.Count = len(items.Items)
+		return items, nil
+	}
+
+	images, err := cli.ImageList(ctx, image.ListOptions{Filters: dangling})
+	if err != nil {
+		return PruneItems{}, err
+	}
+	var items PruneItems
+	for _, img := range images {
+		// コンテナから参照されているイメージは削除されない。
+		if img.Containers > 0 {
+			continue
+		}
+		items.Items = append(items.Items, img.ID)
+		items.Space += uint64(max(img.Size, 0))
+	}
+	items.Count = len(items.Items)
+	return items, nil
+}
+
+// pruneContainers は停止中のコンテナのうち、play-bin が管理していないものを 1 件ずつ削除する。
+// 管理対象のサーバーは停止中でもコンテナを残して状態を保つため、一括削除 (ContainersPrune) は用いない。
+func pruneContainers(ctx context.Context, cli *client.Client, managed func(string) bool, dryRun bool, report *PruneReport) (PruneItems, error) {
+	list, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Size:    true,
+		Filters: filters.NewArgs(filters.Arg("status", "created"), filters.Arg("status", "exited"), filters.Arg("status", "dead")),
+	})
+	if err != nil {
+		return PruneItems{}, err
+	}
+	var items PruneItems
+	for _, c := range list {
+		name := c.ID[:min(12, len(c.ID))]
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		if c.Labels[OwnerLabel] != "" || (managed != nil && managed(name)) {
+			continue
+		}
+		if !dryRun {
+			if err := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{}); err != nil {
+				if !errdefs.IsNotFound(err) {
+					report.Errors = append(report.Errors, fmt.Sprintf("container %s: %v", name, err))
+				}
+				continue
+			}
+		}
+		items.Items = append(items.Items, name)
+		items.Space += uint64(max(c.SizeRw, 0))
+	}
+	items.Count = len(items.Items)
+	return items, nil
+}
+
+// pruneNetworks はコンテナから使用されていない、利用者が作成したネットワークを削除する。
+func pruneNetworks(ctx context.Context, cli *client.Client, dryRun bool) (PruneItems, error) {
+	if !dryRun {
+		r, err := cli.NetworksPrune(ctx, filters.NewArgs())
+		if err != nil {
+			return PruneItems{}, err
+		}
+		return PruneItems{Count: len(r.NetworksDeleted), Items: r.NetworksDeleted}, nil
+	}
+
+	networks, err := cli.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return PruneItems{}, err
+	}
+	// 一覧はネットワークに接続したコンテナを含まないため、停止中を含む全てのコンテナから使用中のネットワークを求める。
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return PruneItems{}, err
+	}
+	used := make(map[string]bool)
+	for _, c := range containers {
+		if c.NetworkSettings == nil {
+			continue
+		}
+		for name, ep := range c.NetworkSettings.Networks {
+			used[name] = true
+			if ep != nil {
+				used[ep.NetworkID] = true
+			}
+		}
+	}
+	var items PruneItems
+	for _, n := range networks {
+		if slices.Contains(builtinNetworks, n.Name) || used[n.Name] || used[n.ID] {
+			continue
+		}
+		items.Items = append(items.Items, n.Name)
+	}
+	items.Count = len(items.Items)
+	return items, nil
+}
+
+// pruneBuildCache は使用されていないビルドキャッシュを削除する。docker builder prune と同じく、共有されたキャッシュは残す。
+func pruneBuildCache(ctx context.Context, cli *client.Client, dryRun bool) (PruneItems, error) {
+	if !dryRun {
+		r, err := cli.BuildCachePrune(ctx, build.CachePruneOptions{})
+		if err != nil {
+			return PruneItems{}, err
+		}
+		return PruneItems{Count: len(r.CachesDeleted), Space: r.SpaceReclaimed, Items: r.CachesDeleted}, nil
+	}
+
+	du, err := cli.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.BuildCacheObject}})
+	if err != nil {
+		return PruneItems{}, err
+	}
+	var items PruneItems
+	for _, c := range du.BuildCache {
+		if c.InUse || c.Shared {
+			continue
+		}
+		items.Items = append(items.Items, c.ID)
+		items.Space += uint64(max(c.Size, 0))
+	}
+	items.Count = len(items.Items)
+	return items, nil
+}
@@ -0,0 +1,116 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+// dockerHubAliases は Docker Hub を指す別名。設定上はいずれのキーでも同一レジストリとして扱う。
+var dockerHubAliases = []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+// MARK: RegistryAuth()
+// イメージ参照からレジストリを特定し、設定済みの認証情報を X-Registry-Auth 形式で返す。
+// 該当する認証情報が無い場合は空文字を返す（匿名でのプルとなる）。
+func RegistryAuth(ref string) (string, error) {
+	if loadedConfig == nil {
+		return "", nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", ref, err)
+	}
+	domain := reference.Domain(named)
+
+	registries := loadedConfig.Get().Registries
+	regCfg, ok := registries[domain]
+	serverAddress := domain
+	if domain == "docker.io" {
+		// Docker Hub はレジストリ側の認証エンドポイントが異なるため、慣例的なアドレスを使用する。
+		serverAddress = "https://index.docker.io/v1/"
+		for _, alias := range dockerHubAliases {
+			if regCfg, ok = registries[alias]; ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return "", nil
+	}
+
+	auth, err := resolveRegistryAuth(regCfg)
+	if err != nil {
+		return "", fmt.Errorf("registry %s: %w", domain, err)
+	}
+	auth.ServerAddress = serverAddress
+	return registry.EncodeAuthConfig(auth)
+}
+
+// resolveRegistryAuth は設定値とファイル参照から、実際に送信する認証情報を組み立てる。
+func resolveRegistryAuth(cfg config.RegistryConfig) (registry.AuthConfig, error) {
+	auth := registry.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		IdentityToken: cfg.IdentityToken,
+	}
+	if cfg.PasswordFile != "" {
+		b, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return auth, fmt.Errorf("failed to read passwordFile: %w", err)
+		}
+		auth.Password = strings.TrimSpace(string(b))
+	}
+	if cfg.IdentityTokenFile != "" {
+		b, err := os.ReadFile(cfg.IdentityTokenFile)
+		if err != nil {
+			return auth, fmt.Errorf("failed to read identityTokenFile: %w", err)
+		}
+		auth.IdentityToken = strings.TrimSpace(string(b))
+	}
+	return auth, nil
+}
+
+// MARK: RegistryAuthConfigs()
+// ビルド時のベースイメージ取得に使用するため、設定済みの全レジストリの認証情報を返す。
+func RegistryAuthConfigs() map[string]registry.AuthConfig {
+	result := make(map[string]registry.AuthConfig)
+	if loadedConfig == nil {
+		return result
+	}
+	for domain, regCfg := range loadedConfig.Get().Registries {
+		auth, err := resolveRegistryAuth(regCfg)
+		if err != nil {
+			logger.Errorf("Internal", "Docker", "レジストリ %s の認証情報の読み込みに失敗: %v", domain, err)
+			continue
+		}
+		serverAddress := domain
+		for _, alias := range dockerHubAliases {
+			if domain == alias {
+				serverAddress = "https://index.docker.io/v1/"
+			}
+		}
+		auth.ServerAddress = serverAddress
+		result[serverAddress] = auth
+	}
+	return result
+}
+
+// MARK: PullImage()
+// レジストリ認証情報を付与してイメージのプルを開始し、Docker の進捗メッセージ列を返す。
+func PullImage(ctx context.Context, cli *client.Client, ref string) (io.ReadCloser, error) {
+	auth, err := RegistryAuth(ref)
+	if err != nil {
+		return nil, err
+	}
+	return cli.ImagePull(ctx, ref, image.PullOptions{RegistryAuth: auth})
+}
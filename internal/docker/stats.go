@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// MARK: ComputedStats
+// Docker の生統計値から算出した、クライアントがそのまま表示に使える正規化済みの指標。
+type ComputedStats struct {
+	CPUPercent     float64 `json:"cpu_percent"`      // 1コア=100% 換算のコンテナ CPU 使用率
+	OnlineCPUs     uint32  `json:"online_cpus"`      // コンテナから見えるCPU数
+	MemoryUsage    uint64  `json:"memory_usage"`     // ページキャッシュを除いた実使用量 (bytes)
+	MemoryLimit    uint64  `json:"memory_limit"`     // メモリ上限 (bytes)
+	MemoryPercent  float64 `json:"memory_percent"`   // 上限に対する使用率
+	NetworkRx      uint64  `json:"network_rx"`       // 全インターフェースの累計受信量 (bytes)
+	NetworkTx      uint64  `json:"network_tx"`       // 全インターフェースの累計送信量 (bytes)
+	NetworkRxRate  float64 `json:"network_rx_rate"`  // 受信レート (bytes/sec)
+	NetworkTxRate  float64 `json:"network_tx_rate"`  // 送信レート (bytes/sec)
+	BlockRead      uint64  `json:"block_read"`       // 累計ディスク読込量 (bytes)
+	BlockWrite     uint64  `json:"block_write"`      // 累計ディスク書込量 (bytes)
+	BlockReadRate  float64 `json:"block_read_rate"`  // 読込レート (bytes/sec)
+	BlockWriteRate float64 `json:"block_write_rate"` // 書込レート (bytes/sec)
+}
+
+// MARK: StatsCalculator
+// ストリーム形式の統計情報から、前回サンプルとの差分を用いてレート系の指標を算出する。
+// 1 本のストリームにつき 1 インスタンスを使用する（スレッドセーフではない）。
+type StatsCalculator struct {
+	prev   *ComputedStats
+	prevAt time.Time
+}
+
+// MARK: Compute()
+// Docker CLI (docker stats) と同等の計算式で CPU・メモリ使用率を求め、I/O レートを付与する。
+func (c *StatsCalculator) Compute(s container.StatsResponse) ComputedStats {
+	out := ComputedStats{
+		OnlineCPUs:  s.CPUStats.OnlineCPUs,
+		MemoryLimit: s.MemoryStats.Limit,
+	}
+
+	// オンラインCPU数が報告されない古いカーネル向けに、コア別使用量の要素数で代替する。
+	if out.OnlineCPUs == 0 {
+		out.OnlineCPUs = uint32(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if out.OnlineCPUs == 0 {
+		out.OnlineCPUs = 1
+	}
+
+	// CPU 使用率は、前回サンプルからのコンテナ使用時間とシステム全体の経過時間の比率で求める。
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	sysDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && sysDelta > 0 {
+		out.CPUPercent = cpuDelta / sysDelta * float64(out.OnlineCPUs) * 100
+	}
+
+	// メモリ使用量は、解放可能なページキャッシュ分を差し引いた値を「実使用量」とする。
+	out.MemoryUsage = s.MemoryStats.Usage
+	if v, ok := s.MemoryStats.Stats["total_inactive_file"]; ok && v < out.MemoryUsage {
+		// cgroup v1
+		out.MemoryUsage -= v
+	} else if v, ok := s.MemoryStats.Stats["inactive_file"]; ok && v < out.MemoryUsage {
+		// cgroup v2
+		out.MemoryUsage -= v
+	}
+	if out.MemoryLimit > 0 {
+		out.MemoryPercent = float64(out.MemoryUsage) / float64(out.MemoryLimit) * 100
+	}
+
+	// ネットワーク・ブロックI/Oは累計値のため、全インターフェース・全デバイス分を合算する。
+	for _, n := range s.Networks {
+		out.NetworkRx += n.RxBytes
+		out.NetworkTx += n.TxBytes
+	}
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			out.BlockRead += e.Value
+		case "write":
+			out.BlockWrite += e.Value
+		}
+	}
+
+	// 前回サンプルとの差分から秒間レートを求める。初回やカウンタのリセット時は 0 とする。
+	at := s.Read
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if c.prev != nil {
+		if elapsed := at.Sub(c.prevAt).Seconds(); elapsed > 0 {
+			out.NetworkRxRate = rate(c.prev.NetworkRx, out.NetworkRx, elapsed)
+			out.NetworkTxRate = rate(c.prev.NetworkTx, out.NetworkTx, elapsed)
+			out.BlockReadRate = rate(c.prev.BlockRead, out.BlockRead, elapsed)
+			out.BlockWriteRate = rate(c.prev.BlockWrite, out.BlockWrite, elapsed)
+		}
+	}
+	prev := out
+	c.prev = &prev
+	c.prevAt = at
+
+	return out
+}
+
+// rate は累計カウンタの差分を秒間レートに換算する。カウンタが巻き戻った場合は 0 を返す。
+func rate(prev, cur uint64, elapsed float64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / elapsed
+}
+
+// MARK: StatsSnapshot()
+// ストリームを開かずに 1 回分の統計情報を取得して算出する。Docker は前回サンプルを含めて返すため、CPU 使用率も求められる。
+// レート系の指標は前回の算出結果が無いため 0 となる。
+func StatsSnapshot(ctx context.Context, cli *client.Client, id string) (ComputedStats, error) {
+	resp, err := cli.ContainerStats(ctx, id, false)
+	if err != nil {
+		return ComputedStats{}, err
+	}
+	defer resp.Body.Close()
+	var s container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return ComputedStats{}, err
+	}
+	var c StatsCalculator
+	return c.Compute(s), nil
+}
+
+// MARK: WithRates()
+// elapsed 前に取得した prev との差分から、スナップショットでは 0 となるレート系の指標を求めて返す。
+// 定期的に StatsSnapshot を取得する場合に、ストリームを開かずにレートを得るために用いる。
+func (s ComputedStats) WithRates(prev ComputedStats, elapsed time.Duration) ComputedStats {
+	if sec := elapsed.Seconds(); sec > 0 {
+		s.NetworkRxRate = rate(prev.NetworkRx, s.NetworkRx, sec)
+		s.NetworkTxRate = rate(prev.NetworkTx, s.NetworkTx, sec)
+		s.BlockReadRate = rate(prev.BlockRead, s.BlockRead, sec)
+		s.BlockWriteRate = rate(prev.BlockWrite, s.BlockWrite, sec)
+	}
+	return s
+}
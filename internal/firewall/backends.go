@@ -0,0 +1,158 @@
+package firewall
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/play-bin/internal/config"
+)
+
+// backend はファイアウォールの種類ごとのルールの追加・削除。
+type backend interface {
+	open(ctx context.Context, serverName string, rules []Rule) error
+	// close はサーバーのルールを削除する。コメントでルールを識別できる場合は rules に依らず全て削除する。
+	close(ctx context.Context, serverName string, rules []Rule) error
+}
+
+// newBackend は設定に応じた backend を返す。
+func newBackend(fw *config.FirewallConfig) backend {
+	r := runner{dryRun: fw.DryRun}
+	switch fw.Backend {
+	case "iptables":
+		return &iptables{runner: r, chain: cmp.Or(fw.Chain, "INPUT")}
+	case "ufw":
+		return &ufw{runner: r}
+	default:
+		family, table, _ := strings.Cut(cmp.Or(fw.Table, "inet filter"), " ")
+		return &nftables{runner: r, family: family, table: strings.TrimSpace(table), chain: cmp.Or(fw.Chain, "input")}
+	}
+}
+
+// MARK: nftables
+// nft でチェインへルールを追加する。ルールにはコメントを付け、削除時はコメントが一致するルールをハンドルで削除する。
+type nftables struct {
+	runner
+	family, table, chain string
+}
+
+func (n *nftables) open(ctx context.Context, serverName string, rules []Rule) error {
+	var errs []error
+	for _, r := range rules {
+		args := []string{"add", "rule", n.family, n.table, n.chain}
+		if r.HostIP != "" {
+			family := "ip"
+			if r.ipv6() {
+				family = "ip6"
+			}
+			args = append(args, family, "daddr", r.HostIP)
+		}
+		args = append(args, r.Protocol, "dport", r.ports("-"), "accept", "comment", `"`+commentPrefix+serverName+`"`)
+		errs = append(errs, n.change(ctx, "nft", args...))
+	}
+	return errors.Join(errs...)
+}
+
+func (n *nftables) close(ctx context.Context, serverName string, _ []Rule) error {
+	out, err := n.query(ctx, "nft", "-a", "list", "chain", n.family, n.table, n.chain)
+	if err != nil {
+		return err
+	}
+	comment := `comment "` + commentPrefix + serverName + `"`
+	var errs []error
+	for _, line := range strings.Split(out, "\n") {
+		_, handle, ok := strings.Cut(line, "# handle ")
+		if !ok || !strings.Contains(line, comment) {
+			continue
+		}
+		errs = append(errs, n.change(ctx, "nft", "delete", "rule", n.family, n.table, n.chain, "handle", strings.TrimSpace(handle)))
+	}
+	return errors.Join(errs...)
+}
+
+// MARK: iptables
+// iptables (IPv6 は ip6tables) でチェインへルールを追加する。削除時はコメントが一致するルールを -S の出力から探して削除する。
+type iptables struct {
+	runner
+	chain string
+}
+
+// commands はルールを適用するコマンドを返す。アドレスを指定しない場合は IPv4 と IPv6 の両方へ適用する。
+func (t *iptables) commands(r Rule) []string {
+	switch {
+	case r.HostIP == "":
+		return []string{"iptables", "ip6tables"}
+	case r.ipv6():
+		return []string{"ip6tables"}
+	default:
+		return []string{"iptables"}
+	}
+}
+
+func (t *iptables) open(ctx context.Context, serverName string, rules []Rule) error {
+	var errs []error
+	for _, r := range rules {
+		args := []string{"-A", t.chain, "-p", r.Protocol}
+		if r.HostIP != "" {
+			args = append(args, "-d", r.HostIP)
+		}
+		args = append(args, "--dport", r.ports(":"), "-m", "comment", "--comment", commentPrefix+serverName, "-j", "ACCEPT")
+		for _, name := range t.commands(r) {
+			errs = append(errs, t.change(ctx, name, args...))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *iptables) close(ctx context.Context, serverName string, _ []Rule) error {
+	var errs []error
+	for _, name := range []string{"iptables", "ip6tables"} {
+		out, err := t.query(ctx, name, "-S", t.chain)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || fields[0] != "-A" {
+				continue
+			}
+			if i := slices.Index(fields, "--comment"); i < 0 || i+1 >= len(fields) || strings.Trim(fields[i+1], `"`) != commentPrefix+serverName {
+				continue
+			}
+			fields[0] = "-D"
+			errs = append(errs, t.change(ctx, name, fields...))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MARK: ufw
+// ufw でポートを許可する。ufw はコメントでルールを削除できないため、開いたルールと同じ指定で削除する。
+type ufw struct {
+	runner
+}
+
+// args は ufw allow / ufw delete allow に続けるルールの指定を返す。
+func (u *ufw) args(r Rule) []string {
+	return []string{"proto", r.Protocol, "from", "any", "to", cmp.Or(r.HostIP, "any"), "port", r.ports(":")}
+}
+
+func (u *ufw) open(ctx context.Context, serverName string, rules []Rule) error {
+	var errs []error
+	for _, r := range rules {
+		args := append([]string{"allow"}, u.args(r)...)
+		errs = append(errs, u.change(ctx, "ufw", append(args, "comment", commentPrefix+serverName)...))
+	}
+	return errors.Join(errs...)
+}
+
+func (u *ufw) close(ctx context.Context, _ string, rules []Rule) error {
+	var errs []error
+	for _, r := range rules {
+		errs = append(errs, u.change(ctx, "ufw", append([]string{"delete", "allow"}, u.args(r)...)...))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,261 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// commandTimeout はファイアウォールのコマンド 1 回あたりの実行時間の上限。
+const commandTimeout = 30 * time.Second
+
+// commentPrefix はルールのコメントの接頭辞。play-bin が追加したルールをサーバーごとに識別し、停止時に削除する。
+const commentPrefix = "play-bin:"
+
+// MARK: Rule
+// ファイアウォールで許可する 1 つのポート (または連続したポートの範囲)。
+type Rule struct {
+	Protocol string // "tcp" または "udp"
+	HostIP   string // 空の場合は全てのアドレス
+	From, To int
+}
+
+// ports はルールのポートを "25565" または "27015-27020" の形式で返す。sep は範囲の区切り文字。
+func (r Rule) ports(sep string) string {
+	if r.From == r.To {
+		return strconv.Itoa(r.From)
+	}
+	return strconv.Itoa(r.From) + sep + strconv.Itoa(r.To)
+}
+
+// ipv6 はルールのアドレスが IPv6 であるかを返す。
+func (r Rule) ipv6() bool {
+	return strings.Contains(r.HostIP, ":")
+}
+
+// MARK: Manager
+// コンテナの起動・停止のイベントを購読し、公開したポートをホストのファイアウォールで開閉する。
+type Manager struct {
+	Config *config.LoadedConfig
+
+	mu     sync.Mutex
+	opened map[string][]Rule // サーバーごとの開いたルール (ufw の削除に使用する)
+}
+
+// MARK: NewManager()
+func NewManager(cfg *config.LoadedConfig) *Manager {
+	return &Manager{Config: cfg, opened: make(map[string][]Rule)}
+}
+
+// MARK: Start()
+// イベントの購読と、稼働中のサーバーのポートの同期を開始する。firewall は再読み込みで有効にできるよう、イベントごとに設定を参照する。
+func (m *Manager) Start() {
+	events, _ := docker.Events.Subscribe()
+	go func() {
+		for ev := range events {
+			if (ev.Action != "start" && ev.Action != "die") || ev.Host != docker.HostOf(ev.Server) {
+				continue
+			}
+			if !m.managed(ev.Server) {
+				continue
+			}
+			if ev.Action == "start" {
+				m.Open(ev.Server)
+			} else {
+				m.Close(ev.Server)
+			}
+		}
+	}()
+	go m.resume()
+}
+
+// resume は play-bin の停止中に起動・停止したサーバーについて、ファイアウォールの状態をコンテナの状態に合わせる。
+func (m *Manager) resume() {
+	cfg := m.Config.Get()
+	for _, serverName := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		if !m.managed(serverName) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		inspect, err := docker.Inspects.Inspect(ctx, serverName)
+		cancel()
+		if err != nil {
+			continue
+		}
+		if inspect.State != nil && inspect.State.Running {
+			m.Open(serverName)
+		} else {
+			m.Close(serverName)
+		}
+	}
+}
+
+// managed はサーバーのポートを開閉の対象とするかを返す。リモートのデーモンで動作するサーバーは、このマシンのファイアウォールの対象外とする。
+func (m *Manager) managed(serverName string) bool {
+	cfg := m.Config.Get()
+	serverCfg, ok := cfg.Servers[serverName]
+	if !ok || cfg.Firewall == nil || serverCfg.Compose == nil {
+		return false
+	}
+	if serverCfg.Firewall != nil && serverCfg.Firewall.Disabled {
+		return false
+	}
+	return docker.IsLocal(serverName)
+}
+
+// MARK: Open()
+// コンテナが公開しているポートを開く。既に開いているルールは削除してから追加し、重複させない。
+func (m *Manager) Open(serverName string) {
+	fw := m.Config.Get().Firewall
+	if fw == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout*4)
+	defer cancel()
+
+	rules, err := publishedRules(ctx, serverName)
+	if err != nil {
+		logger.Errorf("Internal", "Firewall", "公開ポートの取得に失敗(%s): %v", serverName, err)
+		return
+	}
+	b := newBackend(fw)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := b.close(ctx, serverName, m.opened[serverName]); err != nil {
+		logger.Errorf("External", "Firewall", "既存のルールの削除に失敗(%s): %v", serverName, err)
+	}
+	delete(m.opened, serverName)
+	if len(rules) == 0 {
+		return
+	}
+	if err := b.open(ctx, serverName, rules); err != nil {
+		logger.Errorf("External", "Firewall", "ポートの開放に失敗(%s): %v", serverName, err)
+		return
+	}
+	m.opened[serverName] = rules
+	logger.Logf("Internal", "Firewall", "ポートを開放しました(%s): %s", serverName, describe(rules))
+}
+
+// MARK: Close()
+// Open で開いたポートを閉じる。play-bin の再起動等で記録が無い場合は、コンテナが公開しているポートを閉じる。
+func (m *Manager) Close(serverName string) {
+	fw := m.Config.Get().Firewall
+	if fw == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout*4)
+	defer cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules, ok := m.opened[serverName]
+	if !ok {
+		rules, _ = publishedRules(ctx, serverName)
+	}
+	if err := newBackend(fw).close(ctx, serverName, rules); err != nil {
+		logger.Errorf("External", "Firewall", "ポートの閉鎖に失敗(%s): %v", serverName, err)
+		return
+	}
+	delete(m.opened, serverName)
+	if ok {
+		logger.Logf("Internal", "Firewall", "ポートを閉鎖しました(%s): %s", serverName, describe(rules))
+	}
+}
+
+// publishedRules はコンテナが実際に公開しているポートを、連続したポートをまとめたルールとして返す。
+// 設定の network.mapping は再作成まで反映されないため、コンテナの状態を参照する。
+// イベントの直後はキャッシュが破棄される前の可能性があるため、キャッシュを介さずに取得する。
+func publishedRules(ctx context.Context, serverName string) ([]Rule, error) {
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	if err != nil {
+		return nil, err
+	}
+	if inspect.HostConfig == nil || inspect.HostConfig.NetworkMode != "bridge" {
+		return nil, nil
+	}
+	var ports []Rule
+	for port, bindings := range inspect.HostConfig.PortBindings {
+		for _, b := range bindings {
+			hostPort, err := nat.ParsePort(b.HostPort)
+			if err != nil || hostPort == 0 {
+				continue
+			}
+			ports = append(ports, Rule{Protocol: port.Proto(), HostIP: b.HostIP, From: hostPort, To: hostPort})
+		}
+	}
+	return mergeRules(ports), nil
+}
+
+// mergeRules は同じプロトコル・アドレスの連続したポートを 1 つのルールへまとめる。
+func mergeRules(rules []Rule) []Rule {
+	slices.SortFunc(rules, func(a, b Rule) int {
+		if c := strings.Compare(a.Protocol+"/"+a.HostIP, b.Protocol+"/"+b.HostIP); c != 0 {
+			return c
+		}
+		return a.From - b.From
+	})
+	var out []Rule
+	for _, r := range rules {
+		if n := len(out); n > 0 && out[n-1].Protocol == r.Protocol && out[n-1].HostIP == r.HostIP && out[n-1].To+1 >= r.From {
+			out[n-1].To = max(out[n-1].To, r.To)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// describe はログへ出力するためにルールを "25565/tcp, 19132/udp" の形式で返す。
+func describe(rules []Rule) string {
+	parts := make([]string, len(rules))
+	for i, r := range rules {
+		parts[i] = r.ports("-") + "/" + r.Protocol
+		if r.HostIP != "" {
+			parts[i] = r.HostIP + " " + parts[i]
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MARK: runner
+// ファイアウォールのコマンドを実行する。dryRun の場合、変更を伴うコマンドはログへ出力するのみで実行しない。
+type runner struct {
+	dryRun bool
+}
+
+// change は変更を伴うコマンドを実行する。
+func (r runner) change(ctx context.Context, name string, args ...string) error {
+	if r.dryRun {
+		logger.Logf("Internal", "Firewall", "[dry-run] %s %s", name, strings.Join(args, " "))
+		return nil
+	}
+	_, err := r.query(ctx, name, args...)
+	return err
+}
+
+// query は状態の参照のみを行うコマンドを実行し、出力を返す。dryRun でも実行する。
+func (r runner) query(ctx context.Context, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
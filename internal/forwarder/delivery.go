@@ -0,0 +1,281 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// deliveryQueueSize は宛先ごとに保持できる未送信の件数。超過した分は破棄して dropped に計上する。
+	deliveryQueueSize = 256
+	// deliveryWorkers は全ての宛先を通じて同時に送信できる件数。
+	deliveryWorkers = 8
+	// maxDeliveryAttempts は 1 件あたりの送信の試行回数 (初回を含む)。
+	maxDeliveryAttempts = 4
+	// deliveryBackoff は再送までの待機の初期値。試行ごとに倍にし、maxDeliveryBackoff を上限とする。
+	deliveryBackoff    = time.Second
+	maxDeliveryBackoff = 30 * time.Second
+	// deliveryIdleTimeout は宛先への送信が途絶えてから、その宛先のワーカーを停止するまでの時間。
+	deliveryIdleTimeout = 5 * time.Minute
+)
+
+// queuedSink は送信に時間のかかる転送先が実装する。ログの読み込みを止めないよう、Dispatcher のキューを経由して送信する。
+type queuedSink interface {
+	Sink
+	// queueKey は宛先の識別子。同じ宛先 (Webhook) を共有する転送先は 1 つのキューで順に送信する。
+	queueKey() string
+	// target は統計に表示する宛先の名前。URL のトークン等の秘密を含めない。
+	target() string
+}
+
+// MARK: Dispatcher
+// 転送先への送信を宛先ごとのキューで非同期に行い、失敗した送信を間隔を空けて再送する。
+// 宛先ごとに 1 つのワーカーが順に送信するため順序は保たれ、全体の同時送信数は deliveryWorkers に制限する。
+type Dispatcher struct {
+	queues map[string]*deliveryQueue
+	mu     sync.Mutex
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	// ctx は Close の期限を過ぎた場合にキャンセルし、送信中・再送待ちの配信を中断する。
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done は Close で閉じられ、ワーカーに残りの配信を送り切って停止するよう伝える。
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Deliveries はプロセス全体で共有する、転送先への送信キュー。
+var Deliveries = newDispatcher()
+
+func newDispatcher() *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		queues: make(map[string]*deliveryQueue),
+		sem:    make(chan struct{}, deliveryWorkers),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+type delivery struct {
+	sink  queuedSink
+	match Match
+}
+
+// deliveryQueue は 1 つの宛先の未送信の配信と送信の統計。
+type deliveryQueue struct {
+	target  string
+	ch      chan delivery
+	running bool // ワーカーが稼働中か (Dispatcher.mu で保護する)
+
+	delivered, retried, failed, dropped atomic.Uint64
+
+	mu          sync.Mutex
+	dropping    bool // 直前の配信を破棄したか。破棄の開始と回復のみを記録するために使用する
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// MARK: DeliveryStats
+// 宛先ごとの送信の統計。
+type DeliveryStats struct {
+	Target      string    `json:"target"`
+	Queued      int       `json:"queued"`    // 未送信の件数
+	Delivered   uint64    `json:"delivered"` // 送信に成功した件数
+	Retried     uint64    `json:"retried"`   // 再送した回数
+	Failed      uint64    `json:"failed"`    // 再送しても失敗し、破棄した件数
+	Dropped     uint64    `json:"dropped"`   // キューが満杯のため送信せずに破棄した件数
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitzero"`
+}
+
+// enqueue は配信を宛先のキューへ追加する。キューが満杯の場合や終了処理中は破棄して dropped に計上し、待機しない。
+func (d *Dispatcher) enqueue(sink queuedSink, m Match) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := sink.queueKey()
+	q, ok := d.queues[key]
+	if !ok {
+		q = &deliveryQueue{target: sink.target(), ch: make(chan delivery, deliveryQueueSize)}
+		d.queues[key] = q
+	}
+
+	select {
+	case <-d.done:
+		q.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case q.ch <- delivery{sink: sink, match: m}:
+		q.mu.Lock()
+		if q.dropping {
+			q.dropping = false
+			logger.Logf("External", "Forwarder", "転送先のキューが回復しました: %s (破棄した累計 %d 件)", q.target, q.dropped.Load())
+		}
+		q.mu.Unlock()
+	default:
+		// 宛先の応答が遅い間も、ログの読み込みを止めないよう新しい配信を破棄する。破棄が続く間は最初の 1 件のみ記録する。
+		q.dropped.Add(1)
+		q.mu.Lock()
+		if !q.dropping {
+			q.dropping = true
+			logger.Warnf("External", "Forwarder", "転送先のキューが満杯のため、配信を破棄しています: %s", q.target)
+		}
+		q.mu.Unlock()
+	}
+	if !q.running {
+		q.running = true
+		d.wg.Add(1)
+		go d.run(q)
+	}
+}
+
+// run は宛先のキューから配信を取り出して順に送信する。一定時間送信が無い場合は停止し、次の配信で再び起動される。
+func (d *Dispatcher) run(q *deliveryQueue) {
+	defer d.wg.Done()
+	idle := time.NewTimer(deliveryIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case dl := <-q.ch:
+			d.send(q, dl)
+			idle.Reset(deliveryIdleTimeout)
+		case <-d.done:
+			// 終了時は残っている配信を送り切ってから停止する。
+			for {
+				select {
+				case dl := <-q.ch:
+					d.send(q, dl)
+				default:
+					return
+				}
+			}
+		case <-idle.C:
+			d.mu.Lock()
+			if len(q.ch) == 0 {
+				q.running = false
+				d.mu.Unlock()
+				return
+			}
+			d.mu.Unlock()
+			idle.Reset(deliveryIdleTimeout)
+		}
+	}
+}
+
+// send は 1 件の配信を、再送の対象とならない失敗か試行回数の上限まで送信する。
+func (d *Dispatcher) send(q *deliveryQueue, dl delivery) {
+	for attempt := 1; ; attempt++ {
+		select {
+		case d.sem <- struct{}{}:
+		case <-d.ctx.Done():
+			q.failed.Add(1)
+			return
+		}
+		err := dl.sink.Send(d.ctx, dl.match)
+		<-d.sem
+		if err == nil {
+			q.delivered.Add(1)
+			return
+		}
+
+		q.mu.Lock()
+		q.lastError, q.lastErrorAt = err.Error(), time.Now()
+		q.mu.Unlock()
+		wait, retry := retryDelay(err, attempt)
+		if !retry || attempt >= maxDeliveryAttempts || d.ctx.Err() != nil {
+			q.failed.Add(1)
+			logger.Errorf("External", "Forwarder", "%s: ログの転送に失敗 (%s, %d 回試行): %v", dl.match.Server, q.target, attempt, err)
+			return
+		}
+		q.retried.Add(1)
+		logger.Debugf("External", "Forwarder", "%s: ログの転送に失敗したため %s 後に再送します (%s): %v", dl.match.Server, wait.Round(time.Millisecond), q.target, err)
+		select {
+		case <-d.ctx.Done():
+			q.failed.Add(1)
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryDelay は送信の失敗が再送の対象かと、再送までの待機時間を返す。
+// 待機は指数的に延ばし、同じ宛先への再送が一斉に集中しないよう半分をランダムにする。429 の Retry-After はこれより優先する。
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	backoff := min(deliveryBackoff<<(attempt-1), maxDeliveryBackoff)
+	wait := backoff/2 + rand.N(backoff/2+1)
+
+	var se *statusError
+	if errors.As(err, &se) {
+		switch {
+		case se.code == http.StatusTooManyRequests:
+			return max(wait, se.retryAfter), true
+		case se.code >= 500:
+			return wait, true
+		default:
+			// 4xx は URL や本文の誤りのため、再送しても成功しない。
+			return 0, false
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return 0, false
+	}
+	return wait, true
+}
+
+// MARK: Stats()
+// 宛先ごとの送信の統計を、宛先の名前順に返す。
+func (d *Dispatcher) Stats() []DeliveryStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := make([]DeliveryStats, 0, len(d.queues))
+	for _, q := range d.queues {
+		q.mu.Lock()
+		stats = append(stats, DeliveryStats{
+			Target:      q.target,
+			Queued:      len(q.ch),
+			Delivered:   q.delivered.Load(),
+			Retried:     q.retried.Load(),
+			Failed:      q.failed.Load(),
+			Dropped:     q.dropped.Load(),
+			LastError:   q.lastError,
+			LastErrorAt: q.lastErrorAt,
+		})
+		q.mu.Unlock()
+	}
+	slices.SortFunc(stats, func(a, b DeliveryStats) int { return strings.Compare(a.Target, b.Target) })
+	return stats
+}
+
+// MARK: Close()
+// 新しい配信の受け付けを止め、残っている配信の送信を ctx の期限まで待つ。期限を過ぎた場合は送信を中断する。
+func (d *Dispatcher) Close(ctx context.Context) {
+	d.closeOnce.Do(func() {
+		d.mu.Lock()
+		close(d.done)
+		d.mu.Unlock()
+	})
+	finished := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		d.cancel()
+		<-finished
+	}
+}
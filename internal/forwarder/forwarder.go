@@ -0,0 +1,308 @@
+package forwarder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+)
+
+const (
+	// syncInterval は設定に合わせて転送の開始・停止を同期する間隔。
+	syncInterval = 30 * time.Second
+	// drainTimeout は終了時に、キューに残っている配信の送信を待機する時間。
+	drainTimeout = 10 * time.Second
+)
+
+type tailState struct {
+	cancel context.CancelFunc
+	key    string // 転送の設定 (JSON)。変更を検知して再起動するために使用する
+}
+
+// MARK: Manager
+// 各コンテナのログを監視し、ルールに一致した行を設定された転送先へ送る。
+// ルールの評価は転送先と独立しており、同じルールで Discord・HTTP・コンテナへのコマンド等の複数の出力を駆動できる。
+type Manager struct {
+	Config *config.LoadedConfig
+
+	active map[string]*tailState
+	mu     sync.Mutex
+
+	// done は Close で閉じられ、同期ループを停止して転送が再開されないようにする。
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// MARK: NewManager()
+func NewManager(cfg *config.LoadedConfig) *Manager {
+	return &Manager{
+		Config: cfg,
+		active: make(map[string]*tailState),
+		done:   make(chan struct{}),
+	}
+}
+
+// MARK: Start()
+// ログ転送の有効・無効を、設定変更に合わせて同期するループを開始する。
+func (m *Manager) Start() {
+	go func() {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+
+		m.Sync()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				m.Sync()
+			}
+		}
+	}()
+}
+
+// MARK: Sync()
+// 設定ファイルの内容に合わせて、各コンテナのログ転送プロセスの起動・停止を同期する。
+func (m *Manager) Sync() {
+	select {
+	case <-m.done:
+		return
+	default:
+	}
+	cfg := m.Config.Get()
+	activeServers := make(map[string]bool)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for serverName, serverCfg := range cfg.Servers {
+		fc := serverCfg.ForwardSettings()
+		if fc == nil {
+			continue
+		}
+		activeServers[serverName] = true
+		b, _ := json.Marshal(fc)
+		key := string(b)
+
+		// 設定が変更されている場合は一旦停止して再起動する。
+		state, exists := m.active[serverName]
+		if exists && state.key != key {
+			state.cancel()
+			delete(m.active, serverName)
+			exists = false
+			logger.Logf("Internal", "Forwarder", "ログ転送の設定変更を検知しました。再起動します: %s", serverName)
+		}
+		if exists {
+			continue
+		}
+
+		var sinks []Sink
+		for _, sc := range fc.Sinks {
+			sink, err := newSink(serverName, sc)
+			if err != nil {
+				logger.Errorf("Internal", "Forwarder", "%s: 転送先の生成に失敗: %v", serverName, err)
+				continue
+			}
+			sinks = append(sinks, sink)
+		}
+
+		// 新たに監視対象となったコンテナに対して、追跡用の単一ゴルーチンを生成する。
+		ctx, cancel := context.WithCancel(context.Background())
+		m.active[serverName] = &tailState{cancel: cancel, key: key}
+		go m.tail(ctx, serverName, *fc, sinks)
+		logger.Logf("Internal", "Forwarder", "ログ転送を開始しました: %s", serverName)
+	}
+
+	// 構成解除されたサーバーの転送プロセスを、コンテキストを通じて安全に終了させる。
+	for serverName, state := range m.active {
+		if !activeServers[serverName] {
+			state.cancel()
+			delete(m.active, serverName)
+			logger.Logf("Internal", "Forwarder", "ログ転送を停止しました: %s", serverName)
+		}
+	}
+}
+
+// MARK: Close()
+// play-bin の終了時に、全てのログ転送を停止し、キューに残っている配信を drainTimeout まで送信する。
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		m.mu.Lock()
+		for serverName, state := range m.active {
+			state.cancel()
+			delete(m.active, serverName)
+		}
+		m.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		Deliveries.Close(ctx)
+	})
+}
+
+// MARK: tail()
+// Dockerコンテナのストリームログを監視し、ルールに一致した行を逐次転送先へ送る常駐処理。
+func (m *Manager) tail(ctx context.Context, serverName string, fc config.ForwardConfig, sinks []Sink) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		reader, err := m.follow(ctx, serverName)
+		if errors.Is(err, errNotRunning) {
+			continue
+		}
+		if err != nil {
+			logger.Errorf("Internal", "Forwarder", "ログ取得失敗 (%s): %v", serverName, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+
+		err = readLines(reader, fc.LineSize(), func(line string) bool {
+			// 各行に対し、最新のルールを適用して転送可否を判定する。
+			m.process(ctx, serverName, line, getRules(fc.Rules), sinks)
+			return ctx.Err() == nil
+		})
+		reader.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		// ストリームが途絶えた（コンテナ停止等）場合は、再接続の連打を避けるため短い猶予を持たせる。
+		// 読み込みの失敗は転送の欠落となるため記録し、長めに待機してから再接続する。
+		wait := time.Second
+		if err != nil {
+			logger.Errorf("Internal", "Forwarder", "ログの読み込みに失敗 (%s): %v", serverName, err)
+			wait = 10 * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// errNotRunning はコンテナの起動を待機したため、改めて接続を試みることを表す。
+var errNotRunning = errors.New("container is not running")
+
+// follow は接続時点以降の新規ログを追従するストリームを開く。
+// ホスト上で直接実行するサーバーは、停止中も journald・logFile を追従し続ける。
+func (m *Manager) follow(ctx context.Context, serverName string) (io.ReadCloser, error) {
+	if pc := m.Config.Get().Servers[serverName].ProcessSettings(); pc != nil {
+		return process.Logs(ctx, serverName, *pc, process.LogOptions{Follow: true})
+	}
+
+	// コンテナが稼働しているか確認。停止中や生成前であれば、起動イベントを受信するまで待機する。
+	// 確認の直後に起動した場合も待機を終えられるよう、確認の前に起動イベントの購読を開始する。
+	// イベントの取りこぼしに備え、一定時間経過後は状態を再確認する。
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return nil, fmt.Errorf("Dockerホストの解決に失敗: %w", err)
+	}
+	wait, stop := docker.WatchFor(serverName, "start", "restart")
+	defer stop()
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	if err != nil || !inspect.State.Running {
+		wait(ctx, 5*time.Minute)
+		return nil, errNotRunning
+	}
+
+	reader, err := cli.ContainerLogs(ctx, inspect.ID, ctypes.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Tail:       "0", // 接続時点以降の新規ログのみを対象とする
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logStream(reader, inspect.Config.Tty), nil
+}
+
+// logStream はコンテナのログのストリームを、行単位で読める形にして返す。
+// TTY 無しのコンテナは stdout/stderr が 8 バイトのヘッダー付きで多重化されているため、分離してから行単位で読む。
+// ヘッダーが行に混入すると、行頭に一致させる正規表現が一致しなくなる。
+func logStream(reader io.ReadCloser, tty bool) io.ReadCloser {
+	if tty {
+		return reader
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, reader)
+		pw.CloseWithError(err)
+	}()
+	return &demuxReader{PipeReader: pr, src: reader}
+}
+
+// demuxReader は多重化を解除したストリーム。閉じる際は元のストリームも閉じる。
+type demuxReader struct {
+	*io.PipeReader
+	src io.Closer
+}
+
+func (r *demuxReader) Close() error {
+	err := r.src.Close()
+	r.PipeReader.Close()
+	return err
+}
+
+// readLines は r を行単位で fn へ渡す。maxSize バイトを超える行は、maxSize ごとに分割して別の行として渡す。
+// fn が false を返すか、ストリームが終了した場合に戻る。終了が EOF の場合は nil を返す。
+func readLines(r io.Reader, maxSize int, fn func(line string) bool) error {
+	br := bufio.NewReaderSize(r, maxSize)
+	for {
+		// ReadLine はバッファを超える行を isPrefix 付きの断片として返すため、断片をそのまま 1 行として扱う。
+		chunk, _, err := br.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if !fn(string(chunk)) {
+			return nil
+		}
+	}
+}
+
+// process は 1 行にルールを定義順に適用し、一致ごとに全ての転送先へ送る。stop のルールに一致した場合は以降を評価しない。
+// 送信に時間のかかる転送先は Deliveries のキューへ追加し、転送先の応答を待たずに次の行を読む。
+func (m *Manager) process(ctx context.Context, serverName, line string, rules []Rule, sinks []Sink) {
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		matches := rule.match(line, serverName)
+		for _, vars := range matches {
+			match := Match{Server: serverName, Rule: rule.Comment, Line: line, Vars: vars, Time: now, rule: rule}
+			for _, sink := range sinks {
+				if qs, ok := sink.(queuedSink); ok {
+					Deliveries.enqueue(qs, match)
+					continue
+				}
+				if err := sink.Send(ctx, match); err != nil {
+					logger.Errorf("External", "Forwarder", "%s: ログの転送に失敗: %v", serverName, err)
+				}
+			}
+		}
+		if len(matches) > 0 && rule.Stop {
+			break
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package forwarder
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// collectLines は TTY の有無に応じたログのストリームから、readLines が渡す行を全て返す。
+func collectLines(t *testing.T, stream []byte, tty bool, maxSize int) []string {
+	t.Helper()
+	reader := logStream(io.NopCloser(bytes.NewReader(stream)), tty)
+	defer reader.Close()
+	var lines []string
+	err := readLines(reader, maxSize, func(line string) bool {
+		lines = append(lines, line)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("readLines: %v", err)
+	}
+	return lines
+}
+
+func TestReadLinesTTY(t *testing.T) {
+	got := collectLines(t, []byte("[12:00:00] Server started\r\nplayer joined\n\nlast line without newline"), true, 4096)
+	want := []string{"[12:00:00] Server started", "player joined", "", "last line without newline"}
+	if !slices.Equal(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestReadLinesMultiplexed(t *testing.T) {
+	var stream bytes.Buffer
+	stdout := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+	stderr := stdcopy.NewStdWriter(&stream, stdcopy.Stderr)
+	// 1 行が複数のフレームに分かれる場合も、ヘッダーを除いて 1 行として扱う。
+	stdout.Write([]byte("[INFO] Done (3.2s)!"))
+	stdout.Write([]byte(" For help, type \"help\"\n"))
+	stderr.Write([]byte("[WARN] Can't keep up!\n"))
+	stdout.Write([]byte("joined the game\n"))
+
+	got := collectLines(t, stream.Bytes(), false, 4096)
+	want := []string{`[INFO] Done (3.2s)! For help, type "help"`, "[WARN] Can't keep up!", "joined the game"}
+	if !slices.Equal(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestReadLinesOverlong(t *testing.T) {
+	const maxSize = 16
+	long := strings.Repeat("a", maxSize) + strings.Repeat("b", maxSize) + "cc"
+	got := collectLines(t, []byte(long+"\nnext\n"), true, maxSize)
+	// maxSize を超える行は maxSize ごとに分割され、後続の行は影響を受けない。
+	want := []string{strings.Repeat("a", maxSize), strings.Repeat("b", maxSize), "cc", "next"}
+	if !slices.Equal(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestReadLinesStop(t *testing.T) {
+	var lines []string
+	err := readLines(strings.NewReader("a\nb\nc\n"), 4096, func(line string) bool {
+		lines = append(lines, line)
+		return line != "b"
+	})
+	if err != nil || !slices.Equal(lines, []string{"a", "b"}) {
+		t.Errorf("lines = %q, err = %v, want [a b] and nil", lines, err)
+	}
+}
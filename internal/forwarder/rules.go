@@ -0,0 +1,184 @@
+package forwarder
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: Rule
+// コンテナログから特定のパターンを検出し、転送先へ送るためのルール定義。
+// 既定では全てのルールを順に評価し、各ルールでは最初に一致した正規表現の最初の一致のみを転送する。
+type Rule struct {
+	Comment  string           `json:"comment,omitempty"`  // ルールの説明。http / event の転送先では rule として送る
+	Regexp   []string         `json:"regexp"`             // 検出するパターン
+	Webhook  []map[string]any `json:"webhook,omitempty"`  // discord の転送先へ送信する本文
+	Commands []string         `json:"commands,omitempty"` // command の転送先でコンテナの標準入力へ送信する行
+	All      bool             `json:"all,omitempty"`      // 一致した全ての正規表現の、行内の全ての一致をそれぞれ転送する
+	Stop     bool             `json:"stop,omitempty"`     // 一致した場合、以降のルールを評価しない
+	Res      []*regexp.Regexp `json:"-"`
+}
+
+// placeholderPattern は転送する本文中のプレースホルダー (${server}, ${player} 等の名前、$1 / ${1} の番号)。
+var placeholderPattern = regexp.MustCompile(`\$\{(\w+)\}|\$(\d+)`)
+
+// ルールの読み込み状態を保持するキャッシュ構造体。
+type rulesState struct {
+	rules      []Rule
+	lastLoaded time.Time
+	mu         sync.RWMutex
+}
+
+var (
+	rulesCache      = make(map[string]*rulesState)
+	rulesCacheMutex sync.RWMutex
+)
+
+// MARK: getRules()
+// JSON 形式のルールを読み込み、コンパイル済みの正規表現をキャッシュして高速に提供する。
+func getRules(path string) []Rule {
+	rulesCacheMutex.RLock()
+	state, exists := rulesCache[path]
+	rulesCacheMutex.RUnlock()
+
+	if !exists {
+		state = &rulesState{}
+		rulesCacheMutex.Lock()
+		rulesCache[path] = state
+		rulesCacheMutex.Unlock()
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	state.mu.RLock()
+	// 設定ファイル自体のタイムスタンプを監視し、変更時のみリロードを行う。
+	needsReload := info.ModTime().After(state.lastLoaded)
+	state.mu.RUnlock()
+
+	if needsReload {
+		rules, err := loadRules(path)
+		if err != nil {
+			// ロード失敗時は、可用性を考慮し、前回ロード済みのキャッシュを再利用する。
+			logger.Errorf("Internal", "Forwarder", "ログルールのパース失敗: %v", err)
+			state.mu.RLock()
+			defer state.mu.RUnlock()
+			return state.rules
+		}
+		state.mu.Lock()
+		state.rules = rules
+		state.lastLoaded = info.ModTime()
+		state.mu.Unlock()
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.rules
+}
+
+// MARK: loadRules()
+// ファイルからルールをデコードし、正規表現をメモリ上で高速化するために事前コンパイルする。
+func loadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		for _, pat := range rules[i].Regexp {
+			re, err := regexp.Compile(pat)
+			if err != nil {
+				// 正規表現の文法エラーは致命的なため、上位に伝播させる。
+				return nil, err
+			}
+			rules[i].Res = append(rules[i].Res, re)
+		}
+	}
+	return rules, nil
+}
+
+// MARK: > match
+// ルールを行に適用し、一致ごとのプレースホルダーの値を返す。一致しない場合は nil を返す。
+func (r *Rule) match(line, serverName string) []map[string]string {
+	var result []map[string]string
+	for _, re := range r.Res {
+		var all [][]string
+		if r.All {
+			all = re.FindAllStringSubmatch(line, -1)
+		} else if match := re.FindStringSubmatch(line); match != nil {
+			all = [][]string{match}
+		}
+		for _, match := range all {
+			result = append(result, captureVars(re, match, serverName))
+		}
+		if len(result) > 0 && !r.All {
+			break
+		}
+	}
+	return result
+}
+
+// captureVars は正規表現の一致から、プレースホルダーの名前と値の対応を作成する。
+// キャプチャは番号 ("0" は一致全体) と、名前付きグループ ((?P<player>...)) の名前の両方で参照できる。${server} はサーバー名とする。
+func captureVars(re *regexp.Regexp, match []string, serverName string) map[string]string {
+	vars := make(map[string]string, len(match)+1)
+	for i, name := range re.SubexpNames() {
+		vars[strconv.Itoa(i)] = match[i]
+		if name != "" {
+			vars[name] = match[i]
+		}
+	}
+	vars["server"] = serverName
+	return vars
+}
+
+// MARK: Expand()
+// 文字列中の $1, ${player}, ${server} などを置換する。対応する値の無いプレースホルダーはそのまま残す。
+func Expand(s string, vars map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(s, func(p string) string {
+		sub := placeholderPattern.FindStringSubmatch(p)
+		key := sub[1]
+		if key == "" {
+			key = sub[2]
+		}
+		if val, ok := vars[key]; ok {
+			return val
+		}
+		return p
+	})
+}
+
+// expandPayload は map や slice 内の文字列のプレースホルダーを再帰的に置換する。
+func expandPayload(data any, vars map[string]string) any {
+	switch v := data.(type) {
+	case string:
+		return Expand(v, vars)
+	case map[string]any:
+		newMap := make(map[string]any)
+		for k, val := range v {
+			newMap[k] = expandPayload(val, vars)
+		}
+		return newMap
+	case []any:
+		newSlice := make([]any, len(v))
+		for i, val := range v {
+			newSlice[i] = expandPayload(val, vars)
+		}
+		return newSlice
+	default:
+		return v
+	}
+}
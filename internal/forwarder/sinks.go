@@ -0,0 +1,184 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/pubsub"
+)
+
+// webhookTimeout は Webhook / HTTP の転送先への 1 回の送信の期限。
+const webhookTimeout = 10 * time.Second
+
+// MARK: Match
+// ルールに一致したログの 1 行。1 行に複数の一致がある場合 (all) は、一致ごとに生成する。
+type Match struct {
+	Server string            `json:"server"`
+	Rule   string            `json:"rule,omitempty"` // ルールの comment
+	Line   string            `json:"line"`
+	Vars   map[string]string `json:"vars"` // プレースホルダーの値 (番号・名前付きのキャプチャと server)
+	Time   time.Time         `json:"time"`
+
+	rule *Rule
+}
+
+// MARK: Sink
+// 一致した行の転送先。
+type Sink interface {
+	Send(ctx context.Context, m Match) error
+}
+
+// newSink は設定から転送先を生成する。
+func newSink(serverName string, cfg config.ForwardSinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case config.SinkDiscord:
+		return &discordSink{url: cfg.URL}, nil
+	case config.SinkHTTP:
+		return &httpSink{url: cfg.URL, headers: cfg.Headers}, nil
+	case config.SinkCommand:
+		return &commandSink{server: serverName}, nil
+	case config.SinkEvent:
+		return eventSink{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+	}
+}
+
+// MARK: > discordSink
+// ルールの webhook に定義された本文を、プレースホルダーを置換して Discord Webhook へ順に送信する。
+type discordSink struct {
+	url string
+}
+
+func (s *discordSink) queueKey() string { return "discord " + s.url }
+
+// target は Webhook の URL の末尾 (トークン) を伏せて返す。
+func (s *discordSink) target() string {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return "discord"
+	}
+	u.Path = path.Join(path.Dir(u.Path), "***")
+	u.RawQuery = ""
+	return "discord " + u.Redacted()
+}
+
+func (s *discordSink) Send(ctx context.Context, m Match) error {
+	for _, raw := range m.rule.Webhook {
+		if err := postJSON(ctx, s.url, nil, expandPayload(raw, m.Vars)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MARK: > httpSink
+// 一致した行を Match の JSON として任意の URL へ POST する。
+type httpSink struct {
+	url     string
+	headers map[string]string
+}
+
+func (s *httpSink) queueKey() string { return "http " + s.url }
+
+// target はクエリと認証情報を除いた URL を返す。
+func (s *httpSink) target() string {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return "http"
+	}
+	u.RawQuery = ""
+	u.User = nil
+	return "http " + u.String()
+}
+
+func (s *httpSink) Send(ctx context.Context, m Match) error {
+	return postJSON(ctx, s.url, s.headers, m)
+}
+
+// statusError は転送先が 2xx 以外を応答したことを表す。再送の可否の判定に使用する。
+type statusError struct {
+	code       int
+	status     string
+	retryAfter time.Duration // 429 の Retry-After (秒)
+}
+
+func (e *statusError) Error() string { return "unexpected status " + e.status }
+
+// postJSON は body を JSON で POST し、2xx 以外の応答を *statusError とする。
+func postJSON(ctx context.Context, url string, headers map[string]string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		se := &statusError{code: resp.StatusCode, status: resp.Status}
+		// Discord はレート制限の解除までの秒数を小数で返すことがある。
+		if sec, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && sec > 0 {
+			se.retryAfter = time.Duration(sec * float64(time.Second))
+		}
+		return se
+	}
+	return nil
+}
+
+// MARK: > commandSink
+// ルールの commands を、プレースホルダーを置換してコンテナの標準入力へ送信する (例: 参加したプレイヤーへの挨拶)。
+// 送信したコマンドの出力が同じルールに一致すると繰り返し送信されるため、ルールの正規表現はコマンドの出力に一致しないようにすること。
+type commandSink struct {
+	server string
+}
+
+func (s *commandSink) queueKey() string { return "command " + s.server }
+func (s *commandSink) target() string   { return "command " + s.server }
+
+func (s *commandSink) Send(_ context.Context, m Match) error {
+	for _, command := range m.rule.Commands {
+		if err := docker.SendCommand(s.server, Expand(command, m.Vars)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MARK: > eventSink
+// 一致した行を Matches の購読者 (/api/events 等) へ配信する。
+type eventSink struct{}
+
+func (eventSink) Send(_ context.Context, m Match) error {
+	Matches.Publish(m)
+	return nil
+}
+
+// MARK: MatchHub
+// event の転送先に一致した行を、購読者へ配信する。
+type MatchHub struct {
+	pubsub.Hub[Match]
+}
+
+// Matches はプロセス全体で共有する、一致した行の配信元。
+var Matches = &MatchHub{}
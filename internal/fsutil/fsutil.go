@@ -0,0 +1,53 @@
+package fsutil
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// writeMu は WriteFile による置き換えを直列化する。
+// 同じファイルへの書き込みが並行した場合に、古い内容での置き換えが新しい内容を上書きしないようにする。
+var writeMu sync.Mutex
+
+// MARK: WriteFile()
+// 書き込み途中で中断されても既存のファイルが壊れず、読み取り側が書き込み途中の内容を読まないよう、
+// 同じディレクトリの一時ファイルへ書き込んでからリネームで置き換える。
+// 既存のファイルがある場合はそのパーミッションを引き継ぎ、無い場合は perm で作成する。
+func WriteFile(path string, data []byte, perm fs.FileMode) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// MARK: WriteJSON()
+// 値をインデント付きの JSON として WriteFile で書き出す。
+func WriteJSON(path string, v any, perm fs.FileMode) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, b, perm)
+}
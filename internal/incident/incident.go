@@ -0,0 +1,283 @@
+package incident
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// インシデントは <baseDir>/<server>/<id>.json に保存する。
+const baseDir = "./incidents"
+
+const (
+	defaultLogLines = 200
+	// maxReportSize はクラッシュレポート 1 件あたりに記録する最大サイズ。巨大なダンプでディスクを圧迫しないための上限。
+	maxReportSize = 256 << 10
+	// maxReports は 1 件のインシデントに含めるクラッシュレポートの最大数。
+	maxReports = 5
+)
+
+// Report はインシデントに添付したクラッシュレポートファイル。
+type Report struct {
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Incident はコンテナの異常終了 1 回分の記録。
+type Incident struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	ExitCode  int       `json:"exitCode"`
+	OOMKilled bool      `json:"oomKilled,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	Time      time.Time `json:"time"`
+	Logs      []string  `json:"logs,omitempty"`
+	Reports   []Report  `json:"reports,omitempty"`
+}
+
+// Summary は一覧表示用に、ログ本文を除いたインシデントの概要。
+type Summary struct {
+	ID        string    `json:"id"`
+	ExitCode  int       `json:"exitCode"`
+	OOMKilled bool      `json:"oomKilled,omitempty"`
+	Time      time.Time `json:"time"`
+	Reports   int       `json:"reports"`
+}
+
+// MARK: Recorder
+// コンテナの終了イベントを監視し、異常終了時にログとクラッシュレポートを収集する。
+type Recorder struct {
+	Config *config.LoadedConfig
+
+	// OnIncident はインシデントの保存後に呼び出される（Discord への通知等）。
+	OnIncident func(inc Incident)
+}
+
+// MARK: NewRecorder()
+func NewRecorder(cfg *config.LoadedConfig) *Recorder {
+	return &Recorder{Config: cfg}
+}
+
+// MARK: Start()
+// コンテナイベントの購読を開始する。
+func (r *Recorder) Start() {
+	events, _ := docker.Events.Subscribe()
+	go func() {
+		for ev := range events {
+			if ev.Action != "die" || ev.ExitCode == "" || ev.ExitCode == "0" {
+				continue
+			}
+			serverCfg, ok := r.Config.Get().Servers[ev.Server]
+			if !ok || serverCfg.Crash == nil || ev.Host != docker.HostOf(ev.Server) {
+				continue
+			}
+			exitCode, _ := strconv.Atoi(ev.ExitCode)
+			go r.capture(ev.Server, serverCfg, exitCode, ev.Time)
+		}
+	}()
+}
+
+// capture はインシデントを収集・保存し、通知する。
+func (r *Recorder) capture(serverName string, serverCfg config.ServerConfig, exitCode int, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return
+	}
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	if err != nil {
+		logger.Errorf("Internal", "Incident", "終了したコンテナの情報取得に失敗(%s): %v", serverName, err)
+		return
+	}
+	// SIGTERM / SIGKILL による終了は停止・強制停止の操作によるものとみなし、OOM の場合のみ記録する。
+	if (exitCode == 143 || exitCode == 137) && !inspect.State.OOMKilled {
+		return
+	}
+
+	inc := Incident{
+		ID:        at.Format("20060102_150405"),
+		Server:    serverName,
+		ExitCode:  exitCode,
+		OOMKilled: inspect.State.OOMKilled,
+		Time:      at,
+	}
+	startedAt, _ := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	inc.StartedAt = startedAt
+
+	lines := serverCfg.Crash.LogLines
+	if lines <= 0 {
+		lines = defaultLogLines
+	}
+	logs, err := cli.ContainerLogs(ctx, inspect.ID, ctypes.LogsOptions{ShowStdout: true, ShowStderr: true, Tail: strconv.Itoa(lines)})
+	if err != nil {
+		logger.Errorf("Internal", "Incident", "ログの取得に失敗(%s): %v", serverName, err)
+	} else {
+		var buf bytes.Buffer
+		if inspect.Config.Tty {
+			io.Copy(&buf, logs)
+		} else {
+			stdcopy.StdCopy(&buf, &buf, logs)
+		}
+		logs.Close()
+		inc.Logs = strings.Split(strings.TrimRight(strings.ReplaceAll(buf.String(), "\r\n", "\n"), "\n"), "\n")
+	}
+
+	// クラッシュレポートはバインドマウント元に出力されるため、ローカルホストのサーバーのみ収集できる。
+	if docker.IsLocal(serverName) {
+		inc.Reports = collectReports(serverCfg, startedAt)
+	}
+
+	if err := save(inc); err != nil {
+		logger.Errorf("Internal", "Incident", "インシデントの保存に失敗(%s): %v", serverName, err)
+		return
+	}
+	logger.Warnf("Internal", "Incident", "異常終了を記録しました: %s (exit=%d, id=%s)", serverName, exitCode, inc.ID)
+
+	if r.OnIncident != nil {
+		r.OnIncident(inc)
+	}
+}
+
+// collectReports は設定されたパターンに一致するファイルのうち、コンテナの起動以降に更新されたものを新しい順に読み込む。
+func collectReports(serverCfg config.ServerConfig, since time.Time) []Report {
+	type candidate struct {
+		path    string
+		modTime time.Time
+	}
+	var candidates []candidate
+	for _, pattern := range serverCfg.Crash.Reports {
+		if !filepath.IsAbs(pattern) && serverCfg.WorkingDir != "" {
+			pattern = filepath.Join(serverCfg.WorkingDir, pattern)
+		}
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() || info.ModTime().Before(since) {
+				continue
+			}
+			candidates = append(candidates, candidate{path: path, modTime: info.ModTime()})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].modTime.After(candidates[j].modTime) })
+	if len(candidates) > maxReports {
+		candidates = candidates[:maxReports]
+	}
+
+	var reports []Report
+	for _, c := range candidates {
+		f, err := os.Open(c.path)
+		if err != nil {
+			continue
+		}
+		b, _ := io.ReadAll(io.LimitReader(f, maxReportSize+1))
+		f.Close()
+		report := Report{Path: c.path}
+		if len(b) > maxReportSize {
+			b = b[:maxReportSize]
+			report.Truncated = true
+		}
+		report.Content = string(b)
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func save(inc Incident) error {
+	dir := filepath.Join(baseDir, inc.Server)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(inc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, inc.ID+".json"), b, 0o640)
+}
+
+// MARK: List()
+// サーバーのインシデント一覧を新しい順に返す。
+func List(serverName string) ([]Summary, error) {
+	if !validName(serverName) {
+		return nil, os.ErrNotExist
+	}
+	entries, err := os.ReadDir(filepath.Join(baseDir, serverName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Summary{}, nil
+		}
+		return nil, err
+	}
+	list := []Summary{}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		inc, err := Get(serverName, id)
+		if err != nil {
+			continue
+		}
+		list = append(list, Summary{ID: inc.ID, ExitCode: inc.ExitCode, OOMKilled: inc.OOMKilled, Time: inc.Time, Reports: len(inc.Reports)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.After(list[j].Time) })
+	return list, nil
+}
+
+// MARK: Get()
+// インシデントの詳細を返す。
+func Get(serverName, id string) (Incident, error) {
+	if !validName(serverName) || !validName(id) {
+		return Incident{}, os.ErrNotExist
+	}
+	b, err := os.ReadFile(filepath.Join(baseDir, serverName, id+".json"))
+	if err != nil {
+		return Incident{}, err
+	}
+	var inc Incident
+	if err := json.Unmarshal(b, &inc); err != nil {
+		return Incident{}, fmt.Errorf("invalid incident file: %w", err)
+	}
+	return inc, nil
+}
+
+// MARK: Text()
+// ログとクラッシュレポートを 1 つのテキストにまとめる。Discord への添付等に使用する。
+func (inc Incident) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "server: %s\nexit code: %d\noom killed: %t\ntime: %s\n\n", inc.Server, inc.ExitCode, inc.OOMKilled, inc.Time.Format(time.RFC3339))
+	b.WriteString("==== logs ====\n")
+	for _, line := range inc.Logs {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	for _, r := range inc.Reports {
+		fmt.Fprintf(&b, "\n==== %s ====\n%s\n", r.Path, r.Content)
+		if r.Truncated {
+			b.WriteString("(truncated)\n")
+		}
+	}
+	return b.String()
+}
+
+// validName はパス要素として安全な名前であるかを検証する。
+func validName(name string) bool {
+	return name != "" && name == filepath.Base(name) && !strings.HasPrefix(name, ".")
+}
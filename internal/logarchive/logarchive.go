@@ -0,0 +1,526 @@
+package logarchive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// アーカイブは <directory>/<server>/current.log へ追記し、サイズを超えたら <20060102-150405.000>.log へ退避する。
+// 各行の先頭には Docker が記録した時刻 (RFC 3339) を付与し、再開時の重複の除去と時刻での絞り込みに使用する。
+const (
+	currentFile   = "current.log"
+	rotatedFormat = "20060102-150405.000"
+	fileExt       = ".log"
+)
+
+// tailProbeSize は再開位置を調べるために読み込む、ファイル末尾のサイズ。
+const tailProbeSize = 64 << 10
+
+// FileInfo はアーカイブのファイル 1 件の情報。
+type FileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Current bool      `json:"current,omitempty"` // 書き込み中のファイル
+}
+
+// MARK: Archiver
+// 管理下のコンテナのログを追従し、サーバーごとのファイルへ書き出し続ける。
+type Archiver struct {
+	Config *config.LoadedConfig
+
+	mu    sync.Mutex
+	wakes map[string]chan struct{} // サーバーごとの追従ゴルーチンへの再開の要求
+}
+
+// MARK: NewArchiver()
+func NewArchiver(cfg *config.LoadedConfig) *Archiver {
+	return &Archiver{Config: cfg, wakes: make(map[string]chan struct{})}
+}
+
+// MARK: Start()
+// コンテナの起動イベントの購読と、既存のコンテナのログの追従を開始する。
+// logArchive は再読み込みで有効にできるよう、イベントごとに設定を参照する。
+func (a *Archiver) Start() {
+	events, _ := docker.Events.Subscribe()
+	go func() {
+		for ev := range events {
+			if ev.Action != "start" || ev.Host != docker.HostOf(ev.Server) {
+				continue
+			}
+			cfg := a.Config.Get()
+			if _, ok := cfg.Servers[ev.Server]; !ok || !cfg.LogArchive.Enabled(ev.Server) {
+				continue
+			}
+			a.wake(ev.Server)
+		}
+	}()
+	go a.resume()
+	go func() {
+		for {
+			time.Sleep(time.Hour)
+			Prune(a.Config.Get().LogArchive)
+		}
+	}()
+}
+
+// resume は play-bin の停止中に出力されたログを取り込み、稼働中のコンテナの追従を再開する。
+// 停止済みのコンテナも、再作成で失われる前に未保存のログを保存しておく。
+func (a *Archiver) resume() {
+	cfg := a.Config.Get()
+	for serverName := range cfg.Servers {
+		if !cfg.LogArchive.Enabled(serverName) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := docker.Inspects.Inspect(ctx, serverName)
+		cancel()
+		if err != nil {
+			continue
+		}
+		a.wake(serverName)
+	}
+}
+
+// wake はサーバーのログの追従を要求する。追従中の場合は、現在のストリームの終了後に改めて追従する。
+// 再起動の直後は、停止前のストリームの終了より先に起動イベントが届くことがあるため、要求を 1 件まで保持する。
+func (a *Archiver) wake(serverName string) {
+	a.mu.Lock()
+	ch, ok := a.wakes[serverName]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		a.wakes[serverName] = ch
+		go a.run(serverName, ch)
+	}
+	a.mu.Unlock()
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Archiver) run(serverName string, wake <-chan struct{}) {
+	for range wake {
+		cfg := a.Config.Get().LogArchive
+		if !cfg.Enabled(serverName) {
+			continue
+		}
+		if err := archive(serverName, cfg); err != nil {
+			logger.Errorf("Internal", "LogArchive", "%s: ログの保存に失敗: %v", serverName, err)
+		}
+	}
+}
+
+// archive はコンテナのログを、保存済みの最後の行の続きからストリームが終了するまで (コンテナの停止まで) 書き出す。
+func archive(serverName string, cfg *config.LogArchiveConfig) error {
+	dir := filepath.Join(cfg.Directory, serverName)
+	if !validName(serverName) {
+		return errors.New("invalid server name")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	last := lastTime(dir)
+
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	if err != nil {
+		return err
+	}
+	opts := ctypes.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true, Timestamps: true}
+	if !last.IsZero() {
+		opts.Since = last.Format(time.RFC3339Nano)
+	}
+	logs, err := cli.ContainerLogs(ctx, inspect.ID, opts)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	var reader io.Reader = logs
+	if !inspect.Config.Tty {
+		// TTY 無しのコンテナは stdout/stderr が多重化されているため、分離してから行単位で読む。
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, logs)
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		reader = pr
+	}
+
+	w, err := openWriter(dir, cfg)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	br := bufio.NewReader(reader)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = append(bytes.TrimRight(line, "\r\n"), '\n')
+			// since は指定した時刻の行も含むため、保存済みの行を読み飛ばす。
+			if t, _, ok := splitLine(string(line)); !ok || t.After(last) {
+				if err := w.write(line); err != nil {
+					return err
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// MARK: > writer
+// current.log へ追記し、サイズを超えたらローテーションする。
+type writer struct {
+	dir  string
+	cfg  *config.LogArchiveConfig
+	file *os.File
+	size int64
+}
+
+func openWriter(dir string, cfg *config.LogArchiveConfig) (*writer, error) {
+	w := &writer{dir: dir, cfg: cfg}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *writer) open() error {
+	f, err := os.OpenFile(filepath.Join(w.dir, currentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+func (w *writer) write(line []byte) error {
+	if w.size > 0 && w.size+int64(len(line)) > w.cfg.MaxSize() {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	return err
+}
+
+// rotate は current.log を退避して新しいファイルを開き、保持期間・保持数を超えた古いファイルを削除する。
+func (w *writer) rotate() error {
+	w.file.Close()
+	rotated := filepath.Join(w.dir, time.Now().Format(rotatedFormat)+fileExt)
+	if err := os.Rename(filepath.Join(w.dir, currentFile), rotated); err != nil {
+		// 退避できない場合も保存を継続するため、同じファイルを開き直す。
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	pruneDir(w.dir, w.cfg)
+	return nil
+}
+
+func (w *writer) close() error {
+	return w.file.Close()
+}
+
+// MARK: List()
+// 指定サーバーのアーカイブのファイルを古い順に返す。書き込み中のファイルは末尾となる。
+func List(cfg *config.LogArchiveConfig, server string) ([]FileInfo, error) {
+	result := []FileInfo{}
+	if cfg == nil || cfg.Directory == "" || !validName(server) {
+		return result, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(cfg.Directory, server))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, err
+	}
+	var current *FileInfo
+	for _, e := range entries {
+		if !validFileName(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		info := FileInfo{Name: e.Name(), Size: fi.Size(), ModTime: fi.ModTime(), Current: e.Name() == currentFile}
+		if info.Current {
+			current = &info
+			continue
+		}
+		result = append(result, info)
+	}
+	// 退避したファイル名の時刻は辞書順が時刻順となる。
+	slices.SortFunc(result, func(a, b FileInfo) int { return strings.Compare(a.Name, b.Name) })
+	if current != nil {
+		result = append(result, *current)
+	}
+	return result, nil
+}
+
+// MARK: Open()
+// List が返した名前のファイルを開く。ディレクトリトラバーサルを防ぐため形式を厳密に検証する。
+func Open(cfg *config.LogArchiveConfig, server, name string) (*os.File, error) {
+	if cfg == nil || cfg.Directory == "" || !validName(server) || !validFileName(name) {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(filepath.Join(cfg.Directory, server, name))
+}
+
+// MARK: SearchOptions
+// Search の検索条件。
+type SearchOptions struct {
+	Query string         // 部分一致で検索する文字列 (Regex を指定した場合は無視する)
+	Regex *regexp.Regexp // 正規表現で検索する
+	Since time.Time      // この時刻以降の行のみ (ゼロ値は制限なし)
+	Until time.Time      // この時刻以前の行のみ (ゼロ値は制限なし)
+	After time.Time      // この時刻より後の行のみ。前回の検索の続きを取得するためのカーソル (ゼロ値は制限なし)
+	Limit int            // 返す件数の上限
+}
+
+// Match は検索に一致した 1 行。
+type Match struct {
+	Source string    `json:"source"`         // archive (保存済みのファイル) / docker (Docker のログ)
+	File   string    `json:"file,omitempty"` // 保存済みのファイル名
+	Line   int       `json:"line,omitempty"` // ファイル内の行番号 (1 始まり)
+	Time   time.Time `json:"time,omitzero"`
+	Text   string    `json:"text"` // 時刻を除いた行
+}
+
+// 検索対象の種類。
+const (
+	SourceArchive = "archive"
+	SourceDocker  = "docker"
+)
+
+// MARK: Search()
+// アーカイブを古い順に検索し、一致した行を最大 Limit 件返す。上限に達した場合は truncated を true とする。
+// 続きは最後の行の時刻を After に指定して取得できる。
+func Search(ctx context.Context, cfg *config.LogArchiveConfig, server string, opts SearchOptions) (matches []Match, truncated bool, err error) {
+	files, err := List(cfg, server)
+	if err != nil {
+		return nil, false, err
+	}
+	matches = []Match{}
+	for _, f := range files {
+		// 更新時刻が Since / After より前のファイルには、それ以降の行は含まれない。
+		if f.ModTime.Before(opts.Since) || f.ModTime.Before(opts.After) {
+			continue
+		}
+		file, err := Open(cfg, server, f.Name)
+		if err != nil {
+			continue
+		}
+		done, err := SearchStream(ctx, file, Match{Source: SourceArchive, File: f.Name}, opts, &matches)
+		file.Close()
+		if err != nil {
+			return nil, false, err
+		}
+		if done {
+			return matches, len(matches) >= opts.Limit, nil
+		}
+	}
+	return matches, false, nil
+}
+
+// MARK: SearchStream()
+// 先頭に時刻 (RFC 3339) を付与した行の並びを検索し、一致した行を base の情報を付けて matches へ追加する。
+// 件数の上限に達したか、Until より後の行に到達した場合は done を true とする。
+func SearchStream(ctx context.Context, r io.Reader, base Match, opts SearchOptions, matches *[]Match) (done bool, err error) {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, readErr := br.ReadString('\n')
+		if line != "" {
+			if n%1024 == 0 && ctx.Err() != nil {
+				return true, ctx.Err()
+			}
+			t, text, ok := splitLine(line)
+			if !ok {
+				text = strings.TrimRight(line, "\r\n")
+			}
+			switch {
+			case ok && !opts.Until.IsZero() && t.After(opts.Until):
+				return true, nil
+			case ok && t.Before(opts.Since):
+			case ok && !opts.After.IsZero() && !t.After(opts.After):
+			case opts.Regex != nil && !opts.Regex.MatchString(text):
+			case opts.Regex == nil && !strings.Contains(text, opts.Query):
+			default:
+				m := base
+				m.Time, m.Text = t, text
+				if m.File != "" {
+					m.Line = n
+				}
+				*matches = append(*matches, m)
+				if len(*matches) >= opts.Limit {
+					return true, nil
+				}
+			}
+		}
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				return false, nil
+			}
+			return false, readErr
+		}
+	}
+}
+
+// MARK: Prune()
+// 全てのサーバーのアーカイブから、保持期間・保持数を超えたローテーション済みのファイルを削除する。
+func Prune(cfg *config.LogArchiveConfig) {
+	if cfg == nil || cfg.Directory == "" {
+		return
+	}
+	servers, err := os.ReadDir(cfg.Directory)
+	if err != nil {
+		return
+	}
+	for _, server := range servers {
+		if server.IsDir() {
+			pruneDir(filepath.Join(cfg.Directory, server.Name()), cfg)
+		}
+	}
+}
+
+func pruneDir(dir string, cfg *config.LogArchiveConfig) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+fileExt))
+	matches = slices.DeleteFunc(matches, func(p string) bool { return filepath.Base(p) == currentFile })
+	slices.Sort(matches)
+	maxAge := time.Duration(cfg.MaxAgeDays) * 24 * time.Hour
+	for i, name := range matches {
+		expired := cfg.MaxFiles > 0 && i < len(matches)-cfg.MaxFiles
+		if !expired && maxAge > 0 {
+			if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(name); err != nil {
+				logger.Errorf("Internal", "LogArchive", "古いログの削除に失敗: %v", err)
+			}
+		}
+	}
+}
+
+// MARK: LastTime()
+// 指定サーバーの保存済みの最後の行の時刻を返す。保存済みの行が無い場合はゼロ値を返す。
+// Docker のログのうち、この時刻より後の行はまだ保存されていない。
+func LastTime(cfg *config.LogArchiveConfig, server string) time.Time {
+	if cfg == nil || cfg.Directory == "" || !validName(server) {
+		return time.Time{}
+	}
+	return lastTime(filepath.Join(cfg.Directory, server))
+}
+
+// lastTime は dir に保存済みの最後の行の時刻を返す。
+func lastTime(dir string) time.Time {
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+fileExt))
+	slices.Sort(names)
+	// current.log を最初に調べ、空の場合はローテーション直後とみなして新しい順に退避済みのファイルを調べる。
+	names = slices.DeleteFunc(names, func(p string) bool { return filepath.Base(p) == currentFile })
+	slices.Reverse(names)
+	names = append([]string{filepath.Join(dir, currentFile)}, names...)
+	for _, name := range names {
+		if t, ok := lastLineTime(name); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func lastLineTime(name string) (time.Time, bool) {
+	f, err := os.Open(name)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return time.Time{}, false
+	}
+	offset := max(0, info.Size()-tailProbeSize)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+		return time.Time{}, false
+	}
+	lines := strings.Split(strings.TrimRight(string(buf), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if t, _, ok := splitLine(lines[i]); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// splitLine は行の先頭の時刻と本文を分離する。
+func splitLine(line string) (time.Time, string, bool) {
+	ts, text, ok := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+	if !ok {
+		return time.Time{}, "", false
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return t, text, true
+}
+
+// validName はパスの 1 要素として安全に使用できる名前かを判定する。
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// validFileName はアーカイブのファイル名 (current.log または退避したファイル) かを判定する。
+func validFileName(name string) bool {
+	if name == currentFile {
+		return true
+	}
+	base, ok := strings.CutSuffix(name, fileExt)
+	if !ok {
+		return false
+	}
+	_, err := time.Parse(rotatedFormat, base)
+	return err == nil
+}
@@ -0,0 +1,117 @@
+package logformat
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/play-bin/internal/config"
+)
+
+// 正規化したログレベル。数値が大きいほど重大。
+var levelOrder = []string{"debug", "info", "warn", "error"}
+
+// knownLevels は levels で対応付けられていない表記を正規化するための、一般的なレベル名。
+var knownLevels = map[string]string{
+	"trace": "debug", "debug": "debug", "fine": "debug", "finer": "debug", "finest": "debug",
+	"info": "info", "information": "info", "notice": "info",
+	"warn": "warn", "warning": "warn",
+	"error": "error", "err": "error", "severe": "error", "fatal": "error", "critical": "error", "crit": "error",
+}
+
+// ansiEscape は色付け等の端末制御シーケンス。TTY 経由の出力でもパターンに一致させるため除去する。
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// MARK: Entry
+// 構造化したログの 1 行。
+type Entry struct {
+	Time    string `json:"time,omitempty"`
+	Level   string `json:"level,omitempty"` // debug, info, warn, error (判定できない場合は空)
+	Message string `json:"message"`
+	Raw     string `json:"raw"` // 制御シーケンスを含む元の行
+}
+
+// MARK: Parser
+// サーバーの logFormat に従ってログの行を分解する。
+// パターンに一致しない行 (スタックトレースの続き等) は、直前に一致した行のレベルを引き継ぐため、1 つのストリームごとに生成すること。
+type Parser struct {
+	re     *regexp.Regexp
+	levels map[string]string
+	last   string
+}
+
+// MARK: New()
+// logFormat からパーサーを生成する。cfg が nil の場合は分解せず、本文のみを返すパーサーとなる。
+func New(cfg *config.LogFormatConfig) (*Parser, error) {
+	p := &Parser{levels: make(map[string]string)}
+	if cfg == nil {
+		return p, nil
+	}
+	re, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+	for raw, level := range cfg.Levels {
+		p.levels[strings.ToLower(raw)] = level
+	}
+	return p, nil
+}
+
+// MARK: Parse()
+// 1 行を分解する。行末の改行は除去する。
+func (p *Parser) Parse(line string) Entry {
+	line = strings.TrimRight(line, "\r\n")
+	plain := ansiEscape.ReplaceAllString(line, "")
+	e := Entry{Message: plain, Raw: line}
+	if p.re == nil {
+		return e
+	}
+
+	m := p.re.FindStringSubmatch(plain)
+	if m == nil {
+		e.Level = p.last
+		return e
+	}
+	for i, name := range p.re.SubexpNames() {
+		switch name {
+		case "time":
+			e.Time = m[i]
+		case "level":
+			e.Level = p.normalize(m[i])
+		case "message":
+			e.Message = m[i]
+		}
+	}
+	p.last = e.Level
+	return e
+}
+
+// normalize はログ中のレベル表記を正規化する。判定できない表記は空を返す。
+func (p *Parser) normalize(raw string) string {
+	key := strings.ToLower(strings.TrimSpace(raw))
+	if level, ok := p.levels[key]; ok {
+		return level
+	}
+	return knownLevels[key]
+}
+
+// MARK: ParseLevel()
+// 絞り込みに指定されたレベル名を正規化する。
+func ParseLevel(s string) (string, error) {
+	if level, ok := knownLevels[strings.ToLower(s)]; ok {
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown log level %q (expected one of %s)", s, strings.Join(levelOrder, ", "))
+}
+
+// MARK: AtLeast()
+// 行のレベルが min 以上かを返す。レベルを判定できない行は info とみなす。
+func (e Entry) AtLeast(min string) bool {
+	level := e.Level
+	if level == "" {
+		level = "info"
+	}
+	return slices.Index(levelOrder, level) >= slices.Index(levelOrder, min)
+}
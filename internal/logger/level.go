@@ -0,0 +1,248 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// MARK: Level
+// ログの重要度。しきい値未満の重要度のログは出力しない。
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String は設定や API で使用する小文字の名前を返す。
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Label はテキスト形式の行に含める大文字の名前を返す。
+func (l Level) Label() string {
+	return strings.ToUpper(l.String())
+}
+
+// MARK: ParseLevel()
+// "debug" / "info" / "warn" ("warning") / "error" を解釈する。大文字・小文字は区別しない。
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", s)
+}
+
+// 出力形式。
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// MARK: Options
+// 設定ファイルから適用するログの出力設定。
+type Options struct {
+	Format   string           // "text" (既定) または "json"
+	Level    Level            // 全体のしきい値
+	Services map[string]Level // サービス名 (例: "API", "Discord") ごとのしきい値
+
+	File        *FileOptions   // 標準出力に加えて、ローテーションするファイルへ出力する
+	Syslog      *SyslogOptions // 標準出力に加えて、syslog へ出力する
+	BufferLines int            // /api/admin/logs で参照できるよう、メモリ上に保持する件数。0 は既定値 (DefaultBufferLines)
+}
+
+// settings は適用中の設定。出力のたびに参照するため、差し替えは atomic に行う。
+type settings struct {
+	format    string
+	level     Level
+	services  map[string]Level // 設定ファイルによるサービスごとのしきい値
+	overrides map[string]Level // 実行中に API から変更したしきい値 (キーが空文字列の場合は全体)
+
+	// 開いている出力先と、その設定。再読み込みで設定が変更されていなければ開き直さない。
+	file       *rotatingFile
+	fileOpts   FileOptions
+	syslog     *syslogSink
+	syslogOpts SyslogOptions
+}
+
+// sinks は標準出力以外の出力先を返す。
+func (s *settings) sinks() []sink {
+	var out []sink
+	if s.file != nil {
+		out = append(out, s.file)
+	}
+	if s.syslog != nil {
+		out = append(out, s.syslog)
+	}
+	return out
+}
+
+var (
+	active    atomic.Pointer[settings]
+	configMu  sync.Mutex // Configure / SetOverride の read-modify-write を直列化する
+	defaultSt = &settings{format: FormatText, level: LevelInfo}
+)
+
+func current() *settings {
+	if s := active.Load(); s != nil {
+		return s
+	}
+	return defaultSt
+}
+
+// levelFor はサービスに適用するしきい値を、実行中の変更 > 設定ファイルのサービス指定 > 全体の順で決定する。
+func (s *settings) levelFor(service string) Level {
+	if l, ok := s.overrides[service]; ok {
+		return l
+	}
+	if l, ok := s.services[service]; ok {
+		return l
+	}
+	if l, ok := s.overrides[""]; ok {
+		return l
+	}
+	return s.level
+}
+
+// MARK: Configure()
+// 設定ファイルの出力設定を適用する。API から実行中に変更したしきい値は維持する。
+// 出力先 (ファイル・syslog) は設定が変更された場合のみ開き直す。開けなかった出力先はエラーとして返し、それ以外の設定は適用する。
+func Configure(opts Options) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	prev := current()
+	format := opts.Format
+	if format != FormatJSON {
+		format = FormatText
+	}
+	next := &settings{
+		format:    format,
+		level:     opts.Level,
+		services:  maps.Clone(opts.Services),
+		overrides: prev.overrides,
+	}
+
+	var errs []error
+	var stale []sink
+	switch {
+	case opts.File != nil && prev.file != nil && *opts.File == prev.fileOpts:
+		next.file, next.fileOpts = prev.file, prev.fileOpts
+	case opts.File != nil:
+		f, err := openRotatingFile(*opts.File)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("log file: %w", err))
+		} else {
+			next.file, next.fileOpts = f, *opts.File
+		}
+	}
+	if prev.file != nil && next.file != prev.file {
+		stale = append(stale, prev.file)
+	}
+	switch {
+	case opts.Syslog != nil && prev.syslog != nil && *opts.Syslog == prev.syslogOpts:
+		next.syslog, next.syslogOpts = prev.syslog, prev.syslogOpts
+	case opts.Syslog != nil:
+		w, err := openSyslog(*opts.Syslog)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("syslog: %w", err))
+		} else {
+			next.syslog, next.syslogOpts = w, *opts.Syslog
+		}
+	}
+	if prev.syslog != nil && next.syslog != prev.syslog {
+		stale = append(stale, prev.syslog)
+	}
+
+	lines := opts.BufferLines
+	if lines <= 0 {
+		lines = DefaultBufferLines
+	}
+	recent.resize(lines)
+
+	active.Store(next)
+	// 書き込み中の出力先を閉じないよう、出力のロックを取得してから閉じる。
+	outputMu.Lock()
+	for _, sk := range stale {
+		sk.close()
+	}
+	outputMu.Unlock()
+	return errors.Join(errs...)
+}
+
+// MARK: SetOverride()
+// 実行中にしきい値を変更する。service が空の場合は全体のしきい値を変更する。再起動するまで設定ファイルより優先される。
+func SetOverride(service string, level Level) {
+	updateOverrides(func(o map[string]Level) { o[service] = level })
+}
+
+// MARK: ClearOverride()
+// 実行中に変更したしきい値を取り消し、設定ファイルの値へ戻す。
+func ClearOverride(service string) {
+	updateOverrides(func(o map[string]Level) { delete(o, service) })
+}
+
+func updateOverrides(fn func(map[string]Level)) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	next := *current()
+	next.overrides = maps.Clone(next.overrides)
+	if next.overrides == nil {
+		next.overrides = make(map[string]Level)
+	}
+	fn(next.overrides)
+	active.Store(&next)
+}
+
+// MARK: Status
+// 適用中のしきい値 (API の応答用)。
+type Status struct {
+	Format    string            `json:"format"`
+	Level     string            `json:"level"`               // 全体のしきい値 (実行中の変更を反映)
+	Services  map[string]string `json:"services,omitempty"`  // 設定ファイルによるサービスごとのしきい値
+	Overrides map[string]string `json:"overrides,omitempty"` // 実行中に変更したしきい値 (キー "" は全体)
+}
+
+// MARK: CurrentStatus()
+// 適用中の出力形式としきい値を返す。
+func CurrentStatus() Status {
+	s := current()
+	names := func(m map[string]Level) map[string]string {
+		if len(m) == 0 {
+			return nil
+		}
+		out := make(map[string]string, len(m))
+		for k, v := range m {
+			out[k] = v.String()
+		}
+		return out
+	}
+	return Status{
+		Format:    s.format,
+		Level:     s.levelFor("").String(),
+		Services:  names(s.services),
+		Overrides: names(s.overrides),
+	}
+}
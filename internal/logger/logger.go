@@ -1,24 +1,45 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 )
 
 // MARK: Log()
-// 指定されたレベルとサービス名でログを出力する。
-// 規約形式: [timestamp] [level] [service]: message
+// 指定された分類とサービス名で info レベルのログを出力する。
+// 規約形式: [timestamp] [severity] [level] [service]: message
+// level は発生源の分類 (Internal / Client / External)、severity は重要度 (DEBUG / INFO / WARN / ERROR) を表す。
 func Log(level, service, message string) {
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	fmt.Printf("[%s] [%s] [%s]: %s\n", timestamp, level, service, message)
+	write(LevelInfo, level, service, message)
 }
 
 // MARK: Logf()
-// フォーマット指定付きでログを出力する。
+// フォーマット指定付きで info レベルのログを出力する。
 func Logf(level, service, format string, v ...any) {
 	Log(level, service, fmt.Sprintf(format, v...))
 }
 
+// MARK: Debugf()
+// 調査時にのみ必要な詳細 (個々のファイル操作等) を debug レベルで出力する。
+func Debugf(level, service, format string, v ...any) {
+	write(LevelDebug, level, service, fmt.Sprintf(format, v...))
+}
+
+// MARK: Warnf()
+// 処理は継続できるが注意が必要な事象 (操作の拒否や不正な入力等) を warn レベルで出力する。
+func Warnf(level, service, format string, v ...any) {
+	write(LevelWarn, level, service, fmt.Sprintf(format, v...))
+}
+
+// MARK: Errorf()
+// 処理が失敗した事象を error レベルで出力する。
+func Errorf(level, service, format string, v ...any) {
+	write(LevelError, level, service, fmt.Sprintf(format, v...))
+}
+
 // MARK: Internal()
 // 内部エラーまたはシステムログを出力する。
 func Internal(service, message string) {
@@ -41,7 +62,7 @@ func External(service, message string) {
 // エラーレベルのログを出力する。
 func Error(service string, err error) {
 	if err != nil {
-		Internal(service, err.Error())
+		write(LevelError, "Internal", service, err.Error())
 	}
 }
 
@@ -49,7 +70,7 @@ func Error(service string, err error) {
 // 内部エラーをログに出力し、フォーマットされたエラーオブジェクトを返す。
 func InternalError(service, format string, v ...any) error {
 	msg := fmt.Sprintf(format, v...)
-	Internal(service, msg)
+	write(LevelError, "Internal", service, msg)
 	return fmt.Errorf("[%s] %s", service, msg)
 }
 
@@ -57,7 +78,7 @@ func InternalError(service, format string, v ...any) error {
 // クライアント起因のエラーをログに出力し、エラーオブジェクトを返す。
 func ClientError(service, format string, v ...any) error {
 	msg := fmt.Sprintf(format, v...)
-	Client(service, msg)
+	write(LevelWarn, "Client", service, msg)
 	return fmt.Errorf("[%s] %s", service, msg)
 }
 
@@ -65,6 +86,58 @@ func ClientError(service, format string, v ...any) error {
 // 外部依存関係のエラーをログに出力し、エラーオブジェクトを返す。
 func ExternalError(service, format string, v ...any) error {
 	msg := fmt.Sprintf(format, v...)
-	External(service, msg)
+	write(LevelError, "External", service, msg)
 	return fmt.Errorf("[%s] %s", service, msg)
 }
+
+// MARK: Entry
+// 1 件のログ。JSON 形式の出力と、リングバッファからの取得 (/api/admin/logs) で使用する。
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Severity  string    `json:"severity"` // debug / info / warn / error
+	Level     string    `json:"level"`    // Internal / Client / External
+	Service   string    `json:"service"`
+	RequestID string    `json:"requestId,omitempty"` // 操作の起点 (HTTP リクエスト・Discord のインタラクション) の ID
+	Message   string    `json:"message"`
+}
+
+// outputMu は複数の出力先へ書き込む行が混ざらないよう、書き込みを直列化する。
+var outputMu sync.Mutex
+
+// write は重要度がサービスのしきい値以上の場合のみ、設定された形式で全ての出力先へ書き込む。
+func write(severity Level, level, service, message string) {
+	writeEntry(severity, Entry{Level: level, Service: service, Message: message})
+}
+
+// writeEntry は write の本体。e の時刻と重要度はここで設定する。
+func writeEntry(severity Level, e Entry) {
+	s := current()
+	if severity < s.levelFor(e.Service) {
+		return
+	}
+
+	e.Time, e.Severity = time.Now(), severity.String()
+	var line []byte
+	if s.format == FormatJSON {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = append(b, '\n')
+	} else {
+		prefix := fmt.Sprintf("[%s] [%s] [%s] [%s]", e.Time.Format("2006-01-02 15:04:05"), severity.Label(), e.Level, e.Service)
+		if e.RequestID != "" {
+			prefix += " [req=" + e.RequestID + "]"
+		}
+		line = fmt.Appendf(nil, "%s: %s\n", prefix, e.Message)
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	recent.add(e)
+	os.Stdout.Write(line)
+	for _, sk := range s.sinks() {
+		// 出力先の障害でログ出力が止まらないよう、書き込みの失敗は無視する。
+		sk.write(severity, e, line)
+	}
+}
@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+type requestIDKey struct{}
+
+// MARK: NewRequestID()
+// 操作の起点ごとに割り当てる、推測や衝突の心配がない短い ID を生成する。
+func NewRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MARK: WithRequestID()
+// リクエスト ID をコンテキストへ関連付ける。以降、このコンテキストを受け取った処理のログ (For) に ID が付与される。
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// MARK: RequestID()
+// コンテキストに関連付けられたリクエスト ID を返す。関連付けられていない場合は空文字列を返す。
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// MARK: Scoped
+// リクエスト ID を付与してログを出力する。失敗した操作をリクエストの受付からコンテナ・Docker の処理、ジョブまで追跡できるようにする。
+type Scoped struct {
+	requestID string
+}
+
+// MARK: For()
+// コンテキストのリクエスト ID を付与するロガーを返す。ID が無い場合は通常のログと同じ出力となる。
+func For(ctx context.Context) Scoped {
+	return Scoped{requestID: RequestID(ctx)}
+}
+
+func (s Scoped) write(severity Level, level, service, message string) {
+	writeEntry(severity, Entry{Level: level, Service: service, RequestID: s.requestID, Message: message})
+}
+
+// Log は info レベルのログを出力する。
+func (s Scoped) Log(level, service, message string) {
+	s.write(LevelInfo, level, service, message)
+}
+
+// Logf はフォーマット指定付きで info レベルのログを出力する。
+func (s Scoped) Logf(level, service, format string, v ...any) {
+	s.write(LevelInfo, level, service, fmt.Sprintf(format, v...))
+}
+
+// Debugf は debug レベルのログを出力する。
+func (s Scoped) Debugf(level, service, format string, v ...any) {
+	s.write(LevelDebug, level, service, fmt.Sprintf(format, v...))
+}
+
+// Warnf は warn レベルのログを出力する。
+func (s Scoped) Warnf(level, service, format string, v ...any) {
+	s.write(LevelWarn, level, service, fmt.Sprintf(format, v...))
+}
+
+// Errorf は error レベルのログを出力する。
+func (s Scoped) Errorf(level, service, format string, v ...any) {
+	s.write(LevelError, level, service, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,261 @@
+package logger
+
+import (
+	"fmt"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MARK: sink
+// 標準出力以外のログの出力先。write は outputMu を保持した状態で呼び出される。
+type sink interface {
+	write(severity Level, e Entry, line []byte) error
+	close() error
+}
+
+// MARK: FileOptions
+// ローテーションするファイルへの出力設定。
+type FileOptions struct {
+	Path        string        // 出力先のファイル
+	MaxSize     int64         // このサイズ (バイト) を超える場合にローテーションする。0 は無制限
+	RotateEvery time.Duration // ファイルを開いてからこの時間が経過した場合にローテーションする。0 は無効
+	MaxAge      time.Duration // ローテーション済みのファイルを保持する期間。0 は無期限
+	MaxBackups  int           // ローテーション済みのファイルを保持する数。0 は無制限
+}
+
+// MARK: SyslogOptions
+// syslog への出力設定。
+type SyslogOptions struct {
+	Network string // "udp" / "tcp" / "unix"。空の場合はローカルの syslog デーモン
+	Address string
+	Tag     string // 空の場合は "play-bin"
+}
+
+// MARK: > rotatingFile
+// サイズまたは経過時間でローテーションするファイル。ローテーション済みのファイルは "<path>.<20060102-150405.000>" とする。
+type rotatingFile struct {
+	opts     FileOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func openRotatingFile(opts FileOptions) (*rotatingFile, error) {
+	r := &rotatingFile{opts: opts}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	// 既存のファイルへ追記する場合も、経過時間は作成時刻に近い更新時刻ではなく開いた時点から数える。
+	r.openedAt = time.Now()
+	return nil
+}
+
+func (r *rotatingFile) write(_ Level, _ Entry, line []byte) error {
+	if r.shouldRotate(int64(len(line))) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotatingFile) shouldRotate(next int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxSize > 0 && r.size+next > r.opts.MaxSize {
+		return true
+	}
+	return r.opts.RotateEvery > 0 && time.Since(r.openedAt) >= r.opts.RotateEvery
+}
+
+// rotate は現在のファイルを退避して新しいファイルを開き、保持期間・保持数を超えた古いファイルを削除する。
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	rotated := r.opts.Path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(r.opts.Path, rotated); err != nil {
+		// 退避できない場合も出力を継続するため、同じファイルを開き直す。
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.prune()
+	return nil
+}
+
+func (r *rotatingFile) prune() {
+	matches, _ := filepath.Glob(r.opts.Path + ".*")
+	// タイムスタンプの接尾辞は辞書順が時刻順となるため、末尾が最新となる。
+	slices.Sort(matches)
+	for i, name := range matches {
+		expired := r.opts.MaxBackups > 0 && i < len(matches)-r.opts.MaxBackups
+		if !expired && r.opts.MaxAge > 0 {
+			if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > r.opts.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(name)
+		}
+	}
+}
+
+func (r *rotatingFile) close() error {
+	return r.file.Close()
+}
+
+// MARK: > syslogSink
+// 重要度を syslog の優先度へ対応付けて出力する。時刻は syslog 側で付与されるため、本文には含めない。
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func openSyslog(opts SyslogOptions) (*syslogSink, error) {
+	tag := opts.Tag
+	if tag == "" {
+		tag = "play-bin"
+	}
+	w, err := syslog.Dial(opts.Network, opts.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) write(severity Level, e Entry, _ []byte) error {
+	msg := fmt.Sprintf("[%s] [%s]: %s", e.Level, e.Service, e.Message)
+	if e.RequestID != "" {
+		msg = fmt.Sprintf("[%s] [%s] [req=%s]: %s", e.Level, e.Service, e.RequestID, e.Message)
+	}
+	switch severity {
+	case LevelDebug:
+		return s.w.Debug(msg)
+	case LevelWarn:
+		return s.w.Warning(msg)
+	case LevelError:
+		return s.w.Err(msg)
+	default:
+		return s.w.Info(msg)
+	}
+}
+
+func (s *syslogSink) close() error {
+	return s.w.Close()
+}
+
+// MARK: > ringBuffer
+// 直近のログをメモリ上に保持し、UI から play-bin 自身のログを参照できるようにする。
+type ringBuffer struct {
+	entries []Entry
+	next    int  // 次に書き込む位置
+	full    bool // 一周して古いログを上書きしているか
+	mu      sync.Mutex
+}
+
+// DefaultBufferLines はリングバッファに保持するログの既定の件数。
+const DefaultBufferLines = 1000
+
+var recent = &ringBuffer{entries: make([]Entry, DefaultBufferLines)}
+
+func (b *ringBuffer) add(e Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) == 0 {
+		return
+	}
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// snapshot は保持しているログを古い順に返す。
+func (b *ringBuffer) snapshot() []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return slices.Clone(b.entries[:b.next])
+	}
+	return append(slices.Clone(b.entries[b.next:]), b.entries[:b.next]...)
+}
+
+// resize は保持件数を変更する。新しいログから順に、変更後の件数まで引き継ぐ。
+func (b *ringBuffer) resize(n int) {
+	current := b.snapshot()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n == len(b.entries) {
+		return
+	}
+	if len(current) > n {
+		current = current[len(current)-n:]
+	}
+	b.entries = make([]Entry, n)
+	copy(b.entries, current)
+	b.next, b.full = len(current)%max(n, 1), len(current) == n && n > 0
+}
+
+// MARK: Query
+// Recent で取得するログの条件。
+type Query struct {
+	Limit    int    // 新しい順に最大何件を返すか。0 は全件
+	Severity Level  // この重要度以上のみ
+	Service  string // 空でない場合はこのサービスのみ
+	Contains string // 空でない場合はメッセージにこの文字列を含むもののみ
+
+	RequestID string // 空でない場合はこのリクエストに関連するもののみ
+}
+
+// MARK: Recent()
+// リングバッファに保持している直近のログを、条件に一致するものに絞り込んで古い順に返す。
+func Recent(q Query) []Entry {
+	var out []Entry
+	for _, e := range recent.snapshot() {
+		if l, err := ParseLevel(e.Severity); err == nil && l < q.Severity {
+			continue
+		}
+		if q.Service != "" && e.Service != q.Service {
+			continue
+		}
+		if q.Contains != "" && !strings.Contains(e.Message, q.Contains) {
+			continue
+		}
+		if q.RequestID != "" && e.RequestID != q.RequestID {
+			continue
+		}
+		out = append(out, e)
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package mods
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/play-bin/internal/config"
+)
+
+const curseForgeAPI = "https://api.curseforge.com/v1"
+
+// curseForgeLoaders は CurseForge API の modLoaderType の値。
+var curseForgeLoaders = map[string]int{
+	"forge":    1,
+	"fabric":   4,
+	"quilt":    5,
+	"neoforge": 6,
+}
+
+// curseForgeHashSHA1 は CurseForge API のハッシュ種別 (algo) のうち SHA-1 を表す値。
+const curseForgeHashSHA1 = 1
+
+type curseForgeFile struct {
+	ID          int       `json:"id"`
+	ModID       int       `json:"modId"`
+	DisplayName string    `json:"displayName"`
+	FileName    string    `json:"fileName"`
+	FileDate    time.Time `json:"fileDate"`
+	DownloadURL string    `json:"downloadUrl"`
+	Hashes      []struct {
+		Value string `json:"value"`
+		Algo  int    `json:"algo"`
+	} `json:"hashes"`
+}
+
+// curseForgeKey は API キーを返す。apiKeyFile が指定されている場合はファイルから読み込む。
+func curseForgeKey(cfg *config.CurseForgeConfig) (string, error) {
+	if cfg == nil {
+		return "", errors.New("curseforge is not configured")
+	}
+	if cfg.APIKeyFile != "" {
+		b, err := os.ReadFile(cfg.APIKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read apiKeyFile: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	if cfg.APIKey == "" {
+		return "", errors.New("curseforge is not configured")
+	}
+	return cfg.APIKey, nil
+}
+
+// MARK: resolveCurseForge()
+// CurseForge の Mod ID から、ローダーとゲームバージョンに互換性のあるファイルを解決する。
+func resolveCurseForge(ctx context.Context, apiKey string, modsCfg *config.ModsConfig, projectID, versionID string) (release, error) {
+	if _, err := strconv.Atoi(projectID); err != nil {
+		return release{}, fmt.Errorf("curseforge project must be a numeric mod id: %q", projectID)
+	}
+	header := http.Header{"X-Api-Key": []string{apiKey}}
+
+	var file curseForgeFile
+	if versionID != "" {
+		var resp struct {
+			Data curseForgeFile `json:"data"`
+		}
+		if err := getJSON(ctx, curseForgeAPI+"/mods/"+projectID+"/files/"+url.PathEscape(versionID), header, &resp); err != nil {
+			return release{}, err
+		}
+		file = resp.Data
+	} else {
+		q := url.Values{}
+		if modsCfg.GameVersion != "" {
+			q.Set("gameVersion", modsCfg.GameVersion)
+		}
+		if t, ok := curseForgeLoaders[strings.ToLower(modsCfg.Loader)]; ok {
+			q.Set("modLoaderType", strconv.Itoa(t))
+		}
+		var resp struct {
+			Data []curseForgeFile `json:"data"`
+		}
+		if err := getJSON(ctx, curseForgeAPI+"/mods/"+projectID+"/files?"+q.Encode(), header, &resp); err != nil {
+			return release{}, err
+		}
+		if len(resp.Data) == 0 {
+			return release{}, ErrNotFound
+		}
+		sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].FileDate.After(resp.Data[j].FileDate) })
+		file = resp.Data[0]
+	}
+
+	// 作者が外部ツールからの配布を許可していないファイルは downloadUrl が空になる。
+	if file.DownloadURL == "" {
+		return release{}, fmt.Errorf("file %s does not allow third-party downloads", file.FileName)
+	}
+
+	rel := release{
+		origin: origin{
+			Source:    "curseforge",
+			ProjectID: strconv.Itoa(file.ModID),
+			VersionID: strconv.Itoa(file.ID),
+			Version:   file.DisplayName,
+		},
+		FileName: file.FileName,
+		URL:      file.DownloadURL,
+	}
+	for _, h := range file.Hashes {
+		if h.Algo == curseForgeHashSHA1 {
+			rel.HashAlgo, rel.Hash = "sha1", h.Value
+			break
+		}
+	}
+	return rel, nil
+}
@@ -0,0 +1,84 @@
+package mods
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/play-bin/internal/config"
+)
+
+const modrinthAPI = "https://api.modrinth.com/v2"
+
+type modrinthVersion struct {
+	ID            string    `json:"id"`
+	ProjectID     string    `json:"project_id"`
+	VersionNumber string    `json:"version_number"`
+	DatePublished time.Time `json:"date_published"`
+	Files         []struct {
+		URL      string `json:"url"`
+		Filename string `json:"filename"`
+		Primary  bool   `json:"primary"`
+		Hashes   struct {
+			SHA512 string `json:"sha512"`
+			SHA1   string `json:"sha1"`
+		} `json:"hashes"`
+	} `json:"files"`
+}
+
+// MARK: resolveModrinth()
+// Modrinth のプロジェクト（ID またはスラッグ）から、ローダーとゲームバージョンに互換性のあるバージョンを解決する。
+func resolveModrinth(ctx context.Context, modsCfg *config.ModsConfig, projectID, versionID string) (release, error) {
+	var v modrinthVersion
+	if versionID != "" {
+		if err := getJSON(ctx, modrinthAPI+"/version/"+url.PathEscape(versionID), nil, &v); err != nil {
+			return release{}, err
+		}
+	} else {
+		q := url.Values{}
+		if modsCfg.Loader != "" {
+			b, _ := json.Marshal([]string{modsCfg.Loader})
+			q.Set("loaders", string(b))
+		}
+		if modsCfg.GameVersion != "" {
+			b, _ := json.Marshal([]string{modsCfg.GameVersion})
+			q.Set("game_versions", string(b))
+		}
+		var versions []modrinthVersion
+		if err := getJSON(ctx, modrinthAPI+"/project/"+url.PathEscape(projectID)+"/version?"+q.Encode(), nil, &versions); err != nil {
+			return release{}, err
+		}
+		if len(versions) == 0 {
+			return release{}, ErrNotFound
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i].DatePublished.After(versions[j].DatePublished) })
+		v = versions[0]
+	}
+
+	if len(v.Files) == 0 {
+		return release{}, fmt.Errorf("version %s has no files", v.ID)
+	}
+	// 複数ファイルがある場合は primary を優先し、無ければ先頭のファイルを使用する。
+	file := v.Files[0]
+	for _, f := range v.Files {
+		if f.Primary {
+			file = f
+			break
+		}
+	}
+
+	rel := release{
+		origin:   origin{Source: "modrinth", ProjectID: v.ProjectID, VersionID: v.ID, Version: v.VersionNumber},
+		FileName: file.Filename,
+		URL:      file.URL,
+	}
+	if file.Hashes.SHA512 != "" {
+		rel.HashAlgo, rel.Hash = "sha512", file.Hashes.SHA512
+	} else if file.Hashes.SHA1 != "" {
+		rel.HashAlgo, rel.Hash = "sha1", file.Hashes.SHA1
+	}
+	return rel, nil
+}
@@ -0,0 +1,350 @@
+package mods
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+// metadataFile はダウンロードした Mod の取得元を記録するファイル。Mod ディレクトリ直下に配置する。
+const metadataFile = ".play-bin-mods.json"
+
+// userAgent は Modrinth の API 利用規約で要求される、クライアントを識別するための User-Agent。
+const userAgent = "play-bin (https://github.com/aatomu/play-bin)"
+
+// httpClient は外部 API とダウンロードに使用するクライアント。大きな Mod のダウンロードを考慮して長めのタイムアウトとする。
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+var (
+	ErrNotConfigured = errors.New("mods is not configured for this server")
+	ErrRemoteHost    = errors.New("mods is not supported for servers on remote docker hosts")
+	ErrInvalidFile   = errors.New("invalid file name")
+	ErrNotFound      = errors.New("no compatible version found")
+)
+
+// Installed は Mod ディレクトリ内のファイル 1 件を表す。
+type Installed struct {
+	FileName  string    `json:"fileName"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	Source    string    `json:"source,omitempty"`    // "modrinth", "curseforge"。手動で配置したファイルは空
+	ProjectID string    `json:"projectId,omitempty"` // 取得元のプロジェクト ID
+	VersionID string    `json:"versionId,omitempty"` // 取得元のバージョン（ファイル）ID
+	Version   string    `json:"version,omitempty"`   // 表示用のバージョン名
+}
+
+// origin はダウンロードした Mod の取得元情報。
+type origin struct {
+	Source    string `json:"source"`
+	ProjectID string `json:"projectId"`
+	VersionID string `json:"versionId"`
+	Version   string `json:"version"`
+}
+
+// release は取得元から解決した、ダウンロード対象のファイル。
+type release struct {
+	origin
+	FileName string
+	URL      string
+	HashAlgo string // "sha512", "sha1"
+	Hash     string
+}
+
+// dirLocks はサーバーごとに Mod ディレクトリの更新を直列化する。
+var dirLocks sync.Map
+
+// MARK: List()
+// Mod ディレクトリ内の .jar ファイルを、記録済みの取得元情報と共に返す。
+func List(serverName string, serverCfg config.ServerConfig) ([]Installed, error) {
+	dir, err := directory(serverName, serverCfg)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Installed{}, nil
+		}
+		return nil, err
+	}
+	meta := loadMetadata(dir)
+
+	list := []Installed{}
+	for _, e := range entries {
+		if e.IsDir() || !isModFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		item := Installed{FileName: e.Name(), Size: info.Size(), ModTime: info.ModTime()}
+		if o, ok := meta[e.Name()]; ok {
+			item.Source = o.Source
+			item.ProjectID = o.ProjectID
+			item.VersionID = o.VersionID
+			item.Version = o.Version
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].FileName) < strings.ToLower(list[j].FileName) })
+	return list, nil
+}
+
+// MARK: Install()
+// 取得元から互換性のあるバージョンをダウンロードして配置する。versionID が空の場合は最新の互換バージョンを選択する。
+// 同じプロジェクトの旧バージョンが配置済みであれば置き換える（更新）。
+func Install(ctx context.Context, cfg config.Config, serverName, source, projectID, versionID string) (Installed, error) {
+	serverCfg := cfg.Servers[serverName]
+	dir, err := directory(serverName, serverCfg)
+	if err != nil {
+		return Installed{}, err
+	}
+	if projectID == "" {
+		return Installed{}, errors.New("project is required")
+	}
+
+	var rel release
+	switch source {
+	case "modrinth":
+		rel, err = resolveModrinth(ctx, serverCfg.Mods, projectID, versionID)
+	case "curseforge":
+		var key string
+		if key, err = curseForgeKey(cfg.CurseForge); err == nil {
+			rel, err = resolveCurseForge(ctx, key, serverCfg.Mods, projectID, versionID)
+		}
+	default:
+		return Installed{}, fmt.Errorf("unknown source: %q", source)
+	}
+	if err != nil {
+		return Installed{}, err
+	}
+	if !validFileName(rel.FileName) {
+		return Installed{}, fmt.Errorf("%w: %q", ErrInvalidFile, rel.FileName)
+	}
+
+	unlock := lockDir(dir)
+	defer unlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Installed{}, err
+	}
+	if err := download(ctx, rel, filepath.Join(dir, rel.FileName)); err != nil {
+		return Installed{}, err
+	}
+
+	// 同じプロジェクトの旧ファイルを削除し、新しいファイルの取得元を記録する。
+	meta := loadMetadata(dir)
+	for name, o := range meta {
+		if name != rel.FileName && o.Source == rel.Source && o.ProjectID == rel.ProjectID {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+				logger.For(ctx).Errorf("Internal", "Mods", "旧バージョンの削除に失敗(%s): %s: %v", serverName, name, err)
+				continue
+			}
+			delete(meta, name)
+			logger.For(ctx).Logf("Internal", "Mods", "旧バージョンを削除しました(%s): %s", serverName, name)
+		}
+	}
+	meta[rel.FileName] = rel.origin
+	if err := saveMetadata(dir, meta); err != nil {
+		logger.For(ctx).Errorf("Internal", "Mods", "取得元情報の保存に失敗(%s): %v", serverName, err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, rel.FileName))
+	if err != nil {
+		return Installed{}, err
+	}
+	logger.For(ctx).Logf("Internal", "Mods", "Mod を配置しました(%s): %s (%s %s %s)", serverName, rel.FileName, rel.Source, rel.ProjectID, rel.Version)
+	return Installed{
+		FileName:  rel.FileName,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Source:    rel.Source,
+		ProjectID: rel.ProjectID,
+		VersionID: rel.VersionID,
+		Version:   rel.Version,
+	}, nil
+}
+
+// MARK: Update()
+// 取得元が記録されているファイルを、同じプロジェクトの最新の互換バージョンへ更新する。
+func Update(ctx context.Context, cfg config.Config, serverName, fileName string) (Installed, error) {
+	dir, err := directory(serverName, cfg.Servers[serverName])
+	if err != nil {
+		return Installed{}, err
+	}
+	o, ok := loadMetadata(dir)[fileName]
+	if !ok {
+		return Installed{}, fmt.Errorf("%s was not installed from a known source", fileName)
+	}
+	return Install(ctx, cfg, serverName, o.Source, o.ProjectID, "")
+}
+
+// MARK: Remove()
+// Mod ディレクトリからファイルを削除する。
+func Remove(serverName string, serverCfg config.ServerConfig, fileName string) error {
+	dir, err := directory(serverName, serverCfg)
+	if err != nil {
+		return err
+	}
+	if !validFileName(fileName) || !isModFile(fileName) {
+		return ErrInvalidFile
+	}
+
+	unlock := lockDir(dir)
+	defer unlock()
+
+	if err := os.Remove(filepath.Join(dir, fileName)); err != nil {
+		return err
+	}
+	meta := loadMetadata(dir)
+	if _, ok := meta[fileName]; ok {
+		delete(meta, fileName)
+		if err := saveMetadata(dir, meta); err != nil {
+			logger.Errorf("Internal", "Mods", "取得元情報の保存に失敗(%s): %v", serverName, err)
+		}
+	}
+	logger.Logf("Internal", "Mods", "Mod を削除しました(%s): %s", serverName, fileName)
+	return nil
+}
+
+// directory は Mod ディレクトリの絶対パスを解決する。
+func directory(serverName string, serverCfg config.ServerConfig) (string, error) {
+	if serverCfg.Mods == nil || serverCfg.Mods.Directory == "" {
+		return "", ErrNotConfigured
+	}
+	// Mod ディレクトリはバインドマウント元であり、リモートホスト上のファイルには触れられない。
+	if !docker.IsLocal(serverName) {
+		return "", ErrRemoteHost
+	}
+	dir := serverCfg.Mods.Directory
+	if !filepath.IsAbs(dir) && serverCfg.WorkingDir != "" {
+		dir = filepath.Join(serverCfg.WorkingDir, dir)
+	}
+	return dir, nil
+}
+
+func lockDir(dir string) func() {
+	l, _ := dirLocks.LoadOrStore(dir, &sync.Mutex{})
+	mu := l.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// validFileName はディレクトリ外を指さない単一のファイル名であるかを検証する。
+func validFileName(name string) bool {
+	return name != "" && name == filepath.Base(name) && name != "." && name != ".." && !strings.HasPrefix(name, ".")
+}
+
+func isModFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".jar")
+}
+
+func loadMetadata(dir string) map[string]origin {
+	meta := make(map[string]origin)
+	b, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		return meta
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		logger.Errorf("Internal", "Mods", "取得元情報のパースに失敗(%s): %v", dir, err)
+		return make(map[string]origin)
+	}
+	return meta
+}
+
+func saveMetadata(dir string, meta map[string]origin) error {
+	return fsutil.WriteJSON(filepath.Join(dir, metadataFile), meta, 0o644)
+}
+
+// download はファイルを一時ファイルへダウンロードし、ハッシュを検証してから配置する。
+func download(ctx context.Context, rel release, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rel.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var h hash.Hash
+	switch rel.HashAlgo {
+	case "sha512":
+		h = sha512.New()
+	case "sha1":
+		h = sha1.New()
+	}
+	var w io.Writer = tmp
+	if h != nil {
+		w = io.MultiWriter(tmp, h)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if h != nil && !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), rel.Hash) {
+		return fmt.Errorf("checksum mismatch for %s", rel.FileName)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// getJSON は外部 API へ GET リクエストを送り、JSON 応答をデコードする。
+func getJSON(ctx context.Context, url string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed: %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,159 @@
+package netutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// MARK: SplitAddresses()
+// カンマ区切りの待ち受けアドレス (例: "127.0.0.1:8080,[::1]:8080") を分割する。空の項目は含めない。
+func SplitAddresses(addrs string) []string {
+	var out []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// MARK: ValidListen()
+// 待ち受けアドレスとして解釈できるかを返す。IPv6 のアドレスは "[::1]:8080" のように角括弧で囲む。
+func ValidListen(addrs string) bool {
+	list := SplitAddresses(addrs)
+	if len(list) == 0 {
+		return false
+	}
+	for _, addr := range list {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || port == "" {
+			return false
+		}
+		if _, err := net.LookupPort("tcp", port); err != nil {
+			return false
+		}
+		if strings.Contains(host, ":") {
+			if _, err := netip.ParseAddr(host); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MARK: Listen()
+// カンマ区切りの全てのアドレスで TCP の待ち受けを開始し、1 つのリスナーとして返す。
+// ホストを省略したアドレス (":8080") と "[::]:8080" は IPv4 と IPv6 の両方で待ち受ける。
+// "0.0.0.0:8080,[::1]:8080" のように、アドレスファミリーごとに異なるアドレスで待ち受ける場合に複数指定する。
+func Listen(addrs string) (net.Listener, error) {
+	list := SplitAddresses(addrs)
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no listen address")
+	}
+	if len(list) == 1 {
+		return net.Listen("tcp", list[0])
+	}
+
+	m := &multiListener{conns: make(chan acceptResult), done: make(chan struct{})}
+	for _, addr := range list {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.listeners = append(m.listeners, ln)
+	}
+	for _, ln := range m.listeners {
+		m.wg.Add(1)
+		go m.accept(ln)
+	}
+	return m, nil
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// multiListener は複数のリスナーで受け付けた接続を、1 つのリスナーとして Accept できるようにまとめる。
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (m *multiListener) accept(ln net.Listener) {
+	defer m.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		select {
+		case m.conns <- acceptResult{conn, err}:
+		case <-m.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-m.conns:
+		return r.conn, r.err
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (m *multiListener) Close() error {
+	var errs []error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, ln := range m.listeners {
+			errs = append(errs, ln.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Addr は最初のアドレスを返す。
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
+
+// MARK: RemoteIP()
+// "host:port" 形式の接続元アドレスから IP アドレスを取り出す。
+// デュアルスタックで待ち受けた場合の IPv4 射影アドレス ("::ffff:192.0.2.1") は IPv4 の表記へ戻す。
+func RemoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	return ip.Unmap().String()
+}
+
+// MARK: ClientKey()
+// 流量制限等で接続元をまとめる単位を返す。IPv4 はアドレスごと、IPv6 は 1 つの回線に割り当てられる /64 ごととする。
+// IPv6 ではアドレスを容易に変えられるため、アドレスごとに数えると制限を回避できる。
+func ClientKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return ip
+	}
+	prefix, _ := addr.WithZone("").Prefix(64)
+	return prefix.String()
+}
@@ -0,0 +1,243 @@
+package notify
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/preferences"
+)
+
+const (
+	// mailCooldown は同じ種類・サーバーのイベントを再び通知するまでの間隔。ログインの拒否等が続いた場合にメールが殺到しないようにする。
+	mailCooldown = 10 * time.Minute
+	// mailTimeout は 1 通の送信 (接続から切断まで) の期限。
+	mailTimeout = 30 * time.Second
+)
+
+// 既定の件名と本文。notifications.templates で種類ごとに置き換えられる。
+const (
+	defaultSubject = "[play-bin] {{.Summary}}"
+	defaultBody    = `{{.Summary}}
+
+Event: {{.Kind}} ({{.Severity}})
+{{if .Server}}Server: {{.Server}}
+{{end}}Time: {{.Time.Format "2006-01-02 15:04:05 MST"}}
+Host: {{.Hostname}}
+{{range $k, $v := .Details}}{{if $v}}{{$k}}: {{$v}}
+{{end}}{{end}}`
+)
+
+// templateData はテンプレートへ渡す値。イベントの各項目に加え、送信元のホスト名を参照できる。
+type templateData struct {
+	Event
+	Hostname string
+}
+
+// MARK: Mailer
+// 通知イベントを購読し、イベントの種類を notify (設定ファイル、またはユーザー自身の設定) に含むユーザーへメールで送信する。
+// サーバーのイベントはそのサーバーの閲覧権限 (container.read)、ホスト全体のイベント (disk, login_lockout) は admin.logs を持つユーザーのみを宛先とする。
+type Mailer struct {
+	Config *config.LoadedConfig
+	// Preferences はユーザー自身が /api/me/preferences で登録した受け取るイベント。nil の場合は設定ファイルの notify のみとする
+	Preferences *preferences.Store
+
+	mu   sync.Mutex
+	sent map[string]time.Time // 抑制のキー -> 最後に通知した時刻
+}
+
+// MARK: NewMailer()
+func NewMailer(cfg *config.LoadedConfig) *Mailer {
+	return &Mailer{Config: cfg, sent: make(map[string]time.Time)}
+}
+
+// MARK: Start()
+// イベントの受け取りを開始する。送信は 1 件ずつ行い、送信中に発生したイベントはキューで待機する。
+// notifications が未設定の間に受け取ったイベントは破棄する。
+func (m *Mailer) Start() {
+	queue := Events.Queue("mail")
+	go func() {
+		for {
+			m.handle(queue.Next())
+		}
+	}()
+}
+
+// handle は 1 件のイベントを宛先ごとに送信する。
+func (m *Mailer) handle(ev Event) {
+	cfg := m.Config.Get()
+	n := cfg.Notifications
+	if n == nil {
+		return
+	}
+	recipients := Recipients(cfg, ev, m.Preferences)
+	if len(recipients) == 0 || !m.allow(ev) {
+		return
+	}
+
+	subject, body, err := render(n.Templates[ev.Kind], ev)
+	if err != nil {
+		logger.Errorf("Internal", "Notify", "通知メールのテンプレートの描画に失敗: kind=%s, err=%v", ev.Kind, err)
+		return
+	}
+	for _, to := range recipients {
+		if err := sendMail(n.SMTP, to, subject, body); err != nil {
+			logger.Errorf("External", "Notify", "通知メールの送信に失敗: kind=%s, to=%s, err=%v", ev.Kind, to, err)
+			continue
+		}
+		logger.Logf("Internal", "Notify", "通知メールを送信しました: kind=%s, server=%s, to=%s", ev.Kind, ev.Server, to)
+	}
+}
+
+// allow は同じイベントを mailCooldown 以内に通知済みでなければ、通知した時刻を記録して true を返す。
+func (m *Mailer) allow(ev Event) bool {
+	key := ev.Kind + "\x00" + ev.Server + "\x00" + ev.Key
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	maps.DeleteFunc(m.sent, func(_ string, at time.Time) bool { return now.Sub(at) >= mailCooldown })
+	if _, ok := m.sent[key]; ok {
+		return false
+	}
+	m.sent[key] = now
+	return true
+}
+
+// MARK: Recipients()
+// イベントを受け取るユーザーのメールアドレスを、ユーザー名の順で返す。prefs が nil の場合は設定ファイルの notify のみを参照する。
+func Recipients(cfg config.Config, ev Event, prefs *preferences.Store) []string {
+	var out []string
+	for _, name := range slices.Sorted(maps.Keys(cfg.Users)) {
+		user := cfg.Users[name]
+		if user.Email == "" || (!slices.Contains(user.Notify, ev.Kind) && !slices.Contains(prefs.Notify(name), ev.Kind)) {
+			continue
+		}
+		permitted := user.HasPermission("*", config.PermAdminLogs)
+		if ev.Server != "" {
+			permitted = user.HasPermission(ev.Server, config.PermContainerRead)
+		}
+		if permitted && !slices.Contains(out, user.Email) {
+			out = append(out, user.Email)
+		}
+	}
+	return out
+}
+
+// render はイベントの件名と本文を描画する。テンプレートの空の項目は既定の文面とする。
+func render(t config.EmailTemplate, ev Event) (subject, body string, err error) {
+	hostname, _ := os.Hostname()
+	data := templateData{Event: ev, Hostname: hostname}
+	if subject, err = execute(cmp.Or(t.Subject, defaultSubject), data); err != nil {
+		return "", "", err
+	}
+	if body, err = execute(cmp.Or(t.Body, defaultBody), data); err != nil {
+		return "", "", err
+	}
+	// 件名はヘッダーとなるため、改行によるヘッダーの挿入を防ぐ。
+	subject = strings.Join(strings.Fields(subject), " ")
+	return subject, body, nil
+}
+
+func execute(text string, data templateData) (string, error) {
+	tmpl, err := template.New("mail").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// mailAddress は "名前 <address>" 形式を含むアドレスから、SMTP のエンベロープに用いるアドレスのみを取り出す。
+func mailAddress(s string) (string, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
+
+// sendMail は 1 通のメールを送信する。本文は UTF-8 の quoted-printable とする。
+func sendMail(c config.SMTPConfig, to, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+
+	dialer := net.Dialer{Timeout: mailTimeout}
+	var conn net.Conn
+	var err error
+	if c.TLS == config.SMTPTLS {
+		conn, err = tls.DialWithDialer(&dialer, "tcp", c.Addr(), &tls.Config{ServerName: c.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.Addr())
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if c.TLS == "" || c.TLS == config.SMTPStartTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: c.Host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	from, err := mailAddress(c.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	rcpt, err := mailAddress(to)
+	if err != nil {
+		return err
+	}
+	if err := client.Rcpt(rcpt); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
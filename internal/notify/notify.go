@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/incident"
+	"github.com/play-bin/internal/logger"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// diskCheckInterval はディスクの使用率を確認する間隔。
+const diskCheckInterval = 5 * time.Minute
+
+// queueLimit は通知先ごとに保持する送信待ちのイベントの上限。
+const queueLimit = 1024
+
+// MARK: Event
+// 通知の対象となるイベント。メール等の通知先は Events.Queue で受け取る。
+type Event struct {
+	Kind     string            `json:"kind"`             // config.NotifyCrash 等
+	Severity string            `json:"severity"`         // config.SeverityInfo 等。省略時は種類の既定の重要度
+	Server   string            `json:"server,omitempty"` // 対象のサーバー。ホスト全体のイベントは空
+	Time     time.Time         `json:"time"`
+	Summary  string            `json:"summary"`           // 1 行の概要。既定の件名に使用する
+	Details  map[string]string `json:"details,omitempty"` // テンプレートから {{index .Details "exitCode"}} 等で参照する値
+	// Key は同じ種類・サーバーのイベントを、通知の抑制の上で区別する値 (接続元の IP アドレス等)。
+	Key string `json:"-"`
+}
+
+// MARK: Hub
+// 各機能で発生したイベントを、通知先ごとのキューへファンアウトする。
+// 通知先の送信 (SMTP 等) が滞っても取りこぼさないよう、イベントは受け取りを待たずにキューへ保持する。
+type Hub struct {
+	mu     sync.RWMutex
+	queues []*Queue
+}
+
+// Events はプロセス全体で共有される通知イベントの配信ハブ。
+var Events = &Hub{}
+
+// MARK: Queue()
+// 以降に発生したイベントを受け取るキューを作成する。通知先は Next で 1 件ずつ取り出して処理する。
+func (h *Hub) Queue(name string) *Queue {
+	q := &Queue{name: name, ready: make(chan struct{}, 1)}
+	h.mu.Lock()
+	h.queues = append(h.queues, q)
+	h.mu.Unlock()
+	return q
+}
+
+// MARK: Publish()
+// イベントを全ての通知先のキューへ追加する。Time が未設定の場合は現在時刻、Severity が未設定の場合は種類の既定の重要度とする。
+func (h *Hub) Publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Severity == "" {
+		ev.Severity = config.EventSeverity(ev.Kind)
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, q := range h.queues {
+		q.push(ev)
+	}
+}
+
+// MARK: Queue
+// 1 つの通知先の送信待ちのイベント。上限 (queueLimit) を超えた場合は新しいイベントを破棄し、破棄した件数を記録する。
+type Queue struct {
+	name    string
+	mu      sync.Mutex
+	items   []Event
+	dropped int
+	ready   chan struct{} // イベントの追加を Next へ知らせる
+}
+
+// push はイベントをキューの末尾へ追加する。
+func (q *Queue) push(ev Event) {
+	q.mu.Lock()
+	if len(q.items) >= queueLimit {
+		q.dropped++
+		dropped := q.dropped
+		q.mu.Unlock()
+		logger.Warnf("Internal", "Notify", "通知の送信待ちが上限に達したため、イベントを破棄しました: queue=%s, kind=%s, server=%s, dropped=%d", q.name, ev.Kind, ev.Server, dropped)
+		return
+	}
+	q.items = append(q.items, ev)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// MARK: Next()
+// キューの先頭のイベントを取り出す。空の場合は追加されるまで待つ。
+func (q *Queue) Next() Event {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			ev := q.items[0]
+			q.items[0] = Event{}
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			return ev
+		}
+		q.mu.Unlock()
+		<-q.ready
+	}
+}
+
+// MARK: CrashEvent()
+// インシデント (異常終了の記録) を通知のイベントへ変換する。
+func CrashEvent(inc incident.Incident) Event {
+	summary := fmt.Sprintf("%s crashed (exit code %d)", inc.Server, inc.ExitCode)
+	if inc.OOMKilled {
+		summary = fmt.Sprintf("%s was killed due to out of memory", inc.Server)
+	}
+	return Event{
+		Kind:    config.NotifyCrash,
+		Server:  inc.Server,
+		Time:    inc.Time,
+		Summary: summary,
+		Details: map[string]string{
+			"incident":  inc.ID,
+			"exitCode":  strconv.Itoa(inc.ExitCode),
+			"oomKilled": strconv.FormatBool(inc.OOMKilled),
+		},
+	}
+}
+
+// MARK: WatchJobs()
+// ジョブの完了時に、バックアップの完了・失敗を結果と共に通知する。
+// 失敗の通知を取りこぼさないよう、購読ではなく完了時に同期的に呼び出される OnFinish で受け取り、通知先のキューへ追加する。
+func WatchJobs(jobs *container.JobTracker) {
+	jobs.OnFinish(func(j container.Job) {
+		if j.Action == container.ActionBackup {
+			Events.Publish(BackupEvent(j))
+		}
+	})
+}
+
+// MARK: BackupEvent()
+// 完了したバックアップのジョブを通知のイベントへ変換する。Details には BackupStats の各値を含める。
+func BackupEvent(j container.Job) Event {
+	ev := Event{
+		Kind:    config.NotifyBackupCompleted,
+		Server:  j.Server,
+		Time:    j.FinishedAt,
+		Summary: fmt.Sprintf("Backup of %s completed", j.Server),
+		Details: map[string]string{"job": j.ID, "user": j.User, "via": j.Via},
+	}
+	if j.Status == container.JobFailed {
+		ev.Kind = config.NotifyBackupFailed
+		ev.Summary = fmt.Sprintf("Backup of %s failed", j.Server)
+		ev.Details["error"] = j.Error
+	}
+	if b := j.Backup; b != nil {
+		ev.Details["generation"] = b.Generation
+		ev.Details["duration"] = strconv.FormatInt(b.Duration, 10)
+		ev.Details["engine"] = b.Engine
+		// スナップショットで作成した世代は変更されたファイル数とサイズを計測しない。
+		if b.Engine == "" || b.Engine == config.BackupEngineRsync {
+			ev.Details["changedFiles"] = strconv.FormatInt(b.ChangedFiles, 10)
+			ev.Details["totalSize"] = strconv.FormatInt(b.TotalSize, 10)
+			ev.Details["sizeDelta"] = strconv.FormatInt(b.SizeDelta, 10)
+		}
+	}
+	return ev
+}
+
+// MARK: WatchDisk()
+// 作業ディレクトリを含むファイルシステムの使用率を diskCheckInterval ごとに確認し、diskThreshold を超えた時点で通知する。
+// 超えている間は繰り返し通知せず、しきい値を下回った後に再び超えた場合に改めて通知する。
+func WatchDisk(cfg *config.LoadedConfig) {
+	go func() {
+		ticker := time.NewTicker(diskCheckInterval)
+		defer ticker.Stop()
+		over := false
+		for range ticker.C {
+			n := cfg.Get().Notifications
+			if n == nil || n.DiskThreshold <= 0 {
+				over = false
+				continue
+			}
+			usage, err := disk.Usage(".")
+			if err != nil {
+				logger.Errorf("Internal", "Notify", "ディスクの使用率の取得に失敗: %v", err)
+				continue
+			}
+			if usage.UsedPercent < n.DiskThreshold {
+				over = false
+				continue
+			}
+			if over {
+				continue
+			}
+			over = true
+			Events.Publish(Event{
+				Kind:    config.NotifyDisk,
+				Summary: fmt.Sprintf("Disk usage is %.1f%% (threshold %.1f%%)", usage.UsedPercent, n.DiskThreshold),
+				Details: map[string]string{
+					"path":        usage.Path,
+					"usedPercent": strconv.FormatFloat(usage.UsedPercent, 'f', 1, 64),
+					"used":        strconv.FormatUint(usage.Used, 10),
+					"total":       strconv.FormatUint(usage.Total, 10),
+				},
+			})
+		}
+	}()
+}
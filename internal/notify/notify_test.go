@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQueueKeepsEventsWhileConsumerIsBusy(t *testing.T) {
+	h := &Hub{}
+	q := h.Queue("test")
+	// 受け取り側が処理していない間に発生したイベントも、上限までは順に保持する。
+	for i := range queueLimit + 3 {
+		h.Publish(Event{Kind: "backup_failed", Key: strconv.Itoa(i)})
+	}
+	for i := range queueLimit {
+		ev := q.Next()
+		if ev.Key != strconv.Itoa(i) {
+			t.Fatalf("event %d: key = %q", i, ev.Key)
+		}
+		if ev.Time.IsZero() || ev.Severity == "" {
+			t.Fatalf("event %d: time and severity are not filled: %+v", i, ev)
+		}
+	}
+	if q.dropped != 3 {
+		t.Errorf("dropped = %d, want 3", q.dropped)
+	}
+}
+
+func TestQueueNextWaitsForEvent(t *testing.T) {
+	h := &Hub{}
+	q := h.Queue("test")
+	got := make(chan Event)
+	go func() { got <- q.Next() }()
+
+	time.Sleep(10 * time.Millisecond)
+	h.Publish(Event{Kind: "crash", Server: "mc"})
+	select {
+	case ev := <-got:
+		if ev.Server != "mc" {
+			t.Errorf("event = %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next did not return the published event")
+	}
+}
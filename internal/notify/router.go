@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// channelTimeout は Discord / Webhook / Telegram への 1 回の送信の期限。
+	channelTimeout = 10 * time.Second
+	// discordContentLimit と telegramTextLimit は 1 件のメッセージの本文の最大の文字数。
+	discordContentLimit = 2000
+	telegramTextLimit   = 4096
+)
+
+// MARK: Router
+// 通知イベントを購読し、notifications.routes に一致したイベントをルールの通知先 (channels) へ送信する。
+// 静かな時間帯 (quietHours) の間は重要度の低いイベントを破棄し、同じイベントはルールの dedup の間隔ごとに 1 回のみ通知する。
+type Router struct {
+	Config *config.LoadedConfig
+
+	mu    sync.Mutex
+	until map[string]time.Time // ルールと抑制のキー -> 再び通知できるようになる時刻
+}
+
+// MARK: NewRouter()
+func NewRouter(cfg *config.LoadedConfig) *Router {
+	return &Router{Config: cfg, until: make(map[string]time.Time)}
+}
+
+// MARK: Start()
+// イベントの受け取りを開始する。送信は 1 件ずつ行い、送信中に発生したイベントはキューで待機する。
+// routes が未設定の間に受け取ったイベントは破棄する。
+func (r *Router) Start() {
+	queue := Events.Queue("routes")
+	go func() {
+		for {
+			r.handle(queue.Next())
+		}
+	}()
+}
+
+// handle は 1 件のイベントを、一致した全てのルールの通知先へ送信する。複数のルールが同じ通知先を含む場合も 1 回のみ送信する。
+func (r *Router) handle(ev Event) {
+	n := r.Config.Get().Notifications
+	if n == nil || len(n.Routes) == 0 {
+		return
+	}
+	var channels []string
+	for i, route := range n.Routes {
+		if !Matches(route, ev) || !r.allow(i, route, ev) {
+			continue
+		}
+		for _, name := range route.Channels {
+			if !slices.Contains(channels, name) {
+				channels = append(channels, name)
+			}
+		}
+	}
+	if len(channels) == 0 {
+		return
+	}
+
+	subject, body, err := render(n.Templates[ev.Kind], ev)
+	if err != nil {
+		logger.Errorf("Internal", "Notify", "通知のテンプレートの描画に失敗: kind=%s, err=%v", ev.Kind, err)
+		return
+	}
+	for _, name := range channels {
+		ch, ok := n.Channels[name]
+		if !ok {
+			continue
+		}
+		if err := send(n.SMTP, ch, ev, subject, body); err != nil {
+			logger.Errorf("External", "Notify", "通知の送信に失敗: kind=%s, channel=%s, err=%v", ev.Kind, name, err)
+			continue
+		}
+		logger.Logf("Internal", "Notify", "通知を送信しました: kind=%s, severity=%s, server=%s, channel=%s", ev.Kind, ev.Severity, ev.Server, name)
+	}
+}
+
+// MARK: Matches()
+// イベントがルールの種類・重要度・サーバーの条件、および静かな時間帯の条件を満たすかを返す。
+func Matches(route config.NotifyRouteConfig, ev Event) bool {
+	if len(route.Events) > 0 && !slices.Contains(route.Events, ev.Kind) {
+		return false
+	}
+	if !config.SeverityAtLeast(ev.Severity, route.Severity) {
+		return false
+	}
+	if len(route.Servers) > 0 && !slices.Contains(route.Servers, ev.Server) {
+		return false
+	}
+	if q := route.QuietHours; q != nil && q.Contains(ev.Time) {
+		return config.SeverityAtLeast(ev.Severity, cmp.Or(q.Severity, config.SeverityCritical))
+	}
+	return true
+}
+
+// allow は同じイベントをルールの dedup の間隔以内に通知済みでなければ、通知した時刻を記録して true を返す。
+// 抑制はルールごとに行うため、別のルールの通知先へは影響しない。
+func (r *Router) allow(index int, route config.NotifyRouteConfig, ev Event) bool {
+	window := route.DedupDuration()
+	if window == 0 {
+		return true
+	}
+	key := strconv.Itoa(index) + "\x00" + ev.Kind + "\x00" + ev.Server + "\x00" + ev.Key
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	maps.DeleteFunc(r.until, func(_ string, until time.Time) bool { return !now.Before(until) })
+	if _, ok := r.until[key]; ok {
+		return false
+	}
+	r.until[key] = now.Add(window)
+	return true
+}
+
+// send は 1 件の通知先へイベントを送信する。
+func send(smtp config.SMTPConfig, ch config.NotifyChannelConfig, ev Event, subject, body string) error {
+	switch ch.Type {
+	case config.ChannelEmail:
+		for _, to := range ch.To {
+			if err := sendMail(smtp, to, subject, body); err != nil {
+				return fmt.Errorf("to=%s: %w", to, err)
+			}
+		}
+		return nil
+	case config.ChannelDiscord:
+		return postJSON(ch.URL, nil, map[string]string{"content": truncate("**"+subject+"**\n"+body, discordContentLimit)})
+	case config.ChannelTelegram:
+		return postJSON("https://api.telegram.org/bot"+ch.Token+"/sendMessage", nil, map[string]string{
+			"chat_id": ch.ChatID,
+			"text":    truncate(subject+"\n\n"+body, telegramTextLimit),
+		})
+	case config.ChannelWebhook:
+		return postJSON(ch.URL, ch.Headers, ev)
+	default:
+		return fmt.Errorf("unknown channel type %q", ch.Type)
+	}
+}
+
+// truncate は s を limit 文字以内に切り詰める。
+func truncate(s string, limit int) string {
+	r := []rune(s)
+	if len(r) <= limit {
+		return s
+	}
+	return string(r[:limit-1]) + "…"
+}
+
+// postJSON は body を JSON で POST し、2xx 以外の応答をエラーとする。
+// Telegram の URL はトークンを含むため、エラーに URL を含めない。
+func postJSON(target string, headers map[string]string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), channelTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(b))
+	if err != nil {
+		return errors.New("invalid URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			return ue.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
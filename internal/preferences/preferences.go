@@ -0,0 +1,170 @@
+package preferences
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/fsutil"
+)
+
+// 端末のフォントの大きさの範囲 (px)。
+const (
+	minFontSize = 8
+	maxFontSize = 32
+)
+
+// maxFontFamilyLength は端末のフォント名 (CSS の font-family) の最大の長さ。
+const maxFontFamilyLength = 200
+
+// 表示のテーマ。
+const (
+	ThemeSystem = "system" // ブラウザ (OS) の設定に従う
+	ThemeDark   = "dark"
+	ThemeLight  = "light"
+)
+
+// Themes は theme に指定できる値。
+var Themes = []string{ThemeSystem, ThemeDark, ThemeLight}
+
+// MARK: Preferences
+// ユーザーごとの UI と通知の設定。ブラウザを変えても同じ設定となるよう、サーバー側に保存する。
+type Preferences struct {
+	Theme         string `json:"theme,omitempty"`         // system (既定) / dark / light
+	DefaultServer string `json:"defaultServer,omitempty"` // ログイン後に選択するサーバー
+	// Notify はメールで受け取るイベントの種類 (config.NotifyEvents)。設定ファイルの users の notify に加えて通知する
+	Notify       []string      `json:"notify,omitempty"`
+	TerminalFont *TerminalFont `json:"terminalFont,omitempty"`
+	UpdatedAt    time.Time     `json:"updatedAt,omitzero"`
+}
+
+// TerminalFont はコンソールの端末のフォント。
+type TerminalFont struct {
+	Family string `json:"family,omitempty"` // CSS の font-family (例: "JetBrains Mono, monospace")
+	Size   int    `json:"size,omitempty"`   // px。省略時は UI の既定
+}
+
+// MARK: Validate()
+// 設定値を検証し、問題を項目のパスと共に返す。defaultServer はユーザーが閲覧できるサーバーに限る。
+// メールの宛先が無く通知を受け取れない場合は警告とし、保存は妨げない。
+func (p Preferences) Validate(cfg config.Config, username string) []config.Issue {
+	var issues []config.Issue
+	add := func(path, format string, args ...any) {
+		issues = append(issues, config.Issue{Level: config.LevelError, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if p.Theme != "" && !slices.Contains(Themes, p.Theme) {
+		add("theme", "unknown theme %q (expected one of %s)", p.Theme, strings.Join(Themes, ", "))
+	}
+	if p.DefaultServer != "" {
+		// 存在しないサーバーと閲覧できないサーバーを区別しない。
+		if _, ok := cfg.Servers[p.DefaultServer]; !ok || !cfg.Users[username].HasPermission(p.DefaultServer, config.PermContainerRead) {
+			add("defaultServer", "server %q is not available", p.DefaultServer)
+		}
+	}
+	for i, kind := range p.Notify {
+		if !slices.Contains(config.NotifyEvents, kind) {
+			add(fmt.Sprintf("notify[%d]", i), "unknown event %q (expected one of %s)", kind, strings.Join(config.NotifyEvents, ", "))
+		}
+	}
+	if len(p.Notify) > 0 && (cfg.Users[username].Email == "" || cfg.Notifications == nil) {
+		issues = append(issues, config.Issue{Level: config.LevelWarning, Path: "notify", Message: "notifications are not sent without email and notifications.smtp"})
+	}
+	if f := p.TerminalFont; f != nil {
+		if len(f.Family) > maxFontFamilyLength || strings.ContainsAny(f.Family, ";{}<>\\") {
+			add("terminalFont.family", "invalid font family")
+		}
+		if f.Size != 0 && (f.Size < minFontSize || f.Size > maxFontSize) {
+			add("terminalFont.size", "must be between %d and %d", minFontSize, maxFontSize)
+		}
+	}
+	return issues
+}
+
+// MARK: Store
+// ユーザーごとの設定をファイルへ保存する。
+type Store struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]Preferences
+}
+
+// MARK: NewStore()
+func NewStore() *Store {
+	return &Store{users: make(map[string]Preferences)}
+}
+
+// MARK: Load()
+// 保存済みの設定を読み込み、以降の変更の保存先とする。ファイルが存在しない場合は空の状態から始める。
+func (s *Store) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &s.users)
+}
+
+// MARK: Get()
+// ユーザーの設定を返す。未保存の場合は空の設定 (UI の既定) を返す。
+func (s *Store) Get(username string) Preferences {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := s.users[username]
+	p.Notify = slices.Clone(p.Notify)
+	if p.TerminalFont != nil {
+		font := *p.TerminalFont
+		p.TerminalFont = &font
+	}
+	return p
+}
+
+// MARK: Set()
+// ユーザーの設定を置き換えて保存する。検証は呼び出し側で行う。
+func (s *Store) Set(username string, p Preferences) (Preferences, error) {
+	p.UpdatedAt = time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = p
+	return p, s.save()
+}
+
+// MARK: Delete()
+// ユーザーの設定を削除し、既定に戻す。
+func (s *Store) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; !ok {
+		return nil
+	}
+	delete(s.users, username)
+	return s.save()
+}
+
+// MARK: Notify()
+// ユーザーがメールで受け取るよう登録したイベントの種類を返す。
+func (s *Store) Notify(username string) []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.users[username].Notify)
+}
+
+// save は Load で指定されたファイルへ書き出す。s.mu を保持した状態で呼び出すこと。
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return fsutil.WriteJSON(s.path, s.users, 0o600)
+}
@@ -0,0 +1,328 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+const (
+	// defaultLogDir は process.logFile を省略した場合の、command の出力の保存先。
+	defaultLogDir = "./process_logs"
+	// maxLogLine は logFile へ書き込む 1 行の最大のバイト数。超える出力は分割して書き込む。
+	maxLogLine = 64 << 10
+	// followInterval は logFile の追記を確認する間隔。
+	followInterval = 500 * time.Millisecond
+)
+
+// child は play-bin の子プロセスとして実行中の command。
+type child struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	startedAt time.Time
+	done      chan struct{}
+}
+
+var (
+	children   = make(map[string]*child)
+	lastExits  = make(map[string]int) // 終了した command の終了コード
+	childrenMu sync.Mutex
+)
+
+// MARK: LogFile()
+// command の出力の保存先を返す。
+func LogFile(name string, pc config.ProcessConfig) string {
+	if pc.LogFile != "" {
+		return pc.LogFile
+	}
+	return filepath.Join(defaultLogDir, name+".log")
+}
+
+// startChild は command を子プロセスとして起動し、出力を時刻付きで logFile へ追記する。
+// 起動元のリクエストが終わってもプロセスが止まらないよう、ctx には関連付けない。
+func startChild(name string, pc config.ProcessConfig) error {
+	childrenMu.Lock()
+	defer childrenMu.Unlock()
+	if _, ok := children[name]; ok {
+		return fmt.Errorf("process %s is already running", name)
+	}
+
+	path := LogFile(name, pc)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(pc.Command[0], pc.Command[1:]...)
+	cmd.Dir = pc.Directory
+	cmd.Env = os.Environ()
+	for k, v := range pc.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// stdout と stderr に同じ Writer を渡すと、Write は同時に呼び出されない。
+	out := &lineWriter{w: f}
+	cmd.Stdout, cmd.Stderr = out, out
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to start process: %w", err)
+	}
+
+	c := &child{cmd: cmd, stdin: stdin, startedAt: time.Now(), done: make(chan struct{})}
+	children[name] = c
+	logger.Logf("Internal", "Process", "プロセスを起動しました: %s (pid=%d)", name, cmd.Process.Pid)
+	notify(name, "start", 0)
+
+	go func() {
+		err := cmd.Wait()
+		out.flush()
+		f.Close()
+		code := cmd.ProcessState.ExitCode()
+		// シグナルによる終了は、Docker と同じく 128 + シグナル番号とする (SIGTERM: 143, SIGKILL: 137)。
+		if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			code = 128 + int(ws.Signal())
+		}
+		childrenMu.Lock()
+		delete(children, name)
+		lastExits[name] = code
+		childrenMu.Unlock()
+		close(c.done)
+		if err != nil {
+			logger.Logf("Internal", "Process", "プロセスが終了しました: %s (%v)", name, err)
+		} else {
+			logger.Logf("Internal", "Process", "プロセスが終了しました: %s", name)
+		}
+		notify(name, "die", code)
+	}()
+	return nil
+}
+
+func getChild(name string) *child {
+	childrenMu.Lock()
+	defer childrenMu.Unlock()
+	return children[name]
+}
+
+// stopChild は SIGTERM を送って終了を待ち、timeout を過ぎるか ctx がキャンセルされた場合は SIGKILL を送る。停止済みの場合は何もしない。
+func stopChild(ctx context.Context, name string, timeout time.Duration) error {
+	c := getChild(name)
+	if c == nil {
+		return nil
+	}
+	if err := c.cmd.Process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to stop process: %w", err)
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-time.After(timeout):
+		logger.Warnf("Internal", "Process", "%s 以内に終了しなかったため強制終了します: %s", timeout, name)
+	case <-ctx.Done():
+	}
+	return killChild(name)
+}
+
+// killChild は SIGKILL を送って終了を待つ。停止済みの場合は何もしない。
+func killChild(name string) error {
+	c := getChild(name)
+	if c == nil {
+		return nil
+	}
+	if err := c.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill process: %w", err)
+	}
+	<-c.done
+	return nil
+}
+
+func inspectChild(name string) Status {
+	childrenMu.Lock()
+	defer childrenMu.Unlock()
+	if c, ok := children[name]; ok {
+		return Status{State: StateRunning, PID: c.cmd.Process.Pid, StartedAt: c.startedAt}
+	}
+	// play-bin の起動後に一度も実行していない場合も、起動できる状態として停止中とする。
+	return Status{State: StateExited, ExitCode: lastExits[name]}
+}
+
+func sendChild(name, command string) error {
+	c := getChild(name)
+	if c == nil {
+		return fmt.Errorf("process %s is not running", name)
+	}
+	_, err := io.WriteString(c.stdin, command)
+	return err
+}
+
+// MARK: Running()
+// play-bin の子プロセスとして実行中の command のサーバー名を返す。終了時に停止するために使用する。
+func Running() []string {
+	childrenMu.Lock()
+	defer childrenMu.Unlock()
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	return names
+}
+
+// lineWriter は出力を行ごとに、受信した時刻を付けて書き込む。改行の無い末尾は次の書き込みか flush まで保持する。
+type lineWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		var line string
+		if i := bytes.IndexByte(lw.buf, '\n'); i >= 0 {
+			line, lw.buf = strings.TrimRight(string(lw.buf[:i]), "\r"), lw.buf[i+1:]
+		} else if len(lw.buf) >= maxLogLine {
+			line, lw.buf = string(lw.buf[:maxLogLine]), lw.buf[maxLogLine:]
+		} else {
+			return len(p), nil
+		}
+		if _, err := io.WriteString(lw.w, time.Now().Format(time.RFC3339Nano)+" "+line+"\n"); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (lw *lineWriter) flush() {
+	if len(lw.buf) > 0 {
+		io.WriteString(lw.w, time.Now().Format(time.RFC3339Nano)+" "+string(lw.buf)+"\n")
+		lw.buf = nil
+	}
+}
+
+// fileLogs は logFile の時刻付きの行を opts に従って返す。
+func fileLogs(ctx context.Context, path string, opts LogOptions) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && opts.Follow {
+		// まだ一度も起動していない場合は、ファイルが作成されるまで待つ。
+		f = nil
+	} else if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		return nil, err
+	}
+
+	return newStream(ctx, func(ctx context.Context, w *io.PipeWriter) error {
+		defer func() {
+			if f != nil {
+				f.Close()
+			}
+		}()
+		var offset int64
+		if f != nil {
+			// 末尾の tail 行を返すため、範囲内の行を保持しながら最後まで読む。
+			var lines []string
+			n, err := scanFile(f, 0, func(t time.Time, text string) {
+				if !inRange(t, opts) || opts.Tail == 0 {
+					return
+				}
+				lines = append(lines, formatLine(t, text, opts))
+				if opts.Tail > 0 && len(lines) > opts.Tail {
+					lines = lines[1:]
+				}
+			})
+			if err != nil {
+				return err
+			}
+			offset = n
+			for _, line := range lines {
+				if _, err := io.WriteString(w, line); err != nil {
+					return err
+				}
+			}
+		}
+		if !opts.Follow {
+			return nil
+		}
+
+		// 追記された行を一定間隔で読む。ファイルが切り詰められた (ローテーション等) 場合は先頭から読み直す。
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(followInterval):
+			}
+			if f == nil {
+				if f, err = os.Open(path); err != nil {
+					f = nil
+					continue
+				}
+			}
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			if info.Size() < offset {
+				offset = 0
+			}
+			if info.Size() == offset {
+				continue
+			}
+			var werr error
+			offset, err = scanFile(f, offset, func(t time.Time, text string) {
+				if werr == nil && inRange(t, opts) {
+					_, werr = io.WriteString(w, formatLine(t, text, opts))
+				}
+			})
+			if werr != nil {
+				return werr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}), nil
+}
+
+// scanFile は offset 以降の完結した行 (改行で終わる行) を fn へ渡し、読み終えた位置を返す。
+func scanFile(f *os.File, offset int64, fn func(t time.Time, text string)) (int64, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	r := bufio.NewReaderSize(f, maxLogLine+64)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			// 書き込み途中の行は、次の読み込みで改めて読む。
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, err
+		}
+		offset += int64(len(line))
+		ts, text, _ := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			// play-bin 以外が書き込んだ行は時刻を持たないため、本文として扱う。
+			t, text = time.Time{}, strings.TrimSuffix(line, "\n")
+		}
+		fn(t, text)
+	}
+}
@@ -0,0 +1,152 @@
+// Package process は Docker を使わずに play-bin と同じホスト上で直接実行するサーバー (servers.<name>.process) を操作する。
+// systemd のユニット (unit) と、play-bin の子プロセス (command) の 2 つの形態を、同じ関数で扱えるようにする。
+package process
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/play-bin/internal/config"
+)
+
+// プロセスの状態。コンテナ一覧等で Docker のコンテナと並べて扱えるよう、Docker と同じ語彙を用いる。
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting" // unit の起動処理中
+	StateExited     = "exited"
+	StateMissing    = "missing" // unit が存在しない
+)
+
+// MARK: Status
+// プロセスの状態。
+type Status struct {
+	State     string    `json:"state"`
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	ExitCode  int       `json:"exitCode"` // 最後に終了した際の終了コード
+	Unit      string    `json:"unit,omitempty"`
+}
+
+// Running はプロセスが稼働中かを返す。
+func (s Status) Running() bool { return s.State == StateRunning }
+
+// OnEvent は play-bin から起動・停止したプロセスと、command の子プロセスの終了を通知する。
+// action は Docker のイベントと同じ "start" / "die" とし、コンテナのイベントと同じ購読者へ配信するために使用する。
+var OnEvent func(name, action string, exitCode int)
+
+func notify(name, action string, exitCode int) {
+	if OnEvent != nil {
+		OnEvent(name, action, exitCode)
+	}
+}
+
+// MARK: LogOptions
+// ログの取得条件。
+type LogOptions struct {
+	Follow     bool      // 既存の行に続けて、新しい行を待ち続ける
+	Tail       int       // 末尾から返す行数。負の値で全件
+	Since      time.Time // この時刻以降の行のみ (ゼロ値で制限なし)
+	Until      time.Time // この時刻以前の行のみ (ゼロ値で制限なし)
+	Timestamps bool      // 各行の先頭に RFC 3339 の時刻を付ける (Docker の timestamps と同じ形式)
+}
+
+// MARK: Start()
+// プロセスを起動する。既に稼働中の場合はエラーを返す。
+func Start(ctx context.Context, name string, pc config.ProcessConfig) error {
+	if pc.Unit != "" {
+		return startUnit(ctx, name, pc)
+	}
+	return startChild(name, pc)
+}
+
+// MARK: Stop()
+// プロセスを停止する。unit は systemctl stop、command は SIGTERM を送り、stopTimeout を過ぎても終了しない場合は SIGKILL を送る。
+func Stop(ctx context.Context, name string, pc config.ProcessConfig) error {
+	if pc.Unit != "" {
+		return stopUnit(ctx, name, pc)
+	}
+	return stopChild(ctx, name, pc.StopTimeoutDuration())
+}
+
+// MARK: Kill()
+// プロセスを SIGKILL で強制終了する。
+func Kill(ctx context.Context, name string, pc config.ProcessConfig) error {
+	if pc.Unit != "" {
+		return killUnit(ctx, name, pc)
+	}
+	return killChild(name)
+}
+
+// MARK: Inspect()
+// プロセスの状態を返す。
+func Inspect(ctx context.Context, name string, pc config.ProcessConfig) (Status, error) {
+	if pc.Unit != "" {
+		return inspectUnit(ctx, pc)
+	}
+	return inspectChild(name), nil
+}
+
+// MARK: SendCommand()
+// プロセスの標準入力へ文字列を書き込む。unit の場合は stdin に指定した FIFO へ書き込む。
+func SendCommand(name string, pc config.ProcessConfig, command string) error {
+	if pc.Unit != "" {
+		return sendUnit(pc, command)
+	}
+	return sendChild(name, command)
+}
+
+// MARK: Logs()
+// プロセスの出力を行単位で返す。unit は journald から、command は logFile から読む。
+// 返す内容は TTY のコンテナのログと同様に多重化されていないため、そのまま行単位で読める。
+func Logs(ctx context.Context, name string, pc config.ProcessConfig, opts LogOptions) (io.ReadCloser, error) {
+	if pc.Unit != "" {
+		return unitLogs(ctx, pc, opts)
+	}
+	return fileLogs(ctx, LogFile(name, pc), opts)
+}
+
+// formatLine はログの 1 行を、opts に従って時刻付きまたは本文のみで書式化する。
+func formatLine(t time.Time, text string, opts LogOptions) string {
+	if opts.Timestamps {
+		return t.Format(time.RFC3339Nano) + " " + text + "\n"
+	}
+	return text + "\n"
+}
+
+// inRange は時刻が opts の since / until の範囲内かを返す。
+func inRange(t time.Time, opts LogOptions) bool {
+	if !opts.Since.IsZero() && t.Before(opts.Since) {
+		return false
+	}
+	if !opts.Until.IsZero() && t.After(opts.Until) {
+		return false
+	}
+	return true
+}
+
+// stream は出力を生成するゴルーチンの終了を待って閉じる io.ReadCloser。
+type stream struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *stream) Close() error {
+	s.cancel()
+	err := s.PipeReader.Close()
+	<-s.done
+	return err
+}
+
+// newStream は fn の書き込みを読み出すストリームを返す。fn は ctx のキャンセル (Close) で戻らなければならない。
+func newStream(ctx context.Context, fn func(ctx context.Context, w *io.PipeWriter) error) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	s := &stream{PipeReader: pr, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		pw.CloseWithError(fn(ctx, pw))
+	}()
+	return s
+}
@@ -0,0 +1,199 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+// systemdTimestamp は systemctl show が出力する時刻の形式 (例: Mon 2024-01-01 12:00:00 JST)。
+const systemdTimestamp = "Mon 2006-01-02 15:04:05 MST"
+
+// systemctl は systemctl を実行し、失敗した場合は出力をエラーに含める。
+// play-bin の実行ユーザーがユニットを操作できるよう、root での実行か polkit 等による許可が必要。
+func systemctl(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "systemctl", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func startUnit(ctx context.Context, name string, pc config.ProcessConfig) error {
+	if status, err := inspectUnit(ctx, pc); err != nil {
+		return err
+	} else if status.State == StateMissing {
+		return fmt.Errorf("unit %s not found", pc.Unit)
+	} else if status.Running() {
+		return fmt.Errorf("unit %s is already running", pc.Unit)
+	}
+	if _, err := systemctl(ctx, "start", pc.Unit); err != nil {
+		return err
+	}
+	logger.Logf("Internal", "Process", "ユニットを起動しました: %s (%s)", name, pc.Unit)
+	notify(name, "start", 0)
+	return nil
+}
+
+func stopUnit(ctx context.Context, name string, pc config.ProcessConfig) error {
+	if _, err := systemctl(ctx, "stop", pc.Unit); err != nil {
+		return err
+	}
+	logger.Logf("Internal", "Process", "ユニットを停止しました: %s (%s)", name, pc.Unit)
+	notifyUnitExit(ctx, name, pc)
+	return nil
+}
+
+func killUnit(ctx context.Context, name string, pc config.ProcessConfig) error {
+	if _, err := systemctl(ctx, "kill", "--signal=SIGKILL", pc.Unit); err != nil {
+		return err
+	}
+	logger.Logf("Internal", "Process", "ユニットを強制終了しました: %s (%s)", name, pc.Unit)
+	notifyUnitExit(ctx, name, pc)
+	return nil
+}
+
+// notifyUnitExit はユニットの停止を、最後の終了コードと共に通知する。
+func notifyUnitExit(ctx context.Context, name string, pc config.ProcessConfig) {
+	status, _ := inspectUnit(ctx, pc)
+	notify(name, "die", status.ExitCode)
+}
+
+func inspectUnit(ctx context.Context, pc config.ProcessConfig) (Status, error) {
+	out, err := systemctl(ctx, "show", pc.Unit, "--property=LoadState,ActiveState,MainPID,ExecMainStatus,ExecMainStartTimestamp")
+	if err != nil {
+		return Status{}, err
+	}
+	props := make(map[string]string)
+	for line := range strings.Lines(out) {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[k] = v
+		}
+	}
+
+	status := Status{Unit: pc.Unit}
+	status.ExitCode, _ = strconv.Atoi(props["ExecMainStatus"])
+	switch props["ActiveState"] {
+	case "active", "reloading", "deactivating":
+		status.State = StateRunning
+		status.PID, _ = strconv.Atoi(props["MainPID"])
+		status.StartedAt, _ = time.Parse(systemdTimestamp, props["ExecMainStartTimestamp"])
+	case "activating":
+		status.State = StateRestarting
+	default:
+		status.State = StateExited
+	}
+	if props["LoadState"] == "not-found" {
+		status.State = StateMissing
+	}
+	return status, nil
+}
+
+// sendUnit はユニットの標準入力の FIFO へ書き込む。読み手が居ない (ユニットが停止中) 場合に待ち続けないよう、非ブロッキングで開く。
+func sendUnit(pc config.ProcessConfig, command string) error {
+	if pc.Stdin == "" {
+		return errors.New("process.stdin is not configured for unit " + pc.Unit)
+	}
+	f, err := os.OpenFile(pc.Stdin, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.WriteString(f, command)
+	return err
+}
+
+// journalEntry は journalctl -o json の 1 件のうち、使用する項目。
+type journalEntry struct {
+	Timestamp string          `json:"__REALTIME_TIMESTAMP"` // UNIX 時間 (マイクロ秒)
+	Message   json.RawMessage `json:"MESSAGE"`              // 文字列、または UTF-8 でない場合はバイト列の配列
+}
+
+// text は MESSAGE を文字列として返す。
+func (e journalEntry) text() string {
+	var s string
+	if json.Unmarshal(e.Message, &s) == nil {
+		return s
+	}
+	var b []byte
+	var ints []int
+	if json.Unmarshal(e.Message, &ints) == nil {
+		for _, n := range ints {
+			b = append(b, byte(n))
+		}
+	}
+	return string(b)
+}
+
+// unitLogs はユニットのログを journalctl から読む。
+func unitLogs(ctx context.Context, pc config.ProcessConfig, opts LogOptions) (io.ReadCloser, error) {
+	args := []string{"--unit", pc.Unit, "--output", "json", "--no-pager"}
+	if opts.Tail < 0 {
+		args = append(args, "--lines", "all")
+	} else {
+		args = append(args, "--lines", strconv.Itoa(opts.Tail))
+	}
+	// journalctl は "@" に続く UNIX 時間を受け付ける。
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", fmt.Sprintf("@%d", opts.Since.Unix()))
+	}
+	if !opts.Until.IsZero() {
+		args = append(args, "--until", fmt.Sprintf("@%d", opts.Until.Unix()+1))
+	}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+
+	return newStream(ctx, func(ctx context.Context, w *io.PipeWriter) error {
+		cmd := exec.CommandContext(ctx, "journalctl", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		// 秒未満の範囲は journalctl に渡せないため、ここで絞り込む。
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64<<10), maxLogLine*8)
+		var werr error
+		for scanner.Scan() && werr == nil {
+			var e journalEntry
+			if json.Unmarshal(scanner.Bytes(), &e) != nil {
+				continue
+			}
+			usec, _ := strconv.ParseInt(e.Timestamp, 10, 64)
+			t := time.UnixMicro(usec)
+			if inRange(t, opts) {
+				_, werr = io.WriteString(w, formatLine(t, strings.TrimRight(e.text(), "\n"), opts))
+			}
+		}
+		if werr == nil {
+			werr = scanner.Err()
+		}
+		if werr != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return werr
+		}
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			return fmt.Errorf("journalctl: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}), nil
+}
@@ -0,0 +1,165 @@
+package proxyreg
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// bareKeyPattern は TOML で引用符を付けずに記述できるキー。
+var bareKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// MARK: setVelocityServer()
+// velocity.toml の [servers] に `name = "address"` を設定する (Address が空の場合は削除する)。
+// コメントや他の設定を保つため、TOML として再出力せずに該当する行のみを書き換える。新しいサーバーは try の行の前へ追加する。
+func setVelocityServer(data []byte, e entry) ([]byte, bool, error) {
+	lines := strings.Split(string(data), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "[servers]" {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil, false, fmt.Errorf("[servers] section not found")
+	}
+	end := len(lines)
+	for i := start; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "[") {
+			end = i
+			break
+		}
+	}
+
+	key := e.Name
+	if !bareKeyPattern.MatchString(key) {
+		key = strconv.Quote(key)
+	}
+	newLine := key + " = " + strconv.Quote(e.Address)
+	insertAt := -1
+	for i := start; i < end; i++ {
+		k, _, ok := strings.Cut(lines[i], "=")
+		if !ok || strings.HasPrefix(strings.TrimSpace(lines[i]), "#") {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		if unquoted, err := strconv.Unquote(k); err == nil {
+			k = unquoted
+		}
+		switch {
+		case k == e.Name && e.Address == "":
+			return []byte(strings.Join(append(lines[:i:i], lines[i+1:]...), "\n")), true, nil
+		case k == e.Name:
+			if strings.TrimSpace(lines[i]) == newLine {
+				return data, false, nil
+			}
+			lines[i] = newLine
+			return []byte(strings.Join(lines, "\n")), true, nil
+		case k == "try" && insertAt < 0:
+			insertAt = i
+		}
+	}
+	if e.Address == "" {
+		return data, false, nil
+	}
+	if insertAt < 0 {
+		// 末尾の空行の前へ追加し、次のセクションとの間の空行を保つ。
+		insertAt = end
+		for insertAt > start && strings.TrimSpace(lines[insertAt-1]) == "" {
+			insertAt--
+		}
+	}
+	lines = append(lines[:insertAt], append([]string{newLine}, lines[insertAt:]...)...)
+	return []byte(strings.Join(lines, "\n")), true, nil
+}
+
+// MARK: setBungeeServer()
+// BungeeCord の config.yml の servers に name: {motd, address, restricted} を設定する (Address が空の場合は削除する)。
+// コメントを保つため、yaml.Node として読み込んだ上で該当する項目のみを変更する。
+func setBungeeServer(data []byte, e entry) ([]byte, bool, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, false, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, false, fmt.Errorf("config.yml is not a mapping")
+	}
+	root := doc.Content[0]
+	servers := mappingValue(root, "servers")
+	if servers == nil {
+		if e.Address == "" {
+			return data, false, nil
+		}
+		servers = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, scalar("servers"), servers)
+	}
+	if servers.Kind != yaml.MappingNode {
+		return nil, false, fmt.Errorf("servers is not a mapping")
+	}
+
+	index := -1
+	for i := 0; i+1 < len(servers.Content); i += 2 {
+		if servers.Content[i].Value == e.Name {
+			index = i
+			break
+		}
+	}
+	switch {
+	case e.Address == "" && index < 0:
+		return data, false, nil
+	case e.Address == "":
+		servers.Content = append(servers.Content[:index], servers.Content[index+2:]...)
+	case index >= 0:
+		server := servers.Content[index+1]
+		if address := mappingValue(server, "address"); address != nil {
+			if address.Value == e.Address {
+				return data, false, nil
+			}
+			address.Value = e.Address
+		} else if server.Kind == yaml.MappingNode {
+			server.Content = append(server.Content, scalar("address"), scalar(e.Address))
+		} else {
+			return nil, false, fmt.Errorf("servers.%s is not a mapping", e.Name)
+		}
+	default:
+		server := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			scalar("motd"), scalar(e.MOTD),
+			scalar("address"), scalar(e.Address),
+			scalar("restricted"), {Kind: yaml.ScalarNode, Tag: "!!bool", Value: "false"},
+		}}
+		servers.Content = append(servers.Content, scalar(e.Name), server)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, false, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// mappingValue はマッピングのキーに対応する値のノードを返す。
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
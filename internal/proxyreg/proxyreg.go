@@ -0,0 +1,221 @@
+package proxyreg
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+)
+
+// apiTimeout はプロキシの API への 1 回の要求の期限。
+const apiTimeout = 10 * time.Second
+
+// defaultReloadCommands は reloadCommand を省略した場合に、プロキシの種類ごとに送るコマンド。
+var defaultReloadCommands = map[string]string{
+	"velocity":   "velocity reload",
+	"bungeecord": "greload",
+}
+
+// MARK: Registrar
+// バックエンドのサーバーの起動・停止のイベントを購読し、proxies に設定した Velocity / BungeeCord のプロキシへ登録・削除する。
+// ロビーを含むネットワークで、動的に起動するサーバーのためにプロキシの設定を手で編集せずに済むようにする。
+type Registrar struct {
+	Config *config.LoadedConfig
+
+	// mu は同じ設定ファイルへの書き込みが並行しないよう、登録・削除を直列にする。
+	mu sync.Mutex
+}
+
+// MARK: NewRegistrar()
+func NewRegistrar(cfg *config.LoadedConfig) *Registrar {
+	return &Registrar{Config: cfg}
+}
+
+// MARK: Start()
+// イベントの購読と、play-bin の停止中に起動・停止したサーバーの登録状態の同期を開始する。
+func (r *Registrar) Start() {
+	events, _ := docker.Events.Subscribe()
+	go func() {
+		for ev := range events {
+			if (ev.Action != "start" && ev.Action != "die") || ev.Host != docker.HostOf(ev.Server) {
+				continue
+			}
+			if r.Config.Get().Servers[ev.Server].Proxy == nil {
+				continue
+			}
+			go r.update(ev.Server, ev.Action == "start")
+		}
+	}()
+	go r.resume()
+}
+
+// resume は proxy を設定した全てのサーバーについて、稼働中であれば登録し、停止中であれば削除する。
+func (r *Registrar) resume() {
+	cfg := r.Config.Get()
+	for _, serverName := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		if cfg.Servers[serverName].Proxy == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		inspect, err := docker.Inspects.Inspect(ctx, serverName)
+		cancel()
+		running := err == nil && inspect.State != nil && inspect.State.Running
+		r.update(serverName, running)
+	}
+}
+
+// update はサーバーをプロキシへ登録 (register が true) または削除する。
+func (r *Registrar) update(serverName string, register bool) {
+	cfg := r.Config.Get()
+	sp := cfg.Servers[serverName].Proxy
+	if sp == nil {
+		return
+	}
+	px, ok := cfg.Proxies[sp.Network]
+	if !ok {
+		return
+	}
+	entry := entry{Name: cmp.Or(sp.Name, serverName), MOTD: cmp.Or(sp.MOTD, sp.Name, serverName)}
+	if register {
+		entry.Address = sp.Address
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		changed bool
+		err     error
+	)
+	if px.API != "" {
+		changed, err = true, callAPI(px, entry)
+	} else {
+		changed, err = updateConfigFile(cfg, px, entry)
+	}
+	action := "登録"
+	if !register {
+		action = "削除"
+	}
+	if err != nil {
+		logger.Errorf("External", "Proxy", "プロキシ %s への%sに失敗(%s): %v", sp.Network, action, serverName, err)
+		return
+	}
+	if changed {
+		logger.Logf("Internal", "Proxy", "プロキシ %s へ%sしました: %s (%s)", sp.Network, action, entry.Name, cmp.Or(entry.Address, "-"))
+	}
+}
+
+// entry はプロキシへ登録するサーバー。Address が空の場合は削除を表す。
+type entry struct {
+	Name    string
+	Address string
+	MOTD    string
+}
+
+// MARK: callAPI()
+// プロキシのプラグインの HTTP API へ登録・削除を要求する。
+// 本文は {"action": "register" | "unregister", "name": ..., "address": ...} とし、2xx 以外の応答はエラーとする。
+func callAPI(px config.ProxyConfig, e entry) error {
+	body := map[string]string{"action": "register", "name": e.Name, "address": e.Address}
+	if e.Address == "" {
+		body = map[string]string{"action": "unregister", "name": e.Name}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	token, err := apiToken(px)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, px.API, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// apiToken は API のトークンを返す。apiTokenFile は apiToken より優先する。
+func apiToken(px config.ProxyConfig) (string, error) {
+	if px.APITokenFile != "" {
+		b, err := os.ReadFile(px.APITokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read apiTokenFile: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return px.APIToken, nil
+}
+
+// MARK: updateConfigFile()
+// プロキシの設定ファイルのサーバーの一覧を書き換え、変更した場合は再読み込みのコマンドをプロキシへ送る。
+// プロキシが停止中でコマンドを送れない場合も、次回の起動時に設定ファイルから読み込まれるため成功とする。
+func updateConfigFile(cfg config.Config, px config.ProxyConfig, e entry) (bool, error) {
+	path := px.ConfigFile
+	if px.Server != "" {
+		if !docker.IsLocal(px.Server) {
+			return false, fmt.Errorf("proxy server %s is on a remote docker host; use api instead", px.Server)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.Servers[px.Server].WorkingDir, path)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var out []byte
+	var changed bool
+	switch px.Type {
+	case "velocity":
+		out, changed, err = setVelocityServer(data, e)
+	case "bungeecord":
+		out, changed, err = setBungeeServer(data, e)
+	default:
+		return false, fmt.Errorf("unknown proxy type %q", px.Type)
+	}
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := fsutil.WriteFile(path, out, 0o644); err != nil {
+		return false, err
+	}
+
+	if px.Server != "" {
+		command := cmp.Or(px.ReloadCommand, defaultReloadCommands[px.Type])
+		if err := docker.SendCommand(px.Server, command+"\n"); err != nil {
+			logger.Warnf("Internal", "Proxy", "再読み込みのコマンドを送信できませんでした(%s)。次回の起動時に反映されます: %v", px.Server, err)
+		}
+	}
+	return true, nil
+}
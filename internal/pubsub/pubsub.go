@@ -0,0 +1,54 @@
+package pubsub
+
+import "sync"
+
+// subscriberBuffer は購読者ごとの受信バッファの件数。
+const subscriberBuffer = 64
+
+// MARK: Hub
+// 値を複数の購読者へファンアウトする。ゼロ値のまま使用できる。
+// 受信側の処理が滞った場合、発生元を止めないよう該当購読者への値は破棄される。
+// 取りこぼしが許されない処理は、購読ではなく発生元の同期的な通知を使用すること。
+type Hub[T any] struct {
+	mu          sync.RWMutex
+	subscribers map[int]chan T
+	nextID      int
+}
+
+// MARK: Subscribe()
+// 値を受信するためのチャネルと、購読を解除するための関数を返す。解除するとチャネルは閉じられる。
+func (h *Hub[T]) Subscribe() (<-chan T, func()) {
+	ch := make(chan T, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[int]chan T)
+	}
+	id := h.nextID
+	h.nextID++
+	h.subscribers[id] = ch
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, id)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// MARK: Publish()
+// 値を全購読者へ非ブロッキングで配信する。受信バッファが溢れている購読者は飛ばし、他の購読者への配信を優先する。
+func (h *Hub[T]) Publish(v T) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, ch := range h.subscribers {
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+}
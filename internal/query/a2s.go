@@ -0,0 +1,107 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+var a2sInfoRequest = append([]byte{0xFF, 0xFF, 0xFF, 0xFF, 'T'}, "Source Engine Query\x00"...)
+
+const (
+	a2sHeaderInfo      = 0x49
+	a2sHeaderChallenge = 0x41
+)
+
+// MARK: probeA2S()
+// Source Engine 系サーバー（Valheim, ARK, Rust 等の Steam 対応サーバー）に A2S_INFO で問い合わせる。
+func probeA2S(ctx context.Context, address string) (Result, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	resp, err := a2sRoundTrip(conn, a2sInfoRequest)
+	if err != nil {
+		return Result{}, err
+	}
+	// 増幅攻撃対策としてチャレンジ番号を要求された場合は、それを付与して再送する。
+	if len(resp) >= 5 && resp[0] == a2sHeaderChallenge {
+		resp, err = a2sRoundTrip(conn, append(append([]byte(nil), a2sInfoRequest...), resp[1:5]...))
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if len(resp) == 0 || resp[0] != a2sHeaderInfo {
+		return Result{}, errors.New("unexpected A2S response")
+	}
+
+	r := bytes.NewReader(resp[1:])
+	if _, err := r.ReadByte(); err != nil { // プロトコルバージョン
+		return Result{}, err
+	}
+	name, err := readCString(r)
+	if err != nil {
+		return Result{}, err
+	}
+	mapName, err := readCString(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if _, err := readCString(r); err != nil { // folder
+		return Result{}, err
+	}
+	game, err := readCString(r)
+	if err != nil {
+		return Result{}, err
+	}
+	var fixed [5]byte // app id (2), players, max players, bots
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Players:    int(fixed[2]),
+		MaxPlayers: int(fixed[3]),
+		MOTD:       name,
+		Version:    game,
+		Map:        mapName,
+	}, nil
+}
+
+// a2sRoundTrip は 1 パケットを送信し、単一パケットの応答を受信する。
+func a2sRoundTrip(conn net.Conn, req []byte) ([]byte, error) {
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1400)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	// 単一パケットの応答はヘッダー 0xFFFFFFFF で始まる（分割パケットは A2S_INFO では通常発生しない）。
+	if n < 5 || !bytes.Equal(buf[:4], []byte{0xFF, 0xFF, 0xFF, 0xFF}) {
+		return nil, fmt.Errorf("unsupported A2S packet header")
+	}
+	return buf[4:n], nil
+}
+
+func readCString(r *bytes.Reader) (string, error) {
+	var b []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == 0 {
+			return string(b), nil
+		}
+		b = append(b, c)
+	}
+}
@@ -0,0 +1,170 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxStatusLength はステータス応答として受け入れる最大長。不正な応答で大量のメモリを確保しないための上限。
+const maxStatusLength = 1 << 20
+
+// minecraftStatus は Server List Ping の応答 JSON のうち、使用するフィールドのみを定義する。
+type minecraftStatus struct {
+	Version struct {
+		Name string `json:"name"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"`
+}
+
+// MARK: probeMinecraft()
+// Minecraft Java Edition の Server List Ping (1.7 以降) でプレイヤー数と MOTD を取得する。
+func probeMinecraft(ctx context.Context, address string) (Result, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return Result{}, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid port: %w", err)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Handshake (next state = 1: status) に続けて Status Request を送信する。
+	var handshake bytes.Buffer
+	WriteVarInt(&handshake, 0x00)
+	WriteVarInt(&handshake, -1) // プロトコルバージョン。ステータス取得のみのため任意の値でよい
+	WriteVarInt(&handshake, int32(len(host)))
+	handshake.WriteString(host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	WriteVarInt(&handshake, 1)
+
+	var packet bytes.Buffer
+	WriteVarInt(&packet, int32(handshake.Len()))
+	packet.Write(handshake.Bytes())
+	WriteVarInt(&packet, 1)
+	packet.WriteByte(0x00)
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		return Result{}, err
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := ReadVarInt(r); err != nil { // パケット長
+		return Result{}, err
+	}
+	if id, err := ReadVarInt(r); err != nil {
+		return Result{}, err
+	} else if id != 0x00 {
+		return Result{}, fmt.Errorf("unexpected packet id: %d", id)
+	}
+	length, err := ReadVarInt(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if length < 0 || length > maxStatusLength {
+		return Result{}, fmt.Errorf("invalid status length: %d", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Result{}, err
+	}
+
+	var status minecraftStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return Result{}, fmt.Errorf("invalid status response: %w", err)
+	}
+	return Result{
+		Players:    status.Players.Online,
+		MaxPlayers: status.Players.Max,
+		MOTD:       chatText(status.Description),
+		Version:    status.Version.Name,
+	}, nil
+}
+
+// chatText は Minecraft のチャットコンポーネント（文字列またはオブジェクト）から装飾を除いたテキストを取り出す。
+func chatText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return stripFormatting(s)
+	}
+	var component struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if json.Unmarshal(raw, &component) != nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(component.Text)
+	for _, e := range component.Extra {
+		b.WriteString(chatText(e))
+	}
+	return stripFormatting(b.String())
+}
+
+// stripFormatting は "§" に続く書式コードを取り除く。
+func stripFormatting(s string) string {
+	var b strings.Builder
+	skip := false
+	for _, r := range s {
+		if skip {
+			skip = false
+			continue
+		}
+		if r == '§' {
+			skip = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// WriteVarInt は Minecraft プロトコルの可変長整数 (VarInt) を書き込む。
+func WriteVarInt(w *bytes.Buffer, v int32) {
+	u := uint32(v)
+	for {
+		if u&^0x7F == 0 {
+			w.WriteByte(byte(u))
+			return
+		}
+		w.WriteByte(byte(u&0x7F | 0x80))
+		u >>= 7
+	}
+}
+
+// ReadVarInt は Minecraft プロトコルの可変長整数 (VarInt) を読み込む。
+func ReadVarInt(r io.ByteReader) (int32, error) {
+	var result uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(result), nil
+		}
+	}
+	return 0, errors.New("varint is too long")
+}
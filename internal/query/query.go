@@ -0,0 +1,110 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+)
+
+const (
+	defaultTimeout = 3 * time.Second
+	// cacheTTL は問い合わせ結果を再利用する期間。統計ストリーム等から高頻度に参照されてもゲームサーバーへ負荷を掛けないようにする。
+	cacheTTL = 10 * time.Second
+)
+
+// Result はゲームサーバーへの問い合わせ結果を表す。
+type Result struct {
+	Online     bool      `json:"online"`
+	Players    int       `json:"players"`
+	MaxPlayers int       `json:"maxPlayers"`
+	MOTD       string    `json:"motd,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	Map        string    `json:"map,omitempty"`
+	Latency    int64     `json:"latency"` // ミリ秒
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt"`
+	Supported  bool      `json:"supported"` // プレイヤー数を取得できるプロトコルか（tcp は false）
+	ProbeType  string    `json:"type"`
+}
+
+// MARK: Probe()
+// 設定されたプロトコルでサーバーへ問い合わせる。接続できない場合もエラーではなく Online=false の結果を返す。
+func Probe(ctx context.Context, cfg config.QueryConfig) (Result, error) {
+	timeout := defaultTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var result Result
+	var err error
+	switch cfg.Type {
+	case "minecraft":
+		result, err = probeMinecraft(ctx, cfg.Address)
+		result.Supported = true
+	case "a2s":
+		result, err = probeA2S(ctx, cfg.Address)
+		result.Supported = true
+	case "tcp":
+		var conn net.Conn
+		if conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", cfg.Address); err == nil {
+			conn.Close()
+		}
+	default:
+		return Result{}, fmt.Errorf("unknown query type: %q", cfg.Type)
+	}
+
+	result.ProbeType = cfg.Type
+	result.CheckedAt = time.Now()
+	if err != nil {
+		result.Online = false
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Online = true
+	result.Latency = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+type cacheEntry struct {
+	cfg    config.QueryConfig
+	result Result
+}
+
+var (
+	cache   = make(map[string]cacheEntry)
+	cacheMu sync.Mutex
+	// inflight は同一サーバーへの同時問い合わせを 1 つにまとめるためのロック。
+	inflight sync.Map
+)
+
+// MARK: Cached()
+// サーバー名単位で問い合わせ結果をキャッシュし、cacheTTL 以内であれば再利用する。設定が変更された場合は即座に再問い合わせする。
+func Cached(ctx context.Context, serverName string, cfg config.QueryConfig) (Result, error) {
+	lock, _ := inflight.LoadOrStore(serverName, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	cacheMu.Lock()
+	entry, ok := cache[serverName]
+	cacheMu.Unlock()
+	if ok && entry.cfg == cfg && time.Since(entry.result.CheckedAt) < cacheTTL {
+		return entry.result, nil
+	}
+
+	result, err := Probe(ctx, cfg)
+	if err != nil {
+		return result, err
+	}
+	cacheMu.Lock()
+	cache[serverName] = cacheEntry{cfg: cfg, result: result}
+	cacheMu.Unlock()
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package rcon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/play-bin/internal/config"
+)
+
+// Source RCON プロトコルのパケット種別。Minecraft や Source Engine 系のゲームサーバーが対応している。
+const (
+	typeResponse     = 0
+	typeExecCommand  = 2
+	typeAuthResponse = 2
+	typeAuth         = 3
+)
+
+// maxPacketSize は受け入れる応答パケットの最大長。
+const maxPacketSize = 1 << 16
+
+const defaultTimeout = 5 * time.Second
+
+var ErrAuthFailed = errors.New("rcon authentication failed")
+
+// MARK: Exec()
+// RCON でコマンドを 1 件実行し、応答の本文を返す。接続はコマンドごとに確立する。
+func Exec(ctx context.Context, cfg config.RCONConfig, command string) (string, error) {
+	password := cfg.Password
+	if cfg.PasswordFile != "" {
+		b, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passwordFile: %w", err)
+		}
+		password = strings.TrimSpace(string(b))
+	}
+
+	conn, err := (&net.Dialer{Timeout: defaultTimeout}).DialContext(ctx, "tcp", cfg.Address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(defaultTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	r := bufio.NewReader(conn)
+
+	// 認証。失敗時は要求 ID が -1 の応答が返る。
+	if err := writePacket(conn, 1, typeAuth, password); err != nil {
+		return "", err
+	}
+	for {
+		id, typ, _, err := readPacket(r)
+		if err != nil {
+			return "", err
+		}
+		if typ != typeAuthResponse {
+			// 一部の実装は認証応答の前に空の応答パケットを送るため読み飛ばす。
+			continue
+		}
+		if id == -1 {
+			return "", ErrAuthFailed
+		}
+		break
+	}
+
+	if err := writePacket(conn, 2, typeExecCommand, command); err != nil {
+		return "", err
+	}
+	id, _, body, err := readPacket(r)
+	if err != nil {
+		return "", err
+	}
+	if id != 2 {
+		return "", fmt.Errorf("unexpected rcon response id: %d", id)
+	}
+	return body, nil
+}
+
+func writePacket(w io.Writer, id, typ int32, body string) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(4+4+len(body)+2))
+	binary.Write(&buf, binary.LittleEndian, id)
+	binary.Write(&buf, binary.LittleEndian, typ)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readPacket(r io.Reader) (id, typ int32, body string, err error) {
+	var length int32
+	if err = binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return
+	}
+	if length < 10 || length > maxPacketSize {
+		err = fmt.Errorf("invalid rcon packet length: %d", length)
+		return
+	}
+	payload := make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	id = int32(binary.LittleEndian.Uint32(payload[0:4]))
+	typ = int32(binary.LittleEndian.Uint32(payload[4:8]))
+	body = string(bytes.TrimRight(payload[8:], "\x00"))
+	return
+}
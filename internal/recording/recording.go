@@ -0,0 +1,307 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+// 録画ファイルは <directory>/<server>/<user>/<開始時刻(UnixNano)>-<mode>.cast に保存する。
+// ユーザーごとにディレクトリを分けることで、ユーザー単位の保持期間を適用しやすくしている。
+const fileExt = ".cast"
+
+// 録画開始時点ではクライアントの表示サイズが不明なため、一般的な端末サイズをヘッダーに記録し、
+// 以降の変更はリサイズイベントとして記録する。
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// Info は録画ファイル 1 件の情報を表す。
+type Info struct {
+	Name      string    `json:"name"` // <user>/<file> 形式。再生 API の指定に使用する
+	User      string    `json:"user"`
+	Mode      string    `json:"mode"` // exec, attach
+	StartedAt time.Time `json:"startedAt"`
+	Size      int64     `json:"size"`
+}
+
+// header は asciicast v2 形式の先頭行。
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// MARK: Recorder
+// 端末セッションの入出力を、タイムスタンプ付きのイベント列として asciicast v2 形式で書き出す。
+type Recorder struct {
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	start   time.Time
+	pending []byte // 出力チャンクの末尾で途切れた UTF-8 のマルチバイト文字
+}
+
+// MARK: Start()
+// 録画を開始する。設定で録画が無効な場合は nil を返す（nil の Recorder への操作は全て無視される）。
+func Start(cfg *config.RecordingConfig, server, user, mode string) (*Recorder, error) {
+	if cfg == nil || cfg.Directory == "" {
+		return nil, nil
+	}
+	if !validName(server) || !validName(user) {
+		return nil, fmt.Errorf("invalid recording path component: server=%q, user=%q", server, user)
+	}
+
+	dir := filepath.Join(cfg.Directory, server, user)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%d-%s%s", start.UnixNano(), mode, fileExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{f: f, w: bufio.NewWriter(f), start: start}
+	b, _ := json.Marshal(header{
+		Version:   2,
+		Width:     defaultWidth,
+		Height:    defaultHeight,
+		Timestamp: start.Unix(),
+		Title:     fmt.Sprintf("%s@%s (%s)", user, server, mode),
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	r.w.Write(append(b, '\n'))
+	logger.Logf("Internal", "Recording", "録画を開始しました: %s", path)
+	return r, nil
+}
+
+// Write はコンテナからの出力を記録する。io.Writer として出力経路に挟み込めるよう、常に成功を返す。
+func (r *Recorder) Write(p []byte) (int, error) {
+	if r == nil {
+		return len(p), nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// JSON 文字列は有効な UTF-8 である必要があるため、途切れた文字は次のチャンクと結合してから記録する。
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	r.event("o", string(data[:cut]))
+	return len(p), nil
+}
+
+// Input はクライアントからの入力を記録する。
+func (r *Recorder) Input(p []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("i", string(p))
+}
+
+// Resize は端末サイズの変更を記録する。
+func (r *Recorder) Resize(cols, rows uint) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close は未書き込みのデータをフラッシュしてファイルを閉じる。
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func (r *Recorder) event(kind, data string) {
+	if data == "" {
+		return
+	}
+	b, _ := json.Marshal([]any{time.Since(r.start).Seconds(), kind, data})
+	r.w.Write(append(b, '\n'))
+}
+
+// MARK: List()
+// 指定サーバーの録画一覧を新しい順に返す。
+func List(cfg *config.RecordingConfig, server string) ([]Info, error) {
+	result := []Info{}
+	if cfg == nil || cfg.Directory == "" || !validName(server) {
+		return result, nil
+	}
+
+	userDirs, err := os.ReadDir(filepath.Join(cfg.Directory, server))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return result, nil
+		}
+		return nil, err
+	}
+	for _, userDir := range userDirs {
+		if !userDir.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(cfg.Directory, server, userDir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			startedAt, mode, ok := parseFileName(e.Name())
+			if !ok {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				continue
+			}
+			result = append(result, Info{
+				Name:      userDir.Name() + "/" + e.Name(),
+				User:      userDir.Name(),
+				Mode:      mode,
+				StartedAt: startedAt,
+				Size:      fi.Size(),
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.After(result[j].StartedAt) })
+	return result, nil
+}
+
+// MARK: Open()
+// List が返した名前（<user>/<file>）から録画ファイルを開く。ディレクトリトラバーサルを防ぐため形式を厳密に検証する。
+func Open(cfg *config.RecordingConfig, server, name string) (*os.File, error) {
+	if cfg == nil || cfg.Directory == "" {
+		return nil, os.ErrNotExist
+	}
+	user, file, ok := strings.Cut(name, "/")
+	if !ok || !validName(server) || !validName(user) || !validName(file) {
+		return nil, os.ErrNotExist
+	}
+	if _, _, ok := parseFileName(file); !ok {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(filepath.Join(cfg.Directory, server, user, file))
+}
+
+// MARK: Prune()
+// ユーザーごとの保持日数を過ぎた録画を削除する。
+func Prune(cfg *config.RecordingConfig) {
+	if cfg == nil || cfg.Directory == "" {
+		return
+	}
+	servers, err := os.ReadDir(cfg.Directory)
+	if err != nil {
+		return
+	}
+	removed := 0
+	for _, server := range servers {
+		if !server.IsDir() {
+			continue
+		}
+		users, err := os.ReadDir(filepath.Join(cfg.Directory, server.Name()))
+		if err != nil {
+			continue
+		}
+		for _, user := range users {
+			days := cfg.RetentionFor(user.Name())
+			if !user.IsDir() || days <= 0 {
+				continue
+			}
+			deadline := time.Now().AddDate(0, 0, -days)
+			dir := filepath.Join(cfg.Directory, server.Name(), user.Name())
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				startedAt, _, ok := parseFileName(e.Name())
+				if !ok || startedAt.After(deadline) {
+					continue
+				}
+				if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+					logger.Errorf("Internal", "Recording", "録画の削除に失敗: %v", err)
+					continue
+				}
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		logger.Logf("Internal", "Recording", "保持期間を過ぎた録画を %d 件削除しました", removed)
+	}
+}
+
+// MARK: StartJanitor()
+// 保持期間の適用を定期的に行うゴルーチンを開始する。
+func StartJanitor(cfg *config.LoadedConfig) {
+	go func() {
+		for {
+			c := cfg.Get()
+			Prune(c.Recording)
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// parseFileName はファイル名から録画開始時刻とモードを取り出す。
+func parseFileName(name string) (time.Time, string, bool) {
+	base, ok := strings.CutSuffix(name, fileExt)
+	if !ok {
+		return time.Time{}, "", false
+	}
+	ts, mode, ok := strings.Cut(base, "-")
+	if !ok {
+		return time.Time{}, "", false
+	}
+	nano, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(0, nano), mode, true
+}
+
+// validName はパスの 1 要素として安全に使用できる名前かを判定する。
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
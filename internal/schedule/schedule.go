@@ -0,0 +1,253 @@
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/fsutil"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/rcon"
+)
+
+var (
+	ErrNotFound   = errors.New("schedule not found")
+	ErrNotRunning = errors.New("container is not running")
+)
+
+// Schedule はサーバーへ定期的にコマンドを送信する予定 1 件を表す。
+type Schedule struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	Name      string    `json:"name"`
+	Cron      string    `json:"cron"`     // 5 フィールドの cron 式、または @hourly 等
+	Commands  []string  `json:"commands"` // 順に送信するコマンド
+	Via       string    `json:"via"`      // "attach"（コンソールへの入力）または "rcon"
+	Enabled   bool      `json:"enabled"`
+	LastRun   time.Time `json:"lastRun,omitzero"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// MARK: Scheduler
+// API から管理される定期コマンドを保持し、毎分の巡回で実行する。予定はファイルへ永続化する。
+type Scheduler struct {
+	Config *config.LoadedConfig
+
+	mu        sync.Mutex
+	path      string
+	schedules []Schedule
+}
+
+// MARK: NewScheduler()
+// 予定ファイルが存在すれば読み込み、存在しない場合は空の状態で開始する。
+func NewScheduler(cfg *config.LoadedConfig, path string) *Scheduler {
+	s := &Scheduler{Config: cfg, path: path}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Internal", "Schedule", "定期コマンドの読み込みに失敗: %v", err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(b, &s.schedules); err != nil {
+		logger.Errorf("Internal", "Schedule", "定期コマンドのパースに失敗: %v", err)
+		s.schedules = nil
+	}
+	return s
+}
+
+// MARK: Start()
+// 毎分 0 秒に、その時刻に一致する有効な予定を実行するループを開始する。
+func (s *Scheduler) Start() {
+	go func() {
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			time.Sleep(next.Sub(now))
+			s.tick(next)
+		}
+	}()
+}
+
+// tick は指定時刻に一致する予定を非同期で実行する。
+func (s *Scheduler) tick(t time.Time) {
+	s.mu.Lock()
+	var due []Schedule
+	for _, sc := range s.schedules {
+		if !sc.Enabled {
+			continue
+		}
+		spec, err := ParseSpec(sc.Cron)
+		if err != nil || !spec.Match(t) {
+			continue
+		}
+		due = append(due, sc)
+	}
+	s.mu.Unlock()
+
+	for _, sc := range due {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := s.execute(ctx, sc); err != nil && !errors.Is(err, ErrNotRunning) {
+				logger.Errorf("Internal", "Schedule", "定期コマンドの実行に失敗(%s, %s): %v", sc.Server, sc.Name, err)
+			}
+		}()
+	}
+}
+
+// MARK: List()
+// サーバーの予定一覧を返す。
+func (s *Scheduler) List(serverName string) []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Schedule{}
+	for _, sc := range s.schedules {
+		if sc.Server == serverName {
+			list = append(list, sc)
+		}
+	}
+	return list
+}
+
+// MARK: Put()
+// 予定を追加または更新する。ID が空の場合は新規に採番する。実行結果（lastRun 等）は既存の値を引き継ぐ。
+func (s *Scheduler) Put(sc Schedule) (Schedule, error) {
+	if _, err := ParseSpec(sc.Cron); err != nil {
+		return Schedule{}, err
+	}
+	if sc.Via == "" {
+		sc.Via = "attach"
+	}
+	if sc.Via != "attach" && sc.Via != "rcon" {
+		return Schedule{}, fmt.Errorf("unknown via: %q", sc.Via)
+	}
+	sc.Commands = slices.DeleteFunc(sc.Commands, func(c string) bool { return strings.TrimSpace(c) == "" })
+	if len(sc.Commands) == 0 {
+		return Schedule{}, errors.New("commands is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sc.ID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		sc.ID = hex.EncodeToString(b)
+		sc.LastRun, sc.LastError = time.Time{}, ""
+		s.schedules = append(s.schedules, sc)
+	} else {
+		i := s.indexLocked(sc.Server, sc.ID)
+		if i < 0 {
+			return Schedule{}, ErrNotFound
+		}
+		sc.LastRun, sc.LastError = s.schedules[i].LastRun, s.schedules[i].LastError
+		s.schedules[i] = sc
+	}
+	s.saveLocked()
+	return sc, nil
+}
+
+// MARK: Delete()
+// 予定を削除する。
+func (s *Scheduler) Delete(serverName, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexLocked(serverName, id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.schedules = slices.Delete(s.schedules, i, i+1)
+	s.saveLocked()
+	return nil
+}
+
+// MARK: Run()
+// 予定を即時に実行する（動作確認用）。
+func (s *Scheduler) Run(ctx context.Context, serverName, id string) error {
+	s.mu.Lock()
+	i := s.indexLocked(serverName, id)
+	var sc Schedule
+	if i >= 0 {
+		sc = s.schedules[i]
+	}
+	s.mu.Unlock()
+	if i < 0 {
+		return ErrNotFound
+	}
+	return s.execute(ctx, sc)
+}
+
+// execute は予定のコマンドを順に送信し、実行結果を記録する。停止中のサーバーには送信しない。
+func (s *Scheduler) execute(ctx context.Context, sc Schedule) error {
+	err := s.send(ctx, sc)
+	if errors.Is(err, ErrNotRunning) {
+		return err
+	}
+
+	s.mu.Lock()
+	if i := s.indexLocked(sc.Server, sc.ID); i >= 0 {
+		s.schedules[i].LastRun = time.Now()
+		s.schedules[i].LastError = ""
+		if err != nil {
+			s.schedules[i].LastError = err.Error()
+		}
+		s.saveLocked()
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		logger.Logf("Internal", "Schedule", "定期コマンドを実行しました: %s (%s)", sc.Server, sc.Name)
+	}
+	return err
+}
+
+func (s *Scheduler) send(ctx context.Context, sc Schedule) error {
+	cli, err := docker.ForServer(sc.Server)
+	if err != nil {
+		return err
+	}
+	if inspect, err := docker.InspectOwned(ctx, cli, sc.Server); err != nil || !inspect.State.Running {
+		return ErrNotRunning
+	}
+
+	for _, cmd := range sc.Commands {
+		switch sc.Via {
+		case "rcon":
+			rconCfg := s.Config.Get().Servers[sc.Server].RCON
+			if rconCfg == nil {
+				return errors.New("rcon is not configured for this server")
+			}
+			if _, err := rcon.Exec(ctx, *rconCfg, cmd); err != nil {
+				return err
+			}
+		default:
+			if err := docker.SendCommand(sc.Server, cmd+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexLocked は予定の位置を返す。s.mu を保持した状態で呼び出すこと。
+func (s *Scheduler) indexLocked(serverName, id string) int {
+	return slices.IndexFunc(s.schedules, func(sc Schedule) bool { return sc.Server == serverName && sc.ID == id })
+}
+
+// saveLocked は予定をファイルへ書き出す。s.mu を保持した状態で呼び出すこと。
+func (s *Scheduler) saveLocked() {
+	if err := fsutil.WriteJSON(s.path, s.schedules, 0o600); err != nil {
+		logger.Errorf("Internal", "Schedule", "定期コマンドの保存に失敗: %v", err)
+	}
+}
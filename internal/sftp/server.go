@@ -8,13 +8,17 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
+	"sync"
 
+	ctypes "github.com/docker/docker/api/types/container"
 	"github.com/pkg/sftp"
 	"github.com/play-bin/internal/config"
 	"github.com/play-bin/internal/container"
 	"github.com/play-bin/internal/docker"
 	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/netutil"
 	"github.com/play-bin/internal/vfs"
 	"golang.org/x/crypto/ssh"
 )
@@ -23,6 +27,16 @@ type Server struct {
 	Config           *config.LoadedConfig
 	ContainerManager *container.Manager
 	sshConfig        *ssh.ServerConfig
+
+	// listener と conns は終了時に新しい接続の受け付けを停止し、残ったセッションを閉じるために保持する。
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	// ready は待機を開始した (または SFTP サーバーが無効・起動に失敗した) 時点で閉じられる。
+	ready     chan struct{}
+	readyOnce sync.Once
 }
 
 // MARK: NewServer()
@@ -31,6 +45,8 @@ func NewServer(cfg *config.LoadedConfig, cm *container.Manager) *Server {
 	s := &Server{
 		Config:           cfg,
 		ContainerManager: cm,
+		conns:            make(map[net.Conn]struct{}),
+		ready:            make(chan struct{}),
 	}
 
 	sshConfig := &ssh.ServerConfig{
@@ -52,10 +68,10 @@ func NewServer(cfg *config.LoadedConfig, cm *container.Manager) *Server {
 		if err == nil {
 			sshConfig.AddHostKey(private)
 		} else {
-			logger.Logf("Internal", "SFTP", "ホストキーのパース失敗: %v", err)
+			logger.Errorf("Internal", "SFTP", "ホストキーのパース失敗: %v", err)
 		}
 	} else {
-		logger.Logf("Internal", "SFTP", "ホストキーの読み込み失敗: %v", err)
+		logger.Errorf("Internal", "SFTP", "ホストキーの読み込み失敗: %v", err)
 	}
 
 	s.sshConfig = sshConfig
@@ -68,13 +84,14 @@ func generateHostKey(path string) {
 	cmd := exec.Command("ssh-keygen", "-f", path, "-N", "", "-t", "ed25519")
 	if err := cmd.Run(); err != nil {
 		// 生成失敗はシステム設定（パッケージ不足等）に起因するため Internal で記録。
-		logger.Logf("Internal", "SFTP", "ホストキーの生成に失敗しました: %v", err)
+		logger.Errorf("Internal", "SFTP", "ホストキーの生成に失敗しました: %v", err)
 	}
 }
 
 // MARK: Start()
 // 設定されたアドレスで TCP ポートを開放し、リモートからの SFTP クライアント接続を待ち受ける。
 func (s *Server) Start() {
+	defer s.markReady()
 	listen := s.Config.Get().SFTPListen
 	if listen == "" {
 		// リスニング設定が未定義の場合、誤って全ポートを公開するリスクを避けるため無効化する。
@@ -82,21 +99,105 @@ func (s *Server) Start() {
 		return
 	}
 
-	listener, err := net.Listen("tcp", listen)
+	listener, err := netutil.Listen(listen)
 	if err != nil {
-		logger.Logf("Internal", "SFTP", "ポート %s のリスニング失敗: %v", listen, err)
+		logger.Errorf("Internal", "SFTP", "ポート %s のリスニング失敗: %v", listen, err)
+		return
+	}
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		listener.Close()
 		return
 	}
+	s.listener = listener
+	s.mu.Unlock()
 	logger.Logf("Internal", "SFTP", "SFTPサーバーが開始されました: \"%s\"", listen)
+	s.markReady()
 
 	for {
 		// ユーザーごとの独立したセッションを確保するため、 Accept した接続はゴルーチンへ逃がす。
 		nConn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
 			continue
 		}
-		go s.handleConn(nConn)
+		if !s.track(nConn) {
+			nConn.Close()
+			return
+		}
+		go func() {
+			defer s.untrack(nConn)
+			s.handleConn(nConn)
+		}()
+	}
+}
+
+// MARK: Ready()
+// SFTP サーバーが接続の受け付けを開始した (または無効である) 時点で閉じられるチャネルを返す。
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *Server) markReady() {
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
+// MARK: Shutdown()
+// 新しい接続の受け付けを停止し、転送中のセッションが終了するのを ctx の期限まで待機する。期限を過ぎたセッションは切断する。
+func (s *Server) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	s.closing = true
+	listener := s.listener
+	n := len(s.conns)
+	s.mu.Unlock()
+	if listener == nil {
+		return
+	}
+	listener.Close()
+	if n > 0 {
+		logger.Logf("Internal", "SFTP", "接続中のセッションの終了を待機しています: %d 件", n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.mu.Lock()
+		logger.Logf("Internal", "SFTP", "待機時間を過ぎたため、セッションを切断します: %d 件", len(s.conns))
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+		<-done
 	}
+	logger.Log("Internal", "SFTP", "SFTPサーバーを停止しました")
+}
+
+// track は接続を終了時の待機対象へ登録する。終了処理の開始後は登録せずに false を返す。
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(c net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	c.Close()
+	s.wg.Done()
 }
 
 // MARK: authenticate()
@@ -104,9 +205,9 @@ func (s *Server) Start() {
 func (s *Server) authenticate(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
 	cfg := s.Config.Get()
 	user, ok := cfg.Users[c.User()]
-	if !ok || user.Password != string(pass) {
+	if !ok || !user.CheckPassword(string(pass)) {
 		// 認証失敗は外部からのアタックの可能性があるため、発信元を含めて Client コンテキストで記録。
-		logger.Logf("Client", "SFTP", "ログイン失敗: user=%s, addr=%s", c.User(), c.RemoteAddr())
+		logger.Warnf("Client", "SFTP", "ログイン失敗: user=%s, addr=%s", c.User(), c.RemoteAddr())
 		return nil, fmt.Errorf("authentication failed")
 	}
 
@@ -169,7 +270,7 @@ func (s *Server) handleConn(nConn net.Conn) {
 		})
 
 		if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
-			logger.Logf("Internal", "SFTP", "セッション異常終了 (user=%s): %v", username, err)
+			logger.Errorf("Internal", "SFTP", "セッション異常終了 (user=%s): %v", username, err)
 		}
 	}
 }
@@ -183,10 +284,39 @@ type sftpHandler struct {
 // MARK: Filelist()
 // ディレクトリ内のファイル・フォルダ一覧を生成する。
 func (h *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
-	fullPath, err := h.handler.MapPath(r.Filepath)
-
 	// セキュリティ監査のため、ディレクトリ一覧の取得は常に記録する。
-	logger.Logf("Client", "SFTP", "ディレクトリ一覧取得: user=%s, path=%s", h.handler.Username, r.Filepath)
+	logger.Debugf("Client", "SFTP", "ディレクトリ一覧取得: user=%s, path=%s", h.handler.Username, r.Filepath)
+
+	// コンテナ内のファイルシステム：Docker から直接読み出す。
+	if serverName, inner, ok, err := h.handler.ContainerPath(r.Filepath); ok {
+		if err != nil {
+			return nil, err
+		}
+		return containerList(r.Method, serverName, inner)
+	}
+
+	// 状態とログの仮想ファイル：要求の都度、現在の状態から生成する。
+	if serverName, file, ok, err := h.handler.StatusPath(r.Filepath); ok {
+		if err != nil {
+			return nil, err
+		}
+		if r.Method != "Stat" {
+			return nil, sftp.ErrSSHFxOpUnsupported
+		}
+		f, err := h.handler.OpenStatus(serverName, file)
+		if err != nil {
+			return nil, err
+		}
+		info, _ := f.Stat()
+		return &listerAt{items: []os.FileInfo{info}}, nil
+	}
+
+	// バックアップの世代：ホスト上の世代のディレクトリから読み取り専用で提供する。
+	if fullPath, ok, err := h.handler.BackupPath(r.Filepath); ok {
+		return h.backupList(r.Method, r.Filepath, fullPath, err)
+	}
+
+	fullPath, err := h.handler.MapPath(r.Filepath)
 
 	if err != nil {
 		// ルート階層：許可されたコンテナ名を一覧として返す。
@@ -206,16 +336,29 @@ func (h *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
 			containerName := strings.Trim(r.Filepath, "/")
 			var items []os.FileInfo
 
-			// コンテナの実体から現在のマウント状況を問い合わせる。
-			inspect, err := docker.Client.ContainerInspect(context.Background(), containerName)
+			// コンテナの実体から現在のマウント状況を問い合わせる（リモートホスト上のコンテナは対象外）。
+			cli, err := docker.ForServer(containerName)
+			var inspect ctypes.InspectResponse
+			if err == nil && docker.IsLocal(containerName) {
+				ctx, cancel := context.WithTimeout(context.Background(), docker.CallTimeout)
+				inspect, err = docker.InspectOwned(ctx, cli, containerName)
+				cancel()
+			}
 			if err == nil {
 				for _, m := range inspect.Mounts {
 					name := strings.Trim(m.Destination, "/")
 					items = append(items, vfs.NewFileInfo(name, true))
 				}
 			} else {
-				logger.Logf("Internal", "SFTP", "コンテナ %s のマウント一覧取得失敗: %v", containerName, err)
+				logger.Errorf("Internal", "SFTP", "コンテナ %s のマウント一覧取得失敗: %v", containerName, err)
+			}
+			if h.handler.ContainerEnabled(containerName) {
+				items = append(items, vfs.NewFileInfo(vfs.ContainerDir, true))
+			}
+			if h.handler.BackupsEnabled(containerName) {
+				items = append(items, vfs.NewFileInfo(vfs.BackupsDir, true))
 			}
+			items = append(items, h.handler.StatusFiles(containerName)...)
 			return &listerAt{items: items}, nil
 		}
 		return nil, err
@@ -237,32 +380,54 @@ func (h *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
 // MARK: Fileread()
 // 物理ファイルの中身を取り出す。
 func (h *sftpHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
-	fullPath, err := h.handler.MapPath(r.Filepath)
+	if serverName, inner, ok, err := h.handler.ContainerPath(r.Filepath); ok {
+		if err != nil {
+			return nil, err
+		}
+		logger.Debugf("Client", "SFTP", "コンテナ内ファイル読込: user=%s, path=%s", h.handler.Username, r.Filepath)
+		return vfs.ContainerOpen(serverName, inner)
+	}
+
+	if serverName, file, ok, err := h.handler.StatusPath(r.Filepath); ok {
+		if err != nil {
+			return nil, err
+		}
+		return h.handler.OpenStatus(serverName, file)
+	}
+
+	fullPath, ok, err := h.handler.BackupPath(r.Filepath)
+	if !ok {
+		fullPath, err = h.handler.MapPath(r.Filepath)
+	}
 	if err != nil {
+		if err == vfs.ErrVfsBackupDir {
+			return nil, os.ErrInvalid
+		}
 		return nil, err
 	}
 	// トレーサビリティのため、ダウンロード操作を記録。
-	logger.Logf("Client", "SFTP", "ファイル読込: user=%s, path=%s", h.handler.Username, r.Filepath)
+	logger.Debugf("Client", "SFTP", "ファイル読込: user=%s, path=%s", h.handler.Username, r.Filepath)
 	return os.Open(fullPath)
 }
 
 // MARK: Filewrite()
 // 物理ファイルへデータを上書き・追記する。
 func (h *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
-	// 書き込み操作には write 権限が必要
-	containerName := strings.Split(strings.Trim(r.Filepath, "/"), "/")[0]
-	cfg := h.handler.Config.Get()
-	user := cfg.Users[h.handler.Username]
-	if !user.HasPermission(containerName, config.PermFileWrite) {
-		return nil, os.ErrPermission
-	}
-
-	fullPath, err := h.handler.MapPath(r.Filepath)
+	// 書き込み操作には対象のパスへの write 権限が必要
+	fullPath, err := h.handler.MapWritePath(r.Filepath)
 	if err != nil {
 		return nil, err
 	}
 	// データの変更を伴う操作のため、確実にログへ残す。
 	logger.Logf("Client", "SFTP", "ファイル書込: user=%s, path=%s", h.handler.Username, r.Filepath)
+	// ステージングが有効な場合は一時ファイルへ書き込み、転送の完了時に検証してから置き換える。
+	staged, err := h.handler.OpenStaged(r.Filepath, fullPath, os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	if staged != nil {
+		return staged, nil
+	}
 	// 常に新規作成、または既存の内容を破棄して書き込むモードで開く。
 	return os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 }
@@ -270,15 +435,8 @@ func (h *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
 // MARK: Filecmd()
 // ファイルの削除、フォルダ作成、名前変更等の「構成変更」コマンドを処理する。
 func (h *sftpHandler) Filecmd(r *sftp.Request) error {
-	// 変更操作には write 権限が必要
-	containerName := strings.Split(strings.Trim(r.Filepath, "/"), "/")[0]
-	cfg := h.handler.Config.Get()
-	user := cfg.Users[h.handler.Username]
-	if !user.HasPermission(containerName, config.PermFileWrite) {
-		return os.ErrPermission
-	}
-
-	fullPath, err := h.handler.MapPath(r.Filepath)
+	// 変更操作には対象のパスへの write 権限が必要
+	fullPath, err := h.handler.MapWritePath(r.Filepath)
 	if err != nil {
 		return err
 	}
@@ -291,8 +449,8 @@ func (h *sftpHandler) Filecmd(r *sftp.Request) error {
 		// パーミッション等の微調整は、環境の整合性担保のため一律無視（または成功扱い）とする。
 		return nil
 	case "Rename":
-		// 移動先パス解決
-		targetPath, err := h.handler.MapPath(r.Target)
+		// 移動先パス解決 (移動先にも write 権限が必要)
+		targetPath, err := h.handler.MapWritePath(r.Target)
 		if err != nil {
 			return err
 		}
@@ -310,6 +468,71 @@ func (h *sftpHandler) Filecmd(r *sftp.Request) error {
 	return nil
 }
 
+// containerList はコンテナ内のパスに対する一覧 (List) と情報の取得 (Stat) を処理する。
+func containerList(method, serverName, inner string) (sftp.ListerAt, error) {
+	switch method {
+	case "List":
+		items, err := vfs.ContainerReadDir(serverName, inner)
+		if err != nil {
+			return nil, err
+		}
+		return &listerAt{items: items}, nil
+	case "Stat":
+		info, err := vfs.ContainerStat(serverName, inner)
+		if err != nil {
+			return nil, err
+		}
+		return &listerAt{items: []os.FileInfo{info}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// backupList はバックアップの世代内のパスに対する一覧 (List) と情報の取得 (Stat) を処理する。
+// fullPath と err は BackupPath の結果で、世代の一覧等の仮想的な階層は ErrVfsBackupDir となる。
+func (h *sftpHandler) backupList(method, p, fullPath string, err error) (sftp.ListerAt, error) {
+	if err == vfs.ErrVfsBackupDir {
+		switch method {
+		case "List":
+			items, err := h.handler.BackupReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			return &listerAt{items: items}, nil
+		case "Stat":
+			if _, err := h.handler.BackupReadDir(p); err != nil {
+				return nil, err
+			}
+			return &listerAt{items: []os.FileInfo{vfs.NewFileInfo(path.Base(p), true)}}, nil
+		}
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case "List":
+		files, err := os.ReadDir(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		var items []os.FileInfo
+		for _, f := range files {
+			if info, err := f.Info(); err == nil {
+				items = append(items, info)
+			}
+		}
+		return &listerAt{items: items}, nil
+	case "Stat":
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		return &listerAt{items: []os.FileInfo{info}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
 // MARK: listerAt
 // 指定された範囲（オフセット）のファイル一覧データを切り出すためのヘルパー。
 type listerAt struct {
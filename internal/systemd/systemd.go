@@ -0,0 +1,94 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/play-bin/internal/logger"
+)
+
+// MARK: Notify()
+// sd_notify プロトコルで systemd へ状態 (例: "READY=1") を通知する。
+// systemd の管理下 (Type=notify) でない場合 (NOTIFY_SOCKET が未設定) は何もせず false を返す。
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// "@" で始まるパスは Linux の抽象名前空間のソケットを表す。
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MARK: Ready()
+// 起動が完了し、接続の受け付けを開始したことを通知する。After= で順序付けられた後続のユニットはこの時点から起動する。
+func Ready() {
+	if ok, err := Notify("READY=1"); err != nil {
+		logger.Errorf("Internal", "Systemd", "起動完了の通知に失敗: %v", err)
+	} else if ok {
+		logger.Log("Internal", "Systemd", "起動完了を通知しました")
+	}
+}
+
+// MARK: Stopping()
+// 終了処理を開始したことを通知する。
+func Stopping() {
+	if _, err := Notify("STOPPING=1"); err != nil {
+		logger.Errorf("Internal", "Systemd", "終了開始の通知に失敗: %v", err)
+	}
+}
+
+// MARK: Watchdog()
+// ユニットに WatchdogSec= が設定されている場合、その半分の間隔で check を実行し、成功した場合のみ "WATCHDOG=1" を通知する。
+// check が失敗し続ける (またはプロセスが応答しなくなる) と通知が途絶え、systemd がインスタンスを再起動する。
+func Watchdog(check func(ctx context.Context) error) {
+	interval, ok := watchdogInterval()
+	if !ok {
+		return
+	}
+	logger.Logf("Internal", "Systemd", "ウォッチドッグを開始しました: interval=%s", interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			// 確認自体が応答しない場合も通知を止めるため、間隔内に完了しない確認は失敗とみなす。
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := check(ctx)
+			cancel()
+			if err != nil {
+				logger.Warnf("Internal", "Systemd", "ヘルスチェックに失敗したため、ウォッチドッグの通知を見送ります: %v", err)
+				continue
+			}
+			if _, err := Notify("WATCHDOG=1"); err != nil {
+				logger.Errorf("Internal", "Systemd", "ウォッチドッグの通知に失敗: %v", err)
+			}
+		}
+	}()
+}
+
+// watchdogInterval は WATCHDOG_USEC から通知の間隔 (タイムアウトの半分) を求める。WATCHDOG_PID が別のプロセスを指す場合は無効とする。
+func watchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != fmt.Sprint(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
@@ -0,0 +1,176 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+)
+
+// BackupsDir はバックアップの世代を読み取り専用で公開する仮想ディレクトリの名前 (/<server>/_backups)。
+const BackupsDir = "_backups"
+
+// ErrVfsBackupDir は /<server>/_backups 以下の、ホスト上のパスに対応しない階層 (世代の一覧等) を表す内部エラー。
+// 呼び出し元は BackupReadDir で一覧を取得する。
+var ErrVfsBackupDir = errors.New("vfs_backup_dir")
+
+// backupDest は backup 定義 1 件分の世代の保存先。name は定義が複数ある場合に世代の直下で区別するための名前。
+type backupDest struct {
+	name     string
+	destBase string
+}
+
+// backupDests はサーバーの backup 定義 (src:destBase) の保存先を返す。
+// 名前は src のディレクトリ名とし、重複する場合は定義の順番を付けて区別する。
+func backupDests(server config.ServerConfig) []backupDest {
+	var dests []backupDest
+	seen := make(map[string]bool)
+	for i, cmd := range server.Commands.Backup {
+		if cmd.Type != "backup" {
+			continue
+		}
+		parts := strings.SplitN(cmd.Arg, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := filepath.Base(parts[0])
+		if seen[name] || name == "." || name == "/" {
+			name += "-" + strconv.Itoa(i+1)
+		}
+		seen[name] = true
+		dests = append(dests, backupDest{name: name, destBase: parts[1]})
+	}
+	return dests
+}
+
+// MARK: BackupsEnabled()
+// サーバーにバックアップの定義があり、ユーザーがサーバーのファイルの閲覧権限を持つ場合に /<server>/_backups を提示するかを返す。
+func (h *Handler) BackupsEnabled(serverName string) bool {
+	cfg := h.Config.Get()
+	server, ok := cfg.Servers[serverName]
+	if !ok || len(backupDests(server)) == 0 {
+		return false
+	}
+	return cfg.Users[h.Username].HasPermission(serverName, config.PermFileRead)
+}
+
+// MARK: BackupPath()
+// /<server>/_backups 以下の仮想パスを、世代内のファイルのホスト上のパスへ解決する。
+// 対象外のパスの場合は ok に false を返し、呼び出し元は MapPath で解決する。
+// 世代の一覧等のホスト上のパスに対応しない階層は ErrVfsBackupDir を返す。
+func (h *Handler) BackupPath(p string) (fullPath string, ok bool, err error) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/")
+	if len(parts) < 2 || parts[1] != BackupsDir {
+		return "", false, nil
+	}
+	serverName := parts[0]
+	server, exists := h.Config.Get().Servers[serverName]
+	dests := backupDests(server)
+	if !exists || len(dests) == 0 {
+		return "", false, nil
+	}
+	if !h.BackupsEnabled(serverName) {
+		logger.Warnf("Client", "VFS", "バックアップへのアクセス拒否: user=%s, path=%s", h.Username, p)
+		return "", true, os.ErrPermission
+	}
+	if len(parts) == 2 {
+		return "", true, ErrVfsBackupDir
+	}
+
+	generation, rest := parts[2], parts[3:]
+	if !validGeneration(generation) {
+		return "", true, os.ErrNotExist
+	}
+	// 定義が 1 件の場合は世代の直下に内容を、複数の場合は定義ごとのディレクトリを並べる。
+	dest := dests[0]
+	if len(dests) > 1 {
+		if len(rest) == 0 {
+			return "", true, ErrVfsBackupDir
+		}
+		i := slices.IndexFunc(dests, func(d backupDest) bool { return d.name == rest[0] })
+		if i < 0 {
+			return "", true, os.ErrNotExist
+		}
+		dest, rest = dests[i], rest[1:]
+	}
+
+	// ZFS の世代はスナップショットへのシンボリックリンクのため、世代のディレクトリを解決してから、その外を指すパスを拒否する。
+	root, err := filepath.EvalSymlinks(filepath.Join(dest.destBase, generation))
+	if err != nil {
+		return "", true, os.ErrNotExist
+	}
+	fullPath, err = filepath.EvalSymlinks(filepath.Join(append([]string{root}, rest...)...))
+	if err != nil {
+		return "", true, os.ErrNotExist
+	}
+	if fullPath != root && !strings.HasPrefix(fullPath, root+string(filepath.Separator)) {
+		logger.Warnf("Client", "VFS", "世代の外を指すパスへのアクセス拒否: user=%s, path=%s", h.Username, p)
+		return "", true, os.ErrPermission
+	}
+	return fullPath, true, nil
+}
+
+// MARK: BackupReadDir()
+// BackupPath が ErrVfsBackupDir を返した階層の一覧を返す。
+// /<server>/_backups は世代を新しい順で、定義が複数ある場合の /<server>/_backups/<世代> は定義ごとのディレクトリを返す。
+func (h *Handler) BackupReadDir(p string) ([]os.FileInfo, error) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/")
+	if len(parts) < 2 || !h.BackupsEnabled(parts[0]) {
+		return nil, os.ErrPermission
+	}
+	dests := backupDests(h.Config.Get().Servers[parts[0]])
+
+	var items []os.FileInfo
+	if len(parts) == 2 {
+		for _, generation := range listGenerations(dests) {
+			items = append(items, NewFileInfo(generation, true))
+		}
+		return items, nil
+	}
+	for _, dest := range dests {
+		if info, err := os.Stat(filepath.Join(dest.destBase, parts[2])); err == nil && info.IsDir() {
+			items = append(items, NewFileInfo(dest.name, true))
+		}
+	}
+	if len(items) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return items, nil
+}
+
+// listGenerations は全ての保存先を横断して、世代のディレクトリ (または指す先がディレクトリのシンボリックリンク) を新しい順で返す。
+func listGenerations(dests []backupDest) []string {
+	seen := make(map[string]bool)
+	var generations []string
+	for _, dest := range dests {
+		entries, err := os.ReadDir(dest.destBase)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !validGeneration(name) || seen[name] {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(dest.destBase, name)); err != nil || !info.IsDir() {
+				continue
+			}
+			seen[name] = true
+			generations = append(generations, name)
+		}
+	}
+	slices.Sort(generations)
+	slices.Reverse(generations)
+	return generations
+}
+
+// validGeneration は世代の名前として公開できるかを返す。latest は直近の世代を指すシンボリックリンクのため除外する。
+func validGeneration(name string) bool {
+	return name != "" && name != "latest" && !strings.HasPrefix(name, ".")
+}
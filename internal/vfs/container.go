@@ -0,0 +1,255 @@
+package vfs
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// ContainerDir はコンテナ内のファイルシステム全体を読み取り専用で公開する仮想ディレクトリの名前 (/<server>/_container)。
+const ContainerDir = "_container"
+
+// containerFSTimeout はコンテナ内の一覧・読み出しの期限。停止中のコンテナではアーカイブ全体を読み出すため長めに取る。
+const containerFSTimeout = 2 * time.Minute
+
+// MARK: ContainerEnabled()
+// 設定で有効化され、ユーザーがサーバーのファイルの閲覧権限を持つ場合に /<server>/_container を提示するかを返す。
+func (h *Handler) ContainerEnabled(serverName string) bool {
+	cfg := h.Config.Get()
+	server, ok := cfg.Servers[serverName]
+	if !cfg.ContainerFS || !ok || server.ProcessSettings() != nil {
+		return false
+	}
+	return cfg.Users[h.Username].HasPermission(serverName, config.PermFileRead)
+}
+
+// MARK: ContainerPath()
+// /<server>/_container 以下の仮想パスを、サーバー名とコンテナ内の絶対パスへ解決する。
+// 対象外のパスの場合は ok に false を返し、呼び出し元は MapPath で解決する。
+func (h *Handler) ContainerPath(p string) (serverName, inner string, ok bool, err error) {
+	parts := strings.SplitN(strings.Trim(path.Clean("/"+p), "/"), "/", 3)
+	if len(parts) < 2 || parts[1] != ContainerDir || !h.Config.Get().ContainerFS {
+		return "", "", false, nil
+	}
+	serverName = parts[0]
+	if !h.ContainerEnabled(serverName) {
+		logger.Warnf("Client", "VFS", "コンテナ内のファイルへのアクセス拒否: user=%s, path=%s", h.Username, p)
+		return "", "", true, os.ErrPermission
+	}
+	inner = "/"
+	if len(parts) == 3 {
+		inner += parts[2]
+	}
+	return serverName, inner, true, nil
+}
+
+// MARK: ContainerStat()
+// コンテナ内のパスの情報を返す。シンボリックリンクはリンク自体の情報となる。
+func ContainerStat(serverName, inner string) (os.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), docker.CallTimeout)
+	defer cancel()
+	stat, err := docker.StatPath(ctx, serverName, inner)
+	if err != nil {
+		return nil, containerError(err)
+	}
+	name := stat.Name
+	if inner == "/" {
+		name = ContainerDir
+	}
+	return &containerFileInfo{name: name, size: stat.Size, mode: stat.Mode, modTime: stat.Mtime}, nil
+}
+
+// MARK: ContainerReadDir()
+// コンテナ内のディレクトリの一覧を返す。稼働中はコンテナ内で find / stat を実行し、
+// 停止中やコマンドが無いイメージではアーカイブ API から読み出したヘッダーで代替する。
+func ContainerReadDir(serverName, dir string) ([]os.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerFSTimeout)
+	defer cancel()
+	items, err := readDirExec(ctx, serverName, dir)
+	if err == nil {
+		return items, nil
+	}
+	logger.Debugf("Internal", "VFS", "コンテナ内の一覧をアーカイブから取得します: container=%s, dir=%s, err=%v", serverName, dir, err)
+	items, err = readDirArchive(ctx, serverName, dir)
+	return items, containerError(err)
+}
+
+// MARK: ContainerOpen()
+// コンテナ内のファイルを一時ファイルへ読み出して返す。一時ファイルは作成直後に削除するため、閉じると領域が解放される。
+// SFTP / WebDAV は任意の位置からの読み出しを要求するため、アーカイブの逐次読み出しのままでは扱えない。
+func ContainerOpen(serverName, inner string) (*os.File, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerFSTimeout)
+	defer cancel()
+	rc, _, err := docker.CopyFileFrom(ctx, serverName, inner)
+	if err != nil {
+		if errors.Is(err, docker.ErrNotRegularFile) {
+			return nil, os.ErrInvalid
+		}
+		return nil, containerError(err)
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "play-bin-vfs-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, rc); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// readDirExec は find と stat で直下の項目を列挙する。busybox を含む一般的な実装で共通の書式のみを用いる。
+// 名前に改行を含む項目があっても区切れるよう、stat の出力に続けて -print0 で NUL 終端のパスを出力させる。
+func readDirExec(ctx context.Context, serverName, dir string) ([]os.FileInfo, error) {
+	result, err := docker.Exec(ctx, serverName, docker.ExecRequest{
+		Cmd: []string{"find", dir, "-mindepth", "1", "-maxdepth", "1", "-exec", "stat", "-c", "%f %s %Y", "{}", ";", "-print0"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 一部の項目が読めない場合も find は非ゼロで終了するため、出力が得られていれば一覧として扱う。
+	if result.TimedOut || result.Truncated || (result.ExitCode != 0 && result.Stdout == "") {
+		return nil, exitErrorOf(result)
+	}
+	return parseStatOutput(result.Stdout), nil
+}
+
+// parseStatOutput は "<mode> <size> <mtime>\n<path>\x00" の並びを解釈する。形式に合わない項目は読み飛ばす。
+func parseStatOutput(out string) []os.FileInfo {
+	var items []os.FileInfo
+	for _, record := range strings.Split(out, "\x00") {
+		// stat の出力は改行を含まないため、最初の改行より後はすべてパスとして扱う。
+		head, name, ok := strings.Cut(record, "\n")
+		if !ok || name == "" {
+			continue
+		}
+		fields := strings.Fields(head)
+		if len(fields) != 3 {
+			continue
+		}
+		raw, err1 := strconv.ParseUint(fields[0], 16, 32)
+		size, err2 := strconv.ParseInt(fields[1], 10, 64)
+		mtime, err3 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		items = append(items, &containerFileInfo{
+			name:    path.Base(name),
+			size:    size,
+			mode:    unixMode(uint32(raw)),
+			modTime: time.Unix(mtime, 0),
+		})
+	}
+	return items
+}
+
+// readDirArchive はアーカイブ API のヘッダーから直下の項目を列挙する。配下全体を読み出すため、大きなディレクトリでは時間を要する。
+func readDirArchive(ctx context.Context, serverName, dir string) ([]os.FileInfo, error) {
+	rc, _, err := docker.CopyArchiveFrom(ctx, serverName, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// アーカイブ内のパスは指定したディレクトリの名前を最上位とする。
+	base := path.Base(dir)
+	if dir == "/" {
+		base = ""
+	}
+	var items []os.FileInfo
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rel := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if base != "" {
+			var ok bool
+			if rel, ok = strings.CutPrefix(rel, base+"/"); !ok {
+				continue
+			}
+		}
+		if rel == "" || strings.Contains(rel, "/") {
+			continue
+		}
+		items = append(items, &containerFileInfo{name: rel, size: hdr.Size, mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime})
+	}
+}
+
+// unixMode は stat の %f (st_mode の 16 進数) を os.FileMode へ変換する。
+func unixMode(raw uint32) os.FileMode {
+	mode := os.FileMode(raw & 0o777)
+	switch raw & 0o170000 {
+	case 0o040000:
+		mode |= os.ModeDir
+	case 0o120000:
+		mode |= os.ModeSymlink
+	case 0o010000:
+		mode |= os.ModeNamedPipe
+	case 0o140000:
+		mode |= os.ModeSocket
+	case 0o020000:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 0o060000:
+		mode |= os.ModeDevice
+	}
+	return mode
+}
+
+// exitErrorOf は一覧のコマンドが失敗した理由を返す。
+func exitErrorOf(result docker.ExecResult) error {
+	if result.TimedOut {
+		return context.DeadlineExceeded
+	}
+	if result.Truncated {
+		return errors.New("listing output is truncated")
+	}
+	return fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+}
+
+// containerError は Docker のエラーのうち、存在しないパスを os.ErrNotExist へ変換する。
+func containerError(err error) error {
+	if err != nil && errdefs.IsNotFound(err) {
+		return os.ErrNotExist
+	}
+	return err
+}
+
+// MARK: containerFileInfo
+// コンテナ内のパスの情報を表す FileInfo 実装。
+type containerFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (f *containerFileInfo) Name() string       { return f.name }
+func (f *containerFileInfo) Size() int64        { return f.size }
+func (f *containerFileInfo) Mode() os.FileMode  { return f.mode }
+func (f *containerFileInfo) ModTime() time.Time { return f.modTime }
+func (f *containerFileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f *containerFileInfo) Sys() any           { return nil }
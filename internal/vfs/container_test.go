@@ -0,0 +1,25 @@
+package vfs
+
+import "testing"
+
+func TestParseStatOutputNewlineInName(t *testing.T) {
+	out := "81a4 12 1700000000\n/data/a\nb.txt\x00" +
+		"41ed 4096 1700000001\n/data/world\x00" +
+		"81a4 1 1700000002\n/data/stat 1 2\x00"
+	items := parseStatOutput(out)
+	if len(items) != 3 {
+		t.Fatalf("got %d items, want 3", len(items))
+	}
+	if got := items[0].Name(); got != "a\nb.txt" {
+		t.Errorf("items[0].Name() = %q, want %q", got, "a\nb.txt")
+	}
+	if items[0].Size() != 12 || items[0].IsDir() {
+		t.Errorf("items[0] = size %d dir %v, want a 12 byte file", items[0].Size(), items[0].IsDir())
+	}
+	if got := items[1].Name(); got != "world" || !items[1].IsDir() {
+		t.Errorf("items[1] = %q dir %v, want directory world", got, items[1].IsDir())
+	}
+	if got := items[2].Name(); got != "stat 1 2" {
+		t.Errorf("items[2].Name() = %q, want %q", got, "stat 1 2")
+	}
+}
@@ -0,0 +1,194 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// StagingPrefix はステージング中の一時ファイルの名前の接頭辞。置き換え先と同じディレクトリに作成し、rename でアトミックに置き換える。
+const StagingPrefix = ".playbin-upload-"
+
+// validateCommandTimeout は upload.validate の command の実行の期限。
+const validateCommandTimeout = 30 * time.Second
+
+// MARK: StagedFile
+// ステージング中のアップロード。書き込みは一時ファイルへ行い、Close で検証してから置き換え先へ rename する。
+type StagedFile struct {
+	*os.File
+	handler *Handler
+	target  string
+	virtual string
+	closed  bool
+}
+
+// MARK: OpenStaged()
+// サーバーの upload でステージングの対象となるファイル全体の書き込み (O_TRUNC) の場合に、一時ファイルを開いて返す。
+// 対象外の場合は nil を返し、呼び出し元は fullPath を直接開く。p は仮想パス、fullPath は MapPath で解決したホスト上のパス。
+func (h *Handler) OpenStaged(p, fullPath string, flag int) (*StagedFile, error) {
+	if flag&os.O_TRUNC == 0 {
+		return nil, nil
+	}
+	upload, rel := h.uploadConfig(p)
+	if upload == nil || (!upload.Staging && !slices.ContainsFunc(upload.Validate, func(v config.UploadValidateConfig) bool { return v.Match(rel) })) {
+		return nil, nil
+	}
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		return nil, os.ErrInvalid
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), StagingPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return &StagedFile{File: tmp, handler: h, target: fullPath, virtual: p}, nil
+}
+
+// MARK: Close()
+// 一時ファイルを閉じ、CommitUpload で置き換える。
+func (f *StagedFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	tmp := f.File.Name()
+	if err := f.File.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return f.handler.CommitUpload(f.virtual, tmp, f.target)
+}
+
+// MARK: PartPath()
+// 再開可能なアップロードの受信中のファイルのパス。置き換えをアトミックに行えるよう、置き換え先と同じディレクトリに置く。
+func PartPath(fullPath, id string) string {
+	return filepath.Join(filepath.Dir(fullPath), StagingPrefix+id+".part")
+}
+
+// MARK: CommitUpload()
+// 書き込みを終えた一時ファイル tmp を ValidateUpload で検証し、成功した場合のみ PrepareReplace を経て置き換え先 fullPath へ rename する。
+// 失敗した場合は一時ファイルを削除し、元のファイルはそのまま残す。p は仮想パス。
+func (h *Handler) CommitUpload(p, tmp, fullPath string) error {
+	fail := func(err error) error {
+		os.Remove(tmp)
+		return err
+	}
+	if err := h.ValidateUpload(p, tmp); err != nil {
+		return fail(err)
+	}
+	target, err := h.PrepareReplace(p, tmp, fullPath)
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// MARK: ValidateUpload()
+// 一時ファイル tmp を、仮想パス p に一致する upload.validate の全ての検証にかける。
+func (h *Handler) ValidateUpload(p, tmp string) error {
+	upload, rel := h.uploadConfig(p)
+	if upload == nil {
+		return nil
+	}
+	for _, v := range upload.Validate {
+		if !v.Match(rel) {
+			continue
+		}
+		if err := validateUpload(tmp, v); err != nil {
+			logger.Warnf("Client", "VFS", "アップロードの検証に失敗したため置き換えを中止しました: user=%s, path=%s, err=%v", h.Username, p, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// MARK: PrepareReplace()
+// 一時ファイル tmp に置き換え先 fullPath の既存のファイルの権限と所有者を引き継ぎ (新規作成の場合は 0644)、rename する先のパスを返す。
+// 直接書き込む場合と同じく、シンボリックリンクは指す先を置き換える。
+func (h *Handler) PrepareReplace(p, tmp, fullPath string) (string, error) {
+	if resolved, err := filepath.EvalSymlinks(fullPath); err == nil {
+		fullPath = resolved
+	}
+	mode := os.FileMode(0644)
+	var owner *syscall.Stat_t
+	if info, err := os.Stat(fullPath); err == nil {
+		if info.IsDir() {
+			return "", os.ErrInvalid
+		}
+		mode = info.Mode().Perm()
+		owner, _ = info.Sys().(*syscall.Stat_t)
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return "", err
+	}
+	// 所有者の変更は root 以外では失敗し得るため、その場合は直接書き込む場合と同じく play-bin の所有のままとする。
+	if owner != nil {
+		if err := os.Chown(tmp, int(owner.Uid), int(owner.Gid)); err != nil {
+			logger.Debugf("Internal", "VFS", "一時ファイルの所有者を変更できません: path=%s, err=%v", p, err)
+		}
+	}
+	return fullPath, nil
+}
+
+// uploadConfig は仮想パスのサーバーの upload の設定と、サーバー内のパス (先頭の "/" を除く) を返す。
+func (h *Handler) uploadConfig(p string) (*config.UploadConfig, string) {
+	parts := strings.SplitN(strings.Trim(path.Clean("/"+p), "/"), "/", 2)
+	if len(parts) < 2 {
+		return nil, ""
+	}
+	return h.Config.Get().Servers[parts[0]].Upload, parts[1]
+}
+
+// validateUpload は一時ファイルを形式の構文とコマンドで検証する。
+func validateUpload(file string, v config.UploadValidateConfig) error {
+	if v.Format != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var doc any
+		switch v.Format {
+		case config.UploadFormatJSON:
+			err = json.Unmarshal(b, &doc)
+		case config.UploadFormatYAML:
+			err = yaml.Unmarshal(b, &doc)
+		case config.UploadFormatTOML:
+			var table map[string]any
+			_, err = toml.Decode(string(b), &table)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", v.Format, err)
+		}
+	}
+	if v.Command != "" {
+		args, err := config.SplitCommandLine(v.Command)
+		if err != nil || len(args) == 0 {
+			return fmt.Errorf("invalid validate command %q", v.Command)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), validateCommandTimeout)
+		defer cancel()
+		var out bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], append(args[1:], file)...)
+		cmd.Stdout, cmd.Stderr = &out, &out
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("validate command %s: %w: %s", args[0], err, strings.TrimSpace(out.String()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	ctypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+	"github.com/play-bin/internal/process"
+)
+
+// サーバーの直下に置く、状態とログを読み出す仮想ファイルの名前 (/<server>/status.json, /<server>/latest.log)。
+const (
+	StatusFile = "status.json"
+	LogFile    = "latest.log"
+)
+
+// statusLogLines は latest.log に含めるログの行数 (末尾から)。
+const statusLogLines = 200
+
+// MARK: ServerStatus
+// status.json の内容。REST API を使わずに、WebDAV をマウントしたスクリプト等から状態を確認するための最小限の情報。
+type ServerStatus struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"` // running / exited 等の Docker の状態。process のサーバーはプロセスの状態
+	Running    bool      `json:"running"`
+	Health     string    `json:"health,omitempty"` // HEALTHCHECK を定義したイメージのみ
+	ExitCode   int       `json:"exitCode"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	Image      string    `json:"image,omitempty"`
+	Host       string    `json:"host,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"` // このファイルを生成した時刻
+}
+
+// MARK: StatusPath()
+// /<server>/status.json と /<server>/latest.log を、サーバー名とファイル名へ解決する。
+// 対象外のパスの場合は ok に false を返し、呼び出し元は MapPath で解決する。
+func (h *Handler) StatusPath(p string) (serverName, file string, ok bool, err error) {
+	parts := strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/")
+	if len(parts) != 2 || (parts[1] != StatusFile && parts[1] != LogFile) {
+		return "", "", false, nil
+	}
+	serverName, file = parts[0], parts[1]
+	cfg := h.Config.Get()
+	if _, exists := cfg.Servers[serverName]; !exists {
+		return "", "", false, nil
+	}
+	if !cfg.Users[h.Username].HasPermission(serverName, config.PermContainerRead) {
+		logger.Warnf("Client", "VFS", "アクセス拒否: user=%s, path=%s", h.Username, p)
+		return "", "", true, os.ErrPermission
+	}
+	return serverName, file, true, nil
+}
+
+// MARK: StatusFiles()
+// サーバーの直下の一覧に加える仮想ファイルの情報を返す。サイズを正しく示すため、一覧の都度内容を生成する。
+func (h *Handler) StatusFiles(serverName string) []os.FileInfo {
+	var items []os.FileInfo
+	for _, file := range []string{StatusFile, LogFile} {
+		f, err := h.OpenStatus(serverName, file)
+		if err != nil {
+			continue
+		}
+		items = append(items, f.info)
+	}
+	return items
+}
+
+// MARK: OpenStatus()
+// 仮想ファイルの内容を、コンテナ (またはプロセス) の現在の状態と直近のログから生成して返す。
+func (h *Handler) OpenStatus(serverName, file string) (*VirtualFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), docker.CallTimeout)
+	defer cancel()
+	serverCfg := h.Config.Get().Servers[serverName]
+
+	var content []byte
+	var err error
+	switch file {
+	case StatusFile:
+		content, err = json.MarshalIndent(serverStatus(ctx, serverName, serverCfg), "", "  ")
+		content = append(content, '\n')
+	case LogFile:
+		content, err = recentLogs(ctx, serverName, serverCfg)
+	default:
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		logger.Errorf("Internal", "VFS", "%s の生成に失敗(%s): %v", file, serverName, err)
+		return nil, err
+	}
+	return NewVirtualFile(file, content), nil
+}
+
+// serverStatus はコンテナ (またはプロセス) の状態を取得する。取得できない場合は状態を missing / unreachable とする。
+func serverStatus(ctx context.Context, serverName string, serverCfg config.ServerConfig) ServerStatus {
+	status := ServerStatus{Name: serverName, Host: serverCfg.Host, UpdatedAt: time.Now()}
+	if pc := serverCfg.ProcessSettings(); pc != nil {
+		st, err := process.Inspect(ctx, serverName, *pc)
+		if err != nil {
+			status.State = "unreachable"
+			return status
+		}
+		status.State, status.Running, status.ExitCode, status.StartedAt = st.State, st.Running(), st.ExitCode, st.StartedAt
+		return status
+	}
+
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		status.State = "unreachable"
+		return status
+	}
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	if err != nil {
+		status.State = "missing"
+		return status
+	}
+	if inspect.Config != nil {
+		status.Image = inspect.Config.Image
+	}
+	if st := inspect.State; st != nil {
+		status.State, status.Running, status.ExitCode = string(st.Status), st.Running, st.ExitCode
+		status.StartedAt, _ = time.Parse(time.RFC3339Nano, st.StartedAt)
+		if !st.Running {
+			status.FinishedAt, _ = time.Parse(time.RFC3339Nano, st.FinishedAt)
+		}
+		if st.Health != nil {
+			status.Health = string(st.Health.Status)
+		}
+	}
+	return status
+}
+
+// recentLogs は直近 statusLogLines 行のログを時刻付きで返す。TTY の無いコンテナは標準出力と標準エラーをまとめる。
+func recentLogs(ctx context.Context, serverName string, serverCfg config.ServerConfig) ([]byte, error) {
+	if pc := serverCfg.ProcessSettings(); pc != nil {
+		logs, err := process.Logs(ctx, serverName, *pc, process.LogOptions{Tail: statusLogLines, Timestamps: true})
+		if err != nil {
+			return nil, err
+		}
+		defer logs.Close()
+		return io.ReadAll(logs)
+	}
+
+	cli, err := docker.ForServer(serverName)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := docker.InspectOwned(ctx, cli, serverName)
+	if err != nil {
+		// 未作成のコンテナはログが無いため、空のファイルとする。
+		return nil, nil
+	}
+	logs, err := cli.ContainerLogs(ctx, inspect.ID, ctypes.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(statusLogLines),
+		Timestamps: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+	if inspect.Config != nil && inspect.Config.Tty {
+		return io.ReadAll(logs)
+	}
+	var buf bytes.Buffer
+	_, err = stdcopy.StdCopy(&buf, &buf, logs)
+	return buf.Bytes(), err
+}
+
+// MARK: VirtualFile
+// メモリ上の内容を読み取り専用のファイルとして提供する。SFTP の io.ReaderAt と WebDAV の webdav.File を満たす。
+type VirtualFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+// MARK: NewVirtualFile()
+func NewVirtualFile(name string, content []byte) *VirtualFile {
+	return &VirtualFile{
+		Reader: bytes.NewReader(content),
+		info:   &containerFileInfo{name: name, size: int64(len(content)), mode: 0444, modTime: time.Now()},
+	}
+}
+
+func (f *VirtualFile) Close() error                       { return nil }
+func (f *VirtualFile) Stat() (os.FileInfo, error)         { return f.info, nil }
+func (f *VirtualFile) Readdir(int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *VirtualFile) Write(p []byte) (int, error)        { return 0, os.ErrPermission }
@@ -46,7 +46,7 @@ func (h *Handler) MapPath(path string) (string, error) {
 
 	// 指定されたコンテナに対し、このユーザーが操作を許可されているか（read権限）を確認。
 	if !user.HasPermission(containerName, config.PermContainerRead) {
-		logger.Logf("Client", "VFS", "アクセス拒否: user=%s, path=%s", h.Username, path)
+		logger.Warnf("Client", "VFS", "アクセス拒否: user=%s, path=%s", h.Username, path)
 		return "", os.ErrPermission
 	}
 
@@ -61,10 +61,31 @@ func (h *Handler) MapPath(path string) (string, error) {
 
 	targetSubPath := parts[1]
 
-	// コンテナの実体からマウント情報を動的に取得する。
-	inspect, err := docker.Client.ContainerInspect(context.Background(), containerName)
+	// コンテナ内のファイルシステムは ContainerPath で扱う読み取り専用の階層のため、ホスト上のパスには解決しない。
+	if targetSubPath == ContainerDir && cfg.ContainerFS {
+		return "", os.ErrPermission
+	}
+	// 状態とログの仮想ファイルは StatusPath で扱う読み取り専用のファイルのため、書き込み等の操作の対象にしない。
+	if len(parts) == 2 && (targetSubPath == StatusFile || targetSubPath == LogFile) {
+		return "", os.ErrPermission
+	}
+	// バックアップの世代も BackupPath で扱う読み取り専用の階層のため、書き込み等の操作の対象にしない。
+	if targetSubPath == BackupsDir && len(backupDests(cfg.Servers[containerName])) > 0 {
+		return "", os.ErrPermission
+	}
+
+	// リモートホスト上のコンテナのマウント元はこのマシンに存在しないため、ファイル操作の対象外とする。
+	if !docker.IsLocal(containerName) {
+		logger.Logf("Client", "VFS", "リモートホスト上のコンテナへのファイルアクセスは非対応です: %s", containerName)
+		return "", os.ErrNotExist
+	}
+
+	// コンテナの実体からマウント情報を動的に取得する。ファイル操作ごとの問い合わせを避けるため、キャッシュを経由する。
+	ctx, cancel := context.WithTimeout(context.Background(), docker.CallTimeout)
+	defer cancel()
+	inspect, err := docker.Inspects.Inspect(ctx, containerName)
 	if err != nil {
-		logger.Logf("Internal", "VFS", "コンテナ %s の詳細取得失敗: %v", containerName, err)
+		logger.Errorf("Internal", "VFS", "コンテナ %s の詳細取得失敗: %v", containerName, err)
 		return "", os.ErrNotExist
 	}
 
@@ -80,6 +101,27 @@ func (h *Handler) MapPath(path string) (string, error) {
 	return "", os.ErrNotExist
 }
 
+// MARK: CanWrite()
+// 仮想パスへの書き込み (作成・変更・削除・名前変更) を許可するかを返す。
+// file.write の付与がパスに限定されている場合 ("file.write:/data/plugins") は、そのパスと配下のみを許可する。
+func (h *Handler) CanWrite(p string) bool {
+	serverName, rel, _ := strings.Cut(strings.Trim(filepath.Clean("/"+p), "/"), "/")
+	if serverName == "" {
+		return false
+	}
+	return h.Config.Get().Users[h.Username].HasPathPermission(serverName, config.PermFileWrite, "/"+rel)
+}
+
+// MARK: MapWritePath()
+// 書き込みの権限を CanWrite で確認した上で、MapPath で解決する。書き込みを伴う全ての操作はこれを経由する。
+func (h *Handler) MapWritePath(p string) (string, error) {
+	if !h.CanWrite(p) {
+		logger.Warnf("Client", "VFS", "書き込み拒否: user=%s, path=%s", h.Username, p)
+		return "", os.ErrPermission
+	}
+	return h.MapPath(p)
+}
+
 // MARK: FileInfo
 // 物理的なファイルが存在しない仮想階層（コンテナ名など）を表現するための FileInfo 実装。
 type FileInfo struct {
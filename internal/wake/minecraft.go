@@ -0,0 +1,138 @@
+package wake
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/play-bin/internal/query"
+)
+
+// maxPacketLength は受け入れるパケットの最大長。ハンドシェイク等の小さなパケットのみを扱うため小さく抑える。
+const maxPacketLength = 4096
+
+const (
+	defaultSleepingMessage = "サーバーは停止中です。接続すると起動します"
+	defaultStartingMessage = "サーバーを起動しています。しばらくしてから再接続してください"
+)
+
+// MARK: handleMinecraft()
+// Minecraft Java Edition のハンドシェイクを解釈し、ステータス要求には停止中/起動中を示す応答を、
+// ログイン要求には起動中である旨の切断メッセージを返す。ログイン要求であった場合に true を返す。
+func handleMinecraft(conn net.Conn, message string, starting bool) bool {
+	r := bufio.NewReader(conn)
+	payload, err := readPacket(r)
+	if err != nil {
+		return false
+	}
+	p := bytes.NewReader(payload)
+	if id, err := query.ReadVarInt(p); err != nil || id != 0x00 {
+		return false
+	}
+	if _, err := query.ReadVarInt(p); err != nil { // プロトコルバージョン
+		return false
+	}
+	if _, err := readString(p); err != nil { // 接続先アドレス
+		return false
+	}
+	if _, err := p.Seek(2, io.SeekCurrent); err != nil { // 接続先ポート
+		return false
+	}
+	nextState, err := query.ReadVarInt(p)
+	if err != nil {
+		return false
+	}
+
+	switch nextState {
+	case 1: // status
+		if message == "" {
+			message = defaultSleepingMessage
+			if starting {
+				message = defaultStartingMessage
+			}
+		}
+		// Status Request を待ってから応答する。
+		if _, err := readPacket(r); err != nil {
+			return false
+		}
+		status, _ := json.Marshal(map[string]any{
+			"version":     map[string]any{"name": "sleeping", "protocol": -1},
+			"players":     map[string]any{"max": 0, "online": 0},
+			"description": map[string]any{"text": message},
+		})
+		var body bytes.Buffer
+		query.WriteVarInt(&body, 0x00)
+		writeString(&body, string(status))
+		if err := writePacket(conn, body.Bytes()); err != nil {
+			return false
+		}
+		// Ping Request (0x01) にはそのまま同じ内容を返し、クライアントに応答時間を表示させる。
+		ping, err := readPacket(r)
+		if err != nil || len(ping) == 0 || ping[0] != 0x01 {
+			return false
+		}
+		writePacket(conn, ping)
+		return false
+	case 2: // login
+		if message == "" {
+			message = defaultStartingMessage
+		}
+		reason, _ := json.Marshal(map[string]any{"text": message})
+		var body bytes.Buffer
+		query.WriteVarInt(&body, 0x00) // Login Disconnect
+		writeString(&body, string(reason))
+		writePacket(conn, body.Bytes())
+		return true
+	default:
+		return false
+	}
+}
+
+// readPacket は長さ付きのパケットを 1 つ読み込み、パケット ID 以降の内容を返す。
+func readPacket(r *bufio.Reader) ([]byte, error) {
+	length, err := query.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 || length > maxPacketLength {
+		return nil, fmt.Errorf("invalid packet length: %d", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// writePacket は内容の前に長さを付与して送信する。
+func writePacket(w io.Writer, payload []byte) error {
+	var packet bytes.Buffer
+	query.WriteVarInt(&packet, int32(len(payload)))
+	packet.Write(payload)
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	length, err := query.ReadVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > r.Len() {
+		return "", errors.New("invalid string length")
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func writeString(w *bytes.Buffer, s string) {
+	query.WriteVarInt(w, int32(len(s)))
+	w.WriteString(s)
+}
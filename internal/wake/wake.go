@@ -0,0 +1,189 @@
+package wake
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/containerd/errdefs"
+
+	"github.com/play-bin/internal/config"
+	"github.com/play-bin/internal/container"
+	"github.com/play-bin/internal/docker"
+	"github.com/play-bin/internal/logger"
+)
+
+// reconcileInterval はイベントを取りこぼした場合に備えた、待ち受け状態の定期的な再確認の間隔。
+const reconcileInterval = 30 * time.Second
+
+// listener は 1 サーバー分の代理待ち受け。
+type listener struct {
+	cfg      config.WakeConfig
+	ln       net.Listener
+	starting atomic.Bool
+}
+
+// MARK: Proxy
+// 停止中（コンテナが存在しない）サーバーのゲームポートを代理で待ち受け、接続があればサーバーを起動する。
+// コンテナの作成直前に待ち受けを解放し、以降はゲームサーバー自身がポートを引き継ぐ。
+type Proxy struct {
+	Config           *config.LoadedConfig
+	ContainerManager *container.Manager
+
+	mu        sync.Mutex
+	listeners map[string]*listener
+	failed    map[string]bool // 待ち受けに失敗したサーバー（ログの連続出力を防ぐ）
+}
+
+// MARK: NewProxy()
+func NewProxy(cfg *config.LoadedConfig, cm *container.Manager) *Proxy {
+	return &Proxy{
+		Config:           cfg,
+		ContainerManager: cm,
+		listeners:        make(map[string]*listener),
+		failed:           make(map[string]bool),
+	}
+}
+
+// MARK: Start()
+// コンテナのライフサイクルイベントと定期的な確認を契機に、各サーバーの待ち受け状態を調整するループを開始する。
+func (p *Proxy) Start() {
+	events, _ := docker.Events.Subscribe()
+	go func() {
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+		p.reconcile()
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				// 停止・削除によってポートが空いた可能性があるため、再確認する。
+				if ev.Action == "die" || ev.Action == "destroy" {
+					p.reconcile()
+				}
+			case <-ticker.C:
+				p.reconcile()
+			}
+		}
+	}()
+}
+
+// MARK: Release()
+// 指定サーバーの待ち受けを解放する。Manager.BeforeCreate に設定し、Docker がポートを確保できるようにする。
+func (p *Proxy) Release(serverName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked(serverName)
+}
+
+// reconcile は設定とコンテナの状態に合わせて、待ち受けの開始・停止を行う。
+func (p *Proxy) reconcile() {
+	servers := p.Config.Get().Servers
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 設定から削除された、または待ち受け先が変更されたサーバーの待ち受けを閉じる。
+	for name, l := range p.listeners {
+		if cfg := servers[name].Wake; cfg == nil || *cfg != l.cfg {
+			p.closeLocked(name)
+		}
+	}
+
+	for name, serverCfg := range servers {
+		if serverCfg.Wake == nil || !docker.IsLocal(name) {
+			continue
+		}
+		if l, ok := p.listeners[name]; ok && l.starting.Load() {
+			// 起動処理中は「起動中」の応答を返し続ける。
+			continue
+		}
+
+		missing := false
+		if cli, err := docker.ForServer(name); err == nil {
+			_, err := cli.ContainerInspect(ctx, docker.ContainerName(name))
+			missing = errdefs.IsNotFound(err)
+		}
+		// Start は既存のコンテナがあると起動できないため、コンテナが存在しない場合のみ代理で待ち受ける。
+		if !missing {
+			p.closeLocked(name)
+			continue
+		}
+		if _, ok := p.listeners[name]; ok {
+			continue
+		}
+
+		ln, err := net.Listen("tcp", serverCfg.Wake.Listen)
+		if err != nil {
+			if !p.failed[name] {
+				logger.Errorf("Internal", "Wake", "待ち受けの開始に失敗(%s, %s): %v", name, serverCfg.Wake.Listen, err)
+				p.failed[name] = true
+			}
+			continue
+		}
+		delete(p.failed, name)
+		l := &listener{cfg: *serverCfg.Wake, ln: ln}
+		p.listeners[name] = l
+		logger.Logf("Internal", "Wake", "停止中のサーバーの待ち受けを開始しました: %s (%s)", name, serverCfg.Wake.Listen)
+		go p.serve(name, l)
+	}
+}
+
+// closeLocked は待ち受けを閉じる。p.mu を保持した状態で呼び出すこと。
+func (p *Proxy) closeLocked(serverName string) {
+	l, ok := p.listeners[serverName]
+	if !ok {
+		return
+	}
+	l.ln.Close()
+	delete(p.listeners, serverName)
+	logger.Logf("Internal", "Wake", "待ち受けを解放しました: %s", serverName)
+}
+
+// serve は待ち受けが閉じられるまで接続を受け付ける。
+func (p *Proxy) serve(serverName string, l *listener) {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			var wantStart bool
+			if l.cfg.Protocol == "minecraft" {
+				wantStart = handleMinecraft(conn, l.cfg.Message, l.starting.Load())
+			} else {
+				// 汎用 TCP ではプロトコルを解釈できないため、接続自体を起動要求とみなして切断する（クライアントに再接続を促す）。
+				wantStart = true
+			}
+			if wantStart {
+				p.trigger(serverName, l, conn.RemoteAddr())
+			}
+		}()
+	}
+}
+
+// trigger はサーバーの起動を開始する。既に起動処理中であれば何もしない。
+func (p *Proxy) trigger(serverName string, l *listener, from net.Addr) {
+	if !l.starting.CompareAndSwap(false, true) {
+		return
+	}
+	logger.Logf("Client", "Wake", "接続を検知したためサーバーを起動します: %s (from %s)", serverName, from)
+	go func() {
+		err := p.ContainerManager.ExecuteAction(container.WithActor(context.Background(), "", container.ViaWake), serverName, container.ActionStart)
+		l.starting.Store(false)
+		if err != nil {
+			logger.Errorf("Internal", "Wake", "サーバーの起動に失敗(%s): %v", serverName, err)
+		}
+		// 起動に失敗した場合は待ち受けを再開できるよう、状態を再確認する。
+		p.reconcile()
+	}()
+}
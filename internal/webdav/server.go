@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/play-bin/internal/config"
@@ -33,7 +34,7 @@ func (s *Server) Handler() http.Handler {
 		LockSystem: webdav.NewMemLS(),
 		Logger: func(r *http.Request, err error) {
 			if err != nil && !os.IsNotExist(err) {
-				logger.Logf("Internal", "WebDAV", "エラー: %v %s: %v", r.Method, r.URL.Path, err)
+				logger.Errorf("Internal", "WebDAV", "エラー: %v %s: %v", r.Method, r.URL.Path, err)
 			}
 		},
 	}
@@ -44,10 +45,10 @@ func (s *Server) Handler() http.Handler {
 		cfg := s.Config.Get()
 		user, userOk := cfg.Users[username]
 
-		if !ok || !userOk || user.Password != password {
+		if !ok || !userOk || !user.CheckPassword(password) {
 			w.Header().Set("WWW-Authenticate", `Basic realm="play-bin WebDAV"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			logger.Logf("Client", "WebDAV", "ログイン失敗: user=%s, addr=%s", username, r.RemoteAddr)
+			logger.Warnf("Client", "WebDAV", "ログイン失敗: user=%s, addr=%s", username, r.RemoteAddr)
 			return
 		}
 
@@ -97,6 +98,49 @@ func (a *vfsWebdavAdapter) OpenFile(ctx context.Context, name string, flag int,
 		}
 	}
 
+	// コンテナ内のファイルシステムは読み取り専用で、Docker から直接読み出す。
+	if serverName, inner, ok, err := h.ContainerPath(name); ok {
+		if err != nil {
+			return nil, err
+		}
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+			return nil, os.ErrPermission
+		}
+		info, err := vfs.ContainerStat(serverName, inner)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return &containerDirFile{serverName: serverName, inner: inner, info: info}, nil
+		}
+		return vfs.ContainerOpen(serverName, inner)
+	}
+
+	// 状態とログの仮想ファイルは読み取り専用で、開く都度現在の状態から生成する。
+	if serverName, file, ok, err := h.StatusPath(name); ok {
+		if err != nil {
+			return nil, err
+		}
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+			return nil, os.ErrPermission
+		}
+		return h.OpenStatus(serverName, file)
+	}
+
+	// バックアップの世代は読み取り専用で、ホスト上の世代のディレクトリから読み出す。
+	if fullPath, ok, err := h.BackupPath(name); ok {
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+			return nil, os.ErrPermission
+		}
+		if err == vfs.ErrVfsBackupDir {
+			return &backupDirFile{handler: h, name: name}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(fullPath)
+	}
+
 	fullPath, err := h.MapPath(name)
 	if err != nil {
 		// ルートまたはコンテナルートの場合は仮想ディレクトリとして振る舞う
@@ -110,6 +154,16 @@ func (a *vfsWebdavAdapter) OpenFile(ctx context.Context, name string, flag int,
 		return nil, err
 	}
 
+	// ステージングが有効な場合は一時ファイルへ書き込み、Close で検証してから置き換える。
+	staged, err := h.OpenStaged(name, fullPath, flag)
+	if err != nil {
+		return nil, err
+	}
+	if staged != nil {
+		logger.Logf("Client", "WebDAV", "ファイル書込オープン (ステージング): user=%s, path=%s", h.Username, name)
+		return staged, nil
+	}
+
 	f, err := os.OpenFile(fullPath, flag, perm)
 	if err != nil {
 		return nil, err
@@ -160,6 +214,34 @@ func (a *vfsWebdavAdapter) Rename(ctx context.Context, oldName, newName string)
 
 func (a *vfsWebdavAdapter) Stat(ctx context.Context, name string) (os.FileInfo, error) {
 	h := a.getHandler(ctx)
+	if serverName, inner, ok, err := h.ContainerPath(name); ok {
+		if err != nil {
+			return nil, err
+		}
+		return vfs.ContainerStat(serverName, inner)
+	}
+	if serverName, file, ok, err := h.StatusPath(name); ok {
+		if err != nil {
+			return nil, err
+		}
+		f, err := h.OpenStatus(serverName, file)
+		if err != nil {
+			return nil, err
+		}
+		return f.Stat()
+	}
+	if fullPath, ok, err := h.BackupPath(name); ok {
+		if err == vfs.ErrVfsBackupDir {
+			if _, err := h.BackupReadDir(name); err != nil {
+				return nil, err
+			}
+			return vfs.NewFileInfo(path.Base(name), true), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return os.Stat(fullPath)
+	}
 	fullPath, err := h.MapPath(name)
 	if err != nil {
 		if err == vfs.ErrVfsRoot {
@@ -174,15 +256,9 @@ func (a *vfsWebdavAdapter) Stat(ctx context.Context, name string) (os.FileInfo,
 	return os.Stat(fullPath)
 }
 
+// checkWritePerm は対象のパスへの write 権限を確認する。file.write の付与がパスに限定されている場合は、その配下のみを許可する。
 func (a *vfsWebdavAdapter) checkWritePerm(h *vfs.Handler, path string) error {
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) == 0 || parts[0] == "" {
-		return os.ErrPermission
-	}
-	containerName := parts[0]
-	cfg := h.Config.Get()
-	user := cfg.Users[h.Username]
-	if !user.HasPermission(containerName, config.PermFileWrite) {
+	if !h.CanWrite(path) {
 		return os.ErrPermission
 	}
 	return nil
@@ -223,13 +299,25 @@ func (f *vfsWebdavFile) Readdir(count int) ([]os.FileInfo, error) {
 	} else {
 		// コンテナルート：マウントポイント一覧
 		// 注意: Readdir 内で docker client 呼び出しが必要
-		inspect, err := docker.Client.ContainerInspect(context.Background(), f.containerName)
-		if err == nil {
-			for _, m := range inspect.Mounts {
-				name := strings.Trim(m.Destination, "/")
-				items = append(items, vfs.NewFileInfo(name, true))
+		// リモートホスト上のコンテナはマウント元がこのマシンに存在しないため、一覧に含めない。
+		cli, err := docker.ForServer(f.containerName)
+		if err == nil && docker.IsLocal(f.containerName) {
+			ctx, cancel := context.WithTimeout(context.Background(), docker.CallTimeout)
+			defer cancel()
+			if inspect, err := docker.InspectOwned(ctx, cli, f.containerName); err == nil {
+				for _, m := range inspect.Mounts {
+					name := strings.Trim(m.Destination, "/")
+					items = append(items, vfs.NewFileInfo(name, true))
+				}
 			}
 		}
+		if f.handler.ContainerEnabled(f.containerName) {
+			items = append(items, vfs.NewFileInfo(vfs.ContainerDir, true))
+		}
+		if f.handler.BackupsEnabled(f.containerName) {
+			items = append(items, vfs.NewFileInfo(vfs.BackupsDir, true))
+		}
+		items = append(items, f.handler.StatusFiles(f.containerName)...)
 	}
 
 	// 簡易的なオフセット処理
@@ -246,3 +334,78 @@ func (f *vfsWebdavFile) Readdir(count int) ([]os.FileInfo, error) {
 	f.offset = end
 	return items[start:end], nil
 }
+
+// MARK: containerDirFile
+// コンテナ内のディレクトリを webdav.File として扱うための実装。一覧は最初の Readdir でまとめて取得する。
+type containerDirFile struct {
+	serverName string
+	inner      string
+	info       os.FileInfo
+	items      []os.FileInfo
+	loaded     bool
+	offset     int
+}
+
+func (f *containerDirFile) Close() error                                 { return nil }
+func (f *containerDirFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (f *containerDirFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (f *containerDirFile) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (f *containerDirFile) Stat() (os.FileInfo, error)                   { return f.info, nil }
+
+func (f *containerDirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.loaded {
+		items, err := vfs.ContainerReadDir(f.serverName, f.inner)
+		if err != nil {
+			return nil, err
+		}
+		f.items, f.loaded = items, true
+	}
+	if f.offset >= len(f.items) {
+		return nil, nil
+	}
+	end := len(f.items)
+	if count > 0 && f.offset+count < end {
+		end = f.offset + count
+	}
+	items := f.items[f.offset:end]
+	f.offset = end
+	return items, nil
+}
+
+// MARK: backupDirFile
+// バックアップの世代の一覧等の仮想ディレクトリを webdav.File として扱うための実装。
+type backupDirFile struct {
+	handler *vfs.Handler
+	name    string
+	items   []os.FileInfo
+	loaded  bool
+	offset  int
+}
+
+func (f *backupDirFile) Close() error                                 { return nil }
+func (f *backupDirFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (f *backupDirFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (f *backupDirFile) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (f *backupDirFile) Stat() (os.FileInfo, error) {
+	return vfs.NewFileInfo(path.Base(f.name), true), nil
+}
+
+func (f *backupDirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.loaded {
+		items, err := f.handler.BackupReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.items, f.loaded = items, true
+	}
+	if f.offset >= len(f.items) {
+		return nil, nil
+	}
+	end := len(f.items)
+	if count > 0 && f.offset+count < end {
+		end = f.offset + count
+	}
+	items := f.items[f.offset:end]
+	f.offset = end
+	return items, nil
+}
@@ -0,0 +1,165 @@
+// Package client は play-bin の HTTP / WebSocket API を Go から利用するためのクライアント。
+// 自動化ツールや CLI が同じ実装を共有できるよう、ログイン・コンテナの一覧と操作 (ジョブの進捗の取得を含む)・
+// 統計情報のストリーム・WebDAV 経由のファイル操作を提供する。API は /api/v1/ を使用する。
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPrefix は呼び出す API のパスの接頭辞。エラーを JSON 形式で受け取るため /api/v1/ を使用する。
+const apiPrefix = "/api/v1/"
+
+// MARK: Client
+// play-bin サーバー 1 台への接続情報と、ログインで得たセッショントークンを保持する。複数のゴルーチンから並行して使用できる。
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+
+	// PollInterval は RunAction がジョブの進捗を取得する間隔。
+	PollInterval time.Duration
+
+	token    string
+	username string // WebDAV の Basic 認証に使用する
+	password string
+	mu       sync.RWMutex
+}
+
+// Option は NewClient に渡す設定。
+type Option func(*Client)
+
+// WithHTTPClient は API の呼び出しに使用する HTTP クライアントを指定する (TLS の設定やプロキシ等)。
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken は発行済みのセッショントークンを使用する。Login を呼び出す必要はないが、ファイル操作には WithCredentials も必要となる。
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithCredentials はファイル操作 (WebDAV) に使用するユーザー名とパスワードを指定する。Login を呼び出した場合は自動的に設定される。
+func WithCredentials(username, password string) Option {
+	return func(c *Client) { c.username, c.password = username, password }
+}
+
+// MARK: NewClient()
+// baseURL (例: "https://panel.example.com") の play-bin サーバーへ接続するクライアントを作成する。
+func NewClient(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url %q (expected http:// or https://)", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	c := &Client{
+		baseURL:      u,
+		httpClient:   &http.Client{},
+		PollInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// MARK: Token()
+// 現在のセッショントークンを返す。保存しておき、次回 WithToken で再利用できる。
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// MARK: Login()
+// ユーザー名とパスワードでログインし、以降の呼び出しに使用するセッショントークンを保持する。
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"username": username, "password": password}
+	if err := c.do(ctx, http.MethodPost, "login", nil, body, &resp); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.token, c.username, c.password = resp.Token, username, password
+	c.mu.Unlock()
+	return nil
+}
+
+// endpoint は API のパスとクエリから URL を組み立てる。
+func (c *Client) endpoint(path string, query url.Values) string {
+	u := *c.baseURL
+	u.Path += apiPrefix + path
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// newRequest はセッショントークンを付与したリクエストを作成する。
+func (c *Client) newRequest(ctx context.Context, method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return req, nil
+}
+
+// do は API を呼び出し、成功した場合は応答の JSON を out へ読み込む。in が nil 以外の場合は JSON として送信する。
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	_, err := c.doResponse(ctx, method, path, query, nil, in, out)
+	return err
+}
+
+// doResponse は do に加えてリクエストヘッダーを指定でき、応答ヘッダーを返す。
+func (c *Client) doResponse(ctx context.Context, method, path string, query url.Values, header http.Header, in, out any) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := c.newRequest(ctx, method, c.endpoint(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return resp.Header, parseError(resp)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return resp.Header, nil
+	}
+	if w, ok := out.(io.Writer); ok {
+		_, err = io.Copy(w, resp.Body)
+		return resp.Header, err
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient は handler を提供するテスト用のサーバーと、そこへ接続するクライアントを返す。
+func newTestClient(t *testing.T, handler http.Handler, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c, err := NewClient(srv.URL+"/", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// writeAPIError は /api/v1/ と同じ形式のエラーを返す。
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-ID", "req-1")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": code, "message": message, "requestId": "req-1"}})
+}
+
+func TestNewClientRejectsInvalidURL(t *testing.T) {
+	for _, u := range []string{"panel.example.com", "ftp://panel.example.com", "://"} {
+		if _, err := NewClient(u); err == nil {
+			t.Errorf("NewClient(%q) succeeded", u)
+		}
+	}
+}
+
+func TestLoginStoresToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/login", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Username, Password string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Username != "alice" || body.Password != "secret" {
+			writeAPIError(w, http.StatusUnauthorized, "unauthenticated", "Invalid credentials")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+	})
+	mux.HandleFunc("GET /api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "t0ken" {
+			writeAPIError(w, http.StatusUnauthorized, "unauthenticated", "Authentication required")
+			return
+		}
+		json.NewEncoder(w).Encode([]Job{})
+	})
+	c := newTestClient(t, mux)
+	ctx := context.Background()
+
+	if _, err := c.ListJobs(ctx, JobFilter{}); !IsCode(err, "unauthenticated") {
+		t.Fatalf("ListJobs before login: err = %v, want unauthenticated", err)
+	}
+	if err := c.Login(ctx, "alice", "wrong"); !IsCode(err, "unauthenticated") {
+		t.Fatalf("Login with wrong password: err = %v, want unauthenticated", err)
+	}
+	if c.Token() != "" {
+		t.Fatalf("token = %q after failed login", c.Token())
+	}
+	if err := c.Login(ctx, "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token() != "t0ken" {
+		t.Fatalf("token = %q, want t0ken", c.Token())
+	}
+	if _, err := c.ListJobs(ctx, JobFilter{}); err != nil {
+		t.Fatalf("ListJobs after login: %v", err)
+	}
+
+	// 保存したトークンは、ログインせずに再利用できる。
+	reused := newTestClient(t, mux, WithToken(c.Token()))
+	if _, err := reused.ListJobs(ctx, JobFilter{}); err != nil {
+		t.Fatalf("ListJobs with WithToken: %v", err)
+	}
+}
+
+func TestAPIErrorMapping(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/container/start", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		writeAPIError(w, http.StatusTooManyRequests, "cooldown", "start is on cooldown")
+	})
+	mux.HandleFunc("/api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		// リバースプロキシ等が返す、JSON 形式でないエラー。
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	})
+	c := newTestClient(t, mux, WithToken("t"))
+	ctx := context.Background()
+
+	_, err := c.RunBulkAction(ctx, "events", ActionStart, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Code != "cooldown" || apiErr.RequestID != "req-1" || apiErr.RetryAfter != 30*time.Second {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+
+	_, err = c.ListJobs(ctx, JobFilter{})
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadGateway || apiErr.Code != "internal" || apiErr.Message != "upstream unavailable" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
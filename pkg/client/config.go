@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ConfigIssue は設定の検証で見つかった 1 件の問題。
+type ConfigIssue struct {
+	Level   string `json:"level"` // "error" または "warning"
+	File    string `json:"file,omitempty"`
+	Path    string `json:"path,omitempty"` // 問題のあるキー (例: servers.mc.compose.restart)
+	Message string `json:"message"`
+}
+
+// ConfigValidation はサーバー上の設定ファイルの検証結果。
+type ConfigValidation struct {
+	File   string        `json:"file"`
+	Valid  bool          `json:"valid"`
+	Issues []ConfigIssue `json:"issues"`
+}
+
+// MARK: ValidateConfig()
+// サーバーのディスク上の設定ファイル (servers.d を含む) を検証した結果を返す。config.read 権限が必要。
+func (c *Client) ValidateConfig(ctx context.Context) (ConfigValidation, error) {
+	var result ConfigValidation
+	err := c.do(ctx, http.MethodGet, "config/validate", nil, nil, &result)
+	return result, err
+}
@@ -0,0 +1,463 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// MARK: Container
+// コンテナ一覧の 1 項目。
+type Container struct {
+	ID          string   `json:"id"` // 設定に定義されたサーバーはサーバー名、それ以外はコンテナ ID
+	Names       []string `json:"names"`
+	Host        string   `json:"host,omitempty"` // dockerHosts 名 (既定のホストは空文字)
+	Tags        []string `json:"tags,omitempty"` // 設定の tags
+	State       string   `json:"state"`          // running, exited, missing, unreachable 等
+	Actions     []string `json:"actions"`        // 実行可能な操作
+	Permissions []string `json:"permissions"`
+
+	Ready      string      `json:"ready,omitempty"`      // ready 設定のあるサーバーの起動中のみ。ReadyStarting 等
+	LastAction *LastAction `json:"lastAction,omitempty"` // 最後に実行された操作
+	LastStop   *LastStop   `json:"lastStop,omitempty"`   // 最後の停止の終了コードと理由
+	LogLevels  bool        `json:"logLevels,omitempty"`  // logFormat が定義され、ログをレベルで絞り込める
+	StartedAt  time.Time   `json:"startedAt,omitzero"`   // ListOptions.Stats または Sort="uptime" を指定した場合のみ
+	Stats      *Stats      `json:"stats,omitempty"`      // ListOptions.Stats を指定した場合のみ
+}
+
+// LastAction はサーバーに対して最後に実行された操作。
+type LastAction struct {
+	Action     string    `json:"action"`
+	User       string    `json:"user,omitempty"` // 自動停止等の play-bin 自身の操作は空
+	Via        string    `json:"via,omitempty"`  // http, grpc, discord, schedule, autoshutdown, wake
+	Status     JobStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+// LastStop はコンテナが最後に停止した際の終了コードと理由。
+type LastStop struct {
+	Time     time.Time `json:"time"`
+	ExitCode int       `json:"exitCode"`
+	Reason   string    `json:"reason"`           // requested, exited, crashed, oom
+	Action   string    `json:"action,omitempty"` // reason が requested の場合、停止させた操作
+	User     string    `json:"user,omitempty"`
+	Via      string    `json:"via,omitempty"`
+}
+
+// Name は先頭の '/' を除いたコンテナ名を返す。
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// ListOptions はコンテナ一覧の絞り込み・並び替え・ページングの条件。ゼロ値は全件を名前順で返す。
+type ListOptions struct {
+	States []string // いずれかの状態に一致するもののみ
+	Name   string   // 名前にこの文字列を含むもののみ (大文字・小文字は区別しない)
+	Tags   []string // いずれかのパターン (例: "events", "survival-*") に一致するタグを持つもののみ
+	Sort   string   // "name" / "state" / "uptime"。先頭に "-" で降順
+	Limit  int
+	Offset int
+	Stats  bool // 起動中の項目に起動時刻と統計情報を付与する
+}
+
+// MARK: ListContainers()
+// 閲覧権限のあるコンテナの一覧と、絞り込み後 (ページング前) の総数を返す。
+func (c *Client) ListContainers(ctx context.Context, opts ListOptions) ([]Container, int, error) {
+	q := url.Values{}
+	if len(opts.States) > 0 {
+		q.Set("state", strings.Join(opts.States, ","))
+	}
+	if opts.Name != "" {
+		q.Set("name", opts.Name)
+	}
+	if len(opts.Tags) > 0 {
+		q.Set("tag", strings.Join(opts.Tags, ","))
+	}
+	if opts.Sort != "" {
+		q.Set("sort", opts.Sort)
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	if opts.Stats {
+		q.Set("stats", "true")
+	}
+	var containers []Container
+	header, err := c.doResponse(ctx, http.MethodGet, "containers", q, nil, nil, &containers)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := strconv.Atoi(header.Get("X-Total-Count"))
+	if err != nil {
+		total = len(containers)
+	}
+	return containers, total, nil
+}
+
+// MARK: InspectContainer()
+// Docker の ContainerInspect の結果をそのまま返す。
+func (c *Client) InspectContainer(ctx context.Context, server string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	err := c.do(ctx, http.MethodGet, "container/inspect", url.Values{"id": {server}}, nil, &raw)
+	return raw, err
+}
+
+// サーバーの準備状態。ReadyStatus.State の値。
+const (
+	ReadyStarting = "starting" // コンテナは起動したが、準備完了をまだ検知していない
+	ReadyReady    = "ready"    // 準備完了を検知した
+	ReadyTimeout  = "timeout"  // ready.timeout 以内に準備完了を検知できなかった
+)
+
+// MARK: ReadyStatus
+// サーバーの準備状態。ready が未設定、またはコンテナが停止中の場合 State は空となる。
+type ReadyStatus struct {
+	Server string    `json:"server"`
+	State  string    `json:"state"`
+	Since  time.Time `json:"since,omitzero"`
+}
+
+// MARK: Ready()
+// サーバーの準備状態を返す。wait が正の場合は、starting を抜けるまで最大 wait (サーバー側の上限 5 分) 待機する。
+func (c *Client) Ready(ctx context.Context, server string, wait time.Duration) (ReadyStatus, error) {
+	q := url.Values{"id": {server}}
+	if wait > 0 {
+		q.Set("wait", wait.String())
+	}
+	var status ReadyStatus
+	err := c.do(ctx, http.MethodGet, "container/ready", q, nil, &status)
+	return status, err
+}
+
+// MARK: Traffic
+// サーバーのネットワークの通信量の集計。
+type Traffic struct {
+	Server  string           `json:"server"`
+	Total   TrafficBytes     `json:"total"`   // 記録を開始してからの合計
+	Last    *TrafficInterval `json:"last"`    // 最後の取得間隔 (約 1 分) の通信量
+	Current *TrafficInterval `json:"current"` // 起動中のコンテナの、起動してからの累計
+	Months  []struct {
+		Month string `json:"month"`
+		Days  int    `json:"days"`
+		TrafficBytes
+	} `json:"months"` // 月ごとの合計 (新しい順)
+	Month string `json:"month"`
+	Days  []struct {
+		Date string `json:"date"`
+		TrafficBytes
+	} `json:"days"` // Month の日ごとの合計
+}
+
+// TrafficBytes は受信 (RX) と送信 (TX) のバイト数。
+type TrafficBytes struct {
+	RX uint64 `json:"rx"`
+	TX uint64 `json:"tx"`
+}
+
+// TrafficInterval は期間内の通信量。
+type TrafficInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	TrafficBytes
+}
+
+// MARK: Traffic()
+// サーバーの通信量を月ごとの合計と、month (YYYY-MM。空の場合は今月) の日ごとの内訳で返す。
+func (c *Client) Traffic(ctx context.Context, server, month string) (Traffic, error) {
+	q := url.Values{"id": {server}}
+	if month != "" {
+		q.Set("month", month)
+	}
+	var traffic Traffic
+	err := c.do(ctx, http.MethodGet, "container/traffic", q, nil, &traffic)
+	return traffic, err
+}
+
+// MARK: Backup
+// バックアップの世代と、その実行の記録。
+type Backup struct {
+	Generation   string    `json:"generation"`       // RunAction の ActionOptions.Generation に指定できる世代
+	Status       string    `json:"status,omitempty"` // succeeded / failed。記録の無い世代は空
+	Error        string    `json:"error,omitempty"`
+	User         string    `json:"user,omitempty"`
+	Via          string    `json:"via,omitempty"`    // http, grpc, discord, schedule 等
+	Job          string    `json:"job,omitempty"`    // バックアップを行ったジョブの ID
+	Action       string    `json:"action,omitempty"` // ジョブの操作 (backup 以外は他の操作に伴うバックアップ)
+	StartedAt    time.Time `json:"startedAt,omitzero"`
+	Duration     int64     `json:"duration"`         // 所要時間 (ミリ秒)
+	ChangedFiles int64     `json:"changedFiles"`     // 前回の世代から追加・変更されたファイルの数
+	TotalSize    int64     `json:"totalSize"`        // 世代に含まれるファイルの合計サイズ (バイト)
+	SizeDelta    int64     `json:"sizeDelta"`        // 前回の世代からの合計サイズの増減 (バイト)
+	Engine       string    `json:"engine,omitempty"` // 世代を作成した方式 (rsync / btrfs / zfs)
+}
+
+// MARK: ListBackups()
+// サーバーのバックアップ世代を新しい順で返す。失敗したバックアップの記録を含む。
+func (c *Client) ListBackups(ctx context.Context, server string) ([]Backup, error) {
+	var backups []Backup
+	err := c.do(ctx, http.MethodGet, "container/backups", url.Values{"id": {server}}, nil, &backups)
+	return backups, err
+}
+
+// MARK: Logs()
+// コンテナのログの末尾 tail 行を返す (0 の場合はサーバーの既定の 100 行)。
+func (c *Client) Logs(ctx context.Context, server string, tail int) (string, error) {
+	q := url.Values{"id": {server}}
+	if tail > 0 {
+		q.Set("tail", strconv.Itoa(tail))
+	}
+	var b strings.Builder
+	err := c.do(ctx, http.MethodGet, "container/logs", q, nil, &b)
+	return b.String(), err
+}
+
+// LogOptions は DownloadLogs で取得するログの範囲と形式。
+type LogOptions struct {
+	Tail       int       // 末尾の行数。0 の場合は範囲内の全て
+	Since      time.Time // この時刻以降のログのみ (ゼロ値は制限なし)
+	Until      time.Time // この時刻以前のログのみ (ゼロ値は制限なし)
+	Timestamps bool      // 各行の先頭に時刻 (RFC 3339) を付与する
+	Level      string    // 指定したレベル (debug / info / warn / error) 以上の行のみ。サーバーの logFormat が必要
+}
+
+// query は LogOptions をクエリへ変換する。
+func (o LogOptions) query(server string) url.Values {
+	q := url.Values{"id": {server}, "download": {"true"}}
+	if o.Tail > 0 {
+		q.Set("tail", strconv.Itoa(o.Tail))
+	}
+	if !o.Since.IsZero() {
+		q.Set("since", o.Since.Format(time.RFC3339Nano))
+	}
+	if !o.Until.IsZero() {
+		q.Set("until", o.Until.Format(time.RFC3339Nano))
+	}
+	if o.Timestamps {
+		q.Set("timestamps", "true")
+	}
+	if o.Level != "" {
+		q.Set("level", o.Level)
+	}
+	return q
+}
+
+// MARK: DownloadLogs()
+// opts で指定した範囲のコンテナのログを w へ書き込む。大きなログでもメモリに保持せずに書き出す。
+func (c *Client) DownloadLogs(ctx context.Context, server string, opts LogOptions, w io.Writer) error {
+	return c.do(ctx, http.MethodGet, "container/logs", opts.query(server), nil, w)
+}
+
+// MARK: ArchiveFile
+// ディスクに保存したログのファイル 1 件の情報。サーバーの logArchive が有効な場合のみ存在する。
+type ArchiveFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Current bool      `json:"current,omitempty"` // 書き込み中のファイル
+}
+
+// MARK: ArchivedLogs()
+// 保存済みのログのファイルを古い順に返す。書き込み中のファイルは末尾となる。
+func (c *Client) ArchivedLogs(ctx context.Context, server string) ([]ArchiveFile, error) {
+	var files []ArchiveFile
+	err := c.do(ctx, http.MethodGet, "container/archive", url.Values{"id": {server}}, nil, &files)
+	return files, err
+}
+
+// MARK: DownloadArchive()
+// 保存済みのログのファイルを w へ書き込む。各行の先頭には時刻 (RFC 3339) が付与されている。
+func (c *Client) DownloadArchive(ctx context.Context, server, file string, w io.Writer) error {
+	return c.do(ctx, http.MethodGet, "container/archive", url.Values{"id": {server}, "file": {file}}, nil, w)
+}
+
+// LogSearchOptions は SearchLogs / SearchArchive の検索条件。
+type LogSearchOptions struct {
+	Query  string    // 部分一致で検索する文字列
+	Regex  string    // 正規表現で検索する (指定した場合は Query を無視する)
+	Since  time.Time // この時刻以降の行のみ (ゼロ値は制限なし)
+	Until  time.Time // この時刻以前の行のみ (ゼロ値は制限なし)
+	Limit  int       // 返す件数の上限 (0 はサーバーの既定値)
+	Cursor string    // 前回の結果の Next。続きを取得する
+}
+
+// query は LogSearchOptions をクエリへ変換する。
+func (o LogSearchOptions) query(server string) url.Values {
+	q := url.Values{"id": {server}, "q": {o.Query}}
+	if o.Regex != "" {
+		q.Set("regex", o.Regex)
+	}
+	if !o.Since.IsZero() {
+		q.Set("since", o.Since.Format(time.RFC3339Nano))
+	}
+	if !o.Until.IsZero() {
+		q.Set("until", o.Until.Format(time.RFC3339Nano))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	return q
+}
+
+// LogMatch はログの検索に一致した 1 行。
+type LogMatch struct {
+	Source string    `json:"source"`         // archive (保存済みのファイル) / docker (Docker のログ)
+	File   string    `json:"file,omitempty"` // 保存済みのファイル名
+	Line   int       `json:"line,omitempty"`
+	Time   time.Time `json:"time,omitzero"`
+	Text   string    `json:"text"`
+}
+
+// LogSearchResult はログの検索結果。Next が空でない場合、LogSearchOptions.Cursor に指定して続きを取得できる。
+type LogSearchResult struct {
+	Matches   []LogMatch `json:"matches"`
+	Truncated bool       `json:"truncated"`
+	Next      string     `json:"next,omitempty"`
+}
+
+// MARK: SearchLogs()
+// 保存済みのログと Docker のログを古い順に検索する。logArchive が無効なサーバーでは Docker のログのみを検索する。
+func (c *Client) SearchLogs(ctx context.Context, server string, opts LogSearchOptions) (*LogSearchResult, error) {
+	var result LogSearchResult
+	if err := c.do(ctx, http.MethodGet, "container/logs/search", opts.query(server), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MARK: SearchArchive()
+// 保存済みのログのみを古い順に検索する。
+func (c *Client) SearchArchive(ctx context.Context, server string, opts LogSearchOptions) (*LogSearchResult, error) {
+	var result LogSearchResult
+	if err := c.do(ctx, http.MethodGet, "container/archive", opts.query(server), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MARK: LogEntry
+// サーバーの logFormat に従って構造化したログの 1 行。
+type LogEntry struct {
+	Time    string `json:"time,omitempty"`
+	Level   string `json:"level,omitempty"` // debug, info, warn, error (判定できない場合は空)
+	Message string `json:"message"`
+	Raw     string `json:"raw"` // 色付け等の制御シーケンスを含む元の行
+}
+
+// MARK: LogEntries()
+// opts で指定した範囲のログを、サーバーの logFormat に従って構造化して返す。
+// logFormat が未定義のサーバーでは、Message と Raw のみが設定される。
+func (c *Client) LogEntries(ctx context.Context, server string, opts LogOptions) ([]LogEntry, error) {
+	q := opts.query(server)
+	q.Set("format", "json")
+	var buf bytes.Buffer
+	if err := c.do(ctx, http.MethodGet, "container/logs", q, nil, &buf); err != nil {
+		return nil, err
+	}
+	var entries []LogEntry
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e LogEntry
+		if err := dec.Decode(&e); err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// MARK: FollowLogs()
+// コンテナのログの末尾 tail 行 (負の場合は保持している全て) を w へ書き込み、以降の出力を追従して書き込み続ける。
+// ctx がキャンセルされるか、接続が切断されるまで戻らない。ctx のキャンセルで終了した場合は nil を返す。
+func (c *Client) FollowLogs(ctx context.Context, server string, tail int, w io.Writer) error {
+	q := url.Values{"id": {server}, "mode": {"logs"}, "tail": {"all"}}
+	if tail >= 0 {
+		q.Set("tail", strconv.Itoa(tail))
+	}
+	conn, err := c.dialWS(ctx, "/ws/terminal", q)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+		// テキストフレームは制御メッセージのため、出力のみを書き込む。
+		if msgType != websocket.BinaryMessage {
+			continue
+		}
+		if _, err := w.Write(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// MARK: SendCommand()
+// 起動中のコンテナの標準入力へコマンドを送信する。末尾に改行が無い場合は付与する。
+func (c *Client) SendCommand(ctx context.Context, server, command string) error {
+	if !strings.HasSuffix(command, "\n") {
+		command += "\n"
+	}
+	return c.do(ctx, http.MethodPost, "container/cmd", url.Values{"id": {server}}, map[string]string{"command": command}, nil)
+}
+
+// MARK: ShareLink
+// アカウントなしでログと統計情報を閲覧できる、期限付きの共有リンク。
+type ShareLink struct {
+	Server    string    `json:"server"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"` // 閲覧用のページの URL (/share.html?t=...)
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// MARK: CreateShareLink()
+// サーバーのログと統計情報を duration の間だけ読み取り専用で公開するリンクを発行する (最長 7 日)。
+// duration が 0 の場合はサーバーの既定 (1 時間) とする。container.share 権限が必要。
+func (c *Client) CreateShareLink(ctx context.Context, server string, duration time.Duration) (ShareLink, error) {
+	req := map[string]string{}
+	if duration > 0 {
+		req["duration"] = duration.String()
+	}
+	var link ShareLink
+	if err := c.do(ctx, http.MethodPost, "container/share", url.Values{"id": {server}}, req, &link); err != nil {
+		return ShareLink{}, err
+	}
+	// サーバーは相対 URL を返すため、そのまま共有できるよう接続先の URL と組み合わせる。
+	u := *c.baseURL
+	u.Path += "/share.html"
+	u.RawQuery = url.Values{"t": {link.Token}}.Encode()
+	link.URL = u.String()
+	return link, nil
+}
+
+// MARK: RevokeShareLinks()
+// サーバーに対して発行済みの共有リンクを全て無効にする。
+func (c *Client) RevokeShareLinks(ctx context.Context, server string) error {
+	return c.do(ctx, http.MethodDelete, "container/share", url.Values{"id": {server}}, nil, nil)
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoCredentials はファイル操作 (WebDAV) に必要なユーザー名とパスワードが設定されていない場合に返される。
+var ErrNoCredentials = errors.New("file operations require username and password (use Login or WithCredentials)")
+
+// MARK: APIError
+// API が返したエラー。/api/v1/ の JSON 形式のエラー ({"error": {...}}) を解釈したもの。
+type APIError struct {
+	StatusCode int             // HTTP ステータスコード
+	Code       string          `json:"code"`    // 機械可読なエラーの種類 (permission_denied, not_found 等)
+	Message    string          `json:"message"` // 人が読むための説明
+	Details    json.RawMessage `json:"details,omitempty"`
+	RequestID  string          `json:"requestId,omitempty"` // サーバーのログと突き合わせるためのリクエスト ID
+
+	// RetryAfter は流量制限 (rate_limited) や操作の待機時間 (cooldown) の場合に、再試行までの待機時間。
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (%d %s, request %s)", e.Message, e.StatusCode, e.Code, e.RequestID)
+	}
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// MARK: IsCode()
+// err が指定した種類の APIError であるかを判定する (例: client.IsCode(err, "not_found"))。
+func IsCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// parseError はエラー応答を APIError へ変換する。JSON 形式でない応答 (リバースプロキシのエラー等) は本文を説明とする。
+func parseError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var envelope struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(b, &envelope) == nil && envelope.Error != nil {
+		envelope.Error.StatusCode = resp.StatusCode
+		apiErr = envelope.Error
+	} else {
+		apiErr.Message = strings.TrimSpace(string(b))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		apiErr.Code = fallbackCode(resp.StatusCode)
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return apiErr
+}
+
+// fallbackCode は JSON 形式でないエラー応答 (WebDAV 等) に、ステータスコードから推定したエラーの種類を割り当てる。
+func fallbackCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "unauthenticated"
+	case http.StatusForbidden:
+		return "permission_denied"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	}
+	if status >= 500 {
+		return "internal"
+	}
+	return "bad_request"
+}
@@ -0,0 +1,421 @@
+package client
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MARK: FileInfo
+// サーバーのファイル (WebDAV の /dav/ 配下) の 1 項目。
+type FileInfo struct {
+	Name    string
+	Path    string // /dav/ からの相対パス (例: "mc/data/server.properties")
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// davURL は /dav/ 配下のパスの URL を組み立てる。パスは "<サーバー名>/<マウント先>/..." の形式。
+func (c *Client) davURL(p string) string {
+	u := *c.baseURL
+	u.Path += "/dav/" + strings.TrimPrefix(path.Clean("/"+p), "/")
+	return u.String()
+}
+
+// davRequest は WebDAV へのリクエストを Basic 認証付きで送信する。成功した場合は応答を返す (呼び出し元で閉じること)。
+func (c *Client) davRequest(ctx context.Context, method, p string, body io.Reader, header http.Header) (*http.Response, error) {
+	c.mu.RLock()
+	username, password := c.username, c.password
+	c.mu.RUnlock()
+	if username == "" {
+		return nil, ErrNoCredentials
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.davURL(p), body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(username, password)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, parseError(resp)
+	}
+	return resp, nil
+}
+
+// davMultistatus は PROPFIND の応答のうち、一覧に必要な項目。
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				DisplayName   string `xml:"displayname"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// MARK: ListFiles()
+// ディレクトリ直下の項目を返す。"" はアクセスできるサーバーの一覧、"<サーバー名>" はそのマウント先の一覧となる。
+func (c *Client) ListFiles(ctx context.Context, dir string) ([]FileInfo, error) {
+	resp, err := c.davRequest(ctx, "PROPFIND", dir+"/", nil, http.Header{"Depth": {"1"}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+
+	self := strings.Trim(path.Clean("/"+dir), "/")
+	var files []FileInfo
+	for _, r := range ms.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			href = r.Href
+		}
+		rel := strings.Trim(strings.TrimPrefix(href, c.baseURL.Path+"/dav"), "/")
+		if rel == self {
+			continue
+		}
+		f := FileInfo{Name: path.Base(rel), Path: rel}
+		for _, ps := range r.Propstat {
+			p := ps.Prop
+			if p.ResourceType.Collection != nil {
+				f.IsDir = true
+			}
+			if n, err := strconv.ParseInt(p.ContentLength, 10, 64); err == nil {
+				f.Size = n
+			}
+			if t, err := http.ParseTime(p.LastModified); err == nil {
+				f.ModTime = t
+			}
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// MARK: Download()
+// ファイルの内容を w へ書き込む。
+func (c *Client) Download(ctx context.Context, p string, w io.Writer) error {
+	resp, err := c.davRequest(ctx, http.MethodGet, p, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// MARK: Upload()
+// r の内容でファイルを作成 (既存の場合は置き換え) する。親ディレクトリは存在している必要がある。
+func (c *Client) Upload(ctx context.Context, p string, r io.Reader) error {
+	resp, err := c.davRequest(ctx, http.MethodPut, p, r, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MARK: Mkdir()
+// ディレクトリを作成する。
+func (c *Client) Mkdir(ctx context.Context, p string) error {
+	resp, err := c.davRequest(ctx, "MKCOL", p, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MARK: Remove()
+// ファイルまたはディレクトリ (中身を含む) を削除する。
+func (c *Client) Remove(ctx context.Context, p string) error {
+	resp, err := c.davRequest(ctx, http.MethodDelete, p, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MARK: Rename()
+// ファイルまたはディレクトリを移動する。移動先に既に存在する場合は置き換える。
+func (c *Client) Rename(ctx context.Context, from, to string) error {
+	header := http.Header{"Destination": {c.davURL(to)}, "Overwrite": {"T"}}
+	resp, err := c.davRequest(ctx, "MOVE", from, nil, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MARK: ResumableUpload
+// 断片に分けて送信し、中断しても続きから再開できるアップロード (/api/files/upload)。
+type ResumableUpload struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"` // サーバーが受信済みのバイト数
+	SHA256    string    `json:"sha256,omitempty"`
+	Complete  bool      `json:"complete"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"` // データを受信しないまま、この時刻を過ぎると破棄される
+}
+
+// MARK: CreateUpload()
+// p ("<サーバー名>/<マウント先>/...") へのアップロードを作成する。sha256 (16 進数) を指定した場合、完了時にファイル全体を照合する。
+func (c *Client) CreateUpload(ctx context.Context, p string, size int64, sha256 string) (ResumableUpload, error) {
+	var u ResumableUpload
+	in := map[string]any{"path": p, "size": size, "sha256": sha256}
+	err := c.do(ctx, http.MethodPost, "/files/upload", nil, in, &u)
+	return u, err
+}
+
+// MARK: GetUpload()
+// アップロードの受信済みのバイト数を返す。再開する際はこの位置から送信する。
+func (c *Client) GetUpload(ctx context.Context, id string) (ResumableUpload, error) {
+	var u ResumableUpload
+	err := c.do(ctx, http.MethodGet, "/files/upload", url.Values{"upload": {id}}, nil, &u)
+	return u, err
+}
+
+// MARK: UploadChunk()
+// offset からの断片を送信する。offset はサーバーが受信済みのバイト数と一致している必要がある (異なる場合は 409)。
+func (c *Client) UploadChunk(ctx context.Context, id string, offset int64, r io.Reader) (ResumableUpload, error) {
+	var u ResumableUpload
+	req, err := c.newRequest(ctx, http.MethodPatch, c.endpoint("/files/upload", url.Values{"upload": {id}}), r)
+	if err != nil {
+		return u, err
+	}
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return u, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return u, parseError(resp)
+	}
+	return u, json.NewDecoder(resp.Body).Decode(&u)
+}
+
+// MARK: AbortUpload()
+// アップロードを中止し、受信済みのデータを破棄させる。
+func (c *Client) AbortUpload(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/files/upload", url.Values{"upload": {id}}, nil, nil)
+}
+
+// MARK: ResumeUpload()
+// サーバーが受信済みの位置から r の残りを chunkSize ごとに送信し、完了したアップロードを返す。
+// 断片の送信に失敗した場合は受信済みの位置を問い合わせ直し、maxRetries 回まで続きから再送する。
+// 照合・検証の失敗や権限の不足等、再送しても成功しないエラー (409 以外の 4xx) はそのまま返す。
+func (c *Client) ResumeUpload(ctx context.Context, id string, r io.ReaderAt, chunkSize int64, maxRetries int) (ResumableUpload, error) {
+	u, err := c.GetUpload(ctx, id)
+	if err != nil {
+		return u, err
+	}
+	for retries := 0; !u.Complete; {
+		n := min(chunkSize, u.Size-u.Offset)
+		next, err := c.UploadChunk(ctx, id, u.Offset, io.NewSectionReader(r, u.Offset, n))
+		if err == nil {
+			u = next
+			continue
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusConflict && apiErr.StatusCode != http.StatusTooManyRequests {
+			return u, err
+		}
+		if retries++; retries > maxRetries || ctx.Err() != nil {
+			return u, err
+		}
+		if u, err = c.GetUpload(ctx, id); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// MARK: SyncFile
+// 同期のマニフェストの 1 ファイル分。Path は同期先のディレクトリからの相対パス ("/" 区切り)。
+type SyncFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// MARK: SyncOptions
+type SyncOptions struct {
+	Delete  bool     `json:"delete"`            // マニフェストに無いファイルを削除する
+	Exclude []string `json:"exclude,omitempty"` // 比較と削除の対象外とするパターン ("/" を含まない場合はファイル名と照合)
+}
+
+// MARK: SyncPlan
+// 同期の計画。Upload のファイルを ApplySync で送信すると、Delete のファイルの削除と合わせて適用される。
+type SyncPlan struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Upload    []string  `json:"upload"`
+	Delete    []string  `json:"delete"`
+	Unchanged int       `json:"unchanged"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// MARK: SyncResult
+type SyncResult struct {
+	ID        string   `json:"id"`
+	Path      string   `json:"path"`
+	Updated   []string `json:"updated"`
+	Deleted   []string `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// MARK: PlanSync()
+// p ("<サーバー名>/<マウント先>/...") のディレクトリとマニフェストを比較し、送信が必要なファイルと削除するファイルを返す。
+func (c *Client) PlanSync(ctx context.Context, p string, files []SyncFile, opts SyncOptions) (SyncPlan, error) {
+	var plan SyncPlan
+	in := map[string]any{"path": p, "files": files, "delete": opts.Delete, "exclude": opts.Exclude}
+	err := c.do(ctx, http.MethodPost, "/files/sync", nil, in, &plan)
+	return plan, err
+}
+
+// MARK: ApplySync()
+// 計画で送信を求められたファイルを tar で送信し、同期を適用する。送信するファイルが無い場合 (削除のみ) は r に nil を指定できる。
+func (c *Client) ApplySync(ctx context.Context, id string, r io.Reader) (SyncResult, error) {
+	var result SyncResult
+	if r == nil {
+		r = http.NoBody
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, c.endpoint("/files/sync", url.Values{"sync": {id}}), r)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return result, parseError(resp)
+	}
+	return result, json.NewDecoder(resp.Body).Decode(&result)
+}
+
+// MARK: AbortSync()
+// 適用していない計画を破棄する。
+func (c *Client) AbortSync(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/files/sync", url.Values{"sync": {id}}, nil, nil)
+}
+
+// MARK: SyncDir()
+// ローカルのディレクトリ dir の内容を p へ同期する。マニフェストの作成・計画・差分の tar の送信をまとめて行う。
+// dryRun の場合は計画のみを作成して破棄し、適用はしない。シンボリックリンク等の通常のファイル以外は同期しない。
+func (c *Client) SyncDir(ctx context.Context, dir, p string, opts SyncOptions, dryRun bool) (SyncPlan, SyncResult, error) {
+	var files []SyncFile
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		sum, size, err := hashFile(name)
+		if err != nil {
+			return err
+		}
+		files = append(files, SyncFile{Path: filepath.ToSlash(rel), SHA256: sum, Size: size})
+		return nil
+	})
+	if err != nil {
+		return SyncPlan{}, SyncResult{}, err
+	}
+	plan, err := c.PlanSync(ctx, p, files, opts)
+	if err != nil || dryRun {
+		if err == nil {
+			err = c.AbortSync(ctx, plan.ID)
+		}
+		return plan, SyncResult{}, err
+	}
+
+	// 差分の tar はファイルを読みながら生成し、全体をメモリや一時ファイルに置かずに送信する。
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeSyncTar(pw, dir, plan.Upload))
+	}()
+	result, err := c.ApplySync(ctx, plan.ID, pr)
+	pr.Close()
+	return plan, result, err
+}
+
+// writeSyncTar は dir 内の相対パスのファイルを tar として書き出す。
+func writeSyncTar(w io.Writer, dir string, paths []string) error {
+	tw := tar.NewWriter(w)
+	for _, rel := range paths {
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err == nil {
+			err = tw.WriteHeader(&tar.Header{Name: rel, Mode: int64(info.Mode().Perm()), Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg})
+		}
+		if err == nil {
+			_, err = io.Copy(tw, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// hashFile はファイルの SHA-256 (16 進数) と大きさを返す。
+func hashFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const propfindResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<D:multistatus xmlns:D="DAV:">
+  <D:response>
+    <D:href>/dav/mc/data/</D:href>
+    <D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop></D:propstat>
+  </D:response>
+  <D:response>
+    <D:href>/dav/mc/data/server.properties</D:href>
+    <D:propstat><D:prop>
+      <D:getcontentlength>42</D:getcontentlength>
+      <D:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</D:getlastmodified>
+      <D:resourcetype/>
+    </D:prop></D:propstat>
+  </D:response>
+  <D:response>
+    <D:href>/dav/mc/data/world%20nether/</D:href>
+    <D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop></D:propstat>
+  </D:response>
+</D:multistatus>`
+
+// fakeDAV は Basic 認証を要求し、/dav/mc/data/ 配下のみを提供するテスト用の WebDAV。
+func fakeDAV(t *testing.T, files map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		p := strings.TrimPrefix(r.URL.Path, "/dav/")
+		if !strings.HasPrefix(p, "mc/") {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case "PROPFIND":
+			if r.Header.Get("Depth") != "1" {
+				t.Errorf("Depth = %q", r.Header.Get("Depth"))
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			io.WriteString(w, propfindResponse)
+		case http.MethodGet:
+			content, ok := files[p]
+			if !ok {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, content)
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			files[p] = string(b)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func TestListFiles(t *testing.T) {
+	c := newTestClient(t, fakeDAV(t, nil), WithCredentials("alice", "secret"))
+	files, err := c.ListFiles(context.Background(), "mc/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 一覧の対象のディレクトリ自身は含まない。
+	if len(files) != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+	if f := files[0]; f.Name != "server.properties" || f.Path != "mc/data/server.properties" || f.Size != 42 || f.IsDir || f.ModTime.Year() != 2006 {
+		t.Errorf("files[0] = %+v", f)
+	}
+	if f := files[1]; f.Name != "world nether" || !f.IsDir {
+		t.Errorf("files[1] = %+v", f)
+	}
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	files := map[string]string{}
+	c := newTestClient(t, fakeDAV(t, files), WithCredentials("alice", "secret"))
+	ctx := context.Background()
+
+	if err := c.Upload(ctx, "mc/data/ops.json", strings.NewReader(`["alice"]`)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.Download(ctx, "/mc/data/../data/ops.json", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `["alice"]` {
+		t.Errorf("content = %q", buf.String())
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	ctx := context.Background()
+
+	noCreds := newTestClient(t, fakeDAV(t, nil), WithToken("t"))
+	if _, err := noCreds.ListFiles(ctx, "mc"); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("ListFiles without credentials: err = %v, want ErrNoCredentials", err)
+	}
+
+	wrong := newTestClient(t, fakeDAV(t, nil), WithCredentials("alice", "wrong"))
+	if _, err := wrong.ListFiles(ctx, "mc"); !IsCode(err, "unauthenticated") {
+		t.Errorf("ListFiles with wrong password: err = %v, want unauthenticated", err)
+	}
+
+	c := newTestClient(t, fakeDAV(t, map[string]string{}), WithCredentials("alice", "secret"))
+	if err := c.Download(ctx, "mc/data/missing.txt", io.Discard); !IsCode(err, "not_found") {
+		t.Errorf("Download of missing file: err = %v, want not_found", err)
+	}
+	err := c.Upload(ctx, "other/data/a.txt", strings.NewReader("x"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "permission_denied" || apiErr.StatusCode != http.StatusForbidden || apiErr.Message != "Forbidden" {
+		t.Errorf("Upload outside permitted server: err = %v, want permission_denied", err)
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// JobStatus はジョブの状態。
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// MARK: Job
+// コンテナに対する 1 回の操作 (起動、停止、バックアップ等) の進行状況。
+type Job struct {
+	ID         string    `json:"id"`
+	Server     string    `json:"server"`
+	Action     string    `json:"action"`
+	Status     JobStatus `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	Log        []string  `json:"log,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	User       string    `json:"user,omitempty"` // 操作したユーザー
+	Via        string    `json:"via,omitempty"`  // 操作の経路 (http, grpc, discord, schedule, autoshutdown, wake)
+	// Restore はリストアの結果。中断・失敗した場合は Snapshot の世代から復元前の状態へ戻せる。
+	Restore *struct {
+		Generation string `json:"generation"`
+		Snapshot   string `json:"snapshot,omitempty"`
+		Files      int64  `json:"files"`
+		Bytes      int64  `json:"bytes"`
+	} `json:"restore,omitempty"`
+	Cancelable bool `json:"cancelable,omitempty"` // CancelJob で中断できる
+}
+
+// JobFilter はジョブ一覧の絞り込み条件。空の項目は条件としない。
+type JobFilter struct {
+	ID        string
+	Server    string
+	RequestID string
+}
+
+// MARK: ListJobs()
+// 閲覧権限のあるサーバーの直近のジョブを新しい順で返す。
+func (c *Client) ListJobs(ctx context.Context, filter JobFilter) ([]Job, error) {
+	q := url.Values{}
+	if filter.ID != "" {
+		q.Set("id", filter.ID)
+	}
+	if filter.Server != "" {
+		q.Set("server", filter.Server)
+	}
+	if filter.RequestID != "" {
+		q.Set("requestId", filter.RequestID)
+	}
+	var jobs []Job
+	err := c.do(ctx, http.MethodGet, "jobs", q, nil, &jobs)
+	return jobs, err
+}
+
+// MARK: GetJob()
+// 指定 ID のジョブを返す。存在しない (または閲覧権限が無い) 場合は not_found の APIError を返す。
+func (c *Client) GetJob(ctx context.Context, id string) (Job, error) {
+	jobs, err := c.ListJobs(ctx, JobFilter{ID: id})
+	if err != nil {
+		return Job{}, err
+	}
+	if len(jobs) == 0 {
+		return Job{}, &APIError{StatusCode: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("job %q not found", id)}
+	}
+	return jobs[0], nil
+}
+
+// MARK: CancelJob()
+// 実行中のジョブ (リストア等、Cancelable のジョブ) の中断を要求する。ジョブは処理を止めた時点で失敗として完了する。
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "jobs", url.Values{"id": {id}}, nil, nil)
+}
+
+// 操作の種類。
+const (
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionKill    = "kill"
+	ActionBackup  = "backup"
+	ActionRestore = "restore"
+	ActionRemove  = "remove"
+)
+
+// ActionOptions は RunAction の追加の指定。
+type ActionOptions struct {
+	// Generation は restore で復元する世代 (ListBackups で取得)。
+	Generation string
+	// WaitReady は start の完了を、コンテナの起動ではなくサーバーの準備完了 (ready 設定) まで待つ。
+	WaitReady bool
+	// OnProgress はジョブの状態や進捗ログが変化するたびに呼び出される。
+	OnProgress func(Job)
+}
+
+// MARK: RunAction()
+// サーバーへの操作 (ActionStart 等) を実行し、完了したジョブを返す。
+// 操作の応答を待つ間、付与したリクエスト ID でジョブを定期的に取得し、進捗を OnProgress へ通知する。
+// 操作が失敗した場合は、失敗したジョブ (取得できた場合) とエラーを返す。
+func (c *Client) RunAction(ctx context.Context, server, action string, opts *ActionOptions) (Job, error) {
+	if opts == nil {
+		opts = &ActionOptions{}
+	}
+	q := url.Values{"id": {server}}
+	if action == ActionRestore {
+		q.Set("generation", opts.Generation)
+	}
+	if action == ActionStart && opts.WaitReady {
+		q.Set("wait", "ready")
+	}
+	requestID := newRequestID()
+	header := http.Header{"X-Request-Id": {requestID}}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.doResponse(ctx, http.MethodPost, "container/"+action, q, header, nil, nil)
+		done <- err
+	}()
+
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last Job
+	poll := func() {
+		jobs, err := c.ListJobs(ctx, JobFilter{Server: server, RequestID: requestID})
+		if err != nil || len(jobs) == 0 {
+			return
+		}
+		job := jobs[0]
+		if job.Status == last.Status && slices.Equal(job.Log, last.Log) {
+			return
+		}
+		last = job
+		if opts.OnProgress != nil {
+			opts.OnProgress(job)
+		}
+	}
+	for {
+		select {
+		case err := <-done:
+			// 応答の時点でジョブは完了しているため、最終状態を取得する。
+			poll()
+			if err == nil && last.Status == JobFailed {
+				err = fmt.Errorf("%s failed: %s", action, last.Error)
+			}
+			return last, err
+		case <-ticker.C:
+			poll()
+		}
+	}
+}
+
+// BulkResult は RunBulkAction のサーバーごとの結果。
+type BulkResult struct {
+	Server string `json:"server"`
+	Error  string `json:"error,omitempty"` // 成功した場合は空
+}
+
+// MARK: RunBulkAction()
+// タグがパターン (例: "events", "survival-*") に一致する全てのサーバーへ同じ操作を並行して実行し、完了後にサーバーごとの結果を返す。
+// 一部のサーバーの失敗 (権限がない場合を含む) は結果の Error に含め、err とはしない。
+func (c *Client) RunBulkAction(ctx context.Context, tag, action string, opts *ActionOptions) ([]BulkResult, error) {
+	q := url.Values{"id": {"tag:" + tag}}
+	if action == ActionStart && opts != nil && opts.WaitReady {
+		q.Set("wait", "ready")
+	}
+	var resp struct {
+		Results []BulkResult `json:"results"`
+	}
+	err := c.do(ctx, http.MethodPost, "container/"+action, q, nil, &resp)
+	return resp.Results, err
+}
+
+// newRequestID は操作とジョブを突き合わせるためのリクエスト ID を生成する。
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
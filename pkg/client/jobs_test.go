@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJobs は操作の完了までの間、ジョブを実行中として返すテスト用の API。
+type fakeJobs struct {
+	mu        sync.Mutex
+	requestID string
+	job       Job
+	polled    chan struct{} // 実行中のジョブが取得されると閉じる
+	once      sync.Once
+}
+
+func (f *fakeJobs) handler(t *testing.T, result JobStatus, jobErr string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/container/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "mc" || r.URL.Query().Get("wait") != "ready" {
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+		f.mu.Lock()
+		f.requestID = r.Header.Get("X-Request-Id")
+		f.job = Job{ID: "job-1", Server: "mc", Action: ActionStart, Status: JobRunning, Log: []string{"starting"}, RequestID: f.requestID}
+		f.mu.Unlock()
+
+		// 応答を待つ間の進捗の取得を確認してから完了する。
+		select {
+		case <-f.polled:
+		case <-time.After(5 * time.Second):
+			t.Error("job was not polled while the action was running")
+		}
+		f.mu.Lock()
+		f.job.Status, f.job.Error = result, jobErr
+		f.job.Log = append(f.job.Log, "done")
+		f.mu.Unlock()
+	})
+	mux.HandleFunc("GET /api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		jobs := []Job{}
+		if f.requestID != "" && r.URL.Query().Get("requestId") == f.requestID && r.URL.Query().Get("server") == "mc" {
+			jobs = append(jobs, f.job)
+			if f.job.Status == JobRunning {
+				f.once.Do(func() { close(f.polled) })
+			}
+		}
+		json.NewEncoder(w).Encode(jobs)
+	})
+	return mux
+}
+
+func TestRunActionPollsJob(t *testing.T) {
+	f := &fakeJobs{polled: make(chan struct{})}
+	c := newTestClient(t, f.handler(t, JobSucceeded, ""), WithToken("t"))
+	c.PollInterval = 10 * time.Millisecond
+
+	var progress []JobStatus
+	job, err := c.RunAction(context.Background(), "mc", ActionStart, &ActionOptions{
+		WaitReady:  true,
+		OnProgress: func(j Job) { progress = append(progress, j.Status) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "job-1" || job.Status != JobSucceeded || len(job.Log) != 2 {
+		t.Errorf("job = %+v", job)
+	}
+	if len(progress) != 2 || progress[0] != JobRunning || progress[1] != JobSucceeded {
+		t.Errorf("progress = %v, want [running succeeded]", progress)
+	}
+}
+
+func TestRunActionReportsFailedJob(t *testing.T) {
+	f := &fakeJobs{polled: make(chan struct{})}
+	c := newTestClient(t, f.handler(t, JobFailed, "pre hook failed"), WithToken("t"))
+	c.PollInterval = 10 * time.Millisecond
+
+	job, err := c.RunAction(context.Background(), "mc", ActionStart, &ActionOptions{WaitReady: true})
+	if err == nil || !strings.Contains(err.Error(), "pre hook failed") {
+		t.Fatalf("err = %v, want the job error", err)
+	}
+	if job.Status != JobFailed {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestGetJobNotFound(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Job{})
+	})
+	c := newTestClient(t, mux, WithToken("t"))
+	if _, err := c.GetJob(context.Background(), "missing"); !IsCode(err, "not_found") {
+		t.Errorf("err = %v, want not_found", err)
+	}
+}
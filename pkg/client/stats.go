@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// MARK: Stats
+// サーバーが Docker の統計情報から算出した、コンテナのリソース使用量。
+type Stats struct {
+	CPUPercent     float64 `json:"cpu_percent"`    // 1 コア = 100% 換算の CPU 使用率
+	OnlineCPUs     uint32  `json:"online_cpus"`    // コンテナから見える CPU 数
+	MemoryUsage    uint64  `json:"memory_usage"`   // ページキャッシュを除いた実使用量 (bytes)
+	MemoryLimit    uint64  `json:"memory_limit"`   // メモリ上限 (bytes)
+	MemoryPercent  float64 `json:"memory_percent"` // 上限に対する使用率
+	NetworkRx      uint64  `json:"network_rx"`
+	NetworkTx      uint64  `json:"network_tx"`
+	NetworkRxRate  float64 `json:"network_rx_rate"` // bytes/sec
+	NetworkTxRate  float64 `json:"network_tx_rate"`
+	BlockRead      uint64  `json:"block_read"`
+	BlockWrite     uint64  `json:"block_write"`
+	BlockReadRate  float64 `json:"block_read_rate"`
+	BlockWriteRate float64 `json:"block_write_rate"`
+}
+
+// StatsSample はストリームで受信した 1 回分の統計情報。
+type StatsSample struct {
+	Time time.Time // Docker が統計情報を取得した時刻 (状態の通知では通知した時刻)
+	// State はコンテナの状態 (running / stopped / missing / unavailable)。running 以外では Stats と Host は空となる。
+	State string
+	Stats Stats
+	// Host はホスト全体の CPU・メモリの使用状況。
+	Host struct {
+		CPUPercent        float64 `json:"cpu_percent"`
+		MemoryUsed        uint64  `json:"memory_used"`
+		MemoryTotal       uint64  `json:"memory_total"`
+		MemoryUsedPercent float64 `json:"memory_used_percent"`
+	}
+}
+
+// MARK: StreamStats()
+// コンテナの統計情報を WebSocket で購読し、受信するたび (約 1 秒間隔) に fn を呼び出す。
+// 停止中・未作成の間は状態の変化のみを通知し、コンテナが起動すると同じ接続で統計情報の受信を再開する。
+// ctx がキャンセルされるか、fn がエラーを返すか、接続が切断されるまで戻らない。ctx のキャンセルで終了した場合は nil を返す。
+func (c *Client) StreamStats(ctx context.Context, server string, fn func(StatsSample) error) error {
+	conn, err := c.dialWS(ctx, "/ws/stats", url.Values{"id": {server}})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var msg struct {
+			Type     string          `json:"type"`
+			State    string          `json:"state"`
+			Time     time.Time       `json:"time"`
+			Read     time.Time       `json:"read"`
+			Computed Stats           `json:"computed"`
+			OSStats  json.RawMessage `json:"os_stats"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+		sample := StatsSample{Time: msg.Read, State: "running", Stats: msg.Computed}
+		if msg.Type == "state" {
+			// 稼働中への遷移は、直後の統計情報のフレームで通知する。
+			if msg.State == "running" {
+				continue
+			}
+			sample = StatsSample{Time: msg.Time, State: msg.State}
+		} else if len(msg.OSStats) > 0 {
+			json.Unmarshal(msg.OSStats, &sample.Host)
+		}
+		if err := fn(sample); err != nil {
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// ErrStopStream を StreamStats・StreamOverview の fn から返すと、エラーとせずに購読を終了する。
+var ErrStopStream = errors.New("stop stream")
+
+// MARK: Overview
+// ホスト全体と、閲覧できる全ての管理対象サーバーの状態をまとめた 1 回分の概要。
+type Overview struct {
+	Time time.Time `json:"time"`
+	// Host はホスト全体の CPU・メモリ・ディスク (play-bin の作業ディレクトリを含むファイルシステム) の使用状況。
+	Host struct {
+		CPUPercent        float64 `json:"cpu_percent"`
+		MemoryUsed        uint64  `json:"memory_used"`
+		MemoryTotal       uint64  `json:"memory_total"`
+		MemoryUsedPercent float64 `json:"memory_used_percent"`
+		DiskUsed          uint64  `json:"disk_used"`
+		DiskTotal         uint64  `json:"disk_total"`
+		DiskUsedPercent   float64 `json:"disk_used_percent"`
+	} `json:"host"`
+	Servers []OverviewServer `json:"servers"`
+}
+
+// OverviewServer は概要に含まれるサーバー 1 件の状態。Stats は起動中のコンテナで取得できた場合のみ設定される。
+type OverviewServer struct {
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"startedAt"`
+	Stats     *Stats    `json:"stats"`
+}
+
+// MARK: StreamOverview()
+// ホストと全サーバーの概要を WebSocket で購読し、interval ごと (0 の場合はサーバーの既定値) に fn を呼び出す。
+// 終了の条件は StreamStats と同じ。
+func (c *Client) StreamOverview(ctx context.Context, interval time.Duration, fn func(Overview) error) error {
+	q := url.Values{}
+	if interval > 0 {
+		q.Set("interval", strconv.Itoa(int(max(interval, time.Second)/time.Second)))
+	}
+	conn, err := c.dialWS(ctx, "/ws/overview", q)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var msg Overview
+		if err := conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(msg); err != nil {
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MARK: User
+// 設定に定義されたユーザー。パスワードはサーバー側で伏せられるため含まない。
+type User struct {
+	Discord     string              `json:"discord,omitempty"`
+	Permissions map[string][]string `json:"permissions"` // サーバー名 ("*" は全サーバー) ごとの権限
+}
+
+// WriteResult は API による設定の変更結果。
+type WriteResult struct {
+	File   string        `json:"file"`             // 書き込んだファイル
+	Backup string        `json:"backup,omitempty"` // 変更前の内容のバックアップ
+	Issues []ConfigIssue `json:"issues"`           // 検証で見つかった問題 (警告を含む)
+}
+
+// MARK: ListUsers()
+// 現在適用されている設定のユーザーを返す。config.read 権限が必要。
+func (c *Client) ListUsers(ctx context.Context) (map[string]User, error) {
+	var cfg struct {
+		Users map[string]User `json:"users"`
+	}
+	err := c.do(ctx, http.MethodGet, "config", nil, nil, &cfg)
+	return cfg.Users, err
+}
+
+// MARK: PatchUser()
+// ユーザー定義に JSON Merge Patch を適用する (存在しない場合は作成する)。patch が nil の場合はユーザーを削除する。config.write 権限が必要。
+// permissions のサーバーごとの配列は置き換えとなる。変更後の設定に検証エラーがある場合は、Details に検証結果を含む invalid_config の APIError を返す。
+func (c *Client) PatchUser(ctx context.Context, name string, patch any) (WriteResult, error) {
+	if patch == nil {
+		// 本文全体を null とすることで削除を表す。
+		patch = json.RawMessage("null")
+	}
+	var result WriteResult
+	err := c.do(ctx, http.MethodPatch, "config/users", url.Values{"user": {name}}, patch, &result)
+	return result, err
+}
+
+// MARK: DeleteUser()
+// ユーザーを設定から削除する。
+func (c *Client) DeleteUser(ctx context.Context, name string) error {
+	_, err := c.PatchUser(ctx, name, nil)
+	return err
+}
+
+// MARK: Profile
+// ログイン中のユーザー自身の情報。
+type Profile struct {
+	Username    string              `json:"username"`
+	Discord     string              `json:"discord,omitempty"`
+	Permissions map[string][]string `json:"permissions"` // 設定に記述された権限 (ワイルドカードを含む)
+	Servers     map[string][]string `json:"servers"`     // サーバーごとに実際に許可される権限 ("*" は全サーバーに対する付与)
+	Grants      []Grant             `json:"grants,omitempty"`
+}
+
+// MARK: Me()
+// ログイン中のユーザーの情報と、サーバーごとの実効的な権限を返す。
+func (c *Client) Me(ctx context.Context) (Profile, error) {
+	var p Profile
+	err := c.do(ctx, http.MethodGet, "me", nil, nil, &p)
+	return p, err
+}
+
+// MARK: ChangePassword()
+// 自身のパスワードを変更する。現在のパスワードが一致しない場合は invalid_credentials の APIError を返す。
+// 変更後は、このクライアントのセッションを除く同じユーザーのセッションが無効になる。
+func (c *Client) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+	err := c.do(ctx, http.MethodPost, "me/password", nil, map[string]string{"oldPassword": oldPassword, "newPassword": newPassword}, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.password != "" {
+		c.password = newPassword
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// MARK: Grant
+// 期限付きで付与された権限。
+type Grant struct {
+	ID          string    `json:"id"`
+	User        string    `json:"user"`
+	Server      string    `json:"server"` // "*" は全サーバー
+	Permissions []string  `json:"permissions"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// MARK: ListGrants()
+// 有効な期限付きの権限を期限の近い順で返す。user / server が空でない場合はそれで絞り込む。admin.grants 権限が必要。
+func (c *Client) ListGrants(ctx context.Context, user, server string) ([]Grant, error) {
+	q := url.Values{}
+	if user != "" {
+		q.Set("user", user)
+	}
+	if server != "" {
+		q.Set("server", server)
+	}
+	var grants []Grant
+	err := c.do(ctx, http.MethodGet, "admin/grants", q, nil, &grants)
+	return grants, err
+}
+
+// MARK: CreateGrant()
+// ユーザーへサーバーに対する権限を duration の間だけ付与する (最長 30 日)。期限を過ぎると自動的に失効する。
+func (c *Client) CreateGrant(ctx context.Context, user, server string, permissions []string, duration time.Duration, reason string) (Grant, error) {
+	req := map[string]any{
+		"user": user, "server": server, "permissions": permissions,
+		"duration": duration.String(), "reason": reason,
+	}
+	var grant Grant
+	err := c.do(ctx, http.MethodPost, "admin/grants", nil, req, &grant)
+	return grant, err
+}
+
+// MARK: RevokeGrant()
+// 期限付きの権限を期限前に取り消す。
+func (c *Client) RevokeGrant(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "admin/grants", url.Values{"id": {id}}, nil, nil)
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWS は WebSocket の端点 (例: "/ws/stats") へ接続する。
+// WebSocket の接続ではヘッダーを扱えないブラウザと共通の仕様として、セッショントークンの代わりに使い捨てのチケットをクエリで渡す。
+func (c *Client) dialWS(ctx context.Context, path string, q url.Values) (*websocket.Conn, error) {
+	var ticket struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := c.do(ctx, http.MethodPost, "ws-ticket", url.Values{"id": {q.Get("id")}}, map[string]string{"endpoint": path}, &ticket); err != nil {
+		return nil, err
+	}
+
+	u := *c.baseURL
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path += path
+	q.Set("ticket", ticket.Ticket)
+	u.RawQuery = q.Encode()
+
+	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment}
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 400 {
+			return nil, parseError(resp)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
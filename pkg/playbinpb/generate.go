@@ -0,0 +1,5 @@
+// Package playbinpb は proto/playbin/v1/playbin.proto から生成した、gRPC 管理 API のメッセージ型とクライアントを提供する。
+// 外部のツールはこのパッケージ (または proto 定義から各言語向けに生成したコード) で型付きのクライアントを利用できる。
+package playbinpb
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/play-bin --go-grpc_out=../.. --go-grpc_opt=module=github.com/play-bin playbin/v1/playbin.proto
@@ -0,0 +1,1109 @@
+// play-bin の管理 API (gRPC)。
+// HTTP API と同じセッショントークン・権限で、コンテナの一覧と操作、ジョブの参照、統計情報のストリーミングを提供する。
+// Login 以外の呼び出しには、メタデータ authorization にトークン (先頭の "Bearer " は省略可) を付与する。
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: playbin/v1/playbin.proto
+
+package playbinpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type JobStatus int32
+
+const (
+	JobStatus_JOB_STATUS_UNSPECIFIED JobStatus = 0
+	JobStatus_JOB_STATUS_RUNNING     JobStatus = 1
+	JobStatus_JOB_STATUS_SUCCEEDED   JobStatus = 2
+	JobStatus_JOB_STATUS_FAILED      JobStatus = 3
+)
+
+// Enum value maps for JobStatus.
+var (
+	JobStatus_name = map[int32]string{
+		0: "JOB_STATUS_UNSPECIFIED",
+		1: "JOB_STATUS_RUNNING",
+		2: "JOB_STATUS_SUCCEEDED",
+		3: "JOB_STATUS_FAILED",
+	}
+	JobStatus_value = map[string]int32{
+		"JOB_STATUS_UNSPECIFIED": 0,
+		"JOB_STATUS_RUNNING":     1,
+		"JOB_STATUS_SUCCEEDED":   2,
+		"JOB_STATUS_FAILED":      3,
+	}
+)
+
+func (x JobStatus) Enum() *JobStatus {
+	p := new(JobStatus)
+	*p = x
+	return p
+}
+
+func (x JobStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_playbin_v1_playbin_proto_enumTypes[0].Descriptor()
+}
+
+func (JobStatus) Type() protoreflect.EnumType {
+	return &file_playbin_v1_playbin_proto_enumTypes[0]
+}
+
+func (x JobStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobStatus.Descriptor instead.
+func (JobStatus) EnumDescriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{0}
+}
+
+type LoginRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginRequest) Reset() {
+	*x = LoginRequest{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRequest) ProtoMessage() {}
+
+func (x *LoginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRequest.ProtoReflect.Descriptor instead.
+func (*LoginRequest) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LoginRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type LoginResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginResponse) Reset() {
+	*x = LoginResponse{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginResponse) ProtoMessage() {}
+
+func (x *LoginResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginResponse.ProtoReflect.Descriptor instead.
+func (*LoginResponse) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LoginResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type ListContainersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 空でない場合は、いずれかの状態 (running, exited, missing, unreachable 等) に一致するもののみ。
+	States []string `protobuf:"bytes,1,rep,name=states,proto3" json:"states,omitempty"`
+	// 空でない場合は、名前にこの文字列を含むもののみ (大文字・小文字は区別しない)。
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// 起動中のコンテナに統計情報を付与する。
+	Stats         bool `protobuf:"varint,3,opt,name=stats,proto3" json:"stats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListContainersRequest) Reset() {
+	*x = ListContainersRequest{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListContainersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListContainersRequest) ProtoMessage() {}
+
+func (x *ListContainersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListContainersRequest.ProtoReflect.Descriptor instead.
+func (*ListContainersRequest) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListContainersRequest) GetStates() []string {
+	if x != nil {
+		return x.States
+	}
+	return nil
+}
+
+func (x *ListContainersRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ListContainersRequest) GetStats() bool {
+	if x != nil {
+		return x.Stats
+	}
+	return false
+}
+
+type ListContainersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Containers    []*Container           `protobuf:"bytes,1,rep,name=containers,proto3" json:"containers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListContainersResponse) Reset() {
+	*x = ListContainersResponse{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListContainersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListContainersResponse) ProtoMessage() {}
+
+func (x *ListContainersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListContainersResponse.ProtoReflect.Descriptor instead.
+func (*ListContainersResponse) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListContainersResponse) GetContainers() []*Container {
+	if x != nil {
+		return x.Containers
+	}
+	return nil
+}
+
+type Container struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 設定に定義されたサーバーはサーバー名、それ以外はコンテナ ID。
+	Id   string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// dockerHosts 名。既定のホストは空文字。
+	Host  string `protobuf:"bytes,3,opt,name=host,proto3" json:"host,omitempty"`
+	State string `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	// 実行可能な操作 (start, stop, kill, backup, restore, remove)。
+	Actions     []string `protobuf:"bytes,5,rep,name=actions,proto3" json:"actions,omitempty"`
+	Permissions []string `protobuf:"bytes,6,rep,name=permissions,proto3" json:"permissions,omitempty"`
+	// 起動中かつ stats を指定した場合のみ。
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	Stats         *ContainerStats        `protobuf:"bytes,8,opt,name=stats,proto3" json:"stats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Container) Reset() {
+	*x = Container{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Container) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Container) ProtoMessage() {}
+
+func (x *Container) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Container.ProtoReflect.Descriptor instead.
+func (*Container) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Container) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Container) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Container) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Container) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Container) GetActions() []string {
+	if x != nil {
+		return x.Actions
+	}
+	return nil
+}
+
+func (x *Container) GetPermissions() []string {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+func (x *Container) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Container) GetStats() *ContainerStats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+type RunActionRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Server string                 `protobuf:"bytes,1,opt,name=server,proto3" json:"server,omitempty"`
+	// start, stop, kill, backup, restore, remove のいずれか。
+	Action string `protobuf:"bytes,2,opt,name=action,proto3" json:"action,omitempty"`
+	// restore の場合に復元する世代。
+	Generation    string `protobuf:"bytes,3,opt,name=generation,proto3" json:"generation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunActionRequest) Reset() {
+	*x = RunActionRequest{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunActionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunActionRequest) ProtoMessage() {}
+
+func (x *RunActionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunActionRequest.ProtoReflect.Descriptor instead.
+func (*RunActionRequest) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RunActionRequest) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *RunActionRequest) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *RunActionRequest) GetGeneration() string {
+	if x != nil {
+		return x.Generation
+	}
+	return ""
+}
+
+type Job struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Id         string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Server     string                 `protobuf:"bytes,2,opt,name=server,proto3" json:"server,omitempty"`
+	Action     string                 `protobuf:"bytes,3,opt,name=action,proto3" json:"action,omitempty"`
+	Status     JobStatus              `protobuf:"varint,4,opt,name=status,proto3,enum=playbin.v1.JobStatus" json:"status,omitempty"`
+	Error      string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	StartedAt  *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	Log        []string               `protobuf:"bytes,8,rep,name=log,proto3" json:"log,omitempty"`
+	// ジョブを開始した操作のリクエスト ID。
+	RequestId     string `protobuf:"bytes,9,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *Job) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() JobStatus {
+	if x != nil {
+		return x.Status
+	}
+	return JobStatus_JOB_STATUS_UNSPECIFIED
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Job) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Job) GetLog() []string {
+	if x != nil {
+		return x.Log
+	}
+	return nil
+}
+
+func (x *Job) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type ListJobsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 空でない場合は、このサーバーのジョブのみ。
+	Server        string `protobuf:"bytes,1,opt,name=server,proto3" json:"server,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsRequest) Reset() {
+	*x = ListJobsRequest{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsRequest) ProtoMessage() {}
+
+func (x *ListJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsRequest.ProtoReflect.Descriptor instead.
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListJobsRequest) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+type ListJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsResponse) Reset() {
+	*x = ListJobsResponse{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsResponse) ProtoMessage() {}
+
+func (x *ListJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsResponse.ProtoReflect.Descriptor instead.
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListJobsResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WatchJobsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 空でない場合は、このサーバーのジョブのみ。
+	Server        string `protobuf:"bytes,1,opt,name=server,proto3" json:"server,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchJobsRequest) Reset() {
+	*x = WatchJobsRequest{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchJobsRequest) ProtoMessage() {}
+
+func (x *WatchJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchJobsRequest.ProtoReflect.Descriptor instead.
+func (*WatchJobsRequest) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WatchJobsRequest) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+type StreamStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Server        string                 `protobuf:"bytes,1,opt,name=server,proto3" json:"server,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamStatsRequest) Reset() {
+	*x = StreamStatsRequest{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamStatsRequest) ProtoMessage() {}
+
+func (x *StreamStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamStatsRequest.ProtoReflect.Descriptor instead.
+func (*StreamStatsRequest) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *StreamStatsRequest) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+type ContainerStats struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Time  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// 1 コア = 100% 換算の CPU 使用率。
+	CpuPercent float64 `protobuf:"fixed64,2,opt,name=cpu_percent,json=cpuPercent,proto3" json:"cpu_percent,omitempty"`
+	OnlineCpus uint32  `protobuf:"varint,3,opt,name=online_cpus,json=onlineCpus,proto3" json:"online_cpus,omitempty"`
+	// ページキャッシュを除いた実使用量 (bytes)。
+	MemoryUsage    uint64  `protobuf:"varint,4,opt,name=memory_usage,json=memoryUsage,proto3" json:"memory_usage,omitempty"`
+	MemoryLimit    uint64  `protobuf:"varint,5,opt,name=memory_limit,json=memoryLimit,proto3" json:"memory_limit,omitempty"`
+	MemoryPercent  float64 `protobuf:"fixed64,6,opt,name=memory_percent,json=memoryPercent,proto3" json:"memory_percent,omitempty"`
+	NetworkRx      uint64  `protobuf:"varint,7,opt,name=network_rx,json=networkRx,proto3" json:"network_rx,omitempty"`
+	NetworkTx      uint64  `protobuf:"varint,8,opt,name=network_tx,json=networkTx,proto3" json:"network_tx,omitempty"`
+	NetworkRxRate  float64 `protobuf:"fixed64,9,opt,name=network_rx_rate,json=networkRxRate,proto3" json:"network_rx_rate,omitempty"`
+	NetworkTxRate  float64 `protobuf:"fixed64,10,opt,name=network_tx_rate,json=networkTxRate,proto3" json:"network_tx_rate,omitempty"`
+	BlockRead      uint64  `protobuf:"varint,11,opt,name=block_read,json=blockRead,proto3" json:"block_read,omitempty"`
+	BlockWrite     uint64  `protobuf:"varint,12,opt,name=block_write,json=blockWrite,proto3" json:"block_write,omitempty"`
+	BlockReadRate  float64 `protobuf:"fixed64,13,opt,name=block_read_rate,json=blockReadRate,proto3" json:"block_read_rate,omitempty"`
+	BlockWriteRate float64 `protobuf:"fixed64,14,opt,name=block_write_rate,json=blockWriteRate,proto3" json:"block_write_rate,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ContainerStats) Reset() {
+	*x = ContainerStats{}
+	mi := &file_playbin_v1_playbin_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ContainerStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContainerStats) ProtoMessage() {}
+
+func (x *ContainerStats) ProtoReflect() protoreflect.Message {
+	mi := &file_playbin_v1_playbin_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContainerStats.ProtoReflect.Descriptor instead.
+func (*ContainerStats) Descriptor() ([]byte, []int) {
+	return file_playbin_v1_playbin_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ContainerStats) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *ContainerStats) GetCpuPercent() float64 {
+	if x != nil {
+		return x.CpuPercent
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetOnlineCpus() uint32 {
+	if x != nil {
+		return x.OnlineCpus
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetMemoryUsage() uint64 {
+	if x != nil {
+		return x.MemoryUsage
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetMemoryLimit() uint64 {
+	if x != nil {
+		return x.MemoryLimit
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetMemoryPercent() float64 {
+	if x != nil {
+		return x.MemoryPercent
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetNetworkRx() uint64 {
+	if x != nil {
+		return x.NetworkRx
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetNetworkTx() uint64 {
+	if x != nil {
+		return x.NetworkTx
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetNetworkRxRate() float64 {
+	if x != nil {
+		return x.NetworkRxRate
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetNetworkTxRate() float64 {
+	if x != nil {
+		return x.NetworkTxRate
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetBlockRead() uint64 {
+	if x != nil {
+		return x.BlockRead
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetBlockWrite() uint64 {
+	if x != nil {
+		return x.BlockWrite
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetBlockReadRate() float64 {
+	if x != nil {
+		return x.BlockReadRate
+	}
+	return 0
+}
+
+func (x *ContainerStats) GetBlockWriteRate() float64 {
+	if x != nil {
+		return x.BlockWriteRate
+	}
+	return 0
+}
+
+var File_playbin_v1_playbin_proto protoreflect.FileDescriptor
+
+const file_playbin_v1_playbin_proto_rawDesc = "" +
+	"\n" +
+	"\x18playbin/v1/playbin.proto\x12\n" +
+	"playbin.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"F\n" +
+	"\fLoginRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"%\n" +
+	"\rLoginResponse\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\"Y\n" +
+	"\x15ListContainersRequest\x12\x16\n" +
+	"\x06states\x18\x01 \x03(\tR\x06states\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05stats\x18\x03 \x01(\bR\x05stats\"O\n" +
+	"\x16ListContainersResponse\x125\n" +
+	"\n" +
+	"containers\x18\x01 \x03(\v2\x15.playbin.v1.ContainerR\n" +
+	"containers\"\x82\x02\n" +
+	"\tContainer\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04host\x18\x03 \x01(\tR\x04host\x12\x14\n" +
+	"\x05state\x18\x04 \x01(\tR\x05state\x12\x18\n" +
+	"\aactions\x18\x05 \x03(\tR\aactions\x12 \n" +
+	"\vpermissions\x18\x06 \x03(\tR\vpermissions\x129\n" +
+	"\n" +
+	"started_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x120\n" +
+	"\x05stats\x18\b \x01(\v2\x1a.playbin.v1.ContainerStatsR\x05stats\"b\n" +
+	"\x10RunActionRequest\x12\x16\n" +
+	"\x06server\x18\x01 \x01(\tR\x06server\x12\x16\n" +
+	"\x06action\x18\x02 \x01(\tR\x06action\x12\x1e\n" +
+	"\n" +
+	"generation\x18\x03 \x01(\tR\n" +
+	"generation\"\xb3\x02\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06server\x18\x02 \x01(\tR\x06server\x12\x16\n" +
+	"\x06action\x18\x03 \x01(\tR\x06action\x12-\n" +
+	"\x06status\x18\x04 \x01(\x0e2\x15.playbin.v1.JobStatusR\x06status\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\x129\n" +
+	"\n" +
+	"started_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x10\n" +
+	"\x03log\x18\b \x03(\tR\x03log\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\t \x01(\tR\trequestId\")\n" +
+	"\x0fListJobsRequest\x12\x16\n" +
+	"\x06server\x18\x01 \x01(\tR\x06server\"7\n" +
+	"\x10ListJobsResponse\x12#\n" +
+	"\x04jobs\x18\x01 \x03(\v2\x0f.playbin.v1.JobR\x04jobs\"\x1f\n" +
+	"\rGetJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"*\n" +
+	"\x10WatchJobsRequest\x12\x16\n" +
+	"\x06server\x18\x01 \x01(\tR\x06server\",\n" +
+	"\x12StreamStatsRequest\x12\x16\n" +
+	"\x06server\x18\x01 \x01(\tR\x06server\"\x8f\x04\n" +
+	"\x0eContainerStats\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1f\n" +
+	"\vcpu_percent\x18\x02 \x01(\x01R\n" +
+	"cpuPercent\x12\x1f\n" +
+	"\vonline_cpus\x18\x03 \x01(\rR\n" +
+	"onlineCpus\x12!\n" +
+	"\fmemory_usage\x18\x04 \x01(\x04R\vmemoryUsage\x12!\n" +
+	"\fmemory_limit\x18\x05 \x01(\x04R\vmemoryLimit\x12%\n" +
+	"\x0ememory_percent\x18\x06 \x01(\x01R\rmemoryPercent\x12\x1d\n" +
+	"\n" +
+	"network_rx\x18\a \x01(\x04R\tnetworkRx\x12\x1d\n" +
+	"\n" +
+	"network_tx\x18\b \x01(\x04R\tnetworkTx\x12&\n" +
+	"\x0fnetwork_rx_rate\x18\t \x01(\x01R\rnetworkRxRate\x12&\n" +
+	"\x0fnetwork_tx_rate\x18\n" +
+	" \x01(\x01R\rnetworkTxRate\x12\x1d\n" +
+	"\n" +
+	"block_read\x18\v \x01(\x04R\tblockRead\x12\x1f\n" +
+	"\vblock_write\x18\f \x01(\x04R\n" +
+	"blockWrite\x12&\n" +
+	"\x0fblock_read_rate\x18\r \x01(\x01R\rblockReadRate\x12(\n" +
+	"\x10block_write_rate\x18\x0e \x01(\x01R\x0eblockWriteRate*p\n" +
+	"\tJobStatus\x12\x1a\n" +
+	"\x16JOB_STATUS_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12JOB_STATUS_RUNNING\x10\x01\x12\x18\n" +
+	"\x14JOB_STATUS_SUCCEEDED\x10\x02\x12\x15\n" +
+	"\x11JOB_STATUS_FAILED\x10\x032\xe6\x03\n" +
+	"\aPlayBin\x12<\n" +
+	"\x05Login\x12\x18.playbin.v1.LoginRequest\x1a\x19.playbin.v1.LoginResponse\x12W\n" +
+	"\x0eListContainers\x12!.playbin.v1.ListContainersRequest\x1a\".playbin.v1.ListContainersResponse\x12<\n" +
+	"\tRunAction\x12\x1c.playbin.v1.RunActionRequest\x1a\x0f.playbin.v1.Job0\x01\x12E\n" +
+	"\bListJobs\x12\x1b.playbin.v1.ListJobsRequest\x1a\x1c.playbin.v1.ListJobsResponse\x124\n" +
+	"\x06GetJob\x12\x19.playbin.v1.GetJobRequest\x1a\x0f.playbin.v1.Job\x12<\n" +
+	"\tWatchJobs\x12\x1c.playbin.v1.WatchJobsRequest\x1a\x0f.playbin.v1.Job0\x01\x12K\n" +
+	"\vStreamStats\x12\x1e.playbin.v1.StreamStatsRequest\x1a\x1a.playbin.v1.ContainerStats0\x01B-Z+github.com/play-bin/pkg/playbinpb;playbinpbb\x06proto3"
+
+var (
+	file_playbin_v1_playbin_proto_rawDescOnce sync.Once
+	file_playbin_v1_playbin_proto_rawDescData []byte
+)
+
+func file_playbin_v1_playbin_proto_rawDescGZIP() []byte {
+	file_playbin_v1_playbin_proto_rawDescOnce.Do(func() {
+		file_playbin_v1_playbin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_playbin_v1_playbin_proto_rawDesc), len(file_playbin_v1_playbin_proto_rawDesc)))
+	})
+	return file_playbin_v1_playbin_proto_rawDescData
+}
+
+var file_playbin_v1_playbin_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_playbin_v1_playbin_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_playbin_v1_playbin_proto_goTypes = []any{
+	(JobStatus)(0),                 // 0: playbin.v1.JobStatus
+	(*LoginRequest)(nil),           // 1: playbin.v1.LoginRequest
+	(*LoginResponse)(nil),          // 2: playbin.v1.LoginResponse
+	(*ListContainersRequest)(nil),  // 3: playbin.v1.ListContainersRequest
+	(*ListContainersResponse)(nil), // 4: playbin.v1.ListContainersResponse
+	(*Container)(nil),              // 5: playbin.v1.Container
+	(*RunActionRequest)(nil),       // 6: playbin.v1.RunActionRequest
+	(*Job)(nil),                    // 7: playbin.v1.Job
+	(*ListJobsRequest)(nil),        // 8: playbin.v1.ListJobsRequest
+	(*ListJobsResponse)(nil),       // 9: playbin.v1.ListJobsResponse
+	(*GetJobRequest)(nil),          // 10: playbin.v1.GetJobRequest
+	(*WatchJobsRequest)(nil),       // 11: playbin.v1.WatchJobsRequest
+	(*StreamStatsRequest)(nil),     // 12: playbin.v1.StreamStatsRequest
+	(*ContainerStats)(nil),         // 13: playbin.v1.ContainerStats
+	(*timestamppb.Timestamp)(nil),  // 14: google.protobuf.Timestamp
+}
+var file_playbin_v1_playbin_proto_depIdxs = []int32{
+	5,  // 0: playbin.v1.ListContainersResponse.containers:type_name -> playbin.v1.Container
+	14, // 1: playbin.v1.Container.started_at:type_name -> google.protobuf.Timestamp
+	13, // 2: playbin.v1.Container.stats:type_name -> playbin.v1.ContainerStats
+	0,  // 3: playbin.v1.Job.status:type_name -> playbin.v1.JobStatus
+	14, // 4: playbin.v1.Job.started_at:type_name -> google.protobuf.Timestamp
+	14, // 5: playbin.v1.Job.finished_at:type_name -> google.protobuf.Timestamp
+	7,  // 6: playbin.v1.ListJobsResponse.jobs:type_name -> playbin.v1.Job
+	14, // 7: playbin.v1.ContainerStats.time:type_name -> google.protobuf.Timestamp
+	1,  // 8: playbin.v1.PlayBin.Login:input_type -> playbin.v1.LoginRequest
+	3,  // 9: playbin.v1.PlayBin.ListContainers:input_type -> playbin.v1.ListContainersRequest
+	6,  // 10: playbin.v1.PlayBin.RunAction:input_type -> playbin.v1.RunActionRequest
+	8,  // 11: playbin.v1.PlayBin.ListJobs:input_type -> playbin.v1.ListJobsRequest
+	10, // 12: playbin.v1.PlayBin.GetJob:input_type -> playbin.v1.GetJobRequest
+	11, // 13: playbin.v1.PlayBin.WatchJobs:input_type -> playbin.v1.WatchJobsRequest
+	12, // 14: playbin.v1.PlayBin.StreamStats:input_type -> playbin.v1.StreamStatsRequest
+	2,  // 15: playbin.v1.PlayBin.Login:output_type -> playbin.v1.LoginResponse
+	4,  // 16: playbin.v1.PlayBin.ListContainers:output_type -> playbin.v1.ListContainersResponse
+	7,  // 17: playbin.v1.PlayBin.RunAction:output_type -> playbin.v1.Job
+	9,  // 18: playbin.v1.PlayBin.ListJobs:output_type -> playbin.v1.ListJobsResponse
+	7,  // 19: playbin.v1.PlayBin.GetJob:output_type -> playbin.v1.Job
+	7,  // 20: playbin.v1.PlayBin.WatchJobs:output_type -> playbin.v1.Job
+	13, // 21: playbin.v1.PlayBin.StreamStats:output_type -> playbin.v1.ContainerStats
+	15, // [15:22] is the sub-list for method output_type
+	8,  // [8:15] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_playbin_v1_playbin_proto_init() }
+func file_playbin_v1_playbin_proto_init() {
+	if File_playbin_v1_playbin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_playbin_v1_playbin_proto_rawDesc), len(file_playbin_v1_playbin_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_playbin_v1_playbin_proto_goTypes,
+		DependencyIndexes: file_playbin_v1_playbin_proto_depIdxs,
+		EnumInfos:         file_playbin_v1_playbin_proto_enumTypes,
+		MessageInfos:      file_playbin_v1_playbin_proto_msgTypes,
+	}.Build()
+	File_playbin_v1_playbin_proto = out.File
+	file_playbin_v1_playbin_proto_goTypes = nil
+	file_playbin_v1_playbin_proto_depIdxs = nil
+}
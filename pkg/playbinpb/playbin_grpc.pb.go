@@ -0,0 +1,381 @@
+// play-bin の管理 API (gRPC)。
+// HTTP API と同じセッショントークン・権限で、コンテナの一覧と操作、ジョブの参照、統計情報のストリーミングを提供する。
+// Login 以外の呼び出しには、メタデータ authorization にトークン (先頭の "Bearer " は省略可) を付与する。
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: playbin/v1/playbin.proto
+
+package playbinpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PlayBin_Login_FullMethodName          = "/playbin.v1.PlayBin/Login"
+	PlayBin_ListContainers_FullMethodName = "/playbin.v1.PlayBin/ListContainers"
+	PlayBin_RunAction_FullMethodName      = "/playbin.v1.PlayBin/RunAction"
+	PlayBin_ListJobs_FullMethodName       = "/playbin.v1.PlayBin/ListJobs"
+	PlayBin_GetJob_FullMethodName         = "/playbin.v1.PlayBin/GetJob"
+	PlayBin_WatchJobs_FullMethodName      = "/playbin.v1.PlayBin/WatchJobs"
+	PlayBin_StreamStats_FullMethodName    = "/playbin.v1.PlayBin/StreamStats"
+)
+
+// PlayBinClient is the client API for PlayBin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PlayBinClient interface {
+	// ユーザー名とパスワードを検証し、セッショントークンを発行する。HTTP API の /api/login と同じトークンを使用する。
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	// 閲覧権限のあるコンテナの一覧を返す。
+	ListContainers(ctx context.Context, in *ListContainersRequest, opts ...grpc.CallOption) (*ListContainersResponse, error)
+	// コンテナへの操作を開始し、ジョブの進捗を完了まで配信する。
+	// 操作の失敗は最後に配信するジョブの status (JOB_STATUS_FAILED) と error で通知する。
+	// 呼び出し元が切断しても操作は中断しない。
+	RunAction(ctx context.Context, in *RunActionRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error)
+	// 保持している直近のジョブを新しい順で返す。
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// 指定 ID のジョブを返す。
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// ジョブの状態の変化を配信する。
+	WatchJobs(ctx context.Context, in *WatchJobsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error)
+	// コンテナの統計情報を、Docker から受信するたび (約 1 秒間隔) に配信する。
+	StreamStats(ctx context.Context, in *StreamStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ContainerStats], error)
+}
+
+type playBinClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPlayBinClient(cc grpc.ClientConnInterface) PlayBinClient {
+	return &playBinClient{cc}
+}
+
+func (c *playBinClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, PlayBin_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *playBinClient) ListContainers(ctx context.Context, in *ListContainersRequest, opts ...grpc.CallOption) (*ListContainersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListContainersResponse)
+	err := c.cc.Invoke(ctx, PlayBin_ListContainers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *playBinClient) RunAction(ctx context.Context, in *RunActionRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PlayBin_ServiceDesc.Streams[0], PlayBin_RunAction_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RunActionRequest, Job]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlayBin_RunActionClient = grpc.ServerStreamingClient[Job]
+
+func (c *playBinClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, PlayBin_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *playBinClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, PlayBin_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *playBinClient) WatchJobs(ctx context.Context, in *WatchJobsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PlayBin_ServiceDesc.Streams[1], PlayBin_WatchJobs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchJobsRequest, Job]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlayBin_WatchJobsClient = grpc.ServerStreamingClient[Job]
+
+func (c *playBinClient) StreamStats(ctx context.Context, in *StreamStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ContainerStats], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PlayBin_ServiceDesc.Streams[2], PlayBin_StreamStats_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamStatsRequest, ContainerStats]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlayBin_StreamStatsClient = grpc.ServerStreamingClient[ContainerStats]
+
+// PlayBinServer is the server API for PlayBin service.
+// All implementations must embed UnimplementedPlayBinServer
+// for forward compatibility.
+type PlayBinServer interface {
+	// ユーザー名とパスワードを検証し、セッショントークンを発行する。HTTP API の /api/login と同じトークンを使用する。
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// 閲覧権限のあるコンテナの一覧を返す。
+	ListContainers(context.Context, *ListContainersRequest) (*ListContainersResponse, error)
+	// コンテナへの操作を開始し、ジョブの進捗を完了まで配信する。
+	// 操作の失敗は最後に配信するジョブの status (JOB_STATUS_FAILED) と error で通知する。
+	// 呼び出し元が切断しても操作は中断しない。
+	RunAction(*RunActionRequest, grpc.ServerStreamingServer[Job]) error
+	// 保持している直近のジョブを新しい順で返す。
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// 指定 ID のジョブを返す。
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// ジョブの状態の変化を配信する。
+	WatchJobs(*WatchJobsRequest, grpc.ServerStreamingServer[Job]) error
+	// コンテナの統計情報を、Docker から受信するたび (約 1 秒間隔) に配信する。
+	StreamStats(*StreamStatsRequest, grpc.ServerStreamingServer[ContainerStats]) error
+	mustEmbedUnimplementedPlayBinServer()
+}
+
+// UnimplementedPlayBinServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPlayBinServer struct{}
+
+func (UnimplementedPlayBinServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedPlayBinServer) ListContainers(context.Context, *ListContainersRequest) (*ListContainersResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListContainers not implemented")
+}
+func (UnimplementedPlayBinServer) RunAction(*RunActionRequest, grpc.ServerStreamingServer[Job]) error {
+	return status.Error(codes.Unimplemented, "method RunAction not implemented")
+}
+func (UnimplementedPlayBinServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedPlayBinServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedPlayBinServer) WatchJobs(*WatchJobsRequest, grpc.ServerStreamingServer[Job]) error {
+	return status.Error(codes.Unimplemented, "method WatchJobs not implemented")
+}
+func (UnimplementedPlayBinServer) StreamStats(*StreamStatsRequest, grpc.ServerStreamingServer[ContainerStats]) error {
+	return status.Error(codes.Unimplemented, "method StreamStats not implemented")
+}
+func (UnimplementedPlayBinServer) mustEmbedUnimplementedPlayBinServer() {}
+func (UnimplementedPlayBinServer) testEmbeddedByValue()                 {}
+
+// UnsafePlayBinServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PlayBinServer will
+// result in compilation errors.
+type UnsafePlayBinServer interface {
+	mustEmbedUnimplementedPlayBinServer()
+}
+
+func RegisterPlayBinServer(s grpc.ServiceRegistrar, srv PlayBinServer) {
+	// If the following call panics, it indicates UnimplementedPlayBinServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PlayBin_ServiceDesc, srv)
+}
+
+func _PlayBin_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlayBinServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlayBin_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlayBinServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlayBin_ListContainers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListContainersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlayBinServer).ListContainers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlayBin_ListContainers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlayBinServer).ListContainers(ctx, req.(*ListContainersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlayBin_RunAction_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RunActionRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PlayBinServer).RunAction(m, &grpc.GenericServerStream[RunActionRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlayBin_RunActionServer = grpc.ServerStreamingServer[Job]
+
+func _PlayBin_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlayBinServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlayBin_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlayBinServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlayBin_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlayBinServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlayBin_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlayBinServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlayBin_WatchJobs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchJobsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PlayBinServer).WatchJobs(m, &grpc.GenericServerStream[WatchJobsRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlayBin_WatchJobsServer = grpc.ServerStreamingServer[Job]
+
+func _PlayBin_StreamStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PlayBinServer).StreamStats(m, &grpc.GenericServerStream[StreamStatsRequest, ContainerStats]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PlayBin_StreamStatsServer = grpc.ServerStreamingServer[ContainerStats]
+
+// PlayBin_ServiceDesc is the grpc.ServiceDesc for PlayBin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PlayBin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "playbin.v1.PlayBin",
+	HandlerType: (*PlayBinServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Login",
+			Handler:    _PlayBin_Login_Handler,
+		},
+		{
+			MethodName: "ListContainers",
+			Handler:    _PlayBin_ListContainers_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _PlayBin_ListJobs_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _PlayBin_GetJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RunAction",
+			Handler:       _PlayBin_RunAction_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchJobs",
+			Handler:       _PlayBin_WatchJobs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamStats",
+			Handler:       _PlayBin_StreamStats_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "playbin/v1/playbin.proto",
+}
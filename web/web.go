@@ -0,0 +1,8 @@
+package web
+
+import "embed"
+
+// Assets は管理用 Web UI の静的ファイル。バイナリへ埋め込み、作業ディレクトリの内容 (設定ファイルや鍵、バックアップ等) を HTTP で公開しないようにする。
+//
+//go:embed index.html share.html status.html
+var Assets embed.FS